@@ -506,6 +506,17 @@ function TransactionCard({ tx, index }: TransactionCardProps) {
         </Text>
       </Box>
 
+      {tx.memo && (
+        <Box mb={3}>
+          <Text fontSize="xs" color="fg.muted" mb={1}>
+            备注
+          </Text>
+          <Text fontSize="sm" wordBreak="break-all">
+            {tx.memo}
+          </Text>
+        </Box>
+      )}
+
       <Grid templateColumns="1fr auto 1fr" gap={4} alignItems="start">
         {/* 输入 */}
         <Box>
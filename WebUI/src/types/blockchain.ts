@@ -30,6 +30,7 @@ export interface TransactionOutput {
   inputs: TxInput[];
   outputs: TxOutput[];
   is_coinbase: boolean;
+  memo?: string;
 }
 
 export interface BlockOutput {
@@ -0,0 +1,21 @@
+// Blockchain is the single binary for running and using the network: each
+// subcommand shares the configuration file, logging, and chain params flags
+package main
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/cli/attack"
+	"blockchain/pkg/cli/client"
+	"blockchain/pkg/cli/export"
+	"blockchain/pkg/cli/node"
+	"blockchain/pkg/cli/pool"
+	"blockchain/pkg/cli/sim"
+	"blockchain/pkg/cli/spvnode"
+	"blockchain/pkg/cli/stress"
+	"os"
+)
+
+func main() {
+	cli.Main("blockchain", os.Args[1:], node.Command, client.Command, attack.Command, pool.Command,
+		sim.Command, spvnode.Command, export.Command, stress.Command)
+}
@@ -0,0 +1,13 @@
+// Export writes the chain as normalized CSV or Parquet tables for analysis in
+// notebooks; it runs the same command as "blockchain export"
+package main
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/cli/export"
+	"os"
+)
+
+func main() {
+	cli.Standalone("export", export.Command, os.Args[1:])
+}
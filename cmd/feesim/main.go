@@ -0,0 +1,14 @@
+// Feesim runs synthetic wallet agents against a miner and writes datasets of
+// which fees got which transactions included; it runs the same command as
+// "blockchain sim"
+package main
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/cli/sim"
+	"os"
+)
+
+func main() {
+	cli.Standalone("feesim", sim.Command, os.Args[1:])
+}
@@ -0,0 +1,14 @@
+// Spvnode is a light client node that keeps only block headers and verifies
+// transactions from Merkle proofs; it runs the same command as
+// "blockchain spv"
+package main
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/cli/spvnode"
+	"os"
+)
+
+func main() {
+	cli.Standalone("spvnode", spvnode.Command, os.Args[1:])
+}
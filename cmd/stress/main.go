@@ -0,0 +1,14 @@
+// Stress generates blocks packed with signed transactions and reports how long
+// each phase of validating them takes; it runs the same command as
+// "blockchain stress"
+package main
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/cli/stress"
+	"os"
+)
+
+func main() {
+	cli.Standalone("stress", stress.Command, os.Args[1:])
+}
@@ -0,0 +1,310 @@
+// Package access implements role-based access control for the miner's RPC
+// methods. Each API token maps to a role, each role is granted a set of method
+// groups, and a method may only be called by a role granted its group.
+package access
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownRole   = errors.New("unknown role")
+	ErrInvalidToken  = errors.New("invalid API token")
+	ErrAccessDenied  = errors.New("access denied")
+	ErrUnknownMethod = errors.New("method is not in any access group")
+)
+
+// Role is the access level granted to a token
+type Role string
+
+const (
+	RoleNone     Role = "none"     // Peer protocol only
+	RoleObserver Role = "observer" // Read-only chain and node queries
+	RoleWallet   Role = "wallet"   // Observer plus submitting transactions
+	RoleOperator Role = "operator" // Wallet plus mining and peer control
+	RoleAdmin    Role = "admin"    // Everything, including node policy and the audit log
+)
+
+// Group is a set of RPC methods granted together
+type Group string
+
+const (
+	GroupPeer   Group = "peer"   // Block and transaction gossip and chain sync between miners
+	GroupRead   Group = "read"   // Chain, mempool, and node queries
+	GroupWallet Group = "wallet" // Submitting and mixing transactions
+	GroupMining Group = "mining" // Starting and stopping mining, and mining for the node externally
+	GroupPeers  Group = "peers"  // Changing the peer list
+	GroupPolicy Group = "policy" // Changing relay and mining policy
+	GroupAudit  Group = "audit"  // Reading the audit log
+)
+
+// methodGroups assigns every RPCService method to its group. Methods missing
+// here are denied to every role but admin.
+var methodGroups = map[string]Group{
+	"Authenticate":       GroupPeer,
+	"ReceiveBlock":       GroupPeer,
+	"ReceiveTransaction": GroupPeer,
+	"Inv":                GroupPeer,
+	"GetChain":           GroupPeer,
+	"GetHeaders":         GroupPeer,
+	"Handshake":          GroupPeer,
+	"AnnouncePeer":       GroupPeer,
+
+	"GetStatus":         GroupRead,
+	"GetBlock":          GroupRead,
+	"GetTransaction":    GroupRead,
+	"GetSpendingTx":     GroupRead,
+	"GetAddress":        GroupRead,
+	"GetBalance":        GroupRead,
+	"GetUTXOs":          GroupRead,
+	"GetUTXOSnapshot":   GroupRead,
+	"TraceTransaction":  GroupRead,
+	"Search":            GroupRead,
+	"GetSupply":         GroupRead,
+	"GetMinerBlocks":    GroupRead,
+	"GetLeaderboard":    GroupRead,
+	"GetWorkStats":      GroupRead,
+	"GetSyncStats":      GroupRead,
+	"GetDeprecations":   GroupRead,
+	"GetMemoryUsage":    GroupRead,
+	"GetResourceStatus": GroupRead,
+	"GetStandbyStatus":  GroupRead,
+	"GetForkReports":    GroupRead,
+	"GetTxJournal":      GroupRead,
+	"GetTxStatus":       GroupRead,
+	"GetCheckpoint":     GroupRead,
+	"GetMerkleProof":    GroupRead,
+	"GetSPVProof":       GroupRead,
+	"GetEvents":         GroupRead,
+	"GetBandwidth":      GroupRead,
+	"GetBlacklist":      GroupRead,
+	"GetPeers":          GroupRead,
+	"GetPeerInfo":       GroupRead,
+	"CoinJoinGetRound":  GroupRead,
+
+	"SubmitTransaction":    GroupWallet,
+	"SubmitRawTransaction": GroupWallet,
+	"CoinJoinRegister":     GroupWallet,
+	"CoinJoinSign":         GroupWallet,
+
+	"SetMining":        GroupMining,
+	"GetBlockTemplate": GroupMining,
+	"SubmitBlock":      GroupMining,
+
+	"UpdatePeers": GroupPeers,
+
+	"UpdateBlacklist": GroupPolicy,
+
+	"GetAuditLog": GroupAudit,
+}
+
+// mutatingGroups are the groups whose methods change node state
+var mutatingGroups = map[Group]bool{
+	GroupWallet: true,
+	GroupMining: true,
+	GroupPeers:  true,
+	GroupPolicy: true,
+}
+
+// roleGroups lists the groups each role may call
+var roleGroups = map[Role][]Group{
+	RoleNone:     {GroupPeer},
+	RoleObserver: {GroupPeer, GroupRead},
+	RoleWallet:   {GroupPeer, GroupRead, GroupWallet},
+	RoleOperator: {GroupPeer, GroupRead, GroupWallet, GroupMining, GroupPeers},
+	RoleAdmin:    {GroupPeer, GroupRead, GroupWallet, GroupMining, GroupPeers, GroupPolicy, GroupAudit},
+}
+
+// ParseRole returns the role named s
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleGroups[r]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRole, s)
+	}
+	return r, nil
+}
+
+// MethodGroup returns the group of an RPC method name, with or without the
+// "RPCService." prefix
+func MethodGroup(method string) (Group, bool) {
+	g, ok := methodGroups[method[strings.LastIndexByte(method, '.')+1:]]
+	return g, ok
+}
+
+// Mutating reports whether method changes node state. Methods in no group are
+// treated as mutating.
+func Mutating(method string) bool {
+	g, ok := MethodGroup(method)
+	return !ok || mutatingGroups[g]
+}
+
+// Allowed returns nil if role may call method, or why it may not
+func Allowed(role Role, method string) error {
+	g, ok := MethodGroup(method)
+	if !ok {
+		if role == RoleAdmin {
+			return nil
+		}
+		return fmt.Errorf("%w: %s: %w", ErrAccessDenied, method, ErrUnknownMethod)
+	}
+	for _, granted := range roleGroups[role] {
+		if granted == g {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s requires the %s group, role %s does not have it", ErrAccessDenied, method, g, role)
+}
+
+// Groups returns the groups granted to role
+func Groups(role Role) []Group {
+	return append([]Group(nil), roleGroups[role]...)
+}
+
+// PolicyFile is the JSON form of a Policy
+type PolicyFile struct {
+	Anonymous string            `json:"anonymous"` // Role of connections without a token (default: observer)
+	Tokens    map[string]string `json:"tokens"`    // API token -> role
+	Keys      map[string]string `json:"keys"`      // Hex public key of signed requests -> role
+}
+
+// Policy maps API tokens and signing keys to roles. Connections that have not
+// authenticated get the anonymous role.
+type Policy struct {
+	anonymous Role
+	tokens    map[string]Role
+	keys      map[string]Role
+	mu        sync.RWMutex
+
+	nonces  map[string]time.Time // Nonces of accepted signed requests -> expiry
+	nonceMu sync.Mutex
+}
+
+// NewPolicy creates a policy with no tokens or keys whose anonymous role is anonymous
+func NewPolicy(anonymous Role) *Policy {
+	return &Policy{
+		anonymous: anonymous,
+		tokens:    make(map[string]Role),
+		keys:      make(map[string]Role),
+		nonces:    make(map[string]time.Time),
+	}
+}
+
+// LoadPolicy reads a policy from a JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access policy: %v", err)
+	}
+	var file PolicyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse access policy: %v", err)
+	}
+
+	anonymous := RoleObserver
+	if file.Anonymous != "" {
+		if anonymous, err = ParseRole(file.Anonymous); err != nil {
+			return nil, fmt.Errorf("anonymous role: %w", err)
+		}
+	}
+	p := NewPolicy(anonymous)
+	for token, name := range file.Tokens {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", redact(token), err)
+		}
+		if err := p.SetToken(token, role); err != nil {
+			return nil, err
+		}
+	}
+	for key, name := range file.Keys {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", KeyID(key), err)
+		}
+		if err := p.SetKey(key, role); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// SetToken grants role to token, replacing any role it had
+func (p *Policy) SetToken(token string, role Role) error {
+	if token == "" {
+		return fmt.Errorf("%w: empty token", ErrInvalidToken)
+	}
+	if _, ok := roleGroups[role]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownRole, role)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[token] = role
+	return nil
+}
+
+// RevokeToken removes token; connections already authenticated keep their role
+func (p *Policy) RevokeToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.tokens, token)
+}
+
+// Anonymous returns the role of connections that have not authenticated
+func (p *Policy) Anonymous() Role {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.anonymous
+}
+
+// Authenticate returns the role granted to token
+func (p *Policy) Authenticate(token string) (Role, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	role, ok := p.tokens[token]
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	return role, nil
+}
+
+// RoleCounts returns how many tokens and keys hold each role, sorted by role name
+func (p *Policy) RoleCounts() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	counts := make(map[Role]int)
+	for _, role := range p.tokens {
+		counts[role]++
+	}
+	for _, role := range p.keys {
+		counts[role]++
+	}
+	out := make([]string, 0, len(counts))
+	for role, n := range counts {
+		out = append(out, fmt.Sprintf("%s=%d", role, n))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// TokenID identifies a token in logs without revealing it
+func TokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// redact shortens a token for error messages
+func redact(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return token[:4] + "****"
+}
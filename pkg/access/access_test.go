@@ -0,0 +1,80 @@
+package access
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllowedByRole(t *testing.T) {
+	tests := []struct {
+		role    Role
+		method  string
+		allowed bool
+	}{
+		{RoleNone, "RPCService.ReceiveBlock", true},
+		{RoleNone, "RPCService.GetStatus", false},
+		{RoleObserver, "RPCService.GetChain", true},
+		{RoleObserver, "RPCService.SubmitTransaction", false},
+		{RoleWallet, "RPCService.SubmitTransaction", true},
+		{RoleWallet, "RPCService.SetMining", false},
+		{RoleOperator, "RPCService.SetMining", true},
+		{RoleOperator, "RPCService.UpdatePeers", true},
+		{RoleOperator, "RPCService.UpdateBlacklist", false},
+		{RoleAdmin, "RPCService.UpdateBlacklist", true},
+		{RoleOperator, "RPCService.NotAMethod", false},
+		{RoleAdmin, "RPCService.NotAMethod", true},
+	}
+	for _, tt := range tests {
+		err := Allowed(tt.role, tt.method)
+		if (err == nil) != tt.allowed {
+			t.Errorf("Allowed(%s, %s) = %v, want allowed=%v", tt.role, tt.method, err, tt.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("Expected ErrAccessDenied, got %v", err)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	data := `{"anonymous": "none", "tokens": {"ta-secret": "operator", "student": "wallet"}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+	if p.Anonymous() != RoleNone {
+		t.Errorf("Expected anonymous role none, got %s", p.Anonymous())
+	}
+	if role, err := p.Authenticate("ta-secret"); err != nil || role != RoleOperator {
+		t.Errorf("Expected operator for ta-secret, got %s, %v", role, err)
+	}
+	if _, err := p.Authenticate("guess"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an unknown token, got %v", err)
+	}
+
+	p.RevokeToken("student")
+	if _, err := p.Authenticate("student"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Revoked token should no longer authenticate, got %v", err)
+	}
+}
+
+func TestLoadPolicyRejectsUnknownRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	if err := os.WriteFile(path, []byte(`{"tokens": {"secret-token": "root"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadPolicy(path)
+	if !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("Expected ErrUnknownRole, got %v", err)
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Error should not reveal the token: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package access
+
+import (
+	"blockchain/pkg/transaction"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SignatureWindow is how far a signed request's timestamp may be from the
+// miner's clock. Nonces are remembered for as long, so a captured request
+// cannot be replayed while its timestamp is still accepted.
+const SignatureWindow = 2 * time.Minute
+
+var (
+	ErrInvalidKey       = errors.New("invalid signing key")
+	ErrInvalidSignature = errors.New("invalid request signature")
+	ErrStaleSignature   = errors.New("request signature timestamp outside the accepted window")
+	ErrReplayedNonce    = errors.New("request nonce already used")
+)
+
+// Signed authenticates a request by a key registered with the miner instead
+// of a bearer token. The caller signs the request's scope, timestamp, and a
+// random nonce with its private key; the miner only stores the public key.
+type Signed struct {
+	PublicKey string // Hex public key, as registered in the policy
+	Timestamp int64  // Unix seconds when the request was signed
+	Nonce     string // Random hex, never reused
+	Signature string // Hex ECDSA signature of SignedMessage
+}
+
+// SignedMessage is the data signed for a request. The scope names what is
+// being authorized (for example the RPC Authenticate call or one HTTP request)
+// so a signature for one cannot be presented as another.
+func SignedMessage(scope string, timestamp int64, nonce string) string {
+	return "blockchain-auth\n" + scope + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce
+}
+
+// Sign signs scope with a hex private key, using the current time and a fresh nonce
+func Sign(privateKeyHex, scope string) (Signed, error) {
+	key, err := transaction.HexToPrivateKey(privateKeyHex)
+	if err != nil {
+		return Signed{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Signed{}, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	s := Signed{
+		PublicKey: transaction.PublicKeyToHex(&key.PublicKey),
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(buf),
+	}
+	s.Signature, err = transaction.SignECDSA(SignedMessage(scope, s.Timestamp, s.Nonce), privateKeyHex)
+	if err != nil {
+		return Signed{}, err
+	}
+	return s, nil
+}
+
+// SetKey grants role to requests signed by a hex public key
+func (p *Policy) SetKey(publicKeyHex string, role Role) error {
+	if _, err := transaction.HexToPublicKey(publicKeyHex); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidKey, KeyID(publicKeyHex), err)
+	}
+	if _, ok := roleGroups[role]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownRole, role)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys[publicKeyHex] = role
+	return nil
+}
+
+// RevokeKey removes a public key; connections already authenticated keep their role
+func (p *Policy) RevokeKey(publicKeyHex string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.keys, publicKeyHex)
+}
+
+// AuthenticateSigned returns the role granted to the key that signed scope.
+// The signature must be valid, recent, and carry a nonce not seen before.
+func (p *Policy) AuthenticateSigned(s Signed, scope string) (Role, error) {
+	p.mu.RLock()
+	role, ok := p.keys[s.PublicKey]
+	p.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key %s", ErrInvalidSignature, KeyID(s.PublicKey))
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(s.Timestamp, 0)
+	if signedAt.Before(now.Add(-SignatureWindow)) || signedAt.After(now.Add(SignatureWindow)) {
+		return "", ErrStaleSignature
+	}
+	if s.Nonce == "" || !transaction.VerifyECDSA(SignedMessage(scope, s.Timestamp, s.Nonce), s.Signature, s.PublicKey) {
+		return "", ErrInvalidSignature
+	}
+	if !p.useNonce(s.PublicKey+"/"+s.Nonce, signedAt.Add(SignatureWindow), now) {
+		return "", ErrReplayedNonce
+	}
+	return role, nil
+}
+
+// useNonce records a nonce until expires, reporting false if it was already
+// recorded. Expired nonces are dropped as new ones arrive.
+func (p *Policy) useNonce(nonce string, expires, now time.Time) bool {
+	p.nonceMu.Lock()
+	defer p.nonceMu.Unlock()
+	if _, seen := p.nonces[nonce]; seen {
+		return false
+	}
+	for n, exp := range p.nonces {
+		if exp.Before(now) {
+			delete(p.nonces, n)
+		}
+	}
+	p.nonces[nonce] = expires
+	return true
+}
+
+// KeyID identifies a public key in logs by a short SHA-256 prefix
+func KeyID(publicKeyHex string) string {
+	sum := sha256.Sum256([]byte(publicKeyHex))
+	return "key:" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,85 @@
+package access
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSigningKey(t *testing.T) *transaction.KeyPair {
+	t.Helper()
+	kp, err := transaction.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func TestAuthenticateSigned(t *testing.T) {
+	bot := newSigningKey(t)
+	p := NewPolicy(RoleNone)
+	if err := p.SetKey(bot.GetPublicKeyHex(), RoleOperator); err != nil {
+		t.Fatalf("SetKey failed: %v", err)
+	}
+
+	s, err := Sign(bot.GetPrivateKeyHex(), "RPCService.Authenticate")
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if role, err := p.AuthenticateSigned(s, "RPCService.Authenticate"); err != nil || role != RoleOperator {
+		t.Fatalf("Expected operator, got %s, %v", role, err)
+	}
+	if _, err := p.AuthenticateSigned(s, "RPCService.Authenticate"); !errors.Is(err, ErrReplayedNonce) {
+		t.Errorf("Expected ErrReplayedNonce for a replayed request, got %v", err)
+	}
+
+	other, _ := Sign(bot.GetPrivateKeyHex(), "POST /api/transactions")
+	if _, err := p.AuthenticateSigned(other, "RPCService.Authenticate"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a signature of another scope, got %v", err)
+	}
+
+	stranger, _ := Sign(newSigningKey(t).GetPrivateKeyHex(), "RPCService.Authenticate")
+	if _, err := p.AuthenticateSigned(stranger, "RPCService.Authenticate"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for an unregistered key, got %v", err)
+	}
+
+	// A correctly signed but old request is refused
+	stale := Signed{PublicKey: bot.GetPublicKeyHex(), Timestamp: time.Now().Add(-2 * SignatureWindow).Unix(), Nonce: "00ff"}
+	stale.Signature, _ = transaction.SignECDSA(SignedMessage("RPCService.Authenticate", stale.Timestamp, stale.Nonce), bot.GetPrivateKeyHex())
+	if _, err := p.AuthenticateSigned(stale, "RPCService.Authenticate"); !errors.Is(err, ErrStaleSignature) {
+		t.Errorf("Expected ErrStaleSignature, got %v", err)
+	}
+
+	p.RevokeKey(bot.GetPublicKeyHex())
+	fresh, _ := Sign(bot.GetPrivateKeyHex(), "RPCService.Authenticate")
+	if _, err := p.AuthenticateSigned(fresh, "RPCService.Authenticate"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Revoked key should no longer authenticate, got %v", err)
+	}
+}
+
+func TestLoadPolicyKeys(t *testing.T) {
+	bot := newSigningKey(t)
+	path := filepath.Join(t.TempDir(), "access.json")
+	data := `{"anonymous": "none", "keys": {"` + bot.GetPublicKeyHex() + `": "observer"}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+	s, _ := Sign(bot.GetPrivateKeyHex(), "scope")
+	if role, err := p.AuthenticateSigned(s, "scope"); err != nil || role != RoleObserver {
+		t.Errorf("Expected observer, got %s, %v", role, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"keys": {"not-a-key": "observer"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPolicy(path); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected an error for an invalid public key, got %v", err)
+	}
+}
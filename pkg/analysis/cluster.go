@@ -0,0 +1,185 @@
+// Package analysis implements chain analysis heuristics used to demonstrate
+// how address reuse and transaction structure leak ownership
+package analysis
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"fmt"
+	"sort"
+)
+
+// Heuristic names an address-clustering heuristic
+type Heuristic string
+
+const (
+	// HeuristicMultiInput assumes all inputs of a transaction share one owner
+	HeuristicMultiInput Heuristic = "multi-input"
+
+	// HeuristicChange assumes the only never-before-seen output address of a
+	// multi-output transaction is change belonging to the sender
+	HeuristicChange Heuristic = "change"
+
+	// HeuristicMinerID assumes coinbases of blocks with the same MinerID share
+	// one owner, which defeats payout address rotation
+	HeuristicMinerID Heuristic = "miner-id"
+)
+
+// AllHeuristics lists every supported heuristic
+var AllHeuristics = []Heuristic{HeuristicMultiInput, HeuristicChange, HeuristicMinerID}
+
+// Cluster is a set of addresses presumed to share one owner
+type Cluster struct {
+	Addresses []string          `json:"addresses"`
+	Balance   int64             `json:"balance"`
+	Links     map[Heuristic]int `json:"links"` // Merges performed by each heuristic
+}
+
+// ParseHeuristic validates a heuristic name
+func ParseHeuristic(name string) (Heuristic, error) {
+	for _, h := range AllHeuristics {
+		if string(h) == name {
+			return h, nil
+		}
+	}
+	return "", fmt.Errorf("unknown heuristic: %s", name)
+}
+
+// clusterer is a union-find over addresses
+type clusterer struct {
+	parent map[string]string
+	links  map[string]map[Heuristic]int // root -> merges attributed per heuristic
+}
+
+func (c *clusterer) add(addr string) {
+	if _, ok := c.parent[addr]; !ok {
+		c.parent[addr] = addr
+	}
+}
+
+func (c *clusterer) find(addr string) string {
+	for c.parent[addr] != addr {
+		c.parent[addr] = c.parent[c.parent[addr]]
+		addr = c.parent[addr]
+	}
+	return addr
+}
+
+func (c *clusterer) union(a, b string, h Heuristic) {
+	c.add(a)
+	c.add(b)
+	ra, rb := c.find(a), c.find(b)
+	if ra == rb {
+		return
+	}
+	c.parent[rb] = ra
+
+	merged := c.links[ra]
+	if merged == nil {
+		merged = make(map[Heuristic]int)
+		c.links[ra] = merged
+	}
+	for k, v := range c.links[rb] {
+		merged[k] += v
+	}
+	delete(c.links, rb)
+	merged[h]++
+}
+
+// ClusterAddresses groups every address on the chain into clusters using the
+// given heuristics, largest cluster first
+func ClusterAddresses(blocks []*block.Block, heuristics []Heuristic) []*Cluster {
+	enabled := make(map[Heuristic]bool)
+	for _, h := range heuristics {
+		enabled[h] = true
+	}
+
+	c := &clusterer{
+		parent: make(map[string]string),
+		links:  make(map[string]map[Heuristic]int),
+	}
+	owners := make(map[string]string) // "txid:index" -> address
+	seen := make(map[string]bool)
+	minerPayee := make(map[string]string) // MinerID -> first coinbase address
+	utxoSet := transaction.NewUTXOSet()
+
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if tx.IsCoinbase() {
+				for _, out := range tx.Outputs {
+					c.add(out.ScriptPubKey)
+					if !enabled[HeuristicMinerID] || b.MinerID == "" {
+						continue
+					}
+					if first, ok := minerPayee[b.MinerID]; ok {
+						c.union(first, out.ScriptPubKey, HeuristicMinerID)
+					} else {
+						minerPayee[b.MinerID] = out.ScriptPubKey
+					}
+				}
+			} else {
+				var inputAddrs []string
+				for _, in := range tx.Inputs {
+					if addr, ok := owners[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)]; ok {
+						inputAddrs = append(inputAddrs, addr)
+					}
+				}
+				if enabled[HeuristicMultiInput] {
+					for i := 1; i < len(inputAddrs); i++ {
+						c.union(inputAddrs[0], inputAddrs[i], HeuristicMultiInput)
+					}
+				}
+
+				if enabled[HeuristicChange] && len(inputAddrs) > 0 && len(tx.Outputs) > 1 {
+					var fresh []string
+					for _, out := range tx.Outputs {
+						if !seen[out.ScriptPubKey] {
+							fresh = append(fresh, out.ScriptPubKey)
+						}
+					}
+					if len(fresh) == 1 {
+						c.union(inputAddrs[0], fresh[0], HeuristicChange)
+					}
+				}
+
+				for _, out := range tx.Outputs {
+					c.add(out.ScriptPubKey)
+				}
+			}
+
+			for i, out := range tx.Outputs {
+				owners[fmt.Sprintf("%s:%d", tx.ID, i)] = out.ScriptPubKey
+				seen[out.ScriptPubKey] = true
+			}
+			utxoSet.ProcessTransaction(tx)
+		}
+	}
+
+	byRoot := make(map[string]*Cluster)
+	for addr := range c.parent {
+		root := c.find(addr)
+		cluster, ok := byRoot[root]
+		if !ok {
+			cluster = &Cluster{Links: c.links[root]}
+			if cluster.Links == nil {
+				cluster.Links = make(map[Heuristic]int)
+			}
+			byRoot[root] = cluster
+		}
+		cluster.Addresses = append(cluster.Addresses, addr)
+		cluster.Balance += utxoSet.GetBalance(addr)
+	}
+
+	clusters := make([]*Cluster, 0, len(byRoot))
+	for _, cluster := range byRoot {
+		sort.Strings(cluster.Addresses)
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Addresses) != len(clusters[j].Addresses) {
+			return len(clusters[i].Addresses) > len(clusters[j].Addresses)
+		}
+		return clusters[i].Addresses[0] < clusters[j].Addresses[0]
+	})
+	return clusters
+}
@@ -0,0 +1,84 @@
+package analysis
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"testing"
+)
+
+// spend builds an unsigned transaction; clustering only looks at structure
+func spend(inputs []transaction.TxInput, outputs []transaction.TxOutput) *transaction.Transaction {
+	tx := transaction.NewUTXOTransaction(inputs, outputs)
+	tx.ID = tx.CalculateHash()
+	return tx
+}
+
+// clusterOf returns the cluster containing addr
+func clusterOf(clusters []*Cluster, addr string) *Cluster {
+	for _, c := range clusters {
+		for _, a := range c.Addresses {
+			if a == addr {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func testChain() []*block.Block {
+	cb1 := transaction.NewCoinbaseTransaction("alice1", 100, 1)
+	cb2 := transaction.NewCoinbaseTransaction("alice2", 100, 2)
+	cb3 := transaction.NewCoinbaseTransaction("bob", 100, 3)
+
+	// alice1 and alice2 co-spend, paying bob (seen before) and fresh change
+	tx := spend(
+		[]transaction.TxInput{{TxID: cb1.ID, OutIndex: 0}, {TxID: cb2.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 150, ScriptPubKey: "bob"}, {Value: 50, ScriptPubKey: "alice-change"}},
+	)
+	cb4 := transaction.NewCoinbaseTransaction("carol", 100, 4)
+
+	return []*block.Block{
+		block.NewBlock(1, []*transaction.Transaction{cb1}, "", 1, "pool-a"),
+		block.NewBlock(2, []*transaction.Transaction{cb2}, "", 1, "pool-b"),
+		block.NewBlock(3, []*transaction.Transaction{cb3}, "", 1, "pool-c"),
+		block.NewBlock(4, []*transaction.Transaction{cb4, tx}, "", 1, "pool-a"),
+	}
+}
+
+func TestMultiInputAndChangeHeuristics(t *testing.T) {
+	clusters := ClusterAddresses(testChain(), []Heuristic{HeuristicMultiInput, HeuristicChange})
+
+	alice := clusterOf(clusters, "alice1")
+	if alice == nil || clusterOf(clusters, "alice2") != alice || clusterOf(clusters, "alice-change") != alice {
+		t.Fatal("Co-spent inputs and the fresh change output should share a cluster")
+	}
+	if clusterOf(clusters, "bob") == alice {
+		t.Error("The previously seen payee must not be clustered with the sender")
+	}
+	if alice.Links[HeuristicMultiInput] != 1 || alice.Links[HeuristicChange] != 1 {
+		t.Errorf("Unexpected link counts: %v", alice.Links)
+	}
+	if alice.Balance != 50 {
+		t.Errorf("Expected cluster balance 50, got %d", alice.Balance)
+	}
+}
+
+func TestMinerIDDefeatsPayoutRotation(t *testing.T) {
+	clusters := ClusterAddresses(testChain(), []Heuristic{HeuristicMinerID})
+
+	if clusterOf(clusters, "alice1") != clusterOf(clusters, "carol") {
+		t.Error("Coinbases from the same MinerID should be clustered")
+	}
+	if clusterOf(clusters, "alice1") == clusterOf(clusters, "alice2") {
+		t.Error("Without multi-input, different miners should stay separate")
+	}
+}
+
+func TestParseHeuristic(t *testing.T) {
+	if h, err := ParseHeuristic("change"); err != nil || h != HeuristicChange {
+		t.Errorf("Expected change heuristic, got %q, %v", h, err)
+	}
+	if _, err := ParseHeuristic("bogus"); err == nil {
+		t.Error("Unknown heuristic names should be rejected")
+	}
+}
@@ -0,0 +1,221 @@
+// Package attack runs classic attacks on the honest miners of a testnet and
+// reports whether the network resisted: selfish mining, a 51% attack that
+// reverses a payment with a hidden chain, and an eclipse that feeds one
+// miner the attacker's chain by monopolizing its peers.
+//
+// The attacker is not a miner of the network. It mines its own blocks on a
+// copy of the chain, without a template or a mempool, and hands them to the
+// miners it chooses over RPC, as peers do. Who finds each block is drawn at
+// random: the attacker with the probability of its share of the hash power,
+// an honest miner otherwise, so results follow the power given and not the
+// speed of the machine running them.
+//
+//	tn := testnet.New(t, testnet.Config{Miners: 3})
+//	result, err := attack.SelfishMining(tn, attack.SelfishConfig{Power: 0.4, Rounds: 60})
+//	fmt.Println(result)
+//
+// The attack command (package cli/attack) is the other half: one misbehaving
+// miner run against real peers.
+package attack
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/network"
+	"blockchain/pkg/testnet"
+	"blockchain/pkg/transaction"
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// AttackerID is the miner ID in the attacker's blocks
+const AttackerID = "attacker"
+
+// Result reports how an attack went
+type Result struct {
+	Attack         string  // "selfish", "hidden-chain", or "eclipse"
+	Resisted       bool    // Whether the honest network held
+	Rounds         int     // Blocks found during the attack, by anyone
+	AttackerBlocks int     // Blocks the attacker found
+	HonestBlocks   int     // Blocks the honest miners found
+	Orphaned       int     // Honest blocks that ended up off the main chain (the victim's, for an eclipse)
+	Share          float64 // The attacker's share of that chain's blocks since the attack began
+	Detail         string  // What happened, in a sentence
+}
+
+// String summarizes the result on one line
+func (r *Result) String() string {
+	verdict := "resisted"
+	if !r.Resisted {
+		verdict = "succeeded"
+	}
+	return fmt.Sprintf("%s attack %s: %s (%d rounds, %d attacker and %d honest blocks, %d orphaned, attacker share %.0f%%)",
+		r.Attack, verdict, r.Detail, r.Rounds, r.AttackerBlocks, r.HonestBlocks, r.Orphaned, 100*r.Share)
+}
+
+// newRand returns the random source of an attack, from the clock if seed is 0
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// privateChain is the attacker's copy of the chain: the blocks it shares with
+// the honest network up to the fork, then the blocks it mined on top
+type privateChain struct {
+	tn        *testnet.Testnet
+	chain     *blockchain.Blockchain
+	payout    string         // Address the attacker's coinbases pay
+	fork      int64          // Height of the last block shared with the honest network
+	blocks    []*block.Block // Blocks mined past the fork, oldest first
+	published int            // How many of blocks the honest network has been given
+}
+
+// newPrivateChain forks the attacker's chain from the tip of m
+func newPrivateChain(tn *testnet.Testnet, m *network.Miner, payout string) *privateChain {
+	p := &privateChain{tn: tn, payout: payout}
+	p.reset(m)
+	return p
+}
+
+// reset drops the attacker's blocks and forks again from the tip of m
+func (p *privateChain) reset(m *network.Miner) {
+	cfg := p.tn.Config()
+	p.chain = blockchain.NewBlockchainFromBlocks(m.Blockchain.GetBlocks(), cfg.Difficulty, cfg.ChainOptions...)
+	p.fork = p.chain.GetLatestBlock().Index
+	p.blocks, p.published = nil, 0
+}
+
+// tip returns the height of the attacker's tip
+func (p *privateChain) tip() int64 {
+	return p.fork + int64(len(p.blocks))
+}
+
+// mine mines a block holding txs on the attacker's tip
+func (p *privateChain) mine(txs ...*transaction.Transaction) (*block.Block, error) {
+	height := p.tip() + 1
+	reward := p.chain.Params().SubsidyAt(height)
+	utxoSet := p.chain.GetUTXOSet()
+	for _, tx := range txs {
+		reward += tx.GetFee(utxoSet)
+	}
+	coinbase := transaction.NewCoinbaseTransaction(p.payout, reward, height)
+	b := p.chain.CreateBlock(append([]*transaction.Transaction{coinbase}, txs...), AttackerID)
+	b.Difficulty = p.chain.RequiredDifficulty(b.Index)
+	if mtp := p.chain.MedianTimePast(); b.Timestamp <= mtp {
+		b.Timestamp = mtp + 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.tn.Config().Timeout)
+	defer cancel()
+	result := p.chain.Engine().Seal(ctx, b, 1)
+	if !result.Success {
+		return nil, fmt.Errorf("no nonce found for block #%d", height)
+	}
+	if err := p.chain.AddBlock(result.Block); err != nil {
+		return nil, fmt.Errorf("attacker's own chain refused block #%d: %v", height, err)
+	}
+	p.blocks = append(p.blocks, result.Block)
+	return result.Block, nil
+}
+
+// publish hands the attacker's blocks up to height, those not yet published,
+// to the miners at addresses. A miner has processed a block when its call
+// returns, though it may keep it on a side branch.
+func (p *privateChain) publish(height int64, addresses []string) error {
+	for p.published < len(p.blocks) && p.blocks[p.published].Index <= height {
+		b := p.blocks[p.published]
+		for _, address := range addresses {
+			if err := pushBlock(address, b); err != nil {
+				return fmt.Errorf("failed to publish block #%d to %s: %v", b.Index, address, err)
+			}
+		}
+		p.published++
+	}
+	return nil
+}
+
+// pushBlock hands b to the miner at address as a peer would
+func pushBlock(address string, b *block.Block) error {
+	data, err := b.Serialize()
+	if err != nil {
+		return err
+	}
+	client, err := network.DialMiner(address, network.Credentials{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	var reply network.BlockReply
+	return client.Call("RPCService.ReceiveBlock", &network.BlockArgs{BlockData: data}, &reply)
+}
+
+// minerAddresses returns the addresses of miners
+func minerAddresses(miners []*network.Miner) []string {
+	addresses := make([]string, len(miners))
+	for i, m := range miners {
+		addresses[i] = m.Address
+	}
+	return addresses
+}
+
+// waitForBlock waits until every miner has the block with hash, on its main
+// chain if onChain is set or anywhere otherwise
+func waitForBlock(tn *testnet.Testnet, miners []*network.Miner, hash string, height int64, onChain bool) error {
+	deadline := time.Now().Add(tn.Config().Timeout)
+	for {
+		missing := 0
+		for _, m := range miners {
+			if onChain {
+				if b := m.Blockchain.GetBlockByHeight(height); b == nil || b.Hash != hash {
+					missing++
+				}
+			} else if !m.Blockchain.HasBlock(hash) {
+				missing++
+			}
+		}
+		if missing == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("block #%d did not reach %d miners within %v", height, missing, tn.Config().Timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// mineHonest has miner i of the honest miners mine a block and waits until
+// every one of them has it
+func mineHonest(tn *testnet.Testnet, honest []*network.Miner, i int) error {
+	hash, height := tn.MineBlock(minerIndex(tn, honest[i]))
+	return waitForBlock(tn, honest, hash, height, false)
+}
+
+// minerIndex returns the number of m in the testnet
+func minerIndex(tn *testnet.Testnet, m *network.Miner) int {
+	for i, other := range tn.Miners() {
+		if other == m {
+			return i
+		}
+	}
+	return -1
+}
+
+// tally fills in the orphaned honest blocks and the attacker's share of the
+// main chain of m above height start
+func (r *Result) tally(m *network.Miner, start int64) {
+	blocks := m.Blockchain.GetBlocksFrom(start + 1)
+	attacker := 0
+	for _, b := range blocks {
+		if b.MinerID == AttackerID {
+			attacker++
+		}
+	}
+	r.Orphaned = r.HonestBlocks - (len(blocks) - attacker)
+	if len(blocks) > 0 {
+		r.Share = float64(attacker) / float64(len(blocks))
+	}
+}
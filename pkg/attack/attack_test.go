@@ -0,0 +1,91 @@
+package attack
+
+import (
+	"blockchain/pkg/testnet"
+	"testing"
+)
+
+func TestSelfishMiningOutearnsItsPower(t *testing.T) {
+	tn := testnet.New(t, testnet.Config{Miners: 3})
+	result, err := SelfishMining(tn, SelfishConfig{Power: 0.45, Rounds: 40, Seed: 7})
+	if err != nil {
+		t.Fatalf("Attack failed: %v", err)
+	}
+	t.Log(result)
+	if result.Resisted || result.Orphaned == 0 {
+		t.Errorf("A selfish miner with 45%% of the hash power should orphan honest blocks and outearn its power: %v", result)
+	}
+	if result.AttackerBlocks+result.HonestBlocks != result.Rounds {
+		t.Errorf("Every round should find one block: %v", result)
+	}
+	tn.WaitForConsensus()
+}
+
+func TestHiddenChainReversesPaymentOnlyWithMajority(t *testing.T) {
+	tests := []struct {
+		name     string
+		power    float64
+		resisted bool
+	}{
+		{"majority", 0.7, false},
+		{"minority", 0.2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tn := testnet.New(t, testnet.Config{Miners: 3, Fund: map[string]int{"mallory": 1}})
+			value := tn.Balance(0, "mallory") / 2
+			result, err := HiddenChain(tn, HiddenChainConfig{
+				Power: tt.power, Payer: "mallory", Merchant: "merchant", Value: value,
+				Confirmations: 2, Rounds: 20, Seed: 4,
+			})
+			if err != nil {
+				t.Fatalf("Attack failed: %v", err)
+			}
+			t.Log(result)
+			if result.Resisted != tt.resisted {
+				t.Fatalf("Expected resisted=%v: %v", tt.resisted, result)
+			}
+
+			tn.WaitForConsensus()
+			want := value
+			if !tt.resisted {
+				want = 0
+			}
+			for i := range tn.Miners() {
+				if got := tn.Balance(i, "merchant"); got != want {
+					t.Errorf("Miner %d: expected the merchant to hold %d, got %d", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEclipseIsolatesVictimWithoutHonestPeers(t *testing.T) {
+	tests := []struct {
+		name       string
+		keepHonest int
+		resisted   bool
+	}{
+		{"eclipsed", 0, false},
+		{"one-honest-peer", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tn := testnet.New(t, testnet.Config{Miners: 4})
+			result, err := Eclipse(tn, EclipseConfig{Victim: 3, Sybils: 3, KeepHonest: tt.keepHonest, Power: 0.3, Rounds: 20, Seed: 5})
+			if err != nil {
+				t.Fatalf("Attack failed: %v", err)
+			}
+			t.Log(result)
+			if result.Resisted != tt.resisted {
+				t.Fatalf("Expected resisted=%v: %v", tt.resisted, result)
+			}
+
+			// With its links restored, the victim rejoins the network
+			if len(tn.Miner(3).GetPeers()) != 3 {
+				t.Errorf("The victim's peers should be restored, got %v", tn.Miner(3).GetPeers())
+			}
+			tn.WaitForConsensus()
+		})
+	}
+}
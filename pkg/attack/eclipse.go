@@ -0,0 +1,149 @@
+package attack
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/network"
+	"blockchain/pkg/testnet"
+	"fmt"
+	"net"
+)
+
+// DefaultSybils is how many nodes an eclipse surrounds its victim with when
+// its config does not say
+const DefaultSybils = 4
+
+// EclipseConfig describes an eclipse attack
+type EclipseConfig struct {
+	Victim     int     // Number of the miner of tn to eclipse
+	Sybils     int     // Attacker nodes that take the victim's peer slots (default DefaultSybils)
+	KeepHonest int     // Honest miners still linked to the victim, as if the sybils missed them
+	Power      float64 // The attacker's share of the hash power, between 0 and 1
+	Rounds     int     // Blocks found during the attack (default DefaultRounds)
+	Seed       int64   // Seed of who finds each block (default: from the clock)
+}
+
+// Eclipse cuts one miner of tn off from the honest network by monopolizing
+// its peers: sybil nodes of the attacker replace its peers, and the honest
+// miners lose their link to it, except the first cfg.KeepHonest. The attacker
+// mines its own chain and hands it to the victim and the sybils, which serve
+// it when the victim syncs. At the end the victim resyncs with its peers, as
+// its resync loop would, and then its links are restored and the sybils
+// stopped; WaitForConsensus brings it back to the network's tip.
+//
+// The network resisted if the victim ended the attack on the honest tip.
+func Eclipse(tn *testnet.Testnet, cfg EclipseConfig) (*Result, error) {
+	if cfg.Power <= 0 || cfg.Power >= 1 {
+		return nil, fmt.Errorf("attack: hash power %v is not between 0 and 1", cfg.Power)
+	}
+	if cfg.Victim < 0 || cfg.Victim >= len(tn.Miners()) {
+		return nil, fmt.Errorf("attack: no miner %d to eclipse", cfg.Victim)
+	}
+	if cfg.Sybils <= 0 {
+		cfg.Sybils = DefaultSybils
+	}
+	if cfg.Rounds <= 0 {
+		cfg.Rounds = DefaultRounds
+	}
+	rng := newRand(cfg.Seed)
+	victim := tn.Miner(cfg.Victim)
+	var honest []*network.Miner
+	for _, m := range tn.Miners() {
+		if m != victim {
+			honest = append(honest, m)
+		}
+	}
+	kept := honest[:min(cfg.KeepHonest, len(honest))]
+	cut := honest[len(kept):]
+	priv := newPrivateChain(tn, victim, tn.Address(AttackerID))
+	start := priv.fork
+	result := &Result{Attack: "eclipse"}
+
+	sybils, err := startSybils(tn, victim, cfg.Sybils)
+	defer func() {
+		for _, s := range sybils {
+			s.Stop()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// Take the victim's peer slots, and restore them when done
+	var sybilPeers, cutPeers []network.PeerInfo
+	for _, s := range sybils {
+		sybilPeers = append(sybilPeers, network.PeerInfo{ID: s.ID, Address: s.Address})
+	}
+	for _, m := range cut {
+		cutPeers = append(cutPeers, network.PeerInfo{ID: m.ID, Address: m.Address})
+		m.UpdatePeers(nil, []string{victim.Address})
+	}
+	victim.UpdatePeers(sybilPeers, minerAddresses(cut))
+	defer func() {
+		victim.UpdatePeers(cutPeers, minerAddresses(sybils))
+		for _, m := range cut {
+			m.UpdatePeers([]network.PeerInfo{{ID: victim.ID, Address: victim.Address}}, nil)
+		}
+	}()
+
+	attacked := append(minerAddresses(sybils), victim.Address)
+	for ; result.Rounds < cfg.Rounds; result.Rounds++ {
+		if rng.Float64() < cfg.Power {
+			result.AttackerBlocks++
+			if _, err := priv.mine(); err != nil {
+				return nil, err
+			}
+			if err := priv.publish(priv.tip(), attacked); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result.HonestBlocks++
+		if err := mineHonest(tn, honest, result.HonestBlocks%len(honest)); err != nil {
+			return nil, err
+		}
+	}
+
+	victim.SyncWithAllPeers()
+	result.tally(victim, start)
+	tip := honest[0].Blockchain.GetLatestBlock()
+	seen := victim.Blockchain.GetLatestBlock()
+	result.Resisted = seen.Hash == tip.Hash
+	if result.Resisted {
+		result.Detail = fmt.Sprintf("%s stayed on the network's tip at #%d", victim.ID, tip.Index)
+	} else {
+		result.Detail = fmt.Sprintf("%s was left at #%d, %d blocks behind the network's tip",
+			victim.ID, seen.Index, tip.Index-seen.Index)
+	}
+	return result, nil
+}
+
+// startSybils starts n attacker nodes on the victim's chain, peered with the
+// victim only. On error, the nodes already started are returned with it.
+func startSybils(tn *testnet.Testnet, victim *network.Miner, n int) ([]*network.Miner, error) {
+	cfg := tn.Config()
+	var sybils []*network.Miner
+	for i := 0; i < n; i++ {
+		address, err := freeAddress()
+		if err != nil {
+			return sybils, err
+		}
+		s := network.NewMiner(fmt.Sprintf("sybil%d", i), address, cfg.Difficulty,
+			[]network.PeerInfo{{ID: victim.ID, Address: victim.Address}}, cfg.Options...)
+		s.Blockchain = blockchain.NewBlockchainFromBlocks(victim.Blockchain.GetBlocks(), cfg.Difficulty, cfg.ChainOptions...)
+		if err := s.Start(); err != nil {
+			return sybils, fmt.Errorf("attack: failed to start %s: %v", s.ID, err)
+		}
+		sybils = append(sybils, s)
+	}
+	return sybils, nil
+}
+
+// freeAddress returns a local address no one is listening on
+func freeAddress() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("attack: no free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
@@ -0,0 +1,185 @@
+package attack
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/network"
+	"blockchain/pkg/testnet"
+	"blockchain/pkg/transaction"
+	"fmt"
+)
+
+const (
+	// DefaultConfirmations is how many blocks a merchant waits for when a
+	// hidden chain attack's config does not say
+	DefaultConfirmations = 3
+
+	// DefaultFee is what an attack's payment pays when its config does not say
+	DefaultFee = 1000
+)
+
+// HiddenChainConfig describes a double spend with a hidden chain
+type HiddenChainConfig struct {
+	Power         float64 // The attacker's share of the hash power, between 0 and 1
+	Payer         string  // Funded wallet of tn the attacker pays from
+	Merchant      string  // Wallet of tn paid
+	Value         int64   // Amount paid
+	Fee           int64   // Fee of the payment (default DefaultFee)
+	Confirmations int     // Blocks the merchant waits for (default DefaultConfirmations)
+	Rounds        int     // Blocks found before the attacker gives up (default DefaultRounds)
+	Seed          int64   // Seed of who finds each block (default: from the clock)
+}
+
+// HiddenChain has an attacker pay cfg.Merchant from cfg.Payer through the
+// miners of tn, while mining a chain of its own in secret from the block
+// before, in which the same coins pay the payer back. Once the merchant sees
+// cfg.Confirmations and the hidden chain is the longer, the attacker
+// publishes it: the miners switch to it and the payment is gone.
+//
+// The network resisted if the payment survived, which is only likely while
+// the attacker has less than half the hash power.
+func HiddenChain(tn *testnet.Testnet, cfg HiddenChainConfig) (*Result, error) {
+	if cfg.Power <= 0 || cfg.Power >= 1 {
+		return nil, fmt.Errorf("attack: hash power %v is not between 0 and 1", cfg.Power)
+	}
+	if cfg.Fee <= 0 {
+		cfg.Fee = DefaultFee
+	}
+	if cfg.Confirmations <= 0 {
+		cfg.Confirmations = DefaultConfirmations
+	}
+	if cfg.Rounds <= 0 {
+		cfg.Rounds = DefaultRounds
+	}
+	rng := newRand(cfg.Seed)
+	honest := tn.Miners()
+	priv := newPrivateChain(tn, honest[0], tn.Address(cfg.Payer))
+	start := priv.fork
+	result := &Result{Attack: "hidden-chain"}
+
+	payment, refund, err := conflictingPayments(priv.chain, tn.Wallet(cfg.Payer), tn.Address(cfg.Merchant), cfg.Value, cfg.Fee)
+	if err != nil {
+		return nil, err
+	}
+	client, err := network.DialMiner(honest[0].Address, network.Credentials{})
+	if err != nil {
+		return nil, err
+	}
+	_, err = network.SubmitRawTransaction(client, payment)
+	client.Close()
+	if err != nil {
+		return nil, fmt.Errorf("attack: payment refused: %v", err)
+	}
+
+	confirmations := func() int64 {
+		loc := findTx(honest[0], payment.ID)
+		if loc == nil {
+			return 0
+		}
+		return tn.Height(0) - loc.BlockHeight + 1
+	}
+	published := false
+	for ; result.Rounds < cfg.Rounds; result.Rounds++ {
+		if rng.Float64() < cfg.Power {
+			result.AttackerBlocks++
+			var txs []*transaction.Transaction
+			if len(priv.blocks) == 0 {
+				txs = append(txs, refund)
+			}
+			if _, err := priv.mine(txs...); err != nil {
+				return nil, err
+			}
+		} else {
+			result.HonestBlocks++
+			if err := mineHonest(tn, honest, result.HonestBlocks%len(honest)); err != nil {
+				return nil, err
+			}
+		}
+
+		if confirmations() >= int64(cfg.Confirmations) && priv.tip() > tn.Height(0) {
+			last := priv.blocks[len(priv.blocks)-1]
+			if err := priv.publish(priv.tip(), minerAddresses(honest)); err != nil {
+				return nil, err
+			}
+			if err := waitForBlock(tn, honest, last.Hash, last.Index, true); err != nil {
+				return nil, err
+			}
+			published = true
+			result.Rounds++
+			break
+		}
+	}
+
+	result.tally(honest[0], start)
+	reversed := true
+	for _, m := range honest {
+		if findTx(m, payment.ID) != nil || findTx(m, refund.ID) == nil {
+			reversed = false
+		}
+	}
+	result.Resisted = !reversed
+	switch {
+	case reversed:
+		result.Detail = fmt.Sprintf("payment %s was reversed after %d confirmations", shortID(payment.ID), cfg.Confirmations)
+	case published:
+		result.Detail = fmt.Sprintf("the hidden chain was published but payment %s survived", shortID(payment.ID))
+	default:
+		result.Detail = fmt.Sprintf("the hidden chain never overtook the honest one; payment %s has %d confirmations",
+			shortID(payment.ID), confirmations())
+	}
+	return result, nil
+}
+
+// conflictingPayments returns two transactions spending the same outputs of
+// kp on chain: one paying value to merchant, with change, and one paying
+// everything back to kp
+func conflictingPayments(chain *blockchain.Blockchain, kp *transaction.KeyPair, merchant string, value, fee int64) (payment, refund *transaction.Transaction, err error) {
+	payer := kp.GetPublicKeyHex()
+	utxos, _ := chain.FindAddressUTXOs(payer)
+	var inputs []struct {
+		TxID     string
+		OutIndex int
+	}
+	var total int64
+	for _, utxo := range utxos {
+		if total >= value+fee {
+			break
+		}
+		inputs = append(inputs, struct {
+			TxID     string
+			OutIndex int
+		}{utxo.TxID, utxo.OutIndex})
+		total += utxo.Value
+	}
+	if total < value+fee {
+		return nil, nil, fmt.Errorf("attack: payer holds %d, cannot pay %d with fee %d", total, value, fee)
+	}
+
+	keys := map[string]string{payer: kp.GetPrivateKeyHex()}
+	outputs := []transaction.TxOutput{{Value: value, ScriptPubKey: merchant}}
+	if change := total - value - fee; change > 0 {
+		outputs = append(outputs, transaction.TxOutput{Value: change, ScriptPubKey: payer})
+	}
+	utxoSet := chain.GetUTXOSet()
+	if payment, err = utxoSet.CreateTransaction(inputs, outputs, keys); err != nil {
+		return nil, nil, err
+	}
+	refund, err = utxoSet.CreateTransaction(inputs, []transaction.TxOutput{{Value: total - fee, ScriptPubKey: payer}}, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payment, refund, nil
+}
+
+// findTx returns where txID is on m's main chain, or nil
+func findTx(m *network.Miner, txID string) *blockchain.TxLocation {
+	_, loc := m.Blockchain.GetTransaction(txID)
+	return loc
+}
+
+// shortID abbreviates a transaction ID for messages
+func shortID(id string) string {
+	if len(id) > 16 {
+		return id[:16]
+	}
+	return id
+}
@@ -0,0 +1,111 @@
+package attack
+
+import (
+	"blockchain/pkg/testnet"
+	"fmt"
+)
+
+// DefaultRounds is how many blocks an attack lets be found when its config
+// does not say
+const DefaultRounds = 50
+
+// SelfishConfig describes a selfish mining attack
+type SelfishConfig struct {
+	Power  float64 // The attacker's share of the hash power, between 0 and 1
+	Rounds int     // Blocks found during the attack (default DefaultRounds)
+	Seed   int64   // Seed of who finds each block (default: from the clock)
+}
+
+// SelfishMining has an attacker mine selfishly against every miner of tn
+// (Eyal and Sirer): it withholds the blocks it finds, and answers each honest
+// block by publishing just enough of them to keep its lead; when its lead
+// falls to one it publishes everything and the honest block is orphaned, and
+// when the honest miners draw level it publishes to force a race. Honest
+// miners keep the first of two branches as long as each other, so the
+// attacker wins no races it did not already lead.
+//
+// The network resisted if the attacker's share of the main chain's blocks is
+// no more than its share of the hash power, the revenue it would have earned
+// by mining honestly.
+func SelfishMining(tn *testnet.Testnet, cfg SelfishConfig) (*Result, error) {
+	if cfg.Power <= 0 || cfg.Power >= 1 {
+		return nil, fmt.Errorf("attack: hash power %v is not between 0 and 1", cfg.Power)
+	}
+	if cfg.Rounds <= 0 {
+		cfg.Rounds = DefaultRounds
+	}
+	rng := newRand(cfg.Seed)
+	honest := tn.Miners()
+	addresses := minerAddresses(honest)
+	priv := newPrivateChain(tn, honest[0], tn.Address(AttackerID))
+	start := priv.fork
+	result := &Result{Attack: "selfish"}
+
+	// win publishes the whole branch, which is longer than the honest chain,
+	// and forks again from its tip once every miner has switched to it
+	win := func() error {
+		last := priv.blocks[len(priv.blocks)-1]
+		if err := priv.publish(priv.tip(), addresses); err != nil {
+			return err
+		}
+		if err := waitForBlock(tn, honest, last.Hash, last.Index, true); err != nil {
+			return err
+		}
+		priv.reset(honest[0])
+		return nil
+	}
+
+	racing := false // The branch was published level with the honest chain
+	for ; result.Rounds < cfg.Rounds; result.Rounds++ {
+		if rng.Float64() < cfg.Power {
+			result.AttackerBlocks++
+			if _, err := priv.mine(); err != nil {
+				return nil, err
+			}
+			if racing {
+				racing = false
+				if err := win(); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		result.HonestBlocks++
+		if err := mineHonest(tn, honest, result.HonestBlocks%len(honest)); err != nil {
+			return nil, err
+		}
+		racing = false
+		public := tn.Height(0) - priv.fork
+		withheld := int64(len(priv.blocks))
+		var err error
+		switch {
+		case withheld < public:
+			// Behind: adopt the honest chain
+			priv.reset(honest[0])
+		case withheld == public:
+			err = priv.publish(priv.tip(), addresses)
+			racing = true
+		case withheld == public+1:
+			err = win()
+		default:
+			// Well ahead: match the honest chain and keep the rest
+			err = priv.publish(priv.fork+public, addresses)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A lead left at the end is worth publishing
+	if int64(len(priv.blocks)) > tn.Height(0)-priv.fork {
+		if err := win(); err != nil {
+			return nil, err
+		}
+	}
+	result.tally(honest[0], start)
+	result.Resisted = result.Share <= cfg.Power
+	result.Detail = fmt.Sprintf("an attacker with %.0f%% of the hash power earned %.0f%% of the blocks",
+		100*cfg.Power, 100*result.Share)
+	return result, nil
+}
@@ -0,0 +1,139 @@
+// Package audit keeps an append-only log of authenticated RPC actions. Each
+// line of the log file is one JSON entry; entries are never rewritten.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Outcome is how an audited call ended
+type Outcome string
+
+const (
+	OutcomeOK     Outcome = "ok"     // The call succeeded
+	OutcomeFailed Outcome = "failed" // The call ran but reported failure, e.g. an invalid transaction
+	OutcomeError  Outcome = "error"  // The call returned an RPC error
+	OutcomeDenied Outcome = "denied" // The caller's role may not call the method
+)
+
+// Entry is one audited call
+type Entry struct {
+	Seq          int64   `json:"seq"`           // Position in the log, from 1
+	Timestamp    int64   `json:"timestamp"`     // Unix nanoseconds when the call finished
+	Caller       string  `json:"caller"`        // Identity of the API token used
+	Role         string  `json:"role"`          // Role of the caller at the time of the call
+	Remote       string  `json:"remote"`        // Remote host of the connection
+	Method       string  `json:"method"`        // RPC method, e.g. RPCService.SetMining
+	ParamsDigest string  `json:"params_digest"` // SHA-256 of the JSON-encoded arguments
+	Outcome      Outcome `json:"outcome"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// Filter selects entries from the log; zero fields match everything
+type Filter struct {
+	Caller string
+	Method string
+	Since  int64 // Only entries at or after this Unix nanosecond timestamp
+	Limit  int   // Return only the newest Limit matches
+}
+
+// Log appends entries to an audit file
+type Log struct {
+	path string
+	file *os.File
+	enc  *json.Encoder
+	seq  int64
+	mu   sync.Mutex
+}
+
+// Open opens (or creates) an audit file for appending, continuing the
+// sequence numbers of the entries already in it
+func Open(path string) (*Log, error) {
+	entries, err := Read(path, Filter{})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	l := &Log{path: path, file: file, enc: json.NewEncoder(file)}
+	if len(entries) > 0 {
+		l.seq = entries[len(entries)-1].Seq
+	}
+	return l, nil
+}
+
+// Append assigns e the next sequence number and writes it to the file
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	if err := l.enc.Encode(&e); err != nil {
+		return fmt.Errorf("failed to write audit entry: %v", err)
+	}
+	return l.file.Sync()
+}
+
+// Query returns the entries of the log that match f, oldest first
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Read(l.path, f)
+}
+
+// Close closes the audit file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Read loads the entries of an audit file that match f, oldest first
+func Read(path string, f Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for n := 0; dec.More(); n++ {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("corrupt audit entry %d: %v", n, err)
+		}
+		if f.matches(&e) {
+			entries = append(entries, e)
+		}
+	}
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[len(entries)-f.Limit:]
+	}
+	return entries, nil
+}
+
+func (f *Filter) matches(e *Entry) bool {
+	return (f.Caller == "" || e.Caller == f.Caller) &&
+		(f.Method == "" || e.Method == f.Method) &&
+		e.Timestamp >= f.Since
+}
+
+// Digest returns the hex SHA-256 of v's JSON encoding, so entries identify the
+// parameters of a call without storing them (they may include private keys)
+func Digest(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
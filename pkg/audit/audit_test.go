@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	entries := []Entry{
+		{Timestamp: 100, Caller: "token:aa", Method: "RPCService.SetMining", Outcome: OutcomeOK},
+		{Timestamp: 200, Caller: "token:bb", Method: "RPCService.UpdatePeers", Outcome: OutcomeDenied},
+		{Timestamp: 300, Caller: "token:aa", Method: "RPCService.UpdatePeers", Outcome: OutcomeOK},
+	}
+	for _, e := range entries {
+		if err := l.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	got, _ := l.Query(Filter{Caller: "token:aa"})
+	if len(got) != 2 || got[0].Seq != 1 || got[1].Seq != 3 {
+		t.Errorf("Expected entries 1 and 3 for token:aa, got %+v", got)
+	}
+	got, _ = l.Query(Filter{Method: "RPCService.UpdatePeers", Since: 250})
+	if len(got) != 1 || got[0].Seq != 3 {
+		t.Errorf("Expected entry 3 for UpdatePeers since 250, got %+v", got)
+	}
+	got, _ = l.Query(Filter{Limit: 1})
+	if len(got) != 1 || got[0].Seq != 3 {
+		t.Errorf("Expected only the newest entry, got %+v", got)
+	}
+	l.Close()
+
+	// Reopening appends after the existing entries
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer l.Close()
+	l.Append(Entry{Timestamp: 400, Caller: "token:cc", Outcome: OutcomeOK})
+	got, _ = l.Query(Filter{})
+	if len(got) != 4 || got[3].Seq != 4 || got[0].Caller != "token:aa" {
+		t.Errorf("Expected 4 entries continuing the sequence, got %+v", got)
+	}
+}
+
+func TestDigestHidesParameters(t *testing.T) {
+	args := map[string]string{"privkey": "secret"}
+	d := Digest(args)
+	if len(d) != 64 || d != Digest(map[string]string{"privkey": "secret"}) {
+		t.Errorf("Digest should be a stable SHA-256 hex string, got %q", d)
+	}
+	if d == Digest(map[string]string{"privkey": "other"}) {
+		t.Error("Different parameters should have different digests")
+	}
+}
@@ -2,13 +2,15 @@
 package block
 
 import (
+	"blockchain/pkg/codec"
 	"blockchain/pkg/config"
 	"blockchain/pkg/merkle"
+	"blockchain/pkg/pow/hashfn"
 	"blockchain/pkg/transaction"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -23,10 +25,63 @@ type Block struct {
 	Nonce        int64                      `json:"nonce"`
 	Difficulty   int                        `json:"difficulty"`
 	MinerID      string                     `json:"miner_id"`
+	PowAlgorithm string                     `json:"pow_algorithm,omitempty"` // Proof-of-work hash function ("" = SHA-256)
+
+	hashMode hashMode // How transactions are committed in the hash (not serialized)
+}
+
+// hashMode selects how CalculateHash commits to the block's transactions
+type hashMode int8
+
+const (
+	hashModeDefault hashMode = iota // Follow the deprecated global config.UseMerkleTree
+	hashModeMerkle                  // Commit to the Merkle root
+	hashModeLegacy                  // Commit to the concatenated transaction IDs
+)
+
+// Option configures a block at construction time
+type Option func(*Block)
+
+// WithMerkleTree sets whether the block hash commits to the Merkle root
+// instead of the process-wide config default
+func WithMerkleTree(use bool) Option {
+	return func(b *Block) {
+		b.SetMerkleMode(use)
+	}
+}
+
+// WithPowAlgorithm sets the hash function the block's proof of work uses, by
+// its hashfn name
+func WithPowAlgorithm(name string) Option {
+	return func(b *Block) {
+		b.PowAlgorithm = hashfn.Canonical(name)
+	}
+}
+
+// SetMerkleMode fixes how this block's hash commits to its transactions.
+// Chains call this on received blocks so validation follows their own options.
+func (b *Block) SetMerkleMode(use bool) {
+	if use {
+		b.hashMode = hashModeMerkle
+	} else {
+		b.hashMode = hashModeLegacy
+	}
+}
+
+// UsesMerkleTree returns whether the block hash commits to the Merkle root
+func (b *Block) UsesMerkleTree() bool {
+	switch b.hashMode {
+	case hashModeMerkle:
+		return true
+	case hashModeLegacy:
+		return false
+	default:
+		return config.UseMerkleTree()
+	}
 }
 
 // NewBlock creates a new block with the given transactions and previous hash
-func NewBlock(index int64, transactions []*transaction.Transaction, prevHash string, difficulty int, minerID string) *Block {
+func NewBlock(index int64, transactions []*transaction.Transaction, prevHash string, difficulty int, minerID string, opts ...Option) *Block {
 	block := &Block{
 		Index:        index,
 		Timestamp:    time.Now().UnixNano(),
@@ -36,15 +91,18 @@ func NewBlock(index int64, transactions []*transaction.Transaction, prevHash str
 		Difficulty:   difficulty,
 		MinerID:      minerID,
 	}
+	for _, opt := range opts {
+		opt(block)
+	}
 	// Calculate Merkle Root if using Merkle Tree mode
-	if config.UseMerkleTree() {
+	if block.UsesMerkleTree() {
 		block.MerkleRoot = block.CalculateMerkleRoot()
 	}
 	return block
 }
 
 // NewGenesisBlock creates the genesis block (first block in the chain)
-func NewGenesisBlock(difficulty int) *Block {
+func NewGenesisBlock(difficulty int, opts ...Option) *Block {
 	// Genesis block uses a coinbase transaction
 	genesisTransaction := transaction.NewCoinbaseTransaction("genesis", 0, 0)
 	block := &Block{
@@ -56,8 +114,11 @@ func NewGenesisBlock(difficulty int) *Block {
 		Difficulty:   difficulty,
 		MinerID:      "genesis",
 	}
+	for _, opt := range opts {
+		opt(block)
+	}
 	// Calculate Merkle Root if using Merkle Tree mode
-	if config.UseMerkleTree() {
+	if block.UsesMerkleTree() {
 		block.MerkleRoot = block.CalculateMerkleRoot()
 	}
 	block.Hash = block.CalculateHash()
@@ -82,23 +143,95 @@ func (b *Block) CalculateMerkleRoot() string {
 	return root
 }
 
-// CalculateHash computes the SHA256 hash of the block
+// CalculateHash computes the hash of the block with its PowAlgorithm, SHA-256
+// by default, or returns "" if the block names an unknown function.
+// The hashed data is the decimal index, timestamp, transaction commitment,
+// previous hash, nonce, difficulty and miner ID, concatenated, followed by
+// "pow:" and the function's name unless it is SHA-256.
 func (b *Block) CalculateHash() string {
-	var txData string
-	if config.UseMerkleTree() {
+	fn, err := hashfn.New(b.PowAlgorithm)
+	if err != nil {
+		return ""
+	}
+	data := b.appendHashPrefix(make([]byte, 0, 256))
+	data = strconv.AppendInt(data, b.Nonce, 10)
+	data = b.appendHashSuffix(data)
+	var hash [hashfn.Size]byte
+	fn.Sum(data, &hash)
+	return hex.EncodeToString(hash[:])
+}
+
+// appendHashPrefix appends the hashed fields that come before the nonce
+func (b *Block) appendHashPrefix(dst []byte) []byte {
+	dst = strconv.AppendInt(dst, b.Index, 10)
+	dst = strconv.AppendInt(dst, b.Timestamp, 10)
+	if b.UsesMerkleTree() {
 		// Use MerkleRoot for hash calculation
-		txData = b.MerkleRoot
+		dst = append(dst, b.MerkleRoot...)
 	} else {
 		// Serialize transactions directly (legacy mode)
 		for _, tx := range b.Transactions {
-			txData += tx.ID
+			dst = append(dst, tx.ID...)
 		}
 	}
+	return append(dst, b.PrevHash...)
+}
 
-	data := fmt.Sprintf("%d%d%s%s%d%d%s",
-		b.Index, b.Timestamp, txData, b.PrevHash, b.Nonce, b.Difficulty, b.MinerID)
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+// appendHashSuffix appends the hashed fields that come after the nonce
+func (b *Block) appendHashSuffix(dst []byte) []byte {
+	dst = strconv.AppendInt(dst, int64(b.Difficulty), 10)
+	dst = append(dst, b.MinerID...)
+	if b.PowAlgorithm != "" {
+		// Committed so a block cannot be replayed under another function
+		dst = append(dst, "pow:"...)
+		dst = append(dst, b.PowAlgorithm...)
+	}
+	return dst
+}
+
+// HashParts returns the hashed bytes that come before and after the nonce:
+// the block hash is the PowAlgorithm hash of prefix, the nonce in decimal,
+// and suffix
+func (b *Block) HashParts() (prefix, suffix []byte) {
+	return b.appendHashPrefix(nil), b.appendHashSuffix(nil)
+}
+
+// Hasher hashes a block for one nonce after another without allocating. It
+// snapshots every hashed field but the nonce, so it must be recreated if the
+// block changes. A Hasher is not safe for concurrent use.
+type Hasher struct {
+	buf    []byte // Hashed data; the first prefix bytes are fixed
+	prefix int
+	suffix []byte
+	fn     hashfn.Func
+}
+
+// NewHasher returns a Hasher for the block's current contents
+func (b *Block) NewHasher() *Hasher {
+	buf := b.appendHashPrefix(make([]byte, 0, 256))
+	fn, err := hashfn.New(b.PowAlgorithm)
+	if err != nil {
+		fn = unknownFunc{}
+	}
+	return &Hasher{buf: buf, prefix: len(buf), suffix: b.appendHashSuffix(nil), fn: fn}
+}
+
+// HashInto writes the block hash for nonce into sum. It equals the decoded
+// CalculateHash of the block with that nonce.
+func (h *Hasher) HashInto(nonce int64, sum *[hashfn.Size]byte) {
+	h.buf = strconv.AppendInt(h.buf[:h.prefix], nonce, 10)
+	h.buf = append(h.buf, h.suffix...)
+	h.fn.Sum(h.buf, sum)
+}
+
+// unknownFunc stands in for a hash function the block names but hashfn does
+// not know. Its all-ones hash meets no difficulty, so nothing is mined with it.
+type unknownFunc struct{}
+
+func (unknownFunc) Sum(_ []byte, out *[hashfn.Size]byte) {
+	for i := range out {
+		out[i] = 0xff
+	}
 }
 
 // SetHash calculates and sets the block's hash
@@ -106,16 +239,60 @@ func (b *Block) SetHash() {
 	b.Hash = b.CalculateHash()
 }
 
-// Serialize converts the block to JSON bytes
+// Serialize converts the block to its binary encoding, the form peers
+// exchange and the store keeps
 func (b *Block) Serialize() ([]byte, error) {
+	w := codec.NewWriter()
+	w.Varint(b.Index)
+	w.Varint(b.Timestamp)
+	w.String(b.MerkleRoot)
+	w.String(b.PrevHash)
+	w.String(b.Hash)
+	w.Varint(b.Nonce)
+	w.Varint(int64(b.Difficulty))
+	w.String(b.MinerID)
+	w.Uvarint(uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.EncodeTo(w)
+	}
+	w.String(b.PowAlgorithm)
+	return w.Bytes(), nil
+}
+
+// SerializeJSON converts the block to JSON bytes, the form clients read
+func (b *Block) SerializeJSON() ([]byte, error) {
 	return json.Marshal(b)
 }
 
-// DeserializeBlock converts JSON bytes to a Block
+// DeserializeBlock converts binary or JSON bytes to a Block
 func DeserializeBlock(data []byte) (*Block, error) {
 	var block Block
-	err := json.Unmarshal(data, &block)
-	return &block, err
+	if codec.IsJSON(data) {
+		err := json.Unmarshal(data, &block)
+		return &block, err
+	}
+	r := codec.NewReader(data)
+	block.Index = r.Varint()
+	block.Timestamp = r.Varint()
+	block.MerkleRoot = r.String()
+	block.PrevHash = r.String()
+	block.Hash = r.String()
+	block.Nonce = r.Varint()
+	block.Difficulty = int(r.Varint())
+	block.MinerID = r.String()
+	if n := r.Count(); n > 0 {
+		block.Transactions = make([]*transaction.Transaction, n)
+		for i := range block.Transactions {
+			block.Transactions[i] = transaction.DecodeTransactionFrom(r)
+		}
+	}
+	if r.Version() >= 2 {
+		block.PowAlgorithm = r.String()
+	} else {
+		// Version 1 blocks end with the algorithm only if they name one
+		block.PowAlgorithm = r.OptionalString()
+	}
+	return &block, r.Err()
 }
 
 // ValidateTransactions checks if all transactions in the block are valid
@@ -179,9 +356,11 @@ func (b *Block) Clone() *Block {
 		copy(outputs, tx.Outputs)
 
 		transactions[i] = &transaction.Transaction{
-			ID:      tx.ID,
-			Inputs:  inputs,
-			Outputs: outputs,
+			ID:       tx.ID,
+			Inputs:   inputs,
+			Outputs:  outputs,
+			LockTime: tx.LockTime,
+			Memo:     tx.Memo,
 		}
 	}
 
@@ -195,6 +374,8 @@ func (b *Block) Clone() *Block {
 		Nonce:        b.Nonce,
 		Difficulty:   b.Difficulty,
 		MinerID:      b.MinerID,
+		PowAlgorithm: b.PowAlgorithm,
+		hashMode:     b.hashMode,
 	}
 }
 
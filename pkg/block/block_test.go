@@ -1,8 +1,13 @@
 package block
 
 import (
+	"blockchain/pkg/codec"
 	"blockchain/pkg/config"
+	"blockchain/pkg/pow/hashfn"
 	"blockchain/pkg/transaction"
+	"bytes"
+	"encoding/hex"
+	"strings"
 	"testing"
 )
 
@@ -164,6 +169,41 @@ func TestBlockSerialization(t *testing.T) {
 	}
 }
 
+func TestBlockBinaryEncoding(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTransaction(strings.Repeat("ab", 33), 5000000000, 1)
+	spend := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: coinbase.ID, OutIndex: 0, ScriptSig: strings.Repeat("cd", 70) + ":" + strings.Repeat("ef", 33)}},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: strings.Repeat("12", 33)}})
+	block := NewBlock(1, []*transaction.Transaction{coinbase, spend}, strings.Repeat("0", 64), 2, "miner1")
+	block.Nonce = -5
+	block.SetHash()
+
+	data, err := block.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize block: %v", err)
+	}
+	jsonData, _ := block.SerializeJSON()
+	if 2*len(data) > len(jsonData) {
+		t.Errorf("Binary encoding should be under half the JSON size, got %d vs %d", len(data), len(jsonData))
+	}
+	for _, encoded := range [][]byte{data, jsonData} {
+		got, err := DeserializeBlock(encoded)
+		if err != nil {
+			t.Fatalf("Failed to deserialize block: %v", err)
+		}
+		if again, _ := got.Serialize(); !bytes.Equal(again, data) || !got.HasValidHash() {
+			t.Error("Block changed in the round trip")
+		}
+	}
+
+	if _, err := DeserializeBlock(data[:len(data)/2]); err == nil {
+		t.Error("Truncated block should fail to deserialize")
+	}
+	if _, err := DeserializeBlock(append([]byte{99}, data[1:]...)); err == nil {
+		t.Error("Block of an unknown encoding version should fail to deserialize")
+	}
+}
+
 func TestBlockClone(t *testing.T) {
 	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 1)
 	txs := []*transaction.Transaction{coinbase}
@@ -467,3 +507,124 @@ func TestModeSwitch(t *testing.T) {
 		t.Error("Same mode should produce same hash")
 	}
 }
+
+func TestHasherMatchesCalculateHash(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 1)
+	for _, merkle := range []bool{true, false} {
+		blk := NewBlock(7, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 20, "miner1", WithMerkleTree(merkle))
+		hasher := blk.NewHasher()
+		var sum [32]byte
+		for _, nonce := range []int64{0, 1, -1, 1 << 62} {
+			blk.Nonce = nonce
+			hasher.HashInto(nonce, &sum)
+			if got := hex.EncodeToString(sum[:]); got != blk.CalculateHash() {
+				t.Errorf("merkle=%v nonce=%d: HashInto %s, CalculateHash %s", merkle, nonce, got, blk.CalculateHash())
+			}
+		}
+	}
+}
+
+func TestPowAlgorithms(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 1)
+	newBlock := func(algorithm string) *Block {
+		return NewBlock(1, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 1, "miner1",
+			WithMerkleTree(true), WithPowAlgorithm(algorithm))
+	}
+	legacy := NewBlock(1, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 1, "miner1", WithMerkleTree(true))
+	legacy.Timestamp = 1
+	if named := newBlock(hashfn.SHA256); named.PowAlgorithm != "" {
+		t.Errorf("SHA-256 should be named by leaving the name empty, got %q", named.PowAlgorithm)
+	}
+
+	hashes := make(map[string]string)
+	for _, name := range hashfn.Names() {
+		blk := newBlock(name)
+		blk.Timestamp = legacy.Timestamp
+		blk.SetHash()
+		if prev, ok := hashes[blk.Hash]; ok {
+			t.Errorf("%s hashes the block like %s", name, prev)
+		}
+		hashes[blk.Hash] = name
+
+		var sum [32]byte
+		blk.NewHasher().HashInto(blk.Nonce, &sum)
+		if hex.EncodeToString(sum[:]) != blk.Hash {
+			t.Errorf("%s: HashInto disagrees with CalculateHash", name)
+		}
+		data, _ := blk.Serialize()
+		got, err := DeserializeBlock(data)
+		if err != nil || got.PowAlgorithm != blk.PowAlgorithm || !got.HasValidHash() {
+			t.Errorf("%s: block changed in the round trip (%v)", name, err)
+		}
+	}
+	if hashes[legacy.CalculateHash()] != hashfn.SHA256 {
+		t.Error("Blocks naming no function should keep their SHA-256 hashes")
+	}
+
+	unknown := newBlock("md5")
+	var sum [32]byte
+	unknown.NewHasher().HashInto(0, &sum)
+	if unknown.CalculateHash() != "" || sum[0] != 0xff {
+		t.Error("A block naming an unknown function should have no valid hash")
+	}
+}
+
+func TestDeserializeVersion1Blocks(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 1)
+	for _, algorithm := range []string{hashfn.SHA256, hashfn.SHA256d} {
+		blk := NewBlock(1, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 1, "miner1",
+			WithMerkleTree(true), WithPowAlgorithm(algorithm))
+		blk.SetHash()
+		data, _ := blk.Serialize()
+		if data[0] != codec.Version {
+			t.Fatalf("Expected blocks written in version %d, got %d", codec.Version, data[0])
+		}
+
+		// Version 1 wrote the same fields, leaving the algorithm out if empty
+		old := append([]byte{1}, data[1:]...)
+		if blk.PowAlgorithm == "" {
+			if data[len(data)-1] != 0 {
+				t.Fatalf("Expected an empty algorithm to end the encoding")
+			}
+			old = old[:len(old)-1]
+		}
+		got, err := DeserializeBlock(old)
+		if err != nil {
+			t.Fatalf("%s: failed to deserialize version 1 block: %v", algorithm, err)
+		}
+		if got.PowAlgorithm != blk.PowAlgorithm || got.Hash != blk.Hash || !got.HasValidHash() {
+			t.Errorf("%s: version 1 block read as %+v", algorithm, got)
+		}
+		if again, _ := got.Serialize(); !bytes.Equal(again, data) {
+			t.Errorf("%s: version 1 block should reencode in version %d", algorithm, codec.Version)
+		}
+	}
+
+	// Version 2 always holds the algorithm, so a block without it is truncated
+	blk := NewBlock(1, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 1, "miner1", WithMerkleTree(true))
+	data, _ := blk.Serialize()
+	if _, err := DeserializeBlock(data[:len(data)-1]); err == nil {
+		t.Error("Expected a version 2 block missing its algorithm to be refused")
+	}
+}
+
+func BenchmarkHashInto(b *testing.B) {
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 1)
+	blk := NewBlock(1, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 20, "miner1", WithMerkleTree(true))
+	hasher := blk.NewHasher()
+	var sum [32]byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hasher.HashInto(int64(i), &sum)
+	}
+}
+
+func BenchmarkCalculateHash(b *testing.B) {
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 1)
+	blk := NewBlock(1, []*transaction.Transaction{coinbase}, strings.Repeat("0", 64), 20, "miner1", WithMerkleTree(true))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		blk.Nonce = int64(i)
+		blk.CalculateHash()
+	}
+}
@@ -3,9 +3,12 @@ package blockchain
 
 import (
 	"blockchain/pkg/block"
+	"blockchain/pkg/config"
 	"blockchain/pkg/transaction"
 	"errors"
+	"fmt"
 	"sync"
+	"time"
 )
 
 var (
@@ -13,12 +16,15 @@ var (
 	ErrInvalidChain       = errors.New("invalid chain")
 	ErrInvalidPrevHash    = errors.New("invalid previous hash")
 	ErrInvalidPoW         = errors.New("invalid proof of work")
+	ErrInvalidMerkleRoot  = errors.New("merkle root does not match transactions")
 	ErrInvalidIndex       = errors.New("invalid block index")
 	ErrBlockExists        = errors.New("block already exists")
 	ErrInvalidGenesis     = errors.New("invalid genesis block")
 	ErrChainTooShort      = errors.New("chain too short to replace")
 	ErrInvalidTransaction = errors.New("invalid transaction")
 	ErrDoubleSpend        = errors.New("double spend detected")
+	ErrPersistFailed      = errors.New("failed to persist chain state")
+	ErrCheckpointMismatch = errors.New("chain contradicts a checkpoint")
 )
 
 const (
@@ -26,47 +32,153 @@ const (
 	BaseSubsidy int64 = 5000000000
 )
 
+// ChainStore persists chain state changes. Each method must make the change
+// durable before returning; the in-memory chain is only updated on success.
+type ChainStore interface {
+	ConnectBlock(b *block.Block, delta *transaction.UTXODelta) error
+	ReplaceChain(blocks []*block.Block) error
+}
+
+// Options configures the consensus features of a single Blockchain
+type Options struct {
+	UseMerkleTree        bool            // Block hashes commit to the Merkle root
+	UseDynamicDifficulty bool            // Difficulty retargets from recent block times
+	Params               *ChainParams    // Consensus params and rule activation heights
+	MaxClockDrift        time.Duration   // How far ahead of the local clock a block may be dated (0 = unchecked)
+	Engine               ConsensusEngine // Seals blocks and retargets difficulty (nil = PoWEngine)
+	MaxOrphanBytes       int64           // Memory budget of the orphan pool (0 = bounded by count only)
+}
+
+// Option sets a field of Options
+type Option func(*Options)
+
+// WithMerkleTree sets whether block hashes commit to the Merkle root
+func WithMerkleTree(use bool) Option {
+	return func(o *Options) {
+		o.UseMerkleTree = use
+	}
+}
+
+// WithDynamicDifficulty sets whether difficulty adjusts dynamically
+func WithDynamicDifficulty(use bool) Option {
+	return func(o *Options) {
+		o.UseDynamicDifficulty = use
+	}
+}
+
+// WithOptions copies a complete Options value, e.g. from another chain
+func WithOptions(opts Options) Option {
+	return func(o *Options) {
+		*o = opts
+	}
+}
+
+// DefaultOptions returns options taken from the deprecated process-wide config
+func DefaultOptions() Options {
+	return Options{
+		UseMerkleTree:        config.UseMerkleTree(),
+		UseDynamicDifficulty: config.UseDynamicDifficulty(),
+		Params:               DefaultChainParams(),
+		MaxClockDrift:        DefaultMaxClockDrift,
+		Engine:               PoWEngine{},
+		MaxOrphanBytes:       DefaultMaxOrphanBytes,
+	}
+}
+
+func buildOptions(opts []Option) Options {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 // Blockchain represents the entire blockchain
 type Blockchain struct {
 	Blocks     []*block.Block
 	Difficulty int
 	UTXOSet    *transaction.UTXOSet
+	store      ChainStore
+	options    Options
+	index      *chainIndex
 	mu         sync.RWMutex
+	schedule   []DifficultyFloor // Difficulty required from each height on
+	scheduleMu sync.RWMutex      // Guards schedule, which validation reads under mu
+	tree       *blockTree        // Side branches, orphans, and undo data; see ProcessBlock
 }
 
 // NewBlockchain creates a new blockchain with a genesis block
-func NewBlockchain(difficulty int) *Blockchain {
+func NewBlockchain(difficulty int, opts ...Option) *Blockchain {
 	bc := &Blockchain{
 		Blocks:     make([]*block.Block, 0),
 		Difficulty: difficulty,
 		UTXOSet:    transaction.NewUTXOSet(),
+		options:    buildOptions(opts),
+		schedule:   []DifficultyFloor{{Height: 1, Difficulty: difficulty}},
+		tree:       newBlockTree(),
 	}
 	// Create genesis block
-	genesis := block.NewGenesisBlock(difficulty)
+	genesis := block.NewGenesisBlock(difficulty, bc.blockOptions(0)...)
 	bc.Blocks = append(bc.Blocks, genesis)
 	// Process genesis block transactions
 	for _, tx := range genesis.Transactions {
 		bc.UTXOSet.ProcessTransaction(tx)
 	}
+	bc.atHeight(bc.UTXOSet, 1)
+	bc.index = buildIndex(bc.Blocks)
 	return bc
 }
 
 // NewBlockchainFromBlocks creates a blockchain from existing blocks
-func NewBlockchainFromBlocks(blocks []*block.Block, difficulty int) *Blockchain {
+func NewBlockchainFromBlocks(blocks []*block.Block, difficulty int, opts ...Option) *Blockchain {
 	bc := &Blockchain{
 		Blocks:     blocks,
 		Difficulty: difficulty,
 		UTXOSet:    transaction.NewUTXOSet(),
+		options:    buildOptions(opts),
+		schedule:   []DifficultyFloor{{Height: 1, Difficulty: difficulty}},
+		tree:       newBlockTree(),
 	}
-	// Rebuild UTXO set from blocks
+	// Rebuild UTXO set from blocks, keeping each block's undo data
 	for _, b := range blocks {
+		bc.ConfigureBlock(b)
+		bc.atHeight(bc.UTXOSet, b.Index)
+		bc.tree.undo[b.Hash] = bc.UTXOSet.ComputeDelta(b.Transactions)
 		for _, tx := range b.Transactions {
 			bc.UTXOSet.ProcessTransaction(tx)
 		}
 	}
+	bc.atHeight(bc.UTXOSet, int64(len(blocks)))
+	bc.index = buildIndex(blocks)
+	bc.retargetAll()
 	return bc
 }
 
+// Options returns the chain's feature options
+func (bc *Blockchain) Options() Options {
+	return bc.options
+}
+
+// blockOptions returns the block construction options for a block at height
+func (bc *Blockchain) blockOptions(height int64) []block.Option {
+	ctx := bc.ContextAt(height)
+	return []block.Option{block.WithMerkleTree(ctx.UseMerkleTree), block.WithPowAlgorithm(ctx.PowAlgorithm)}
+}
+
+// ConfigureBlock applies the hashing rules of the block's height to a block
+// received from elsewhere, so its hash is checked the way this chain computed
+// hashes at that height
+func (bc *Blockchain) ConfigureBlock(b *block.Block) {
+	b.SetMerkleMode(bc.ContextAt(b.Index).UseMerkleTree)
+}
+
+// SetStore attaches a persistent store that receives every chain change
+func (bc *Blockchain) SetStore(store ChainStore) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.store = store
+}
+
 // GetLatestBlock returns the most recent block in the chain
 func (bc *Blockchain) GetLatestBlock() *block.Block {
 	bc.mu.RLock()
@@ -84,22 +196,46 @@ func (bc *Blockchain) GetLength() int {
 	return len(bc.Blocks)
 }
 
-// AddBlock adds a validated block to the blockchain
+// AddBlock adds a validated block to the tip of the blockchain. A block that
+// does not extend the tip is rejected; ProcessBlock keeps it instead.
 func (bc *Blockchain) AddBlock(newBlock *block.Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
+	return bc.addBlockUnlocked(newBlock)
+}
 
+// addBlockUnlocked validates a block and appends it to the tip, keeping the
+// UTXO changes it makes so a reorganization can roll it back
+func (bc *Blockchain) addBlockUnlocked(newBlock *block.Block) error {
 	// Validate the block
+	bc.ConfigureBlock(newBlock)
 	if err := bc.validateBlockUnlocked(newBlock); err != nil {
 		return err
 	}
 
+	// Persist before applying so a crash never leaves memory ahead of disk
+	bc.atHeight(bc.UTXOSet, newBlock.Index)
+	delta := bc.UTXOSet.ComputeDelta(newBlock.Transactions)
+	if bc.store != nil {
+		if err := bc.store.ConnectBlock(newBlock, delta); err != nil {
+			bc.atHeight(bc.UTXOSet, newBlock.Index+1)
+			return fmt.Errorf("%w: %v", ErrPersistFailed, err)
+		}
+	}
+
 	bc.Blocks = append(bc.Blocks, newBlock)
+	bc.index.addBlock(bc.Blocks, int64(len(bc.Blocks)-1))
 
 	// Update UTXO set with transactions from the new block
 	for _, tx := range newBlock.Transactions {
 		bc.UTXOSet.ProcessTransaction(tx)
 	}
+	bc.atHeight(bc.UTXOSet, newBlock.Index+1)
+	bc.tree.undo[newBlock.Hash] = delta
+	bc.pruneTree()
+
+	// With dynamic difficulty, this block may close a retarget interval
+	bc.retarget(bc.Blocks)
 
 	return nil
 }
@@ -123,9 +259,14 @@ func (bc *Blockchain) validateBlockUnlocked(newBlock *block.Block) error {
 		return ErrInvalidBlock
 	}
 
-	// Check if PoW is valid
-	if !newBlock.HasValidPoW() {
-		return ErrInvalidPoW
+	// A Merkle-mode hash covers only the root, so the root must cover the transactions
+	if newBlock.UsesMerkleTree() && !newBlock.HasValidMerkleRoot() {
+		return ErrInvalidMerkleRoot
+	}
+
+	// Check the block is sealed
+	if err := bc.Engine().ValidateHeader(newBlock); err != nil {
+		return err
 	}
 
 	// Validate all transactions (basic validation)
@@ -133,6 +274,16 @@ func (bc *Blockchain) validateBlockUnlocked(newBlock *block.Block) error {
 		return ErrInvalidBlock
 	}
 
+	// Validate against the rules in force at this height
+	if err := bc.ContextAt(newBlock.Index).checkBlockRules(newBlock); err != nil {
+		return err
+	}
+
+	// Check the timestamp against recent blocks and the local clock
+	if err := bc.checkTimestamp(newBlock, bc.Blocks); err != nil {
+		return err
+	}
+
 	// Validate transactions against UTXO set
 	if err := bc.ValidateBlockTransactions(newBlock); err != nil {
 		return err
@@ -141,11 +292,75 @@ func (bc *Blockchain) validateBlockUnlocked(newBlock *block.Block) error {
 	return nil
 }
 
+// VerifyHeader checks a block's header against its predecessor (nil for a
+// genesis block): index, hash link, hash, and proof of work. It does not look
+// at transactions or chain state, so a peer's chain can be checked block by
+// block before paying for full validation.
+func (bc *Blockchain) VerifyHeader(b, prev *block.Block) error {
+	bc.ConfigureBlock(b)
+	if !b.HasValidHash() {
+		if prev == nil {
+			return ErrInvalidGenesis
+		}
+		return ErrInvalidBlock
+	}
+	return bc.CheckHeader(b, prev)
+}
+
+// CheckHeader is VerifyHeader for a header received without its transactions.
+// The block's hash is taken as claimed, since it commits to the transactions;
+// only the link to prev, the proof of work and the claimed difficulty are
+// checked. VerifyHeader checks the hash once the block's body arrives.
+func (bc *Blockchain) CheckHeader(b, prev *block.Block) error {
+	if prev == nil {
+		if b.Index != 0 || b.PrevHash != "0000000000000000000000000000000000000000000000000000000000000000" {
+			return ErrInvalidGenesis
+		}
+		return nil
+	}
+
+	if b.Index != prev.Index+1 {
+		return ErrInvalidIndex
+	}
+	if b.PrevHash != prev.Hash {
+		return ErrInvalidPrevHash
+	}
+	if err := bc.Engine().ValidateHeader(b); err != nil {
+		return err
+	}
+	ctx := bc.ContextAt(b.Index)
+	if bc.options.UseDynamicDifficulty {
+		// The requirement follows the timestamps of the header's own branch,
+		// which full validation replays; only the floor is checked here
+		ctx.Difficulty = 0
+	}
+	if err := ctx.checkHeaderRules(b); err != nil {
+		return err
+	}
+	// Without the ancestry only the clock can be checked; full validation
+	// checks the median time past
+	return bc.checkTimestamp(b, nil)
+}
+
 // ValidateBlockTransactions validates all transactions in a block against the UTXO set
 func (bc *Blockchain) ValidateBlockTransactions(newBlock *block.Block) error {
-	// Create a temporary UTXO set copy to track spent outputs within this block
+	// A coinbase-only block spends nothing, so it is checked against an empty
+	// set; otherwise work on a copy to track spent outputs within this block
+	if len(newBlock.Transactions) == 1 && newBlock.Transactions[0].IsCoinbase() {
+		return bc.applyBlockTransactions(transaction.NewUTXOSet(), newBlock)
+	}
 	tempUTXO := bc.UTXOSet.Copy()
+	tempUTXO.Sigs = transaction.VerifySpends(blockSpends([]*block.Block{newBlock}, bc.UTXOSet))
+	return bc.applyBlockTransactions(tempUTXO, newBlock)
+}
 
+// applyBlockTransactions validates a block's transactions and coinbase against
+// tempUTXO, applying them as it goes. On error tempUTXO is left part-applied.
+func (bc *Blockchain) applyBlockTransactions(tempUTXO *transaction.UTXOSet, newBlock *block.Block) error {
+	if err := bc.options.Params.checkBlockSize(newBlock.Transactions); err != nil {
+		return err
+	}
+	bc.atHeight(tempUTXO, newBlock.Index)
 	var totalFees int64
 	var coinbaseValue int64
 	coinbaseCount := 0
@@ -183,14 +398,22 @@ func (bc *Blockchain) ValidateBlockTransactions(newBlock *block.Block) error {
 		return ErrInvalidTransaction
 	}
 
-	expectedReward := BaseSubsidy + totalFees
+	expectedReward := bc.options.Params.SubsidyAt(newBlock.Index) + totalFees
 	if coinbaseValue > expectedReward {
-		return ErrInvalidTransaction
+		return fmt.Errorf("%w: block #%d pays %d, allowed %d",
+			ErrExcessCoinbase, newBlock.Index, coinbaseValue, expectedReward)
 	}
 
 	return nil
 }
 
+// atHeight readies utxo to validate and apply the block at height: outputs
+// are stamped with it, and lock times and coinbase maturity checked against it
+func (bc *Blockchain) atHeight(utxo *transaction.UTXOSet, height int64) {
+	utxo.Height = height
+	utxo.CoinbaseMaturity = bc.options.Params.CoinbaseMaturityAt(height)
+}
+
 // ValidateChain validates the entire blockchain
 func (bc *Blockchain) ValidateChain() error {
 	bc.mu.RLock()
@@ -212,29 +435,56 @@ func (bc *Blockchain) ValidateChain() error {
 		return ErrInvalidGenesis
 	}
 
-	// Validate each subsequent block
-	for i := 1; i < len(bc.Blocks); i++ {
-		currentBlock := bc.Blocks[i]
-		prevBlock := bc.Blocks[i-1]
+	// Replay the ledger from genesis rather than trust the UTXO set built for
+	// the chain, so spends and coinbase values are checked block by block
+	utxo := transaction.NewUTXOSet()
+	for _, tx := range genesis.Transactions {
+		utxo.ProcessTransaction(tx)
+	}
 
-		// Check index
-		if currentBlock.Index != prevBlock.Index+1 {
-			return ErrInvalidIndex
+	// Validate each subsequent block, long chains checked in parallel first
+	pre := bc.prevalidate(bc.Blocks[1:], utxo)
+	utxo.Sigs = pre.signatures()
+	for i := 1; i < len(bc.Blocks); i++ {
+		if err := bc.checkBlock(bc.Blocks[i], bc.Blocks[:i], utxo, pre); err != nil {
+			return err
 		}
+	}
 
-		// Check previous hash pointer
-		if currentBlock.PrevHash != prevBlock.Hash {
-			return ErrInvalidPrevHash
-		}
+	return nil
+}
+
+// checkBlock fully validates currentBlock as the successor of chain, the
+// blocks up to its parent, applying its transactions to utxo, the ledger as
+// of the parent. The checks needing no chain state are skipped if pre (which
+// may be nil) has them passed. On error utxo is left part-applied.
+func (bc *Blockchain) checkBlock(currentBlock *block.Block, chain []*block.Block, utxo *transaction.UTXOSet, pre *prevalidated) error {
+	prevBlock := chain[len(chain)-1]
+
+	// Check index
+	if currentBlock.Index != prevBlock.Index+1 {
+		return ErrInvalidIndex
+	}
 
+	// Check previous hash pointer
+	if currentBlock.PrevHash != prevBlock.Hash {
+		return ErrInvalidPrevHash
+	}
+
+	if !pre.passed(currentBlock) {
 		// Check hash is valid
 		if !currentBlock.HasValidHash() {
 			return ErrInvalidBlock
 		}
 
-		// Check PoW is valid
-		if !currentBlock.HasValidPoW() {
-			return ErrInvalidPoW
+		// Check the hashed Merkle root commits to the transactions
+		if currentBlock.UsesMerkleTree() && !currentBlock.HasValidMerkleRoot() {
+			return ErrInvalidMerkleRoot
+		}
+
+		// Check the block is sealed
+		if err := bc.Engine().ValidateHeader(currentBlock); err != nil {
+			return err
 		}
 
 		// Check transactions are valid
@@ -243,29 +493,87 @@ func (bc *Blockchain) ValidateChain() error {
 		}
 	}
 
-	return nil
+	// Check against the rules in force at this block's height, not the current ones
+	if err := bc.ContextAt(currentBlock.Index).checkBlockRules(currentBlock); err != nil {
+		return err
+	}
+
+	// Check the timestamp against the blocks before it
+	if err := bc.checkTimestamp(currentBlock, chain); err != nil {
+		return err
+	}
+
+	// Check spends and the coinbase against the ledger so far
+	return bc.applyBlockTransactions(utxo, currentBlock)
 }
 
 // ReplaceChain replaces the current chain with a new one if it's longer and valid
-// This implements the longest chain rule
+// This implements the longest chain rule. The new chain is validated in full,
+// economic rules included, so a longer branch minting extra coins is refused.
 func (bc *Blockchain) ReplaceChain(newBlocks []*block.Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
+	return bc.replaceChainUnlocked(newBlocks)
+}
 
+// replaceChainUnlocked is ReplaceChain with mu held. The blocks it detaches
+// move to the side branches, so the chain can switch back to them.
+func (bc *Blockchain) replaceChainUnlocked(newBlocks []*block.Block) error {
 	// Check if new chain is longer
 	if len(newBlocks) <= len(bc.Blocks) {
 		return ErrChainTooShort
 	}
 
-	// Validate the new chain
-	newChain := NewBlockchainFromBlocks(newBlocks, bc.Difficulty)
+	// However long, a chain rewriting checkpointed history is refused outright
+	if err := bc.options.Params.checkCheckpoints(newBlocks); err != nil {
+		return err
+	}
+
+	// Only the blocks above the last one both chains share are validated and
+	// applied; the UTXO set is rolled back to that block, not rebuilt
+	fork := min(len(bc.Blocks), len(newBlocks)) - 1
+	for fork >= 0 && bc.Blocks[fork].Hash != newBlocks[fork].Hash {
+		fork--
+	}
+	if fork >= 0 {
+		_, err := bc.switchBranch(int64(fork), newBlocks[fork+1:])
+		return err
+	}
+
+	// A chain from another genesis block is validated from scratch
+	newChain := NewBlockchainFromBlocks(newBlocks, bc.Difficulty, WithOptions(bc.options))
+	newChain.setSchedule(bc.DifficultySchedule())
+	newChain.retargetAll()
 	if err := newChain.ValidateChain(); err != nil {
 		return err
 	}
 
+	if bc.store != nil {
+		if err := bc.store.ReplaceChain(newBlocks); err != nil {
+			return fmt.Errorf("%w: %v", ErrPersistFailed, err)
+		}
+	}
+
+	// Detached blocks become a side branch
+	bc.tree.reorgs++
+	for _, b := range bc.Blocks {
+		bc.tree.side[b.Hash] = b
+	}
+	for _, b := range newBlocks {
+		delete(bc.tree.side, b.Hash)
+		bc.tree.removeOrphan(b.Hash)
+	}
+
 	// Replace the chain and UTXO set
 	bc.Blocks = newBlocks
 	bc.UTXOSet = newChain.UTXOSet
+	bc.index = newChain.index
+	bc.tree.undo = newChain.tree.undo
+	if bc.options.UseDynamicDifficulty {
+		bc.Difficulty = newChain.Difficulty
+		bc.setSchedule(newChain.DifficultySchedule())
+	}
+	bc.pruneTree()
 	return nil
 }
 
@@ -281,6 +589,7 @@ func (bc *Blockchain) CreateBlock(transactions []*transaction.Transaction, miner
 		latestBlock.Hash,
 		bc.Difficulty,
 		minerID,
+		bc.blockOptions(latestBlock.Index+1)...,
 	)
 	return newBlock
 }
@@ -313,11 +622,13 @@ func (bc *Blockchain) GetBlocksFrom(startIndex int64) []*block.Block {
 	return blocks
 }
 
-// SetDifficulty updates the mining difficulty
+// SetDifficulty updates the mining difficulty. It becomes the required
+// difficulty from the next block on; earlier blocks keep their requirement.
 func (bc *Blockchain) SetDifficulty(difficulty int) {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 	bc.Difficulty = difficulty
+	bc.scheduleDifficulty(bc.Blocks[len(bc.Blocks)-1].Index+1, difficulty)
 }
 
 // GetDifficulty returns the current mining difficulty
@@ -337,6 +648,12 @@ func (bc *Blockchain) ValidateTransaction(tx *transaction.Transaction) error {
 		return ErrInvalidTransaction
 	}
 
+	// Rules that will be active for the next block
+	nextHeight := bc.Blocks[len(bc.Blocks)-1].Index + 1
+	if err := bc.ContextAt(nextHeight).checkTransactionRules(tx); err != nil {
+		return err
+	}
+
 	// UTXO validation (skip for coinbase)
 	if !tx.IsCoinbase() {
 		if err := bc.UTXOSet.ValidateTransaction(tx); err != nil {
@@ -354,6 +671,45 @@ func (bc *Blockchain) GetUTXOSet() *transaction.UTXOSet {
 	return bc.UTXOSet.Copy()
 }
 
+// HasUTXO reports whether an output is unspent, without copying the UTXO set
+func (bc *Blockchain) HasUTXO(txID string, outIndex int) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.UTXOSet.HasUTXO(txID, outIndex)
+}
+
+// UTXOSize returns the number of unspent outputs and their approximate
+// memory use in bytes, without copying the UTXO set
+func (bc *Blockchain) UTXOSize() (int, int64) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.UTXOSet.Size()
+}
+
+// FindUTXO returns a copy of an unspent output, or nil if it is spent or unknown
+func (bc *Blockchain) FindUTXO(txID string, outIndex int) *transaction.UTXO {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	utxo := bc.UTXOSet.FindUTXO(txID, outIndex)
+	if utxo == nil {
+		return nil
+	}
+	u := *utxo
+	return &u
+}
+
+// FindAddressUTXOs returns copies of an address's unspent outputs and the
+// height of the tip they reflect, without copying the whole UTXO set
+func (bc *Blockchain) FindAddressUTXOs(address string) ([]transaction.UTXO, int64) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	var utxos []transaction.UTXO
+	for _, utxo := range bc.UTXOSet.FindUTXOsForAddress(address) {
+		utxos = append(utxos, *utxo)
+	}
+	return utxos, int64(len(bc.Blocks)) - 1
+}
+
 // GetBalance returns the balance for an address
 func (bc *Blockchain) GetBalance(address string) int64 {
 	bc.mu.RLock()
@@ -244,3 +244,97 @@ func TestSetDifficulty(t *testing.T) {
 		t.Errorf("Expected difficulty 4, got %d", bc.GetDifficulty())
 	}
 }
+
+func TestPerChainMerkleOption(t *testing.T) {
+	merkleChain := NewBlockchain(2, WithMerkleTree(true))
+	legacyChain := NewBlockchain(2, WithMerkleTree(false))
+
+	if merkleChain.GetLatestBlock().MerkleRoot == "" {
+		t.Error("Merkle chain genesis should commit to a Merkle root")
+	}
+	if legacyChain.GetLatestBlock().MerkleRoot != "" {
+		t.Error("Legacy chain genesis should not set a Merkle root")
+	}
+
+	// Each chain mines and validates in its own mode, independent of the other
+	if err := merkleChain.AddBlock(createValidBlock(merkleChain, "miner1")); err != nil {
+		t.Errorf("Merkle chain rejected its own block: %v", err)
+	}
+	if err := legacyChain.AddBlock(createValidBlock(legacyChain, "miner1")); err != nil {
+		t.Errorf("Legacy chain rejected its own block: %v", err)
+	}
+
+	// The options are per instance and don't come from the global defaults
+	if !merkleChain.Options().UseMerkleTree || legacyChain.Options().UseMerkleTree {
+		t.Error("Chain options should be independent of each other")
+	}
+}
+
+func TestReceivedBlockUsesChainOptions(t *testing.T) {
+	legacyChain := NewBlockchain(2, WithMerkleTree(false))
+	newBlock := createValidBlock(legacyChain, "miner1")
+
+	// A deserialized copy carries no hash mode; the chain applies its own
+	data, _ := newBlock.Serialize()
+	received, _ := block.DeserializeBlock(data)
+
+	merkleChain := NewBlockchainFromBlocks(legacyChain.GetBlocks(), 2, WithMerkleTree(true))
+	if err := merkleChain.AddBlock(received); err == nil {
+		t.Error("A chain in Merkle mode should reject a legacy-hashed block")
+	}
+
+	received, _ = block.DeserializeBlock(data)
+	if err := legacyChain.AddBlock(received); err != nil {
+		t.Errorf("Legacy chain should accept the received block: %v", err)
+	}
+}
+
+func TestVerifyHeader(t *testing.T) {
+	bc := NewBlockchain(2)
+	genesis := bc.GetLatestBlock()
+	b := createValidBlock(bc, "miner1")
+
+	if err := bc.VerifyHeader(genesis, nil); err != nil {
+		t.Errorf("Genesis header should verify: %v", err)
+	}
+	if err := bc.VerifyHeader(b, genesis); err != nil {
+		t.Errorf("Mined header should verify: %v", err)
+	}
+	if err := bc.VerifyHeader(b, nil); err != ErrInvalidGenesis {
+		t.Errorf("Non-genesis block without predecessor should fail, got %v", err)
+	}
+
+	unmined := bc.CreateBlock(b.Transactions, "miner1")
+	for nonce := int64(0); ; nonce++ {
+		unmined.Nonce = nonce
+		if unmined.Hash = unmined.CalculateHash(); !pow.ValidateHash(unmined.Hash, bc.Difficulty) {
+			break
+		}
+	}
+	if err := bc.VerifyHeader(unmined, genesis); err != ErrInvalidPoW {
+		t.Errorf("Expected ErrInvalidPoW for an unmined header, got %v", err)
+	}
+}
+
+func TestAddBlockWithMismatchedMerkleRoot(t *testing.T) {
+	bc := NewBlockchain(2, WithMerkleTree(true))
+	newBlock := createValidBlock(bc, "miner1")
+
+	// The hash commits to the root, so swapping transactions leaves hash and PoW intact
+	newBlock.Transactions[0] = transaction.NewCoinbaseTransaction("thief", 5000000000, 1)
+	if !newBlock.HasValidHash() || !newBlock.HasValidPoW() {
+		t.Fatal("Swapping transactions should not disturb the header")
+	}
+
+	if err := bc.AddBlock(newBlock); err != ErrInvalidMerkleRoot {
+		t.Errorf("Expected ErrInvalidMerkleRoot, got %v", err)
+	}
+
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Failed to add valid block: %v", err)
+	}
+	bc.Blocks[1].Transactions[0] = transaction.NewCoinbaseTransaction("thief", 5000000000, 1)
+	if err := bc.ValidateChain(); err != ErrInvalidMerkleRoot {
+		t.Errorf("Expected ErrInvalidMerkleRoot from ValidateChain, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"fmt"
+)
+
+// DefaultMaxBlockBytes is the most serialized transaction bytes a block may
+// carry under the default chain params, well within the network's message limit
+const DefaultMaxBlockBytes = 1 << 20
+
+// ErrBlockTooLarge is returned for a block carrying more transactions, or
+// more transaction bytes, than the chain params allow
+var ErrBlockTooLarge = fmt.Errorf("%w: block exceeds the size limit", ErrInvalidBlock)
+
+// TxSize returns the length of a transaction's binary encoding, what the
+// block size limit counts
+func TxSize(tx *transaction.Transaction) int64 {
+	data, err := tx.Serialize()
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// BlockSize returns the total serialized size of a block's transactions,
+// coinbase included
+func BlockSize(txs []*transaction.Transaction) int64 {
+	var size int64
+	for _, tx := range txs {
+		size += TxSize(tx)
+	}
+	return size
+}
+
+// BlockLimits returns the most transactions besides the coinbase and the most
+// serialized transaction bytes a block may carry (0 = unlimited)
+func (p *ChainParams) BlockLimits() (maxTxs int, maxBytes int64) {
+	if p == nil {
+		return 0, 0
+	}
+	return p.MaxBlockTxs, p.MaxBlockBytes
+}
+
+// checkBlockSize checks a block's transactions against the chain's limits:
+// MaxBlockTxs counts all but the coinbase, MaxBlockBytes all of them
+func (p *ChainParams) checkBlockSize(txs []*transaction.Transaction) error {
+	maxTxs, maxBytes := p.BlockLimits()
+	count := 0
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			count++
+		}
+	}
+	if maxTxs > 0 && count > maxTxs {
+		return fmt.Errorf("%w: %d transactions, limit %d", ErrBlockTooLarge, count, maxTxs)
+	}
+	if maxBytes > 0 {
+		if size := BlockSize(txs); size > maxBytes {
+			return fmt.Errorf("%w: %d bytes, limit %d", ErrBlockTooLarge, size, maxBytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+)
+
+type outPoint = struct {
+	TxID     string
+	OutIndex int
+}
+
+func TestBlockSizeLimits(t *testing.T) {
+	params := DefaultChainParams()
+	bc := NewBlockchain(1, WithParams(params))
+	kp, _ := transaction.GenerateKeyPair()
+	pub := kp.GetPublicKeyHex()
+	keys := map[string]string{pub: kp.GetPrivateKeyHex()}
+
+	// Fund a key, then spend its reward twice over in one block
+	funding := transaction.NewCoinbaseTransaction(pub, BaseSubsidy, 1)
+	b := bc.CreateBlock([]*transaction.Transaction{funding}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	ledger := bc.GetUTXOSet()
+	first, err := ledger.CreateTransaction([]outPoint{{funding.ID, 0}},
+		[]transaction.TxOutput{{Value: BaseSubsidy - 10, ScriptPubKey: pub}}, keys)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	ledger.ProcessTransaction(first)
+	second, err := ledger.CreateTransaction([]outPoint{{first.ID, 0}},
+		[]transaction.TxOutput{{Value: BaseSubsidy - 20, ScriptPubKey: "bob"}}, keys)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	coinbase := transaction.NewCoinbaseTransaction("miner1", BaseSubsidy+20, 2)
+	txs := []*transaction.Transaction{coinbase, first, second}
+	b = bc.CreateBlock(txs, "miner1")
+	mineForTest(bc, b)
+
+	// The coinbase does not count toward the transaction limit
+	params.MaxBlockTxs = 1
+	if err := bc.AddBlock(b); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("Expected a block over the transaction limit to be refused, got %v", err)
+	}
+	params.MaxBlockTxs = 2
+
+	// The byte limit counts every transaction, coinbase included
+	params.MaxBlockBytes = BlockSize(txs) - 1
+	if err := bc.AddBlock(b); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("Expected a block over the byte limit to be refused, got %v", err)
+	}
+	params.MaxBlockBytes = BlockSize(txs)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("A block at the limits should be accepted: %v", err)
+	}
+
+	// The whole chain is revalidated under the same limits
+	params.MaxBlockTxs = 1
+	if err := bc.ValidateChain(); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("Expected chain validation to refuse the block, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/difficulty"
+	"blockchain/pkg/pow"
+	"context"
+)
+
+// ConsensusEngine decides what seals a block and how the difficulty blocks
+// must claim changes. A Blockchain asks its engine rather than checking proof
+// of work or retargeting itself, so other consensus rules plug in through
+// WithEngine without changes to the chain.
+type ConsensusEngine interface {
+	// ValidateHeader checks that b's seal meets what its header claims. The
+	// chain checks separately that b's hash commits to its contents and that
+	// the claim is what consensus requires.
+	ValidateHeader(b *block.Block) error
+
+	// Seal searches for a seal of b on the given number of workers, setting
+	// its nonce and hash, until one is found or ctx is done
+	Seal(ctx context.Context, b *block.Block, workers int) *pow.MiningResult
+
+	// CalcDifficulty returns the difficulty required from the block after
+	// chain, a chain from genesis, given the difficulty required of chain's
+	// last block, and whether chain ends at a retarget. The chain only asks
+	// with dynamic difficulty on.
+	CalcDifficulty(chain []*block.Block, current int) (int, bool)
+}
+
+// PoWEngine is the proof of work the chain has always used: a block is sealed
+// by a hash with at least its claimed difficulty in leading zero bits, and
+// every difficulty.AdjustmentInterval blocks the difficulty is recalculated
+// from how long the last interval took
+type PoWEngine struct{}
+
+// ValidateHeader checks the block's proof of work against its claimed difficulty
+func (PoWEngine) ValidateHeader(b *block.Block) error {
+	if !b.HasValidPoW() {
+		return ErrInvalidPoW
+	}
+	return nil
+}
+
+// Seal mines the block, in parallel if workers is above one
+func (PoWEngine) Seal(ctx context.Context, b *block.Block, workers int) *pow.MiningResult {
+	if workers > 1 {
+		return pow.NewProofOfWork(b).MineParallel(ctx, workers)
+	}
+	return pow.NewProofOfWork(b).Mine(ctx, nil)
+}
+
+// CalcDifficulty retargets from the timestamps of the last interval of chain
+func (PoWEngine) CalcDifficulty(chain []*block.Block, current int) (int, bool) {
+	next := int64(len(chain))
+	if !difficulty.ShouldAdjust(next) {
+		return current, false
+	}
+	return difficulty.CalculateNewDifficulty(chain[next-difficulty.AdjustmentInterval:], current), true
+}
+
+// WithEngine sets the consensus engine of the chain (PoWEngine by default)
+func WithEngine(engine ConsensusEngine) Option {
+	return func(o *Options) {
+		o.Engine = engine
+	}
+}
+
+// Engine returns the chain's consensus engine
+func (bc *Blockchain) Engine() ConsensusEngine {
+	if bc.options.Engine == nil {
+		return PoWEngine{}
+	}
+	return bc.options.Engine
+}
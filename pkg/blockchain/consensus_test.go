@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/pow"
+	"context"
+	"errors"
+	"testing"
+)
+
+var errUnsealed = errors.New("not signed by the authority")
+
+// authorityEngine seals a block by marking it with a fixed nonce and keeps the
+// difficulty at zero, so blocks need no proof of work at all
+type authorityEngine struct{}
+
+func (authorityEngine) ValidateHeader(b *block.Block) error {
+	if b.Nonce != 42 {
+		return errUnsealed
+	}
+	return nil
+}
+
+func (authorityEngine) Seal(_ context.Context, b *block.Block, _ int) *pow.MiningResult {
+	b.Nonce = 42
+	b.Hash = b.CalculateHash()
+	return &pow.MiningResult{Block: b, Success: true, Nonce: b.Nonce, Attempts: 1, WorkerAttempts: []int64{1}}
+}
+
+func (authorityEngine) CalcDifficulty(_ []*block.Block, current int) (int, bool) {
+	return current, false
+}
+
+func TestChainUsesConsensusEngine(t *testing.T) {
+	bc := NewBlockchain(0, WithEngine(authorityEngine{}))
+
+	b := createValidBlock(bc, "miner1")
+	b.Nonce = 7
+	b.Hash = b.CalculateHash()
+	if err := bc.AddBlock(b); !errors.Is(err, errUnsealed) {
+		t.Fatalf("Expected the engine to reject an unsealed block, got %v", err)
+	}
+
+	if result := bc.Engine().Seal(context.Background(), b, 1); !result.Success {
+		t.Fatal("Engine failed to seal the block")
+	}
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add a sealed block: %v", err)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Chain sealed by the engine should validate: %v", err)
+	}
+
+	if _, ok := NewBlockchain(2).Engine().(PoWEngine); !ok {
+		t.Error("A chain should default to proof of work")
+	}
+}
@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/pow/hashfn"
+	"blockchain/pkg/transaction"
+	"fmt"
+)
+
+// ValidationContext captures the consensus rules that applied at one block
+// height. Blocks are always checked against the context of their own height,
+// so importing or reindexing an old chain uses the rules of its time rather
+// than the node's current settings.
+type ValidationContext struct {
+	Height        int64
+	UseMerkleTree bool   // How block hashes are computed at this height
+	MinDifficulty int    // Difficulty floor from the params (0 = none)
+	Difficulty    int    // Difficulty consensus requires; blocks must claim exactly this (0 = not known)
+	PowAlgorithm  string // Proof-of-work hash function blocks must name ("" = SHA-256)
+	Params        *ChainParams
+}
+
+// ContextAt returns the validation context for a block at the given height
+func (bc *Blockchain) ContextAt(height int64) *ValidationContext {
+	params := bc.options.Params
+	useMerkle := bc.options.UseMerkleTree
+	if params != nil {
+		if _, ok := params.Activations[RuleMerkleHash]; ok {
+			useMerkle = params.IsActive(RuleMerkleHash, height)
+		}
+	}
+	return &ValidationContext{
+		Height:        height,
+		UseMerkleTree: useMerkle,
+		MinDifficulty: params.MinDifficultyAt(height),
+		Difficulty:    bc.RequiredDifficulty(height),
+		PowAlgorithm:  params.PowAlgorithmAt(height),
+		Params:        params,
+	}
+}
+
+// IsActive reports whether a rule applies in this context
+func (ctx *ValidationContext) IsActive(rule Rule) bool {
+	return ctx.Params.IsActive(rule, ctx.Height)
+}
+
+// checkHeaderRules validates the header fields a context constrains. A block
+// at a checkpoint height must be the checkpointed one, and every block must
+// be hashed with the function the params schedule for its height. Proof of
+// work is checked against the block's claimed difficulty elsewhere, so the
+// claim itself must be what consensus requires.
+func (ctx *ValidationContext) checkHeaderRules(b *block.Block) error {
+	if hash, ok := ctx.Params.CheckpointAt(ctx.Height); ok && b.Hash != hash {
+		return fmt.Errorf("%w: block #%d is %s, checkpoint requires %s", ErrCheckpointMismatch, ctx.Height, b.Hash, hash)
+	}
+	if b.PowAlgorithm != ctx.PowAlgorithm {
+		return fmt.Errorf("%w: block hashed with %s, height %d requires %s",
+			ErrInvalidPoW, powAlgorithmName(b.PowAlgorithm), ctx.Height, powAlgorithmName(ctx.PowAlgorithm))
+	}
+	if b.Difficulty < ctx.MinDifficulty {
+		return fmt.Errorf("%w: difficulty %d below floor %d at height %d",
+			ErrInvalidPoW, b.Difficulty, ctx.MinDifficulty, ctx.Height)
+	}
+	if b.Difficulty < ctx.Difficulty {
+		return fmt.Errorf("%w: block claims %d, height %d requires %d",
+			ErrInsufficientDifficulty, b.Difficulty, ctx.Height, ctx.Difficulty)
+	}
+	if ctx.Difficulty > 0 && b.Difficulty != ctx.Difficulty {
+		return fmt.Errorf("%w: block claims %d, height %d requires %d",
+			ErrDifficultyMismatch, b.Difficulty, ctx.Height, ctx.Difficulty)
+	}
+	return nil
+}
+
+// powAlgorithmName names a hash function for messages, where "" reads badly
+func powAlgorithmName(name string) string {
+	if name == "" {
+		return hashfn.SHA256
+	}
+	return name
+}
+
+// checkBlockRules validates a block against the height-specific rules of the context
+func (ctx *ValidationContext) checkBlockRules(b *block.Block) error {
+	if err := ctx.checkHeaderRules(b); err != nil {
+		return err
+	}
+
+	if ctx.IsActive(RuleStrictMerkleRoot) && b.UsesMerkleTree() && !b.HasValidMerkleRoot() {
+		return fmt.Errorf("%w: %s at height %d", ErrRuleViolation, RuleStrictMerkleRoot, ctx.Height)
+	}
+
+	for i, tx := range b.Transactions {
+		if i == 0 && tx.IsCoinbase() && ctx.IsActive(RuleCoinbaseHeight) {
+			expected := fmt.Sprintf("coinbase:%d", ctx.Height)
+			if tx.Inputs[0].ScriptSig != expected {
+				return fmt.Errorf("%w: %s at height %d", ErrRuleViolation, RuleCoinbaseHeight, ctx.Height)
+			}
+		}
+		if err := ctx.checkTransactionRules(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTransactionRules validates a transaction against the height-specific rules of the context
+func (ctx *ValidationContext) checkTransactionRules(tx *transaction.Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if ctx.IsActive(RuleInputSigHash) && tx.HasLegacySignatures() {
+		return fmt.Errorf("%w: %s (legacy signature) at height %d", ErrRuleViolation, RuleInputSigHash, ctx.Height)
+	}
+	if ctx.IsActive(RuleSpentValueSigHash) && !tx.SignsSpentValues() {
+		return fmt.Errorf("%w: %s (signature not committing to the spent value) at height %d",
+			ErrRuleViolation, RuleSpentValueSigHash, ctx.Height)
+	}
+	if ctx.IsActive(RuleDustLimit) {
+		for i, out := range tx.Outputs {
+			if out.Value < ctx.Params.DustLimit {
+				return fmt.Errorf("%w: %s (output %d is %d satoshi, minimum %d) at height %d",
+					ErrRuleViolation, RuleDustLimit, i, out.Value, ctx.Params.DustLimit, ctx.Height)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/difficulty"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestImportOldChainAfterHashUpgrade(t *testing.T) {
+	// Blocks mined before the upgrade use legacy hashing
+	oldChain := NewBlockchain(2, WithMerkleTree(false))
+	for i := 0; i < 2; i++ {
+		if err := oldChain.AddBlock(createValidBlock(oldChain, "miner1")); err != nil {
+			t.Fatalf("Failed to build old chain: %v", err)
+		}
+	}
+
+	// The upgraded node hashes with the Merkle root from height 3 onward
+	params := DefaultChainParams()
+	params.Activations[RuleMerkleHash] = 3
+	imported := NewBlockchainFromBlocks(oldChain.GetBlocks(), 2, WithMerkleTree(true), WithParams(params))
+	if err := imported.ValidateChain(); err != nil {
+		t.Fatalf("Import of pre-upgrade chain should validate: %v", err)
+	}
+
+	newBlock := createValidBlock(imported, "miner1")
+	if !newBlock.UsesMerkleTree() {
+		t.Error("Blocks after the activation height should commit to the Merkle root")
+	}
+	if err := imported.AddBlock(newBlock); err != nil {
+		t.Fatalf("Post-upgrade block should be accepted: %v", err)
+	}
+
+	// Current settings alone would reject the legacy history
+	current := NewBlockchainFromBlocks(oldChain.GetBlocks(), 2, WithMerkleTree(true))
+	if err := current.ValidateChain(); err == nil {
+		t.Error("Validating old blocks with current settings should fail")
+	}
+}
+
+func TestDifficultyFloorByHeight(t *testing.T) {
+	params := DefaultChainParams()
+	params.DifficultyFloors = []DifficultyFloor{{Height: 2, Difficulty: 3}}
+	bc := NewBlockchain(1, WithParams(params))
+
+	// Height 1 predates the floor, so the old difficulty is still fine
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Block below the floor height should be accepted: %v", err)
+	}
+
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); !errors.Is(err, ErrInvalidPoW) {
+		t.Fatalf("Expected difficulty floor violation, got %v", err)
+	}
+
+	bc.SetDifficulty(3)
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Block meeting the floor should be accepted: %v", err)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Chain spanning the floor change should validate: %v", err)
+	}
+}
+
+func TestRequiredDifficultyIgnoresBlockClaim(t *testing.T) {
+	bc := NewBlockchain(3)
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	// Lowering the difficulty applies from the next block on; history keeps its requirement
+	bc.SetDifficulty(2)
+	if got := bc.RequiredDifficulty(1); got != 3 {
+		t.Errorf("Height 1 should still require 3, got %d", got)
+	}
+	if got := bc.RequiredDifficulty(2); got != 2 {
+		t.Errorf("Height 2 should require 2, got %d", got)
+	}
+	bc.SetDifficulty(3)
+
+	// A block whose hash meets its own claim, but the claim is below consensus
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 2)
+	cheap := bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	cheap.Difficulty = 1
+	pow.NewProofOfWork(cheap).Mine(context.TODO(), nil)
+	if !cheap.HasValidPoW() {
+		t.Fatal("Block should meet its claimed difficulty")
+	}
+
+	prev := bc.GetLatestBlock()
+	if err := bc.VerifyHeader(cheap, prev); !errors.Is(err, ErrInsufficientDifficulty) {
+		t.Errorf("Expected ErrInsufficientDifficulty from VerifyHeader, got %v", err)
+	}
+	if err := bc.AddBlock(cheap); !errors.Is(err, ErrInsufficientDifficulty) || !errors.Is(err, ErrInvalidPoW) {
+		t.Errorf("Expected ErrInsufficientDifficulty from AddBlock, got %v", err)
+	}
+
+	// Nor can a replacement chain carry it
+	blocks := append(bc.GetBlocks(), cheap)
+	if err := bc.ReplaceChain(blocks); !errors.Is(err, ErrInsufficientDifficulty) {
+		t.Errorf("Expected ErrInsufficientDifficulty from ReplaceChain, got %v", err)
+	}
+	if bc.GetLength() != 2 {
+		t.Errorf("Chain should be unchanged, got length %d", bc.GetLength())
+	}
+
+	// Claiming more than required is refused too: the claim must be exact
+	coinbase = transaction.NewCoinbaseTransaction("miner1", 5000000000, 2)
+	costly := bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	costly.Difficulty = 4
+	pow.NewProofOfWork(costly).Mine(context.TODO(), nil)
+	err := bc.AddBlock(costly)
+	if !errors.Is(err, ErrDifficultyMismatch) || errors.Is(err, ErrInsufficientDifficulty) {
+		t.Errorf("Expected ErrDifficultyMismatch for an overstated claim, got %v", err)
+	}
+	if !errors.Is(bc.VerifyHeader(cheap, prev), ErrDifficultyMismatch) {
+		t.Error("An understated claim should be a difficulty mismatch too")
+	}
+}
+
+// addBlockAt mines and adds the next block with the given timestamp
+func addBlockAt(t *testing.T, bc *Blockchain, timestamp int64) {
+	t.Helper()
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, bc.GetLatestBlock().Index+1)
+	b := bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	b.Timestamp = timestamp
+	pow.NewProofOfWork(b).Mine(context.TODO(), nil)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block #%d: %v", b.Index, err)
+	}
+}
+
+func TestDynamicDifficultyRetargets(t *testing.T) {
+	fast := NewBlockchain(2, WithDynamicDifficulty(true))
+	genesis := fast.GetLatestBlock()
+	for i := int64(1); i < difficulty.AdjustmentInterval; i++ {
+		addBlockAt(t, fast, genesis.Timestamp+i*int64(time.Millisecond))
+	}
+	if fast.GetDifficulty() != 3 || fast.RequiredDifficulty(6) != 3 || fast.RequiredDifficulty(5) != 2 {
+		t.Fatalf("Fast blocks should raise the difficulty to 3 from height 6, got %d", fast.GetDifficulty())
+	}
+
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 6)
+	cheap := fast.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	cheap.Difficulty = 2
+	pow.NewProofOfWork(cheap).Mine(context.TODO(), nil)
+	if err := fast.AddBlock(cheap); !errors.Is(err, ErrInsufficientDifficulty) {
+		t.Errorf("A block below the retargeted difficulty should be rejected, got %v", err)
+	}
+
+	// A branch from the same genesis whose blocks came slowly retargets down,
+	// and is validated against its own retarget, not ours
+	slow := NewBlockchainFromBlocks([]*block.Block{genesis.Clone()}, 2, WithDynamicDifficulty(true))
+	for i := int64(1); i < difficulty.AdjustmentInterval+2; i++ {
+		addBlockAt(t, slow, genesis.Timestamp+i*int64(30*time.Second))
+	}
+	if slow.RequiredDifficulty(6) != 1 {
+		t.Fatalf("Slow blocks should lower the difficulty to 1, got %d", slow.RequiredDifficulty(6))
+	}
+	if err := fast.ReplaceChain(slow.GetBlocks()); err != nil {
+		t.Fatalf("The longer slow branch should replace ours: %v", err)
+	}
+	if fast.GetDifficulty() != 1 || fast.RequiredDifficulty(6) != 1 {
+		t.Errorf("Expected the adopted branch's difficulty 1, got %d", fast.GetDifficulty())
+	}
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"fmt"
+)
+
+var (
+	// ErrDifficultyMismatch is returned for a block that claims another
+	// difficulty than consensus requires at its height. It wraps ErrInvalidPoW.
+	ErrDifficultyMismatch = fmt.Errorf("%w: difficulty does not match requirement", ErrInvalidPoW)
+
+	// ErrInsufficientDifficulty is the ErrDifficultyMismatch of a block
+	// claiming less than required, so its proof of work is cheaper
+	ErrInsufficientDifficulty = fmt.Errorf("%w: difficulty below requirement", ErrDifficultyMismatch)
+)
+
+// RequiredDifficulty returns the difficulty consensus requires of the block at
+// height: the chain's difficulty schedule, raised to any floor in its params,
+// plus the offset of any scheduled parameter change.
+// A block's Difficulty field is only the miner's claim; the hash must meet it,
+// and it must be exactly this.
+func (bc *Blockchain) RequiredDifficulty(height int64) int {
+	floor := bc.options.Params.MinDifficultyAt(height)
+	if height <= 0 {
+		return floor // Genesis is fixed, not mined
+	}
+	return max(max(floor, bc.scheduledDifficulty(height))+bc.options.Params.DifficultyOffsetAt(height), 0)
+}
+
+// scheduledDifficulty returns the difficulty schedule's step in force at
+// height, before floors and offsets
+func (bc *Blockchain) scheduledDifficulty(height int64) int {
+	bc.scheduleMu.RLock()
+	defer bc.scheduleMu.RUnlock()
+	scheduled := 0
+	for _, step := range bc.schedule {
+		if step.Height > height {
+			break
+		}
+		scheduled = step.Difficulty
+	}
+	return scheduled
+}
+
+// retarget applies dynamic difficulty once blocks, a chain from genesis, ends
+// at a retarget of the consensus engine: the difficulty the engine calculates
+// is scheduled from the next block on like SetDifficulty would. The caller
+// holds mu for writing or owns bc.
+func (bc *Blockchain) retarget(blocks []*block.Block) {
+	if !bc.options.UseDynamicDifficulty {
+		return
+	}
+	next := int64(len(blocks))
+	d, ok := bc.Engine().CalcDifficulty(blocks, bc.scheduledDifficulty(next-1))
+	if !ok {
+		return
+	}
+	bc.Difficulty = d
+	bc.scheduleDifficulty(next, d)
+}
+
+// retargetAll replays every retarget of the chain's blocks on top of the
+// current schedule, so the difficulty each block must meet follows the
+// timestamps of its own branch
+func (bc *Blockchain) retargetAll() {
+	for n := 1; n <= len(bc.Blocks); n++ {
+		bc.retarget(bc.Blocks[:n])
+	}
+}
+
+// DifficultySchedule returns the difficulty steps the chain has applied, in
+// height order. Each step holds from its height until the next one.
+func (bc *Blockchain) DifficultySchedule() []DifficultyFloor {
+	bc.scheduleMu.RLock()
+	defer bc.scheduleMu.RUnlock()
+	return append([]DifficultyFloor(nil), bc.schedule...)
+}
+
+// scheduleDifficulty makes difficulty apply from height onward, dropping
+// steps at or above that height
+func (bc *Blockchain) scheduleDifficulty(height int64, difficulty int) {
+	bc.scheduleMu.Lock()
+	defer bc.scheduleMu.Unlock()
+	i := len(bc.schedule)
+	for i > 0 && bc.schedule[i-1].Height >= height {
+		i--
+	}
+	bc.schedule = append(bc.schedule[:i], DifficultyFloor{Height: height, Difficulty: difficulty})
+}
+
+// scheduleUpTo returns the steps of schedule at or below height
+func scheduleUpTo(schedule []DifficultyFloor, height int64) []DifficultyFloor {
+	i := len(schedule)
+	for i > 0 && schedule[i-1].Height > height {
+		i--
+	}
+	return schedule[:i]
+}
+
+// setSchedule replaces the difficulty schedule with a copy of steps
+func (bc *Blockchain) setSchedule(steps []DifficultyFloor) {
+	bc.scheduleMu.Lock()
+	defer bc.scheduleMu.Unlock()
+	bc.schedule = append([]DifficultyFloor(nil), steps...)
+}
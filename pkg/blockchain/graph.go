@@ -0,0 +1,213 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+)
+
+const (
+	// MaxTraceDepth bounds how many hops TraceTransaction follows each way
+	MaxTraceDepth = 32
+	// MaxTraceNodes bounds how many transactions one graph holds
+	MaxTraceNodes = 500
+)
+
+var ErrTxNotFound = errors.New("transaction not found")
+
+// TxNode is a confirmed transaction in a transaction graph
+type TxNode struct {
+	TxID     string `json:"txid"`
+	Height   int64  `json:"height"`
+	Coinbase bool   `json:"coinbase"`
+	Value    int64  `json:"value"` // Total output value
+	// Hops from the root: negative for ancestors, positive for descendants
+	Hops int `json:"hops"`
+	// More links lead on from this node than the depth or size limit allowed
+	Partial bool `json:"partial"`
+}
+
+// TxFlow is an edge of a transaction graph: an output of one transaction
+// spent by another
+type TxFlow struct {
+	From     string `json:"from"` // Funding transaction
+	OutIndex int    `json:"out_index"`
+	To       string `json:"to"` // Spending transaction
+	Value    int64  `json:"value"`
+	Address  string `json:"address"`
+}
+
+// TxGraph is the neighbourhood of a transaction: where its funds came from
+// and where its outputs went, up to Depth hops each way
+type TxGraph struct {
+	Root      string   `json:"root"`
+	Depth     int      `json:"depth"`
+	Nodes     []TxNode `json:"nodes"` // Root first, then by distance
+	Edges     []TxFlow `json:"edges"`
+	Truncated bool     `json:"truncated"` // MaxTraceNodes was reached
+}
+
+// txGraphBuilder accumulates a graph while the chain is read-locked
+type txGraphBuilder struct {
+	bc    *Blockchain
+	graph *TxGraph
+	nodes map[string]int // Index into graph.Nodes by transaction ID
+	edges map[string]bool
+}
+
+// tx returns the confirmed transaction with the given ID, or nil
+func (g *txGraphBuilder) tx(txID string) *transaction.Transaction {
+	loc, ok := g.bc.index.txLocations[txID]
+	if !ok {
+		return nil
+	}
+	return g.bc.Blocks[loc.BlockHeight].Transactions[loc.Position]
+}
+
+// addNode adds a transaction at the given hops, reporting whether it is new.
+// Once the graph is full, new transactions are refused.
+func (g *txGraphBuilder) addNode(tx *transaction.Transaction, hops int) bool {
+	if _, ok := g.nodes[tx.ID]; ok {
+		return false
+	}
+	if len(g.graph.Nodes) >= MaxTraceNodes {
+		g.graph.Truncated = true
+		return false
+	}
+	g.nodes[tx.ID] = len(g.graph.Nodes)
+	g.graph.Nodes = append(g.graph.Nodes, TxNode{
+		TxID:     tx.ID,
+		Height:   g.bc.index.txLocations[tx.ID].BlockHeight,
+		Coinbase: tx.IsCoinbase(),
+		Value:    tx.TotalOutputValue(),
+		Hops:     hops,
+	})
+	return true
+}
+
+// addEdge links output outIndex of from to the transaction spending it
+func (g *txGraphBuilder) addEdge(from *transaction.Transaction, outIndex int, to string) {
+	key := outpoint(from.ID, outIndex)
+	if g.edges[key] || outIndex < 0 || outIndex >= len(from.Outputs) {
+		return
+	}
+	g.edges[key] = true
+	out := from.Outputs[outIndex]
+	g.graph.Edges = append(g.graph.Edges, TxFlow{
+		From: from.ID, OutIndex: outIndex, To: to, Value: out.Value, Address: out.ScriptPubKey,
+	})
+}
+
+// markPartial flags the nodes of a walk's last frontier that link further
+func (g *txGraphBuilder) markPartial(frontier []*transaction.Transaction, links func(*transaction.Transaction) bool) {
+	for _, tx := range frontier {
+		if links(tx) {
+			g.graph.Nodes[g.nodes[tx.ID]].Partial = true
+		}
+	}
+}
+
+// funders returns the confirmed transactions whose outputs tx spends, with
+// the spent output index of each input
+func (g *txGraphBuilder) funders(tx *transaction.Transaction) ([]*transaction.Transaction, []int) {
+	if tx.IsCoinbase() {
+		return nil, nil
+	}
+	var txs []*transaction.Transaction
+	var outs []int
+	for _, in := range tx.Inputs {
+		if prev := g.tx(in.TxID); prev != nil {
+			txs = append(txs, prev)
+			outs = append(outs, in.OutIndex)
+		}
+	}
+	return txs, outs
+}
+
+// spenders returns the confirmed transactions spending tx's outputs, with
+// the output index each spends
+func (g *txGraphBuilder) spenders(tx *transaction.Transaction) ([]*transaction.Transaction, []int) {
+	var txs []*transaction.Transaction
+	var outs []int
+	for i := range tx.Outputs {
+		if spend, ok := g.bc.index.spentBy[outpoint(tx.ID, i)]; ok {
+			if next := g.tx(spend.TxID); next != nil {
+				txs = append(txs, next)
+				outs = append(outs, i)
+			}
+		}
+	}
+	return txs, outs
+}
+
+// TraceTransaction walks a confirmed transaction's ancestors (the
+// transactions that funded it) and descendants (the transactions that spent
+// its outputs) breadth first, up to depth hops each way, capped at
+// MaxTraceDepth. Graphs stop growing at MaxTraceNodes transactions.
+func (bc *Blockchain) TraceTransaction(txID string, depth int) (*TxGraph, error) {
+	if depth < 0 {
+		depth = 0
+	}
+	if depth > MaxTraceDepth {
+		depth = MaxTraceDepth
+	}
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	g := &txGraphBuilder{
+		bc:    bc,
+		graph: &TxGraph{Root: txID, Depth: depth},
+		nodes: make(map[string]int),
+		edges: make(map[string]bool),
+	}
+	root := g.tx(txID)
+	if root == nil {
+		return nil, ErrTxNotFound
+	}
+	g.addNode(root, 0)
+
+	// Ancestors: each hop follows the inputs of the previous frontier
+	frontier := []*transaction.Transaction{root}
+	for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+		var next []*transaction.Transaction
+		for _, tx := range frontier {
+			prevs, outs := g.funders(tx)
+			for i, prev := range prevs {
+				if g.addNode(prev, -hop) {
+					next = append(next, prev)
+				}
+				if _, ok := g.nodes[prev.ID]; ok {
+					g.addEdge(prev, outs[i], tx.ID)
+				}
+			}
+		}
+		frontier = next
+	}
+	g.markPartial(frontier, func(tx *transaction.Transaction) bool {
+		prevs, _ := g.funders(tx)
+		return len(prevs) > 0
+	})
+
+	// Descendants: each hop follows the spends of the previous frontier
+	frontier = []*transaction.Transaction{root}
+	for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+		var next []*transaction.Transaction
+		for _, tx := range frontier {
+			spends, outs := g.spenders(tx)
+			for i, spend := range spends {
+				if g.addNode(spend, hop) {
+					next = append(next, spend)
+				}
+				if _, ok := g.nodes[spend.ID]; ok {
+					g.addEdge(tx, outs[i], spend.ID)
+				}
+			}
+		}
+		frontier = next
+	}
+	g.markPartial(frontier, func(tx *transaction.Transaction) bool {
+		spends, _ := g.spenders(tx)
+		return len(spends) > 0
+	})
+
+	return g.graph, nil
+}
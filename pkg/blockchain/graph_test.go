@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+)
+
+// addSpendBlock mines a block holding a coinbase and a spend of txID:outIndex,
+// signed with priv, and returns the spend
+func addSpendBlock(t *testing.T, bc *Blockchain, txID string, outIndex int, priv string, outputs []transaction.TxOutput) *transaction.Transaction {
+	t.Helper()
+	spend := transaction.NewUTXOTransaction([]transaction.TxInput{{TxID: txID, OutIndex: outIndex}}, outputs)
+	sig, err := spend.SignInput(0, priv)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	spend.Inputs[0].ScriptSig = sig
+	spend.ID = spend.CalculateHash()
+	height := bc.GetLatestBlock().Index + 1
+	coinbase := transaction.NewCoinbaseTransaction("miner1", BaseSubsidy, height)
+	b := bc.CreateBlock([]*transaction.Transaction{coinbase, spend}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block %d: %v", height, err)
+	}
+	return spend
+}
+
+func TestTraceTransaction(t *testing.T) {
+	alice, _ := transaction.GenerateKeyPair()
+	bob, _ := transaction.GenerateKeyPair()
+
+	bc := NewBlockchain(1)
+	funding := transaction.NewCoinbaseTransaction(alice.GetPublicKeyHex(), BaseSubsidy, 1)
+	b1 := bc.CreateBlock([]*transaction.Transaction{funding}, "miner1")
+	mineForTest(bc, b1)
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	// funding -> pay (to bob, change to alice) -> onward (bob to carol)
+	pay := addSpendBlock(t, bc, funding.ID, 0, alice.GetPrivateKeyHex(), []transaction.TxOutput{
+		{Value: 1000000, ScriptPubKey: bob.GetPublicKeyHex()},
+		{Value: BaseSubsidy - 1000000, ScriptPubKey: alice.GetPublicKeyHex()},
+	})
+	onward := addSpendBlock(t, bc, pay.ID, 0, bob.GetPrivateKeyHex(), []transaction.TxOutput{
+		{Value: 1000000, ScriptPubKey: "carol"},
+	})
+
+	g, err := bc.TraceTransaction(pay.ID, 1)
+	if err != nil {
+		t.Fatalf("TraceTransaction failed: %v", err)
+	}
+	hops := make(map[string]int)
+	for _, n := range g.Nodes {
+		hops[n.TxID] = n.Hops
+	}
+	if len(g.Nodes) != 3 || hops[funding.ID] != -1 || hops[pay.ID] != 0 || hops[onward.ID] != 1 {
+		t.Fatalf("Expected funding, pay, and onward at hops -1, 0, 1, got %+v", g.Nodes)
+	}
+	if g.Nodes[0].TxID != pay.ID {
+		t.Error("The root should be the first node")
+	}
+	if len(g.Edges) != 2 {
+		t.Fatalf("Expected 2 edges, got %+v", g.Edges)
+	}
+	for _, e := range g.Edges {
+		if e.From == pay.ID && (e.To != onward.ID || e.OutIndex != 0 || e.Value != 1000000 || e.Address != bob.GetPublicKeyHex()) {
+			t.Errorf("Unexpected edge out of pay: %+v", e)
+		}
+		if e.To == pay.ID && e.From != funding.ID {
+			t.Errorf("Unexpected edge into pay: %+v", e)
+		}
+	}
+
+	// From the end of the chain, depth bounds the walk back
+	g, _ = bc.TraceTransaction(onward.ID, 1)
+	if len(g.Nodes) != 2 || !g.Nodes[1].Partial {
+		t.Errorf("Depth 1 should stop at pay and mark it partial, got %+v", g.Nodes)
+	}
+	g, _ = bc.TraceTransaction(onward.ID, 2)
+	if len(g.Nodes) != 3 || g.Nodes[2].TxID != funding.ID || g.Nodes[2].Hops != -2 || g.Nodes[2].Partial {
+		t.Errorf("Depth 2 should reach the coinbase, got %+v", g.Nodes)
+	}
+
+	if _, err := bc.TraceTransaction("missing", 1); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("Expected ErrTxNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"strconv"
+	"strings"
+)
+
+// TxLocation identifies where a transaction was confirmed
+type TxLocation struct {
+	BlockHeight int64
+	BlockHash   string
+	Position    int // Index within the block's transactions
+}
+
+// Spend identifies the confirmed input spending an output
+type Spend struct {
+	TxID  string // Spending transaction
+	Input int    // Index of the spending input
+	TxLocation
+}
+
+// chainIndex maps hashes, transaction IDs, and addresses to chain positions
+type chainIndex struct {
+	heightByHash map[string]int64
+	txLocations  map[string]TxLocation
+	addressTxs   map[string][]string // Transaction IDs touching an address, in chain order
+	spentBy      map[string]Spend    // Spending input by "txid:index" outpoint
+	minerBlocks  map[string][]int64  // Heights of the blocks mined by each miner ID, in chain order
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		heightByHash: make(map[string]int64),
+		txLocations:  make(map[string]TxLocation),
+		addressTxs:   make(map[string][]string),
+		spentBy:      make(map[string]Spend),
+		minerBlocks:  make(map[string][]int64),
+	}
+}
+
+// addBlock indexes a block appended at position height of blocks
+func (ix *chainIndex) addBlock(blocks []*block.Block, height int64) {
+	b := blocks[height]
+	ix.heightByHash[b.Hash] = height
+	ix.minerBlocks[b.MinerID] = append(ix.minerBlocks[b.MinerID], height)
+
+	for pos, tx := range b.Transactions {
+		loc := TxLocation{BlockHeight: height, BlockHash: b.Hash, Position: pos}
+		ix.txLocations[tx.ID] = loc
+
+		touched := make(map[string]bool)
+		if !tx.IsCoinbase() {
+			for i, in := range tx.Inputs {
+				if prev := ix.output(blocks, in.TxID, in.OutIndex); prev != nil {
+					touched[prev.ScriptPubKey] = true
+				}
+				ix.spentBy[outpoint(in.TxID, in.OutIndex)] = Spend{TxID: tx.ID, Input: i, TxLocation: loc}
+			}
+		}
+		for _, out := range tx.Outputs {
+			touched[out.ScriptPubKey] = true
+		}
+		for addr := range touched {
+			ix.addressTxs[addr] = append(ix.addressTxs[addr], tx.ID)
+		}
+	}
+}
+
+// output returns the indexed output txID:outIndex, or nil if unknown
+func (ix *chainIndex) output(blocks []*block.Block, txID string, outIndex int) *transaction.TxOutput {
+	loc, ok := ix.txLocations[txID]
+	if !ok {
+		return nil
+	}
+	tx := blocks[loc.BlockHeight].Transactions[loc.Position]
+	if outIndex < 0 || outIndex >= len(tx.Outputs) {
+		return nil
+	}
+	return &tx.Outputs[outIndex]
+}
+
+// outpoint returns the "txid:index" key of an output
+func outpoint(txID string, outIndex int) string {
+	return txID + ":" + strconv.Itoa(outIndex)
+}
+
+// buildIndex indexes every block of a chain
+func buildIndex(blocks []*block.Block) *chainIndex {
+	ix := newChainIndex()
+	for i := range blocks {
+		ix.addBlock(blocks, int64(i))
+	}
+	return ix
+}
+
+// GetBlockByHeight returns a copy of the block at height, or nil
+func (bc *Blockchain) GetBlockByHeight(height int64) *block.Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 0 || height >= int64(len(bc.Blocks)) {
+		return nil
+	}
+	return bc.Blocks[height].Clone()
+}
+
+// GetBlockByHash returns a copy of the block with the given hash, or nil
+func (bc *Blockchain) GetBlockByHash(hash string) *block.Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	height, ok := bc.index.heightByHash[hash]
+	if !ok {
+		return nil
+	}
+	return bc.Blocks[height].Clone()
+}
+
+// GetTransaction returns a copy of a confirmed transaction and its location, or nil
+func (bc *Blockchain) GetTransaction(txID string) (*transaction.Transaction, *TxLocation) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	loc, ok := bc.index.txLocations[txID]
+	if !ok {
+		return nil, nil
+	}
+	return bc.Blocks[loc.BlockHeight].Clone().Transactions[loc.Position], &loc
+}
+
+// GetOutput returns a confirmed output (spent or not), or nil if unknown
+func (bc *Blockchain) GetOutput(txID string, outIndex int) *transaction.TxOutput {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	out := bc.index.output(bc.Blocks, txID, outIndex)
+	if out == nil {
+		return nil
+	}
+	o := *out
+	return &o
+}
+
+// GetSpendingTx returns the confirmed input spending output outIndex of
+// txID, or nil if the output is unspent or unknown
+func (bc *Blockchain) GetSpendingTx(txID string, outIndex int) *Spend {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	spend, ok := bc.index.spentBy[outpoint(txID, outIndex)]
+	if !ok {
+		return nil
+	}
+	return &spend
+}
+
+// GetAddressTransactions returns the IDs of confirmed transactions paying to
+// or spending from address, oldest first
+func (bc *Blockchain) GetAddressTransactions(address string) []string {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return append([]string(nil), bc.index.addressTxs[address]...)
+}
+
+// SearchKind is the kind of entity a search query matched
+type SearchKind string
+
+const (
+	SearchBlock       SearchKind = "block"
+	SearchTransaction SearchKind = "transaction"
+	SearchAddress     SearchKind = "address"
+)
+
+// SearchResult is the entity a search query matched. Kind is empty when
+// nothing matched; MatchedBy says how the query was interpreted ("height",
+// "hash", "txid", or "address").
+type SearchResult struct {
+	Kind      SearchKind
+	MatchedBy string
+	Block     *block.Block
+	Tx        *transaction.Transaction
+	Location  *TxLocation
+	Address   string
+}
+
+// Search interprets query as a block height, block hash, transaction ID, or
+// address, in that order, and returns the first confirmed match
+func (bc *Blockchain) Search(query string) SearchResult {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return SearchResult{}
+	}
+
+	if height, err := strconv.ParseInt(query, 10, 64); err == nil {
+		if b := bc.GetBlockByHeight(height); b != nil {
+			return SearchResult{Kind: SearchBlock, MatchedBy: "height", Block: b}
+		}
+	}
+	if b := bc.GetBlockByHash(query); b != nil {
+		return SearchResult{Kind: SearchBlock, MatchedBy: "hash", Block: b}
+	}
+	if tx, loc := bc.GetTransaction(query); tx != nil {
+		return SearchResult{Kind: SearchTransaction, MatchedBy: "txid", Tx: tx, Location: loc}
+	}
+	if len(bc.GetAddressTransactions(query)) > 0 {
+		return SearchResult{Kind: SearchAddress, MatchedBy: "address", Address: query}
+	}
+	return SearchResult{}
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"testing"
+)
+
+func TestChainIndexLookups(t *testing.T) {
+	bc := NewBlockchain(2)
+	kp, _ := transaction.GenerateKeyPair()
+	alice := kp.GetPublicKeyHex()
+
+	// Block 1 pays alice, block 2 spends it to bob
+	funding := createValidBlock(bc, alice)
+	if err := bc.AddBlock(funding); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	coinbase := funding.Transactions[0]
+	spend, err := bc.GetUTXOSet().CreateTransaction(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: coinbase.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: "bob"}},
+		map[string]string{alice: kp.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	b := bc.CreateBlock([]*transaction.Transaction{
+		transaction.NewCoinbaseTransaction("miner1", BaseSubsidy, 2), spend,
+	}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add spending block: %v", err)
+	}
+
+	if got := bc.GetBlockByHash(b.Hash); got == nil || got.Index != 2 {
+		t.Error("Block should be found by hash")
+	}
+	if bc.GetBlockByHeight(5) != nil {
+		t.Error("Height beyond the tip should return nil")
+	}
+
+	tx, loc := bc.GetTransaction(spend.ID)
+	if tx == nil || loc.BlockHeight != 2 || loc.Position != 1 || loc.BlockHash != b.Hash {
+		t.Errorf("Unexpected transaction location: %+v", loc)
+	}
+
+	history := bc.GetAddressTransactions(alice)
+	if len(history) != 2 || history[0] != coinbase.ID || history[1] != spend.ID {
+		t.Errorf("Alice should have received and spent, got %v", history)
+	}
+	if len(bc.GetAddressTransactions("bob")) != 1 {
+		t.Error("Bob's payment should be indexed")
+	}
+
+	spender := bc.GetSpendingTx(coinbase.ID, 0)
+	if spender == nil || spender.TxID != spend.ID || spender.Input != 0 || spender.BlockHeight != 2 || spender.BlockHash != b.Hash {
+		t.Errorf("Coinbase output should be spent by the spend in block 2, got %+v", spender)
+	}
+	if bc.GetSpendingTx(spend.ID, 0) != nil || bc.GetSpendingTx(coinbase.ID, 1) != nil {
+		t.Error("Unspent and unknown outputs should have no spender")
+	}
+
+	// Replacing the chain rebuilds the index
+	other := NewBlockchain(2)
+	other.AddBlock(createValidBlock(other, "carol"))
+	other.AddBlock(createValidBlock(other, "carol"))
+	other.AddBlock(createValidBlock(other, "carol"))
+	if err := bc.ReplaceChain(other.GetBlocks()); err != nil {
+		t.Fatalf("Failed to replace chain: %v", err)
+	}
+	if tx, _ := bc.GetTransaction(spend.ID); tx != nil || bc.GetSpendingTx(coinbase.ID, 0) != nil {
+		t.Error("Transactions of the replaced chain should no longer be indexed")
+	}
+	if len(bc.GetAddressTransactions("carol")) != 3 {
+		t.Error("The new chain should be indexed")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	bc := NewBlockchain(2)
+	b := createValidBlock(bc, "alice")
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	if r := bc.Search("1"); r.Kind != SearchBlock || r.MatchedBy != "height" || r.Block.Hash != b.Hash {
+		t.Errorf("Height should match block #1, got %+v", r)
+	}
+	if r := bc.Search(b.Hash); r.Kind != SearchBlock || r.MatchedBy != "hash" {
+		t.Errorf("Hash should match the block, got %+v", r)
+	}
+	if r := bc.Search(b.Transactions[0].ID); r.Kind != SearchTransaction || r.Location.BlockHeight != 1 {
+		t.Errorf("Transaction ID should match the coinbase, got %+v", r)
+	}
+	if r := bc.Search("alice"); r.Kind != SearchAddress || r.Address != "alice" {
+		t.Errorf("Address should match, got %+v", r)
+	}
+	for _, q := range []string{"", "7", "unknown"} {
+		if r := bc.Search(q); r.Kind != "" {
+			t.Errorf("Search(%q) should match nothing, got %+v", q, r)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"sort"
+	"time"
+)
+
+// MinedBlock summarizes a block for per-miner queries
+type MinedBlock struct {
+	Height    int64
+	Hash      string
+	Timestamp int64 // Unix nanoseconds
+	TxCount   int
+	Reward    int64 // Coinbase value: subsidy plus fees
+}
+
+// MinerStats is a miner's standing over a range of heights
+type MinerStats struct {
+	MinerID     string
+	Blocks      int
+	Rewards     int64 // Total coinbase value
+	Fees        int64 // Part of Rewards collected as fees
+	FirstHeight int64
+	LastHeight  int64
+	// Mean seconds between the miner's consecutive blocks; 0 with fewer than two
+	AvgInterval float64
+}
+
+// heightRange clamps an inclusive height range to the mined blocks. from
+// defaults to 1, skipping genesis, and a negative to means the tip.
+func (bc *Blockchain) heightRange(from, to int64) (int64, int64) {
+	if from < 1 {
+		from = 1
+	}
+	if tip := int64(len(bc.Blocks)) - 1; to < 0 || to > tip {
+		to = tip
+	}
+	return from, to
+}
+
+// coinbaseValue returns the total coinbase output of a block
+func coinbaseValue(b *block.Block) int64 {
+	var value int64
+	for _, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			value += tx.TotalOutputValue()
+		}
+	}
+	return value
+}
+
+// BlocksByMiner returns the blocks mined by minerID between heights from and
+// to inclusive, oldest first
+func (bc *Blockchain) BlocksByMiner(minerID string, from, to int64) []MinedBlock {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	from, to = bc.heightRange(from, to)
+
+	var blocks []MinedBlock
+	for _, height := range bc.index.minerBlocks[minerID] {
+		if height < from {
+			continue
+		}
+		if height > to {
+			break
+		}
+		b := bc.Blocks[height]
+		blocks = append(blocks, MinedBlock{
+			Height:    height,
+			Hash:      b.Hash,
+			Timestamp: b.Timestamp,
+			TxCount:   len(b.Transactions),
+			Reward:    coinbaseValue(b),
+		})
+	}
+	return blocks
+}
+
+// Leaderboard ranks the miners of the blocks between heights from and to
+// inclusive by blocks mined, then by rewards earned
+func (bc *Blockchain) Leaderboard(from, to int64) []MinerStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	from, to = bc.heightRange(from, to)
+
+	byMiner := make(map[string]*MinerStats)
+	for height := from; height <= to; height++ {
+		b := bc.Blocks[height]
+		stats, ok := byMiner[b.MinerID]
+		if !ok {
+			stats = &MinerStats{MinerID: b.MinerID, FirstHeight: height}
+			byMiner[b.MinerID] = stats
+		}
+		reward := coinbaseValue(b)
+		stats.Blocks++
+		stats.Rewards += reward
+		stats.Fees += reward - bc.claimedSubsidy(b.Transactions)
+		stats.LastHeight = height
+	}
+
+	board := make([]MinerStats, 0, len(byMiner))
+	for _, stats := range byMiner {
+		if stats.Blocks > 1 {
+			// The gaps between consecutive blocks add up to first-to-last
+			span := bc.Blocks[stats.LastHeight].Timestamp - bc.Blocks[stats.FirstHeight].Timestamp
+			stats.AvgInterval = time.Duration(span).Seconds() / float64(stats.Blocks-1)
+		}
+		board = append(board, *stats)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Blocks != board[j].Blocks {
+			return board[i].Blocks > board[j].Blocks
+		}
+		if board[i].Rewards != board[j].Rewards {
+			return board[i].Rewards > board[j].Rewards
+		}
+		return board[i].MinerID < board[j].MinerID
+	})
+	return board
+}
@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlocksByMinerAndLeaderboard(t *testing.T) {
+	bc := NewBlockchain(1)
+	for _, miner := range []string{"alice", "bob", "alice", "carol", "alice"} {
+		if err := bc.AddBlock(createValidBlock(bc, miner)); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	blocks := bc.BlocksByMiner("alice", 0, -1)
+	if len(blocks) != 3 || blocks[0].Height != 1 || blocks[1].Height != 3 || blocks[2].Height != 5 {
+		t.Fatalf("Expected alice's blocks at 1, 3, 5, got %+v", blocks)
+	}
+	if blocks[1].Hash != bc.GetBlockByHeight(3).Hash || blocks[1].Reward != BaseSubsidy || blocks[1].TxCount != 1 {
+		t.Errorf("Unexpected block summary: %+v", blocks[1])
+	}
+	if blocks := bc.BlocksByMiner("alice", 2, 4); len(blocks) != 1 || blocks[0].Height != 3 {
+		t.Errorf("Range 2-4 should hold only block 3, got %+v", blocks)
+	}
+	if len(bc.BlocksByMiner("genesis", 0, -1)) != 0 {
+		t.Error("Genesis should be excluded")
+	}
+
+	board := bc.Leaderboard(0, -1)
+	if len(board) != 3 || board[0].MinerID != "alice" || board[1].MinerID != "bob" || board[2].MinerID != "carol" {
+		t.Fatalf("Expected alice, then bob and carol by name, got %+v", board)
+	}
+	alice := board[0]
+	if alice.Blocks != 3 || alice.Rewards != 3*BaseSubsidy || alice.Fees != 0 || alice.FirstHeight != 1 || alice.LastHeight != 5 {
+		t.Errorf("Unexpected stats for alice: %+v", alice)
+	}
+	span := time.Duration(bc.GetBlockByHeight(5).Timestamp - bc.GetBlockByHeight(1).Timestamp)
+	if alice.AvgInterval != span.Seconds()/2 {
+		t.Errorf("Expected an average interval of %v, got %v", span.Seconds()/2, alice.AvgInterval)
+	}
+	if board[1].AvgInterval != 0 {
+		t.Error("A single block has no interval")
+	}
+
+	if board := bc.Leaderboard(4, 10); len(board) != 2 || board[0].MinerID != "alice" || board[0].Blocks != 1 {
+		t.Errorf("Range 4 to the tip should hold carol and alice, got %+v", board)
+	}
+}
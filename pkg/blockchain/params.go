@@ -0,0 +1,271 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/pow/hashfn"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrRuleViolation = errors.New("consensus rule violation")
+
+// Rule names a consensus rule that can be activated at a block height
+type Rule string
+
+const (
+	// RuleDustLimit rejects non-coinbase outputs below ChainParams.DustLimit
+	RuleDustLimit Rule = "dust-limit"
+
+	// RuleCoinbaseHeight requires the coinbase scriptSig to encode the block height
+	RuleCoinbaseHeight Rule = "coinbase-height"
+
+	// RuleStrictMerkleRoot requires the header Merkle root to match the transactions.
+	// Block validation now always checks this; the rule remains so params files
+	// naming it still load.
+	RuleStrictMerkleRoot Rule = "strict-merkle-root"
+
+	// RuleMerkleHash switches block hashing to commit to the Merkle root. When it
+	// has no activation height, the chain's UseMerkleTree option applies at every height.
+	RuleMerkleHash Rule = "merkle-hash"
+
+	// RuleInputSigHash requires every input signature to commit to its input
+	// (transaction.SigHashV1). Before activation legacy signatures, valid for
+	// any input of the same key, are still accepted alongside versioned ones.
+	RuleInputSigHash Rule = "input-sighash"
+
+	// RuleSpentValueSigHash requires every input signature to also commit to
+	// the value and scriptPubKey of the output it spends (transaction.SigHashV3),
+	// so an offline signer cannot be misled about the fee it pays.
+	RuleSpentValueSigHash Rule = "spent-value-sighash"
+
+	// RuleCoinbaseMaturity keeps coinbase outputs unspendable until
+	// ChainParams.CoinbaseMaturity blocks have followed the one that created
+	// them, so a reorganization cannot strand spends of a vanished reward.
+	RuleCoinbaseMaturity Rule = "coinbase-maturity"
+)
+
+// ChainParams holds consensus parameters, including the heights at which
+// versioned rules activate. Rules absent from Activations are never active.
+type ChainParams struct {
+	Activations      map[Rule]int64    `json:"activations"`
+	DustLimit        int64             `json:"dust_limit"`                  // Minimum output value once RuleDustLimit is active
+	CoinbaseMaturity int64             `json:"coinbase_maturity,omitempty"` // Blocks a coinbase output waits once RuleCoinbaseMaturity is active
+	HalvingInterval  int64             `json:"halving_interval,omitempty"`  // Blocks between halvings of the subsidy (0 = never)
+	MaxBlockTxs      int               `json:"max_block_txs,omitempty"`     // Most transactions a block may carry besides its coinbase (0 = unlimited)
+	MaxBlockBytes    int64             `json:"max_block_bytes,omitempty"`   // Most serialized transaction bytes a block may carry (0 = unlimited)
+	PowAlgorithm     string            `json:"pow_algorithm,omitempty"`     // Proof-of-work hash function of blocks after genesis, by hashfn name ("" = sha256)
+	DifficultyFloors []DifficultyFloor `json:"difficulty_floors"`           // Minimum PoW difficulty by height, in height order
+	Changes          []ParamChange     `json:"changes"`                     // Scheduled parameter changes, in height order
+	Checkpoints      map[int64]string  `json:"checkpoints,omitempty"`       // Block hash every accepted chain must hold, by height
+}
+
+// ParamChange schedules new consensus parameters from Height onward, such as
+// a difficulty bomb or a subsidy cut. Fields left unset keep their previous
+// value; a set field holds until a later change sets it again.
+type ParamChange struct {
+	Height           int64   `json:"height"`
+	Name             string  `json:"name,omitempty"`              // Label nodes report, so upgraded nodes can be told apart
+	DifficultyOffset *int    `json:"difficulty_offset,omitempty"` // Added to the difficulty consensus requires
+	Subsidy          *int64  `json:"subsidy,omitempty"`           // Block subsidy in satoshi
+	PowAlgorithm     *string `json:"pow_algorithm,omitempty"`     // Proof-of-work hash function, by hashfn name
+}
+
+// DifficultyFloor is the minimum difficulty a block must claim from Height onward
+type DifficultyFloor struct {
+	Height     int64 `json:"height"`
+	Difficulty int   `json:"difficulty"`
+}
+
+// DefaultChainParams returns params with no versioned rules activated and
+// the default block size limit
+func DefaultChainParams() *ChainParams {
+	return &ChainParams{
+		Activations:   make(map[Rule]int64),
+		MaxBlockBytes: DefaultMaxBlockBytes,
+	}
+}
+
+// LoadChainParams reads chain params from a JSON file
+func LoadChainParams(path string) (*ChainParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain params: %v", err)
+	}
+	params := DefaultChainParams()
+	if err := json.Unmarshal(data, params); err != nil {
+		return nil, fmt.Errorf("failed to parse chain params: %v", err)
+	}
+	if params.Activations == nil {
+		params.Activations = make(map[Rule]int64)
+	}
+	for i := 1; i < len(params.DifficultyFloors); i++ {
+		if params.DifficultyFloors[i].Height <= params.DifficultyFloors[i-1].Height {
+			return nil, fmt.Errorf("difficulty floors must be in increasing height order")
+		}
+	}
+	for i, change := range params.Changes {
+		if change.Height < 1 {
+			return nil, fmt.Errorf("parameter change %d: height must be at least 1", i)
+		}
+		if i > 0 && change.Height <= params.Changes[i-1].Height {
+			return nil, fmt.Errorf("parameter changes must be in increasing height order")
+		}
+		if change.Subsidy != nil && *change.Subsidy < 0 {
+			return nil, fmt.Errorf("parameter change %d: subsidy must not be negative", i)
+		}
+		if change.PowAlgorithm != nil {
+			if _, err := hashfn.New(*change.PowAlgorithm); err != nil {
+				return nil, fmt.Errorf("parameter change %d: %w", i, err)
+			}
+		}
+	}
+	if _, err := hashfn.New(params.PowAlgorithm); err != nil {
+		return nil, err
+	}
+	if params.CoinbaseMaturity < 0 {
+		return nil, fmt.Errorf("coinbase maturity must not be negative")
+	}
+	if params.HalvingInterval < 0 {
+		return nil, fmt.Errorf("halving interval must not be negative")
+	}
+	if params.MaxBlockTxs < 0 || params.MaxBlockBytes < 0 {
+		return nil, fmt.Errorf("block size limits must not be negative")
+	}
+	for height, hash := range params.Checkpoints {
+		if height < 0 || hash == "" {
+			return nil, fmt.Errorf("checkpoint at height %d must name a block hash at a height of at least 0", height)
+		}
+	}
+	return params, nil
+}
+
+// Fingerprint returns a short hash of the params. Nodes loaded with the same
+// params file share a fingerprint, so one that missed an upgrade stands out.
+func (p *ChainParams) Fingerprint() string {
+	data, _ := json.Marshal(p) // Map keys are sorted, so the encoding is stable
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// DifficultyOffsetAt returns the difficulty added by scheduled changes at height
+func (p *ChainParams) DifficultyOffsetAt(height int64) int {
+	if p == nil {
+		return 0
+	}
+	offset := 0
+	for _, c := range p.Changes {
+		if c.Height > height {
+			break
+		}
+		if c.DifficultyOffset != nil {
+			offset = *c.DifficultyOffset
+		}
+	}
+	return offset
+}
+
+// PowAlgorithmAt returns the proof-of-work hash function a block at height
+// must name, as block headers name it. The genesis block always uses SHA-256.
+func (p *ChainParams) PowAlgorithmAt(height int64) string {
+	if p == nil || height < 1 {
+		return ""
+	}
+	name := p.PowAlgorithm
+	for _, c := range p.Changes {
+		if c.Height > height {
+			break
+		}
+		if c.PowAlgorithm != nil {
+			name = *c.PowAlgorithm
+		}
+	}
+	return hashfn.Canonical(name)
+}
+
+// CoinbaseMaturityAt returns how many blocks a coinbase output must wait
+// before a block at height may spend it
+func (p *ChainParams) CoinbaseMaturityAt(height int64) int64 {
+	if !p.IsActive(RuleCoinbaseMaturity, height) {
+		return 0
+	}
+	return p.CoinbaseMaturity
+}
+
+// IsActive reports whether a rule applies to a block at the given height
+func (p *ChainParams) IsActive(rule Rule, height int64) bool {
+	if p == nil {
+		return false
+	}
+	activation, ok := p.Activations[rule]
+	return ok && height >= activation
+}
+
+// MinDifficultyAt returns the difficulty floor in force at height (0 if none)
+func (p *ChainParams) MinDifficultyAt(height int64) int {
+	if p == nil {
+		return 0
+	}
+	floor := 0
+	for _, f := range p.DifficultyFloors {
+		if f.Height > height {
+			break
+		}
+		floor = f.Difficulty
+	}
+	return floor
+}
+
+// CheckpointAt returns the block hash checkpointed at height, if any
+func (p *ChainParams) CheckpointAt(height int64) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	hash, ok := p.Checkpoints[height]
+	return hash, ok
+}
+
+// LastCheckpoint returns the height of the highest checkpoint at or below
+// height, -1 if none
+func (p *ChainParams) LastCheckpoint(height int64) int64 {
+	last := int64(-1)
+	if p != nil {
+		for h := range p.Checkpoints {
+			if h <= height {
+				last = max(last, h)
+			}
+		}
+	}
+	return last
+}
+
+// checkCheckpoints checks that a chain holds the checkpointed block at every
+// checkpoint height it reaches, reporting the lowest one it contradicts
+func (p *ChainParams) checkCheckpoints(blocks []*block.Block) error {
+	var err error
+	bad := int64(len(blocks))
+	if p != nil {
+		for height, hash := range p.Checkpoints {
+			if height < bad && blocks[height].Hash != hash {
+				bad = height
+				err = fmt.Errorf("%w: block #%d is %s, checkpoint requires %s", ErrCheckpointMismatch, height, blocks[height].Hash, hash)
+			}
+		}
+	}
+	return err
+}
+
+// WithParams sets the consensus params (including rule activations) of the chain
+func WithParams(params *ChainParams) Option {
+	return func(o *Options) {
+		o.Params = params
+	}
+}
+
+// Params returns the chain's consensus params
+func (bc *Blockchain) Params() *ChainParams {
+	return bc.options.Params
+}
@@ -0,0 +1,342 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/pow/hashfn"
+	"blockchain/pkg/transaction"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRuleActivationHeight(t *testing.T) {
+	params := DefaultChainParams()
+	params.Activations[RuleDustLimit] = 10
+
+	if params.IsActive(RuleDustLimit, 9) {
+		t.Error("Rule should not be active before its activation height")
+	}
+	if !params.IsActive(RuleDustLimit, 10) {
+		t.Error("Rule should be active at its activation height")
+	}
+	if params.IsActive(RuleCoinbaseHeight, 100) {
+		t.Error("Rule without an activation height should never be active")
+	}
+}
+
+func TestCoinbaseHeightRuleActivatesMidChain(t *testing.T) {
+	params := DefaultChainParams()
+	params.Activations[RuleCoinbaseHeight] = 2
+	bc := NewBlockchain(2, WithParams(params))
+
+	// Before activation a mislabeled coinbase is still accepted
+	coinbase := transaction.NewCoinbaseTransaction("miner1", 5000000000, 99)
+	b := bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Block before activation should be accepted: %v", err)
+	}
+
+	// From the activation height the coinbase must encode the block height
+	coinbase = transaction.NewCoinbaseTransaction("miner1", 5000000000, 99)
+	b = bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrRuleViolation) {
+		t.Fatalf("Expected rule violation after activation, got %v", err)
+	}
+
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Block following the new rule should be accepted: %v", err)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Chain spanning the activation should validate: %v", err)
+	}
+}
+
+func TestDustLimitRule(t *testing.T) {
+	params := DefaultChainParams()
+	params.Activations[RuleDustLimit] = 5
+	params.DustLimit = 1000
+
+	tx := &transaction.Transaction{
+		Inputs:  []transaction.TxInput{{TxID: "abc", OutIndex: 0}},
+		Outputs: []transaction.TxOutput{{Value: 500, ScriptPubKey: "addr"}},
+	}
+	if err := (&ValidationContext{Height: 4, Params: params}).checkTransactionRules(tx); err != nil {
+		t.Errorf("Dust output should be allowed before activation: %v", err)
+	}
+	if err := (&ValidationContext{Height: 5, Params: params}).checkTransactionRules(tx); !errors.Is(err, ErrRuleViolation) {
+		t.Errorf("Expected dust rule violation, got %v", err)
+	}
+}
+
+func TestLoadChainParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "params.json")
+	data := `{"activations": {"dust-limit": 2000, "coinbase-height": 1000}, "dust_limit": 546, "checkpoints": {"1500": "00ab"}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := LoadChainParams(path)
+	if err != nil {
+		t.Fatalf("Failed to load params: %v", err)
+	}
+	if params.DustLimit != 546 || !params.IsActive(RuleDustLimit, 2000) || params.IsActive(RuleCoinbaseHeight, 999) {
+		t.Errorf("Loaded params don't match file: %+v", params)
+	}
+	if hash, ok := params.CheckpointAt(1500); !ok || hash != "00ab" || params.LastCheckpoint(1499) != -1 {
+		t.Errorf("Loaded checkpoints don't match file: %v", params.Checkpoints)
+	}
+}
+
+func TestCheckpointsRefuseHistoryRewrites(t *testing.T) {
+	params := DefaultChainParams()
+	bc := NewBlockchain(1, WithParams(params))
+	genesis := bc.GetLatestBlock()
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "honest")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	params.Checkpoints = map[int64]string{2: bc.GetBlocks()[2].Hash}
+
+	// A longer chain from genesis is refused, however much work it holds
+	rival := []*block.Block{genesis}
+	for i := 0; i < 5; i++ {
+		rival = append(rival, mineOn(bc, rival[i], "rival", BaseSubsidy))
+	}
+	if err := bc.ReplaceChain(rival); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("Expected a checkpoint mismatch, got %v", err)
+	}
+	if bc.GetLength() != 4 || bc.GetLatestBlock().MinerID != "honest" {
+		t.Fatal("The chain should be unchanged")
+	}
+	if _, _, err := bc.ProcessBlock(rival[1]); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("Expected a side block below the checkpoint to be refused, got %v", err)
+	}
+
+	// Forks above the checkpoint are still followed
+	fork := bc.GetBlocks()[:3]
+	for i := 0; i < 3; i++ {
+		fork = append(fork, mineOn(bc, fork[len(fork)-1], "rival", BaseSubsidy))
+	}
+	if err := bc.ReplaceChain(fork); err != nil {
+		t.Fatalf("A chain holding the checkpoint should be accepted: %v", err)
+	}
+
+	// A block at a checkpoint height must be the checkpointed one
+	other := NewBlockchain(1, WithParams(&ChainParams{Checkpoints: map[int64]string{1: rival[1].Hash}}))
+	if err := other.AddBlock(createValidBlock(other, "honest")); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("Expected a block contradicting the checkpoint to be refused, got %v", err)
+	}
+}
+
+// mineForTest finds a nonce satisfying the chain difficulty
+func mineForTest(bc *Blockchain, b *block.Block) {
+	for nonce := int64(0); ; nonce++ {
+		b.Nonce = nonce
+		hash := b.CalculateHash()
+		if pow.ValidateHash(hash, bc.Difficulty) {
+			b.Hash = hash
+			return
+		}
+	}
+}
+
+func TestInputSigHashRule(t *testing.T) {
+	params := DefaultChainParams()
+	params.Activations[RuleInputSigHash] = 5
+
+	kp, _ := transaction.GenerateKeyPair()
+	tx := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: "abc", OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 500, ScriptPubKey: "addr"}},
+	)
+	tx.Inputs[0].ScriptSig, _ = transaction.SignECDSA(tx.GetDataToSign(), kp.GetPrivateKeyHex())
+
+	if err := (&ValidationContext{Height: 4, Params: params}).checkTransactionRules(tx); err != nil {
+		t.Errorf("Legacy signatures should be allowed before activation: %v", err)
+	}
+	if err := (&ValidationContext{Height: 5, Params: params}).checkTransactionRules(tx); !errors.Is(err, ErrRuleViolation) {
+		t.Errorf("Expected input-sighash violation, got %v", err)
+	}
+
+	tx.Inputs[0].ScriptSig, _ = tx.SignInput(0, kp.GetPrivateKeyHex())
+	if err := (&ValidationContext{Height: 5, Params: params}).checkTransactionRules(tx); err != nil {
+		t.Errorf("Versioned signatures should be allowed after activation: %v", err)
+	}
+}
+
+func TestSpentValueSigHashRule(t *testing.T) {
+	params := DefaultChainParams()
+	params.Activations[RuleSpentValueSigHash] = 5
+
+	kp, _ := transaction.GenerateKeyPair()
+	tx := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: "abc", OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 500, ScriptPubKey: "addr"}},
+	)
+	tx.Inputs[0].ScriptSig, _ = tx.SignInput(0, kp.GetPrivateKeyHex())
+
+	if err := (&ValidationContext{Height: 4, Params: params}).checkTransactionRules(tx); err != nil {
+		t.Errorf("v1 signatures should be allowed before activation: %v", err)
+	}
+	if err := (&ValidationContext{Height: 5, Params: params}).checkTransactionRules(tx); !errors.Is(err, ErrRuleViolation) {
+		t.Errorf("Expected spent-value-sighash violation, got %v", err)
+	}
+
+	spent := transaction.TxOutput{Value: 600, ScriptPubKey: kp.GetPublicKeyHex()}
+	tx.Inputs[0].ScriptSig, _ = tx.SignInputSpending(0, kp.GetPrivateKeyHex(), transaction.SigHashAll, spent)
+	if err := (&ValidationContext{Height: 5, Params: params}).checkTransactionRules(tx); err != nil {
+		t.Errorf("v3 signatures should be allowed after activation: %v", err)
+	}
+}
+
+func TestScheduledParamChanges(t *testing.T) {
+	one, half, zero := 1, BaseSubsidy/2, int64(0)
+	params := DefaultChainParams()
+	params.Changes = []ParamChange{
+		{Height: 3, Name: "drill", DifficultyOffset: &one, Subsidy: &half},
+		{Height: 5, Subsidy: &zero},
+	}
+
+	if params.SubsidyAt(2) != BaseSubsidy || params.SubsidyAt(3) != half || params.SubsidyAt(6) != 0 {
+		t.Errorf("Subsidy should follow the scheduled changes")
+	}
+	eras := params.EmissionSchedule()
+	if len(eras) != 3 || eras[0].EndHeight != 2 || eras[1].Total != 2*half || eras[2].StartHeight != 5 || eras[2].Total != 0 {
+		t.Errorf("Unexpected emission eras: %+v", eras)
+	}
+	if params.MaxSupply() != 2*BaseSubsidy+2*half {
+		t.Errorf("A schedule ending in zero subsidy should be bounded, got %d", params.MaxSupply())
+	}
+	if params.Fingerprint() == DefaultChainParams().Fingerprint() || params.Fingerprint() != params.Fingerprint() {
+		t.Error("Fingerprints should tell params apart and be stable")
+	}
+
+	bc := NewBlockchain(1, WithParams(params))
+	for i := 0; i < 2; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	if bc.RequiredDifficulty(2) != 1 || bc.RequiredDifficulty(3) != 2 {
+		t.Fatalf("The offset should apply from height 3, got %d", bc.RequiredDifficulty(3))
+	}
+
+	// nextBlock mines block 3 claiming the given difficulty and subsidy
+	nextBlock := func(difficulty int, subsidy int64) *block.Block {
+		coinbase := transaction.NewCoinbaseTransaction("miner1", subsidy, 3)
+		b := bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+		b.Difficulty = difficulty
+		pow.NewProofOfWork(b).Mine(context.TODO(), nil)
+		return b
+	}
+	if err := bc.AddBlock(nextBlock(1, half)); !errors.Is(err, ErrInsufficientDifficulty) {
+		t.Errorf("Expected the old difficulty to be rejected, got %v", err)
+	}
+	if err := bc.AddBlock(nextBlock(2, BaseSubsidy)); !errors.Is(err, ErrExcessCoinbase) {
+		t.Errorf("Expected the old subsidy to be rejected, got %v", err)
+	}
+	if err := bc.AddBlock(nextBlock(2, half)); err != nil {
+		t.Fatalf("Block following the new params should be accepted: %v", err)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Chain spanning the change should validate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "params.json")
+	os.WriteFile(path, []byte(`{"changes": [{"height": 10, "subsidy": 1}, {"height": 5, "subsidy": 0}]}`), 0644)
+	if _, err := LoadChainParams(path); err == nil {
+		t.Error("Changes out of height order should be refused")
+	}
+}
+
+func TestPowAlgorithmSchedule(t *testing.T) {
+	scrypt := hashfn.ScryptLite
+	params := DefaultChainParams()
+	params.PowAlgorithm = hashfn.SHA256d
+	params.Changes = []ParamChange{{Height: 3, PowAlgorithm: &scrypt}}
+	if params.PowAlgorithmAt(0) != "" || params.PowAlgorithmAt(2) != hashfn.SHA256d || params.PowAlgorithmAt(3) != scrypt {
+		t.Fatal("The hash function should follow the params from height 1")
+	}
+
+	bc := NewBlockchain(1, WithParams(params))
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	if bc.Blocks[0].PowAlgorithm != "" || bc.Blocks[1].PowAlgorithm != hashfn.SHA256d || bc.Blocks[3].PowAlgorithm != scrypt {
+		t.Error("Created blocks should name the function of their height")
+	}
+
+	// A block hashed with an earlier function is refused, whatever its work
+	b := bc.CreateBlock([]*transaction.Transaction{transaction.NewCoinbaseTransaction("miner1", BaseSubsidy, 4)}, "miner1")
+	b.PowAlgorithm = hashfn.SHA256d
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrInvalidPoW) {
+		t.Errorf("Expected a block of the wrong function to be refused, got %v", err)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Chain spanning the change should validate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "params.json")
+	os.WriteFile(path, []byte(`{"changes": [{"height": 5, "pow_algorithm": "md5"}]}`), 0644)
+	if _, err := LoadChainParams(path); !errors.Is(err, hashfn.ErrUnknown) {
+		t.Errorf("An unknown hash function should be refused, got %v", err)
+	}
+}
+
+func TestCoinbaseMaturityRule(t *testing.T) {
+	params := DefaultChainParams()
+	params.Activations[RuleCoinbaseMaturity] = 1
+	params.CoinbaseMaturity = 2
+	alice, _ := transaction.GenerateKeyPair()
+
+	bc := NewBlockchain(1, WithParams(params))
+	funding := transaction.NewCoinbaseTransaction(alice.GetPublicKeyHex(), BaseSubsidy, 1)
+	b1 := bc.CreateBlock([]*transaction.Transaction{funding}, "miner1")
+	mineForTest(bc, b1)
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	spend := transaction.NewUTXOTransaction([]transaction.TxInput{{TxID: funding.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: BaseSubsidy - 1000, ScriptPubKey: "bob"}})
+	spend.Inputs[0].ScriptSig, _ = spend.SignInput(0, alice.GetPrivateKeyHex())
+	spend.ID = spend.CalculateHash()
+	spendAt := func(height int64) *block.Block {
+		coinbase := transaction.NewCoinbaseTransaction("miner1", BaseSubsidy, height)
+		b := bc.CreateBlock([]*transaction.Transaction{coinbase, spend}, "miner1")
+		mineForTest(bc, b)
+		return b
+	}
+
+	// The reward mined at height 1 may first be spent at height 3
+	if err := bc.ValidateTransaction(spend); err == nil {
+		t.Error("The mempool should refuse an immature coinbase spend")
+	}
+	if err := bc.AddBlock(spendAt(2)); err == nil {
+		t.Fatal("A block spending an immature coinbase should be refused")
+	}
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	if err := bc.ValidateTransaction(spend); err != nil {
+		t.Errorf("The mempool should accept a matured coinbase spend: %v", err)
+	}
+	if err := bc.AddBlock(spendAt(3)); err != nil {
+		t.Fatalf("A matured coinbase should be spendable: %v", err)
+	}
+
+	// Rebuilt from its blocks, the chain still validates under the rule
+	rebuilt := NewBlockchainFromBlocks(bc.GetBlocks(), bc.Difficulty, WithParams(params))
+	if err := rebuilt.ValidateChain(); err != nil {
+		t.Errorf("Rebuilt chain should validate: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"runtime"
+	"sync"
+)
+
+// MinParallelBlocks is the fewest blocks ReplaceChain and ValidateChain check
+// on parallel workers; shorter runs are not worth starting them for
+const MinParallelBlocks = 8
+
+// prevalidated is what checking a run of blocks in parallel established
+// before they are validated in order
+type prevalidated struct {
+	blocks map[*block.Block]bool // Passed the checks that need no chain state
+	sigs   *transaction.SigCache // Inputs whose signatures hold
+}
+
+// passed reports whether b passed the checks that need no chain state
+func (p *prevalidated) passed(b *block.Block) bool {
+	return p != nil && p.blocks[b]
+}
+
+// signatures returns the inputs verified ahead of time (nil if none)
+func (p *prevalidated) signatures() *transaction.SigCache {
+	if p == nil {
+		return nil
+	}
+	return p.sigs
+}
+
+// prevalidate checks the hashes, Merkle roots, seals and transaction
+// form of blocks, which follow the ledger base and are configured for the
+// chain, on parallel workers, and batch-verifies the signatures of inputs
+// spending outputs in base or created in blocks. Nothing is rejected here:
+// checkBlock repeats whatever did not pass, so an invalid chain fails at the
+// same block with the same error as in a serial pass. Returns nil for runs
+// shorter than MinParallelBlocks.
+func (bc *Blockchain) prevalidate(blocks []*block.Block, base *transaction.UTXOSet) *prevalidated {
+	if len(blocks) < MinParallelBlocks {
+		return nil
+	}
+
+	engine := bc.Engine()
+	passed := make([]bool, len(blocks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(blocks)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				b := blocks[i]
+				passed[i] = b.HasValidHash() &&
+					(!b.UsesMerkleTree() || b.HasValidMerkleRoot()) &&
+					engine.ValidateHeader(b) == nil &&
+					b.ValidateTransactions()
+			}
+		}()
+	}
+	for i := range blocks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := &prevalidated{
+		blocks: make(map[*block.Block]bool),
+		sigs:   transaction.VerifySpends(blockSpends(blocks, base)),
+	}
+	for i, b := range blocks {
+		if passed[i] {
+			result.blocks[b] = true
+		}
+	}
+	return result
+}
+
+// blockSpends lists the inputs of blocks' transactions with the outputs they
+// spend, found among those created in blocks or else in base. Inputs spending
+// neither are left out. A lookup that picks the wrong output, such as one of
+// a duplicated transaction, only costs a second verification, as the cached
+// signature then does not match what the input turns out to spend.
+func blockSpends(blocks []*block.Block, base *transaction.UTXOSet) []transaction.InputSpend {
+	created := make(map[string]*transaction.Transaction)
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if _, ok := created[tx.ID]; !ok {
+				created[tx.ID] = tx
+			}
+		}
+	}
+	var spends []transaction.InputSpend
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for i, in := range tx.Inputs {
+				if prev := created[in.TxID]; prev != nil && in.OutIndex >= 0 && in.OutIndex < len(prev.Outputs) {
+					spends = append(spends, transaction.InputSpend{Tx: tx, Input: i, Spent: prev.Outputs[in.OutIndex]})
+				} else if utxo := base.FindUTXO(in.TxID, in.OutIndex); utxo != nil {
+					spends = append(spends, transaction.InputSpend{Tx: tx, Input: i, Spent: utxo.Output()})
+				}
+			}
+		}
+	}
+	return spends
+}
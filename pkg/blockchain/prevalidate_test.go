@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+)
+
+// spendChain builds a chain whose blocks after the first each spend the
+// previous block's change, so every block carries a signature to check
+func spendChain(t *testing.T, n int) *Blockchain {
+	t.Helper()
+	alice, _ := transaction.GenerateKeyPair()
+	bc := NewBlockchain(1)
+	funding := transaction.NewCoinbaseTransaction(alice.GetPublicKeyHex(), BaseSubsidy, 1)
+	b1 := bc.CreateBlock([]*transaction.Transaction{funding}, "miner1")
+	mineForTest(bc, b1)
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	prev, value := funding.ID, BaseSubsidy
+	for i := 1; i < n; i++ {
+		value -= 1000
+		spend := addSpendBlock(t, bc, prev, 0, alice.GetPrivateKeyHex(), []transaction.TxOutput{
+			{Value: value, ScriptPubKey: alice.GetPublicKeyHex()},
+		})
+		prev = spend.ID
+	}
+	return bc
+}
+
+func TestPrevalidateChecksBlocksAndSignatures(t *testing.T) {
+	source := spendChain(t, 2*MinParallelBlocks)
+	blocks := source.GetBlocks()
+	base := transaction.NewUTXOSet()
+	base.ProcessTransaction(blocks[0].Transactions[0])
+
+	transaction.ResetCaches() // Building the chain verified every spend already
+	pre := source.prevalidate(blocks[1:], base)
+	for _, b := range blocks[1:] {
+		if !pre.passed(b) {
+			t.Errorf("Block #%d should pass", b.Index)
+		}
+	}
+	if got := pre.signatures().Len(); got != len(blocks)-2 {
+		t.Errorf("Expected every spend's signature verified, got %d of %d", got, len(blocks)-2)
+	}
+	if source.prevalidate(blocks[1:MinParallelBlocks], base) != nil {
+		t.Error("A short run should be left to the serial pass")
+	}
+
+	// A chain sharing only genesis switches over with the checks done in parallel
+	target := NewBlockchainFromBlocks(blocks[:1], 1)
+	if err := target.ReplaceChain(blocks); err != nil {
+		t.Fatalf("Failed to replace chain: %v", err)
+	}
+	if target.GetLength() != len(blocks) || target.GetUTXOSet().Sigs != nil {
+		t.Errorf("Expected the whole chain adopted and no signature cache kept")
+	}
+	if err := NewBlockchainFromBlocks(source.GetBlocks(), 1).ValidateChain(); err != nil {
+		t.Errorf("Valid chain should validate: %v", err)
+	}
+}
+
+func TestPrevalidateKeepsSerialErrors(t *testing.T) {
+	source := spendChain(t, 2*MinParallelBlocks)
+
+	tests := []struct {
+		name   string
+		tamper func(b *block.Block)
+		want   error
+	}{
+		{"bad signature", func(b *block.Block) {
+			in := &b.Transactions[1].Inputs[0]
+			last := in.ScriptSig[len(in.ScriptSig)-1]
+			in.ScriptSig = in.ScriptSig[:len(in.ScriptSig)-1] + string("01"[(last+1)%2])
+		}, ErrInvalidTransaction},
+		{"bad hash", func(b *block.Block) { b.Nonce++ }, ErrInvalidBlock},
+	}
+	for _, tt := range tests {
+		blocks := source.GetBlocks()
+		tt.tamper(blocks[MinParallelBlocks])
+
+		target := NewBlockchainFromBlocks(blocks[:1], 1)
+		if err := target.ReplaceChain(blocks); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if target.GetLength() != 1 {
+			t.Errorf("%s: chain should be unchanged, got length %d", tt.name, target.GetLength())
+		}
+		if err := NewBlockchainFromBlocks(blocks, 1).ValidateChain(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ValidateChain expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
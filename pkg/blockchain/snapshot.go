@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// UTXOSnapshot is the UTXO set at a chain tip: the consensus state every node
+// on the same chain must agree on
+type UTXOSnapshot struct {
+	Height  int64          `json:"height"`
+	TipHash string         `json:"tip_hash"`
+	UTXOs   []SnapshotUTXO `json:"utxos"` // Sorted by outpoint
+}
+
+// SnapshotUTXO is an unspent output with the height of the block that created it
+type SnapshotUTXO struct {
+	transaction.UTXO
+	Height int64 `json:"height"` // -1 if the creating transaction is not indexed
+}
+
+// Outpoint returns the output's "txid:index" reference
+func (u SnapshotUTXO) Outpoint() string {
+	return fmt.Sprintf("%s:%d", u.TxID, u.OutIndex)
+}
+
+// Snapshot returns the chain's UTXO set at its tip
+func (bc *Blockchain) Snapshot() UTXOSnapshot {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	tip := bc.Blocks[len(bc.Blocks)-1]
+	snap := UTXOSnapshot{Height: tip.Index, TipHash: tip.Hash}
+	for _, utxo := range bc.UTXOSet.GetAllUTXOs() {
+		height := int64(-1)
+		if loc, ok := bc.index.txLocations[utxo.TxID]; ok {
+			height = loc.BlockHeight
+		}
+		u := *utxo
+		u.Height = 0 // Reported as SnapshotUTXO.Height, which hides it in JSON
+		snap.UTXOs = append(snap.UTXOs, SnapshotUTXO{UTXO: u, Height: height})
+	}
+	return snap
+}
+
+// WriteSnapshot saves a snapshot as JSON
+func WriteSnapshot(path string, snap UTXOSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadSnapshot loads a snapshot saved by WriteSnapshot
+func ReadSnapshot(path string) (UTXOSnapshot, error) {
+	var snap UTXOSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("invalid snapshot %s: %v", path, err)
+	}
+	return snap, nil
+}
+
+// UTXOMismatch is an outpoint both snapshots hold with different contents
+type UTXOMismatch struct {
+	Outpoint string       `json:"outpoint"`
+	A        SnapshotUTXO `json:"a"`
+	B        SnapshotUTXO `json:"b"`
+}
+
+// SnapshotDiff lists how snapshot b differs from snapshot a
+type SnapshotDiff struct {
+	Missing    []SnapshotUTXO `json:"missing"`    // In a but not b
+	Extra      []SnapshotUTXO `json:"extra"`      // In b but not a
+	Mismatched []UTXOMismatch `json:"mismatched"` // Same outpoint, different value, script, or height
+}
+
+// Empty reports whether the snapshots hold the same UTXO set
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Mismatched) == 0
+}
+
+// FirstHeight returns the lowest creation height among the differing outputs,
+// the earliest block whose effects the snapshots disagree on, or -1 if there
+// is none. An output one side spent and the other did not is attributed to
+// the block that created it, so the spend itself may be later.
+func (d *SnapshotDiff) FirstHeight() int64 {
+	first := int64(-1)
+	note := func(h int64) {
+		if h >= 0 && (first < 0 || h < first) {
+			first = h
+		}
+	}
+	for _, u := range d.Missing {
+		note(u.Height)
+	}
+	for _, u := range d.Extra {
+		note(u.Height)
+	}
+	for _, m := range d.Mismatched {
+		note(m.A.Height)
+		note(m.B.Height)
+	}
+	return first
+}
+
+// DiffSnapshots compares two snapshots outpoint by outpoint
+func DiffSnapshots(a, b UTXOSnapshot) SnapshotDiff {
+	inB := make(map[string]SnapshotUTXO, len(b.UTXOs))
+	for _, u := range b.UTXOs {
+		inB[u.Outpoint()] = u
+	}
+	var d SnapshotDiff
+	for _, ua := range a.UTXOs {
+		op := ua.Outpoint()
+		ub, ok := inB[op]
+		if !ok {
+			d.Missing = append(d.Missing, ua)
+			continue
+		}
+		delete(inB, op)
+		if ua != ub {
+			d.Mismatched = append(d.Mismatched, UTXOMismatch{Outpoint: op, A: ua, B: ub})
+		}
+	}
+	for _, ub := range inB {
+		d.Extra = append(d.Extra, ub)
+	}
+	sort.Slice(d.Extra, func(i, j int) bool {
+		if d.Extra[i].TxID != d.Extra[j].TxID {
+			return d.Extra[i].TxID < d.Extra[j].TxID
+		}
+		return d.Extra[i].OutIndex < d.Extra[j].OutIndex
+	})
+	return d
+}
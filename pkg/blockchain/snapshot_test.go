@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	bc := NewBlockchain(2)
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	a := bc.Snapshot()
+	if a.Height != 3 || a.TipHash != bc.GetLatestBlock().Hash {
+		t.Fatalf("Snapshot should be at the tip, got height %d", a.Height)
+	}
+
+	// Round trip through a file
+	path := filepath.Join(t.TempDir(), "a.json")
+	if err := WriteSnapshot(path, a); err != nil {
+		t.Fatalf("WriteSnapshot failed: %v", err)
+	}
+	saved, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshot failed: %v", err)
+	}
+	if d := DiffSnapshots(a, saved); !d.Empty() || d.FirstHeight() != -1 {
+		t.Fatalf("A saved snapshot should match, got %+v", d)
+	}
+
+	// A node with broken UTXO processing: it lost block 2's coinbase, paid
+	// block 3's coinbase a different value, and holds an output nobody created
+	cb2 := bc.GetBlockByHeight(2).Transactions[0]
+	cb3 := bc.GetBlockByHeight(3).Transactions[0]
+	broken := NewBlockchainFromBlocks(bc.GetBlocks(), 2)
+	broken.UTXOSet.RemoveUTXO(cb2.ID, 0)
+	broken.UTXOSet.AddUTXO(cb3.ID, 0, 1, cb3.Outputs[0].ScriptPubKey)
+	broken.UTXOSet.AddUTXO("phantom", 0, 50, "mallory")
+
+	d := DiffSnapshots(a, broken.Snapshot())
+	if len(d.Missing) != 1 || d.Missing[0].TxID != cb2.ID || d.Missing[0].Height != 2 {
+		t.Errorf("Expected block 2's coinbase missing, got %+v", d.Missing)
+	}
+	if len(d.Extra) != 1 || d.Extra[0].TxID != "phantom" || d.Extra[0].Height != -1 {
+		t.Errorf("Expected the phantom output extra, got %+v", d.Extra)
+	}
+	if len(d.Mismatched) != 1 || d.Mismatched[0].B.Value != 1 {
+		t.Errorf("Expected block 3's coinbase mismatched, got %+v", d.Mismatched)
+	}
+	if d.FirstHeight() != 2 {
+		t.Errorf("Expected divergence from height 2, got %d", d.FirstHeight())
+	}
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// maxHalvings is the number of halvings after which any subsidy is 0
+const maxHalvings = 63
+
+// ErrExcessCoinbase is returned for a block whose coinbase pays more than its
+// subsidy plus the fees it collects. It wraps ErrInvalidTransaction.
+var ErrExcessCoinbase = fmt.Errorf("%w: coinbase exceeds subsidy plus fees", ErrInvalidTransaction)
+
+// EmissionEra is a run of consecutive heights paying the same block subsidy
+type EmissionEra struct {
+	StartHeight int64
+	EndHeight   int64 // Last height of the era, or -1 if the era never ends
+	Subsidy     int64
+	Total       int64 // Subsidy of the whole era, or -1 if unbounded
+}
+
+// SubsidyAt returns the maximum subsidy a block at height may claim:
+// BaseSubsidy, until a scheduled change sets another, halved at every
+// multiple of HalvingInterval, so the total supply is capped
+func (p *ChainParams) SubsidyAt(height int64) int64 {
+	if height <= 0 {
+		return 0 // Genesis pays nothing
+	}
+	subsidy := BaseSubsidy
+	if p == nil {
+		return subsidy
+	}
+	for _, c := range p.Changes {
+		if c.Height > height {
+			break
+		}
+		if c.Subsidy != nil {
+			subsidy = *c.Subsidy
+		}
+	}
+	if p.HalvingInterval > 0 {
+		halvings := height / p.HalvingInterval
+		if halvings > maxHalvings {
+			return 0
+		}
+		subsidy >>= halvings
+	}
+	return subsidy
+}
+
+// EmissionSchedule returns the subsidy eras implied by the params, in height
+// order. A new era starts at each scheduled change of the subsidy and at each
+// halving; the last era never ends, and is bounded only if it pays nothing.
+func (p *ChainParams) EmissionSchedule() []EmissionEra {
+	starts := []int64{1}
+	if p != nil {
+		for _, c := range p.Changes {
+			if c.Subsidy != nil && c.Height > 1 {
+				starts = append(starts, c.Height)
+			}
+		}
+		for n := int64(1); p.HalvingInterval > 0 && n <= maxHalvings+1 && p.HalvingInterval <= math.MaxInt64/n; n++ {
+			starts = append(starts, n*p.HalvingInterval)
+		}
+	}
+	slices.Sort(starts)
+
+	var eras []EmissionEra
+	for _, height := range slices.Compact(starts) {
+		subsidy := p.SubsidyAt(height)
+		if len(eras) > 0 {
+			last := &eras[len(eras)-1]
+			if subsidy == last.Subsidy {
+				continue
+			}
+			last.EndHeight = height - 1
+			last.Total = last.Subsidy * (last.EndHeight - last.StartHeight + 1)
+		}
+		eras = append(eras, EmissionEra{StartHeight: height, EndHeight: -1, Subsidy: subsidy})
+	}
+	if last := &eras[len(eras)-1]; last.Subsidy != 0 {
+		last.Total = -1
+	}
+	return eras
+}
+
+// MaxSupply returns the total subsidy the schedule will ever issue, or -1 if unbounded
+func (p *ChainParams) MaxSupply() int64 {
+	var total int64
+	for _, era := range p.EmissionSchedule() {
+		if era.Total < 0 {
+			return -1
+		}
+		total += era.Total
+	}
+	return total
+}
+
+// SupplyEra is an emission era with what the chain has issued in it so far
+type SupplyEra struct {
+	EmissionEra
+	Blocks int64 // Blocks mined in the era so far
+	Issued int64 // Subsidy claimed by those blocks (miners may claim less than allowed)
+}
+
+// Supply summarizes the coins in existence at the chain tip. All values are in satoshi.
+type Supply struct {
+	Height        int64
+	NextSubsidy   int64 // Subsidy of the next block
+	MaxSupply     int64 // -1 if the schedule never ends
+	Scheduled     int64 // Subsidy allowed up to the tip
+	Issued        int64 // Subsidy claimed up to the tip; fees only move existing coins
+	Burned        int64 // Unspent value locked to provably unspendable outputs
+	BurnedOutputs int
+	Circulating   int64 // Issued - Burned
+	Eras          []SupplyEra
+}
+
+// Supply computes the emission schedule and the circulating supply from the
+// chain params and chain state
+func (bc *Blockchain) Supply() Supply {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	params := bc.options.Params
+	tip := int64(len(bc.Blocks) - 1)
+	supply := Supply{
+		Height:      tip,
+		NextSubsidy: params.SubsidyAt(tip + 1),
+		MaxSupply:   params.MaxSupply(),
+	}
+	for _, era := range params.EmissionSchedule() {
+		supply.Eras = append(supply.Eras, SupplyEra{EmissionEra: era})
+	}
+
+	for height, b := range bc.Blocks {
+		claimed := bc.claimedSubsidy(b.Transactions)
+		supply.Scheduled += params.SubsidyAt(int64(height))
+		supply.Issued += claimed
+		for i := range supply.Eras {
+			era := &supply.Eras[i]
+			if int64(height) >= era.StartHeight && (era.EndHeight < 0 || int64(height) <= era.EndHeight) {
+				era.Blocks++
+				era.Issued += claimed
+				break
+			}
+		}
+	}
+
+	for _, utxo := range bc.UTXOSet.GetAllUTXOs() {
+		if utxo.Value > 0 && transaction.IsUnspendable(utxo.ScriptPubKey) {
+			supply.Burned += utxo.Value
+			supply.BurnedOutputs++
+		}
+	}
+	supply.Circulating = supply.Issued - supply.Burned
+	return supply
+}
+
+// claimedSubsidy returns the coinbase value of a block minus the fees it collected
+func (bc *Blockchain) claimedSubsidy(txs []*transaction.Transaction) int64 {
+	var coinbase, fees int64
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			coinbase += tx.TotalOutputValue()
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if out := bc.index.output(bc.Blocks, in.TxID, in.OutIndex); out != nil {
+				fees += out.Value
+			}
+		}
+		fees -= tx.TotalOutputValue()
+	}
+	return coinbase - fees
+}
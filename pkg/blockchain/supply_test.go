@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSupplyTracksIssuanceAndBurn(t *testing.T) {
+	bc := NewBlockchain(2)
+	kp, _ := transaction.GenerateKeyPair()
+	alice := kp.GetPublicKeyHex()
+
+	funding := createValidBlock(bc, alice)
+	if err := bc.AddBlock(funding); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	// Alice pays 1000 to "bob" (not a public key, so burned) and 500 in fees,
+	// which the next coinbase collects on top of the subsidy
+	coinbase := funding.Transactions[0]
+	spend, err := bc.GetUTXOSet().CreateTransaction(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: coinbase.ID, OutIndex: 0}},
+		[]transaction.TxOutput{
+			{Value: 1000, ScriptPubKey: "bob"},
+			{Value: BaseSubsidy - 1500, ScriptPubKey: alice},
+		},
+		map[string]string{alice: kp.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	b := bc.CreateBlock([]*transaction.Transaction{
+		transaction.NewCoinbaseTransaction(alice, BaseSubsidy+500, 2), spend,
+	}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	supply := bc.Supply()
+	if supply.Height != 2 || supply.Scheduled != 2*BaseSubsidy || supply.Issued != 2*BaseSubsidy {
+		t.Errorf("Fees should not count as issuance: %+v", supply)
+	}
+	if supply.Burned != 1000 || supply.BurnedOutputs != 1 || supply.Circulating != 2*BaseSubsidy-1000 {
+		t.Errorf("Unexpected burn accounting: %+v", supply)
+	}
+	if len(supply.Eras) != 1 || supply.Eras[0].Blocks != 2 || supply.Eras[0].Issued != supply.Issued {
+		t.Errorf("Unexpected era totals: %+v", supply.Eras)
+	}
+	if supply.MaxSupply != -1 || supply.NextSubsidy != BaseSubsidy {
+		t.Errorf("Constant subsidy should be unbounded: %+v", supply)
+	}
+}
+
+func TestReplaceChainRejectsInflatedCoinbase(t *testing.T) {
+	bc := NewBlockchain(1)
+	for i := 0; i < 2; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "honest")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	// A longer branch from genesis whose second block pays 100 subsidies
+	blocks := bc.GetBlocks()[:1]
+	for height := int64(1); height <= 3; height++ {
+		value := BaseSubsidy
+		if height == 2 {
+			value = 100 * BaseSubsidy
+		}
+		coinbase := transaction.NewCoinbaseTransaction("attacker", value, height)
+		b := block.NewBlock(height, []*transaction.Transaction{coinbase}, blocks[height-1].Hash, 1, "attacker",
+			block.WithMerkleTree(bc.Options().UseMerkleTree))
+		pow.NewProofOfWork(b).Mine(context.TODO(), nil)
+		blocks = append(blocks, b)
+	}
+
+	err := bc.ReplaceChain(blocks)
+	if !errors.Is(err, ErrExcessCoinbase) || !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("Expected ErrExcessCoinbase, got %v", err)
+	}
+	if bc.GetLength() != 3 || bc.GetLatestBlock().MinerID != "honest" {
+		t.Error("The honest chain should be unchanged")
+	}
+	if supply := bc.Supply(); supply.Issued != supply.Scheduled {
+		t.Errorf("Issued %d should match scheduled %d", supply.Issued, supply.Scheduled)
+	}
+}
+
+func TestHalvingScheduleCapsSupply(t *testing.T) {
+	params := DefaultChainParams()
+	params.HalvingInterval = 2
+	if got := []int64{params.SubsidyAt(1), params.SubsidyAt(2), params.SubsidyAt(3), params.SubsidyAt(4)}; got[0] != BaseSubsidy ||
+		got[1] != BaseSubsidy/2 || got[2] != BaseSubsidy/2 || got[3] != BaseSubsidy/4 {
+		t.Errorf("Expected the subsidy to halve every 2 blocks, got %v", got)
+	}
+	if params.SubsidyAt(2*(maxHalvings+1)) != 0 {
+		t.Error("The subsidy should run out")
+	}
+
+	// The eras sum to a finite supply: 1 block at the full subsidy, then 2 per halving
+	eras := params.EmissionSchedule()
+	if eras[0].EndHeight != 1 || eras[1].StartHeight != 2 || eras[1].Total != BaseSubsidy {
+		t.Errorf("Unexpected first eras: %+v", eras[:2])
+	}
+	var want int64 = BaseSubsidy
+	for s := BaseSubsidy / 2; s > 0; s /= 2 {
+		want += 2 * s
+	}
+	if got := params.MaxSupply(); got != want {
+		t.Errorf("Expected a max supply of %d, got %d", want, got)
+	}
+
+	// Blocks are held to the halved subsidy
+	bc := NewBlockchain(1, WithParams(params))
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	b := createValidBlock(bc, "miner1") // Claims the full BaseSubsidy
+	if err := bc.AddBlock(b); !errors.Is(err, ErrExcessCoinbase) {
+		t.Errorf("Expected the full subsidy to be refused after a halving, got %v", err)
+	}
+	b = bc.CreateBlock([]*transaction.Transaction{transaction.NewCoinbaseTransaction("miner1", BaseSubsidy/2, 2)}, "miner1")
+	mineForTest(bc, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Errorf("The halved subsidy should be accepted: %v", err)
+	}
+	if supply := bc.Supply(); supply.NextSubsidy != BaseSubsidy/2 || supply.MaxSupply != want {
+		t.Errorf("Unexpected supply: %+v", supply)
+	}
+}
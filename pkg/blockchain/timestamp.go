@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// MedianTimeSpan is how many blocks before a new one its timestamp must
+	// be later than the median of
+	MedianTimeSpan = 11
+
+	// DefaultMaxClockDrift is how far ahead of the local clock a block's
+	// timestamp may be by default
+	DefaultMaxClockDrift = 10 * time.Minute
+)
+
+var (
+	ErrTimestampTooEarly = errors.New("block timestamp not after the median of recent blocks")
+	ErrTimestampInFuture = errors.New("block timestamp too far in the future")
+)
+
+// WithMaxClockDrift sets how far ahead of the local clock a block's timestamp
+// may be (0 = unchecked)
+func WithMaxClockDrift(drift time.Duration) Option {
+	return func(o *Options) {
+		o.MaxClockDrift = drift
+	}
+}
+
+// medianTimePast returns the median timestamp of the last MedianTimeSpan
+// blocks of chain, or of all of them if it is shorter
+func medianTimePast(chain []*block.Block) int64 {
+	recent := chain[max(len(chain)-MedianTimeSpan, 0):]
+	times := make([]int64, len(recent))
+	for i, b := range recent {
+		times[i] = b.Timestamp
+	}
+	slices.Sort(times)
+	return times[len(times)/2]
+}
+
+// MedianTimePast returns the median timestamp of the last MedianTimeSpan
+// blocks; the next block's timestamp must be later
+func (bc *Blockchain) MedianTimePast() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return medianTimePast(bc.Blocks)
+}
+
+// checkTimestamp checks b's timestamp against chain, the blocks up to its
+// parent: it must be later than their median time past, which no single
+// miner can move, and at most MaxClockDrift ahead of the local clock, so a
+// miner cannot skew the difficulty retarget by dating blocks in the future.
+// Without the chain (nil), as for a header checked alone, only the clock is.
+func (bc *Blockchain) checkTimestamp(b *block.Block, chain []*block.Block) error {
+	if len(chain) > 0 {
+		if mtp := medianTimePast(chain); b.Timestamp <= mtp {
+			return fmt.Errorf("%w: block #%d at %s, median %s", ErrTimestampTooEarly, b.Index, formatTime(b.Timestamp), formatTime(mtp))
+		}
+	}
+	if drift := bc.options.MaxClockDrift; drift > 0 {
+		if ahead := time.Duration(b.Timestamp - time.Now().UnixNano()); ahead > drift {
+			return fmt.Errorf("%w: block #%d is %s ahead of the local clock, at most %s allowed",
+				ErrTimestampInFuture, b.Index, ahead.Round(time.Second), drift)
+		}
+	}
+	return nil
+}
+
+// formatTime formats a block timestamp (Unix nanoseconds)
+func formatTime(ts int64) string {
+	return time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockAt creates the next block dated timestamp and mines it
+func blockAt(bc *Blockchain, timestamp int64) *block.Block {
+	coinbase := transaction.NewCoinbaseTransaction("miner1", BaseSubsidy, bc.GetLatestBlock().Index+1)
+	b := bc.CreateBlock([]*transaction.Transaction{coinbase}, "miner1")
+	b.Timestamp = timestamp
+	mineForTest(bc, b)
+	return b
+}
+
+func TestTimestampRules(t *testing.T) {
+	bc := NewBlockchain(1)
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	blocks := bc.GetBlocks()
+	if mtp := bc.MedianTimePast(); mtp != blocks[2].Timestamp {
+		t.Errorf("Expected the median of 4 blocks to be block #2's timestamp, got %d", mtp)
+	}
+
+	// Before the tip but after the median is fine; at the median is not
+	mtp := bc.MedianTimePast()
+	if err := bc.AddBlock(blockAt(bc, mtp)); !errors.Is(err, ErrTimestampTooEarly) {
+		t.Errorf("Expected a block dated at the median to be refused, got %v", err)
+	}
+	if err := bc.AddBlock(blockAt(bc, mtp+1)); err != nil {
+		t.Fatalf("A block dated after the median should be accepted: %v", err)
+	}
+
+	// Nor may a block be dated too far ahead, checked from its header alone
+	future := blockAt(bc, time.Now().Add(DefaultMaxClockDrift+time.Minute).UnixNano())
+	if err := bc.VerifyHeader(future, bc.GetLatestBlock()); !errors.Is(err, ErrTimestampInFuture) {
+		t.Errorf("Expected VerifyHeader to refuse a future block, got %v", err)
+	}
+	if err := bc.AddBlock(future); !errors.Is(err, ErrTimestampInFuture) {
+		t.Errorf("Expected AddBlock to refuse a future block, got %v", err)
+	}
+
+	// A replacement chain is held to the same rules
+	early := bc.GetBlocks()
+	for _, ts := range []int64{time.Now().UnixNano(), early[1].Timestamp} {
+		early = append(early, mineOn(bc, early[len(early)-1], "rival", BaseSubsidy))
+		early[len(early)-1].Timestamp = ts
+		mineForTest(bc, early[len(early)-1])
+	}
+	if err := bc.ReplaceChain(early); !errors.Is(err, ErrTimestampTooEarly) {
+		t.Errorf("Expected a chain with a backdated block to be refused, got %v", err)
+	}
+
+	// The drift is configurable, and 0 turns the clock check off
+	relaxed := NewBlockchainFromBlocks(bc.GetBlocks(), 1, WithMaxClockDrift(0))
+	if err := relaxed.AddBlock(blockAt(relaxed, time.Now().Add(24*time.Hour).UnixNano())); err != nil {
+		t.Errorf("Without a drift limit a future block should be accepted: %v", err)
+	}
+}
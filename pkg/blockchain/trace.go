@@ -0,0 +1,282 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/script"
+	"blockchain/pkg/transaction"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TraceKind classifies a step of a block trace
+type TraceKind string
+
+const (
+	TraceHeader    TraceKind = "header"    // Linkage, hash, Merkle root, and proof of work
+	TraceRule      TraceKind = "rule"      // Consensus rules in force at the block's height
+	TraceTx        TraceKind = "tx"        // Per-transaction structure and balance checks
+	TraceSpend     TraceKind = "spend"     // A UTXO consumed by an input
+	TraceSignature TraceKind = "signature" // An input signature verified against the spent output's key
+	TraceCreate    TraceKind = "create"    // A UTXO created by an output
+	TraceCoinbase  TraceKind = "coinbase"  // Coinbase placement and reward
+)
+
+// TraceStep is one check made, or one ledger change applied, while
+// validating a block
+type TraceStep struct {
+	Kind   TraceKind
+	Detail string
+	OK     bool
+}
+
+// BlockTrace is the step-by-step validation of one block against the ledger
+// as of its parent. Steps stop at the first failed check, as validation does.
+type BlockTrace struct {
+	Height int64
+	Hash   string
+	Steps  []TraceStep
+	// Err is the verdict of the chain's real validator, which the steps
+	// explain; nil if the block is valid
+	Err error
+}
+
+// Failed returns the failed step, or nil if every traced check passed
+func (t *BlockTrace) Failed() *TraceStep {
+	if n := len(t.Steps); n > 0 && !t.Steps[n-1].OK {
+		return &t.Steps[n-1]
+	}
+	return nil
+}
+
+// check records a step and returns err if it failed
+func (t *BlockTrace) check(kind TraceKind, ok bool, err error, format string, args ...any) error {
+	t.Steps = append(t.Steps, TraceStep{Kind: kind, Detail: fmt.Sprintf(format, args...), OK: ok})
+	if !ok {
+		return err
+	}
+	return nil
+}
+
+// note records a ledger change
+func (t *BlockTrace) note(kind TraceKind, format string, args ...any) {
+	t.Steps = append(t.Steps, TraceStep{Kind: kind, Detail: fmt.Sprintf(format, args...), OK: true})
+}
+
+// TraceBlock re-executes the validation of the block at height, recording
+// each rule checked, each UTXO consumed and created, and each signature
+// verified. The ledger is rebuilt by replaying the chain up to the block's
+// parent, so the trace depends only on the blocks, not on the node's state.
+func (bc *Blockchain) TraceBlock(height int64) (*BlockTrace, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 1 || height >= int64(len(bc.Blocks)) {
+		return nil, fmt.Errorf("no block to replay at height %d (chain has %d blocks; genesis has no parent)", height, len(bc.Blocks))
+	}
+
+	b := bc.Blocks[height].Clone()
+	bc.ConfigureBlock(b)
+	ledger := transaction.NewUTXOSet()
+	for _, earlier := range bc.Blocks[:height] {
+		bc.atHeight(ledger, earlier.Index)
+		for _, tx := range earlier.Transactions {
+			ledger.ProcessTransaction(tx)
+		}
+	}
+
+	t := &BlockTrace{Height: b.Index, Hash: b.Hash}
+	traceErr := bc.traceBlock(t, b, bc.Blocks[:height], ledger.Copy())
+	t.Err = bc.checkBlock(b, bc.Blocks[:height], ledger, nil)
+	if (traceErr == nil) != (t.Err == nil) {
+		// The steps and the validator must agree; say so if they ever do not
+		t.Steps = append(t.Steps, TraceStep{Kind: TraceRule, Detail: fmt.Sprintf("validator verdict differs from trace: %v", t.Err)})
+	}
+	return t, nil
+}
+
+// traceBlock mirrors checkBlock step by step, applying b to ledger
+func (bc *Blockchain) traceBlock(t *BlockTrace, b *block.Block, chain []*block.Block, ledger *transaction.UTXOSet) error {
+	prev := chain[len(chain)-1]
+	if err := t.check(TraceHeader, b.Index == prev.Index+1, ErrInvalidIndex,
+		"index %d follows parent %d", b.Index, prev.Index); err != nil {
+		return err
+	}
+	if err := t.check(TraceHeader, b.PrevHash == prev.Hash, ErrInvalidPrevHash,
+		"previous hash %s links to parent", abbrev(b.PrevHash)); err != nil {
+		return err
+	}
+	mode := "legacy"
+	if b.UsesMerkleTree() {
+		mode = "merkle"
+	}
+	if err := t.check(TraceHeader, b.HasValidHash(), ErrInvalidBlock,
+		"hash %s matches contents (%s hashing)", abbrev(b.Hash), mode); err != nil {
+		return err
+	}
+	if b.UsesMerkleTree() {
+		if err := t.check(TraceHeader, b.HasValidMerkleRoot(), ErrInvalidMerkleRoot,
+			"merkle root %s commits to %d transactions", abbrev(b.MerkleRoot), len(b.Transactions)); err != nil {
+			return err
+		}
+	}
+	sealErr := bc.Engine().ValidateHeader(b)
+	if err := t.check(TraceHeader, sealErr == nil, sealErr,
+		"proof of work meets claimed difficulty %d", b.Difficulty); err != nil {
+		return err
+	}
+
+	ctx := bc.ContextAt(b.Index)
+	headerErr := ctx.checkHeaderRules(b)
+	if err := t.check(TraceRule, headerErr == nil, headerErr,
+		"claimed difficulty %d meets required %d (floor %d)", b.Difficulty, ctx.Difficulty, ctx.MinDifficulty); err != nil {
+		return err
+	}
+
+	for _, tx := range b.Transactions {
+		if err := t.check(TraceTx, tx.Verify(), ErrInvalidBlock, "tx %s is well-formed", abbrev(tx.ID)); err != nil {
+			return err
+		}
+	}
+
+	rulesErr := ctx.checkBlockRules(b)
+	if err := t.check(TraceRule, rulesErr == nil, rulesErr,
+		"rules active at height %d: %s", b.Index, activeRules(ctx)); err != nil {
+		return err
+	}
+	timeErr := bc.checkTimestamp(b, chain)
+	if err := t.check(TraceHeader, timeErr == nil, timeErr,
+		"timestamp %s is after the median time past %s", formatTime(b.Timestamp), formatTime(medianTimePast(chain))); err != nil {
+		return err
+	}
+
+	return bc.traceTransactions(t, b, ledger)
+}
+
+// traceTransactions mirrors applyBlockTransactions step by step
+func (bc *Blockchain) traceTransactions(t *BlockTrace, b *block.Block, ledger *transaction.UTXOSet) error {
+	sizeErr := bc.options.Params.checkBlockSize(b.Transactions)
+	if err := t.check(TraceRule, sizeErr == nil, sizeErr,
+		"block carries %d transactions in %d bytes%s", len(b.Transactions), BlockSize(b.Transactions), sizeLimits(bc.options.Params)); err != nil {
+		return err
+	}
+	bc.atHeight(ledger, b.Index)
+	var totalFees, coinbaseValue int64
+	coinbaseCount := 0
+	for i, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			coinbaseCount++
+			if err := t.check(TraceCoinbase, coinbaseCount == 1 && i == 0, ErrInvalidTransaction,
+				"coinbase %s is the block's first and only coinbase", abbrev(tx.ID)); err != nil {
+				return err
+			}
+			coinbaseValue = tx.TotalOutputValue()
+			ledger.ProcessTransaction(tx)
+			traceOutputs(t, tx)
+			continue
+		}
+
+		var inputTotal int64
+		for j, in := range tx.Inputs {
+			utxo := ledger.FindUTXO(in.TxID, in.OutIndex)
+			if err := t.check(TraceSpend, utxo != nil, ErrInvalidTransaction,
+				"tx %s input %d spends %s:%d%s", abbrev(tx.ID), j, abbrev(in.TxID), in.OutIndex, utxoSummary(utxo)); err != nil {
+				return err
+			}
+			inputTotal += utxo.Value
+			if script.IsScriptHash(utxo.ScriptPubKey) {
+				spendErr := tx.SpendsOutput(j, in.ScriptSig, utxo.Output())
+				if err := t.check(TraceSignature, spendErr == nil, ErrInvalidTransaction,
+					"tx %s input %d satisfies redeem script %s", abbrev(tx.ID), j, abbrev(utxo.ScriptPubKey)); err != nil {
+					return err
+				}
+				continue
+			}
+			version, flag, _, _ := transaction.ParseScriptSig(in.ScriptSig)
+			if err := t.check(TraceSignature, tx.VerifyInputSpending(j, in.ScriptSig, utxo.Output()), ErrInvalidTransaction,
+				"tx %s input %d %s signature by %s", abbrev(tx.ID), j, sigHashName(version, flag), abbrev(utxo.ScriptPubKey)); err != nil {
+				return err
+			}
+		}
+
+		outputTotal := tx.TotalOutputValue()
+		validErr := ledger.ValidateTransaction(tx)
+		if err := t.check(TraceTx, validErr == nil, ErrInvalidTransaction,
+			"tx %s inputs %d cover outputs %d (fee %d)", abbrev(tx.ID), inputTotal, outputTotal, inputTotal-outputTotal); err != nil {
+			return err
+		}
+		totalFees += tx.GetFee(ledger)
+		ledger.ProcessTransaction(tx)
+		for j, in := range tx.Inputs {
+			t.note(TraceSpend, "consumed %s:%d (tx %s input %d)", abbrev(in.TxID), in.OutIndex, abbrev(tx.ID), j)
+		}
+		traceOutputs(t, tx)
+	}
+
+	if err := t.check(TraceCoinbase, coinbaseCount == 1, ErrInvalidTransaction,
+		"block has exactly one coinbase (found %d)", coinbaseCount); err != nil {
+		return err
+	}
+	allowed := bc.options.Params.SubsidyAt(b.Index) + totalFees
+	return t.check(TraceCoinbase, coinbaseValue <= allowed, ErrExcessCoinbase,
+		"coinbase pays %d, allowed %d (subsidy %d + fees %d)", coinbaseValue, allowed, allowed-totalFees, totalFees)
+}
+
+// sizeLimits describes the block size limits in force, if any
+func sizeLimits(p *ChainParams) string {
+	maxTxs, maxBytes := p.BlockLimits()
+	if maxTxs == 0 && maxBytes == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (limits: %d besides the coinbase, %d bytes; 0 = unlimited)", maxTxs, maxBytes)
+}
+
+// traceOutputs records the UTXOs a transaction created
+func traceOutputs(t *BlockTrace, tx *transaction.Transaction) {
+	for i, out := range tx.Outputs {
+		t.note(TraceCreate, "created %s:%d: %d to %s", abbrev(tx.ID), i, out.Value, abbrev(out.ScriptPubKey))
+	}
+}
+
+// activeRules lists the versioned rules in force in ctx
+func activeRules(ctx *ValidationContext) string {
+	var rules []string
+	if ctx.Params != nil {
+		for rule := range ctx.Params.Activations {
+			if ctx.IsActive(rule) {
+				rules = append(rules, string(rule))
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return "none"
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, ", ")
+}
+
+func utxoSummary(utxo *transaction.UTXO) string {
+	if utxo == nil {
+		return " (not in the UTXO set)"
+	}
+	return fmt.Sprintf(" (%d to %s)", utxo.Value, abbrev(utxo.ScriptPubKey))
+}
+
+func sigHashName(v transaction.SigHashVersion, flag transaction.SigHashFlag) string {
+	switch v {
+	case transaction.SigHashV1:
+		return "v1"
+	case transaction.SigHashV2:
+		return "v2 " + flag.String()
+	case transaction.SigHashV3:
+		return "v3 " + flag.String()
+	}
+	return "legacy"
+}
+
+// abbrev shortens hashes and keys for trace output
+func abbrev(s string) string {
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:16] + "..."
+}
@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+)
+
+// countSteps returns how many steps of a kind the trace recorded
+func countSteps(trace *BlockTrace, kind TraceKind) int {
+	n := 0
+	for _, step := range trace.Steps {
+		if step.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTraceBlock(t *testing.T) {
+	kp, _ := transaction.GenerateKeyPair()
+	owner := kp.GetPublicKeyHex()
+
+	bc := NewBlockchain(1)
+	funding := transaction.NewCoinbaseTransaction(owner, BaseSubsidy, 1)
+	b1 := bc.CreateBlock([]*transaction.Transaction{funding}, "miner1")
+	mineForTest(bc, b1)
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	// Block 2 spends the funding output and pays a 1000 satoshi fee
+	spend := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: funding.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 600, ScriptPubKey: "alice"}, {Value: BaseSubsidy - 1600, ScriptPubKey: owner}},
+	)
+	spend.Inputs[0].ScriptSig, _ = spend.SignInput(0, kp.GetPrivateKeyHex())
+	spend.ID = spend.CalculateHash()
+	coinbase := transaction.NewCoinbaseTransaction("miner1", BaseSubsidy+1000, 2)
+	b2 := bc.CreateBlock([]*transaction.Transaction{coinbase, spend}, "miner1")
+	mineForTest(bc, b2)
+	if err := bc.AddBlock(b2); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	trace, err := bc.TraceBlock(2)
+	if err != nil {
+		t.Fatalf("TraceBlock failed: %v", err)
+	}
+	if trace.Err != nil || trace.Failed() != nil {
+		t.Fatalf("Valid block should trace clean, got %v (failed step %+v)", trace.Err, trace.Failed())
+	}
+	if trace.Hash != b2.Hash {
+		t.Errorf("Trace is of %s, expected %s", trace.Hash, b2.Hash)
+	}
+	// One input checked and consumed, one signature, three outputs created
+	if n := countSteps(trace, TraceSpend); n != 2 {
+		t.Errorf("Expected 2 spend steps, got %d", n)
+	}
+	if n := countSteps(trace, TraceSignature); n != 1 {
+		t.Errorf("Expected 1 signature step, got %d", n)
+	}
+	if n := countSteps(trace, TraceCreate); n != 3 {
+		t.Errorf("Expected 3 create steps, got %d", n)
+	}
+
+	if _, err := bc.TraceBlock(0); err == nil {
+		t.Error("Genesis has no parent to replay against")
+	}
+
+	// A chain loaded without validation whose block 2 overpays its coinbase
+	inflated := transaction.NewCoinbaseTransaction("miner1", 2*BaseSubsidy, 2)
+	bad := bc.CreateBlock([]*transaction.Transaction{inflated}, "miner1")
+	bad.Index, bad.PrevHash = 2, b1.Hash
+	mineForTest(bc, bad)
+	forged := NewBlockchainFromBlocks(append(bc.GetBlocks()[:2], bad), 1)
+
+	trace, err = forged.TraceBlock(2)
+	if err != nil {
+		t.Fatalf("TraceBlock failed: %v", err)
+	}
+	if !errors.Is(trace.Err, ErrExcessCoinbase) {
+		t.Fatalf("Expected ErrExcessCoinbase, got %v", trace.Err)
+	}
+	if failed := trace.Failed(); failed == nil || failed.Kind != TraceCoinbase {
+		t.Errorf("Trace should end at the coinbase reward check, got %+v", failed)
+	}
+}
@@ -0,0 +1,494 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// MaxReorgDepth is how far below the tip a side branch may fork and still
+	// be kept; side blocks and orphans this far below the tip are dropped.
+	// Deeper forks can only be adopted as a whole chain, with ReplaceChain.
+	MaxReorgDepth = 100
+
+	// maxOrphans bounds the orphan pool; the oldest orphan is evicted first
+	maxOrphans = 100
+
+	// DefaultMaxOrphanBytes is the default memory budget of the orphan pool.
+	// A hundred full blocks would take about 100 MiB.
+	DefaultMaxOrphanBytes = 16 << 20
+
+	// blockHeaderBytes approximates the memory a block takes besides its
+	// transactions
+	blockHeaderBytes = 256
+)
+
+// ErrOrphanBlock is returned for a block whose parent is unknown. The block is
+// kept in the orphan pool and connected once its parent arrives.
+var ErrOrphanBlock = fmt.Errorf("%w: parent unknown, kept as orphan", ErrInvalidPrevHash)
+
+// ErrOrphanTooEasy is returned for a block whose parent is unknown and that
+// claims less difficulty than its height can require. It is not kept, so
+// cheap blocks cannot push real orphans out of the pool.
+var ErrOrphanTooEasy = fmt.Errorf("%w: orphan claims less than the minimum difficulty", ErrInsufficientDifficulty)
+
+// BlockStatus says where ProcessBlock placed a block
+type BlockStatus int
+
+const (
+	BlockRejected    BlockStatus = iota // Invalid or already known
+	BlockExtended                       // Appended to the main chain
+	BlockSideBranch                     // Kept on a branch no longer than the main chain
+	BlockReorganized                    // Its branch outgrew the main chain and replaced the blocks above the fork
+	BlockOrphaned                       // Kept in the orphan pool until its parent arrives
+)
+
+func (s BlockStatus) String() string {
+	switch s {
+	case BlockExtended:
+		return "extended"
+	case BlockSideBranch:
+		return "side branch"
+	case BlockReorganized:
+		return "reorganized"
+	case BlockOrphaned:
+		return "orphaned"
+	}
+	return "rejected"
+}
+
+// Reorg describes a change of the main chain other than an extension
+type Reorg struct {
+	Base     *block.Block   // Last block both branches share
+	Detached []*block.Block // Blocks that left the main chain, oldest first
+	Attached []*block.Block // Blocks that joined it, oldest first
+}
+
+// blockTree holds the blocks known besides the main chain. Side blocks link
+// to the main chain or to other side blocks; orphans wait for a parent.
+type blockTree struct {
+	side        map[string]*block.Block
+	orphans     map[string]*block.Block
+	orphanOrder []string                          // Orphan hashes, oldest first
+	orphanSince map[string]time.Time              // When each orphan arrived
+	orphanBytes int64                             // Approximate memory of the orphans
+	undo        map[string]*transaction.UTXODelta // UTXO changes of each main-chain block, by hash
+	reorgs      int
+}
+
+func newBlockTree() *blockTree {
+	return &blockTree{
+		side:        make(map[string]*block.Block),
+		orphans:     make(map[string]*block.Block),
+		orphanSince: make(map[string]time.Time),
+		undo:        make(map[string]*transaction.UTXODelta),
+	}
+}
+
+// WithMaxOrphanBytes sets the memory budget of the orphan pool (0 = bounded
+// by count only)
+func WithMaxOrphanBytes(maxBytes int64) Option {
+	return func(o *Options) {
+		o.MaxOrphanBytes = maxBytes
+	}
+}
+
+// blockBytes approximates the memory a block takes
+func blockBytes(b *block.Block) int64 {
+	return BlockSize(b.Transactions) + blockHeaderBytes
+}
+
+// addOrphan adds b to the orphan pool, evicting the oldest orphans while
+// there are more than maxOrphans or they take more than maxBytes
+func (t *blockTree) addOrphan(b *block.Block, maxBytes int64) {
+	t.orphans[b.Hash] = b
+	t.orphanSince[b.Hash] = time.Now()
+	t.orphanBytes += blockBytes(b)
+	t.orphanOrder = append(t.orphanOrder, b.Hash)
+	for len(t.orphans) > maxOrphans || maxBytes > 0 && t.orphanBytes > maxBytes {
+		t.removeOrphan(t.orphanOrder[0])
+		t.orphanOrder = t.orphanOrder[1:]
+	}
+}
+
+// removeOrphan drops an orphan from the pool, if there. Its hash is left in
+// orphanOrder, which skips hashes no longer in the pool.
+func (t *blockTree) removeOrphan(hash string) {
+	if o, ok := t.orphans[hash]; ok {
+		t.orphanBytes -= blockBytes(o)
+		delete(t.orphans, hash)
+		delete(t.orphanSince, hash)
+	}
+}
+
+// ExpireOrphans drops the orphans that arrived before cutoff, still waiting
+// for their parent, and returns how many it dropped
+func (bc *Blockchain) ExpireOrphans(cutoff time.Time) int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	t := bc.tree
+	expired := 0
+	for len(t.orphanOrder) > 0 {
+		hash := t.orphanOrder[0]
+		if _, ok := t.orphans[hash]; ok {
+			if !t.orphanSince[hash].Before(cutoff) {
+				break
+			}
+			t.removeOrphan(hash)
+			expired++
+		}
+		t.orphanOrder = t.orphanOrder[1:]
+	}
+	return expired
+}
+
+// takeOrphans removes and returns the orphans whose parent is hash
+func (t *blockTree) takeOrphans(hash string) []*block.Block {
+	var children []*block.Block
+	kept := t.orphanOrder[:0]
+	for _, h := range t.orphanOrder {
+		o, ok := t.orphans[h]
+		if !ok {
+			continue
+		}
+		if o.PrevHash == hash {
+			children = append(children, o)
+			t.removeOrphan(h)
+			continue
+		}
+		kept = append(kept, h)
+	}
+	t.orphanOrder = kept
+	return children
+}
+
+// TreeStats counts the blocks held off the main chain
+type TreeStats struct {
+	SideBlocks     int   // Blocks on competing branches
+	Orphans        int   // Blocks waiting for their parent
+	OrphanBytes    int64 // Approximate memory of the orphans
+	OrphanMaxBytes int64 // Memory budget of the orphan pool (0 = bounded by count only)
+	Reorgs         int   // Reorganizations so far, to a side branch or an adopted chain
+}
+
+// TreeStats returns the number of side blocks, orphans, and reorganizations
+func (bc *Blockchain) TreeStats() TreeStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return TreeStats{
+		SideBlocks:     len(bc.tree.side),
+		Orphans:        len(bc.tree.orphans),
+		OrphanBytes:    bc.tree.orphanBytes,
+		OrphanMaxBytes: bc.options.MaxOrphanBytes,
+		Reorgs:         bc.tree.reorgs,
+	}
+}
+
+// ProcessBlock adds a block wherever it fits: on the main chain's tip, on a
+// side branch, or in the orphan pool if its parent is unknown. A side branch
+// that grows longer than the main chain becomes the main chain, and orphans
+// waiting on a connected block are connected in turn. The returned status is
+// the block's own; the Reorg, if not nil, describes how the main chain
+// changed other than by extension.
+func (bc *Blockchain) ProcessBlock(b *block.Block) (BlockStatus, *Reorg, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	old := bc.Blocks
+	status, err := bc.placeBlock(b)
+	if err == nil && status != BlockOrphaned {
+		queue := []string{b.Hash}
+		for len(queue) > 0 {
+			for _, child := range bc.tree.takeOrphans(queue[0]) {
+				if s, err := bc.placeBlock(child); err == nil && s != BlockOrphaned {
+					queue = append(queue, child.Hash)
+				}
+			}
+			queue = queue[1:]
+		}
+	}
+	return status, bc.reorgSince(old), err
+}
+
+// reorgSince describes how the main chain changed from old, or returns nil if
+// it only grew. old must be a previous value of bc.Blocks; the chain never
+// rewrites blocks in place, so its elements are still the blocks they were.
+func (bc *Blockchain) reorgSince(old []*block.Block) *Reorg {
+	fork := min(len(old), len(bc.Blocks)) - 1
+	for fork >= 0 && old[fork].Hash != bc.Blocks[fork].Hash {
+		fork--
+	}
+	if fork == len(old)-1 {
+		return nil
+	}
+	reorg := &Reorg{}
+	if fork >= 0 {
+		reorg.Base = bc.Blocks[fork].Clone()
+	}
+	for _, b := range old[fork+1:] {
+		reorg.Detached = append(reorg.Detached, b.Clone())
+	}
+	for _, b := range bc.Blocks[fork+1:] {
+		reorg.Attached = append(reorg.Attached, b.Clone())
+	}
+	return reorg
+}
+
+// placeBlock is ProcessBlock for a single block, without connecting orphans
+func (bc *Blockchain) placeBlock(b *block.Block) (BlockStatus, error) {
+	bc.ConfigureBlock(b)
+	if bc.knownBlock(b.Hash) {
+		return BlockRejected, ErrBlockExists
+	}
+
+	tip := bc.Blocks[len(bc.Blocks)-1]
+	if b.PrevHash == tip.Hash {
+		if err := bc.addBlockUnlocked(b); err != nil {
+			return BlockRejected, err
+		}
+		return BlockExtended, nil
+	}
+
+	// The main chain holds every checkpoint up to its tip, so any other block
+	// at or below one would fork history the checkpoint fixes
+	if last := bc.options.Params.LastCheckpoint(tip.Index); b.Index <= last {
+		return BlockRejected, fmt.Errorf("%w: block #%d forks below the checkpoint at #%d", ErrCheckpointMismatch, b.Index, last)
+	}
+
+	parent := bc.findBlock(b.PrevHash)
+	if parent == nil {
+		// Only work already done goes in the pool; the link is checked later
+		if !b.HasValidHash() {
+			return BlockRejected, ErrInvalidBlock
+		}
+		if least := bc.minOrphanDifficulty(b.Index); b.Difficulty < least {
+			return BlockRejected, fmt.Errorf("%w: block #%d claims %d, at least %d required", ErrOrphanTooEasy, b.Index, b.Difficulty, least)
+		}
+		if err := bc.Engine().ValidateHeader(b); err != nil {
+			return BlockRejected, err
+		}
+		if b.Index <= tip.Index-MaxReorgDepth {
+			return BlockRejected, fmt.Errorf("%w: block #%d is too far below the tip to keep", ErrInvalidPrevHash, b.Index)
+		}
+		bc.tree.addOrphan(b, bc.options.MaxOrphanBytes)
+		return BlockOrphaned, ErrOrphanBlock
+	}
+
+	// Side blocks are checked as far as they can be without the UTXO set of
+	// their branch; the rest waits until the branch would become the main chain
+	if err := bc.VerifyHeader(b, parent); err != nil {
+		return BlockRejected, err
+	}
+	if b.UsesMerkleTree() && !b.HasValidMerkleRoot() {
+		return BlockRejected, ErrInvalidMerkleRoot
+	}
+	if !b.ValidateTransactions() {
+		return BlockRejected, ErrInvalidBlock
+	}
+	if b.Index <= tip.Index-MaxReorgDepth {
+		return BlockRejected, fmt.Errorf("%w: block #%d forks more than %d blocks below the tip", ErrInvalidBlock, b.Index, MaxReorgDepth)
+	}
+	bc.tree.side[b.Hash] = b
+	if b.Index <= tip.Index {
+		return BlockSideBranch, nil
+	}
+	if err := bc.reorganize(b); err != nil {
+		return BlockRejected, err
+	}
+	return BlockReorganized, nil
+}
+
+// minOrphanDifficulty returns the least difficulty an orphan at height may
+// claim. Without dynamic difficulty the requirement at every height is known
+// ahead. With it, the orphan's branch may have retargeted since it forked
+// within MaxReorgDepth of the tip, so the least requirement of the main chain
+// over that window and of the next block stands in for it.
+func (bc *Blockchain) minOrphanDifficulty(height int64) int {
+	if !bc.options.UseDynamicDifficulty {
+		return bc.RequiredDifficulty(height)
+	}
+	tip := bc.Blocks[len(bc.Blocks)-1].Index
+	least := bc.RequiredDifficulty(tip + 1)
+	for h := max(tip-MaxReorgDepth+1, 1); h <= tip; h++ {
+		least = min(least, bc.RequiredDifficulty(h))
+	}
+	return least
+}
+
+// HasBlock reports whether a block is on the main chain, a side branch, or
+// in the orphan pool
+func (bc *Blockchain) HasBlock(hash string) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.knownBlock(hash)
+}
+
+// knownBlock reports whether a block is on the main chain, a side branch, or
+// in the orphan pool
+func (bc *Blockchain) knownBlock(hash string) bool {
+	if _, ok := bc.index.heightByHash[hash]; ok {
+		return true
+	}
+	if _, ok := bc.tree.side[hash]; ok {
+		return true
+	}
+	_, ok := bc.tree.orphans[hash]
+	return ok
+}
+
+// findBlock returns a block of the main chain or a side branch, or nil
+func (bc *Blockchain) findBlock(hash string) *block.Block {
+	if height, ok := bc.index.heightByHash[hash]; ok {
+		return bc.Blocks[height]
+	}
+	return bc.tree.side[hash]
+}
+
+// reorganize makes the side branch ending at tip the main chain. A branch
+// block that fails validation is dropped with its descendants, leaving the
+// chain unchanged.
+func (bc *Blockchain) reorganize(tip *block.Block) error {
+	var branch []*block.Block
+	fork := int64(-1)
+	for b := tip; ; {
+		branch = append(branch, b)
+		if height, ok := bc.index.heightByHash[b.PrevHash]; ok {
+			fork = height
+			break
+		}
+		parent, ok := bc.tree.side[b.PrevHash]
+		if !ok {
+			bc.dropSide(branch)
+			return fmt.Errorf("%w: side branch of block #%d lost its link to the main chain", ErrInvalidChain, tip.Index)
+		}
+		b = parent
+	}
+	slices.Reverse(branch)
+
+	failed, err := bc.switchBranch(fork, branch)
+	if err != nil {
+		if failed < len(branch) {
+			bc.dropSide(branch[failed:])
+			return fmt.Errorf("side branch block #%d: %w", branch[failed].Index, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// switchBranch replaces the main chain above the block at height fork with
+// branch. The UTXO set is rolled back to fork with the undo data of the blocks
+// it detaches, rather than rebuilt from genesis, and branch is validated in
+// full as it is applied. On error the chain is unchanged, and the returned
+// index is that of the branch block that failed (len(branch) if none did).
+func (bc *Blockchain) switchBranch(fork int64, branch []*block.Block) (int, error) {
+	utxo := bc.UTXOSet.Copy()
+	for height := len(bc.Blocks) - 1; height > int(fork); height-- {
+		utxo.RevertDelta(bc.tree.undo[bc.Blocks[height].Hash])
+	}
+	newBlocks := append(bc.Blocks[:fork+1:fork+1], branch...)
+
+	// With dynamic difficulty the branch's own timestamps set what its blocks
+	// must meet; retargets at or below the fork came from shared blocks
+	schedule, difficulty := bc.DifficultySchedule(), bc.Difficulty
+	restore := func() {
+		bc.setSchedule(schedule)
+		bc.Difficulty = difficulty
+	}
+	if bc.options.UseDynamicDifficulty {
+		bc.setSchedule(scheduleUpTo(schedule, fork+1))
+	}
+
+	// A long branch, such as a synced chain, is checked in parallel first
+	for _, b := range branch {
+		bc.ConfigureBlock(b)
+	}
+	pre := bc.prevalidate(branch, utxo)
+	utxo.Sigs = pre.signatures()
+	defer func() { utxo.Sigs = nil }()
+
+	deltas := make([]*transaction.UTXODelta, len(branch))
+	for i, b := range branch {
+		bc.atHeight(utxo, b.Index)
+		deltas[i] = utxo.ComputeDelta(b.Transactions)
+		if err := bc.checkBlock(b, newBlocks[:b.Index], utxo, pre); err != nil {
+			restore()
+			return i, err
+		}
+		bc.retarget(newBlocks[:b.Index+1])
+	}
+
+	if bc.store != nil {
+		if err := bc.store.ReplaceChain(newBlocks); err != nil {
+			restore()
+			return len(branch), fmt.Errorf("%w: %v", ErrPersistFailed, err)
+		}
+	}
+
+	// Only a switch detaching blocks is a reorg, whether from a side branch
+	// or an adopted chain
+	if int(fork) < len(bc.Blocks)-1 {
+		bc.tree.reorgs++
+	}
+	for _, b := range bc.Blocks[fork+1:] {
+		bc.tree.side[b.Hash] = b
+		delete(bc.tree.undo, b.Hash)
+	}
+	for i, b := range branch {
+		delete(bc.tree.side, b.Hash)
+		bc.tree.removeOrphan(b.Hash)
+		bc.tree.undo[b.Hash] = deltas[i]
+	}
+	bc.atHeight(utxo, int64(len(newBlocks)))
+	bc.Blocks = newBlocks
+	bc.UTXOSet = utxo
+	bc.index = buildIndex(newBlocks)
+	if bc.options.UseDynamicDifficulty {
+		bc.Difficulty = bc.scheduledDifficulty(int64(len(newBlocks)))
+	}
+	bc.pruneTree()
+	return len(branch), nil
+}
+
+// dropSide removes blocks from the side branches, along with every side
+// block descending from them
+func (bc *Blockchain) dropSide(blocks []*block.Block) {
+	dropped := make(map[string]bool)
+	for _, b := range blocks {
+		delete(bc.tree.side, b.Hash)
+		dropped[b.Hash] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for hash, b := range bc.tree.side {
+			if dropped[b.PrevHash] {
+				delete(bc.tree.side, hash)
+				dropped[hash] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// pruneTree drops side blocks and orphans MaxReorgDepth or more below the
+// tip. Undo data is kept for every main-chain block, so ReplaceChain can roll
+// back to a fork at any depth.
+func (bc *Blockchain) pruneTree() {
+	floor := bc.Blocks[len(bc.Blocks)-1].Index - MaxReorgDepth
+	if floor < 0 {
+		return
+	}
+	for hash, b := range bc.tree.side {
+		if b.Index <= floor {
+			delete(bc.tree.side, hash)
+		}
+	}
+	for hash, b := range bc.tree.orphans {
+		if b.Index <= floor {
+			bc.tree.removeOrphan(hash)
+		}
+	}
+}
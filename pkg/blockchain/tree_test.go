@@ -0,0 +1,263 @@
+package blockchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mineOn mines a block paying value to miner on top of parent
+func mineOn(bc *Blockchain, parent *block.Block, miner string, value int64) *block.Block {
+	height := parent.Index + 1
+	coinbase := transaction.NewCoinbaseTransaction(miner, value, height)
+	b := block.NewBlock(height, []*transaction.Transaction{coinbase}, parent.Hash, bc.Difficulty, miner,
+		block.WithMerkleTree(bc.Options().UseMerkleTree))
+	mineForTest(bc, b)
+	return b
+}
+
+func TestProcessBlockReorganizesToLongerBranch(t *testing.T) {
+	bc := NewBlockchain(1)
+	genesis := bc.GetLatestBlock()
+	for i := 0; i < 2; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "honest")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	// A competing branch from genesis stays on the side until it is longer
+	branch := []*block.Block{mineOn(bc, genesis, "rival", BaseSubsidy)}
+	for i := 0; i < 2; i++ {
+		branch = append(branch, mineOn(bc, branch[i], "rival", BaseSubsidy))
+	}
+	for _, b := range branch[:2] {
+		status, reorg, err := bc.ProcessBlock(b)
+		if err != nil || status != BlockSideBranch || reorg != nil {
+			t.Fatalf("Expected block #%d on a side branch, got %v, %v, %v", b.Index, status, reorg, err)
+		}
+	}
+	if bc.GetLatestBlock().MinerID != "honest" || bc.TreeStats().SideBlocks != 2 {
+		t.Fatalf("The main chain should be unchanged, stats %+v", bc.TreeStats())
+	}
+
+	status, reorg, err := bc.ProcessBlock(branch[2])
+	if err != nil || status != BlockReorganized {
+		t.Fatalf("Expected a reorg, got %v, %v", status, err)
+	}
+	if reorg.Base.Hash != genesis.Hash || len(reorg.Detached) != 2 || len(reorg.Attached) != 3 {
+		t.Errorf("Unexpected reorg: base #%d, %d detached, %d attached", reorg.Base.Index, len(reorg.Detached), len(reorg.Attached))
+	}
+	if bc.GetLength() != 4 || bc.GetLatestBlock().Hash != branch[2].Hash {
+		t.Fatalf("Expected the branch as the main chain")
+	}
+	if got := bc.UTXOSet.GetBalance("honest"); got != 0 {
+		t.Errorf("Detached coinbases should be rolled back, honest still has %d", got)
+	}
+	if got := bc.UTXOSet.GetBalance("rival"); got != 3*BaseSubsidy {
+		t.Errorf("Expected rival to hold %d, got %d", 3*BaseSubsidy, got)
+	}
+	if stats := bc.TreeStats(); stats.SideBlocks != 2 || stats.Reorgs != 1 {
+		t.Errorf("Detached blocks should become a side branch, stats %+v", stats)
+	}
+
+	// The detached branch can take the chain back once it grows
+	if bc.GetBlockByHash(reorg.Detached[1].Hash) != nil {
+		t.Fatal("Detached blocks should not be found on the main chain")
+	}
+	next := mineOn(bc, reorg.Detached[1], "honest", BaseSubsidy)
+	if status, _, err := bc.ProcessBlock(next); err != nil || status != BlockSideBranch {
+		t.Fatalf("Expected the old branch to stay on the side at equal length, got %v, %v", status, err)
+	}
+	status, reorg, err = bc.ProcessBlock(mineOn(bc, next, "honest", BaseSubsidy))
+	if err != nil || status != BlockReorganized || len(reorg.Detached) != 3 {
+		t.Fatalf("Expected a reorg back to the old branch, got %v, %+v, %v", status, reorg, err)
+	}
+	if got := bc.UTXOSet.GetBalance("rival"); got != 0 {
+		t.Errorf("Expected rival's coinbases rolled back, got %d", got)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Chain invalid after reorgs: %v", err)
+	}
+}
+
+func TestProcessBlockConnectsOrphans(t *testing.T) {
+	bc := NewBlockchain(1)
+	first := mineOn(bc, bc.GetLatestBlock(), "miner1", BaseSubsidy)
+	second := mineOn(bc, first, "miner1", BaseSubsidy)
+
+	status, _, err := bc.ProcessBlock(second)
+	if !errors.Is(err, ErrOrphanBlock) || status != BlockOrphaned || bc.TreeStats().Orphans != 1 {
+		t.Fatalf("Expected an orphan, got %v, %v", status, err)
+	}
+	if !errors.Is(err, ErrInvalidPrevHash) {
+		t.Error("ErrOrphanBlock should wrap ErrInvalidPrevHash")
+	}
+
+	status, reorg, err := bc.ProcessBlock(first)
+	if err != nil || status != BlockExtended || reorg != nil {
+		t.Fatalf("Expected the parent to extend the chain, got %v, %v, %v", status, reorg, err)
+	}
+	if bc.GetLength() != 3 || bc.GetLatestBlock().Hash != second.Hash || bc.TreeStats().Orphans != 0 {
+		t.Errorf("Expected the orphan connected, length %d, stats %+v", bc.GetLength(), bc.TreeStats())
+	}
+}
+
+func TestOrphanPoolRejectsBlocksBelowTheRequiredDifficulty(t *testing.T) {
+	bc := NewBlockchain(2)
+	parent := mineOn(bc, bc.GetLatestBlock(), "miner1", BaseSubsidy)
+
+	// An orphan claiming difficulty 0 costs no work at all
+	cheap := block.NewBlock(2, []*transaction.Transaction{transaction.NewCoinbaseTransaction("spammer", BaseSubsidy, 2)},
+		parent.Hash, 0, "spammer")
+	cheap.Hash = cheap.CalculateHash()
+	status, _, err := bc.ProcessBlock(cheap)
+	if !errors.Is(err, ErrOrphanTooEasy) || !errors.Is(err, ErrInsufficientDifficulty) || status != BlockRejected {
+		t.Fatalf("Expected ErrOrphanTooEasy, got %v, %v", status, err)
+	}
+	if bc.HasBlock(cheap.Hash) || bc.TreeStats().Orphans != 0 {
+		t.Error("The cheap orphan should not be kept")
+	}
+
+	honest := mineOn(bc, parent, "miner1", BaseSubsidy)
+	if status, _, err := bc.ProcessBlock(honest); status != BlockOrphaned {
+		t.Fatalf("Expected an orphan at the required difficulty kept, got %v, %v", status, err)
+	}
+}
+
+func TestOrphanPoolEvictsOldestOverBudget(t *testing.T) {
+	src := NewBlockchain(1)
+	blocks := []*block.Block{mineOn(src, src.GetLatestBlock(), "miner1", BaseSubsidy)}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, mineOn(src, blocks[i], "miner1", BaseSubsidy))
+	}
+
+	// Room for the two newest orphans only
+	budget := blockBytes(blocks[2]) + blockBytes(blocks[3])
+	bc := NewBlockchainFromBlocks(src.GetBlocks(), 1, WithMaxOrphanBytes(budget))
+	for _, b := range blocks[1:] {
+		if status, _, err := bc.ProcessBlock(b); status != BlockOrphaned {
+			t.Fatalf("Expected block #%d orphaned, got %v, %v", b.Index, status, err)
+		}
+	}
+	stats := bc.TreeStats()
+	if stats.Orphans != 2 || stats.OrphanBytes != budget || bc.HasBlock(blocks[1].Hash) {
+		t.Fatalf("Expected the oldest orphan evicted, stats %+v", stats)
+	}
+
+	// The evicted block must arrive again before its descendants connect
+	bc.ProcessBlock(blocks[0])
+	if bc.GetLength() != 2 || bc.TreeStats().Orphans != 2 {
+		t.Fatalf("Expected the orphans to keep waiting, length %d, stats %+v", bc.GetLength(), bc.TreeStats())
+	}
+	bc.ProcessBlock(blocks[1])
+	if stats := bc.TreeStats(); bc.GetLength() != 5 || stats.Orphans != 0 || stats.OrphanBytes != 0 {
+		t.Errorf("Expected every orphan connected, length %d, stats %+v", bc.GetLength(), stats)
+	}
+}
+
+func TestExpireOrphansDropsOnlyOlderOrphans(t *testing.T) {
+	src := NewBlockchain(1)
+	blocks := []*block.Block{mineOn(src, src.GetLatestBlock(), "miner1", BaseSubsidy)}
+	for i := 0; i < 2; i++ {
+		blocks = append(blocks, mineOn(src, blocks[i], "miner1", BaseSubsidy))
+	}
+	bc := NewBlockchainFromBlocks(src.GetBlocks(), 1)
+	bc.ProcessBlock(blocks[1])
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond)
+	bc.ProcessBlock(blocks[2])
+
+	if n := bc.ExpireOrphans(cutoff); n != 1 || bc.HasBlock(blocks[1].Hash) || !bc.HasBlock(blocks[2].Hash) {
+		t.Fatalf("Expected only the older orphan dropped, dropped %d, stats %+v", n, bc.TreeStats())
+	}
+	if n := bc.ExpireOrphans(cutoff); n != 0 {
+		t.Errorf("Expected nothing more to drop, dropped %d", n)
+	}
+	if n := bc.ExpireOrphans(time.Now()); n != 1 || bc.TreeStats().Orphans != 0 || bc.TreeStats().OrphanBytes != 0 {
+		t.Errorf("Expected the newer orphan dropped, dropped %d, stats %+v", n, bc.TreeStats())
+	}
+}
+
+func TestProcessBlockDropsInvalidBranch(t *testing.T) {
+	bc := NewBlockchain(1)
+	genesis := bc.GetLatestBlock()
+	if err := bc.AddBlock(createValidBlock(bc, "honest")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+
+	// The branch's second block pays 100 subsidies, which only the UTXO
+	// replay of a reorg can catch
+	first := mineOn(bc, genesis, "attacker", BaseSubsidy)
+	if status, _, err := bc.ProcessBlock(first); err != nil || status != BlockSideBranch {
+		t.Fatalf("Expected a side block, got %v, %v", status, err)
+	}
+	status, _, err := bc.ProcessBlock(mineOn(bc, first, "attacker", 100*BaseSubsidy))
+	if !errors.Is(err, ErrExcessCoinbase) || status != BlockRejected {
+		t.Fatalf("Expected ErrExcessCoinbase, got %v, %v", status, err)
+	}
+	if bc.GetLength() != 2 || bc.GetLatestBlock().MinerID != "honest" {
+		t.Error("The main chain should be unchanged")
+	}
+	if stats := bc.TreeStats(); stats.SideBlocks != 1 || stats.Reorgs != 0 {
+		t.Errorf("Only the invalid block should be dropped, stats %+v", stats)
+	}
+	if got := bc.UTXOSet.GetBalance("honest"); got != BaseSubsidy {
+		t.Errorf("Expected honest to keep %d, got %d", BaseSubsidy, got)
+	}
+}
+
+func TestReplaceChainRollsBackOnlyTheDivergentBlocks(t *testing.T) {
+	alice, _ := transaction.GenerateKeyPair()
+	bc := NewBlockchain(1)
+	funding := transaction.NewCoinbaseTransaction(alice.GetPublicKeyHex(), BaseSubsidy, 1)
+	b1 := bc.CreateBlock([]*transaction.Transaction{funding}, "miner1")
+	mineForTest(bc, b1)
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	rival := NewBlockchainFromBlocks(bc.GetBlocks(), 1)
+
+	// Our chain spends the funding; the longer rival chain does not
+	addSpendBlock(t, bc, funding.ID, 0, alice.GetPrivateKeyHex(), []transaction.TxOutput{
+		{Value: BaseSubsidy, ScriptPubKey: "bob"},
+	})
+	for i := 0; i < 3; i++ {
+		if err := rival.AddBlock(createValidBlock(rival, "rival")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+
+	// An output only our UTXO set holds shows the shared blocks are not replayed
+	bc.UTXOSet.AddUTXO("marker", 0, 1, "nobody")
+	if err := bc.ReplaceChain(rival.GetBlocks()); err != nil {
+		t.Fatalf("Failed to replace chain: %v", err)
+	}
+	if !bc.UTXOSet.HasUTXO("marker", 0) {
+		t.Error("Expected the UTXO set rolled back, not rebuilt from genesis")
+	}
+	bc.UTXOSet.RemoveUTXO("marker", 0)
+
+	if !bc.UTXOSet.HasUTXO(funding.ID, 0) || bc.UTXOSet.GetBalance("bob") != 0 {
+		t.Error("The detached spend should be undone")
+	}
+	rebuilt := NewBlockchainFromBlocks(rival.GetBlocks(), 1)
+	if d := DiffSnapshots(bc.Snapshot(), rebuilt.Snapshot()); !d.Empty() {
+		t.Errorf("Expected the UTXO set of a full rebuild, got %+v", d)
+	}
+	if stats := bc.TreeStats(); stats.SideBlocks != 1 || stats.Reorgs != 1 {
+		t.Errorf("Expected the detached block on a side branch and one reorg, stats %+v", stats)
+	}
+
+	// Adopting a chain that only extends ours is not a reorg
+	if err := rival.AddBlock(createValidBlock(rival, "rival")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	if err := bc.ReplaceChain(rival.GetBlocks()); err != nil {
+		t.Fatalf("Failed to replace chain: %v", err)
+	}
+	if stats := bc.TreeStats(); stats.Reorgs != 1 {
+		t.Errorf("Expected an extension not counted as a reorg, stats %+v", stats)
+	}
+}
@@ -0,0 +1,86 @@
+// Package attack runs a malicious miner for testing purposes. It is the attack
+// command of the blockchain binary and the whole of the fakeminer binary.
+package attack
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Command runs a malicious miner
+var Command = cli.Command{Name: "attack", Summary: "Run a malicious miner that attacks its peers", Run: run}
+
+func run(ctx *cli.Context, args []string) {
+	// Parse command line arguments
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	common := cli.AddCommonFlags(fs)
+	id := fs.String("id", "", "Miner ID")
+	address := fs.String("address", "", "Listen address (e.g., localhost:8001)")
+	peers := fs.String("peers", "", "Comma-separated list of peer addresses")
+	difficulty := fs.Int("difficulty", 4, "Mining difficulty")
+	maliciousType := fs.String("type", "invalid_pow", "Type of malicious behavior: invalid_pow, invalid_hash, invalid_prev_hash, fake_length, oversized, tx_flood, low_difficulty, invalid_merkle, coinbase_inflation, excess_coinbase, missing_coinbase, duplicate_tx, double_spend, future_timestamp, selfish")
+
+	ctx.Parse(fs, args)
+
+	if *id == "" || *address == "" {
+		fmt.Printf("Usage: %s -id <id> -address <address> -type <type> [-peers <peers>] [-difficulty <n>] [-chain-params <file>]\n", ctx.Prog)
+		fmt.Println()
+		fmt.Println("Malicious types:")
+		fmt.Println("  invalid_pow        - Creates blocks that don't satisfy PoW")
+		fmt.Println("  invalid_hash       - Creates blocks with incorrect hash")
+		fmt.Println("  invalid_prev_hash  - Creates blocks with wrong previous hash")
+		fmt.Println("  fake_length        - Advertises an inflated chain length padded with unmined blocks")
+		fmt.Println("  oversized          - Floods peers with huge block payloads and deeply nested JSON")
+		fmt.Println("  tx_flood           - Mines to its own keys, then floods peers with valid minimum-fee transactions")
+		fmt.Println("  low_difficulty     - Claims difficulty 1 on its blocks, whatever the network requires")
+		fmt.Println("  invalid_merkle     - Swaps a block's transactions after mining, leaving a stale Merkle root")
+		fmt.Println("  coinbase_inflation - Mines a private branch paying itself 100x the subsidy, then publishes it once longer")
+		fmt.Println("  excess_coinbase    - Pushes blocks whose coinbase pays 100x the subsidy")
+		fmt.Println("  missing_coinbase   - Pushes blocks without a coinbase transaction")
+		fmt.Println("  duplicate_tx       - Mines to its own keys, then pushes blocks holding one transaction twice")
+		fmt.Println("  double_spend       - Mines to its own keys, then pushes blocks spending one output twice")
+		fmt.Println("  future_timestamp   - Pushes blocks dated a day ahead of its clock")
+		fmt.Println("  selfish            - Withholds the blocks it finds, releasing them when honest miners come within one")
+		os.Exit(1)
+	}
+	defer common.OpenLog()()
+
+	// Follow the same consensus params as the miners under attack
+	params := common.Params(*id)
+	peerList := cli.ParsePeers(*peers)
+
+	// Create malicious miner
+	miner := network.NewMaliciousMiner(*id, *address, *difficulty, peerList, *maliciousType,
+		network.WithChainOptions(blockchain.WithParams(params)))
+
+	miner.SetBlockCallback(func(b *block.Block) {
+		log.Printf("[MALICIOUS %s] Attempted to add block: #%d", *id, b.Index)
+	})
+
+	err := miner.Start()
+	if err != nil {
+		logging.Fatalf("Failed to start malicious miner: %v", err)
+	}
+
+	// Sync with peers
+	if len(peerList) > 0 {
+		miner.SyncWithAllPeers()
+	}
+
+	// Start mining
+	miner.StartMining()
+
+	log.Printf("[MALICIOUS %s] Running with type: %s", *id, *maliciousType)
+
+	// Wait for interrupt
+	cli.WaitForSignal()
+
+	miner.Stop()
+}
@@ -0,0 +1,239 @@
+// Package cli holds the bootstrap shared by the subcommands of the blockchain
+// binary: dispatching, the configuration file, logging, chain params, peer
+// lists, and credentials. Each subcommand lives in a package of its own under
+// pkg/cli; the standalone miner, client, fakeminer, feesim, spvnode, export,
+// and stress binaries run the same commands.
+package cli
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Environment variables read by every command
+const (
+	ConfigEnv  = "BLOCKCHAIN_CONFIG"   // Configuration file, when -config is not given
+	NetworkEnv = "BLOCKCHAIN_NETWORK"  // Network of the configuration file to use, when -network is not given
+	TokenEnv   = "BLOCKCHAIN_TOKEN"    // API token presented to miners that restrict RPC access
+	KeyFileEnv = "BLOCKCHAIN_KEY_FILE" // File holding a hex private key to sign RPC calls with
+	TLSCAEnv   = "BLOCKCHAIN_TLS_CA"   // CA certificates of miners served over TLS; set to dial miners over TLS
+	TLSCertEnv = "BLOCKCHAIN_TLS_CERT" // Client certificate presented to miners over TLS
+	TLSKeyEnv  = "BLOCKCHAIN_TLS_KEY"  // Private key of the client certificate
+)
+
+// Command is a subcommand of the blockchain binary
+type Command struct {
+	Name    string // As typed after the binary's name
+	Summary string // One line for the command list
+	Run     func(ctx *Context, args []string)
+}
+
+// Context is what a running command shares with the others
+type Context struct {
+	Prog   string // How the command was invoked, for usage lines: "blockchain node", or "miner" standalone
+	Name   string // The command's name, which is also its section of the configuration file
+	Config *Config
+}
+
+// Parse sets the flags of fs from the configuration file, then from args,
+// which take precedence. Like a flag.ExitOnError set, it exits on errors.
+func (c *Context) Parse(fs *flag.FlagSet, args []string) {
+	if err := c.Config.Apply(fs, c.Name); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Prog, err)
+		os.Exit(2)
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+}
+
+// Main runs the command named by the first of args, after the binary's own
+// flags, the way the blockchain binary does
+func Main(prog string, args []string, cmds ...Command) {
+	fs := flag.NewFlagSet(prog, flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(ConfigEnv), "JSON, YAML, or TOML file with flag values for every command (default: $"+ConfigEnv+")")
+	network := fs.String("network", os.Getenv(NetworkEnv), "Network of the configuration file whose values to use (default: $"+NetworkEnv+", or the file's network key)")
+	fs.Usage = func() { printCommands(prog, cmds) }
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || fs.Arg(0) == "help" {
+		printCommands(prog, cmds)
+		os.Exit(1)
+	}
+	for _, cmd := range cmds {
+		if cmd.Name == fs.Arg(0) {
+			run(prog+" "+cmd.Name, cmd, *configPath, *network, fs.Args()[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n\n", prog, fs.Arg(0))
+	printCommands(prog, cmds)
+	os.Exit(1)
+}
+
+// Standalone runs cmd as a binary of its own, reading the configuration file
+// and network named by the environment
+func Standalone(prog string, cmd Command, args []string) {
+	run(prog, cmd, os.Getenv(ConfigEnv), os.Getenv(NetworkEnv), args)
+}
+
+func run(prog string, cmd Command, configPath, network string, args []string) {
+	config, err := LoadConfig(configPath, network)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", prog, err)
+		os.Exit(2)
+	}
+	cmd.Run(&Context{Prog: prog, Name: cmd.Name, Config: config}, args)
+}
+
+func printCommands(prog string, cmds []Command) {
+	fmt.Printf("Usage: %s [-config <file>] [-network <name>] <command> [flags]\n", prog)
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, cmd := range cmds {
+		fmt.Printf("  %-8s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Println()
+	fmt.Printf("Run '%s <command> -h' for a command's flags.\n", prog)
+}
+
+// Common holds the flags shared by the commands that run a miner
+type Common struct {
+	ChainParams string     // JSON file with consensus params and rule activation heights
+	LogFile     string     // Append log output to this file instead of stderr
+	LogLevel    slog.Level // Lowest level of the messages logged
+}
+
+// AddCommonFlags defines -chain-params, -log-file, and -log-level on fs
+func AddCommonFlags(fs *flag.FlagSet) *Common {
+	c := &Common{LogLevel: slog.LevelInfo}
+	fs.StringVar(&c.ChainParams, "chain-params", "", "JSON file with consensus params and rule activation heights")
+	fs.StringVar(&c.LogFile, "log-file", "", "Append log output to this file (default: stderr)")
+	fs.Func("log-level", "Lowest level logged: debug, info, warn, or error (default: info)", func(name string) error {
+		level, err := logging.ParseLevel(name)
+		c.LogLevel = level
+		return err
+	})
+	return c
+}
+
+// OpenLog sends the log to -log-file, if set, writing the messages of
+// -log-level and above, and returns a func that closes it
+func (c *Common) OpenLog() func() {
+	if c.LogFile == "" {
+		logging.Setup(os.Stderr, c.LogLevel)
+		return func() {}
+	}
+	f, err := os.OpenFile(c.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logging.Fatalf("Failed to open log file: %v", err)
+	}
+	logging.Setup(f, c.LogLevel)
+	return func() {
+		logging.Setup(os.Stderr, c.LogLevel)
+		f.Close()
+	}
+}
+
+// Params returns the chain params in -chain-params, or the defaults. With a
+// miner ID, it logs the rule activations and scheduled changes under it.
+func (c *Common) Params(id string) *blockchain.ChainParams {
+	if c.ChainParams == "" {
+		return blockchain.DefaultChainParams()
+	}
+	params, err := blockchain.LoadChainParams(c.ChainParams)
+	if err != nil {
+		logging.Fatalf("Failed to load chain params: %v", err)
+	}
+	if id == "" {
+		return params
+	}
+	for rule, height := range params.Activations {
+		log.Printf("[%s] Rule %s activates at height %d", ShortID(id), rule, height)
+	}
+	for _, change := range params.Changes {
+		log.Printf("[%s] Parameter change %q at height %d (difficulty offset %s, subsidy %s)",
+			ShortID(id), change.Name, change.Height, optional(change.DifficultyOffset), optional(change.Subsidy))
+	}
+	if params.HalvingInterval > 0 {
+		log.Printf("[%s] Subsidy halves every %d blocks, capping the supply at %d", ShortID(id), params.HalvingInterval, params.MaxSupply())
+	}
+	if maxTxs, maxBytes := params.BlockLimits(); maxTxs > 0 || maxBytes > 0 {
+		log.Printf("[%s] Blocks limited to %d transactions and %d bytes (0 = unlimited)", ShortID(id), maxTxs, maxBytes)
+	}
+	if len(params.Checkpoints) > 0 {
+		log.Printf("[%s] Enforcing %d checkpoints, the highest at height %d",
+			ShortID(id), len(params.Checkpoints), params.LastCheckpoint(math.MaxInt64))
+	}
+	log.Printf("[%s] Chain params fingerprint %s", ShortID(id), params.Fingerprint())
+	return params
+}
+
+// optional formats a parameter a scheduled change may leave unset
+func optional[T any](v *T) string {
+	if v == nil {
+		return "unchanged"
+	}
+	return fmt.Sprint(*v)
+}
+
+// ShortID returns the first 6 characters of an ID for logging
+func ShortID(id string) string {
+	if len(id) <= 6 {
+		return id
+	}
+	return id[:6]
+}
+
+// ParsePeers turns a comma-separated list of addresses into peers named
+// peer0, peer1, and so on
+func ParsePeers(list string) []network.PeerInfo {
+	var peers []network.PeerInfo
+	if list == "" {
+		return peers
+	}
+	for i, addr := range strings.Split(list, ",") {
+		peers = append(peers, network.PeerInfo{
+			ID:      fmt.Sprintf("peer%d", i),
+			Address: strings.TrimSpace(addr),
+		})
+	}
+	return peers
+}
+
+// Credentials reads the credentials presented to miners from the environment
+func Credentials() (network.Credentials, error) {
+	cred := network.Credentials{Token: os.Getenv(TokenEnv)}
+	if path := os.Getenv(KeyFileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cred, fmt.Errorf("failed to read signing key: %v", err)
+		}
+		cred.SigningKey = strings.TrimSpace(string(data))
+	}
+	if os.Getenv(TLSCAEnv) != "" || os.Getenv(TLSCertEnv) != "" {
+		cfg, err := network.LoadTLSConfig(os.Getenv(TLSCertEnv), os.Getenv(TLSKeyEnv), os.Getenv(TLSCAEnv))
+		if err != nil {
+			return cred, err
+		}
+		cred.TLS = cfg
+	}
+	return cred, nil
+}
+
+// WaitForSignal blocks until the process is interrupted or terminated
+func WaitForSignal() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+}
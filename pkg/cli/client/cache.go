@@ -0,0 +1,67 @@
+package client
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/network"
+	"blockchain/pkg/storage"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheEnv names the local block cache directory; "off" disables the cache
+const cacheEnv = "BLOCKCHAIN_CACHE"
+
+// defaultCacheDir returns the block cache directory, or "" if it is disabled
+func defaultCacheDir() string {
+	if dir := os.Getenv(cacheEnv); dir != "" {
+		if dir == "off" {
+			return ""
+		}
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".blockchain", "cache")
+}
+
+// fetchChain downloads a miner's chain, reusing the blocks in the local cache
+// and fetching only those after its tip. It returns the chain and how many
+// blocks were downloaded. A cache that cannot be used is reported on stderr
+// and the whole chain is downloaded instead.
+func fetchChain(minerAddr string) ([]*block.Block, int) {
+	cred, err := cli.Credentials()
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	client := &network.Client{Auth: cred}
+
+	var cache *storage.BlockCache
+	if dir := defaultCacheDir(); dir != "" {
+		if cache, err = storage.OpenBlockCache(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: block cache disabled: %v\n", err)
+		}
+	}
+	if cache == nil {
+		blocks, err := client.GetChain(minerAddr)
+		if err != nil {
+			outputError(fmt.Sprintf("failed to get blockchain: %v", err))
+			os.Exit(1)
+		}
+		return blocks, len(blocks)
+	}
+
+	blocks, downloaded, err := client.GetChainCached(minerAddr, cache)
+	if err != nil && blocks == nil {
+		outputError(fmt.Sprintf("failed to get blockchain: %v", err))
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to update block cache: %v\n", err)
+	}
+	return blocks, downloaded
+}
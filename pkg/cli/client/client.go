@@ -0,0 +1,1607 @@
+// Package client is the blockchain client: wallets, transfers, and queries
+// against miners, all output as JSON. It is the wallet command of the
+// blockchain binary and the whole of the standalone client binary.
+package client
+
+import (
+	"blockchain/pkg/analysis"
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/monitor"
+	"blockchain/pkg/network"
+	"blockchain/pkg/policy"
+	"blockchain/pkg/transaction"
+	"blockchain/pkg/wallet"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/rpc"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// WalletOutput represents a wallet in JSON format
+type WalletOutput struct {
+	Address    string `json:"address"`     // Public key (hex)
+	PrivateKey string `json:"private_key"` // Private key (hex)
+	CreatedAt  string `json:"created_at"`  // Timestamp
+}
+
+// HDWalletOutput represents an HD wallet seed and its first derived addresses
+type HDWalletOutput struct {
+	Seed      string          `json:"seed"` // Hex seed; back it up to recover every address
+	Addresses []HDAddressInfo `json:"addresses"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// HDAddressInfo is one derived key of an HD wallet
+type HDAddressInfo struct {
+	Index      uint32 `json:"index"`
+	Address    string `json:"address"`
+	PrivateKey string `json:"private_key"`
+}
+
+// ClusterAnalysisOutput represents address clusters in JSON format
+type ClusterAnalysisOutput struct {
+	Heuristics     []analysis.Heuristic `json:"heuristics"`
+	AddressCount   int                  `json:"address_count"`
+	ClusterCount   int                  `json:"cluster_count"`
+	LargestCluster int                  `json:"largest_cluster"`
+	Clusters       []*analysis.Cluster  `json:"clusters"`
+}
+
+// CoinJoinOutput represents the result of a coinjoin round in JSON format
+type CoinJoinOutput struct {
+	Success      bool   `json:"success"`
+	RoundID      string `json:"round_id"`
+	TxID         string `json:"txid,omitempty"`
+	Participants int    `json:"participants"`
+	Denomination int64  `json:"denomination"`
+	Error        string `json:"error,omitempty"`
+}
+
+// BlacklistOutput represents a miner's blacklist in JSON format
+type BlacklistOutput struct {
+	Addresses    []string `json:"addresses"`
+	Transactions []string `json:"transactions"`
+	Purged       int      `json:"purged_pending_txs"`
+}
+
+// BlockchainStatusOutput represents blockchain status in JSON format
+type BlockchainStatusOutput struct {
+	ChainLength       int                  `json:"chain_length"`
+	Difficulty        int                  `json:"difficulty"`
+	LatestBlockHash   string               `json:"latest_block_hash"`
+	LatestBlockIndex  int64                `json:"latest_block_index"`
+	LatestBlockMiner  string               `json:"latest_block_miner"`
+	LatestBlockTime   int64                `json:"latest_block_time"`
+	TotalTransactions int                  `json:"total_transactions"`
+	DownloadedBlocks  int                  `json:"downloaded_blocks"` // Blocks not already in the local cache
+	MinerStatus       *network.StatusReply `json:"miner_status,omitempty"`
+	Blocks            []BlockOutput        `json:"blocks,omitempty"`
+}
+
+// BlockOutput represents a block in JSON format
+type BlockOutput struct {
+	Index        int64               `json:"index"`
+	Hash         string              `json:"hash"`
+	PrevHash     string              `json:"prev_hash"`
+	Timestamp    int64               `json:"timestamp"`
+	Nonce        int64               `json:"nonce"`
+	Difficulty   int                 `json:"difficulty"`
+	MinerID      string              `json:"miner_id"`
+	PowAlgorithm string              `json:"pow_algorithm,omitempty"`
+	Transactions []TransactionOutput `json:"transactions"`
+}
+
+// TransactionOutput represents a transaction in JSON format
+type TransactionOutput struct {
+	ID         string                 `json:"id"`
+	Inputs     []transaction.TxInput  `json:"inputs"`
+	Outputs    []transaction.TxOutput `json:"outputs"`
+	IsCoinbase bool                   `json:"is_coinbase"`
+	Memo       string                 `json:"memo,omitempty"`
+}
+
+// WalletStatusOutput represents wallet status in JSON format
+type WalletStatusOutput struct {
+	Address    string       `json:"address"`
+	Balance    int64        `json:"balance"`
+	BalanceBTC float64      `json:"balance_btc"`
+	UTXOs      []UTXOOutput `json:"utxos"`
+	UTXOCount  int          `json:"utxo_count"`
+}
+
+// UTXOOutput represents a UTXO in JSON format
+type UTXOOutput struct {
+	TxID         string  `json:"txid"`
+	OutIndex     int     `json:"out_index"`
+	Value        int64   `json:"value"`
+	ValueBTC     float64 `json:"value_btc"`
+	ScriptPubKey string  `json:"scriptpubkey"`
+}
+
+// SearchOutput represents a search result in JSON format
+type SearchOutput struct {
+	Query       string             `json:"query"`
+	Type        string             `json:"type"` // block, transaction, address, or none
+	MatchedBy   string             `json:"matched_by,omitempty"`
+	Block       *BlockOutput       `json:"block,omitempty"`
+	Transaction *TransactionOutput `json:"transaction,omitempty"`
+	Confirmed   bool               `json:"confirmed,omitempty"`
+	BlockHeight int64              `json:"block_height,omitempty"`
+	BlockHash   string             `json:"block_hash,omitempty"`
+	Address     string             `json:"address,omitempty"`
+	Balance     int64              `json:"balance,omitempty"`
+	TxCount     int                `json:"tx_count,omitempty"`
+}
+
+// SpentByOutput represents the confirmed spender of an output in JSON format
+type SpentByOutput struct {
+	TxID        string `json:"txid"`
+	OutIndex    int    `json:"vout"`
+	Spent       bool   `json:"spent"`
+	SpentBy     string `json:"spent_by,omitempty"` // Spending transaction
+	Input       *int   `json:"input,omitempty"`    // Index of the spending input
+	BlockHeight int64  `json:"block_height,omitempty"`
+	BlockHash   string `json:"block_hash,omitempty"`
+}
+
+// LeaderboardOutput represents the miner ranking over a height range in JSON format
+type LeaderboardOutput struct {
+	FromHeight int64             `json:"from_height"`
+	ToHeight   int64             `json:"to_height"`
+	Miners     []MinerStatsEntry `json:"miners"`
+}
+
+// MinerStatsEntry is one miner's row on the leaderboard
+type MinerStatsEntry struct {
+	Rank        int     `json:"rank"`
+	MinerID     string  `json:"miner_id"`
+	Blocks      int     `json:"blocks"`
+	Rewards     int64   `json:"rewards"`
+	Fees        int64   `json:"fees"`
+	FirstHeight int64   `json:"first_height"`
+	LastHeight  int64   `json:"last_height"`
+	AvgInterval float64 `json:"avg_interval_seconds"`
+}
+
+// MinerBlocksOutput represents the blocks one miner produced in JSON format
+type MinerBlocksOutput struct {
+	MinerID    string           `json:"miner_id"`
+	FromHeight int64            `json:"from_height"`
+	ToHeight   int64            `json:"to_height"`
+	Blocks     []MinedBlockInfo `json:"blocks"`
+}
+
+// MinedBlockInfo is one block of a miner's block list
+type MinedBlockInfo struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+	TxCount   int    `json:"tx_count"`
+	Reward    int64  `json:"reward"`
+}
+
+// SupplyOutput represents the coin supply and emission schedule in JSON format
+type SupplyOutput struct {
+	Height         int64             `json:"height"`
+	NextSubsidy    int64             `json:"next_subsidy"`
+	MaxSupply      *int64            `json:"max_supply"` // null if unbounded
+	Scheduled      int64             `json:"scheduled"`
+	Issued         int64             `json:"issued"`
+	Burned         int64             `json:"burned"`
+	BurnedOutputs  int               `json:"burned_outputs"`
+	Circulating    int64             `json:"circulating"`
+	CirculatingBTC float64           `json:"circulating_btc"`
+	Eras           []EmissionEraInfo `json:"eras"`
+}
+
+// EmissionEraInfo is one subsidy era of the emission schedule
+type EmissionEraInfo struct {
+	StartHeight int64  `json:"start_height"`
+	EndHeight   *int64 `json:"end_height"` // null if the era never ends
+	Subsidy     int64  `json:"subsidy"`
+	Total       *int64 `json:"total"` // null if unbounded
+	Blocks      int64  `json:"blocks_mined"`
+	Issued      int64  `json:"issued"`
+}
+
+// ErrorOutput represents an error in JSON format
+type ErrorOutput struct {
+	Error string `json:"error"`
+}
+
+// TransferOutput represents a transfer result in JSON format
+type TransferOutput struct {
+	Success       bool   `json:"success"`
+	TxID          string `json:"txid"`
+	CorrelationID string `json:"correlation_id,omitempty"` // Follow the transaction with "journey -correlation"
+	Status        string `json:"status,omitempty"`         // "pending" once accepted; check again with "tx -txid"
+	Message       string `json:"message,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Command runs a client command
+var Command = cli.Command{Name: "wallet", Summary: "Manage keys, send transactions, and query miners", Run: run}
+
+func run(ctx *cli.Context, args []string) {
+	// Define commands
+	walletCmd := flag.NewFlagSet("wallet", flag.ExitOnError)
+	walletNewCmd := flag.NewFlagSet("wallet new", flag.ExitOnError)
+	walletListCmd := flag.NewFlagSet("wallet list", flag.ExitOnError)
+	walletImportCmd := flag.NewFlagSet("wallet import", flag.ExitOnError)
+	walletExportCmd := flag.NewFlagSet("wallet export", flag.ExitOnError)
+	blockchainCmd := flag.NewFlagSet("blockchain", flag.ExitOnError)
+	balanceCmd := flag.NewFlagSet("balance", flag.ExitOnError)
+	transferCmd := flag.NewFlagSet("transfer", flag.ExitOnError)
+	clusterCmd := flag.NewFlagSet("cluster-analysis", flag.ExitOnError)
+	coinjoinCmd := flag.NewFlagSet("coinjoin", flag.ExitOnError)
+	blacklistCmd := flag.NewFlagSet("blacklist", flag.ExitOnError)
+	topCmd := flag.NewFlagSet("top", flag.ExitOnError)
+	searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
+	txGraphCmd := flag.NewFlagSet("tx-graph", flag.ExitOnError)
+	spentByCmd := flag.NewFlagSet("spent-by", flag.ExitOnError)
+	txStatusCmd := flag.NewFlagSet("tx", flag.ExitOnError)
+	proofCmd := flag.NewFlagSet("proof", flag.ExitOnError)
+	supplyCmd := flag.NewFlagSet("supply", flag.ExitOnError)
+	leaderboardCmd := flag.NewFlagSet("leaderboard", flag.ExitOnError)
+	forksCmd := flag.NewFlagSet("forks", flag.ExitOnError)
+	monitorCmd := flag.NewFlagSet("monitor", flag.ExitOnError)
+	miningCmd := flag.NewFlagSet("mining", flag.ExitOnError)
+	hashCmd := flag.NewFlagSet("hash", flag.ExitOnError)
+	peersCmd := flag.NewFlagSet("peers", flag.ExitOnError)
+	auditCmd := flag.NewFlagSet("audit", flag.ExitOnError)
+	snapshotCmd := flag.NewFlagSet("utxo-snapshot", flag.ExitOnError)
+	utxoDiffCmd := flag.NewFlagSet("utxo-diff", flag.ExitOnError)
+	upgradesCmd := flag.NewFlagSet("upgrades", flag.ExitOnError)
+	journeyCmd := flag.NewFlagSet("journey", flag.ExitOnError)
+	lightSyncCmd := flag.NewFlagSet("light-sync", flag.ExitOnError)
+
+	// Wallet command flags
+	walletHD := walletCmd.Bool("hd", false, "Generate an HD wallet seed instead of a single keypair")
+	walletSeed := walletCmd.String("seed", "", "Derive addresses from an existing HD wallet seed (hex)")
+	walletCount := walletCmd.Int("count", 5, "Number of HD addresses to derive")
+
+	// Keystore command flags
+	walletNewKeystore := walletNewCmd.String("keystore", defaultKeystorePath(), "Encrypted keystore file")
+	walletNewName := walletNewCmd.String("name", "", "Name for the new key (default: key<n>)")
+	walletListKeystore := walletListCmd.String("keystore", defaultKeystorePath(), "Encrypted keystore file")
+	walletImportKeystore := walletImportCmd.String("keystore", defaultKeystorePath(), "Encrypted keystore file")
+	walletImportName := walletImportCmd.String("name", "", "Name for the imported key (default: key<n>)")
+	walletImportFile := walletImportCmd.String("file", "", "File holding the hex private key (default: prompt)")
+	walletExportKeystore := walletExportCmd.String("keystore", defaultKeystorePath(), "Encrypted keystore file")
+	walletExportKey := walletExportCmd.String("key", "", "Name or address of the key to export")
+
+	// Blockchain command flags
+	blockchainMiner := blockchainCmd.String("miner", "localhost:8001", "Miner address")
+	blockchainDetail := blockchainCmd.Bool("detail", false, "Include detailed block information")
+	blockchainQuorum := blockchainCmd.String("quorum", "", "Only trust a chain tip agreed on by k of n miners (k/n; -miner lists the n miners)")
+
+	// Balance command flags
+	balanceMiner := balanceCmd.String("miner", "localhost:8001", "Miner address")
+	balanceAddress := balanceCmd.String("address", "", "Wallet address (public key)")
+	balanceQuorum := balanceCmd.String("quorum", "", "Only trust an answer agreed on by k of n miners (k/n; -miner lists the n miners)")
+
+	// Transfer command flags
+	transferMiner := transferCmd.String("miner", "localhost:8001", "Miner address")
+	transferFrom := transferCmd.String("from", "", "Sender's public key (address)")
+	transferPrivateKey := transferCmd.String("privkey", "", "Sender's private key")
+	transferInputs := transferCmd.String("inputs", "", "Comma-separated list of UTXOs to spend (format: txid:outindex,txid:outindex)")
+	transferOutputs := transferCmd.String("outputs", "", "Comma-separated list of outputs (format: address:amount,address:amount)")
+	transferKey := transferCmd.String("key", "", "Sign with this keystore key (name or address) instead of -privkey")
+	transferKeystore := transferCmd.String("keystore", defaultKeystorePath(), "Encrypted keystore file")
+	transferMemo := transferCmd.String("memo", "", fmt.Sprintf("Memo such as a payment reference, committed in the txid (at most %d bytes)", transaction.MaxMemoBytes))
+
+	// Cluster analysis command flags
+	clusterMiner := clusterCmd.String("miner", "localhost:8001", "Miner address")
+	clusterHeuristics := clusterCmd.String("heuristics", "multi-input,change,miner-id", "Comma-separated heuristics to apply")
+
+	// Coinjoin command flags
+	coinjoinMiner := coinjoinCmd.String("miner", "localhost:8001", "Coordinating miner address")
+	coinjoinPrivateKey := coinjoinCmd.String("privkey", "", "Private key owning the inputs")
+	coinjoinInputs := coinjoinCmd.String("inputs", "", "Comma-separated list of UTXOs to mix (format: txid:outindex)")
+	coinjoinMix := coinjoinCmd.String("mix", "", "Address receiving the mixed output")
+	coinjoinChange := coinjoinCmd.String("change", "", "Address receiving change, if inputs exceed the denomination and fee")
+	coinjoinKey := coinjoinCmd.String("key", "", "Sign with this keystore key (name or address) instead of -privkey")
+	coinjoinKeystore := coinjoinCmd.String("keystore", defaultKeystorePath(), "Encrypted keystore file")
+	// Search command flags
+	searchMiner := searchCmd.String("miner", "localhost:8001", "Miner address")
+	searchQuery := searchCmd.String("query", "", "Block height or hash, transaction ID, or address")
+	searchQuorum := searchCmd.String("quorum", "", "Only trust an answer agreed on by k of n miners (k/n; -miner lists the n miners)")
+
+	// Transaction graph command flags
+	txGraphMiner := txGraphCmd.String("miner", "localhost:8001", "Miner address")
+	txGraphTxID := txGraphCmd.String("txid", "", "Confirmed transaction to trace")
+	txGraphDepth := txGraphCmd.Int("depth", 3, "Hops to follow to ancestors and descendants (at most 32)")
+
+	// Spent-by command flags
+	spentByMiner := spentByCmd.String("miner", "localhost:8001", "Miner address")
+	spentByTxID := spentByCmd.String("txid", "", "Transaction holding the output")
+	spentByVout := spentByCmd.Int("vout", 0, "Index of the output")
+
+	// Tx status command flags
+	txStatusMiner := txStatusCmd.String("miner", "localhost:8001", "Miner address")
+	txStatusTxID := txStatusCmd.String("txid", "", "Transaction to look up (printed by transfer)")
+
+	// Proof command flags
+	proofMiner := proofCmd.String("miner", "localhost:8001", "Miner address")
+	proofTxID := proofCmd.String("txid", "", "Confirmed transaction to prove")
+
+	// Supply command flags
+	supplyMiner := supplyCmd.String("miner", "localhost:8001", "Miner address")
+	supplyQuorum := supplyCmd.String("quorum", "", "Only trust an answer agreed on by k of n miners (k/n; -miner lists the n miners)")
+
+	// Leaderboard command flags
+	leaderboardMiner := leaderboardCmd.String("miner", "localhost:8001", "Miner address")
+	leaderboardID := leaderboardCmd.String("id", "", "List the blocks of this miner ID instead of the ranking")
+	leaderboardFrom := leaderboardCmd.Int64("from", 1, "First height to count")
+	leaderboardTo := leaderboardCmd.Int64("to", -1, "Last height to count (-1: the tip)")
+
+	// Forks command flags
+	forksMiner := forksCmd.String("miner", "localhost:8001", "Miner address")
+	forksLimit := forksCmd.Int("limit", 10, "Show at most this many of the newest reports (0 = all kept)")
+
+	// Top command flags
+	topMiners := topCmd.String("miners", "localhost:8001", "Comma-separated miner addresses to monitor")
+	topInterval := topCmd.Duration("interval", 2*time.Second, "Refresh interval")
+	topBlocks := topCmd.Int("blocks", 8, "Number of recent blocks to show")
+	topOnce := topCmd.Bool("once", false, "Print a single frame and exit")
+
+	// Monitor command flags
+	monitorMiners := monitorCmd.String("miners", "localhost:8001", "Comma-separated miner addresses to watch")
+	monitorLag := monitorCmd.Int64("max-lag", 3, "Alert when a miner is more than this many blocks behind the majority (0 = off)")
+	monitorAge := monitorCmd.Duration("max-age", 10*time.Minute, "Alert when a miner's latest block is older than this (0 = off)")
+	monitorInterval := monitorCmd.Duration("interval", 30*time.Second, "Polling interval")
+	monitorWebhook := monitorCmd.String("webhook", "", "URL to POST each alert to as JSON")
+	monitorOnce := monitorCmd.Bool("once", false, "Check once, print a JSON report, and exit 2 if any miner is behind")
+
+	// Blacklist command flags
+	blacklistMiner := blacklistCmd.String("miner", "localhost:8001", "Miner address")
+	blacklistAddAddr := blacklistCmd.String("add-address", "", "Comma-separated addresses to blacklist")
+	blacklistRemoveAddr := blacklistCmd.String("remove-address", "", "Comma-separated addresses to remove from the blacklist")
+	blacklistAddTx := blacklistCmd.String("add-tx", "", "Comma-separated transaction IDs to blacklist")
+	blacklistRemoveTx := blacklistCmd.String("remove-tx", "", "Comma-separated transaction IDs to remove from the blacklist")
+
+	// Mining command flags
+	miningMiner := miningCmd.String("miner", "localhost:8001", "Miner address")
+	miningStart := miningCmd.Bool("start", false, "Start mining")
+	miningStop := miningCmd.Bool("stop", false, "Stop mining")
+
+	// Hash command flags
+	hashMiner := hashCmd.String("miner", "localhost:8001", "Miner address")
+	hashThreads := hashCmd.Int("threads", runtime.NumCPU(), "Parallel hashing workers")
+	hashBlocks := hashCmd.Int("blocks", 1, "Stop after this many accepted blocks")
+	hashRefresh := hashCmd.Duration("refresh", network.DefaultTemplateRefresh, "Fetch a new template after hashing one this long")
+
+	// Peers command flags
+	peersMiner := peersCmd.String("miner", "localhost:8001", "Miner address")
+	peersAdd := peersCmd.String("add", "", "Comma-separated peer addresses to add")
+	peersRemove := peersCmd.String("remove", "", "Comma-separated peer addresses to remove")
+	peersScores := peersCmd.Bool("scores", false, "Show each connected host's misbehavior score and ban instead")
+
+	// Audit command flags
+	auditMiner := auditCmd.String("miner", "localhost:8001", "Miner address")
+	auditCaller := auditCmd.String("caller", "", "Only show calls by this caller (e.g. token:1a2b3c4d)")
+	auditMethod := auditCmd.String("method", "", "Only show calls of this method (e.g. RPCService.SetMining)")
+	auditSince := auditCmd.Duration("since", 0, "Only show calls in this recent period (0 = all)")
+	auditLimit := auditCmd.Int("limit", 50, "Show at most this many of the newest calls (0 = all)")
+
+	// UTXO snapshot and diff command flags
+	snapshotMiner := snapshotCmd.String("miner", "localhost:8001", "Miner address")
+	snapshotOut := snapshotCmd.String("out", "", "Write the snapshot to this file (default: print it)")
+	utxoDiffA := utxoDiffCmd.String("a", "", "First UTXO set: a snapshot file or a miner address")
+	utxoDiffB := utxoDiffCmd.String("b", "", "Second UTXO set: a snapshot file or a miner address")
+
+	// Upgrades command flags
+	upgradesMiners := upgradesCmd.String("miners", "localhost:8001", "Comma-separated miner addresses to check")
+	upgradesParams := upgradesCmd.String("chain-params", "", "Chain params file the miners should run")
+	upgradesCmd.StringVar(upgradesParams, "params", "", "Alias of -chain-params")
+	upgradesName := upgradesCmd.String("name", "", "Scheduled change the miners should know of")
+
+	// Journey command flags
+	journeyMiners := journeyCmd.String("miners", "localhost:8001", "Comma-separated miner addresses whose journals to merge")
+	journeyTxID := journeyCmd.String("txid", "", "Transaction to follow")
+	journeyCorr := journeyCmd.String("correlation", "", "Correlation ID to follow (printed by transfer)")
+
+	// Light sync command flags
+	lightSyncMiner := lightSyncCmd.String("miner", "localhost:8001", "Miner address")
+	lightSyncTrusted := lightSyncCmd.String("trusted-key", "", "Hex public key whose checkpoints to trust")
+	lightSyncFile := lightSyncCmd.String("checkpoint", "", "Checkpoint file to start from (default: ask the miner)")
+
+	coinjoinTimeout := coinjoinCmd.Duration("timeout", 5*time.Minute, "How long to wait for the round to fill and complete")
+
+	if len(args) < 1 {
+		printUsage(ctx.Prog)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "wallet":
+		if len(args) > 1 {
+			switch args[1] {
+			case "new":
+				ctx.Parse(walletNewCmd, args[2:])
+				createKeystoreWallet(*walletNewKeystore, *walletNewName)
+				return
+			case "list":
+				ctx.Parse(walletListCmd, args[2:])
+				listKeystore(*walletListKeystore)
+				return
+			case "import":
+				ctx.Parse(walletImportCmd, args[2:])
+				importKey(*walletImportKeystore, *walletImportName, *walletImportFile)
+				return
+			case "export":
+				ctx.Parse(walletExportCmd, args[2:])
+				if *walletExportKey == "" {
+					outputError("key is required")
+					os.Exit(1)
+				}
+				exportKey(*walletExportKeystore, *walletExportKey)
+				return
+			}
+		}
+		ctx.Parse(walletCmd, args[1:])
+		if *walletHD || *walletSeed != "" {
+			generateHDWallet(*walletSeed, *walletCount)
+		} else {
+			generateWallet()
+		}
+
+	case "blockchain":
+		ctx.Parse(blockchainCmd, args[1:])
+		if *blockchainQuorum != "" {
+			quorumRead(*blockchainQuorum, splitAndTrim(*blockchainMiner, ","), nil, nil)
+			return
+		}
+		getBlockchainStatus(*blockchainMiner, *blockchainDetail)
+
+	case "balance":
+		ctx.Parse(balanceCmd, args[1:])
+		if *balanceAddress == "" {
+			outputError("address is required")
+			os.Exit(1)
+		}
+		if *balanceQuorum != "" {
+			quorumBalance(*balanceQuorum, splitAndTrim(*balanceMiner, ","), *balanceAddress)
+			return
+		}
+		getWalletStatus(*balanceMiner, *balanceAddress)
+
+	case "transfer":
+		ctx.Parse(transferCmd, args[1:])
+		if (*transferKey == "" && (*transferFrom == "" || *transferPrivateKey == "")) || *transferInputs == "" || *transferOutputs == "" {
+			outputError("key (or from and privkey), inputs, and outputs are required")
+			os.Exit(1)
+		}
+		from, privateKey := signingKey(*transferKeystore, *transferKey, *transferPrivateKey, *transferFrom)
+		sendTransfer(*transferMiner, from, privateKey, *transferInputs, *transferOutputs, *transferMemo)
+
+	case "coinjoin":
+		ctx.Parse(coinjoinCmd, args[1:])
+		if (*coinjoinKey == "" && *coinjoinPrivateKey == "") || *coinjoinInputs == "" || *coinjoinMix == "" {
+			outputError("key (or privkey), inputs, and mix are required")
+			os.Exit(1)
+		}
+		_, privateKey := signingKey(*coinjoinKeystore, *coinjoinKey, *coinjoinPrivateKey, "")
+		joinCoinJoin(*coinjoinMiner, privateKey, *coinjoinInputs, *coinjoinMix, *coinjoinChange, *coinjoinTimeout)
+
+	case "top":
+		ctx.Parse(topCmd, args[1:])
+		runTop(splitAndTrim(*topMiners, ","), *topInterval, *topBlocks, *topOnce)
+
+	case "monitor":
+		ctx.Parse(monitorCmd, args[1:])
+		runMonitor(splitAndTrim(*monitorMiners, ","), monitor.Thresholds{
+			MaxLag:    *monitorLag,
+			MaxTipAge: *monitorAge,
+		}, *monitorInterval, *monitorWebhook, *monitorOnce)
+
+	case "blacklist":
+		ctx.Parse(blacklistCmd, args[1:])
+		manageBlacklist(*blacklistMiner, policy.BlacklistEntries{
+			Addresses:    splitAndTrim(*blacklistAddAddr, ","),
+			Transactions: splitAndTrim(*blacklistAddTx, ","),
+		}, policy.BlacklistEntries{
+			Addresses:    splitAndTrim(*blacklistRemoveAddr, ","),
+			Transactions: splitAndTrim(*blacklistRemoveTx, ","),
+		})
+
+	case "mining":
+		ctx.Parse(miningCmd, args[1:])
+		if *miningStart == *miningStop {
+			outputError("exactly one of start or stop is required")
+			os.Exit(1)
+		}
+		setMining(*miningMiner, *miningStart)
+
+	case "hash":
+		ctx.Parse(hashCmd, args[1:])
+		if *hashThreads < 1 || *hashBlocks < 1 || *hashRefresh <= 0 {
+			outputError("threads, blocks, and refresh must be positive")
+			os.Exit(1)
+		}
+		hashForMiner(*hashMiner, *hashThreads, *hashBlocks, *hashRefresh)
+
+	case "peers":
+		ctx.Parse(peersCmd, args[1:])
+		if *peersScores {
+			showPeerScores(*peersMiner)
+		} else {
+			managePeers(*peersMiner, splitAndTrim(*peersAdd, ","), splitAndTrim(*peersRemove, ","))
+		}
+
+	case "audit":
+		ctx.Parse(auditCmd, args[1:])
+		var since int64
+		if *auditSince > 0 {
+			since = time.Now().Add(-*auditSince).UnixNano()
+		}
+		queryAuditLog(*auditMiner, network.AuditQueryArgs{
+			Caller: *auditCaller,
+			Method: *auditMethod,
+			Since:  since,
+			Limit:  *auditLimit,
+		})
+
+	case "search":
+		ctx.Parse(searchCmd, args[1:])
+		if *searchQuery == "" {
+			outputError("query is required")
+			os.Exit(1)
+		}
+		if *searchQuorum != "" {
+			quorumSearch(*searchQuorum, splitAndTrim(*searchMiner, ","), *searchQuery)
+			return
+		}
+		search(*searchMiner, *searchQuery)
+
+	case "tx-graph":
+		ctx.Parse(txGraphCmd, args[1:])
+		if *txGraphTxID == "" {
+			outputError("txid is required")
+			os.Exit(1)
+		}
+		traceTransaction(*txGraphMiner, *txGraphTxID, *txGraphDepth)
+
+	case "spent-by":
+		ctx.Parse(spentByCmd, args[1:])
+		if *spentByTxID == "" {
+			outputError("txid is required")
+			os.Exit(1)
+		}
+		spentBy(*spentByMiner, *spentByTxID, *spentByVout)
+
+	case "tx":
+		ctx.Parse(txStatusCmd, args[1:])
+		if *txStatusTxID == "" {
+			outputError("txid is required")
+			os.Exit(1)
+		}
+		txStatus(*txStatusMiner, *txStatusTxID)
+
+	case "proof":
+		ctx.Parse(proofCmd, args[1:])
+		if *proofTxID == "" {
+			outputError("txid is required")
+			os.Exit(1)
+		}
+		merkleProof(*proofMiner, *proofTxID)
+
+	case "leaderboard":
+		ctx.Parse(leaderboardCmd, args[1:])
+		if *leaderboardID != "" {
+			minerBlocks(*leaderboardMiner, *leaderboardID, *leaderboardFrom, *leaderboardTo)
+			return
+		}
+		leaderboard(*leaderboardMiner, *leaderboardFrom, *leaderboardTo)
+
+	case "forks":
+		ctx.Parse(forksCmd, args[1:])
+		forkReports(*forksMiner, *forksLimit)
+
+	case "supply":
+		ctx.Parse(supplyCmd, args[1:])
+		if *supplyQuorum != "" {
+			quorumSupply(*supplyQuorum, splitAndTrim(*supplyMiner, ","))
+			return
+		}
+		getSupply(*supplyMiner)
+
+	case "utxo-snapshot":
+		ctx.Parse(snapshotCmd, args[1:])
+		saveSnapshot(*snapshotMiner, *snapshotOut)
+
+	case "utxo-diff":
+		ctx.Parse(utxoDiffCmd, args[1:])
+		if *utxoDiffA == "" || *utxoDiffB == "" {
+			outputError("both -a and -b are required")
+			os.Exit(1)
+		}
+		diffSnapshots(*utxoDiffA, *utxoDiffB)
+
+	case "upgrades":
+		ctx.Parse(upgradesCmd, args[1:])
+		checkUpgrades(splitAndTrim(*upgradesMiners, ","), *upgradesParams, *upgradesName)
+
+	case "journey":
+		ctx.Parse(journeyCmd, args[1:])
+		if *journeyTxID == "" && *journeyCorr == "" {
+			outputError("-txid or -correlation is required")
+			os.Exit(1)
+		}
+		txJourney(splitAndTrim(*journeyMiners, ","), *journeyTxID, *journeyCorr)
+
+	case "light-sync":
+		ctx.Parse(lightSyncCmd, args[1:])
+		if *lightSyncTrusted == "" {
+			outputError("trusted-key is required")
+			os.Exit(1)
+		}
+		lightSync(*lightSyncMiner, *lightSyncTrusted, *lightSyncFile)
+
+	case "cluster-analysis":
+		ctx.Parse(clusterCmd, args[1:])
+		runClusterAnalysis(*clusterMiner, *clusterHeuristics)
+
+	default:
+		printUsage(ctx.Prog)
+		os.Exit(1)
+	}
+}
+
+// printUsage prints the commands, each invoked as prog
+func printUsage(prog string) {
+	usage := `Blockchain Client - JSON CLI Tool
+
+Usage:
+  client wallet                                    Generate a new wallet (keypair)
+  client wallet new [-name <name>] [-keystore <file>]  Generate a keypair into the encrypted keystore
+  client wallet list [-keystore <file>]            List the keystore's key names and addresses
+  client wallet import [-name <name>] [-file <file>] [-keystore <file>]  Encrypt an existing private key into the keystore
+  client wallet export -key <name|address> [-keystore <file>]  Decrypt and print a keystore key
+  client blockchain [-miner <address>] [-detail]  Get blockchain status and parameters
+  client balance -address <address> [-miner <address>]  Get wallet balance and UTXOs
+  client transfer -key <name|address> -inputs <utxos> -outputs <outputs> [-miner <address>]
+  client transfer -from <address> -privkey <key> -inputs <utxos> -outputs <outputs> [-miner <address>]
+  client wallet -hd [-seed <hex>] [-count <n>]     Generate (or restore) an HD wallet and derive addresses
+  client search -query <query> [-miner <address>]  Find a block (height or hash), transaction, or address
+  client tx-graph -txid <txid> [-depth <n>] [-miner <address>]  Trace where a transaction's funds came from and went
+  client spent-by -txid <txid> [-vout <n>] [-miner <address>]  Find the confirmed transaction spending an output
+  client tx -txid <txid> [-miner <address>]        Check whether a transaction is pending, confirmed, or dropped
+  client proof -txid <txid> [-miner <address>]     Fetch and check a confirmed transaction's Merkle proof
+  client supply [-miner <address>]                 Show the emission schedule and circulating supply
+  client leaderboard [-id <miner id>] [-from <height>] [-to <height>] [-miner <address>]  Rank miners, or list one miner's blocks
+  client forks [-limit <n>] [-miner <address>]     Show a miner's reports of deep reorgs
+  client cluster-analysis [-miner <address>] [-heuristics <list>]  Group chain addresses by likely owner
+  client top [-miners <list>] [-interval <duration>] [-blocks <n>] [-once]  Live dashboard of miners
+  client monitor [-miners <list>] [-max-lag <n>] [-max-age <duration>] [-interval <duration>] [-webhook <url>] [-once]
+  client blacklist [-add-address <list>] [-remove-address <list>] [-add-tx <list>] [-remove-tx <list>] [-miner <address>]
+  client coinjoin -key <name|address> -inputs <utxos> -mix <address> [-change <address>] [-miner <address>]
+  client mining -start|-stop [-miner <address>]    Start or stop a miner's mining loop
+  client hash [-threads <n>] [-blocks <n>] [-refresh <duration>] [-miner <address>]  Mine blocks for a miner from its block templates
+  client peers [-add <list>] [-remove <list>] [-miner <address>]  Show or change a miner's peers
+  client peers -scores [-miner <address>]  Show the misbehavior scores and bans of a miner's hosts
+  client audit [-caller <id>] [-method <name>] [-since <duration>] [-limit <n>] [-miner <address>]
+  client utxo-snapshot [-out <file>] [-miner <address>]  Save a miner's full UTXO set
+  client utxo-diff -a <file|address> -b <file|address>  Compare two UTXO sets
+  client upgrades [-chain-params <file>] [-name <change>] [-miners <list>]  Check which miners run the scheduled params
+  client journey -txid <txid> | -correlation <id> [-miners <list>]  Follow a transaction across miners
+  client light-sync -trusted-key <pubkey> [-checkpoint <file>] [-miner <address>]  Sync headers from a signed checkpoint
+
+Commands:
+  wallet       Generate a new wallet keypair, or manage the encrypted keystore (outputs JSON)
+  blockchain   Get current blockchain status (outputs JSON)
+  balance      Get wallet balance and all UTXOs (outputs JSON)
+  transfer     Send a transaction with multiple outputs (outputs JSON)
+  search       Look up a block, transaction, or address from a single query (outputs JSON)
+  tx-graph     Walk a transaction's ancestors and descendants as nodes and edges (outputs JSON)
+  spent-by     Look up which transaction and block spent an output (outputs JSON)
+  tx           Report a transaction's status: pending with its fee rate, confirmed with its block
+               and confirmation count, or dropped with the reason (outputs JSON)
+  proof        Fetch a confirmed transaction's block header and Merkle proof and check that the
+               proof leads to the header's Merkle root (outputs JSON; exit status 2 if it does not)
+  supply       Show per-era emission, issued, burned, and circulating coins (outputs JSON)
+  leaderboard  Rank miners by blocks, rewards, and average interval, or list one miner's blocks (outputs JSON)
+  forks        List reorg incident reports: both branches, their miners, and moved transactions (outputs JSON)
+  cluster-analysis  Apply address-clustering heuristics to the chain (outputs JSON)
+  top          Live terminal view of heights, hash rates, mempools, peers, and recent blocks
+  monitor      Alert when a miner is down, lags the majority, or stops producing blocks
+  blacklist    Show or change a miner's blacklist policy (outputs JSON)
+  coinjoin     Join a coinjoin round, sign locally, and wait for completion (outputs JSON)
+  mining       Start or stop mining (outputs JSON; needs the operator role on restricted miners)
+  hash         Do a miner's proof of work in this process: fetch block templates, find their nonces,
+               and submit the solved blocks (outputs JSON; needs the operator role on restricted miners)
+  peers        Show or change a miner's peer list, or with -scores the misbehavior score, offenses,
+               and ban of each host connected to it (outputs JSON; changes need the operator role)
+  audit        Show a miner's audit log of authenticated changes (outputs JSON; needs the admin role)
+  utxo-snapshot  Dump a miner's UTXO set at its tip, with each output's creation height (outputs JSON)
+  utxo-diff    List outpoints missing, extra, or mismatched between two snapshots or live miners
+               (outputs JSON; exits 2 if the sets differ)
+  upgrades     Report each miner's params fingerprint and scheduled changes, and which have upgraded
+               (outputs JSON; exits 2 if a reachable miner has not)
+  journey      Merge the miners' journals of one transaction into a timeline: submission, relays,
+               and block inclusion, with when each miner first held it (outputs JSON)
+  light-sync   Verify a checkpoint signed by a trusted key and check only the headers after it,
+               stating what was taken on trust (outputs JSON)
+
+Options:
+  -miner <address>    Miner node address (default: localhost:8001)
+  -address <address>  Wallet address (public key in hex)
+  -detail             Include detailed block information in blockchain command
+  -from <address>     Sender's public key (address)
+  -key <name|address> Transfer, coinjoin: sign with this keystore key
+  -keystore <file>    Encrypted keystore (default: $BLOCKCHAIN_KEYSTORE or ~/.blockchain/keystore.json)
+  -privkey <key>      Sender's private key (hex); visible in shell history and process lists, prefer -key
+  -inputs <utxos>     Comma-separated list of UTXOs to spend (format: txid:outindex,txid:outindex)
+  -outputs <outputs>  Comma-separated list of outputs (format: address:amount,address:amount)
+                      Amount in satoshi. Excess will be miner fee.
+  -memo <text>        Transfer: memo such as a payment reference (printable text, at most 80 bytes)
+  -hd                 Generate an HD wallet seed (use as miner -payout-seed)
+  -seed <hex>         Existing HD wallet seed to derive addresses from
+  -count <n>          Number of HD addresses to derive (default: 5)
+  -quorum <k/n>       blockchain, balance, search, supply: query the n miners listed in -miner
+                      (comma-separated) and only trust answers at least k of them agree on
+  -query <query>      Search: block height or hash, transaction ID, or address
+  -txid, -depth       Tx graph: transaction to trace and hops to follow each way (default: 3)
+  -txid, -vout        Spent-by: output to look up (default vout: 0)
+  -txid <txid>        Tx: transaction to check; Proof: confirmed transaction to prove
+  -id <miner id>      Leaderboard: list the blocks mined by this miner ID instead
+  -from, -to          Leaderboard: height range to count (default: 1 to the tip)
+  -heuristics <list>  Clustering heuristics: multi-input, change, miner-id (default: all)
+  -mix <address>      Coinjoin: address receiving the mixed output
+  -change <address>   Coinjoin: address receiving change
+  -timeout <duration> Coinjoin: how long to wait for the round (default: 5m)
+  -start, -stop       Mining: start or stop the miner's mining loop
+  -add, -remove       Peers: comma-separated peer addresses to add or remove
+  -caller, -method    Audit: only show calls by this token identity or of this method
+  -since <duration>   Audit: only show calls in this recent period
+  -limit <n>          Audit: newest calls to show (default: 50); forks: newest reports (default: 10)
+  -out <file>         UTXO snapshot: file to write (default: print the snapshot)
+  -a, -b              UTXO diff: snapshot files or miner addresses to compare
+  -chain-params <file>  Upgrades: params file the miners should run (default: the params most miners run)
+  -name <change>      Upgrades: a scheduled change the miners should know of
+  -correlation <id>   Journey: correlation ID a transfer returned (or -txid)
+  -trusted-key <key>  Light sync: public key of the checkpoint signer, e.g. the instructor's
+  -checkpoint <file>  Light sync: checkpoint file to start from (default: the miner's latest)
+
+Miners started with -access restrict RPC methods by role. Set BLOCKCHAIN_TOKEN
+to an API token to use its role (observer, wallet, operator, or admin) instead
+of the miner's anonymous role. For automation without a shared secret, set
+BLOCKCHAIN_KEY_FILE to a file holding a private key (from "wallet") whose
+public key is listed under "keys" in the miner's policy; each connection is
+then authenticated by a fresh signature instead of a token.
+
+Miners started with -tls-cert are dialed over TLS when BLOCKCHAIN_TLS_CA names
+the CA file their certificates are checked against. BLOCKCHAIN_TLS_CERT and
+BLOCKCHAIN_TLS_KEY present a client certificate, which takes the role the
+miner's -tls-client-role grants.
+
+Downloaded blocks are cached in ~/.blockchain/cache (override with
+BLOCKCHAIN_CACHE, or set it to "off"), so later commands fetch only new blocks.
+
+The keystore encrypts each private key with AES-256-GCM under a key derived
+from its password by scrypt. The password is prompted for without echo, or
+read from BLOCKCHAIN_KEYSTORE_PASSWORD for scripts.
+
+All output is in JSON format for frontend integration.
+`
+	fmt.Println(strings.ReplaceAll(usage, "  client ", "  "+prog+" "))
+}
+
+// dialRPC connects to a miner, authenticating with the credentials in the
+// environment if set
+func dialRPC(minerAddr string) (*rpc.Client, error) {
+	cred, err := cli.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return network.DialMiner(minerAddr, cred)
+}
+
+func outputJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		outputError(fmt.Sprintf("failed to marshal JSON: %v", err))
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+func outputError(message string) {
+	outputJSON(ErrorOutput{Error: message})
+}
+
+// generateWallet creates a new wallet (keypair) and outputs it as JSON
+func generateWallet() {
+	kp, err := transaction.GenerateKeyPair()
+	if err != nil {
+		outputError(fmt.Sprintf("failed to generate wallet: %v", err))
+		os.Exit(1)
+	}
+
+	wallet := WalletOutput{
+		Address:    kp.GetPublicKeyHex(),
+		PrivateKey: kp.GetPrivateKeyHex(),
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+
+	outputJSON(wallet)
+}
+
+// generateHDWallet creates (or restores) an HD wallet and outputs its first addresses as JSON
+func generateHDWallet(seedHex string, count int) {
+	var w *wallet.HDWallet
+	var err error
+	if seedHex != "" {
+		w, err = wallet.HDWalletFromHex(seedHex)
+	} else {
+		w, err = wallet.GenerateHDWallet()
+	}
+	if err != nil {
+		outputError(fmt.Sprintf("failed to create HD wallet: %v", err))
+		os.Exit(1)
+	}
+
+	output := HDWalletOutput{
+		Seed:      w.SeedHex(),
+		Addresses: make([]HDAddressInfo, 0, count),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	for i := 0; i < count; i++ {
+		kp := w.DeriveKey(uint32(i))
+		output.Addresses = append(output.Addresses, HDAddressInfo{
+			Index:      uint32(i),
+			Address:    kp.GetPublicKeyHex(),
+			PrivateKey: kp.GetPrivateKeyHex(),
+		})
+	}
+
+	outputJSON(output)
+}
+
+// getBlockchainStatus retrieves and outputs blockchain status as JSON
+func getBlockchainStatus(minerAddr string, includeDetail bool) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// Get miner status
+	var statusReply network.StatusReply
+	err = client.Call("RPCService.GetStatus", &struct{}{}, &statusReply)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to get miner status: %v", err))
+		os.Exit(1)
+	}
+
+	// Get blockchain, downloading only the blocks the cache lacks
+	blocks, downloaded := fetchChain(minerAddr)
+
+	// Build output
+	output := BlockchainStatusOutput{
+		ChainLength:      len(blocks),
+		DownloadedBlocks: downloaded,
+		MinerStatus:      &statusReply,
+	}
+
+	// Calculate total transactions
+	totalTxs := 0
+	for _, b := range blocks {
+		totalTxs += len(b.Transactions)
+	}
+	output.TotalTransactions = totalTxs
+
+	if len(blocks) > 0 {
+		latest := blocks[len(blocks)-1]
+		output.Difficulty = latest.Difficulty
+		output.LatestBlockHash = latest.Hash
+		output.LatestBlockIndex = latest.Index
+		output.LatestBlockMiner = latest.MinerID
+		output.LatestBlockTime = latest.Timestamp
+	}
+
+	// Include detailed block information if requested
+	if includeDetail {
+		output.Blocks = make([]BlockOutput, len(blocks))
+		for i, b := range blocks {
+			output.Blocks[i] = convertBlockToOutput(b)
+		}
+	}
+
+	outputJSON(output)
+}
+
+// getWalletStatus retrieves and outputs wallet balance and UTXOs as JSON
+func getWalletStatus(minerAddr, address string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// The miner looks up the address's outputs in its UTXO set
+	var reply network.UTXOsReply
+	if err := client.Call("RPCService.GetUTXOs", &network.AddressArgs{Address: address}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get UTXOs: %v", err))
+		os.Exit(1)
+	}
+	balance, utxos := reply.Balance, reply.UTXOs
+
+	// Convert UTXOs to output format
+	utxoOutputs := make([]UTXOOutput, len(utxos))
+	for i, utxo := range utxos {
+		utxoOutputs[i] = UTXOOutput{
+			TxID:         utxo.TxID,
+			OutIndex:     utxo.OutIndex,
+			Value:        utxo.Value,
+			ValueBTC:     float64(utxo.Value) / transaction.SatoshiPerBTC,
+			ScriptPubKey: utxo.ScriptPubKey,
+		}
+	}
+
+	output := WalletStatusOutput{
+		Address:    address,
+		Balance:    balance,
+		BalanceBTC: float64(balance) / transaction.SatoshiPerBTC,
+		UTXOs:      utxoOutputs,
+		UTXOCount:  len(utxos),
+	}
+
+	outputJSON(output)
+}
+
+// convertBlockToOutput converts a block to output format
+func convertBlockToOutput(b *block.Block) BlockOutput {
+	txs := make([]TransactionOutput, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		txs[i] = TransactionOutput{
+			ID:         tx.ID,
+			Inputs:     tx.Inputs,
+			Outputs:    tx.Outputs,
+			IsCoinbase: tx.IsCoinbase(),
+			Memo:       tx.Memo,
+		}
+	}
+
+	return BlockOutput{
+		Index:        b.Index,
+		Hash:         b.Hash,
+		PrevHash:     b.PrevHash,
+		Timestamp:    b.Timestamp,
+		Nonce:        b.Nonce,
+		Difficulty:   b.Difficulty,
+		MinerID:      b.MinerID,
+		PowAlgorithm: b.PowAlgorithm,
+		Transactions: txs,
+	}
+}
+
+// getSupply reports the miner's emission schedule and current coin supply
+func getSupply(minerAddr string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.SupplyReply
+	if err := client.Call("RPCService.GetSupply", &struct{}{}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get supply: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(convertSupply(reply))
+}
+
+// convertSupply converts a supply reply to output format
+func convertSupply(reply network.SupplyReply) SupplyOutput {
+	// Negative values mean "unbounded" and are reported as null
+	bounded := func(v int64) *int64 {
+		if v < 0 {
+			return nil
+		}
+		return &v
+	}
+	output := SupplyOutput{
+		Height:         reply.Height,
+		NextSubsidy:    reply.NextSubsidy,
+		MaxSupply:      bounded(reply.MaxSupply),
+		Scheduled:      reply.Scheduled,
+		Issued:         reply.Issued,
+		Burned:         reply.Burned,
+		BurnedOutputs:  reply.BurnedOutputs,
+		Circulating:    reply.Circulating,
+		CirculatingBTC: float64(reply.Circulating) / transaction.SatoshiPerBTC,
+	}
+	for _, era := range reply.Eras {
+		output.Eras = append(output.Eras, EmissionEraInfo{
+			StartHeight: era.StartHeight,
+			EndHeight:   bounded(era.EndHeight),
+			Subsidy:     era.Subsidy,
+			Total:       bounded(era.Total),
+			Blocks:      era.Blocks,
+			Issued:      era.Issued,
+		})
+	}
+	return output
+}
+
+// leaderboard outputs the miners of a height range ranked by blocks mined,
+// then by rewards
+func leaderboard(minerAddr string, from, to int64) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.LeaderboardReply
+	if err := client.Call("RPCService.GetLeaderboard", &network.HeightRangeArgs{FromHeight: from, ToHeight: to}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get leaderboard: %v", err))
+		os.Exit(1)
+	}
+	output := LeaderboardOutput{FromHeight: max(from, 1), ToHeight: to, Miners: []MinerStatsEntry{}}
+	if to < 0 || to > reply.Height {
+		output.ToHeight = reply.Height
+	}
+	for i, m := range reply.Miners {
+		output.Miners = append(output.Miners, MinerStatsEntry{
+			Rank:        i + 1,
+			MinerID:     m.MinerID,
+			Blocks:      m.Blocks,
+			Rewards:     m.Rewards,
+			Fees:        m.Fees,
+			FirstHeight: m.FirstHeight,
+			LastHeight:  m.LastHeight,
+			AvgInterval: m.AvgInterval,
+		})
+	}
+	outputJSON(output)
+}
+
+// minerBlocks outputs the blocks a miner produced over a height range
+func minerBlocks(minerAddr, minerID string, from, to int64) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	args := &network.MinerBlocksArgs{MinerID: minerID, HeightRangeArgs: network.HeightRangeArgs{FromHeight: from, ToHeight: to}}
+	var reply network.MinerBlocksReply
+	if err := client.Call("RPCService.GetMinerBlocks", args, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get blocks: %v", err))
+		os.Exit(1)
+	}
+	output := MinerBlocksOutput{MinerID: minerID, FromHeight: max(from, 1), ToHeight: to, Blocks: []MinedBlockInfo{}}
+	if to < 0 || to > reply.Height {
+		output.ToHeight = reply.Height
+	}
+	for _, b := range reply.Blocks {
+		output.Blocks = append(output.Blocks, MinedBlockInfo{
+			Height:    b.Height,
+			Hash:      b.Hash,
+			Timestamp: b.Timestamp,
+			TxCount:   b.TxCount,
+			Reward:    b.Reward,
+		})
+	}
+	outputJSON(output)
+}
+
+// search looks up a block, transaction, or address on the miner
+func search(minerAddr, query string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.SearchReply
+	if err := client.Call("RPCService.Search", &network.SearchArgs{Query: query}, &reply); err != nil {
+		outputError(fmt.Sprintf("search failed: %v", err))
+		os.Exit(1)
+	}
+
+	output, err := convertSearch(query, reply)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	outputJSON(output)
+}
+
+// traceTransaction outputs the graph of a transaction's funding sources and
+// the transactions that spent its outputs
+func traceTransaction(minerAddr, txID string, depth int) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var graph blockchain.TxGraph
+	if err := client.Call("RPCService.TraceTransaction", &network.TxGraphArgs{TxID: txID, Depth: depth}, &graph); err != nil {
+		outputError(fmt.Sprintf("failed to trace transaction: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(graph)
+}
+
+// spentBy outputs the confirmed transaction spending output vout of txID
+func spentBy(minerAddr, txID string, vout int) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.SpendingTxReply
+	if err := client.Call("RPCService.GetSpendingTx", &network.OutpointArgs{TxID: txID, OutIndex: vout}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to look up output: %v", err))
+		os.Exit(1)
+	}
+	output := SpentByOutput{TxID: txID, OutIndex: vout, Spent: reply.Found}
+	if reply.Found {
+		output.SpentBy = reply.Spend.TxID
+		output.Input = &reply.Spend.Input
+		output.BlockHeight = reply.Spend.BlockHeight
+		output.BlockHash = reply.Spend.BlockHash
+	}
+	outputJSON(output)
+}
+
+// convertSearch converts a search reply to output format
+func convertSearch(query string, reply network.SearchReply) (SearchOutput, error) {
+	output := SearchOutput{Query: query, Type: reply.Type, MatchedBy: reply.MatchedBy}
+	switch reply.Type {
+	case "block":
+		b, err := block.DeserializeBlock(reply.BlockData)
+		if err != nil {
+			return output, fmt.Errorf("failed to deserialize block: %v", err)
+		}
+		blockOutput := convertBlockToOutput(b)
+		output.Block = &blockOutput
+	case "transaction":
+		tx, err := transaction.DeserializeTransaction(reply.TxData)
+		if err != nil {
+			return output, fmt.Errorf("failed to deserialize transaction: %v", err)
+		}
+		output.Transaction = &TransactionOutput{ID: tx.ID, Inputs: tx.Inputs, Outputs: tx.Outputs, IsCoinbase: tx.IsCoinbase(), Memo: tx.Memo}
+		output.Confirmed = reply.Confirmed
+		output.BlockHeight = reply.BlockHeight
+		output.BlockHash = reply.BlockHash
+	case "address":
+		output.Address = reply.Address
+		output.Balance = reply.Balance
+		output.TxCount = reply.TxCount
+	default:
+		output.Type = "none"
+	}
+	return output, nil
+}
+
+// sendTransfer creates and sends a transfer transaction with multiple outputs
+func sendTransfer(minerAddr, from, privateKey, inputs, outputs, memo string) {
+	// Parse UTXO inputs
+	inputSpecs, err := parseUTXOInputs(inputs)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to parse inputs: %v", err))
+		os.Exit(1)
+	}
+
+	// Parse outputs
+	outputSpecs, err := parseOutputs(outputs)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to parse outputs: %v", err))
+		os.Exit(1)
+	}
+
+	// Connect to miner
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// Get blockchain to validate UTXO ownership
+	blocks, _ := fetchChain(minerAddr)
+
+	// Build UTXO set from blocks
+	utxoSet := transaction.NewUTXOSet()
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			utxoSet.ProcessTransaction(tx)
+		}
+	}
+
+	// Calculate total input value and validate ownership
+	var totalInput int64
+	for _, spec := range inputSpecs {
+		utxo := utxoSet.FindUTXO(spec.TxID, spec.OutIndex)
+		if utxo == nil {
+			outputError(fmt.Sprintf("UTXO not found: %s:%d", spec.TxID, spec.OutIndex))
+			os.Exit(1)
+		}
+		if utxo.ScriptPubKey != from {
+			outputError(fmt.Sprintf("UTXO %s:%d does not belong to address %s", spec.TxID, spec.OutIndex, from))
+			os.Exit(1)
+		}
+		totalInput += utxo.Value
+	}
+
+	// Calculate total output value
+	var totalOutput int64
+	for _, out := range outputSpecs {
+		totalOutput += out.Value
+	}
+
+	// Calculate miner fee (can be 0 or positive, but not negative)
+	minerFee := totalInput - totalOutput
+	if minerFee < 0 {
+		outputError(fmt.Sprintf("insufficient funds: input=%d satoshi, output=%d satoshi, deficit=%d satoshi", totalInput, totalOutput, -minerFee))
+		os.Exit(1)
+	}
+
+	// Sign locally; only the signed transaction is sent to the miner
+	tx, err := utxoSet.CreateTransactionWithMemo(inputSpecs, outputSpecs, memo, map[string]string{from: privateKey})
+	if err != nil {
+		outputError(fmt.Sprintf("failed to sign transaction: %v", err))
+		os.Exit(1)
+	}
+	txData, err := tx.SerializeJSON()
+	if err != nil {
+		outputError(fmt.Sprintf("failed to serialize transaction: %v", err))
+		os.Exit(1)
+	}
+
+	// Submit transaction via RPC
+	var txReply network.TransactionReply
+	err = client.Call("RPCService.SubmitRawTransaction", &network.RawTransactionArgs{TxData: txData}, &txReply)
+	if err != nil {
+		outputError(fmt.Sprintf("RPC call failed: %v", err))
+		os.Exit(1)
+	}
+
+	// Output result
+	output := TransferOutput{
+		Success:       txReply.Success,
+		TxID:          txReply.TxID,
+		CorrelationID: txReply.CorrelationID,
+	}
+
+	if txReply.Success {
+		output.Message = fmt.Sprintf("Transfer successful! %d outputs, total: %d satoshi (%.8f BTC)", len(outputSpecs), totalOutput, float64(totalOutput)/transaction.SatoshiPerBTC)
+		if minerFee > 0 {
+			output.Message += fmt.Sprintf(". Miner fee: %d satoshi (%.8f BTC)", minerFee, float64(minerFee)/transaction.SatoshiPerBTC)
+		}
+		output.Status = network.TxPending
+	} else {
+		output.Error = txReply.Error
+	}
+
+	outputJSON(output)
+}
+
+// parseUTXOInputs parses comma-separated UTXO inputs (format: txid:outindex,txid:outindex)
+func parseUTXOInputs(inputs string) ([]struct {
+	TxID     string
+	OutIndex int
+}, error) {
+	var specs []struct {
+		TxID     string
+		OutIndex int
+	}
+
+	parts := splitAndTrim(inputs, ",")
+	for _, part := range parts {
+		pair := splitAndTrim(part, ":")
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid UTXO format: %s (expected txid:outindex)", part)
+		}
+
+		var outIndex int
+		_, err := fmt.Sscanf(pair[1], "%d", &outIndex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output index: %s", pair[1])
+		}
+
+		specs = append(specs, struct {
+			TxID     string
+			OutIndex int
+		}{
+			TxID:     pair[0],
+			OutIndex: outIndex,
+		})
+	}
+
+	return specs, nil
+}
+
+// parseOutputs parses comma-separated outputs (format: address:amount,address:amount)
+func parseOutputs(outputs string) ([]transaction.TxOutput, error) {
+	var txOutputs []transaction.TxOutput
+
+	parts := splitAndTrim(outputs, ",")
+	for _, part := range parts {
+		pair := splitAndTrim(part, ":")
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid output format: %s (expected address:amount)", part)
+		}
+
+		var amount int64
+		_, err := fmt.Sscanf(pair[1], "%d", &amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount: %s", pair[1])
+		}
+
+		if amount <= 0 {
+			return nil, fmt.Errorf("amount must be positive: %d", amount)
+		}
+
+		txOutputs = append(txOutputs, transaction.TxOutput{
+			Value:        amount,
+			ScriptPubKey: pair[0],
+		})
+	}
+
+	if len(txOutputs) == 0 {
+		return nil, fmt.Errorf("no valid outputs")
+	}
+
+	return txOutputs, nil
+}
+
+// splitAndTrim splits a string by delimiter and trims whitespace
+func splitAndTrim(s, sep string) []string {
+	parts := []string{}
+	for _, part := range splitString(s, sep) {
+		trimmed := trimSpace(part)
+		if trimmed != "" {
+			parts = append(parts, trimmed)
+		}
+	}
+	return parts
+}
+
+// splitString splits a string by separator
+func splitString(s, sep string) []string {
+	if s == "" {
+		return []string{}
+	}
+	var parts []string
+	var current string
+	for i := 0; i < len(s); i++ {
+		if i+len(sep) <= len(s) && s[i:i+len(sep)] == sep {
+			parts = append(parts, current)
+			current = ""
+			i += len(sep) - 1
+		} else {
+			current += string(s[i])
+		}
+	}
+	parts = append(parts, current)
+	return parts
+}
+
+// trimSpace trims whitespace from a string
+func trimSpace(s string) string {
+	start := 0
+	end := len(s)
+	for start < end && (s[start] == ' ' || s[start] == '\t' || s[start] == '\n' || s[start] == '\r') {
+		start++
+	}
+	for end > start && (s[end-1] == ' ' || s[end-1] == '\t' || s[end-1] == '\n' || s[end-1] == '\r') {
+		end--
+	}
+	return s[start:end]
+}
+
+// runClusterAnalysis fetches the chain and outputs address clusters as JSON
+func runClusterAnalysis(minerAddr, heuristicList string) {
+	var heuristics []analysis.Heuristic
+	for _, name := range splitAndTrim(heuristicList, ",") {
+		h, err := analysis.ParseHeuristic(name)
+		if err != nil {
+			outputError(err.Error())
+			os.Exit(1)
+		}
+		heuristics = append(heuristics, h)
+	}
+
+	blocks, _ := fetchChain(minerAddr)
+	clusters := analysis.ClusterAddresses(blocks, heuristics)
+	output := ClusterAnalysisOutput{
+		Heuristics:   heuristics,
+		ClusterCount: len(clusters),
+		Clusters:     clusters,
+	}
+	for _, c := range clusters {
+		output.AddressCount += len(c.Addresses)
+	}
+	if len(clusters) > 0 {
+		output.LargestCluster = len(clusters[0].Addresses)
+	}
+
+	outputJSON(output)
+}
+
+// joinCoinJoin registers inputs in the miner's open coinjoin round, waits for
+// it to fill, signs the combined transaction locally, and waits for completion.
+// The private key never leaves the client.
+func joinCoinJoin(minerAddr, privateKey, inputs, mixAddr, changeAddr string, timeout time.Duration) {
+	priv, err := transaction.HexToPrivateKey(privateKey)
+	if err != nil {
+		outputError(fmt.Sprintf("invalid private key: %v", err))
+		os.Exit(1)
+	}
+	specs, err := parseUTXOInputs(inputs)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	var txInputs []transaction.TxInput
+	for _, spec := range specs {
+		txInputs = append(txInputs, transaction.TxInput{TxID: spec.TxID, OutIndex: spec.OutIndex})
+	}
+
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// Signatures commit to the outputs our inputs spend, so a miner
+	// misreporting them only gets signatures that do not verify
+	var utxoReply network.UTXOsReply
+	err = client.Call("RPCService.GetUTXOs", &network.AddressArgs{Address: transaction.PublicKeyToHex(&priv.PublicKey)}, &utxoReply)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to get UTXOs: %v", err))
+		os.Exit(1)
+	}
+	spent := make(map[string]transaction.TxOutput, len(utxoReply.UTXOs))
+	for _, utxo := range utxoReply.UTXOs {
+		spent[fmt.Sprintf("%s:%d", utxo.TxID, utxo.OutIndex)] = utxo.Output()
+	}
+	for _, in := range txInputs {
+		if _, ok := spent[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)]; !ok {
+			outputError(fmt.Sprintf("input %s:%d is not an unspent output of this key", in.TxID, in.OutIndex))
+			os.Exit(1)
+		}
+	}
+
+	var regReply network.CoinJoinRegisterReply
+	err = client.Call("RPCService.CoinJoinRegister", &network.CoinJoinRegisterArgs{
+		Inputs:        txInputs,
+		MixAddress:    mixAddr,
+		ChangeAddress: changeAddr,
+	}, &regReply)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to register: %v", err))
+		os.Exit(1)
+	}
+	if !regReply.Success {
+		outputError(fmt.Sprintf("failed to register: %s", regReply.Error))
+		os.Exit(1)
+	}
+
+	output := CoinJoinOutput{RoundID: regReply.RoundID}
+	deadline := time.Now().Add(timeout)
+	signed := false
+	for {
+		var round network.CoinJoinRoundReply
+		err = client.Call("RPCService.CoinJoinGetRound", &network.CoinJoinRoundArgs{RoundID: regReply.RoundID}, &round)
+		if err != nil {
+			outputError(fmt.Sprintf("failed to poll round: %v", err))
+			os.Exit(1)
+		}
+		if !round.Success {
+			outputError(fmt.Sprintf("failed to poll round: %s", round.Error))
+			os.Exit(1)
+		}
+		output.Participants = round.Participants
+		output.Denomination = round.Denomination
+
+		if round.State == "complete" {
+			tx, _ := transaction.DeserializeTransaction(round.TxData)
+			output.Success = true
+			output.TxID = tx.ID
+			break
+		}
+
+		if round.State == "signing" && !signed {
+			tx, err := transaction.DeserializeTransaction(round.TxData)
+			if err != nil {
+				outputError(fmt.Sprintf("failed to deserialize round transaction: %v", err))
+				os.Exit(1)
+			}
+			// Each signature commits to the position the coordinator gave our input
+			mine := make(map[string]bool, len(txInputs))
+			for _, in := range txInputs {
+				mine[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)] = true
+			}
+			sigs := make(map[string]string)
+			for i, in := range tx.Inputs {
+				key := fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)
+				if !mine[key] {
+					continue
+				}
+				sig, err := tx.SignInputSpending(i, privateKey, transaction.SigHashAll, spent[key])
+				if err != nil {
+					outputError(fmt.Sprintf("failed to sign: %v", err))
+					os.Exit(1)
+				}
+				sigs[key] = sig
+			}
+			var signReply network.TransactionReply
+			err = client.Call("RPCService.CoinJoinSign", &network.CoinJoinSignArgs{
+				RoundID:    regReply.RoundID,
+				Signatures: sigs,
+			}, &signReply)
+			if err != nil {
+				outputError(fmt.Sprintf("failed to submit signatures: %v", err))
+				os.Exit(1)
+			}
+			if !signReply.Success {
+				outputError(fmt.Sprintf("failed to submit signatures: %s", signReply.Error))
+				os.Exit(1)
+			}
+			signed = true
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			output.Error = fmt.Sprintf("round %s did not complete within %s (state: %s)", regReply.RoundID, timeout, round.State)
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	outputJSON(output)
+}
+
+// manageBlacklist applies blacklist changes (if any) and outputs the resulting list as JSON
+func manageBlacklist(minerAddr string, add, remove policy.BlacklistEntries) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.BlacklistReply
+	if len(add.Addresses)+len(add.Transactions)+len(remove.Addresses)+len(remove.Transactions) > 0 {
+		err = client.Call("RPCService.UpdateBlacklist", &network.BlacklistArgs{Add: add, Remove: remove}, &reply)
+	} else {
+		err = client.Call("RPCService.GetBlacklist", &struct{}{}, &reply)
+	}
+	if err != nil {
+		outputError(fmt.Sprintf("failed to update blacklist: %v", err))
+		os.Exit(1)
+	}
+	if !reply.Success {
+		outputError(reply.Error)
+		os.Exit(1)
+	}
+
+	outputJSON(BlacklistOutput{
+		Addresses:    reply.Entries.Addresses,
+		Transactions: reply.Entries.Transactions,
+		Purged:       reply.Purged,
+	})
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"blockchain/pkg/audit"
+	"blockchain/pkg/network"
+	"fmt"
+	"os"
+)
+
+// MiningOutput represents a miner's mining state in JSON format
+type MiningOutput struct {
+	Miner  string `json:"miner"`
+	Mining bool   `json:"mining"`
+	Paused string `json:"paused,omitempty"` // Resource pressure holding mining off
+}
+
+// PeersOutput represents a miner's peer list in JSON format
+type PeersOutput struct {
+	Miner    string              `json:"miner"`
+	Peers    []network.PeerInfo  `json:"peers"`
+	Features map[string][]string `json:"features,omitempty"` // Negotiated protocol features by peer address
+}
+
+// PeerScoresOutput represents the misbehavior scores a miner keeps per host in
+// JSON format
+type PeerScoresOutput struct {
+	Miner        string              `json:"miner"`
+	BanThreshold int                 `json:"ban_threshold"`
+	BanDuration  string              `json:"ban_duration"`
+	Peers        []network.PeerScore `json:"peers"`
+}
+
+// AuditOutput represents entries of a miner's audit log in JSON format
+type AuditOutput struct {
+	Miner   string        `json:"miner"`
+	Count   int           `json:"count"`
+	Entries []audit.Entry `json:"entries"`
+}
+
+// setMining starts or stops a miner's mining loop
+func setMining(minerAddr string, enabled bool) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.MiningReply
+	if err := client.Call("RPCService.SetMining", &network.MiningArgs{Enabled: enabled}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to set mining: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(MiningOutput{Miner: minerAddr, Mining: reply.Mining, Paused: reply.Paused})
+}
+
+// managePeers shows a miner's peers, first adding and removing the given addresses
+func managePeers(minerAddr string, add, remove []string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.PeersReply
+	if len(add)+len(remove) > 0 {
+		args := &network.PeersArgs{Remove: remove}
+		for _, addr := range add {
+			args.Add = append(args.Add, network.PeerInfo{ID: addr, Address: addr})
+		}
+		err = client.Call("RPCService.UpdatePeers", args, &reply)
+	} else {
+		err = client.Call("RPCService.GetPeers", &struct{}{}, &reply)
+	}
+	if err != nil {
+		outputError(fmt.Sprintf("failed to update peers: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(PeersOutput{Miner: minerAddr, Peers: reply.Peers, Features: reply.Features})
+}
+
+// showPeerScores prints the connections, misbehavior scores, and bans of the
+// hosts a miner is tracking
+func showPeerScores(minerAddr string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.PeerInfoReply
+	if err := client.Call("RPCService.GetPeerInfo", &struct{}{}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get peer info: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(PeerScoresOutput{
+		Miner:        minerAddr,
+		BanThreshold: reply.BanThreshold,
+		BanDuration:  reply.BanDuration.String(),
+		Peers:        reply.Peers,
+	})
+}
+
+// queryAuditLog prints the audit log entries matching args
+func queryAuditLog(minerAddr string, args network.AuditQueryArgs) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.AuditQueryReply
+	if err := client.Call("RPCService.GetAuditLog", &args, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to query audit log: %v", err))
+		os.Exit(1)
+	}
+	if !reply.Success {
+		outputError(reply.Error)
+		os.Exit(1)
+	}
+	outputJSON(AuditOutput{Miner: minerAddr, Count: len(reply.Entries), Entries: reply.Entries})
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"blockchain/pkg/network"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ForkBlockOutput is one block of a fork report's branch in JSON format
+type ForkBlockOutput struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	MinerID   string `json:"miner_id"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ForkReportOutput is one reorg incident report in JSON format
+type ForkReportOutput struct {
+	ID         string            `json:"id"`
+	DetectedAt string            `json:"detected_at"`
+	Peer       string            `json:"peer"` // ID and address of the peer whose chain won
+	ForkHeight int64             `json:"fork_height"`
+	ForkTime   string            `json:"fork_time,omitempty"`
+	Depth      int               `json:"depth"`
+	Duration   string            `json:"duration"`
+	OldBranch  []ForkBlockOutput `json:"old_branch"`
+	NewBranch  []ForkBlockOutput `json:"new_branch"`
+	OldMiners  []string          `json:"old_miners"`
+	NewMiners  []string          `json:"new_miners"`
+	DroppedTxs []string          `json:"dropped_txs"`
+	AddedTxs   []string          `json:"added_txs"`
+}
+
+// ForkReportsOutput lists a miner's fork reports in JSON format
+type ForkReportsOutput struct {
+	Miner    string             `json:"miner"`
+	Enabled  bool               `json:"enabled"`
+	MinDepth int                `json:"min_depth,omitempty"`
+	Reports  []ForkReportOutput `json:"reports"`
+}
+
+// convertForkBranch converts a branch's headers to output format
+func convertForkBranch(headers []network.BlockHeader) []ForkBlockOutput {
+	blocks := make([]ForkBlockOutput, len(headers))
+	for i, h := range headers {
+		blocks[i] = ForkBlockOutput{
+			Height:    h.Index,
+			Hash:      h.Hash,
+			MinerID:   h.MinerID,
+			Timestamp: time.Unix(0, h.Timestamp).Format(time.RFC3339),
+		}
+	}
+	return blocks
+}
+
+// forkReports outputs the most recent reorg reports of a miner, oldest first
+func forkReports(minerAddr string, limit int) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.ForkReportsReply
+	if err := client.Call("RPCService.GetForkReports", &network.ForkReportsArgs{Limit: limit}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get fork reports: %v", err))
+		os.Exit(1)
+	}
+
+	output := ForkReportsOutput{Miner: minerAddr, Enabled: reply.Enabled, MinDepth: reply.MinDepth, Reports: []ForkReportOutput{}}
+	for _, r := range reply.Reports {
+		report := ForkReportOutput{
+			ID:         r.ID,
+			DetectedAt: r.DetectedAt.Format(time.RFC3339),
+			Peer:       fmt.Sprintf("%s (%s)", r.Peer.ID, r.Peer.Address),
+			ForkHeight: r.ForkHeight,
+			Depth:      r.Depth,
+			Duration:   r.Duration.Round(time.Second).String(),
+			OldBranch:  convertForkBranch(r.OldBranch),
+			NewBranch:  convertForkBranch(r.NewBranch),
+			OldMiners:  r.OldMiners,
+			NewMiners:  r.NewMiners,
+			DroppedTxs: r.DroppedTxs,
+			AddedTxs:   r.AddedTxs,
+		}
+		if r.ForkTime != 0 {
+			report.ForkTime = time.Unix(0, r.ForkTime).Format(time.RFC3339)
+		}
+		output.Reports = append(output.Reports, report)
+	}
+	outputJSON(output)
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/network"
+	"blockchain/pkg/pow"
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// HashOutput reports an external hashing run against a miner in JSON format
+type HashOutput struct {
+	Miner     string        `json:"miner"`
+	Blocks    []HashedBlock `json:"blocks"`
+	Hashes    int64         `json:"hashes"`
+	Templates int           `json:"templates"` // Templates fetched, including those refreshed unsolved
+	Rejected  int           `json:"rejected"`  // Solutions the miner refused, as when its tip moved first
+}
+
+// HashedBlock is a block found by an external hashing run
+type HashedBlock struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+	Nonce  int64  `json:"nonce"`
+}
+
+// hashForMiner mines count blocks for a miner outside its process: it fetches
+// block templates, searches their nonces on threads workers, and submits each
+// solution. A template is refetched after refresh so new transactions and
+// tips are picked up.
+func hashForMiner(minerAddr string, threads, count int, refresh time.Duration) {
+	cred, err := cli.Credentials()
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	client := &network.Client{Auth: cred}
+
+	out := HashOutput{Miner: minerAddr, Blocks: []HashedBlock{}}
+	for len(out.Blocks) < count {
+		tmpl, err := client.GetBlockTemplate(minerAddr)
+		if err != nil {
+			outputError(fmt.Sprintf("failed to get block template: %v", err))
+			os.Exit(1)
+		}
+		out.Templates++
+		b, err := block.DeserializeBlock(tmpl.BlockData)
+		if err != nil {
+			outputError(fmt.Sprintf("invalid block template: %v", err))
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), refresh)
+		result := pow.NewProofOfWork(b).MineParallel(ctx, threads)
+		cancel()
+		out.Hashes += result.Attempts
+		if !result.Success {
+			continue
+		}
+		reply, err := client.SubmitBlock(minerAddr, tmpl.TemplateID, result.Nonce)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Block #%d refused: %v\n", tmpl.Height, err)
+			out.Rejected++
+			continue
+		}
+		out.Blocks = append(out.Blocks, HashedBlock{Height: reply.Height, Hash: reply.Hash, Nonce: result.Nonce})
+	}
+	outputJSON(out)
+}
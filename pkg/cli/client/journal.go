@@ -0,0 +1,89 @@
+package client
+
+import (
+	"blockchain/pkg/network"
+	"sort"
+	"time"
+)
+
+// JourneyEventOutput is one miner's journal event in JSON format
+type JourneyEventOutput struct {
+	Time          string `json:"time"`
+	Offset        string `json:"offset"` // Since the journey's first event
+	Node          string `json:"node"`
+	Kind          string `json:"kind"`
+	TxID          string `json:"txid"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Peer          string `json:"peer,omitempty"`
+	Hops          int    `json:"hops"`
+	Height        int64  `json:"height,omitempty"`
+	Detail        string `json:"detail,omitempty"`
+}
+
+// JourneyOutput is a transaction's journey across miners in JSON format
+type JourneyOutput struct {
+	TxID          string               `json:"txid,omitempty"`
+	CorrelationID string               `json:"correlation_id,omitempty"`
+	Reached       map[string]string    `json:"reached"` // Node -> offset at which it first held the transaction
+	Unreachable   []string             `json:"unreachable"`
+	Events        []JourneyEventOutput `json:"events"`
+}
+
+// txJourney merges the journal events of a transaction, selected by ID,
+// correlation ID, or both, from every miner into one timeline
+func txJourney(addresses []string, txID, corr string) {
+	output := JourneyOutput{TxID: txID, CorrelationID: corr, Reached: map[string]string{}, Unreachable: []string{}, Events: []JourneyEventOutput{}}
+	var events []network.JournalEvent
+	for _, addr := range addresses {
+		client, err := dialRPC(addr)
+		if err != nil {
+			output.Unreachable = append(output.Unreachable, addr)
+			continue
+		}
+		var reply network.TxJournalReply
+		err = client.Call("RPCService.GetTxJournal", &network.TxJournalArgs{TxID: txID, CorrelationID: corr}, &reply)
+		client.Close()
+		if err != nil {
+			output.Unreachable = append(output.Unreachable, addr)
+			continue
+		}
+		events = append(events, reply.Events...)
+	}
+	if len(events) == 0 {
+		outputJSON(output)
+		return
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	start := events[0].Time
+	for _, e := range events {
+		offset := e.Time.Sub(start).Round(time.Microsecond).String()
+		if _, ok := output.Reached[e.Node]; !ok && (e.Kind == network.JournalSubmitted || e.Kind == network.JournalReceived) {
+			output.Reached[e.Node] = offset
+		}
+		output.Events = append(output.Events, JourneyEventOutput{
+			Time:          e.Time.Format(time.RFC3339Nano),
+			Offset:        offset,
+			Node:          e.Node,
+			Kind:          e.Kind,
+			TxID:          e.TxID,
+			CorrelationID: e.CorrelationID,
+			Peer:          e.Peer,
+			Hops:          e.Hops,
+			Height:        e.Height,
+			Detail:        e.Detail,
+		})
+	}
+	if output.TxID == "" {
+		output.TxID = events[0].TxID
+	}
+	if output.CorrelationID == "" {
+		for _, e := range events {
+			if e.CorrelationID != "" {
+				output.CorrelationID = e.CorrelationID
+				break
+			}
+		}
+	}
+	outputJSON(output)
+}
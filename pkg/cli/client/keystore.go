@@ -0,0 +1,240 @@
+package client
+
+import (
+	"blockchain/pkg/transaction"
+	"blockchain/pkg/wallet"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables configuring the encrypted keystore
+const (
+	keystoreEnv         = "BLOCKCHAIN_KEYSTORE"          // Keystore file (default: ~/.blockchain/keystore.json)
+	keystorePasswordEnv = "BLOCKCHAIN_KEYSTORE_PASSWORD" // Password, for scripts; otherwise prompted for
+)
+
+// KeystoreKeyOutput represents a key held in the keystore in JSON format. The
+// private key is only output by "wallet export".
+type KeystoreKeyOutput struct {
+	Name       string `json:"name"`
+	Address    string `json:"address"` // Public key (hex)
+	PrivateKey string `json:"private_key,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	Keystore   string `json:"keystore"`
+}
+
+// KeystoreListOutput represents the keys of a keystore in JSON format
+type KeystoreListOutput struct {
+	Keystore string              `json:"keystore"`
+	Keys     []KeystoreKeyOutput `json:"keys"`
+}
+
+// stdin is shared by every prompt so buffered input is not lost between them
+var stdin = bufio.NewReader(os.Stdin)
+
+// defaultKeystorePath returns the keystore file used when -keystore is not given
+func defaultKeystorePath() string {
+	if path := os.Getenv(keystoreEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "keystore.json"
+	}
+	return filepath.Join(home, ".blockchain", "keystore.json")
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptSecret reads a line from the terminal without echoing it
+func promptSecret(prompt string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return "", errors.New("stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	line, err := stdin.ReadString('\n')
+	stty("echo")
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// keystorePassword returns the keystore password from the environment or
+// the terminal. New passwords are asked for twice.
+func keystorePassword(confirm bool) (string, error) {
+	if password, ok := os.LookupEnv(keystorePasswordEnv); ok {
+		return password, nil
+	}
+	password, err := promptSecret("Keystore password: ")
+	if err != nil {
+		return "", fmt.Errorf("cannot prompt for the keystore password (%v); set %s", err, keystorePasswordEnv)
+	}
+	if confirm {
+		again, err := promptSecret("Repeat password: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", errors.New("passwords do not match")
+		}
+	}
+	return password, nil
+}
+
+// openKeystore loads the keystore at path, exiting on error
+func openKeystore(path string) *wallet.Keystore {
+	ks, err := wallet.OpenKeystore(path)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to open keystore: %v", err))
+		os.Exit(1)
+	}
+	return ks
+}
+
+// keyOutput describes a keystore key, without its private key
+func keyOutput(ks *wallet.Keystore, key *wallet.KeystoreKey) KeystoreKeyOutput {
+	return KeystoreKeyOutput{Name: key.Name, Address: key.Address, CreatedAt: key.CreatedAt, Keystore: ks.Path()}
+}
+
+// addToKeystore encrypts a private key into the keystore at path and outputs
+// the stored key. Keys are named key1, key2, ... unless a name is given.
+func addToKeystore(path, name, privateKey string) {
+	ks := openKeystore(path)
+	if name == "" {
+		name = fmt.Sprintf("key%d", len(ks.Keys)+1)
+	}
+	// Keys added to a new keystore set its password, so confirm it
+	password, err := keystorePassword(len(ks.Keys) == 0)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	if len(ks.Keys) > 0 {
+		// One password per keystore: check it against an existing key first
+		if _, err := ks.Decrypt(ks.Keys[0].Name, password); err != nil {
+			outputError(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	key, err := ks.Add(name, privateKey, password)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to add key: %v", err))
+		os.Exit(1)
+	}
+	if err := ks.Save(); err != nil {
+		outputError(fmt.Sprintf("failed to save keystore: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(keyOutput(ks, key))
+}
+
+// createKeystoreWallet generates a keypair and stores it in the keystore
+// instead of printing its private key
+func createKeystoreWallet(path, name string) {
+	kp, err := transaction.GenerateKeyPair()
+	if err != nil {
+		outputError(fmt.Sprintf("failed to generate wallet: %v", err))
+		os.Exit(1)
+	}
+	addToKeystore(path, name, kp.GetPrivateKeyHex())
+}
+
+// importKey adds an existing private key, read from file or the terminal,
+// to the keystore
+func importKey(path, name, file string) {
+	var privateKey string
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			outputError(fmt.Sprintf("failed to read private key: %v", err))
+			os.Exit(1)
+		}
+		privateKey = strings.TrimSpace(string(data))
+	} else {
+		var err error
+		privateKey, err = promptSecret("Private key (hex): ")
+		if err != nil {
+			outputError(fmt.Sprintf("cannot prompt for the private key (%v); use -file", err))
+			os.Exit(1)
+		}
+		privateKey = strings.TrimSpace(privateKey)
+	}
+	addToKeystore(path, name, privateKey)
+}
+
+// listKeystore outputs the names and addresses in the keystore; no password
+// is needed
+func listKeystore(path string) {
+	ks := openKeystore(path)
+	output := KeystoreListOutput{Keystore: ks.Path(), Keys: make([]KeystoreKeyOutput, 0, len(ks.Keys))}
+	for i := range ks.Keys {
+		output.Keys = append(output.Keys, keyOutput(ks, &ks.Keys[i]))
+	}
+	outputJSON(output)
+}
+
+// exportKey decrypts a key and outputs it with its private key
+func exportKey(path, ref string) {
+	ks := openKeystore(path)
+	key, privateKey := unlockKey(ks, ref)
+	output := keyOutput(ks, key)
+	output.PrivateKey = privateKey
+	outputJSON(output)
+}
+
+// unlockKey decrypts the keystore key with the given name or address,
+// exiting on error
+func unlockKey(ks *wallet.Keystore, ref string) (*wallet.KeystoreKey, string) {
+	key := ks.Find(ref)
+	if key == nil {
+		outputError(fmt.Sprintf("%v: %s", wallet.ErrKeyNotFound, ref))
+		os.Exit(1)
+	}
+	password, err := keystorePassword(false)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	privateKey, err := ks.Decrypt(ref, password)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	return key, privateKey
+}
+
+// signingKey resolves the key a command signs with: a keystore key if ref is
+// set, otherwise the raw -privkey. from, if set, must match the key's address.
+func signingKey(keystorePath, ref, privateKey, from string) (address, key string) {
+	if ref == "" {
+		return from, privateKey
+	}
+	if privateKey != "" {
+		outputError("use either -key or -privkey, not both")
+		os.Exit(1)
+	}
+	k, privateKey := unlockKey(openKeystore(keystorePath), ref)
+	if from != "" && from != k.Address {
+		outputError(fmt.Sprintf("-from does not match the address of key %s", k.Name))
+		os.Exit(1)
+	}
+	return k.Address, privateKey
+}
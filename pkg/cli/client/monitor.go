@@ -0,0 +1,88 @@
+package client
+
+import (
+	"blockchain/pkg/monitor"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// MonitorOutput represents the result of a single monitor check in JSON format
+type MonitorOutput struct {
+	Healthy        bool            `json:"healthy"`
+	MajorityHeight int64           `json:"majority_height"`
+	Alerts         []monitor.Alert `json:"alerts"`
+}
+
+// monitorExitCode is returned by a -once check that finds a node behind
+const monitorExitCode = 2
+
+// observeMiners polls the miners and converts their status for the monitor
+func observeMiners(addresses []string) []monitor.NodeStatus {
+	var statuses []monitor.NodeStatus
+	for _, snap := range pollMiners(addresses) {
+		status := monitor.NodeStatus{Address: snap.address, Err: snap.err}
+		if snap.err == nil {
+			status.Height = int64(snap.status.ChainLength - 1)
+			status.TipTime = time.Unix(0, snap.status.TipTime)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// runMonitor watches miners and reports any that fall behind. With once it
+// prints a single JSON report and exits non-zero if any alert is active;
+// otherwise it logs (and posts to the webhook) each alert as it starts and
+// clears until interrupted.
+func runMonitor(addresses []string, th monitor.Thresholds, interval time.Duration, webhook string, once bool) {
+	if once {
+		statuses := observeMiners(addresses)
+		majority, _ := monitor.MajorityHeight(statuses)
+		alerts := monitor.Evaluate(statuses, th, time.Now())
+		for _, a := range alerts {
+			notify(webhook, a)
+		}
+		outputJSON(MonitorOutput{Healthy: len(alerts) == 0, MajorityHeight: majority, Alerts: alerts})
+		if len(alerts) > 0 {
+			os.Exit(monitorExitCode)
+		}
+		return
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	log.Printf("Monitoring %d miners every %s (max lag %d blocks, max tip age %s)",
+		len(addresses), interval, th.MaxLag, th.MaxTipAge)
+	m := monitor.New(th)
+	for {
+		raised, cleared := m.Update(observeMiners(addresses), time.Now())
+		for _, a := range append(raised, cleared...) {
+			notify(webhook, a)
+		}
+
+		select {
+		case <-sigChan:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// notify logs an alert and posts it to the webhook, if one is configured
+func notify(webhook string, a monitor.Alert) {
+	if a.Resolved {
+		log.Printf("RESOLVED: %s", a.Message)
+	} else {
+		log.Printf("ALERT [%s]: %s", a.Kind, a.Message)
+	}
+	if webhook == "" {
+		return
+	}
+	if err := monitor.PostWebhook(webhook, a); err != nil {
+		log.Printf("Failed to post alert to webhook: %v", err)
+	}
+}
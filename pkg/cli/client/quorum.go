@@ -0,0 +1,127 @@
+package client
+
+import (
+	"blockchain/pkg/network"
+	"blockchain/pkg/quorum"
+	"blockchain/pkg/transaction"
+	"os"
+)
+
+// TipInfo identifies a chain tip
+type TipInfo struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// QuorumOutput wraps an answer accepted by k of n miners in JSON format
+type QuorumOutput struct {
+	Quorum      string         `json:"quorum"`
+	Tip         *TipInfo       `json:"tip,omitempty"`
+	TipCheck    quorum.Result  `json:"tip_check"`
+	Result      interface{}    `json:"result,omitempty"`
+	ResultCheck *quorum.Result `json:"result_check,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// callMiner makes one RPC call to a miner
+func callMiner(address, method string, args, reply interface{}) error {
+	client, err := dialMiner(address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Call(method, args, reply)
+}
+
+// quorumRead checks that k of the n miners agree on the chain tip and, if
+// query is set, on its answer, which convert turns into output format. The
+// report lists every dissenting miner; the command fails without quorum.
+func quorumRead(spec string, miners []string, query func(miner string) (interface{}, error), convert func(interface{}) (interface{}, error)) {
+	q, err := quorum.ParseSpec(spec)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+
+	output := QuorumOutput{Quorum: q.String()}
+	fail := func(err error) {
+		output.Error = err.Error()
+		outputJSON(output)
+		os.Exit(1)
+	}
+
+	output.TipCheck, err = quorum.Ask(q, miners, func(miner string) (interface{}, error) {
+		var status network.StatusReply
+		if err := callMiner(miner, "RPCService.GetStatus", &struct{}{}, &status); err != nil {
+			return nil, err
+		}
+		return TipInfo{Height: int64(status.ChainLength - 1), Hash: status.TipHash}, nil
+	})
+	if err != nil {
+		fail(err)
+	}
+	tip := output.TipCheck.Value.(TipInfo)
+	output.Tip = &tip
+
+	if query != nil {
+		check, err := quorum.Ask(q, miners, query)
+		output.ResultCheck = &check
+		if err != nil {
+			fail(err)
+		}
+		if output.Result, err = convert(check.Value); err != nil {
+			fail(err)
+		}
+	}
+	outputJSON(output)
+}
+
+// quorumBalance reads an address's balance and UTXOs under quorum
+func quorumBalance(spec string, miners []string, address string) {
+	quorumRead(spec, miners, func(miner string) (interface{}, error) {
+		var reply network.AddressReply
+		err := callMiner(miner, "RPCService.GetAddress", &network.AddressArgs{Address: address}, &reply)
+		return reply, err
+	}, func(v interface{}) (interface{}, error) {
+		reply := v.(network.AddressReply)
+		utxos := make([]UTXOOutput, len(reply.UTXOs))
+		for i, utxo := range reply.UTXOs {
+			utxos[i] = UTXOOutput{
+				TxID:         utxo.TxID,
+				OutIndex:     utxo.OutIndex,
+				Value:        utxo.Value,
+				ValueBTC:     float64(utxo.Value) / transaction.SatoshiPerBTC,
+				ScriptPubKey: utxo.ScriptPubKey,
+			}
+		}
+		return WalletStatusOutput{
+			Address:    address,
+			Balance:    reply.Balance,
+			BalanceBTC: float64(reply.Balance) / transaction.SatoshiPerBTC,
+			UTXOs:      utxos,
+			UTXOCount:  len(utxos),
+		}, nil
+	})
+}
+
+// quorumSearch runs a search under quorum
+func quorumSearch(spec string, miners []string, query string) {
+	quorumRead(spec, miners, func(miner string) (interface{}, error) {
+		var reply network.SearchReply
+		err := callMiner(miner, "RPCService.Search", &network.SearchArgs{Query: query}, &reply)
+		return reply, err
+	}, func(v interface{}) (interface{}, error) {
+		return convertSearch(query, v.(network.SearchReply))
+	})
+}
+
+// quorumSupply reads the coin supply under quorum
+func quorumSupply(spec string, miners []string) {
+	quorumRead(spec, miners, func(miner string) (interface{}, error) {
+		var reply network.SupplyReply
+		err := callMiner(miner, "RPCService.GetSupply", &struct{}{}, &reply)
+		return reply, err
+	}, func(v interface{}) (interface{}, error) {
+		return convertSupply(v.(network.SupplyReply)), nil
+	})
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/network"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// topDialTimeout bounds how long one unreachable miner can stall a refresh
+const topDialTimeout = 2 * time.Second
+
+// minerSnapshot is one miner's status at refresh time
+type minerSnapshot struct {
+	address string
+	status  network.StatusReply
+	err     error
+}
+
+// dialMiner connects to a miner, giving up after topDialTimeout
+func dialMiner(address string) (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", address, topDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := cli.Credentials()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := rpc.NewClient(conn)
+	if err := network.AuthenticateClient(client, cred); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// pollMiners fetches the status of every miner concurrently
+func pollMiners(addresses []string) []minerSnapshot {
+	snaps := make([]minerSnapshot, len(addresses))
+	done := make(chan struct{})
+	for i, addr := range addresses {
+		go func(i int, addr string) {
+			defer func() { done <- struct{}{} }()
+			snaps[i].address = addr
+			client, err := dialMiner(addr)
+			if err != nil {
+				snaps[i].err = err
+				return
+			}
+			defer client.Close()
+			snaps[i].err = client.Call("RPCService.GetStatus", &struct{}{}, &snaps[i].status)
+		}(i, addr)
+	}
+	for range addresses {
+		<-done
+	}
+	return snaps
+}
+
+// fetchRecentBlocks returns the last n blocks of a miner's chain, newest first
+func fetchRecentBlocks(address string, length, n int) ([]*block.Block, error) {
+	client, err := dialMiner(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	start := length - n
+	if start < 0 {
+		start = 0
+	}
+	chain, err := network.FetchChain(client, int64(start))
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*block.Block
+	for i := len(chain) - 1; i >= 0 && len(blocks) < n; i-- {
+		b, err := block.DeserializeBlock(chain[i])
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// formatHashRate renders hashes per second with a unit suffix
+func formatHashRate(rate float64) string {
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s"}
+	i := 0
+	for rate >= 1000 && i < len(units)-1 {
+		rate /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", rate, units[i])
+}
+
+// renderTop draws one frame of the dashboard
+func renderTop(snaps []minerSnapshot, recent []*block.Block, recentFrom string, interval time.Duration) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "client top - %s - refresh %s - Ctrl-C to quit\n\n", time.Now().Format("15:04:05"), interval)
+
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MINER\tADDRESS\tHEIGHT\tDIFF\tHASHRATE\tMINED\tMEMPOOL\tPEERS\tSTATE")
+	var totalRate float64
+	for _, s := range snaps {
+		if s.err != nil {
+			fmt.Fprintf(w, "-\t%s\t-\t-\t-\t-\t-\t-\tDOWN (%v)\n", s.address, s.err)
+			continue
+		}
+		state := "idle"
+		if s.status.Mining {
+			state = "mining"
+		} else if s.status.Paused != "" {
+			state = "paused (" + s.status.Paused + ")"
+		}
+		totalRate += s.status.HashRate
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%d\t%d\t%d\t%s\n",
+			shortID(s.status.ID), s.address, s.status.ChainLength-1, s.status.Difficulty,
+			formatHashRate(s.status.HashRate), s.status.BlocksMined, s.status.PendingTxs, s.status.Peers, state)
+	}
+	w.Flush()
+	fmt.Fprintf(&sb, "\nNetwork hash rate: %s\n", formatHashRate(totalRate))
+
+	if len(recent) > 0 {
+		fmt.Fprintf(&sb, "\nRecent blocks (from %s)\n", recentFrom)
+		w = tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HEIGHT\tHASH\tMINER\tTXS\tAGE")
+		for _, b := range recent {
+			age := time.Since(time.Unix(0, b.Timestamp)).Truncate(time.Second)
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", b.Index, b.Hash[:16], shortID(b.MinerID), len(b.Transactions), age)
+		}
+		w.Flush()
+	}
+	return sb.String()
+}
+
+// runTop refreshes a live view of the given miners until interrupted
+func runTop(addresses []string, interval time.Duration, recentCount int, once bool) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		snaps := pollMiners(addresses)
+
+		// Show recent blocks from the miner with the longest chain
+		var recent []*block.Block
+		var recentFrom string
+		best := -1
+		for i, s := range snaps {
+			if s.err == nil && (best < 0 || s.status.ChainLength > snaps[best].status.ChainLength) {
+				best = i
+			}
+		}
+		if best >= 0 && recentCount > 0 {
+			recentFrom = snaps[best].address
+			recent, _ = fetchRecentBlocks(recentFrom, snaps[best].status.ChainLength, recentCount)
+		}
+
+		frame := renderTop(snaps, recent, recentFrom, interval)
+		if once {
+			fmt.Print(frame)
+			return
+		}
+		// Clear the screen and move the cursor home before each frame
+		fmt.Print("\033[H\033[2J" + frame)
+
+		select {
+		case <-sigChan:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// shortID returns the first 6 characters of an ID for display
+func shortID(id string) string {
+	if len(id) <= 6 {
+		return id
+	}
+	return id[:6]
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"blockchain/pkg/network"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TxStatusOutput reports where a transaction stands on a miner in JSON format
+type TxStatusOutput struct {
+	TxID          string  `json:"txid"`
+	Status        string  `json:"status"` // pending, confirmed, dropped, or unknown
+	TipHeight     int64   `json:"tip_height"`
+	BlockHeight   int64   `json:"block_height,omitempty"`
+	BlockHash     string  `json:"block_hash,omitempty"`
+	Confirmations int64   `json:"confirmations"`
+	Fee           int64   `json:"fee,omitempty"`
+	FeeRate       float64 `json:"fee_rate,omitempty"` // Satoshi per byte
+	PendingFor    string  `json:"pending_for,omitempty"`
+	Reason        string  `json:"reason,omitempty"`
+}
+
+// txStatus outputs whether a transaction is pending, confirmed, or dropped
+func txStatus(minerAddr, txID string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.TxStatusReply
+	if err := client.Call("RPCService.GetTxStatus", &network.TxQueryArgs{TxID: txID}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get transaction status: %v", err))
+		os.Exit(1)
+	}
+	output := TxStatusOutput{
+		TxID:          reply.TxID,
+		Status:        reply.Status,
+		TipHeight:     reply.Height,
+		BlockHeight:   reply.BlockHeight,
+		BlockHash:     reply.BlockHash,
+		Confirmations: reply.Confirmations,
+		Fee:           reply.Fee,
+		FeeRate:       reply.FeeRate,
+		Reason:        reply.Reason,
+	}
+	if reply.Status == network.TxPending {
+		output.PendingFor = reply.Pending.Round(time.Second).String()
+	}
+	outputJSON(output)
+}
+
+// MerkleProofOutput reports a confirmed transaction's Merkle proof in JSON format
+type MerkleProofOutput struct {
+	TxID        string   `json:"txid"`
+	Verified    bool     `json:"verified"` // The proof leads to the header's Merkle root and the header is well formed
+	BlockHeight int64    `json:"block_height"`
+	BlockHash   string   `json:"block_hash"`
+	MerkleRoot  string   `json:"merkle_root"`
+	Siblings    []string `json:"siblings"`
+	Directions  []bool   `json:"directions"` // true = sibling is on the right
+	TipHeight   int64    `json:"tip_height"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// merkleProof fetches a confirmed transaction's Merkle proof and checks it
+// against the header served with it. This shows the transaction is in that
+// block, not that the block is in the main chain; the spv command checks that
+// against its own headers.
+func merkleProof(minerAddr, txID string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply network.MerkleProofReply
+	if err := client.Call("RPCService.GetMerkleProof", &network.TxQueryArgs{TxID: txID}, &reply); err != nil {
+		outputError(fmt.Sprintf("failed to get Merkle proof: %v", err))
+		os.Exit(1)
+	}
+	output := MerkleProofOutput{
+		TxID:        txID,
+		Verified:    true,
+		BlockHeight: reply.Header.Index,
+		BlockHash:   reply.BlockHash,
+		MerkleRoot:  reply.Header.MerkleRoot,
+		TipHeight:   reply.Height,
+	}
+	if reply.Proof != nil {
+		output.Siblings = reply.Proof.Siblings
+		output.Directions = reply.Proof.Directions
+	}
+	if err := network.VerifyMerkleProof(txID, &reply); err != nil {
+		output.Verified = false
+		output.Error = err.Error()
+	}
+	outputJSON(output)
+	if !output.Verified {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"blockchain/pkg/blockchain"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// UpgradeNodeOutput is one miner's chain params in JSON format
+type UpgradeNodeOutput struct {
+	Miner      string   `json:"miner"`
+	Error      string   `json:"error,omitempty"`
+	ParamsHash string   `json:"params_hash,omitempty"`
+	Changes    []string `json:"changes,omitempty"` // Scheduled parameter changes the miner knows of
+	TipHeight  int64    `json:"tip_height"`
+	TipHash    string   `json:"tip_hash,omitempty"`
+	Upgraded   bool     `json:"upgraded"`
+}
+
+// UpgradeCheckOutput reports which miners run the expected chain params in JSON format
+type UpgradeCheckOutput struct {
+	Expected    string              `json:"expected"` // What counted as upgraded
+	Upgraded    []string            `json:"upgraded"`
+	NotUpgraded []string            `json:"not_upgraded"`
+	Unreachable []string            `json:"unreachable"`
+	Miners      []UpgradeNodeOutput `json:"miners"`
+}
+
+// changeLabel names a scheduled change by its name, or its height if unnamed
+func changeLabel(c blockchain.ParamChange) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("height-%d", c.Height)
+}
+
+// checkUpgrades reports which miners run the chain params in paramsFile, know
+// the scheduled change named change, or (with neither) match the params most
+// miners run. It exits with status 2 if any reachable miner has not upgraded.
+func checkUpgrades(addresses []string, paramsFile, change string) {
+	var expectedHash string
+	output := UpgradeCheckOutput{Upgraded: []string{}, NotUpgraded: []string{}, Unreachable: []string{}}
+	switch {
+	case paramsFile != "":
+		params, err := blockchain.LoadChainParams(paramsFile)
+		if err != nil {
+			outputError(err.Error())
+			os.Exit(1)
+		}
+		expectedHash = params.Fingerprint()
+		output.Expected = "params " + expectedHash
+	case change != "":
+		output.Expected = "change " + change
+	}
+
+	snaps := pollMiners(addresses)
+	if output.Expected == "" {
+		// Without a reference, the most common fingerprint counts as upgraded
+		counts := make(map[string]int)
+		for _, snap := range snaps {
+			if snap.err == nil {
+				counts[snap.status.ParamsHash]++
+				if counts[snap.status.ParamsHash] > counts[expectedHash] {
+					expectedHash = snap.status.ParamsHash
+				}
+			}
+		}
+		output.Expected = "majority params " + expectedHash
+	}
+
+	for _, snap := range snaps {
+		node := UpgradeNodeOutput{Miner: snap.address}
+		if snap.err != nil {
+			node.Error = snap.err.Error()
+			output.Unreachable = append(output.Unreachable, snap.address)
+			output.Miners = append(output.Miners, node)
+			continue
+		}
+		node.ParamsHash = snap.status.ParamsHash
+		node.TipHeight = int64(snap.status.ChainLength) - 1
+		node.TipHash = snap.status.TipHash
+		for _, c := range snap.status.Upgrades {
+			node.Changes = append(node.Changes, changeLabel(c))
+		}
+		if change != "" && paramsFile == "" {
+			node.Upgraded = slices.Contains(node.Changes, change)
+		} else {
+			node.Upgraded = node.ParamsHash == expectedHash
+		}
+		if node.Upgraded {
+			output.Upgraded = append(output.Upgraded, snap.address)
+		} else {
+			output.NotUpgraded = append(output.NotUpgraded, snap.address)
+		}
+		output.Miners = append(output.Miners, node)
+	}
+
+	outputJSON(output)
+	if len(output.NotUpgraded) > 0 {
+		os.Exit(2)
+	}
+}
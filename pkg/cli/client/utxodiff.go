@@ -0,0 +1,203 @@
+package client
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/network"
+	"fmt"
+	"net/rpc"
+	"os"
+)
+
+// SnapshotSource describes one side of a UTXO set comparison in JSON format
+type SnapshotSource struct {
+	Source  string `json:"source"` // Snapshot file or miner address
+	Live    bool   `json:"live"`
+	Height  int64  `json:"height"`
+	TipHash string `json:"tip_hash"`
+	UTXOs   int    `json:"utxos"`
+}
+
+// SnapshotDiffOutput reports how UTXO set B differs from A in JSON format
+type SnapshotDiffOutput struct {
+	A         SnapshotSource `json:"a"`
+	B         SnapshotSource `json:"b"`
+	Identical bool           `json:"identical"`
+	// First height whose block hashes differ; only checked between live miners
+	ForkHeight *int64 `json:"fork_height,omitempty"`
+	// Lowest creation height among the differing outputs (-1 = none)
+	FirstDivergence int64  `json:"first_divergence"`
+	Note            string `json:"note,omitempty"`
+	blockchain.SnapshotDiff
+}
+
+// SnapshotSavedOutput reports a UTXO snapshot written to a file in JSON format
+type SnapshotSavedOutput struct {
+	Miner   string `json:"miner"`
+	File    string `json:"file"`
+	Height  int64  `json:"height"`
+	TipHash string `json:"tip_hash"`
+	UTXOs   int    `json:"utxos"`
+}
+
+// fetchSnapshot downloads a miner's UTXO set at its tip
+func fetchSnapshot(client *rpc.Client) (blockchain.UTXOSnapshot, error) {
+	var snap blockchain.UTXOSnapshot
+	err := client.Call("RPCService.GetUTXOSnapshot", &struct{}{}, &snap)
+	return snap, err
+}
+
+// saveSnapshot writes a miner's UTXO set to file, or prints it if file is empty
+func saveSnapshot(minerAddr, file string) {
+	client, err := dialRPC(minerAddr)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to connect to miner: %v", err))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	snap, err := fetchSnapshot(client)
+	if err != nil {
+		outputError(fmt.Sprintf("failed to get UTXO snapshot: %v", err))
+		os.Exit(1)
+	}
+	if file == "" {
+		outputJSON(snap)
+		return
+	}
+	if err := blockchain.WriteSnapshot(file, snap); err != nil {
+		outputError(fmt.Sprintf("failed to write snapshot: %v", err))
+		os.Exit(1)
+	}
+	outputJSON(SnapshotSavedOutput{Miner: minerAddr, File: file, Height: snap.Height, TipHash: snap.TipHash, UTXOs: len(snap.UTXOs)})
+}
+
+// openSnapshot reads source as a snapshot file if one exists at that path,
+// and otherwise fetches it from the miner at that address. The returned
+// client is nil for files; callers close it.
+func openSnapshot(source string) (blockchain.UTXOSnapshot, *rpc.Client, error) {
+	if _, err := os.Stat(source); err == nil {
+		snap, err := blockchain.ReadSnapshot(source)
+		return snap, nil, err
+	}
+	client, err := dialRPC(source)
+	if err != nil {
+		return blockchain.UTXOSnapshot{}, nil, fmt.Errorf("%s is neither a snapshot file nor a reachable miner: %v", source, err)
+	}
+	snap, err := fetchSnapshot(client)
+	if err != nil {
+		client.Close()
+		return snap, nil, fmt.Errorf("failed to get UTXO snapshot from %s: %v", source, err)
+	}
+	return snap, client, nil
+}
+
+// blockHashAt returns the hash of a miner's block at height
+func blockHashAt(client *rpc.Client, height int64) (string, error) {
+	var reply network.BlockQueryReply
+	if err := client.Call("RPCService.GetBlock", &network.BlockQueryArgs{Height: height}, &reply); err != nil {
+		return "", err
+	}
+	if !reply.Found {
+		return "", fmt.Errorf("no block at height %d", height)
+	}
+	b, err := block.DeserializeBlock(reply.BlockData)
+	if err != nil {
+		return "", err
+	}
+	return b.Hash, nil
+}
+
+// findForkHeight returns the first height up to maxHeight at which the two
+// miners' chains hold different blocks, or -1 if they agree up to maxHeight.
+// Chains that differ at a height differ at every later one, so a binary
+// search needs only a few lookups.
+func findForkHeight(a, b *rpc.Client, maxHeight int64) (int64, error) {
+	differs := func(h int64) (bool, error) {
+		ha, err := blockHashAt(a, h)
+		if err != nil {
+			return false, err
+		}
+		hb, err := blockHashAt(b, h)
+		if err != nil {
+			return false, err
+		}
+		return ha != hb, nil
+	}
+	if d, err := differs(maxHeight); err != nil || !d {
+		return -1, err
+	}
+	lo, hi := int64(0), maxHeight // Invariant: the chains differ at hi
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		d, err := differs(mid)
+		if err != nil {
+			return -1, err
+		}
+		if d {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return hi, nil
+}
+
+// diffSnapshots compares the UTXO sets of two snapshot files or live miners.
+// It exits with status 2 if they differ, for use in scripts.
+func diffSnapshots(sourceA, sourceB string) {
+	snapA, clientA, err := openSnapshot(sourceA)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	if clientA != nil {
+		defer clientA.Close()
+	}
+	snapB, clientB, err := openSnapshot(sourceB)
+	if err != nil {
+		outputError(err.Error())
+		os.Exit(1)
+	}
+	if clientB != nil {
+		defer clientB.Close()
+	}
+
+	diff := blockchain.DiffSnapshots(snapA, snapB)
+	output := SnapshotDiffOutput{
+		A:               SnapshotSource{Source: sourceA, Live: clientA != nil, Height: snapA.Height, TipHash: snapA.TipHash, UTXOs: len(snapA.UTXOs)},
+		B:               SnapshotSource{Source: sourceB, Live: clientB != nil, Height: snapB.Height, TipHash: snapB.TipHash, UTXOs: len(snapB.UTXOs)},
+		Identical:       diff.Empty(),
+		FirstDivergence: diff.FirstHeight(),
+		SnapshotDiff:    diff,
+	}
+
+	if clientA != nil && clientB != nil {
+		maxHeight := snapA.Height
+		if snapB.Height < maxHeight {
+			maxHeight = snapB.Height
+		}
+		fork, err := findForkHeight(clientA, clientB, maxHeight)
+		if err != nil {
+			output.Note = fmt.Sprintf("could not locate the fork: %v", err)
+		} else if fork >= 0 {
+			output.ForkHeight = &fork
+			output.Note = fmt.Sprintf("the chains fork at height %d, so their UTXO sets are expected to differ from there", fork)
+		}
+	}
+	if output.Note == "" {
+		switch {
+		case snapA.Height != snapB.Height:
+			output.Note = fmt.Sprintf("snapshots are at different heights (%d and %d); outputs created or spent in between also differ", snapA.Height, snapB.Height)
+		case snapA.TipHash != snapB.TipHash:
+			output.Note = "snapshots are of different chain tips at the same height"
+		case !diff.Empty():
+			output.Note = "same chain tip but different UTXO sets: the nodes applied the same blocks differently"
+		}
+	}
+
+	outputJSON(output)
+	if !output.Identical {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"blockchain/pkg/config"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config holds flag values read from a configuration file shared by all
+// commands, in JSON, YAML, or TOML (see config.File). A top-level key sets the
+// flag of that name in every command that defines one; a section under a
+// command's name sets that command's flags and takes precedence. Lists are
+// joined with commas. Flags given on the command line override both.
+//
+// A file may describe several networks in sections named network.<name>. The
+// values of the one chosen with -network, or named by the network key, sit
+// between the top-level keys and the command's section.
+//
+//	{
+//	  "miner": "10.0.0.5:8001",
+//	  "log-level": "warn",
+//	  "network": "lab",
+//	  "node": {"id": "m1"},
+//	  "network.lab": {"chain-params": "lab.json", "peers": ["10.0.0.6:8001", "10.0.0.7:8001"]},
+//	  "network.local": {"difficulty": 4, "peers": ["localhost:8002"]}
+//	}
+//
+// The keys listen and data_dir also set -address and -datadir. Keys no flag
+// matches are ignored, since commands define different flags.
+type Config struct {
+	Path     string
+	Network  string // The network whose values apply, "" for none
+	values   map[string]string
+	network  map[string]string
+	sections map[string]map[string]string
+}
+
+// LoadConfig reads a configuration file, using the values of network, or if
+// that is "", of the network the file names. An empty path gives an empty
+// config, in which no network can be chosen.
+func LoadConfig(path, network string) (*Config, error) {
+	c := &Config{Path: path, values: map[string]string{}, sections: map[string]map[string]string{}}
+	if path == "" {
+		if network != "" {
+			return nil, fmt.Errorf("network %s chosen without a configuration file", network)
+		}
+		return c, nil
+	}
+	f, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	c.values, c.sections = f.Values, f.Sections
+	if network == "" {
+		network = f.Values["network"]
+	}
+	if network == "" {
+		return c, nil
+	}
+	values, ok := f.Network(network)
+	if !ok {
+		return nil, fmt.Errorf("config %s: no network %q (networks: %s)", path, network, strings.Join(f.Networks(), ", "))
+	}
+	c.Network, c.network = network, values
+	return c, nil
+}
+
+// configAliases are config keys read as the flag they name, for settings
+// whose flag name is terse
+var configAliases = map[string]string{
+	"listen":   "address",
+	"data-dir": "datadir",
+}
+
+// Apply sets the flags of fs named by the top-level keys, then those of the
+// network, then those named in the section of the command. A nil config sets
+// nothing.
+func (c *Config) Apply(fs *flag.FlagSet, section string) error {
+	if c == nil {
+		return nil
+	}
+	for _, values := range []map[string]string{c.values, c.network, c.sections[section]} {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			flagName := name
+			if alias, ok := configAliases[name]; ok && fs.Lookup(name) == nil {
+				flagName = alias
+			}
+			if fs.Lookup(flagName) == nil {
+				continue
+			}
+			if err := fs.Set(flagName, values[name]); err != nil {
+				return fmt.Errorf("config %s: -%s: %v", c.Path, flagName, err)
+			}
+		}
+	}
+	return nil
+}
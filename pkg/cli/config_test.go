@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	return writeConfigFile(t, "config.json", data)
+}
+
+func writeConfigFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestConfigSetsFlagsBySection(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `{
+		"miner": "10.0.0.5:8001",
+		"difficulty": 6,
+		"node": {"id": "m1", "peers": ["a:8001", "b:8001"], "mine": false, "difficulty": 8},
+		"wallet": {"miner": "10.0.0.9:8001"}
+	}`), "")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	fs := flag.NewFlagSet("node", flag.ContinueOnError)
+	id := fs.String("id", "", "")
+	peers := fs.String("peers", "", "")
+	mine := fs.Bool("mine", true, "")
+	difficulty := fs.Int("difficulty", 4, "")
+	address := fs.String("address", "0.0.0.0:8001", "")
+	if err := config.Apply(fs, "node"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := fs.Parse([]string{"-id", "m2"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// The command line wins over the section, which wins over the top level
+	if *id != "m2" || *peers != "a:8001,b:8001" || *mine || *difficulty != 8 || *address != "0.0.0.0:8001" {
+		t.Errorf("Unexpected flags: id %q, peers %q, mine %v, difficulty %d, address %q", *id, *peers, *mine, *difficulty, *address)
+	}
+
+	fs = flag.NewFlagSet("balance", flag.ContinueOnError)
+	miner := fs.String("miner", "localhost:8001", "")
+	if err := config.Apply(fs, "wallet"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if *miner != "10.0.0.9:8001" {
+		t.Errorf("Expected the wallet section's miner, got %q", *miner)
+	}
+
+	var none *Config
+	if err := none.Apply(fs, "wallet"); err != nil {
+		t.Errorf("A nil config should set nothing, got %v", err)
+	}
+}
+
+func TestYAMLConfigWithAliases(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, "miners.yaml", `
+difficulty: 5
+node:
+  listen: 0.0.0.0:8002
+  data_dir: /var/lib/m2
+  peers: [a:8001, b:8001]
+`), "")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	fs := flag.NewFlagSet("node", flag.ContinueOnError)
+	address := fs.String("address", "0.0.0.0:8001", "")
+	dataDir := fs.String("datadir", "", "")
+	peers := fs.String("peers", "", "")
+	difficulty := fs.Int("difficulty", 4, "")
+	if err := config.Apply(fs, "node"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if *address != "0.0.0.0:8002" || *dataDir != "/var/lib/m2" || *peers != "a:8001,b:8001" || *difficulty != 5 {
+		t.Errorf("Unexpected flags: address %q, datadir %q, peers %q, difficulty %d", *address, *dataDir, *peers, *difficulty)
+	}
+}
+
+func TestConfigRejectsBadValues(t *testing.T) {
+	for _, data := range []string{`{"peers": [["a"]]}`, `{"node": {"id": null}}`, `[1, 2]`} {
+		if _, err := LoadConfig(writeConfig(t, data), ""); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+
+	config, err := LoadConfig(writeConfig(t, `{"difficulty": "hard"}`), "")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	fs := flag.NewFlagSet("node", flag.ContinueOnError)
+	fs.Int("difficulty", 4, "")
+	if err := config.Apply(fs, "node"); err == nil || !strings.Contains(err.Error(), "-difficulty") {
+		t.Errorf("Expected an error naming the flag, got %v", err)
+	}
+}
+
+func TestConfigSelectsNetwork(t *testing.T) {
+	path := writeConfigFile(t, "networks.toml", `
+difficulty = 6
+log_level = "warn"
+network = "lab"
+
+[node]
+id = "m1"
+difficulty = 8
+
+[network.lab]
+peers = ["10.0.0.6:8001", "10.0.0.7:8001"]
+chain_params = "lab.json"
+
+[network.local]
+peers = ["localhost:8002"]
+difficulty = 4
+`)
+	apply := func(network string) *Common {
+		config, err := LoadConfig(path, network)
+		if err != nil {
+			t.Fatalf("LoadConfig(%q) failed: %v", network, err)
+		}
+		fs := flag.NewFlagSet("node", flag.ContinueOnError)
+		common := AddCommonFlags(fs)
+		fs.String("peers", "", "")
+		fs.Int("difficulty", 4, "")
+		if err := config.Apply(fs, "node"); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if peers := fs.Lookup("peers").Value.String(); peers != map[string]string{"lab": "10.0.0.6:8001,10.0.0.7:8001", "local": "localhost:8002"}[config.Network] {
+			t.Errorf("Unexpected peers for network %q: %q", config.Network, peers)
+		}
+		// The command's section wins over the network
+		if difficulty := fs.Lookup("difficulty").Value.String(); difficulty != "8" {
+			t.Errorf("Expected the node section's difficulty, got %s", difficulty)
+		}
+		return common
+	}
+
+	// The file's network key chooses, unless a network is given
+	if common := apply(""); common.ChainParams != "lab.json" || common.LogLevel != slog.LevelWarn {
+		t.Errorf("Expected the lab network's chain params at level warn, got %+v", common)
+	}
+	if common := apply("local"); common.ChainParams != "" {
+		t.Errorf("Expected no chain params on the local network, got %q", common.ChainParams)
+	}
+
+	if _, err := LoadConfig(path, "prod"); err == nil || !strings.Contains(err.Error(), "lab, local") {
+		t.Errorf("Expected an unknown network to be refused with the known ones, got %v", err)
+	}
+	if _, err := LoadConfig("", "lab"); err == nil {
+		t.Error("Expected a network to need a configuration file")
+	}
+	config, err := LoadConfig(writeConfig(t, `{"log-level": "loud"}`), "")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := config.Apply(flag.NewFlagSet("node", flag.ContinueOnError), "node"); err != nil {
+		t.Errorf("A flag the command lacks should be skipped, got %v", err)
+	}
+	fs := flag.NewFlagSet("node", flag.ContinueOnError)
+	AddCommonFlags(fs)
+	if err := config.Apply(fs, "node"); err == nil || !strings.Contains(err.Error(), "-log-level") {
+		t.Errorf("Expected an unknown log level to be refused, got %v", err)
+	}
+}
+
+func TestParsePeers(t *testing.T) {
+	peers := ParsePeers("localhost:8002, localhost:8003")
+	if len(peers) != 2 || peers[0].ID != "peer0" || peers[1].Address != "localhost:8003" {
+		t.Errorf("Unexpected peers: %+v", peers)
+	}
+	if peers := ParsePeers(""); len(peers) != 0 {
+		t.Errorf("Expected no peers, got %+v", peers)
+	}
+}
@@ -0,0 +1,287 @@
+// Package export writes the chain as normalized CSV or Parquet tables for
+// analysis in notebooks. It is the export command of the blockchain binary
+// and the whole of the export binary.
+package export
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Command exports the chain as tables
+var Command = cli.Command{Name: "export", Summary: "Export the chain as CSV or Parquet tables for notebooks", Run: run}
+
+// outputRow is an output awaiting its spent_by columns
+type outputRow struct {
+	txID        string
+	index       int
+	address     string
+	value       int64
+	spentBy     string
+	spentHeight int64
+}
+
+// kind is the type of a column's values: string, int64, or bool
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindBool
+)
+
+func (k kind) parquetType() int32 {
+	switch k {
+	case kindInt:
+		return parquetInt64
+	case kindBool:
+		return parquetBoolean
+	}
+	return parquetByteArray
+}
+
+// column describes a column of an exported table
+type column struct {
+	name     string
+	kind     kind
+	optional bool // May be missing: inputs spending unknown outputs, unspent outputs
+}
+
+func text(name string) column    { return column{name: name, kind: kindString} }
+func integer(name string) column { return column{name: name, kind: kindInt} }
+func boolean(name string) column { return column{name: name, kind: kindBool} }
+
+// optional returns col allowed to be missing
+func optional(col column) column {
+	col.optional = true
+	return col
+}
+
+// table is a table being written in one of the export formats. Rows hold a
+// string, int64, or bool per column, or nil for a missing value.
+type table interface {
+	write(row ...any) error
+	close() error
+}
+
+// createTable creates the table name in dir, in format
+func createTable(format, dir, name string, columns []column) (table, error) {
+	if format == "parquet" {
+		return createParquetTable(dir, name, columns)
+	}
+	return createCSVTable(dir, name, columns)
+}
+
+// csvTable wraps a CSV file being written
+type csvTable struct {
+	file *os.File
+	w    *csv.Writer
+}
+
+// createCSVTable creates name.csv in dir and writes its header row
+func createCSVTable(dir, name string, columns []column) (*csvTable, error) {
+	file, err := os.Create(filepath.Join(dir, name+".csv"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s table: %v", name, err)
+	}
+	t := &csvTable{file: file, w: csv.NewWriter(file)}
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	if err := t.w.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// write writes a row, leaving missing values empty
+func (t *csvTable) write(row ...any) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		switch v := v.(type) {
+		case string:
+			record[i] = v
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		}
+	}
+	return t.w.Write(record)
+}
+
+// close flushes and closes the table file
+func (t *csvTable) close() error {
+	t.w.Flush()
+	if err := t.w.Error(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
+
+// fetchChain downloads the full chain from a miner, presenting the
+// credentials in the environment as the client does
+func fetchChain(minerAddr string) ([]*block.Block, error) {
+	cred, err := cli.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	client, err := network.DialMiner(minerAddr, cred)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to miner: %v", err)
+	}
+	defer client.Close()
+
+	chain, err := network.FetchChain(client, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blockchain: %v", err)
+	}
+
+	blocks := make([]*block.Block, len(chain))
+	for i, data := range chain {
+		b, err := block.DeserializeBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize block: %v", err)
+		}
+		blocks[i] = b
+	}
+	return blocks, nil
+}
+
+// exportChain writes blocks, transactions, inputs, and outputs tables to dir
+// in format. Inputs are resolved to the address and value they spend, and
+// every output records the transaction and height that spent it (missing if
+// unspent).
+func exportChain(blocks []*block.Block, format, dir string) error {
+	blocksTable, err := createTable(format, dir, "blocks", []column{
+		integer("height"), text("hash"), text("prev_hash"), integer("timestamp"), integer("nonce"),
+		integer("difficulty"), text("miner_id"), text("merkle_root"), integer("tx_count")})
+	if err != nil {
+		return err
+	}
+	txTable, err := createTable(format, dir, "transactions", []column{
+		text("txid"), integer("block_height"), text("block_hash"), integer("position"), boolean("is_coinbase"),
+		integer("input_count"), integer("output_count"), integer("total_output"), integer("fee")})
+	if err != nil {
+		return err
+	}
+	inputTable, err := createTable(format, dir, "inputs", []column{
+		text("txid"), integer("input_index"), text("prev_txid"), integer("prev_out_index"),
+		optional(text("address")), optional(integer("value"))})
+	if err != nil {
+		return err
+	}
+
+	outputs := make(map[string]*outputRow)
+	var outputOrder []*outputRow
+
+	for _, b := range blocks {
+		if err := blocksTable.write(b.Index, b.Hash, b.PrevHash, b.Timestamp, b.Nonce,
+			int64(b.Difficulty), b.MinerID, b.MerkleRoot, int64(len(b.Transactions))); err != nil {
+			return err
+		}
+
+		for pos, tx := range b.Transactions {
+			var inputTotal int64
+			if !tx.IsCoinbase() {
+				for i, in := range tx.Inputs {
+					var address, value any
+					if out, ok := outputs[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)]; ok {
+						address, value = out.address, out.value
+						inputTotal += out.value
+						out.spentBy, out.spentHeight = tx.ID, b.Index
+					}
+					if err := inputTable.write(tx.ID, int64(i), in.TxID, int64(in.OutIndex), address, value); err != nil {
+						return err
+					}
+				}
+			}
+
+			outputTotal := tx.TotalOutputValue()
+			var fee int64
+			if !tx.IsCoinbase() && inputTotal > outputTotal {
+				fee = inputTotal - outputTotal
+			}
+			if err := txTable.write(tx.ID, b.Index, b.Hash, int64(pos), tx.IsCoinbase(),
+				int64(len(tx.Inputs)), int64(len(tx.Outputs)), outputTotal, fee); err != nil {
+				return err
+			}
+
+			for i, out := range tx.Outputs {
+				row := &outputRow{txID: tx.ID, index: i, address: out.ScriptPubKey, value: out.Value, spentHeight: -1}
+				outputs[fmt.Sprintf("%s:%d", tx.ID, i)] = row
+				outputOrder = append(outputOrder, row)
+			}
+		}
+	}
+
+	outputTable, err := createTable(format, dir, "outputs", []column{
+		text("txid"), integer("out_index"), text("address"), integer("value"),
+		optional(text("spent_by_txid")), optional(integer("spent_height"))})
+	if err != nil {
+		return err
+	}
+	for _, row := range outputOrder {
+		var spentBy, spentHeight any
+		if row.spentHeight >= 0 {
+			spentBy, spentHeight = row.spentBy, row.spentHeight
+		}
+		if err := outputTable.write(row.txID, int64(row.index), row.address, row.value, spentBy, spentHeight); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range []table{blocksTable, txTable, inputTable, outputTable} {
+		if err := t.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func run(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	minerAddr := fs.String("miner", "localhost:8001", "Miner address to export the chain from")
+	outDir := fs.String("out", "export", "Directory to write the tables to")
+	format := fs.String("format", "csv", "Table format: csv or parquet")
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s [-miner <addr>] [-out <dir>] [-format csv|parquet]\n", ctx.Prog)
+		fmt.Println()
+		fmt.Println("Writes the blocks, transactions, inputs, and outputs tables of a miner's chain.")
+		fmt.Printf("Miners restricting RPC access are dialed with the credentials in $%s or $%s,\n", cli.TokenEnv, cli.KeyFileEnv)
+		fmt.Printf("and over TLS when $%s or $%s is set, as the client does.\n", cli.TLSCAEnv, cli.TLSCertEnv)
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	ctx.Parse(fs, args)
+	if *format != "csv" && *format != "parquet" {
+		logging.Fatalf("Unknown format %q: use csv or parquet", *format)
+	}
+
+	blocks, err := fetchChain(*minerAddr)
+	if err != nil {
+		logging.Fatalf("Failed to fetch chain: %v", err)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		logging.Fatalf("Failed to create output directory: %v", err)
+	}
+	if err := exportChain(blocks, *format, *outDir); err != nil {
+		logging.Fatalf("Failed to export chain: %v", err)
+	}
+
+	log.Printf("Exported %d blocks to %s (blocks, transactions, inputs, and outputs tables in %s)", len(blocks), *outDir, *format)
+}
@@ -0,0 +1,126 @@
+package export
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testChain returns two blocks: a coinbase paying alice, then a payment from
+// it to an address needing quotes in CSV, with change to alice and one input
+// spending an output the chain never had
+func testChain() []*block.Block {
+	genesis := block.NewBlock(0, []*transaction.Transaction{transaction.NewCoinbaseTransaction("alice", 50, 0)}, "", 1, "m1")
+	coinbase := genesis.Transactions[0]
+	payment := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: coinbase.ID, OutIndex: 0, ScriptSig: "sig"}, {TxID: "ghost", OutIndex: 3, ScriptSig: "sig"}},
+		[]transaction.TxOutput{{Value: 30, ScriptPubKey: "carol, \"the\nmerchant\""}, {Value: 15, ScriptPubKey: "alice"}})
+	payment.ID = payment.CalculateHash()
+	next := block.NewBlock(1, []*transaction.Transaction{transaction.NewCoinbaseTransaction("bob", 55, 1), payment}, genesis.Hash, 1, "m2")
+	return []*block.Block{genesis, next}
+}
+
+// readCSV returns the records of name.csv in dir
+func readCSV(t *testing.T, dir, name string) [][]string {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, name+".csv"))
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return records
+}
+
+func TestCSVTableQuotesValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"plain", "alice", "alice"},
+		{"comma", "a,b", "a,b"},
+		{"quote", `say "hi"`, `say "hi"`},
+		{"newline", "two\nlines", "two\nlines"},
+		{"leading space", " padded", " padded"},
+		{"integer", int64(-42), "-42"},
+		{"boolean", true, "true"},
+		{"missing", nil, ""},
+	}
+	dir := t.TempDir()
+	table, err := createCSVTable(dir, "values", []column{text("name"), optional(text("value")), text("last")})
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for _, tt := range tests {
+		if err := table.write(tt.name, tt.value, "end"); err != nil {
+			t.Fatalf("%s: write failed: %v", tt.name, err)
+		}
+	}
+	if err := table.close(); err != nil {
+		t.Fatalf("Failed to close table: %v", err)
+	}
+
+	records := readCSV(t, dir, "values")
+	if !reflect.DeepEqual(records[0], []string{"name", "value", "last"}) {
+		t.Errorf("Unexpected header %q", records[0])
+	}
+	if len(records) != len(tests)+1 {
+		t.Fatalf("Expected %d rows, got %d", len(tests), len(records)-1)
+	}
+	for i, tt := range tests {
+		if got := records[i+1]; !reflect.DeepEqual(got, []string{tt.name, tt.want, "end"}) {
+			t.Errorf("%s: expected %q to read back as %q, got %q", tt.name, tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestExportChainCSV(t *testing.T) {
+	blocks := testChain()
+	payment := blocks[1].Transactions[1]
+	dir := t.TempDir()
+	if err := exportChain(blocks, "csv", dir); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	headers := map[string][]string{
+		"blocks":       {"height", "hash", "prev_hash", "timestamp", "nonce", "difficulty", "miner_id", "merkle_root", "tx_count"},
+		"transactions": {"txid", "block_height", "block_hash", "position", "is_coinbase", "input_count", "output_count", "total_output", "fee"},
+		"inputs":       {"txid", "input_index", "prev_txid", "prev_out_index", "address", "value"},
+		"outputs":      {"txid", "out_index", "address", "value", "spent_by_txid", "spent_height"},
+	}
+	rows := map[string]int{"blocks": 2, "transactions": 3, "inputs": 2, "outputs": 4}
+	for name, header := range headers {
+		records := readCSV(t, dir, name)
+		if !reflect.DeepEqual(records[0], header) {
+			t.Errorf("%s: expected columns %q, got %q", name, header, records[0])
+		}
+		if len(records)-1 != rows[name] {
+			t.Errorf("%s: expected %d rows, got %d", name, rows[name], len(records)-1)
+		}
+	}
+
+	// The payment's fee counts only the input the chain knows
+	txs := readCSV(t, dir, "transactions")
+	if want := []string{payment.ID, "1", blocks[1].Hash, "1", "false", "2", "2", "45", "5"}; !reflect.DeepEqual(txs[3], want) {
+		t.Errorf("Expected payment row %q, got %q", want, txs[3])
+	}
+	inputs := readCSV(t, dir, "inputs")
+	if want := []string{payment.ID, "1", "ghost", "3", "", ""}; !reflect.DeepEqual(inputs[2], want) {
+		t.Errorf("Expected the unknown input unresolved, got %q", inputs[2])
+	}
+	outputs := readCSV(t, dir, "outputs")
+	if want := []string{blocks[0].Transactions[0].ID, "0", "alice", "50", payment.ID, "1"}; !reflect.DeepEqual(outputs[1], want) {
+		t.Errorf("Expected the coinbase spent by the payment, got %q", outputs[1])
+	}
+	if want := []string{payment.ID, "0", "carol, \"the\nmerchant\"", "30", "", ""}; !reflect.DeepEqual(outputs[3], want) {
+		t.Errorf("Expected the quoted address unspent, got %q", outputs[3])
+	}
+}
@@ -0,0 +1,303 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Parquet physical types, encodings, and page types used by the writer
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage = 0
+	parquetRequired = 0 // Repetition of columns always set
+	parquetOptional = 1 // Repetition of columns that may be missing
+	parquetUTF8     = 0 // Converted type of string columns
+)
+
+// parquetTable buffers a table and writes it to a Parquet file on close: one
+// row group holding one uncompressed, PLAIN-encoded data page per column.
+// That is the simplest file pandas and pyarrow read, and needs no library.
+type parquetTable struct {
+	path    string
+	columns []column
+	values  [][]any // Values of each column, nil where missing
+	rows    int
+}
+
+func createParquetTable(dir, name string, columns []column) (*parquetTable, error) {
+	return &parquetTable{
+		path:    filepath.Join(dir, name+".parquet"),
+		columns: columns,
+		values:  make([][]any, len(columns)),
+	}, nil
+}
+
+func (t *parquetTable) write(row ...any) error {
+	if len(row) != len(t.columns) {
+		return fmt.Errorf("row of %d values for %d columns", len(row), len(t.columns))
+	}
+	for i, v := range row {
+		col := t.columns[i]
+		switch v.(type) {
+		case nil:
+			if !col.optional {
+				return fmt.Errorf("missing value in required column %s", col.name)
+			}
+		case string:
+			if col.kind != kindString {
+				return fmt.Errorf("string value in column %s", col.name)
+			}
+		case int64:
+			if col.kind != kindInt {
+				return fmt.Errorf("integer value in column %s", col.name)
+			}
+		case bool:
+			if col.kind != kindBool {
+				return fmt.Errorf("boolean value in column %s", col.name)
+			}
+		default:
+			return fmt.Errorf("value of type %T in column %s", v, col.name)
+		}
+	}
+	// Only a whole row is added, so the columns stay aligned
+	for i, v := range row {
+		t.values[i] = append(t.values[i], v)
+	}
+	t.rows++
+	return nil
+}
+
+func (t *parquetTable) close() error {
+	file := []byte("PAR1")
+	var chunks []columnChunk
+	for i, col := range t.columns {
+		body := t.encodeValues(i)
+		page := &thriftWriter{}
+		page.i32(1, parquetDataPage)
+		page.i32(2, int32(len(body)))
+		page.i32(3, int32(len(body)))
+		page.begin(5)
+		page.i32(1, int32(t.rows))
+		page.i32(2, parquetPlain)
+		page.i32(3, parquetRLE)
+		page.i32(4, parquetRLE)
+		page.end()
+		page.stop()
+
+		chunks = append(chunks, columnChunk{col: col, offset: int64(len(file)), size: int64(len(page.buf) + len(body))})
+		file = append(file, page.buf...)
+		file = append(file, body...)
+	}
+	footer := t.footer(chunks)
+	file = append(file, footer...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(footer)))
+	file = append(file, "PAR1"...)
+	if err := os.WriteFile(t.path, file, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", t.path, err)
+	}
+	return nil
+}
+
+// columnChunk is where a column's page landed in the file
+type columnChunk struct {
+	col    column
+	offset int64
+	size   int64
+}
+
+// encodeValues returns the data page body of column i: the definition
+// levels of an optional column, then its present values
+func (t *parquetTable) encodeValues(i int) []byte {
+	var body []byte
+	values := t.values[i]
+	if t.columns[i].optional {
+		// One bit-packed run of 1-bit levels: 1 if present, 0 if missing
+		present := make([]bool, len(values))
+		for j, v := range values {
+			present[j] = v != nil
+		}
+		levels := binary.AppendUvarint(nil, uint64((len(values)+7)/8)<<1|1)
+		levels = append(levels, packBits(present)...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(levels)))
+		body = append(body, levels...)
+	}
+
+	var bits []bool
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(v)))
+			body = append(body, v...)
+		case int64:
+			body = binary.LittleEndian.AppendUint64(body, uint64(v))
+		case bool:
+			bits = append(bits, v)
+		}
+	}
+	if t.columns[i].kind == kindBool {
+		body = append(body, packBits(bits)...)
+	}
+	return body
+}
+
+// packBits packs bits least significant first, padding the last byte
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// footer returns the file's FileMetaData
+func (t *parquetTable) footer(chunks []columnChunk) []byte {
+	w := &thriftWriter{}
+	w.i32(1, 1) // version
+	w.list(2, thriftStruct, len(t.columns)+1)
+	w.elem()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(t.columns)))
+	w.end()
+	for _, col := range t.columns {
+		w.elem()
+		w.i32(1, col.kind.parquetType())
+		repetition := int32(parquetRequired)
+		if col.optional {
+			repetition = parquetOptional
+		}
+		w.i32(3, repetition)
+		w.binary(4, col.name)
+		if col.kind == kindString {
+			w.i32(6, parquetUTF8)
+		}
+		w.end()
+	}
+	w.i64(3, int64(t.rows))
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+	w.list(4, thriftStruct, 1)
+	w.elem()
+	w.list(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		w.elem()
+		w.i64(2, c.offset)
+		w.begin(3)
+		w.i32(1, c.col.kind.parquetType())
+		w.list(2, thriftI32, 2)
+		w.buf = binary.AppendVarint(w.buf, parquetPlain)
+		w.buf = binary.AppendVarint(w.buf, parquetRLE)
+		w.list(3, thriftBinary, 1)
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(c.col.name)))
+		w.buf = append(w.buf, c.col.name...)
+		w.i32(4, 0) // uncompressed
+		w.i64(5, int64(t.rows))
+		w.i64(6, c.size)
+		w.i64(7, c.size)
+		w.i64(9, c.offset)
+		w.end()
+		w.end()
+	}
+	w.i64(2, total)
+	w.i64(3, int64(t.rows))
+	w.end()
+	w.binary(6, "blockchain export")
+	w.stop()
+	return w.buf
+}
+
+// Thrift compact protocol type codes
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, in which
+// Parquet writes its page headers and footer. Fields must be written in
+// increasing ID order within a struct.
+type thriftWriter struct {
+	buf  []byte
+	last []int16 // ID of the last field written in each open struct
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if len(w.last) == 0 {
+		w.last = []int16{0}
+	}
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.buf = binary.AppendVarint(w.buf, int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.buf = binary.AppendVarint(w.buf, int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// list starts a list field of n elements of type typ, which follow
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|typ)
+		return
+	}
+	w.buf = append(w.buf, 0xf0|typ)
+	w.buf = binary.AppendUvarint(w.buf, uint64(n))
+}
+
+// begin opens a struct field, closed by end
+func (w *thriftWriter) begin(id int16) {
+	w.field(id, thriftStruct)
+	w.elem()
+}
+
+// elem opens a struct element of a list, closed by end
+func (w *thriftWriter) elem() {
+	if len(w.last) == 0 {
+		w.last = []int16{0}
+	}
+	w.last = append(w.last, 0)
+}
+
+// end closes the innermost open struct
+func (w *thriftWriter) end() {
+	w.buf = append(w.buf, 0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// stop ends the top-level struct
+func (w *thriftWriter) stop() {
+	w.buf = append(w.buf, 0)
+}
@@ -0,0 +1,356 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// thriftReader decodes Thrift compact protocol structs into maps of field ID
+// to value: int64 for integers, []byte for binary, bool, []any for lists,
+// and map[int16]any for structs. It reads what any Parquet reader would,
+// independently of thriftWriter.
+type thriftReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.err = fmt.Errorf("truncated at %d", r.pos)
+		return 0
+	}
+	r.pos++
+	return r.buf[r.pos-1]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[min(r.pos, len(r.buf)):])
+	if n <= 0 {
+		r.err = fmt.Errorf("bad varint at %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// zigzag reads a signed integer
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := map[int16]any{}
+	var id int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+	return fields
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2: // true, false as a field
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		if r.pos+n > len(r.buf) {
+			r.err = fmt.Errorf("truncated binary at %d", r.pos)
+			return nil
+		}
+		r.pos += n
+		return r.buf[r.pos-n : r.pos]
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			if elem := header & 0x0f; elem == 1 || elem == 2 {
+				list = append(list, r.byte() == 1) // A list's booleans are bytes
+			} else {
+				list = append(list, r.value(elem))
+			}
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.err = fmt.Errorf("unknown type %d at %d", typ, r.pos)
+	return nil
+}
+
+// parquetFile is a decoded single-row-group Parquet file
+type parquetFile struct {
+	meta    map[int16]any
+	schema  []map[int16]any
+	columns [][]any // Values of each column, nil where missing
+}
+
+// readParquet checks the framing of the Parquet file at path and decodes its
+// footer, page headers, and values
+func readParquet(t *testing.T, path string) *parquetFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("%s: missing PAR1 magic", path)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footerLen <= 0 || footerLen > len(data)-12 {
+		t.Fatalf("%s: footer length %d out of range", path, footerLen)
+	}
+	r := &thriftReader{buf: data[len(data)-8-footerLen : len(data)-8]}
+	f := &parquetFile{meta: r.structure()}
+	if r.err != nil || r.pos != footerLen {
+		t.Fatalf("%s: footer decoded %d of %d bytes: %v", path, r.pos, footerLen, r.err)
+	}
+	for _, elem := range f.meta[2].([]any) {
+		f.schema = append(f.schema, elem.(map[int16]any))
+	}
+	rows := f.meta[3].(int64)
+
+	groups := f.meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("%s: expected one row group, got %d", path, len(groups))
+	}
+	group := groups[0].(map[int16]any)
+	if group[3] != rows {
+		t.Errorf("%s: row group has %v rows, file %d", path, group[3], rows)
+	}
+	chunks := group[1].([]any)
+	if len(chunks) != len(f.schema)-1 {
+		t.Fatalf("%s: %d column chunks for %d columns", path, len(chunks), len(f.schema)-1)
+	}
+	var total int64
+	for i, c := range chunks {
+		chunk := c.(map[int16]any)
+		meta := chunk[3].(map[int16]any)
+		element := f.schema[i+1]
+		offset := meta[9].(int64)
+		if chunk[2] != offset || meta[1] != element[1] || meta[4] != int64(0) || meta[5] != rows {
+			t.Errorf("%s: column %d metadata %v disagrees with the schema %v", path, i, meta, element)
+		}
+		if path := meta[3].([]any); len(path) != 1 || string(path[0].([]byte)) != string(element[4].([]byte)) {
+			t.Errorf("Column %d has path %q", i, path)
+		}
+
+		page := &thriftReader{buf: data, pos: int(offset)}
+		header := page.structure()
+		if page.err != nil {
+			t.Fatalf("%s: column %d page header: %v", path, i, page.err)
+		}
+		dataHeader := header[5].(map[int16]any)
+		size := header[3].(int64)
+		if header[1] != int64(parquetDataPage) || header[2] != size || dataHeader[1] != rows || dataHeader[2] != int64(parquetPlain) {
+			t.Errorf("%s: column %d has page header %v", path, i, header)
+		}
+		if chunkSize := int64(page.pos) - offset + size; meta[6] != chunkSize || meta[7] != chunkSize {
+			t.Errorf("%s: column %d chunk is %d bytes, metadata says %v", path, i, chunkSize, meta[7])
+		}
+		total += meta[7].(int64)
+		f.columns = append(f.columns, decodePage(t, data[page.pos:page.pos+int(size)], element, int(rows)))
+	}
+	if group[2] != total {
+		t.Errorf("%s: row group is %d bytes, metadata says %v", path, total, group[2])
+	}
+	return f
+}
+
+// decodePage decodes the PLAIN values of a data page of n rows, after the
+// definition levels of an optional column
+func decodePage(t *testing.T, body []byte, element map[int16]any, n int) []any {
+	t.Helper()
+	present := make([]bool, n)
+	for i := range present {
+		present[i] = true
+	}
+	if element[3] == int64(parquetOptional) {
+		levelsLen := int(binary.LittleEndian.Uint32(body))
+		r := &thriftReader{buf: body[4 : 4+levelsLen]}
+		// RLE/bit-packed hybrid runs of 1-bit levels
+		for i := 0; i < n && r.err == nil; {
+			header := r.uvarint()
+			if header&1 == 0 {
+				v := r.byte() == 1
+				for end := i + int(header>>1); i < end && i < n; i++ {
+					present[i] = v
+				}
+				continue
+			}
+			for groups := int(header >> 1); groups > 0; groups-- {
+				b := r.byte()
+				for bit := 0; bit < 8 && i < n; bit, i = bit+1, i+1 {
+					present[i] = b&(1<<bit) != 0
+				}
+			}
+		}
+		if r.err != nil || r.pos != levelsLen {
+			t.Fatalf("Bad definition levels: %v", r.err)
+		}
+		body = body[4+levelsLen:]
+	}
+
+	values := make([]any, n)
+	var pos, bit int
+	for i := range values {
+		if !present[i] {
+			continue
+		}
+		switch element[1] {
+		case int64(parquetByteArray):
+			size := int(binary.LittleEndian.Uint32(body[pos:]))
+			values[i] = string(body[pos+4 : pos+4+size])
+			pos += 4 + size
+		case int64(parquetInt64):
+			values[i] = int64(binary.LittleEndian.Uint64(body[pos:]))
+			pos += 8
+		case int64(parquetBoolean):
+			values[i] = body[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		default:
+			t.Fatalf("Unexpected type %v", element[1])
+		}
+	}
+	if pos += (bit + 7) / 8; pos != len(body) {
+		t.Errorf("Page decoded %d of %d bytes", pos, len(body))
+	}
+	return values
+}
+
+func TestParquetTableFormat(t *testing.T) {
+	dir := t.TempDir()
+	columns := []column{text("name"), optional(integer("value")), boolean("flag"), optional(text("note"))}
+	table, err := createParquetTable(dir, "values", columns)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	// Enough rows for several bytes of definition levels and booleans
+	var want [][]any
+	for i := 0; i < 20; i++ {
+		row := []any{fmt.Sprintf("row %d", i), int64(i * -1000), i%3 == 0, nil}
+		if i%2 == 0 {
+			row[1] = nil
+		}
+		if i == 19 {
+			row[3] = "last, \"quoted\""
+		}
+		want = append(want, row)
+		if err := table.write(row...); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := table.write(nil, int64(1), true, nil); err == nil {
+		t.Error("Expected a missing value in a required column to be refused")
+	}
+	if err := table.write("x", "1", true, nil); err == nil {
+		t.Error("Expected a string in an integer column to be refused")
+	}
+	if err := table.close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	f := readParquet(t, filepath.Join(dir, "values.parquet"))
+	if f.meta[1] != int64(1) || f.meta[3] != int64(20) || string(f.meta[6].([]byte)) != "blockchain export" {
+		t.Errorf("Unexpected file metadata %v", f.meta)
+	}
+	root := f.schema[0]
+	if string(root[4].([]byte)) != "schema" || root[5] != int64(len(columns)) {
+		t.Errorf("Unexpected schema root %v", root)
+	}
+	wantSchema := []struct {
+		name       string
+		typ        int64
+		repetition int64
+		utf8       bool
+	}{
+		{"name", parquetByteArray, parquetRequired, true},
+		{"value", parquetInt64, parquetOptional, false},
+		{"flag", parquetBoolean, parquetRequired, false},
+		{"note", parquetByteArray, parquetOptional, true},
+	}
+	for i, w := range wantSchema {
+		e := f.schema[i+1]
+		_, converted := e[6]
+		if string(e[4].([]byte)) != w.name || e[1] != w.typ || e[3] != w.repetition || converted != w.utf8 {
+			t.Errorf("Column %d: expected %+v, got %v", i, w, e)
+		}
+	}
+	for i, row := range want {
+		for j, v := range row {
+			if got := f.columns[j][i]; got != v {
+				t.Errorf("Row %d column %s: expected %v, got %v", i, columns[j].name, v, got)
+			}
+		}
+	}
+}
+
+func TestExportChainParquetMatchesCSV(t *testing.T) {
+	blocks := testChain()
+	csvDir, parquetDir := t.TempDir(), t.TempDir()
+	if err := exportChain(blocks, "csv", csvDir); err != nil {
+		t.Fatalf("CSV export failed: %v", err)
+	}
+	if err := exportChain(blocks, "parquet", parquetDir); err != nil {
+		t.Fatalf("Parquet export failed: %v", err)
+	}
+
+	for _, name := range []string{"blocks", "transactions", "inputs", "outputs"} {
+		records := readCSV(t, csvDir, name)
+		f := readParquet(t, filepath.Join(parquetDir, name+".parquet"))
+		var header []string
+		for _, e := range f.schema[1:] {
+			header = append(header, string(e[4].([]byte)))
+		}
+		if !reflect.DeepEqual(header, records[0]) {
+			t.Errorf("%s: Parquet columns %q, CSV %q", name, header, records[0])
+		}
+		if f.meta[3] != int64(len(records)-1) {
+			t.Fatalf("%s: Parquet has %v rows, CSV %d", name, f.meta[3], len(records)-1)
+		}
+		for i, record := range records[1:] {
+			for j, want := range record {
+				var got string
+				switch v := f.columns[j][i].(type) {
+				case string:
+					got = v
+				case int64:
+					got = strconv.FormatInt(v, 10)
+				case bool:
+					got = strconv.FormatBool(v)
+				}
+				if got != want {
+					t.Errorf("%s row %d column %s: Parquet %q, CSV %q", name, i, header[j], got, want)
+				}
+			}
+		}
+	}
+	// A missing value is missing, not empty
+	outputs := readParquet(t, filepath.Join(parquetDir, "outputs.parquet"))
+	if outputs.columns[4][3] != nil || outputs.columns[4][0] != blocks[1].Transactions[1].ID {
+		t.Errorf("Unexpected spent_by_txid column %v", outputs.columns[4])
+	}
+}
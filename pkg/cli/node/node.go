@@ -0,0 +1,641 @@
+// Package node runs a mining node. It is the node command of the blockchain
+// binary and the whole of the standalone miner binary.
+package node
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/audit"
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/explorer"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/network"
+	"blockchain/pkg/policy"
+	"blockchain/pkg/resource"
+	"blockchain/pkg/storage"
+	"blockchain/pkg/transaction"
+	"blockchain/pkg/wallet"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openDataDir recovers the chain stored in dir into the miner and attaches the
+// store so every later block connect is written ahead to disk
+func openDataDir(miner *network.Miner, dir string, difficulty int) (*storage.Store, error) {
+	store, blocks, info, err := storage.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.TruncatedBytes > 0 {
+		log.Printf("[%s] Discarded %d bytes of torn block data", cli.ShortID(miner.ID), info.TruncatedBytes)
+	}
+	if info.RolledForward {
+		log.Printf("[%s] Completed interrupted chain update from WAL", cli.ShortID(miner.ID))
+	}
+	if info.RolledBack {
+		log.Printf("[%s] Discarded incomplete chain update from WAL", cli.ShortID(miner.ID))
+	}
+
+	if len(blocks) > 0 {
+		bc := blockchain.NewBlockchainFromBlocks(blocks, difficulty, blockchain.WithOptions(miner.Blockchain.Options()))
+		if err := bc.ValidateChain(); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("stored chain is invalid: %v", err)
+		}
+		miner.Blockchain = bc
+		log.Printf("[%s] Loaded %d blocks from %s", cli.ShortID(miner.ID), len(blocks), dir)
+	} else if err := store.ReplaceChain(miner.Blockchain.GetBlocks()); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	miner.Blockchain.SetStore(store)
+	return store, nil
+}
+
+// startHTTP serves the miner's web endpoints in the background, over HTTPS if
+// tlsConfig is set
+func startHTTP(miner *network.Miner, addr string, enableGraphQL, enableREST bool, tlsConfig *tls.Config) {
+	src := explorer.Source{
+		Chain:   func() *blockchain.Blockchain { return miner.Blockchain },
+		Pending: miner.GetPendingTransactions,
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", explorer.NewHandler(src))
+	if enableGraphQL {
+		mux.Handle("/graphql", explorer.NewGraphQLHandler(src))
+	}
+	if enableREST {
+		mux.Handle("/api/", network.NewGateway(miner))
+	}
+	server := &http.Server{Addr: addr, Handler: mux, TLSConfig: tlsConfig}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		logging.Fatalf("HTTP server failed: %v", err)
+	}()
+}
+
+// startGRPC serves the miner's gRPC API in the background, over TLS if a
+// certificate is given (HTTP/2, which native gRPC needs) and otherwise over
+// plain HTTP/1.1 for gRPC-Web clients
+func startGRPC(miner *network.Miner, addr, certFile, keyFile string) {
+	server := &http.Server{Addr: addr, Handler: network.NewGRPCServer(miner)}
+	go func() {
+		var err error
+		if certFile != "" {
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		logging.Fatalf("gRPC server failed: %v", err)
+	}()
+}
+
+// Command runs a mining node
+var Command = cli.Command{Name: "node", Summary: "Run a mining node, or replay a block's validation", Run: run}
+
+func run(ctx *cli.Context, args []string) {
+	// Subcommands take their own flags
+	if len(args) > 0 && args[0] == "replay" {
+		runReplay(ctx, args[1:])
+		return
+	}
+
+	// Parse command line arguments
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	common := cli.AddCommonFlags(fs)
+	id := fs.String("id", "", "Miner ID")
+	address := fs.String("address", "0.0.0.0:8001", "Listen address (default: 0.0.0.0:8001)")
+	peers := fs.String("peers", "", "Comma-separated list of peer addresses (e.g., localhost:8002,localhost:8003)")
+	difficulty := fs.Int("difficulty", 4, "Mining difficulty (number of leading zeros)")
+	autoMine := fs.Bool("mine", true, "Start mining automatically")
+	useMerkle := fs.Bool("merkle", true, "Use Merkle Tree for block hash calculation (default: true)")
+	dynamicDiff := fs.Bool("dynamic-difficulty", false, "Enable dynamic difficulty adjustment (default: false)")
+	clockDrift := fs.Duration("max-clock-drift", blockchain.DefaultMaxClockDrift, "Reject blocks dated further than this ahead of the local clock (0 = unchecked)")
+	threads := fs.Int("threads", 1, "Number of parallel mining threads (default: 1, no parallelism)")
+	recordPath := fs.String("record", "", "Record every received block/transaction payload to this log file")
+	replayPath := fs.String("replay", "", "Replay a recorded message log into a fresh node and exit")
+	dataDir := fs.String("datadir", "", "Directory for crash-safe chain persistence (default: in-memory only)")
+	mempoolTTL := fs.Duration("mempool-ttl", mempool.DefaultTTL, "Drop pending transactions older than this (0 = never)")
+	peerRetention := fs.Duration("peer-retention", network.DefaultPeerRetention, "Drop peer records without contact for this long (0 = never)")
+	orphanRetention := fs.Duration("orphan-retention", network.DefaultOrphanRetention, "Drop orphan blocks whose parent has not arrived for this long (0 = never)")
+	mempoolMaxBytes := fs.Int64("mempool-max-bytes", mempool.DefaultMaxBytes, "Memory budget for pending transactions in bytes (0 = unlimited)")
+	mempoolMaxTxs := fs.Int("mempool-max-txs", 0, "Maximum number of pending transactions (0 = unlimited)")
+	mempoolEvict := fs.String("mempool-evict", "oldest", "Eviction policy when the mempool budget is exceeded: oldest, feerate")
+	orphanMaxBytes := fs.Int64("orphan-max-bytes", blockchain.DefaultMaxOrphanBytes, "Memory budget for blocks waiting for their parent in bytes, oldest evicted first (0 = count limit only)")
+	sigCacheSize := fs.Int("sig-cache-size", transaction.SignatureCacheSize, "Most verified input signatures cached across validations (0 = no cache)")
+	pubKeyCacheSize := fs.Int("pubkey-cache-size", transaction.PubKeyCacheSize, "Most parsed public keys cached (0 = no cache)")
+	blockTxs := fs.Int("block-txs", network.DefaultMaxBlockTxs, "Most pending transactions per mined block, highest fee rate first (0 = unlimited; the chain params may set a tighter limit)")
+	templateRefresh := fs.Duration("template-refresh", network.DefaultTemplateRefresh, "Rebuild the block being mined after this long if transactions paying more fees have arrived (0 = never)")
+	minDiskMB := fs.Uint64("min-disk-mb", 0, "Pause mining and relay while free space on the -datadir filesystem is below this many MiB (0 = off)")
+	minMemMB := fs.Uint64("min-mem-mb", 0, "Pause mining and relay while available memory is below this many MiB (0 = off)")
+	watchInterval := fs.Duration("watchdog-interval", network.DefaultWatchdogInterval, "How often the resource watchdog checks disk and memory")
+	standbyFor := fs.String("standby-for", "", "Run as a warm standby for the primary miner at this address: follow its chain and mine only while it is down")
+	heartbeat := fs.Duration("heartbeat-interval", network.DefaultHeartbeatInterval, "How often a standby checks on its primary")
+	heartbeatMisses := fs.Int("heartbeat-misses", network.DefaultHeartbeatMisses, "Missed heartbeats in a row before a standby takes over")
+	replica := fs.Bool("replica", false, "Run as a read replica: follow the peers' chain and serve queries, but never mine or accept transactions")
+	replicaSync := fs.Duration("replica-sync", network.DefaultReplicaSyncInterval, "How often a read replica pulls new blocks from its peers")
+	resyncInterval := fs.Duration("resync-interval", network.DefaultResyncInterval, "How often to check for missed blocks and resync with all peers if behind (0 = never)")
+	resyncStale := fs.Duration("resync-stale", network.DefaultResyncConfig().StaleAfter, "Resync with all peers when no new block arrived for this long")
+	maxConns := fs.Int("max-conns", network.DefaultMaxConns, "Most RPC connections served at once (0 = unlimited)")
+	maxConnsPerHost := fs.Int("max-conns-per-host", network.DefaultMaxConnsPerHost, "Most RPC connections one host may hold open (0 = unlimited)")
+	callRate := fs.Float64("rpc-rate", network.DefaultCallRate, "RPC calls per second accepted from each host (0 = unlimited)")
+	banThreshold := fs.Int("ban-threshold", network.DefaultBanThreshold, "Ban a host once its misbehavior score reaches this (0 = never)")
+	banDuration := fs.Duration("ban-duration", network.DefaultBanDuration, "How long a banned host is refused")
+	checkpointKey := fs.String("checkpoint-key", "", "File holding the hex private key to sign header checkpoints for light clients with")
+	checkpointTrusted := fs.String("checkpoint-trusted", "", "Serve the checkpoints in -checkpoint-file signed by this hex public key")
+	checkpointFile := fs.String("checkpoint-file", "", "Checkpoint file written by the signer and read by other miners (default: <datadir>/checkpoint.json)")
+	checkpointInterval := fs.Int64("checkpoint-interval", network.DefaultCheckpointInterval, "Blocks between signed checkpoints")
+	checkpointDepth := fs.Int64("checkpoint-depth", network.DefaultCheckpointDepth, "Blocks that must follow a header before it is signed")
+	syncRate := fs.Int64("sync-bytes-per-sec", 0, "Cap chain and header downloads, fetched or served, at this many bytes per second each way (0 = unlimited)")
+	relayRate := fs.Int64("relay-bytes-per-sec", 0, "Cap block and transaction relay and other peer traffic at this many bytes per second each way (0 = unlimited)")
+	forkDepth := fs.Int("fork-report-depth", network.DefaultForkReportDepth, "Write an incident report for reorgs removing at least this many blocks (0 = off)")
+	forkDir := fs.String("fork-report-dir", "", "Directory for fork reports (default: <datadir>/forks, or memory only without -datadir)")
+	gcInterval := fs.Duration("gc-interval", network.DefaultGCInterval, "How often expired data is garbage collected")
+	coinjoinDenom := fs.Int64("coinjoin-denom", 0, "Coordinate coinjoin rounds mixing this many satoshi per output (0 = disabled)")
+	coinjoinSize := fs.Int("coinjoin-size", 3, "Participants per coinjoin round")
+	coinjoinFee := fs.Int64("coinjoin-fee", 1000, "Fee in satoshi paid by each coinjoin participant")
+	blacklistPath := fs.String("blacklist", "", "Enable the blacklist policy, loading entries from this JSON file (\"-\" = start empty)")
+	httpAddr := fs.String("http", "", "Serve the web block explorer on this address, e.g. localhost:8080 (default: disabled)")
+	enableGraphQL := fs.Bool("graphql", false, "Also serve a GraphQL query endpoint at /graphql on the -http address")
+	enableREST := fs.Bool("rest", false, "Also serve the RPC methods as a JSON API under /api/ on the -http address")
+	grpcAddr := fs.String("grpc", "", "Serve the gRPC API (see pkg/network/miner.proto) on this address (default: disabled)")
+	grpcCert := fs.String("grpc-cert", "", "TLS certificate file for -grpc; native gRPC clients need it, gRPC-Web clients do not")
+	grpcKey := fs.String("grpc-key", "", "TLS private key file for -grpc-cert")
+	payoutSeed := fs.String("payout-seed", "", "HD wallet seed (hex); pay each block's reward to a fresh derived address")
+	auditPath := fs.String("audit", "", "Append authenticated mutating RPC calls to this audit log file (requires -access)")
+	features := fs.String("features", strings.Join(network.SupportedFeatures(), ","), "Comma-separated protocol features to offer peers (empty = none)")
+	accessPath := fs.String("access", "", "Restrict RPC methods by role, loading API tokens and signing keys from this JSON file (default: unrestricted)")
+	tlsCert := fs.String("tls-cert", "", "Serve RPC and -http over TLS with this certificate file, and dial peers over TLS (default: plain TCP)")
+	tlsKey := fs.String("tls-key", "", "TLS private key file for -tls-cert")
+	tlsCA := fs.String("tls-ca", "", "CA certificates to check peers' certificates and clients' certificates against (default: system roots, no client certificates)")
+	tlsClientRole := fs.String("tls-client-role", "", "Give connections with a client certificate issued by -tls-ca this role: observer, wallet, operator, admin (requires -access)")
+
+	ctx.Parse(fs, args)
+
+	if *id == "" {
+		fmt.Printf("Usage: %s -id <id> -address <address> [-peers <peers>] [-difficulty <n>] [-mine] [-merkle] [-threads <n>]\n", ctx.Prog)
+		fmt.Printf("       %s replay -block <hash|height> (-datadir <dir> | -miner <address>) [-trace]\n", ctx.Prog)
+		fmt.Println()
+		fmt.Println("Options:")
+		fmt.Println("  -id        Miner ID (required)")
+		fmt.Println("  -address   Listen address (default: 0.0.0.0:8001)")
+		fmt.Println("  -peers     Comma-separated peer addresses")
+		fmt.Println("  -difficulty Mining difficulty (default: 4)")
+		fmt.Println("  -mine      Start mining automatically (default: true)")
+		fmt.Println("  -merkle    Use Merkle Tree for block hash (default: true)")
+		fmt.Println("  -dynamic-difficulty  Enable dynamic difficulty adjustment (default: false)")
+		fmt.Println("  -max-clock-drift    Reject blocks dated further than this ahead of the local clock (default: 10m, 0 = unchecked)")
+		fmt.Println("  -threads   Number of parallel mining threads (default: 1)")
+		fmt.Println("  -record    Record received block/transaction payloads to a log file")
+		fmt.Println("  -replay    Replay a recorded log into a fresh node and exit")
+		fmt.Println("  -datadir   Persist the chain to this directory and recover it on restart")
+		fmt.Println("  -mempool-ttl     Drop pending transactions older than this (default: 30m)")
+		fmt.Println("  -peer-retention  Drop peer records without contact for this long (default: 1h)")
+		fmt.Println("  -orphan-retention  Drop orphan blocks whose parent has not arrived for this long (default: 30m)")
+		fmt.Println("  -gc-interval     How often expired data is garbage collected (default: 1m)")
+		fmt.Println("  -mempool-max-bytes  Memory budget for pending transactions (default: 32 MiB)")
+		fmt.Println("  -mempool-max-txs    Maximum number of pending transactions (default: 0, unlimited)")
+		fmt.Println("  -mempool-evict      Eviction policy when over budget: oldest, feerate (default: oldest)")
+		fmt.Println("  -orphan-max-bytes   Memory budget for orphan blocks, oldest evicted first (default: 16 MiB)")
+		fmt.Println("  -sig-cache-size     Most verified input signatures cached (default: 32768)")
+		fmt.Println("  -pubkey-cache-size  Most parsed public keys cached (default: 4096)")
+		fmt.Println("  -block-txs          Most pending transactions per block, highest fee rate first (default: 10)")
+		fmt.Println("  -min-disk-mb        Pause mining and relay while free datadir disk space is below this (default: 0, off)")
+		fmt.Println("  -min-mem-mb         Pause mining and relay while available memory is below this (default: 0, off)")
+		fmt.Println("  -watchdog-interval  How often disk and memory are checked (default: 10s)")
+		fmt.Println("  -standby-for        Stand by for the primary miner at this address; mine only while it is down")
+		fmt.Println("  -heartbeat-interval How often a standby checks on its primary (default: 2s)")
+		fmt.Println("  -heartbeat-misses   Missed heartbeats before a standby takes over (default: 3)")
+		fmt.Println("  -replica            Serve queries only: follow the peers' chain, never mine or accept transactions")
+		fmt.Println("  -replica-sync       How often a read replica pulls new blocks from its peers (default: 5s)")
+		fmt.Println("  -resync-interval    How often to check for missed blocks, resyncing if behind (default: 15s, 0 = never)")
+		fmt.Println("  -resync-stale       Resync with all peers when no block arrived for this long (default: 30s)")
+		fmt.Println("  -max-conns          Most RPC connections served at once (default: 256, 0 = unlimited)")
+		fmt.Println("  -max-conns-per-host Most RPC connections per host (default: 64, 0 = unlimited)")
+		fmt.Println("  -rpc-rate           RPC calls per second accepted from each host (default: 500, 0 = unlimited)")
+		fmt.Println("  -ban-threshold      Ban a host once its misbehavior score reaches this (default: 100, 0 = never)")
+		fmt.Println("  -ban-duration       How long a banned host is refused (default: 10m)")
+		fmt.Println("  -checkpoint-key     File with the private key to sign header checkpoints for light clients with")
+		fmt.Println("  -checkpoint-trusted Serve checkpoints from -checkpoint-file signed by this public key")
+		fmt.Println("  -checkpoint-file    Checkpoint file written by the signer, read by others (default: <datadir>/checkpoint.json)")
+		fmt.Println("  -checkpoint-interval Blocks between signed checkpoints (default: 100)")
+		fmt.Println("  -checkpoint-depth   Blocks that must follow a header before it is signed (default: 6)")
+		fmt.Println("  -sync-bytes-per-sec  Cap chain sync traffic to and from peers, each way (default: 0, unlimited)")
+		fmt.Println("  -relay-bytes-per-sec Cap block/transaction relay and other peer traffic, each way (default: 0, unlimited)")
+		fmt.Println("  -fork-report-depth  Report reorgs removing at least this many blocks (default: 2, 0 = off)")
+		fmt.Println("  -fork-report-dir    Directory for fork reports (default: <datadir>/forks)")
+		fmt.Println("  -chain-params       JSON file with rule activation heights and scheduled parameter changes (default: none)")
+		fmt.Println("  -log-file           Append log output to this file (default: stderr)")
+		fmt.Println("  -payout-seed        HD wallet seed; rotate the coinbase address every block")
+		fmt.Println("  -blacklist          Refuse to relay/mine transactions touching listed addresses (JSON file, or - for empty)")
+		fmt.Println("  -coinjoin-denom     Coordinate coinjoin rounds with this output value (default: 0, disabled)")
+		fmt.Println("  -coinjoin-size      Participants per coinjoin round (default: 3)")
+		fmt.Println("  -coinjoin-fee       Fee paid by each coinjoin participant (default: 1000)")
+		fmt.Println("  -http               Serve the web block explorer on this address (default: disabled)")
+		fmt.Println("  -graphql            Serve a GraphQL endpoint at /graphql on the -http address (default: false)")
+		fmt.Println("  -rest               Serve the RPC methods as a JSON API under /api/ on the -http address (default: false)")
+		fmt.Println("  -grpc               Serve the gRPC API on this address (default: disabled)")
+		fmt.Println("  -grpc-cert          TLS certificate for -grpc, needed by native gRPC clients (without it only gRPC-Web is served)")
+		fmt.Println("  -grpc-key           TLS private key for -grpc-cert")
+		fmt.Println("  -features           Protocol features to offer peers (default: all of " + strings.Join(network.SupportedFeatures(), ", ") + ")")
+		fmt.Println("  -access             JSON file mapping API tokens and signing keys to roles: observer, wallet, operator, admin")
+		fmt.Println("  -audit              Append authenticated mutating RPC calls to this file (requires -access)")
+		fmt.Println("  -tls-cert           Serve RPC and -http over TLS with this certificate, and dial peers over TLS (default: plain TCP)")
+		fmt.Println("  -tls-key            TLS private key for -tls-cert")
+		fmt.Println("  -tls-ca             CA certificates that peer and client certificates are checked against")
+		fmt.Println("  -tls-client-role    Role of clients presenting a certificate issued by -tls-ca (requires -access)")
+		os.Exit(1)
+	}
+	defer common.OpenLog()()
+
+	// Merkle Tree configuration
+	if *useMerkle {
+		log.Printf("[%s] Using Merkle Tree for block hash calculation", cli.ShortID(*id))
+	} else {
+		log.Printf("[%s] Using direct transaction serialization for block hash calculation (legacy mode)", cli.ShortID(*id))
+	}
+
+	// Dynamic difficulty configuration
+	if *dynamicDiff {
+		log.Printf("[%s] Dynamic difficulty adjustment enabled (target: 1 block per 10 seconds)", cli.ShortID(*id))
+	} else {
+		log.Printf("[%s] Static difficulty mode (difficulty: %d)", cli.ShortID(*id), *difficulty)
+	}
+
+	// Parallel mining threads configuration
+	if *threads > 1 {
+		log.Printf("[%s] Parallel mining enabled with %d threads", cli.ShortID(*id), *threads)
+	} else {
+		log.Printf("[%s] Sequential mining (single thread)", cli.ShortID(*id))
+	}
+
+	// Consensus params: versioned rules activate at their configured heights
+	params := common.Params(*id)
+
+	// Parse peers
+	peerList := cli.ParsePeers(*peers)
+
+	poolCfg := mempool.Config{MaxBytes: *mempoolMaxBytes, MaxTxs: *mempoolMaxTxs, TTL: *mempoolTTL}
+	switch *mempoolEvict {
+	case "oldest":
+		poolCfg.Eviction = mempool.EvictOldest
+	case "feerate":
+		poolCfg.Eviction = mempool.EvictLowestFeeRate
+	default:
+		logging.Fatalf("Unknown mempool eviction policy: %s", *mempoolEvict)
+	}
+
+	// Protocol features: each is used with a peer only if the peer offers it too
+	offered, err := network.ParseFeatures(*features)
+	if err != nil {
+		logging.Fatalf("Invalid -features: %v", err)
+	}
+
+	minerOpts := []network.MinerOption{
+		network.WithMiningThreads(*threads),
+		network.WithFeatures(offered),
+		network.WithMempool(poolCfg),
+		network.WithMaxBlockTxs(*blockTxs),
+		network.WithTemplateRefresh(*templateRefresh),
+		network.WithChainOptions(
+			blockchain.WithMerkleTree(*useMerkle),
+			blockchain.WithDynamicDifficulty(*dynamicDiff),
+			blockchain.WithParams(params),
+			blockchain.WithMaxClockDrift(*clockDrift),
+			blockchain.WithMaxOrphanBytes(*orphanMaxBytes),
+		),
+	}
+	transaction.SetCacheSizes(*sigCacheSize, *pubKeyCacheSize)
+
+	// Resource watchdog: pause mining and relay under disk or memory pressure
+	if *minDiskMB > 0 || *minMemMB > 0 {
+		thresholds := resource.Thresholds{MinDiskFree: *minDiskMB << 20, MinMemAvailable: *minMemMB << 20}
+		if thresholds.MinDiskFree > 0 && *dataDir == "" {
+			logging.Fatalf("-min-disk-mb requires -datadir")
+		}
+		minerOpts = append(minerOpts, network.WithWatchdog(network.WatchdogConfig{
+			Path:       *dataDir,
+			Thresholds: thresholds,
+			Interval:   *watchInterval,
+		}))
+		log.Printf("[%s] Resource watchdog enabled (min disk %s, min memory %s)", cli.ShortID(*id),
+			resource.FormatBytes(thresholds.MinDiskFree), resource.FormatBytes(thresholds.MinMemAvailable))
+	}
+
+	// Warm standby: follow the primary and take over when it stops answering
+	if *standbyFor != "" {
+		primary := network.PeerInfo{ID: "primary", Address: *standbyFor}
+		minerOpts = append(minerOpts, network.WithStandby(network.StandbyConfig{
+			Primary:  primary,
+			Interval: *heartbeat,
+			Misses:   *heartbeatMisses,
+		}))
+		known := false
+		for _, p := range peerList {
+			known = known || p.Address == primary.Address
+		}
+		if !known {
+			peerList = append(peerList, primary)
+		}
+		log.Printf("[%s] Standing by for %s (heartbeat %v, takeover after %d misses)", cli.ShortID(*id),
+			primary.Address, *heartbeat, *heartbeatMisses)
+	}
+
+	// Bandwidth caps: pace peer traffic for slow or metered links
+	if *syncRate < 0 || *relayRate < 0 {
+		logging.Fatalf("-sync-bytes-per-sec and -relay-bytes-per-sec must not be negative")
+	}
+	if *syncRate > 0 || *relayRate > 0 {
+		minerOpts = append(minerOpts, network.WithBandwidth(network.BandwidthConfig{
+			SyncBytesPerSec:  *syncRate,
+			RelayBytesPerSec: *relayRate,
+		}))
+		log.Printf("[%s] Bandwidth capped (sync %s, relay %s)", cli.ShortID(*id), formatRate(*syncRate), formatRate(*relayRate))
+	}
+
+	// Read replica: serve queries from a synced chain, away from the mining nodes
+	if *replica {
+		if *standbyFor != "" || *coinjoinDenom > 0 {
+			logging.Fatalf("-replica cannot be combined with -standby-for or -coinjoin-denom")
+		}
+		if len(peerList) == 0 {
+			logging.Fatalf("-replica requires -peers to sync from")
+		}
+		minerOpts = append(minerOpts, network.WithReplica(network.ReplicaConfig{SyncInterval: *replicaSync}))
+		log.Printf("[%s] Read replica: syncing from %d peers every %v; not mining or accepting transactions",
+			cli.ShortID(*id), len(peerList), *replicaSync)
+	}
+
+	// Recover from missed broadcasts, e.g. after a network partition heals
+	minerOpts = append(minerOpts, network.WithResync(network.ResyncConfig{Interval: *resyncInterval, StaleAfter: *resyncStale}))
+
+	// Keep one host from exhausting the listener
+	minerOpts = append(minerOpts, network.WithServerLimits(network.ServerLimits{
+		MaxConns:        *maxConns,
+		MaxConnsPerHost: *maxConnsPerHost,
+		CallRate:        *callRate,
+		CallBurst:       int(2 * *callRate),
+		BanThreshold:    *banThreshold,
+		BanDuration:     *banDuration,
+	}))
+
+	// Header checkpoints: sign them with the instructor's key, or serve the signer's
+	if *checkpointKey != "" || *checkpointTrusted != "" {
+		cfg := network.CheckpointConfig{
+			TrustedKey: *checkpointTrusted,
+			Interval:   *checkpointInterval,
+			Depth:      *checkpointDepth,
+			File:       *checkpointFile,
+		}
+		if cfg.File == "" && *dataDir != "" {
+			cfg.File = filepath.Join(*dataDir, "checkpoint.json")
+		}
+		if *checkpointKey != "" {
+			data, err := os.ReadFile(*checkpointKey)
+			if err != nil {
+				logging.Fatalf("Failed to read checkpoint key: %v", err)
+			}
+			cfg.SigningKey = strings.TrimSpace(string(data))
+			key, err := transaction.HexToPrivateKey(cfg.SigningKey)
+			if err != nil {
+				logging.Fatalf("Invalid checkpoint key: %v", err)
+			}
+			if *checkpointTrusted != "" && *checkpointTrusted != transaction.PublicKeyToHex(&key.PublicKey) {
+				logging.Fatalf("-checkpoint-trusted does not match -checkpoint-key")
+			}
+			log.Printf("[%s] Signing a header checkpoint every %d blocks, %d deep", cli.ShortID(*id), cfg.Interval, cfg.Depth)
+		} else {
+			if cfg.File == "" {
+				logging.Fatalf("-checkpoint-trusted requires -checkpoint-file or -datadir")
+			}
+			if _, err := transaction.HexToPublicKey(cfg.TrustedKey); err != nil {
+				logging.Fatalf("Invalid -checkpoint-trusted key: %v", err)
+			}
+			log.Printf("[%s] Serving header checkpoints from %s signed by %s", cli.ShortID(*id), cfg.File, access.KeyID(cfg.TrustedKey))
+		}
+		minerOpts = append(minerOpts, network.WithCheckpoints(cfg))
+	}
+
+	// Fork monitor: write up reorgs deep enough to be worth a post-mortem
+	if *forkDepth > 0 {
+		dir := *forkDir
+		if dir == "" && *dataDir != "" {
+			dir = filepath.Join(*dataDir, "forks")
+		}
+		minerOpts = append(minerOpts, network.WithForkMonitor(network.ForkMonitorConfig{MinDepth: *forkDepth, Dir: dir}))
+	}
+
+	// Payout rotation: derive a new coinbase address per block height
+	if *payoutSeed != "" {
+		w, err := wallet.HDWalletFromHex(*payoutSeed)
+		if err != nil {
+			logging.Fatalf("Invalid payout seed: %v", err)
+		}
+		minerOpts = append(minerOpts, network.WithPayoutWallet(w))
+		log.Printf("[%s] Rotating coinbase payout address per block", cli.ShortID(*id))
+	}
+
+	// Coinjoin coordinator for the privacy lab
+	if *coinjoinDenom > 0 {
+		minerOpts = append(minerOpts, network.WithCoinJoin(network.CoinJoinConfig{
+			Denomination: *coinjoinDenom,
+			Participants: *coinjoinSize,
+			Fee:          *coinjoinFee,
+		}))
+		log.Printf("[%s] Coordinating coinjoin rounds: %d participants x %d satoshi", cli.ShortID(*id), *coinjoinSize, *coinjoinDenom)
+	}
+
+	// Blacklist policy: filtered transactions are neither relayed nor mined
+	if *blacklistPath != "" {
+		bl := policy.NewBlacklist()
+		if *blacklistPath != "-" {
+			var err error
+			bl, err = policy.LoadBlacklist(*blacklistPath)
+			if err != nil {
+				logging.Fatalf("Failed to load blacklist: %v", err)
+			}
+		}
+		entries := bl.Entries()
+		minerOpts = append(minerOpts, network.WithBlacklist(bl))
+		log.Printf("[%s] POLICY: blacklist enabled with %d addresses and %d transactions",
+			cli.ShortID(*id), len(entries.Addresses), len(entries.Transactions))
+	}
+
+	// Role-based access control: tokens map to roles, roles to RPC method groups
+	if *accessPath != "" {
+		p, err := access.LoadPolicy(*accessPath)
+		if err != nil {
+			logging.Fatalf("Failed to load access policy: %v", err)
+		}
+		minerOpts = append(minerOpts, network.WithAccessPolicy(p))
+		log.Printf("[%s] ACCESS: RPC restricted by role (anonymous: %s, tokens: %v)",
+			cli.ShortID(*id), p.Anonymous(), p.RoleCounts())
+	}
+
+	// TLS on the RPC and HTTP listeners, and client certificates as credentials
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		cfg, err := network.LoadTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			logging.Fatalf("Failed to load TLS config: %v", err)
+		}
+		var role access.Role
+		if *tlsClientRole != "" {
+			if *accessPath == "" {
+				logging.Fatalf("-tls-client-role requires -access")
+			}
+			if *tlsCA == "" {
+				logging.Fatalf("-tls-client-role requires -tls-ca")
+			}
+			if role, err = access.ParseRole(*tlsClientRole); err != nil {
+				logging.Fatalf("Invalid -tls-client-role: %v", err)
+			}
+		}
+		tlsConfig = cfg
+		minerOpts = append(minerOpts, network.WithTLS(cfg, role))
+		log.Printf("[%s] TLS: serving RPC and dialing peers over TLS (client certificate role: %s)", cli.ShortID(*id), role)
+	} else if *tlsCA != "" || *tlsClientRole != "" {
+		logging.Fatalf("-tls-ca and -tls-client-role require -tls-cert")
+	}
+
+	// Audit log of authenticated mutating calls, queryable by admins
+	if *auditPath != "" {
+		if *accessPath == "" {
+			logging.Fatalf("-audit requires -access")
+		}
+		auditLog, err := audit.Open(*auditPath)
+		if err != nil {
+			logging.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		minerOpts = append(minerOpts, network.WithAuditLog(auditLog))
+		log.Printf("[%s] AUDIT: recording authenticated mutating RPC calls to %s", cli.ShortID(*id), *auditPath)
+	}
+
+	// Create and start miner
+	miner := network.NewMiner(*id, *address, *difficulty, peerList, minerOpts...)
+
+	miner.SetGCConfig(network.GCConfig{
+		PeerRetention:   *peerRetention,
+		OrphanRetention: *orphanRetention,
+		Interval:        *gcInterval,
+	})
+
+	// Replay mode: feed a recorded log into a fresh, offline node and exit
+	if *replayPath != "" {
+		msgs, err := network.ReadMessageLog(*replayPath)
+		if err != nil {
+			logging.Fatalf("Failed to read replay log: %v", err)
+		}
+		result := miner.ReplayMessages(msgs)
+		log.Printf("[%s] Replayed %d messages (%d blocks, %d txs, %d chains): %d accepted, %d rejected. Final chain length: %d",
+			cli.ShortID(*id), len(msgs), result.Blocks, result.Transactions, result.Chains,
+			result.Accepted, result.Rejected, miner.Blockchain.GetLength())
+		return
+	}
+
+	// Load the persisted chain, repairing any state torn by a crash
+	if *dataDir != "" {
+		store, err := openDataDir(miner, *dataDir, *difficulty)
+		if err != nil {
+			logging.Fatalf("Failed to open data dir: %v", err)
+		}
+		defer store.Close()
+	}
+
+	// Record mode: log every received payload for offline debugging
+	if *recordPath != "" {
+		recorder, err := network.NewMessageRecorder(*recordPath)
+		if err != nil {
+			logging.Fatalf("Failed to open record log: %v", err)
+		}
+		defer recorder.Close()
+		if err := miner.SetRecorder(recorder); err != nil {
+			logging.Fatalf("Failed to start recording: %v", err)
+		}
+		log.Printf("[%s] Recording received messages to %s", cli.ShortID(*id), *recordPath)
+	}
+
+	// Set up logging callback
+	miner.SetBlockCallback(func(b *block.Block) {
+		log.Printf("[%s] New block added: #%d", cli.ShortID(*id), b.Index)
+	})
+
+	// Start the miner server
+	if err := miner.Start(); err != nil {
+		logging.Fatalf("Failed to start miner: %v", err)
+	}
+
+	// Serve the block explorer
+	if *httpAddr != "" {
+		startHTTP(miner, *httpAddr, *enableGraphQL, *enableREST, tlsConfig)
+		scheme := "http"
+		if tlsConfig != nil {
+			scheme = "https"
+		}
+		log.Printf("[%s] Block explorer listening on %s://%s", cli.ShortID(*id), scheme, *httpAddr)
+		if *enableREST {
+			log.Printf("[%s] JSON API listening on %s://%s/api/", cli.ShortID(*id), scheme, *httpAddr)
+		}
+	} else if *enableGraphQL {
+		logging.Fatalf("-graphql requires -http")
+	} else if *enableREST {
+		logging.Fatalf("-rest requires -http")
+	}
+
+	// Serve the gRPC API
+	if *grpcAddr != "" {
+		if (*grpcCert == "") != (*grpcKey == "") {
+			logging.Fatalf("-grpc-cert and -grpc-key must be given together")
+		}
+		startGRPC(miner, *grpcAddr, *grpcCert, *grpcKey)
+		if *grpcCert != "" {
+			log.Printf("[%s] gRPC API listening on %s (TLS)", cli.ShortID(*id), *grpcAddr)
+		} else {
+			log.Printf("[%s] gRPC-Web API listening on %s (no TLS: native gRPC clients need -grpc-cert)", cli.ShortID(*id), *grpcAddr)
+		}
+	} else if *grpcCert != "" || *grpcKey != "" {
+		logging.Fatalf("-grpc-cert requires -grpc")
+	}
+
+	// Sync with peers
+	if len(peerList) > 0 {
+		log.Printf("[%s] Syncing with %d peers...", cli.ShortID(*id), len(peerList))
+		miner.SyncWithAllPeers()
+	}
+
+	// Start mining if enabled
+	if *autoMine && !*replica {
+		miner.StartMining()
+	}
+
+	log.Printf("[%s] Miner is running. Chain length: %d", cli.ShortID(*id), miner.Blockchain.GetLength())
+
+	// Wait for interrupt signal
+	cli.WaitForSignal()
+
+	log.Printf("[%s] Shutting down...", cli.ShortID(*id))
+	miner.Stop()
+}
+
+// formatRate formats a bandwidth cap in bytes per second
+func formatRate(bytesPerSec int64) string {
+	if bytesPerSec <= 0 {
+		return "unlimited"
+	}
+	return resource.FormatBytes(uint64(bytesPerSec)) + "/s"
+}
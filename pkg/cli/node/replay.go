@@ -0,0 +1,125 @@
+package node
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"blockchain/pkg/storage"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// loadReplayChain reads a chain from a data directory or a running miner
+func loadReplayChain(dataDir, minerAddr string) ([]*block.Block, error) {
+	if dataDir != "" {
+		store, blocks, _, err := storage.Open(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		store.Close()
+		if len(blocks) == 0 {
+			return nil, fmt.Errorf("no blocks stored in %s", dataDir)
+		}
+		return blocks, nil
+	}
+
+	cred, err := cli.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	client, err := network.DialMiner(minerAddr, cred)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	chain, err := network.FetchChain(client, 0)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*block.Block, 0, len(chain))
+	for _, data := range chain {
+		b, err := block.DeserializeBlock(data)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// runReplay re-executes the validation of one block and prints the verdict,
+// and with -trace every rule, UTXO, and signature it checked
+func runReplay(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	common := cli.AddCommonFlags(fs)
+	blockRef := fs.String("block", "", "Hash or height of the block to replay (required)")
+	trace := fs.Bool("trace", false, "Print each rule checked, UTXO consumed/created, and signature verified")
+	dataDir := fs.String("datadir", "", "Read the chain from this data directory")
+	minerAddr := fs.String("miner", "", "Read the chain from the miner at this address")
+	difficulty := fs.Int("difficulty", 4, "Mining difficulty the chain was built with")
+	useMerkle := fs.Bool("merkle", true, "Use Merkle Tree for block hash calculation")
+	dynamicDiff := fs.Bool("dynamic-difficulty", false, "The chain uses dynamic difficulty adjustment")
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s replay -block <hash|height> (-datadir <dir> | -miner <address>) [-trace]\n", ctx.Prog)
+		fmt.Println()
+		fmt.Println("Re-executes one block's validation against the ledger as of its parent.")
+		fmt.Println("Use the same -difficulty, -merkle, -dynamic-difficulty, and -chain-params")
+		fmt.Println("as the node that built the chain, or its blocks will not validate.")
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	ctx.Parse(fs, args)
+
+	if *blockRef == "" || (*dataDir == "") == (*minerAddr == "") {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	defer common.OpenLog()()
+	params := common.Params("")
+
+	blocks, err := loadReplayChain(*dataDir, *minerAddr)
+	if err != nil {
+		logging.Fatalf("Failed to load chain: %v", err)
+	}
+	bc := blockchain.NewBlockchainFromBlocks(blocks, *difficulty,
+		blockchain.WithMerkleTree(*useMerkle),
+		blockchain.WithDynamicDifficulty(*dynamicDiff),
+		blockchain.WithParams(params),
+	)
+
+	var height int64 = -1
+	if b := bc.GetBlockByHash(*blockRef); b != nil {
+		height = b.Index
+	} else if h, err := strconv.ParseInt(*blockRef, 10, 64); err == nil {
+		height = h
+	} else {
+		logging.Fatalf("No block %s in the chain", *blockRef)
+	}
+
+	result, err := bc.TraceBlock(height)
+	if err != nil {
+		logging.Fatalf("Failed to replay block: %v", err)
+	}
+
+	fmt.Printf("Replaying block #%d %s\n", result.Height, result.Hash)
+	if *trace {
+		for i, step := range result.Steps {
+			mark := "ok"
+			if !step.OK {
+				mark = "FAIL"
+			}
+			fmt.Printf("%4d  %-4s  %-9s  %s\n", i+1, mark, step.Kind, step.Detail)
+		}
+	}
+	if result.Err != nil {
+		fmt.Printf("Block #%d is INVALID: %v\n", result.Height, result.Err)
+		os.Exit(2)
+	}
+	fmt.Printf("Block #%d is valid (%d steps)\n", result.Height, len(result.Steps))
+}
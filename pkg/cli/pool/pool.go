@@ -0,0 +1,137 @@
+// Package pool runs a mining pool for a node, a worker hashing for a pool, or
+// prints a pool's books. It is the pool command of the blockchain binary.
+package pool
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"blockchain/pkg/pool"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+// Command runs a mining pool or one of its workers
+var Command = cli.Command{Name: "pool", Summary: "Run a mining pool for a node, or a worker hashing shares for one", Run: run}
+
+func usage(prog string) {
+	fmt.Printf("Usage: %s serve [-miner <address>] [-listen <address>] [-share-difficulty <bits>] [-refresh <duration>]\n", prog)
+	fmt.Printf("       %s work -pool <address> -worker <name> [-threads <n>] [-refresh <duration>]\n", prog)
+	fmt.Printf("       %s stats -pool <address>\n", prog)
+	fmt.Println()
+	fmt.Println("serve hands out the miner's block templates as jobs, counts the shares workers")
+	fmt.Println("find at the share difficulty, and submits those that solve a block. Each block's")
+	fmt.Println("reward is split among the workers by their shares of the round that found it;")
+	fmt.Println("the coinbase pays the miner's address, and the pool's books say who is owed what.")
+	fmt.Println()
+	fmt.Println("work hashes the pool's jobs and submits every share until interrupted; stats")
+	fmt.Println("prints the pool's books as JSON.")
+}
+
+func run(ctx *cli.Context, args []string) {
+	if len(args) == 0 {
+		usage(ctx.Prog)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "serve":
+		serve(ctx, args[1:])
+	case "work":
+		work(ctx, args[1:])
+	case "stats":
+		stats(ctx, args[1:])
+	default:
+		usage(ctx.Prog)
+		os.Exit(1)
+	}
+}
+
+func serve(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	common := cli.AddCommonFlags(fs)
+	minerAddr := fs.String("miner", "localhost:8001", "Miner to fetch block templates from and submit blocks to")
+	listen := fs.String("listen", "localhost:9001", "Address workers connect to")
+	shareDifficulty := fs.Int("share-difficulty", 0, fmt.Sprintf("Leading zero bits a share needs (default: %d fewer than the block)", pool.DefaultShareBits))
+	refresh := fs.Duration("refresh", pool.DefaultRefresh, "Fetch a new template once a job is this old")
+	fs.Usage = func() { usage(ctx.Prog); fmt.Println(); fs.PrintDefaults() }
+	ctx.Parse(fs, args)
+	defer common.OpenLog()()
+
+	cred, err := cli.Credentials()
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	p := pool.New(pool.Node{Client: &network.Client{Auth: cred}, Address: *minerAddr}, *shareDifficulty, *refresh)
+	if _, err := p.Job(); err != nil {
+		logging.Fatalf("Failed to get a job from %s: %v", *minerAddr, err)
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logging.Fatalf("Failed to listen on %s: %v", *listen, err)
+	}
+	log.Printf("[POOL] Mining for %s, serving workers on %s", *minerAddr, l.Addr())
+	go func() {
+		if err := p.Serve(l); err != nil {
+			logging.Fatalf("Pool server failed: %v", err)
+		}
+	}()
+
+	cli.WaitForSignal()
+	l.Close()
+	s := p.Stats()
+	log.Printf("[POOL] Stopped after %d shares and %d blocks", s.Shares, len(s.Blocks))
+}
+
+func work(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	poolAddr := fs.String("pool", "localhost:9001", "Pool to hash for")
+	worker := fs.String("worker", "", "Name the pool credits shares to")
+	threads := fs.Int("threads", runtime.NumCPU(), "Parallel hashing workers")
+	refresh := fs.Duration("refresh", pool.DefaultRefresh, "Fetch a new job after hashing one this long")
+	fs.Usage = func() { usage(ctx.Prog); fmt.Println(); fs.PrintDefaults() }
+	ctx.Parse(fs, args)
+	if *worker == "" || *threads < 1 || *refresh <= 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	runCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	log.Printf("[POOL] Hashing for %s as %s on %d threads", *poolAddr, *worker, *threads)
+	stats, err := pool.Work(runCtx, *poolAddr, *worker, *threads, *refresh, func(reply pool.ShareReply) {
+		switch {
+		case reply.Result.Block:
+			log.Printf("[POOL] Share solved block #%d %s", reply.Result.Height, cli.ShortID(reply.Result.Hash))
+		case reply.Result.Error != "":
+			log.Printf("[POOL] Share solved block #%d, refused by the node: %s", reply.Result.Height, reply.Result.Error)
+		case !reply.Accepted && !reply.Stale:
+			log.Printf("[POOL] Share refused: %s", reply.Error)
+		}
+	})
+	log.Printf("[POOL] %s: %v", *worker, stats)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+}
+
+func stats(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	poolAddr := fs.String("pool", "localhost:9001", "Pool to query")
+	fs.Usage = func() { usage(ctx.Prog); fmt.Println(); fs.PrintDefaults() }
+	ctx.Parse(fs, args)
+
+	s, err := pool.GetStats(*poolAddr)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	data, _ := json.MarshalIndent(s, "", "  ")
+	fmt.Println(string(data))
+}
@@ -0,0 +1,146 @@
+// Package sim runs synthetic wallet agents against a miner and writes datasets
+// of which fees got which transactions included, for studying fee markets. It
+// is the sim command of the blockchain binary and the whole of the feesim
+// binary.
+package sim
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/cli"
+	"blockchain/pkg/feesim"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"blockchain/pkg/wallet"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+// Command runs a fee market simulation
+var Command = cli.Command{Name: "sim", Summary: "Simulate a fee market of wallet agents against a miner", Run: run}
+
+func run(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	common := cli.AddCommonFlags(fs)
+	minerAddr := fs.String("miner", "", "Miner to run against; it must pay its coinbases to -payout-seed (default: start one in-process)")
+	payoutSeed := fs.String("payout-seed", "", "HD wallet seed the miner was started with; its coinbases fund the agents")
+	configPath := fs.String("config", "", "JSON file describing the rounds and agent groups (default: a built-in mix)")
+	rounds := fs.Int("rounds", 0, "Override the config's rounds (blocks to submit transactions for)")
+	drain := fs.Int("drain", -1, "Override the config's drain (further blocks to wait for pending transactions)")
+	seed := fs.Int64("seed", 0, "Seed for random bids (default: from the config, or the clock)")
+	outDir := fs.String("out", "", "Directory for transactions.csv, blocks.csv, and summary.json (default: feesim-<time>)")
+	asJSON := fs.Bool("json", false, "Print the group summaries as JSON instead of a table")
+	localAddr := fs.String("local-address", "localhost:8101", "Listen address of the in-process miner")
+	difficulty := fs.Int("difficulty", 18, "In-process miner: difficulty, which sets how fast blocks come")
+	blockTxs := fs.Int("block-txs", 5, "In-process miner: most transactions per block, the scarce space agents bid for")
+	ctx.Parse(fs, args)
+	defer common.OpenLog()()
+
+	cfg := feesim.DefaultConfig()
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			logging.Fatalf("Failed to read config: %v", err)
+		}
+		cfg = feesim.Config{}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			logging.Fatalf("Invalid config: %v", err)
+		}
+	}
+	if *rounds > 0 {
+		cfg.Rounds = *rounds
+	}
+	if *drain >= 0 {
+		cfg.Drain = *drain
+	}
+	if *seed != 0 {
+		cfg.Seed = *seed
+	}
+
+	var payout *wallet.HDWallet
+	var err error
+	if *minerAddr == "" {
+		// Start a miner paying a fresh wallet, unless one was given
+		if *payoutSeed != "" {
+			payout, err = wallet.HDWalletFromHex(*payoutSeed)
+		} else {
+			payout, err = wallet.GenerateHDWallet()
+		}
+		if err != nil {
+			logging.Fatalf("Invalid payout seed: %v", err)
+		}
+		m := network.NewMiner("feesim-miner", *localAddr, *difficulty, nil,
+			network.WithPayoutWallet(payout), network.WithMaxBlockTxs(*blockTxs),
+			network.WithChainOptions(blockchain.WithParams(common.Params("feesim-miner"))))
+		if err := m.Start(); err != nil {
+			logging.Fatalf("Failed to start miner: %v", err)
+		}
+		defer m.Stop()
+		m.StartMining()
+		*minerAddr = *localAddr
+		log.Printf("Started an in-process miner on %s (difficulty %d, %d transactions per block)", *localAddr, *difficulty, *blockTxs)
+	} else {
+		if *payoutSeed == "" {
+			logging.Fatalf("-payout-seed is required with -miner")
+		}
+		if payout, err = wallet.HDWalletFromHex(*payoutSeed); err != nil {
+			logging.Fatalf("Invalid payout seed: %v", err)
+		}
+	}
+
+	cred, err := cli.Credentials()
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	node, err := feesim.Dial(*minerAddr, cred)
+	if err != nil {
+		logging.Fatalf("Failed to connect to miner: %v", err)
+	}
+	defer node.Close()
+
+	sim, err := feesim.New(cfg, node)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	sim.Logf = log.Printf
+
+	// A fresh miner needs a few blocks before its coinbases cover the agents
+	var funds feesim.Funds
+	deadline := time.Now().Add(sim.Timeout)
+	for {
+		funds, err = feesim.PayoutFunds(node, payout, sim.Needed())
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			logging.Fatalf("Failed to fund agents: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+
+	result, err := sim.Run(funds)
+	if err != nil {
+		logging.Fatalf("Simulation failed: %v", err)
+	}
+	dir := *outDir
+	if dir == "" {
+		dir = "feesim-" + time.Now().Format("20060102-150405")
+	}
+	if err := result.WriteDataset(dir); err != nil {
+		logging.Fatalf("Failed to write dataset: %v", err)
+	}
+	log.Printf("Wrote %d transactions and %d blocks to %s", len(result.Transactions), len(result.Blocks), dir)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(result.Groups)
+	} else {
+		err = result.WriteText(os.Stdout)
+	}
+	if err != nil {
+		logging.Fatalf("Failed to write summary: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package spvnode runs a light client node that keeps only block headers and
+// verifies transactions from Merkle proofs. It is the spv command of the
+// blockchain binary and the whole of the spvnode binary.
+package spvnode
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/spv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Command runs a light client node
+var Command = cli.Command{Name: "spv", Summary: "Run a light client that syncs headers and verifies transactions by Merkle proof", Run: run}
+
+// TxOutput reports whether a transaction was proven in the header chain in JSON format
+type TxOutput struct {
+	TxID          string `json:"txid"`
+	Verified      bool   `json:"verified"`
+	BlockHeight   int64  `json:"block_height,omitempty"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Confirmations int64  `json:"confirmations,omitempty"`
+	Miner         string `json:"miner,omitempty"` // Who served the proof
+	ProofHashes   int    `json:"proof_hashes,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// SyncOutput is the state of the header chain and the verified transactions in JSON format
+type SyncOutput struct {
+	Miners       []string   `json:"miners"`
+	Genesis      string     `json:"genesis"`
+	Headers      int        `json:"headers"`
+	TipHeight    int64      `json:"tip_height"`
+	TipHash      string     `json:"tip_hash"`
+	TipTime      string     `json:"tip_time"`
+	SyncError    string     `json:"sync_error,omitempty"` // Miners whose chains could not be used
+	Transactions []TxOutput `json:"transactions,omitempty"`
+}
+
+func run(ctx *cli.Context, args []string) {
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	miners := fs.String("miners", "localhost:8001", "Comma-separated full miners to sync headers from and ask for proofs")
+	genesis := fs.String("genesis", "", "Genesis block hash to require (default: the first miner's)")
+	txids := fs.String("txid", "", "Comma-separated transactions to verify")
+	interval := fs.Duration("interval", 10*time.Second, "How often to sync headers and re-verify the transactions")
+	once := fs.Bool("once", false, "Sync and verify once, print the result as JSON, and exit (status 2 if a transaction is not verified)")
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s [-miners <list>] [-txid <list>] [-genesis <hash>] [-interval <duration>] [-once]\n", ctx.Prog)
+		fmt.Println()
+		fmt.Println("Downloads only block headers, checking that they link and meet their proof of")
+		fmt.Println("work, and verifies each transaction from a Merkle proof checked against them.")
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	ctx.Parse(fs, args)
+
+	node := spv.NewNode(splitList(*miners), *genesis)
+	cred, err := cli.Credentials()
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	node.Auth = cred
+	watched := splitList(*txids)
+
+	if *once {
+		syncErr := node.Sync()
+		if node.Length() == 0 {
+			logging.Fatalf("Failed to sync headers: %v", syncErr)
+		}
+		output := syncOutput(node, syncErr)
+		allVerified := true
+		for _, txID := range watched {
+			result := verify(node, txID)
+			allVerified = allVerified && result.Verified
+			output.Transactions = append(output.Transactions, result)
+		}
+		data, _ := json.MarshalIndent(output, "", "  ")
+		fmt.Println(string(data))
+		if !allVerified {
+			os.Exit(2)
+		}
+		return
+	}
+
+	go func() {
+		var lastTip string
+		confirmations := make(map[string]int64) // -1 while not proven
+		for {
+			if err := node.Sync(); err != nil {
+				log.Printf("[SPV] Sync: %v", err)
+			}
+			if tip, ok := node.Tip(); ok && tip.Hash != lastTip {
+				lastTip = tip.Hash
+				log.Printf("[SPV] Header chain at #%d %s (%d headers)", tip.Index, cli.ShortID(tip.Hash), node.Length())
+			}
+			for _, txID := range watched {
+				result := verify(node, txID)
+				state := result.Confirmations
+				if !result.Verified {
+					state = -1
+				}
+				if last, ok := confirmations[txID]; ok && last == state {
+					continue
+				}
+				confirmations[txID] = state
+				if result.Verified {
+					log.Printf("[SPV] Transaction %s proven in block #%d by %s: %d confirmations",
+						cli.ShortID(txID), result.BlockHeight, result.Miner, result.Confirmations)
+				} else {
+					log.Printf("[SPV] Transaction %s not proven: %s", cli.ShortID(txID), result.Error)
+				}
+			}
+			time.Sleep(*interval)
+		}
+	}()
+
+	log.Printf("[SPV] Light client following %s", strings.Join(node.Miners, ", "))
+	cli.WaitForSignal()
+}
+
+// syncOutput reports the node's header chain
+func syncOutput(node *spv.Node, syncErr error) SyncOutput {
+	tip, _ := node.Tip()
+	output := SyncOutput{
+		Miners:    node.Miners,
+		Genesis:   node.Genesis,
+		Headers:   node.Length(),
+		TipHeight: tip.Index,
+		TipHash:   tip.Hash,
+		TipTime:   time.Unix(0, tip.Timestamp).Format(time.RFC3339),
+	}
+	if syncErr != nil {
+		output.SyncError = syncErr.Error()
+	}
+	return output
+}
+
+// verify asks the miners for a proof of txID and checks it
+func verify(node *spv.Node, txID string) TxOutput {
+	inc, err := node.VerifyTransaction(txID)
+	if err != nil {
+		return TxOutput{TxID: txID, Error: err.Error()}
+	}
+	return TxOutput{
+		TxID:          txID,
+		Verified:      true,
+		BlockHeight:   inc.BlockHeight,
+		BlockHash:     inc.BlockHash,
+		Confirmations: inc.Confirmations,
+		Miner:         inc.Miner,
+		ProofHashes:   len(inc.Proof.Siblings),
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
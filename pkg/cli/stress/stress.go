@@ -0,0 +1,57 @@
+// Package stress generates blocks packed with signed transactions and reports
+// how long each phase of validating them takes. It is the stress command of
+// the blockchain binary and the whole of the stress binary.
+package stress
+
+import (
+	"blockchain/pkg/cli"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/stress"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Command times block validation by phase
+var Command = cli.Command{Name: "stress", Summary: "Time validating generated blocks of signed transactions, by phase", Run: run}
+
+func run(ctx *cli.Context, args []string) {
+	def := stress.DefaultConfig()
+	fs := flag.NewFlagSet(ctx.Name, flag.ExitOnError)
+	blocks := fs.Int("blocks", def.Blocks, "Number of blocks to validate")
+	txs := fs.Int("txs", def.TxsPerBlock, "Signed transactions per block")
+	keys := fs.Int("keys", def.Keys, "Distinct signing keys")
+	merkle := fs.Bool("merkle", def.UseMerkleTree, "Hash blocks through their Merkle root")
+	asJSON := fs.Bool("json", false, "Write the report as JSON")
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s [-blocks <n>] [-txs <n>] [-keys <n>] [-merkle=false] [-json]\n", ctx.Prog)
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	ctx.Parse(fs, args)
+
+	cfg := stress.Config{Blocks: *blocks, TxsPerBlock: *txs, Keys: *keys, UseMerkleTree: *merkle}
+	log.Printf("Generating %d blocks of %d transactions...", cfg.Blocks, cfg.TxsPerBlock)
+	start := time.Now()
+	fixture, err := stress.Generate(cfg)
+	if err != nil {
+		logging.Fatalf("Failed to generate blocks: %v", err)
+	}
+	log.Printf("Generated in %v; validating", time.Since(start).Round(time.Millisecond))
+
+	report, err := fixture.Run()
+	if err != nil {
+		logging.Fatalf("Validation failed: %v", err)
+	}
+	if *asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		logging.Fatalf("Failed to write report: %v", err)
+	}
+}
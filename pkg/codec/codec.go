@@ -0,0 +1,206 @@
+// Package codec implements the primitives of the compact binary encoding of
+// blocks and transactions: varints, and strings whose lowercase hex parts
+// (hashes, keys, signatures) are packed as raw bytes. Every value has exactly
+// one encoding, so equal blocks encode to equal bytes.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version is the first byte of a binary-encoded block or transaction. It can
+// never begin JSON, so decoders tell the two apart by it. Encodings are
+// written in the latest version and read in any since MinVersion; a new field
+// needs a new version, which the decoder checks for before reading it.
+//
+// Version 2 ends a block with its proof-of-work algorithm, which version 1
+// blocks lack. Transactions are the same in both.
+const (
+	Version    byte = 2
+	MinVersion byte = 1
+)
+
+var ErrMalformed = errors.New("malformed binary encoding")
+
+// IsJSON reports whether data is JSON rather than the binary encoding
+func IsJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
+
+// Writer appends values to an encoding
+type Writer struct {
+	buf []byte
+}
+
+// NewWriter starts an encoding with the version byte
+func NewWriter() *Writer {
+	return &Writer{buf: []byte{Version}}
+}
+
+// Bytes returns the encoding
+func (w *Writer) Bytes() []byte { return w.buf }
+
+// Uvarint appends an unsigned varint, such as a count
+func (w *Writer) Uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+// Varint appends a zigzag-encoded signed varint
+func (w *Writer) Varint(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+// String appends a string as its ':'-separated parts, each packed to raw
+// bytes if it is non-empty, even-length lowercase hex
+func (w *Writer) String(s string) {
+	if s == "" {
+		w.Uvarint(0)
+		return
+	}
+	parts := strings.Split(s, ":")
+	w.Uvarint(uint64(len(parts)))
+	for _, part := range parts {
+		if isPackable(part) {
+			raw, _ := hex.DecodeString(part)
+			w.Uvarint(uint64(len(raw))<<1 | 1)
+			w.buf = append(w.buf, raw...)
+		} else {
+			w.Uvarint(uint64(len(part)) << 1)
+			w.buf = append(w.buf, part...)
+		}
+	}
+}
+
+// isPackable reports whether part is hex that decodes and re-encodes to itself
+func isPackable(part string) bool {
+	if part == "" || len(part)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(part); i++ {
+		if c := part[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Reader reads values from an encoding. The first error sticks: later reads
+// return zero values and Err reports it.
+type Reader struct {
+	data    []byte
+	err     error
+	version byte
+}
+
+// NewReader checks data's version byte and reads the values after it
+func NewReader(data []byte) *Reader {
+	r := &Reader{}
+	switch {
+	case len(data) == 0:
+		r.err = fmt.Errorf("%w: empty", ErrMalformed)
+	case data[0] < MinVersion || data[0] > Version:
+		r.err = fmt.Errorf("%w: unknown version %d", ErrMalformed, data[0])
+	default:
+		r.data, r.version = data[1:], data[0]
+	}
+	return r
+}
+
+// Version returns the version of the encoding, so decoders read only the
+// fields it has
+func (r *Reader) Version() byte {
+	return r.version
+}
+
+// Err returns the first error met, or one if bytes are left over
+func (r *Reader) Err() error {
+	if r.err == nil && len(r.data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformed, len(r.data))
+	}
+	return r.err
+}
+
+func (r *Reader) fail(what string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: bad %s", ErrMalformed, what)
+	}
+	r.data = nil
+}
+
+// Uvarint reads an unsigned varint
+func (r *Reader) Uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// Varint reads a signed varint
+func (r *Reader) Varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail("varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// Count reads the length of a list whose items take at least one byte each,
+// so a forged count cannot make the caller allocate more than data holds
+func (r *Reader) Count() int {
+	n := r.Uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail("count")
+		return 0
+	}
+	return int(n)
+}
+
+// String reads a string written by Writer.String
+func (r *Reader) String() string {
+	n := r.Count()
+	if n == 0 {
+		return ""
+	}
+	parts := make([]string, n)
+	for i := range parts {
+		header := r.Uvarint()
+		size := header >> 1
+		if size > uint64(len(r.data)) {
+			r.fail("string")
+			return ""
+		}
+		raw := r.data[:size]
+		r.data = r.data[size:]
+		if header&1 == 1 {
+			parts[i] = hex.EncodeToString(raw)
+		} else if parts[i] = string(raw); isPackable(parts[i]) {
+			r.fail("string: unpacked hex") // Not the one encoding
+			return ""
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// OptionalString reads a string that version 1 encodings may end with: it is
+// missing if empty, or else written as by String
+func (r *Reader) OptionalString() string {
+	if r.err != nil || len(r.data) == 0 {
+		return ""
+	}
+	s := r.String()
+	if s == "" {
+		r.fail("string: empty optional") // Not the one encoding
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"", "miner1", "coinbase:42", "abcd", "ABCD", "abc", "00ff:", ":", "deadbeef:miner:0a",
+	} {
+		w := NewWriter()
+		w.String(s)
+		r := NewReader(w.Bytes())
+		if got := r.String(); got != s || r.Err() != nil {
+			t.Errorf("Round trip of %q gave %q (%v)", s, got, r.Err())
+		}
+	}
+
+	// Lowercase hex packs to half its length
+	w := NewWriter()
+	w.String(string(bytes.Repeat([]byte("ab"), 32)))
+	if len(w.Bytes()) != 1+1+1+32 {
+		t.Errorf("Expected a 64-char hash to take 35 bytes, got %d", len(w.Bytes()))
+	}
+}
+
+func TestReaderRejectsMalformed(t *testing.T) {
+	w := NewWriter()
+	w.Varint(-7)
+	w.String("feed")
+	good := w.Bytes()
+
+	cases := map[string][]byte{
+		"empty":           {},
+		"unknown version": append([]byte{Version + 1}, good[1:]...),
+		"truncated":       good[:len(good)-1],
+		"trailing bytes":  append(append([]byte{}, good...), 0),
+		"unpacked hex":    {Version, 0x0d, 1, 8, 'f', 'e', 'e', 'd'},
+		"forged count":    {Version, 0x0d, 0xff, 0xff, 0x03},
+	}
+	for name, data := range cases {
+		r := NewReader(data)
+		r.Varint()
+		_ = r.String()
+		if err := r.Err(); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+
+	r := NewReader(good)
+	if v, s := r.Varint(), r.String(); v != -7 || s != "feed" || r.Err() != nil {
+		t.Errorf("Expected -7 and feed, got %d %q (%v)", v, s, r.Err())
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	if !IsJSON([]byte(" \n{\"id\":1}")) || IsJSON(NewWriter().Bytes()) || IsJSON(nil) {
+		t.Error("IsJSON should tell JSON objects from the binary encoding")
+	}
+}
+
+func TestReaderVersions(t *testing.T) {
+	for v := MinVersion; v <= Version; v++ {
+		r := NewReader([]byte{v, 0x06})
+		if got := r.Varint(); got != 3 || r.Version() != v || r.Err() != nil {
+			t.Errorf("Version %d: read %d at version %d (%v)", v, got, r.Version(), r.Err())
+		}
+	}
+	if r := NewReader([]byte{MinVersion - 1, 0x06}); !errors.Is(r.Err(), ErrMalformed) {
+		t.Errorf("Expected a version before MinVersion to be refused, got %v", r.Err())
+	}
+}
+
+func TestOptionalString(t *testing.T) {
+	for _, s := range []string{"", "scrypt-lite"} {
+		w := NewWriter()
+		w.Varint(3)
+		if s != "" {
+			w.String(s)
+		}
+		r := NewReader(w.Bytes())
+		if v, got := r.Varint(), r.OptionalString(); v != 3 || got != s || r.Err() != nil {
+			t.Errorf("Round trip of %q gave %d %q (%v)", s, v, got, r.Err())
+		}
+	}
+
+	// An explicitly empty value is not the one encoding of a missing one
+	r := NewReader([]byte{Version, 0x06, 0})
+	r.Varint()
+	if _ = r.OptionalString(); !errors.Is(r.Err(), ErrMalformed) {
+		t.Errorf("Expected ErrMalformed, got %v", r.Err())
+	}
+}
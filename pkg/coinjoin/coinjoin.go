@@ -0,0 +1,288 @@
+// Package coinjoin coordinates collaborative transactions in which several
+// wallets contribute inputs and each receives an output of the same value,
+// so an observer cannot link mixed outputs back to the inputs that paid them
+package coinjoin
+
+import (
+	"blockchain/pkg/transaction"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownRound      = errors.New("unknown coinjoin round")
+	ErrRoundNotSigning   = errors.New("coinjoin round is not collecting signatures")
+	ErrUnknownInput      = errors.New("input does not reference an unspent output")
+	ErrInputRegistered   = errors.New("input already registered in this round")
+	ErrInsufficientFunds = errors.New("inputs do not cover the denomination and fee")
+	ErrMissingChange     = errors.New("change address required when inputs exceed the denomination and fee")
+	ErrAddressReused     = errors.New("output address already registered in this round")
+	ErrBadSignature      = errors.New("signature does not verify against the input owner")
+)
+
+// State is the phase of a coinjoin round
+type State string
+
+const (
+	StateRegistering State = "registering" // Waiting for participants
+	StateSigning     State = "signing"     // Combined transaction built, collecting signatures
+	StateComplete    State = "complete"    // Fully signed and handed off for broadcast
+)
+
+// UTXOLookup resolves an input reference to the unspent output it spends
+type UTXOLookup func(txID string, outIndex int) *transaction.UTXO
+
+// Registration is one participant's contribution to a round
+type Registration struct {
+	Inputs        []transaction.TxInput // Outputs to spend (ScriptSig is ignored)
+	MixAddress    string                // Receives exactly the denomination
+	ChangeAddress string                // Receives inputs - denomination - fee, if any
+}
+
+// RoundInfo is a snapshot of a round's progress
+type RoundInfo struct {
+	ID           string
+	State        State
+	Denomination int64
+	Participants int
+	Size         int
+	Tx           *transaction.Transaction // Set once the round reaches StateSigning
+}
+
+// round is the coordinator's internal state for one coinjoin
+type round struct {
+	id           string
+	state        State
+	participants []Registration
+	spent        map[string]transaction.TxOutput // "txid:index" -> the output it spends
+	addresses    map[string]bool
+	tx           *transaction.Transaction
+}
+
+// Coordinator collects registrations into fixed-size rounds and assembles
+// one combined transaction per round for the participants to sign
+type Coordinator struct {
+	denomination int64
+	size         int
+	fee          int64 // Paid by each participant
+	lookup       UTXOLookup
+	onComplete   func(tx *transaction.Transaction)
+
+	rounds  map[string]*round
+	current *round
+	mu      sync.Mutex
+}
+
+// NewCoordinator creates a coordinator for rounds of size participants, each
+// mixing denomination satoshi and paying fee satoshi toward the transaction fee
+func NewCoordinator(denomination int64, size int, fee int64, lookup UTXOLookup) *Coordinator {
+	if size < 2 {
+		size = 2
+	}
+	return &Coordinator{
+		denomination: denomination,
+		size:         size,
+		fee:          fee,
+		lookup:       lookup,
+		rounds:       make(map[string]*round),
+	}
+}
+
+// SetCompleteCallback sets the function that receives each fully signed transaction
+func (c *Coordinator) SetCompleteCallback(fn func(tx *transaction.Transaction)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onComplete = fn
+}
+
+// Register adds a participant to the open round and returns its ID. The round
+// moves to signing as soon as it has enough participants.
+func (c *Coordinator) Register(reg Registration) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current == nil {
+		c.current = &round{
+			id:        newRoundID(),
+			state:     StateRegistering,
+			spent:     make(map[string]transaction.TxOutput),
+			addresses: make(map[string]bool),
+		}
+		c.rounds[c.current.id] = c.current
+	}
+	r := c.current
+
+	if len(reg.Inputs) == 0 {
+		return "", ErrInsufficientFunds
+	}
+	var total int64
+	spent := make(map[string]transaction.TxOutput)
+	for _, in := range reg.Inputs {
+		key := fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)
+		if _, ok := r.spent[key]; ok {
+			return "", ErrInputRegistered
+		}
+		if _, ok := spent[key]; ok {
+			return "", ErrInputRegistered
+		}
+		utxo := c.lookup(in.TxID, in.OutIndex)
+		if utxo == nil {
+			return "", fmt.Errorf("%w: %s", ErrUnknownInput, key)
+		}
+		spent[key] = utxo.Output()
+		total += utxo.Value
+	}
+
+	change := total - c.denomination - c.fee
+	if change < 0 {
+		return "", ErrInsufficientFunds
+	}
+	if change > 0 && reg.ChangeAddress == "" {
+		return "", ErrMissingChange
+	}
+	if reg.MixAddress == "" || r.addresses[reg.MixAddress] ||
+		(change > 0 && (r.addresses[reg.ChangeAddress] || reg.ChangeAddress == reg.MixAddress)) {
+		return "", ErrAddressReused
+	}
+
+	for key, out := range spent {
+		r.spent[key] = out
+	}
+	r.addresses[reg.MixAddress] = true
+	if change > 0 {
+		r.addresses[reg.ChangeAddress] = true
+	} else {
+		reg.ChangeAddress = ""
+	}
+	reg.Inputs = append([]transaction.TxInput(nil), reg.Inputs...)
+	r.participants = append(r.participants, reg)
+
+	if len(r.participants) >= c.size {
+		r.tx = c.buildTransaction(r)
+		r.state = StateSigning
+		c.current = nil
+	}
+	return r.id, nil
+}
+
+// buildTransaction assembles the unsigned combined transaction. Inputs and
+// outputs are sorted so their order reveals nothing about who registered when.
+func (c *Coordinator) buildTransaction(r *round) *transaction.Transaction {
+	var inputs []transaction.TxInput
+	var mixed, change []transaction.TxOutput
+	for _, p := range r.participants {
+		for _, in := range p.Inputs {
+			inputs = append(inputs, transaction.TxInput{TxID: in.TxID, OutIndex: in.OutIndex})
+		}
+		mixed = append(mixed, transaction.TxOutput{Value: c.denomination, ScriptPubKey: p.MixAddress})
+		if p.ChangeAddress != "" {
+			var total int64
+			for _, in := range p.Inputs {
+				total += c.lookup(in.TxID, in.OutIndex).Value
+			}
+			change = append(change, transaction.TxOutput{
+				Value:        total - c.denomination - c.fee,
+				ScriptPubKey: p.ChangeAddress,
+			})
+		}
+	}
+
+	sort.Slice(inputs, func(i, j int) bool {
+		if inputs[i].TxID != inputs[j].TxID {
+			return inputs[i].TxID < inputs[j].TxID
+		}
+		return inputs[i].OutIndex < inputs[j].OutIndex
+	})
+	sort.Slice(mixed, func(i, j int) bool { return mixed[i].ScriptPubKey < mixed[j].ScriptPubKey })
+	sort.Slice(change, func(i, j int) bool { return change[i].ScriptPubKey < change[j].ScriptPubKey })
+
+	return transaction.NewUTXOTransaction(inputs, append(mixed, change...))
+}
+
+// Round returns a snapshot of a round. The transaction is a copy that the
+// participant can sign without affecting the coordinator's state.
+func (c *Coordinator) Round(id string) (*RoundInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.rounds[id]
+	if !ok {
+		return nil, ErrUnknownRound
+	}
+	info := &RoundInfo{
+		ID:           r.id,
+		State:        r.state,
+		Denomination: c.denomination,
+		Participants: len(r.participants),
+		Size:         c.size,
+	}
+	if r.tx != nil {
+		tx := *r.tx
+		tx.Inputs = append([]transaction.TxInput(nil), r.tx.Inputs...)
+		tx.Outputs = append([]transaction.TxOutput(nil), r.tx.Outputs...)
+		info.Tx = &tx
+	}
+	return info, nil
+}
+
+// Sign attaches signatures, keyed by "txid:index", for inputs of a round's
+// transaction. Once every input is signed the transaction is complete and is
+// passed to the completion callback.
+func (c *Coordinator) Sign(id string, signatures map[string]string) error {
+	c.mu.Lock()
+	r, ok := c.rounds[id]
+	if !ok {
+		c.mu.Unlock()
+		return ErrUnknownRound
+	}
+	if r.state != StateSigning {
+		c.mu.Unlock()
+		return ErrRoundNotSigning
+	}
+
+	// Verify everything before applying anything so a bad batch changes nothing
+	index := make(map[string]int, len(r.tx.Inputs))
+	for i, in := range r.tx.Inputs {
+		index[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)] = i
+	}
+	for key, sig := range signatures {
+		if _, ok := index[key]; !ok {
+			c.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrUnknownInput, key)
+		}
+		if !r.tx.VerifyInputSpending(index[key], sig, r.spent[key]) {
+			c.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrBadSignature, key)
+		}
+	}
+	for key, sig := range signatures {
+		r.tx.Inputs[index[key]].ScriptSig = sig
+	}
+
+	for _, in := range r.tx.Inputs {
+		if in.ScriptSig == "" {
+			c.mu.Unlock()
+			return nil
+		}
+	}
+	r.tx.ID = r.tx.CalculateHash()
+	r.state = StateComplete
+	tx, onComplete := r.tx, c.onComplete
+	c.mu.Unlock()
+
+	if onComplete != nil {
+		onComplete(tx)
+	}
+	return nil
+}
+
+// newRoundID returns a random round identifier
+func newRoundID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
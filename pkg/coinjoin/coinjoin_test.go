@@ -0,0 +1,134 @@
+package coinjoin
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type participant struct {
+	kp   *transaction.KeyPair
+	utxo *transaction.UTXO
+}
+
+// setup creates n participants each owning one UTXO of the given value
+func setup(t *testing.T, n int, value int64) ([]participant, UTXOLookup) {
+	utxos := make(map[string]*transaction.UTXO)
+	var ps []participant
+	for i := 0; i < n; i++ {
+		kp, err := transaction.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := &transaction.UTXO{TxID: fmt.Sprintf("tx%d", i), OutIndex: 0, Value: value, ScriptPubKey: kp.GetPublicKeyHex()}
+		utxos[fmt.Sprintf("%s:%d", u.TxID, u.OutIndex)] = u
+		ps = append(ps, participant{kp: kp, utxo: u})
+	}
+	lookup := func(txID string, outIndex int) *transaction.UTXO {
+		return utxos[fmt.Sprintf("%s:%d", txID, outIndex)]
+	}
+	return ps, lookup
+}
+
+func TestRoundBuildsEqualOutputsAndCompletes(t *testing.T) {
+	ps, lookup := setup(t, 3, 1500)
+	c := NewCoordinator(1000, 3, 100, lookup)
+
+	var completed *transaction.Transaction
+	c.SetCompleteCallback(func(tx *transaction.Transaction) { completed = tx })
+
+	var roundID string
+	for i, p := range ps {
+		id, err := c.Register(Registration{
+			Inputs:        []transaction.TxInput{{TxID: p.utxo.TxID, OutIndex: 0}},
+			MixAddress:    fmt.Sprintf("mix%d", i),
+			ChangeAddress: fmt.Sprintf("change%d", i),
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		roundID = id
+	}
+
+	info, err := c.Round(roundID)
+	if err != nil || info.State != StateSigning {
+		t.Fatalf("Full round should be signing, got %v, %v", info, err)
+	}
+	equal := 0
+	for _, out := range info.Tx.Outputs {
+		if out.Value == 1000 {
+			equal++
+		}
+	}
+	if equal != 3 || len(info.Tx.Outputs) != 6 {
+		t.Errorf("Expected 3 equal mixed outputs plus 3 change outputs, got %+v", info.Tx.Outputs)
+	}
+
+	// Each participant signs only their own input, at its position in the shared transaction
+	for _, p := range ps {
+		for i, in := range info.Tx.Inputs {
+			if in.TxID != p.utxo.TxID {
+				continue
+			}
+			sig, _ := info.Tx.SignInput(i, p.kp.GetPrivateKeyHex())
+			if err := c.Sign(roundID, map[string]string{p.utxo.TxID + ":0": sig}); err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+		}
+	}
+
+	if completed == nil {
+		t.Fatal("Completion callback should receive the signed transaction")
+	}
+	owners := make(map[int]string)
+	for i, in := range completed.Inputs {
+		owners[i] = lookup(in.TxID, in.OutIndex).ScriptPubKey
+	}
+	if !completed.Verify() || !completed.VerifySignatures(owners) {
+		t.Error("Combined transaction should carry valid signatures for every input")
+	}
+}
+
+func TestRegisterRejectsBadInput(t *testing.T) {
+	ps, lookup := setup(t, 2, 1000)
+	c := NewCoordinator(1000, 2, 100, lookup)
+
+	_, err := c.Register(Registration{
+		Inputs:     []transaction.TxInput{{TxID: ps[0].utxo.TxID, OutIndex: 0}},
+		MixAddress: "mix0",
+	})
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected insufficient funds, got %v", err)
+	}
+
+	c = NewCoordinator(900, 2, 100, lookup)
+	reg := Registration{Inputs: []transaction.TxInput{{TxID: ps[0].utxo.TxID, OutIndex: 0}}, MixAddress: "mix0"}
+	if _, err := c.Register(reg); err != nil {
+		t.Fatalf("Exact-amount registration should succeed: %v", err)
+	}
+	if _, err := c.Register(reg); !errors.Is(err, ErrInputRegistered) {
+		t.Errorf("Expected duplicate input rejection, got %v", err)
+	}
+	if _, err := c.Register(Registration{Inputs: []transaction.TxInput{{TxID: "missing", OutIndex: 0}}, MixAddress: "mix1"}); !errors.Is(err, ErrUnknownInput) {
+		t.Errorf("Expected unknown input rejection, got %v", err)
+	}
+}
+
+func TestSignRejectsForeignSignature(t *testing.T) {
+	ps, lookup := setup(t, 2, 1000)
+	c := NewCoordinator(900, 2, 100, lookup)
+	var id string
+	for i, p := range ps {
+		id, _ = c.Register(Registration{
+			Inputs:     []transaction.TxInput{{TxID: p.utxo.TxID, OutIndex: 0}},
+			MixAddress: fmt.Sprintf("mix%d", i),
+		})
+	}
+
+	info, _ := c.Round(id)
+	sig, _ := transaction.SignECDSA(info.Tx.GetDataToSign(), ps[1].kp.GetPrivateKeyHex())
+	if err := c.Sign(id, map[string]string{ps[0].utxo.TxID + ":0": sig}); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Signing another participant's input should fail, got %v", err)
+	}
+}
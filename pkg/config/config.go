@@ -1,4 +1,8 @@
-// Package config provides global configuration for the blockchain
+// Package config provides process-wide defaults for the blockchain, and reads
+// the configuration files that set command flags (see File).
+// The globals leak across every chain and miner in a process, so features are
+// configured per instance with blockchain.Option and network.MinerOption; the
+// values here are only used as defaults when no option is given.
 package config
 
 import "sync"
@@ -27,6 +31,8 @@ func UseMerkleTree() bool {
 }
 
 // SetUseMerkleTree sets whether to use Merkle Tree for block hash calculation
+//
+// Deprecated: use blockchain.WithMerkleTree or block.WithMerkleTree.
 func SetUseMerkleTree(use bool) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -41,6 +47,8 @@ func UseDynamicDifficulty() bool {
 }
 
 // SetUseDynamicDifficulty sets whether to use dynamic difficulty adjustment
+//
+// Deprecated: use blockchain.WithDynamicDifficulty.
 func SetUseDynamicDifficulty(use bool) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -56,6 +64,8 @@ func MiningThreads() int {
 
 // SetMiningThreads sets the number of parallel threads for mining
 // If threads <= 0, it defaults to 1 (sequential mining)
+//
+// Deprecated: use network.WithMiningThreads.
 func SetMiningThreads(threads int) {
 	mu.Lock()
 	defer mu.Unlock()
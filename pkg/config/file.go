@@ -0,0 +1,426 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// File holds the flag values of a configuration file as text: top-level
+// values, and sections of values named after commands. Lists are joined with
+// commas, and underscores in keys read as hyphens, so mempool_ttl sets
+// -mempool-ttl.
+//
+// A section named network.<name> holds the values of a network, such as its
+// peers and chain params, so that one file can describe several (see
+// Network). The network key names the one used when none is chosen.
+//
+// The format follows the extension: YAML for .yaml and .yml, TOML for .toml,
+// and JSON otherwise. Only what flag values need is understood: scalars,
+// lists of scalars, and one level of sections.
+//
+//	# YAML                          # TOML
+//	difficulty: 5                   difficulty = 5
+//	network: lab                    network = "lab"
+//	node:                           [node]
+//	  id: m1                        id = "m1"
+//	network.lab:                    [network.lab]
+//	  peers:                        peers = ["10.0.0.6:8001", "10.0.0.7:8001"]
+//	    - 10.0.0.6:8001
+//	    - 10.0.0.7:8001
+type File struct {
+	Path     string
+	Values   map[string]string
+	Sections map[string]map[string]string
+}
+
+// Load reads the configuration file at path
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	f := &File{Path: path, Values: map[string]string{}, Sections: map[string]map[string]string{}}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = f.parseYAML(data)
+	case ".toml":
+		err = f.parseTOML(data)
+	default:
+		err = f.parseJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// NetworkSection prefixes the names of the sections holding networks
+const NetworkSection = "network."
+
+// Network returns the values of the network called name, and whether the
+// file defines it
+func (f *File) Network(name string) (map[string]string, bool) {
+	values, ok := f.Sections[NetworkSection+name]
+	return values, ok
+}
+
+// Networks returns the names of the networks the file defines, sorted
+func (f *File) Networks() []string {
+	var names []string
+	for section := range f.Sections {
+		if name, ok := strings.CutPrefix(section, NetworkSection); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// set records value under key, in section if it is not ""
+func (f *File) set(section, key, value string) {
+	key = strings.ReplaceAll(key, "_", "-")
+	if section == "" {
+		f.Values[key] = value
+		return
+	}
+	if f.Sections[section] == nil {
+		f.Sections[section] = map[string]string{}
+	}
+	f.Sections[section][key] = value
+}
+
+// parseJSON reads a JSON object of values and objects of values
+func (f *File) parseJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for key, value := range raw {
+		if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			var section map[string]json.RawMessage
+			if err := json.Unmarshal(value, &section); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			f.Sections[key] = map[string]string{}
+			for name, v := range section {
+				s, err := jsonValue(v)
+				if err != nil {
+					return fmt.Errorf("%s.%s: %v", key, name, err)
+				}
+				f.set(key, name, s)
+			}
+			continue
+		}
+		s, err := jsonValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		f.set("", key, s)
+	}
+	return nil
+}
+
+// jsonValue turns a JSON string, number, boolean, or list of them into the
+// text of a flag value
+func jsonValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if !bytes.HasPrefix(raw, []byte("[")) {
+		return jsonScalar(raw)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return "", err
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		s, err := jsonScalar(bytes.TrimSpace(item))
+		if err != nil {
+			return "", err
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func jsonScalar(raw json.RawMessage) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return string(raw), nil
+	}
+	return "", fmt.Errorf("expected a string, number, boolean, or list of them")
+}
+
+// parseYAML reads block mappings nested at most one level, block lists of
+// scalars, and flow lists such as [a, b]
+func (f *File) parseYAML(data []byte) error {
+	var (
+		section       string // Section being read, "" at the top level
+		pending       string // Key given no value; its lines below decide what it holds
+		pendingIndent int
+		list          []string // Items under pending, if it holds a list
+	)
+	flush := func() {
+		if pending == "" {
+			return
+		}
+		if section == "" && list == nil {
+			// A key with nothing under it at the top level is an empty section
+			f.Sections[pending] = map[string]string{}
+		} else {
+			f.set(section, pending, strings.Join(list, ","))
+		}
+		pending, list = "", nil
+	}
+
+	for n, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripComment(line), " \t\r")
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		text = strings.TrimSpace(text)
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: "+format, append([]interface{}{n + 1}, args...)...)
+		}
+
+		if item, ok := strings.CutPrefix(text, "-"); ok && (item == "" || item[0] == ' ') {
+			if pending == "" || indent < pendingIndent {
+				return errorf("list item outside a list")
+			}
+			v, err := yamlScalar(strings.TrimSpace(item))
+			if err != nil {
+				return errorf("%v", err)
+			}
+			list = append(list, v)
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || key == "" {
+			return errorf("expected key: value")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if indent > 0 && pending != "" && section == "" && list == nil && indent > pendingIndent {
+			// The key above opens a section
+			section, pending = pending, ""
+			f.Sections[section] = map[string]string{}
+		}
+		if pending != "" && list == nil && indent > pendingIndent {
+			return errorf("%s: only one level of sections is supported", pending)
+		}
+		flush()
+		switch {
+		case indent == 0:
+			section = ""
+		case section == "":
+			return errorf("unexpected indentation")
+		}
+		if value == "" {
+			pending, pendingIndent = key, indent
+			continue
+		}
+		v, err := yamlValue(value)
+		if err != nil {
+			return errorf("%s: %v", key, err)
+		}
+		f.set(section, key, v)
+	}
+	flush()
+	return nil
+}
+
+// yamlValue reads a scalar or a flow list of scalars
+func yamlValue(s string) (string, error) {
+	inner, ok := strings.CutPrefix(s, "[")
+	if !ok {
+		return yamlScalar(s)
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return "", fmt.Errorf("unterminated list %s", s)
+	}
+	items, err := splitList(inner)
+	if err != nil {
+		return "", err
+	}
+	for i, item := range items {
+		if items[i], err = yamlScalar(item); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(items, ","), nil
+}
+
+// yamlScalar reads a plain or quoted scalar
+func yamlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		inner, ok := strings.CutSuffix(s[1:], "'")
+		if !ok {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(inner, "''", "'"), nil
+	case strings.HasPrefix(s, "{"), strings.HasPrefix(s, "["):
+		return "", fmt.Errorf("expected a scalar, got %s", s)
+	case s == "~" || s == "null":
+		return "", nil
+	}
+	return s, nil
+}
+
+// parseTOML reads key = value pairs under optional [section] tables. Values
+// are strings, numbers, booleans, or arrays of them, which may span lines.
+func (f *File) parseTOML(data []byte) error {
+	section := ""
+	lines := strings.Split(string(data), "\n")
+	for n := 0; n < len(lines); n++ {
+		text := strings.TrimSpace(stripComment(lines[n]))
+		if text == "" {
+			continue
+		}
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: "+format, append([]interface{}{n + 1}, args...)...)
+		}
+
+		if name, ok := strings.CutPrefix(text, "["); ok {
+			name, ok = strings.CutSuffix(name, "]")
+			if !ok || strings.ContainsAny(name, "[]") {
+				return errorf("invalid table header %s", text)
+			}
+			section = strings.Trim(strings.TrimSpace(name), `"`)
+			// [network.lab] names a network's section, not a table nested in network
+			if network, ok := strings.CutPrefix(section, NetworkSection); strings.Contains(network, ".") || ok && network == "" {
+				return errorf("nested table %s is not supported", section)
+			}
+			if f.Sections[section] == nil {
+				f.Sections[section] = map[string]string{}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return errorf("expected key = value")
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		value = strings.TrimSpace(value)
+		// An array continues until its brackets close
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && n+1 < len(lines) {
+			n++
+			value += " " + strings.TrimSpace(stripComment(lines[n]))
+		}
+		v, err := tomlValue(value)
+		if err != nil {
+			return errorf("%s: %v", key, err)
+		}
+		f.set(section, key, v)
+	}
+	return nil
+}
+
+// tomlValue reads a string, number, boolean, or array of them
+func tomlValue(s string) (string, error) {
+	inner, ok := strings.CutPrefix(s, "[")
+	if !ok {
+		return tomlScalar(s)
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return "", fmt.Errorf("unterminated array %s", s)
+	}
+	items, err := splitList(inner)
+	if err != nil {
+		return "", err
+	}
+	for i, item := range items {
+		if items[i], err = tomlScalar(item); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(items, ","), nil
+}
+
+func tomlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		inner, ok := strings.CutSuffix(s[1:], "'")
+		if !ok {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return inner, nil
+	case s == "true" || s == "false":
+		return s, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(s, "_", ""), 64); err != nil {
+		return "", fmt.Errorf("expected a quoted string, number, or boolean, got %s", s)
+	}
+	return strings.ReplaceAll(s, "_", ""), nil
+}
+
+// splitList splits the items of a flow list or array at commas outside
+// quotes, dropping a trailing comma
+func splitList(s string) ([]string, error) {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in [%s]", s)
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	for _, item := range items {
+		if item == "" {
+			return nil, fmt.Errorf("empty item in [%s]", s)
+		}
+	}
+	return items, nil
+}
+
+// stripComment drops a # comment from line, unless the # is quoted or part
+// of a word
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadFormatsAgree(t *testing.T) {
+	files := map[string]string{
+		"miners.json": `{
+			"difficulty": 5,
+			"chain-params": "params.json",
+			"node": {"id": "m1", "peers": ["10.0.0.6:8001", "10.0.0.7:8001"], "mine": false, "mempool_ttl": "10m"},
+			"wallet": {},
+			"network": "lab",
+			"network.lab": {"peers": ["10.0.0.8:8001"]}
+		}`,
+		"miners.yaml": `
+# Shared by every command
+difficulty: 5
+chain-params: "params.json"   # Quoted or not
+node:
+  id: m1
+  peers:
+    - 10.0.0.6:8001
+    - '10.0.0.7:8001'
+  mine: false
+  mempool_ttl: 10m
+wallet:
+network: lab
+network.lab:
+  peers: [10.0.0.8:8001]
+`,
+		"miners.toml": `
+difficulty = 5
+chain-params = 'params.json'
+network = "lab"
+
+[node]
+id = "m1"
+peers = [
+  "10.0.0.6:8001", # First
+  "10.0.0.7:8001",
+]
+mine = false
+mempool_ttl = "10m"
+
+[wallet]
+
+[network.lab]
+peers = ["10.0.0.8:8001"]
+`,
+	}
+	want := &File{
+		Values: map[string]string{"difficulty": "5", "chain-params": "params.json", "network": "lab"},
+		Sections: map[string]map[string]string{
+			"node":        {"id": "m1", "peers": "10.0.0.6:8001,10.0.0.7:8001", "mine": "false", "mempool-ttl": "10m"},
+			"wallet":      {},
+			"network.lab": {"peers": "10.0.0.8:8001"},
+		},
+	}
+	for name, data := range files {
+		f, err := Load(writeFile(t, name, data))
+		if err != nil {
+			t.Errorf("%s: Load failed: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(f.Values, want.Values) || !reflect.DeepEqual(f.Sections, want.Sections) {
+			t.Errorf("%s: got values %v and sections %v", name, f.Values, f.Sections)
+		}
+		if lab, ok := f.Network("lab"); !ok || lab["peers"] != "10.0.0.8:8001" || !reflect.DeepEqual(f.Networks(), []string{"lab"}) {
+			t.Errorf("%s: expected network lab, got %v of %v", name, lab, f.Networks())
+		}
+	}
+}
+
+func TestLoadRejectsUnsupportedSyntax(t *testing.T) {
+	files := map[string]string{
+		"nested.yaml":   "node:\n  tls:\n    cert: a.pem\n",
+		"indent.yaml":   "difficulty: 5\n  id: m1\n",
+		"item.yaml":     "- a\n",
+		"map.yaml":      "peers: {a: 1}\n",
+		"bare.toml":     "id = m1\n",
+		"nested.toml":   "[node.tls]\ncert = \"a.pem\"\n",
+		"network.toml":  "[network.lab.tls]\ncert = \"a.pem\"\n",
+		"unclosed.toml": "peers = [\"a\",\n",
+		"list.json":     `[1, 2]`,
+	}
+	for name, data := range files {
+		if _, err := Load(writeFile(t, name, data)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package explorer serves a minimal block explorer as server-rendered HTML
+package explorer
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/transaction"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recentBlocks is how many blocks the home page lists
+const recentBlocks = 20
+
+// defaultGraphDepth is how many hops a transaction's flow graph walks each way
+// unless ?depth= says otherwise
+const defaultGraphDepth = 3
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// Source supplies the chain state the explorer renders
+type Source struct {
+	Chain   func() *blockchain.Blockchain     // Current chain (may be swapped on reorg or reload)
+	Pending func() []*transaction.Transaction // Mempool, for unconfirmed transactions (optional)
+}
+
+// Explorer renders blocks, transactions, and addresses
+type Explorer struct {
+	src   Source
+	pages map[string]*template.Template
+}
+
+var funcs = template.FuncMap{
+	"btc": func(satoshi int64) string {
+		return fmt.Sprintf("%.8f", float64(satoshi)/transaction.SatoshiPerBTC)
+	},
+	"short": func(s string) string {
+		if len(s) <= 16 {
+			return s
+		}
+		return s[:16] + "…"
+	},
+	"time": func(nanos int64) string {
+		return time.Unix(0, nanos).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"add": func(a, b int64) int64 { return a + b },
+}
+
+// NewHandler returns an http.Handler serving the explorer pages
+func NewHandler(src Source) http.Handler {
+	e := &Explorer{src: src, pages: make(map[string]*template.Template)}
+	for _, page := range []string{"index", "block", "tx", "address", "notfound"} {
+		e.pages[page] = template.Must(template.New("layout.html").Funcs(funcs).
+			ParseFS(templateFS, "templates/layout.html", "templates/"+page+".html"))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", e.handleIndex)
+	mux.HandleFunc("GET /block/{id}", e.handleBlock)
+	mux.HandleFunc("GET /tx/{id}", e.handleTx)
+	mux.HandleFunc("GET /tx/{id}/graph", e.handleTxGraph)
+	mux.HandleFunc("GET /address/{addr}", e.handleAddress)
+	mux.HandleFunc("GET /search", e.handleSearch)
+	return mux
+}
+
+// render executes a page template, logging (not exposing) template errors
+func (e *Explorer) render(w http.ResponseWriter, status int, page string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := e.pages[page].Execute(w, data); err != nil {
+		logging.Errorf("explorer: failed to render %s: %v", page, err)
+	}
+}
+
+func (e *Explorer) notFound(w http.ResponseWriter, what string) {
+	e.render(w, http.StatusNotFound, "notfound", what)
+}
+
+func (e *Explorer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	bc := e.src.Chain()
+	length := bc.GetLength()
+	var blocks []*block.Block
+	for h := int64(length - 1); h >= 0 && len(blocks) < recentBlocks; h-- {
+		blocks = append(blocks, bc.GetBlockByHeight(h))
+	}
+
+	pending := 0
+	if e.src.Pending != nil {
+		pending = len(e.src.Pending())
+	}
+	e.render(w, http.StatusOK, "index", map[string]any{
+		"Height":     length - 1,
+		"Difficulty": bc.GetDifficulty(),
+		"Pending":    pending,
+		"Blocks":     blocks,
+	})
+}
+
+func (e *Explorer) handleBlock(w http.ResponseWriter, r *http.Request) {
+	bc := e.src.Chain()
+	id := r.PathValue("id")
+	b := bc.GetBlockByHash(id)
+	if b == nil {
+		if height, err := strconv.ParseInt(id, 10, 64); err == nil {
+			b = bc.GetBlockByHeight(height)
+		}
+	}
+	if b == nil {
+		e.notFound(w, "block "+id)
+		return
+	}
+	e.render(w, http.StatusOK, "block", map[string]any{
+		"Block":   b,
+		"HasNext": b.Index+1 < int64(bc.GetLength()),
+	})
+}
+
+// inputView is a transaction input resolved to the output it spends
+type inputView struct {
+	transaction.TxInput
+	Address string
+	Value   int64
+	Known   bool
+}
+
+// outputView is a transaction output with its spent status
+type outputView struct {
+	transaction.TxOutput
+	Index   int
+	Unspent bool
+	SpentBy string // Spending transaction, if confirmed
+}
+
+func (e *Explorer) handleTx(w http.ResponseWriter, r *http.Request) {
+	bc := e.src.Chain()
+	id := r.PathValue("id")
+	tx, loc := bc.GetTransaction(id)
+	if tx == nil && e.src.Pending != nil {
+		for _, pending := range e.src.Pending() {
+			if pending.ID == id {
+				tx = pending
+				break
+			}
+		}
+	}
+	if tx == nil {
+		e.notFound(w, "transaction "+id)
+		return
+	}
+
+	var inputs []inputView
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			view := inputView{TxInput: in}
+			if out := bc.GetOutput(in.TxID, in.OutIndex); out != nil {
+				view.Address, view.Value, view.Known = out.ScriptPubKey, out.Value, true
+			}
+			inputs = append(inputs, view)
+		}
+	}
+
+	var outputs []outputView
+	for i, out := range tx.Outputs {
+		view := outputView{
+			TxOutput: out,
+			Index:    i,
+			Unspent:  loc != nil && bc.FindUTXO(tx.ID, i) != nil,
+		}
+		if spend := bc.GetSpendingTx(tx.ID, i); spend != nil {
+			view.SpentBy = spend.TxID
+		}
+		outputs = append(outputs, view)
+	}
+
+	e.render(w, http.StatusOK, "tx", map[string]any{
+		"Tx":       tx,
+		"Location": loc,
+		"Coinbase": tx.IsCoinbase(),
+		"Inputs":   inputs,
+		"Outputs":  outputs,
+		"Total":    tx.TotalOutputValue(),
+		"Fee":      txFee(bc, tx),
+	})
+}
+
+// handleTxGraph serves a confirmed transaction's ancestors and descendants as
+// JSON, for drawing fund flow diagrams
+func (e *Explorer) handleTxGraph(w http.ResponseWriter, r *http.Request) {
+	depth := defaultGraphDepth
+	if d := r.URL.Query().Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil {
+			http.Error(w, "invalid depth", http.StatusBadRequest)
+			return
+		}
+	}
+	g, err := e.src.Chain().TraceTransaction(r.PathValue("id"), depth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(g); err != nil {
+		logging.Errorf("explorer: failed to encode graph: %v", err)
+	}
+}
+
+// handleSearch redirects the search box query to the page of the matching entity
+func (e *Explorer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	result := e.src.Chain().Search(q)
+
+	var target string
+	switch result.Kind {
+	case blockchain.SearchBlock:
+		target = "/block/" + result.Block.Hash
+	case blockchain.SearchTransaction:
+		target = "/tx/" + result.Tx.ID
+	case blockchain.SearchAddress:
+		target = "/address/" + url.PathEscape(result.Address)
+	default:
+		if e.src.Pending != nil {
+			for _, tx := range e.src.Pending() {
+				if tx.ID == q {
+					target = "/tx/" + tx.ID
+				}
+			}
+		}
+	}
+	if target == "" {
+		e.notFound(w, fmt.Sprintf("block, transaction, or address matching %q", q))
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func (e *Explorer) handleAddress(w http.ResponseWriter, r *http.Request) {
+	bc := e.src.Chain()
+	addr := r.PathValue("addr")
+	txIDs := bc.GetAddressTransactions(addr)
+	utxoSet := bc.GetUTXOSet()
+	utxos := utxoSet.FindUTXOsForAddress(addr)
+	if len(txIDs) == 0 && len(utxos) == 0 {
+		e.notFound(w, "address "+addr)
+		return
+	}
+
+	// Newest first
+	for i, j := 0, len(txIDs)-1; i < j; i, j = i+1, j-1 {
+		txIDs[i], txIDs[j] = txIDs[j], txIDs[i]
+	}
+	e.render(w, http.StatusOK, "address", map[string]any{
+		"Address": addr,
+		"Balance": utxoSet.GetBalance(addr),
+		"UTXOs":   utxos,
+		"TxIDs":   txIDs,
+	})
+}
+
+// txFee returns inputs minus outputs for a transaction whose inputs are all
+// confirmed outputs, and 0 for coinbases or unresolvable inputs
+func txFee(bc *blockchain.Blockchain, tx *transaction.Transaction) int64 {
+	if tx.IsCoinbase() {
+		return 0
+	}
+	var inputTotal int64
+	for _, in := range tx.Inputs {
+		out := bc.GetOutput(in.TxID, in.OutIndex)
+		if out == nil {
+			return 0
+		}
+		inputTotal += out.Value
+	}
+	if inputTotal < tx.TotalOutputValue() {
+		return 0
+	}
+	return inputTotal - tx.TotalOutputValue()
+}
@@ -0,0 +1,103 @@
+package explorer
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/testchain"
+	"blockchain/pkg/transaction"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, srv *httptest.Server, path string) (int, string) {
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestExplorerPages(t *testing.T) {
+	chain := testchain.New(t, 2).Fund("alice", 1)
+	bc, kp := chain.Chain(), chain.Wallet("alice")
+	alice := kp.GetPublicKeyHex()
+
+	coinbase := bc.GetBlockByHeight(1).Transactions[0]
+	spend, err := bc.GetUTXOSet().CreateTransactionWithMemo(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: coinbase.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: "bob"}},
+		"<invoice 7>",
+		map[string]string{alice: kp.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+
+	srv := httptest.NewServer(NewHandler(Source{
+		Chain:   func() *blockchain.Blockchain { return bc },
+		Pending: func() []*transaction.Transaction { return []*transaction.Transaction{spend} },
+	}))
+	defer srv.Close()
+
+	if status, body := get(t, srv, "/"); status != http.StatusOK || !strings.Contains(body, "<b>1</b> pending") {
+		t.Errorf("Home page should list the chain and pending count, got %d", status)
+	}
+	if status, body := get(t, srv, "/block/1"); status != http.StatusOK || !strings.Contains(body, coinbase.ID) {
+		t.Errorf("Block page by height failed with %d", status)
+	}
+	if status, _ := get(t, srv, "/block/"+bc.GetBlockByHeight(1).Hash); status != http.StatusOK {
+		t.Errorf("Block page by hash failed with %d", status)
+	}
+	if status, body := get(t, srv, "/tx/"+spend.ID); status != http.StatusOK || !strings.Contains(body, "Pending") {
+		t.Errorf("Mempool transaction should render as pending, got %d", status)
+	} else if !strings.Contains(body, "<td>&lt;invoice 7&gt;</td>") {
+		t.Error("The memo should be shown, escaped")
+	}
+
+	// Confirm the spend; its input now resolves to alice and the coinbase output is spent
+	chain.Include(spend).MineTo("miner1", 1)
+	status, body := get(t, srv, "/tx/"+spend.ID)
+	if status != http.StatusOK || !strings.Contains(body, "block #2") || !strings.Contains(body, "/address/"+alice) {
+		t.Errorf("Confirmed transaction should show its block and input owner, got %d", status)
+	}
+	if _, body := get(t, srv, "/tx/"+coinbase.ID); !strings.Contains(body, `spent by <a href="/tx/`+spend.ID+`"`) {
+		t.Error("Coinbase output should be shown as spent by the spend")
+	}
+	if status, body := get(t, srv, "/address/bob"); status != http.StatusOK || !strings.Contains(body, spend.ID) {
+		t.Errorf("Address page should list bob's transaction, got %d", status)
+	}
+	if status, body := get(t, srv, "/tx/"+spend.ID+"/graph?depth=1"); status != http.StatusOK ||
+		!strings.Contains(body, `"from":"`+coinbase.ID+`"`) {
+		t.Errorf("Flow graph should link the coinbase to the spend, got %d: %s", status, body)
+	}
+
+	// The search box redirects to the matching page
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for query, want := range map[string]string{
+		"2":      "/block/" + bc.GetBlockByHeight(2).Hash,
+		spend.ID: "/tx/" + spend.ID,
+		"bob":    "/address/bob",
+	} {
+		resp, err := noRedirect.Get(srv.URL + "/search?q=" + query)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != want {
+			t.Errorf("Search %q: got %d to %q, want %q", query, resp.StatusCode, resp.Header.Get("Location"), want)
+		}
+	}
+
+	for _, path := range []string{"/block/99", "/tx/missing", "/tx/missing/graph", "/address/nobody", "/search?q=nothing"} {
+		if status, _ := get(t, srv, path); status != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, status)
+		}
+	}
+}
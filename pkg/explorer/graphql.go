@@ -0,0 +1,356 @@
+package explorer
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/graphql"
+	"blockchain/pkg/transaction"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxBlocksPerQuery caps the blocks(limit:) argument
+const maxBlocksPerQuery = 100
+
+// query is the per-request state shared by resolvers
+type query struct {
+	bc      *blockchain.Blockchain
+	pending []*transaction.Transaction
+}
+
+// txRef is a transaction with its confirmation location (nil if pending)
+type txRef struct {
+	q   *query
+	tx  *transaction.Transaction
+	loc *blockchain.TxLocation
+}
+
+type blockRef struct {
+	q *query
+	b *block.Block
+}
+
+type inputRef struct {
+	tx    txRef
+	index int
+}
+
+type outputRef struct {
+	tx    txRef
+	index int
+}
+
+type addressRef struct {
+	q       *query
+	address string
+}
+
+func (q *query) block(b *block.Block) any {
+	if b == nil {
+		return nil
+	}
+	return blockRef{q: q, b: b}
+}
+
+// transaction finds a confirmed or pending transaction
+func (q *query) transaction(id string) any {
+	if tx, loc := q.bc.GetTransaction(id); tx != nil {
+		return txRef{q: q, tx: tx, loc: loc}
+	}
+	for _, tx := range q.pending {
+		if tx.ID == id {
+			return txRef{q: q, tx: tx}
+		}
+	}
+	return nil
+}
+
+// spentBy returns the confirmed input spending an output
+func (q *query) spentBy(txID string, index int) (inputRef, bool) {
+	spend := q.bc.GetSpendingTx(txID, index)
+	if spend == nil {
+		return inputRef{}, false
+	}
+	tx, loc := q.bc.GetTransaction(spend.TxID)
+	if tx == nil {
+		return inputRef{}, false
+	}
+	return inputRef{tx: txRef{q: q, tx: tx, loc: loc}, index: spend.Input}, true
+}
+
+// chainSchema exposes blocks, transactions, and addresses. Lists of nested
+// objects are resolved lazily, so a query pays only for the fields it selects.
+var chainSchema = &graphql.Schema{
+	Query: "Query",
+	Types: map[string]graphql.Object{
+		"Query": {
+			"height": {Resolve: func(src any, _ graphql.Args) (any, error) {
+				return src.(*query).bc.GetLength() - 1, nil
+			}},
+			"difficulty": {Resolve: func(src any, _ graphql.Args) (any, error) {
+				return src.(*query).bc.GetDifficulty(), nil
+			}},
+			"block": {Type: "Block", Resolve: func(src any, args graphql.Args) (any, error) {
+				q := src.(*query)
+				hash, byHash, err := args.String("hash")
+				if err != nil {
+					return nil, err
+				}
+				if byHash {
+					return q.block(q.bc.GetBlockByHash(hash)), nil
+				}
+				height, byHeight, err := args.Int("height")
+				if err != nil {
+					return nil, err
+				}
+				if !byHeight {
+					height = int64(q.bc.GetLength() - 1)
+				}
+				return q.block(q.bc.GetBlockByHeight(height)), nil
+			}},
+			"blocks": {Type: "Block", Resolve: func(src any, args graphql.Args) (any, error) {
+				q := src.(*query)
+				from, ok, err := args.Int("from")
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					from = int64(q.bc.GetLength() - 1)
+				}
+				limit, ok, err := args.Int("limit")
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					limit = 10
+				}
+				if limit < 0 || limit > maxBlocksPerQuery {
+					return nil, fmt.Errorf("limit must be between 0 and %d", maxBlocksPerQuery)
+				}
+				blocks := []blockRef{}
+				for h := from; h >= 0 && int64(len(blocks)) < limit; h-- {
+					if b := q.bc.GetBlockByHeight(h); b != nil {
+						blocks = append(blocks, blockRef{q: q, b: b})
+					}
+				}
+				return blocks, nil
+			}},
+			"transaction": {Type: "Transaction", Resolve: func(src any, args graphql.Args) (any, error) {
+				id, ok, err := args.String("id")
+				if err != nil || !ok {
+					return nil, fmt.Errorf("argument \"id\" is required")
+				}
+				return src.(*query).transaction(id), nil
+			}},
+			"address": {Type: "Address", Resolve: func(src any, args graphql.Args) (any, error) {
+				addr, ok, err := args.String("address")
+				if err != nil || !ok {
+					return nil, fmt.Errorf("argument \"address\" is required")
+				}
+				return addressRef{q: src.(*query), address: addr}, nil
+			}},
+			"pending": {Type: "Transaction", Resolve: func(src any, _ graphql.Args) (any, error) {
+				q := src.(*query)
+				txs := []txRef{}
+				for _, tx := range q.pending {
+					txs = append(txs, txRef{q: q, tx: tx})
+				}
+				return txs, nil
+			}},
+		},
+
+		"Block": {
+			"height":     {Resolve: blockField(func(b *block.Block) any { return b.Index })},
+			"hash":       {Resolve: blockField(func(b *block.Block) any { return b.Hash })},
+			"prevHash":   {Resolve: blockField(func(b *block.Block) any { return b.PrevHash })},
+			"merkleRoot": {Resolve: blockField(func(b *block.Block) any { return b.MerkleRoot })},
+			"timestamp":  {Resolve: blockField(func(b *block.Block) any { return b.Timestamp })},
+			"difficulty": {Resolve: blockField(func(b *block.Block) any { return b.Difficulty })},
+			"nonce":      {Resolve: blockField(func(b *block.Block) any { return b.Nonce })},
+			"miner":      {Resolve: blockField(func(b *block.Block) any { return b.MinerID })},
+			"txCount":    {Resolve: blockField(func(b *block.Block) any { return len(b.Transactions) })},
+			"transactions": {Type: "Transaction", Resolve: func(src any, _ graphql.Args) (any, error) {
+				ref := src.(blockRef)
+				txs := make([]txRef, len(ref.b.Transactions))
+				for pos, tx := range ref.b.Transactions {
+					loc := &blockchain.TxLocation{BlockHeight: ref.b.Index, BlockHash: ref.b.Hash, Position: pos}
+					txs[pos] = txRef{q: ref.q, tx: tx, loc: loc}
+				}
+				return txs, nil
+			}},
+			"previous": {Type: "Block", Resolve: func(src any, _ graphql.Args) (any, error) {
+				ref := src.(blockRef)
+				return ref.q.block(ref.q.bc.GetBlockByHash(ref.b.PrevHash)), nil
+			}},
+			"next": {Type: "Block", Resolve: func(src any, _ graphql.Args) (any, error) {
+				ref := src.(blockRef)
+				return ref.q.block(ref.q.bc.GetBlockByHeight(ref.b.Index + 1)), nil
+			}},
+		},
+
+		"Transaction": {
+			"id":          {Resolve: txField(func(ref txRef) any { return ref.tx.ID })},
+			"coinbase":    {Resolve: txField(func(ref txRef) any { return ref.tx.IsCoinbase() })},
+			"confirmed":   {Resolve: txField(func(ref txRef) any { return ref.loc != nil })},
+			"totalOutput": {Resolve: txField(func(ref txRef) any { return ref.tx.TotalOutputValue() })},
+			"fee":         {Resolve: txField(func(ref txRef) any { return txFee(ref.q.bc, ref.tx) })},
+			"memo": {Resolve: txField(func(ref txRef) any {
+				if ref.tx.Memo == "" {
+					return nil
+				}
+				return ref.tx.Memo
+			})},
+			"position": {Resolve: txField(func(ref txRef) any {
+				if ref.loc == nil {
+					return nil
+				}
+				return ref.loc.Position
+			})},
+			"block": {Type: "Block", Resolve: txField(func(ref txRef) any {
+				if ref.loc == nil {
+					return nil
+				}
+				return ref.q.block(ref.q.bc.GetBlockByHeight(ref.loc.BlockHeight))
+			})},
+			"inputs": {Type: "Input", Resolve: txField(func(ref txRef) any {
+				inputs := []inputRef{}
+				if !ref.tx.IsCoinbase() {
+					for i := range ref.tx.Inputs {
+						inputs = append(inputs, inputRef{tx: ref, index: i})
+					}
+				}
+				return inputs
+			})},
+			"outputs": {Type: "Output", Resolve: txField(func(ref txRef) any {
+				outputs := make([]outputRef, len(ref.tx.Outputs))
+				for i := range ref.tx.Outputs {
+					outputs[i] = outputRef{tx: ref, index: i}
+				}
+				return outputs
+			})},
+		},
+
+		"Input": {
+			"index":       {Resolve: inputField(func(ref inputRef, _ transaction.TxInput) any { return ref.index })},
+			"txId":        {Resolve: inputField(func(_ inputRef, in transaction.TxInput) any { return in.TxID })},
+			"outIndex":    {Resolve: inputField(func(_ inputRef, in transaction.TxInput) any { return in.OutIndex })},
+			"signature":   {Resolve: inputField(func(_ inputRef, in transaction.TxInput) any { return in.ScriptSig })},
+			"transaction": {Type: "Transaction", Resolve: inputField(func(ref inputRef, _ transaction.TxInput) any { return ref.tx })},
+			"spends": {Type: "Output", Resolve: inputField(func(ref inputRef, in transaction.TxInput) any {
+				prev, ok := ref.tx.q.transaction(in.TxID).(txRef)
+				if !ok || in.OutIndex < 0 || in.OutIndex >= len(prev.tx.Outputs) {
+					return nil
+				}
+				return outputRef{tx: prev, index: in.OutIndex}
+			})},
+		},
+
+		"Output": {
+			"index":       {Resolve: outputField(func(ref outputRef, _ transaction.TxOutput) any { return ref.index })},
+			"value":       {Resolve: outputField(func(_ outputRef, out transaction.TxOutput) any { return out.Value })},
+			"address":     {Resolve: outputField(func(_ outputRef, out transaction.TxOutput) any { return out.ScriptPubKey })},
+			"transaction": {Type: "Transaction", Resolve: outputField(func(ref outputRef, _ transaction.TxOutput) any { return ref.tx })},
+			"spent": {Resolve: outputField(func(ref outputRef, _ transaction.TxOutput) any {
+				return ref.tx.q.bc.GetSpendingTx(ref.tx.tx.ID, ref.index) != nil
+			})},
+			"spentBy": {Type: "Input", Resolve: outputField(func(ref outputRef, _ transaction.TxOutput) any {
+				if in, ok := ref.tx.q.spentBy(ref.tx.tx.ID, ref.index); ok {
+					return in
+				}
+				return nil
+			})},
+		},
+
+		"Address": {
+			"address": {Resolve: addressField(func(ref addressRef) any { return ref.address })},
+			"balance": {Resolve: addressField(func(ref addressRef) any { return ref.q.bc.GetBalance(ref.address) })},
+			"utxos": {Type: "Output", Resolve: addressField(func(ref addressRef) any {
+				outputs := []outputRef{}
+				for _, utxo := range ref.q.bc.GetUTXOSet().FindUTXOsForAddress(ref.address) {
+					if tx, ok := ref.q.transaction(utxo.TxID).(txRef); ok {
+						outputs = append(outputs, outputRef{tx: tx, index: utxo.OutIndex})
+					}
+				}
+				return outputs
+			})},
+			"transactions": {Type: "Transaction", Resolve: addressField(func(ref addressRef) any {
+				txs := []txRef{}
+				for _, id := range ref.q.bc.GetAddressTransactions(ref.address) {
+					if tx, ok := ref.q.transaction(id).(txRef); ok {
+						txs = append(txs, tx)
+					}
+				}
+				return txs
+			})},
+		},
+	},
+}
+
+func blockField(fn func(b *block.Block) any) graphql.Resolver {
+	return func(src any, _ graphql.Args) (any, error) { return fn(src.(blockRef).b), nil }
+}
+
+func txField(fn func(ref txRef) any) graphql.Resolver {
+	return func(src any, _ graphql.Args) (any, error) { return fn(src.(txRef)), nil }
+}
+
+func inputField(fn func(ref inputRef, in transaction.TxInput) any) graphql.Resolver {
+	return func(src any, _ graphql.Args) (any, error) {
+		ref := src.(inputRef)
+		return fn(ref, ref.tx.tx.Inputs[ref.index]), nil
+	}
+}
+
+func outputField(fn func(ref outputRef, out transaction.TxOutput) any) graphql.Resolver {
+	return func(src any, _ graphql.Args) (any, error) {
+		ref := src.(outputRef)
+		return fn(ref, ref.tx.tx.Outputs[ref.index]), nil
+	}
+}
+
+func addressField(fn func(ref addressRef) any) graphql.Resolver {
+	return func(src any, _ graphql.Args) (any, error) { return fn(src.(addressRef)), nil }
+}
+
+// graphQLRequest is the standard GraphQL-over-HTTP request body
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// NewGraphQLHandler returns an http.Handler that executes GraphQL queries
+// (POST JSON {"query", "variables"}, or GET ?query=&variables=)
+func NewGraphQLHandler(src Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			if vars := r.URL.Query().Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+					http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+				http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := &query{bc: src.Chain()}
+		if src.Pending != nil {
+			q.pending = src.Pending()
+		}
+		resp := chainSchema.Execute(req.Query, req.Variables, q)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,131 @@
+package explorer
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/testchain"
+	"blockchain/pkg/transaction"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGraphQLNestedChainQuery(t *testing.T) {
+	chain := testchain.New(t, 2).Fund("alice", 1)
+	bc, kp := chain.Chain(), chain.Wallet("alice")
+	alice := kp.GetPublicKeyHex()
+
+	coinbase := bc.GetBlockByHeight(1).Transactions[0]
+	spend, err := bc.GetUTXOSet().CreateTransactionWithMemo(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: coinbase.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: coinbase.Outputs[0].Value - 500, ScriptPubKey: "bob"}},
+		"ref 42",
+		map[string]string{alice: kp.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	chain.Include(spend).MineTo("miner1", 1)
+
+	srv := httptest.NewServer(NewGraphQLHandler(Source{
+		Chain: func() *blockchain.Blockchain { return bc },
+	}))
+	defer srv.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"query": `query($h: Int) {
+			height
+			block(height: $h) {
+				hash
+				transactions { id memo outputs { value spent spentBy { transaction { id fee memo block { height } } } } }
+			}
+			address(address: "bob") { balance transactions { id } }
+		}`,
+		"variables": map[string]any{"h": 1},
+	})
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Height int64
+			Block  struct {
+				Hash         string
+				Transactions []struct {
+					ID      string
+					Memo    *string
+					Outputs []struct {
+						Value   int64
+						Spent   bool
+						SpentBy *struct {
+							Transaction struct {
+								ID    string
+								Fee   int64
+								Memo  string
+								Block struct{ Height int64 }
+							}
+						}
+					}
+				}
+			}
+			Address struct {
+				Balance      int64
+				Transactions []struct{ ID string }
+			}
+		}
+		Errors []graphqlError
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	data := result.Data
+	if data.Height != 2 || data.Block.Hash != bc.GetBlockByHeight(1).Hash {
+		t.Errorf("Unexpected chain data: %+v", data)
+	}
+	out := data.Block.Transactions[0].Outputs[0]
+	if !out.Spent || out.SpentBy == nil {
+		t.Fatal("Coinbase output should be reported as spent")
+	}
+	if memo := data.Block.Transactions[0].Memo; memo != nil {
+		t.Errorf("A transaction without a memo should report null, got %q", *memo)
+	}
+	if by := out.SpentBy.Transaction; by.ID != spend.ID || by.Fee != 500 || by.Memo != "ref 42" || by.Block.Height != 2 {
+		t.Errorf("Unexpected spending transaction: %+v", by)
+	}
+	if data.Address.Balance != spend.Outputs[0].Value || len(data.Address.Transactions) != 1 {
+		t.Errorf("Unexpected address data: %+v", data.Address)
+	}
+}
+
+type graphqlError struct {
+	Message string
+}
+
+func TestGraphQLRejectsBadRequests(t *testing.T) {
+	handler := NewGraphQLHandler(Source{Chain: func() *blockchain.Blockchain { return blockchain.NewBlockchain(2) }})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader([]byte("not json"))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Malformed body should be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?query=%7Bblocks(limit:1000)%7Bhash%7D%7D", nil))
+	var resp struct{ Errors []graphqlError }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || len(resp.Errors) != 1 {
+		t.Errorf("Oversized limit should be a field error, got %d %v", rec.Code, resp.Errors)
+	}
+}
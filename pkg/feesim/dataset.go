@@ -0,0 +1,200 @@
+package feesim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// TxRecord is one transaction an agent wanted to send and what became of it
+type TxRecord struct {
+	Agent          string        `json:"agent"`
+	Group          string        `json:"group"`
+	Strategy       string        `json:"strategy"`
+	Round          int           `json:"round"`
+	TxID           string        `json:"txid,omitempty"`
+	Fee            int64         `json:"fee"`
+	Size           int64         `json:"size"`     // mempool.Size, the unit of fee rates
+	FeeRate        float64       `json:"fee_rate"` // Satoshi per byte
+	SubmitHeight   int64         `json:"submit_height"`
+	Submitted      time.Time     `json:"submitted"`
+	Status         string        `json:"status"`
+	IncludedHeight int64         `json:"included_height,omitempty"`
+	WaitBlocks     int64         `json:"wait_blocks,omitempty"`
+	WaitTime       time.Duration `json:"wait_ns,omitempty"` // From submission to the including block's timestamp
+	Error          string        `json:"error,omitempty"`
+}
+
+// BlockRecord describes one block mined during the simulation
+type BlockRecord struct {
+	Height      int64     `json:"height"`
+	Round       int       `json:"round"`
+	Timestamp   time.Time `json:"timestamp"`
+	MinerID     string    `json:"miner_id"`
+	Txs         int       `json:"txs"`     // Transactions besides the coinbase
+	SimTxs      int       `json:"sim_txs"` // Of which the simulation's
+	MinFee      int64     `json:"min_fee"` // Fees of the simulation's transactions in the block
+	MedianFee   int64     `json:"median_fee"`
+	MaxFee      int64     `json:"max_fee"`
+	Backlog     int       `json:"backlog"`      // Simulated transactions still waiting after the block
+	MempoolSize int       `json:"mempool_size"` // Pending transactions on the miner, all senders
+}
+
+// GroupSummary aggregates the outcomes of one agent group
+type GroupSummary struct {
+	Group         string  `json:"group"`
+	Strategy      string  `json:"strategy"`
+	Demand        string  `json:"demand"`
+	Wanted        int     `json:"wanted"` // Transactions the demand curve asked for
+	Submitted     int     `json:"submitted"`
+	Included      int     `json:"included"`
+	Pending       int     `json:"pending"`
+	Rejected      int     `json:"rejected"`
+	Unfunded      int     `json:"unfunded"`
+	InclusionRate float64 `json:"inclusion_rate"` // Included over submitted
+	MeanFee       float64 `json:"mean_fee"`       // Over submitted transactions
+	MeanWait      float64 `json:"mean_wait_blocks"`
+	MaxWait       int64   `json:"max_wait_blocks"`
+	FeesPaid      int64   `json:"fees_paid"` // By included transactions
+}
+
+// Result is the outcome of a simulation
+type Result struct {
+	Config       Config         `json:"config"`
+	StartHeight  int64          `json:"start_height"`
+	EndHeight    int64          `json:"end_height"`
+	Started      time.Time      `json:"started"`
+	Finished     time.Time      `json:"finished"`
+	Groups       []GroupSummary `json:"groups"`
+	Transactions []TxRecord     `json:"-"`
+	Blocks       []BlockRecord  `json:"-"`
+}
+
+// summarize fills in the group summaries
+func (r *Result) summarize() {
+	index := make(map[string]int)
+	r.Groups = nil
+	for _, g := range r.Config.Agents {
+		index[g.Name] = len(r.Groups)
+		r.Groups = append(r.Groups, GroupSummary{Group: g.Name, Strategy: g.Bidding.Strategy, Demand: g.Demand.Kind})
+	}
+	var waits = make([]int64, len(r.Groups))
+	var fees = make([]int64, len(r.Groups))
+	for _, t := range r.Transactions {
+		i, ok := index[t.Group]
+		if !ok {
+			continue
+		}
+		g := &r.Groups[i]
+		g.Wanted++
+		switch t.Status {
+		case StatusIncluded:
+			g.Included++
+			g.FeesPaid += t.Fee
+			waits[i] += t.WaitBlocks
+			g.MaxWait = max(g.MaxWait, t.WaitBlocks)
+		case StatusPending:
+			g.Pending++
+		case StatusRejected:
+			g.Rejected++
+		case StatusUnfunded:
+			g.Unfunded++
+			continue
+		}
+		if t.Status != StatusRejected {
+			g.Submitted++
+			fees[i] += t.Fee
+		}
+	}
+	for i := range r.Groups {
+		g := &r.Groups[i]
+		if g.Submitted > 0 {
+			g.InclusionRate = float64(g.Included) / float64(g.Submitted)
+			g.MeanFee = float64(fees[i]) / float64(g.Submitted)
+		}
+		if g.Included > 0 {
+			g.MeanWait = float64(waits[i]) / float64(g.Included)
+		}
+	}
+}
+
+// WriteDataset writes the result to dir as transactions.csv, one row per
+// transaction an agent wanted to send, blocks.csv, one row per block mined
+// during the run, and summary.json, the config and per-group summaries
+func (r *Result) WriteDataset(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	txRows := [][]string{{"agent", "group", "strategy", "round", "txid", "fee", "size", "fee_rate",
+		"submit_height", "submitted", "status", "included_height", "wait_blocks", "wait_ms", "error"}}
+	for _, t := range r.Transactions {
+		included, wait := "", ""
+		if t.Status == StatusIncluded {
+			included = strconv.FormatInt(t.IncludedHeight, 10)
+			wait = strconv.FormatInt(t.WaitBlocks, 10)
+		}
+		txRows = append(txRows, []string{t.Agent, t.Group, t.Strategy, strconv.Itoa(t.Round), t.TxID,
+			strconv.FormatInt(t.Fee, 10), strconv.FormatInt(t.Size, 10), strconv.FormatFloat(t.FeeRate, 'f', 4, 64),
+			strconv.FormatInt(t.SubmitHeight, 10), t.Submitted.Format(time.RFC3339Nano), t.Status, included, wait,
+			strconv.FormatInt(t.WaitTime.Milliseconds(), 10), t.Error})
+	}
+	if err := writeCSV(filepath.Join(dir, "transactions.csv"), txRows); err != nil {
+		return err
+	}
+
+	blockRows := [][]string{{"height", "round", "timestamp", "miner_id", "txs", "sim_txs", "min_fee", "median_fee",
+		"max_fee", "backlog", "mempool_size"}}
+	for _, b := range r.Blocks {
+		blockRows = append(blockRows, []string{strconv.FormatInt(b.Height, 10), strconv.Itoa(b.Round),
+			b.Timestamp.Format(time.RFC3339Nano), b.MinerID, strconv.Itoa(b.Txs), strconv.Itoa(b.SimTxs),
+			strconv.FormatInt(b.MinFee, 10), strconv.FormatInt(b.MedianFee, 10), strconv.FormatInt(b.MaxFee, 10),
+			strconv.Itoa(b.Backlog), strconv.Itoa(b.MempoolSize)})
+	}
+	if err := writeCSV(filepath.Join(dir, "blocks.csv"), blockRows); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "summary.json"), data, 0644)
+}
+
+// writeCSV writes rows to path
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteText writes the group summaries as a table
+func (r *Result) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Simulated %d rounds over blocks %d to %d in %v\n\n", r.Config.Rounds, r.StartHeight+1, r.EndHeight,
+		r.Finished.Sub(r.Started).Round(time.Millisecond))
+	groups := append([]GroupSummary(nil), r.Groups...)
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].MeanFee > groups[j].MeanFee })
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "group\tstrategy\tdemand\twanted\tsubmitted\tincluded\tpending\tunfunded\tinclusion\tmean fee\tmean wait\tmax wait\t")
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%.0f%%\t%.0f\t%.2f\t%d\t\n", g.Group, g.Strategy, g.Demand,
+			g.Wanted, g.Submitted, g.Included, g.Pending, g.Unfunded, 100*g.InclusionRate, g.MeanFee, g.MeanWait, g.MaxWait)
+	}
+	return tw.Flush()
+}
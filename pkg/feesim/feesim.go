@@ -0,0 +1,490 @@
+// Package feesim simulates a fee market against a running miner. Synthetic
+// wallet agents submit transactions at rates set by demand curves, bid fees
+// by strategies, and the fate of every submission is followed block by block,
+// producing datasets on how fees buy inclusion when blocks are full.
+package feesim
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/transaction"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Demand curve kinds
+const (
+	DemandConstant = "constant" // Rate transactions every round
+	DemandWave     = "wave"     // From Rate up to Peak and back over every Period rounds
+	DemandBurst    = "burst"    // Rate, with Peak on the first round of every Period
+)
+
+// Bidding strategies
+const (
+	StrategyFixed    = "fixed"    // Always bid Fee
+	StrategyRandom   = "random"   // Bid uniformly between Fee and MaxFee
+	StrategyAdaptive = "adaptive" // Bid Markup over the cheapest simulated fee last mined, from Fee to MaxFee
+)
+
+// Submission outcomes
+const (
+	StatusIncluded = "included" // Mined into a block
+	StatusPending  = "pending"  // Still unconfirmed when the simulation ended
+	StatusRejected = "rejected" // Refused by the miner
+	StatusUnfunded = "unfunded" // The agent wanted to send but had no confirmed output to spend
+)
+
+// DefaultPollInterval is how often the miner's tip is polled for new blocks
+const DefaultPollInterval = 100 * time.Millisecond
+
+var ErrInvalidConfig = errors.New("invalid simulation config")
+
+// DemandCurve sets how many transactions an agent wants to send each round.
+// Fractional rates carry over, so a rate of 0.5 sends every other round.
+type DemandCurve struct {
+	Kind   string  `json:"kind"`
+	Rate   float64 `json:"rate"`             // Transactions per round
+	Peak   float64 `json:"peak,omitempty"`   // Wave and burst: the highest rate
+	Period int     `json:"period,omitempty"` // Wave and burst: rounds per cycle
+}
+
+// At returns the demand in round (from 0)
+func (d DemandCurve) At(round int) float64 {
+	switch d.Kind {
+	case DemandWave:
+		phase := 2 * math.Pi * float64(round%d.Period) / float64(d.Period)
+		return d.Rate + (d.Peak-d.Rate)*(1-math.Cos(phase))/2
+	case DemandBurst:
+		if round%d.Period == 0 {
+			return d.Peak
+		}
+	}
+	return d.Rate
+}
+
+// Bidding sets the fee an agent offers, in satoshi per transaction. Every
+// simulated transaction has the same shape, so fees rank as fee rates do.
+type Bidding struct {
+	Strategy string  `json:"strategy"`
+	Fee      int64   `json:"fee"`               // Fixed bid, or the lowest bid of the other strategies
+	MaxFee   int64   `json:"max_fee,omitempty"` // Random and adaptive: the highest bid
+	Markup   float64 `json:"markup,omitempty"`  // Adaptive: fraction bid over the cheapest simulated fee last mined
+}
+
+// AgentConfig describes a group of identical agents
+type AgentConfig struct {
+	Name    string      `json:"name"`
+	Count   int         `json:"count"`   // Agents in the group (default 1)
+	Outputs int         `json:"outputs"` // Confirmed outputs funded per agent, its most transactions in flight (default 5)
+	Demand  DemandCurve `json:"demand"`
+	Bidding Bidding     `json:"bidding"`
+}
+
+// Config describes a simulation
+type Config struct {
+	Rounds int           `json:"rounds"` // Blocks to submit transactions for
+	Drain  int           `json:"drain"`  // Further blocks to wait for pending transactions, submitting none
+	Value  int64         `json:"value"`  // Satoshi funded per agent output (default 1000000)
+	Seed   int64         `json:"seed"`   // Seeds the random bids (0 = from the clock)
+	Agents []AgentConfig `json:"agents"`
+}
+
+// DefaultConfig returns three groups of agents with constant, wave, and
+// burst demand, bidding fixed, random, and adaptive fees
+func DefaultConfig() Config {
+	return Config{
+		Rounds: 30,
+		Drain:  5,
+		Value:  1000000,
+		Agents: []AgentConfig{
+			{Name: "steady", Count: 3, Outputs: 5, Demand: DemandCurve{Kind: DemandConstant, Rate: 1},
+				Bidding: Bidding{Strategy: StrategyFixed, Fee: 200}},
+			{Name: "commuter", Count: 3, Outputs: 5, Demand: DemandCurve{Kind: DemandWave, Rate: 0.2, Peak: 2, Period: 10},
+				Bidding: Bidding{Strategy: StrategyRandom, Fee: 100, MaxFee: 2000}},
+			{Name: "trader", Count: 2, Outputs: 8, Demand: DemandCurve{Kind: DemandBurst, Rate: 0.5, Peak: 6, Period: 8},
+				Bidding: Bidding{Strategy: StrategyAdaptive, Fee: 100, MaxFee: 5000, Markup: 0.2}},
+		},
+	}
+}
+
+// validate fills in defaults and checks the config
+func (cfg *Config) validate() error {
+	if cfg.Rounds < 1 || cfg.Drain < 0 {
+		return fmt.Errorf("%w: need at least one round and no negative drain", ErrInvalidConfig)
+	}
+	if cfg.Value <= 0 {
+		cfg.Value = 1000000
+	}
+	if len(cfg.Agents) == 0 {
+		return fmt.Errorf("%w: no agents", ErrInvalidConfig)
+	}
+	for i := range cfg.Agents {
+		a := &cfg.Agents[i]
+		if a.Name == "" {
+			a.Name = fmt.Sprintf("group%d", i)
+		}
+		if a.Count <= 0 {
+			a.Count = 1
+		}
+		if a.Outputs <= 0 {
+			a.Outputs = 5
+		}
+		switch a.Demand.Kind {
+		case DemandConstant:
+		case DemandWave, DemandBurst:
+			if a.Demand.Period <= 0 {
+				return fmt.Errorf("%w: %s: %s demand needs a period", ErrInvalidConfig, a.Name, a.Demand.Kind)
+			}
+		default:
+			return fmt.Errorf("%w: %s: unknown demand %q", ErrInvalidConfig, a.Name, a.Demand.Kind)
+		}
+		b := a.Bidding
+		switch b.Strategy {
+		case StrategyFixed:
+		case StrategyRandom, StrategyAdaptive:
+			if b.MaxFee < b.Fee {
+				return fmt.Errorf("%w: %s: max_fee below fee", ErrInvalidConfig, a.Name)
+			}
+		default:
+			return fmt.Errorf("%w: %s: unknown strategy %q", ErrInvalidConfig, a.Name, b.Strategy)
+		}
+		if b.Fee <= 0 || max(b.Fee, b.MaxFee) >= cfg.Value {
+			return fmt.Errorf("%w: %s: fees must be positive and below the funded value", ErrInvalidConfig, a.Name)
+		}
+	}
+	return nil
+}
+
+// Node is the miner the simulation runs against
+type Node interface {
+	// Status returns the height of the tip and the number of pending transactions
+	Status() (height int64, pending int, err error)
+	// Block returns the block at height of the miner's chain
+	Block(height int64) (*block.Block, error)
+	// UTXOs returns the unspent outputs of an address
+	UTXOs(address string) ([]transaction.UTXO, error)
+	// Submit submits a signed transaction
+	Submit(tx *transaction.Transaction) error
+}
+
+// Funds are confirmed outputs spendable by the simulation, with their keys
+type Funds struct {
+	UTXOs []transaction.UTXO
+	Keys  map[string]string // Address -> hex private key
+}
+
+// agent is one synthetic wallet
+type agent struct {
+	name  string
+	group *AgentConfig
+	key   *transaction.KeyPair
+	free  []transaction.UTXO // Confirmed outputs not being spent
+	owed  float64            // Demand carried over to the next round
+}
+
+// tracked is a submitted transaction awaiting inclusion
+type tracked struct {
+	agent  *agent
+	record int // Index into the result's transactions
+}
+
+// Simulator runs a simulation against a node
+type Simulator struct {
+	Config       Config
+	Node         Node
+	PollInterval time.Duration // How often the tip is polled (default DefaultPollInterval)
+	Timeout      time.Duration // Longest wait for a block before giving up (default 5m)
+	Logf         func(format string, args ...any)
+
+	rng      *rand.Rand
+	agents   []*agent
+	inflight map[string]*tracked
+	result   *Result
+	height   int64
+	cheapest int64 // Cheapest simulated fee in the latest block holding any, 0 before one
+}
+
+// New returns a simulator of cfg against node
+func New(cfg Config, node Node) (*Simulator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Simulator{
+		Config:       cfg,
+		Node:         node,
+		PollInterval: DefaultPollInterval,
+		Timeout:      5 * time.Minute,
+		Logf:         func(string, ...any) {},
+		rng:          rand.New(rand.NewSource(seed)),
+		inflight:     make(map[string]*tracked),
+	}, nil
+}
+
+// Needed returns the satoshi needed to fund every agent, fan-out fees included
+func (s *Simulator) Needed() int64 {
+	outputs := 0
+	for _, g := range s.Config.Agents {
+		outputs += g.Count * g.Outputs
+	}
+	return int64(outputs)*s.Config.Value + int64(outputs/fanOut+1)*fanOutFee
+}
+
+const (
+	fanOut    = 50     // Most agent outputs created by one funding transaction
+	fanOutFee = 100000 // Fee of a funding transaction, high enough to be mined first
+)
+
+// Run funds the agents from funds, then runs the configured rounds and
+// returns what happened to every transaction
+func (s *Simulator) Run(funds Funds) (*Result, error) {
+	if err := s.fund(funds); err != nil {
+		return nil, fmt.Errorf("funding agents: %w", err)
+	}
+	s.result = &Result{Config: s.Config, StartHeight: s.height, Started: time.Now()}
+
+	for round := 0; round < s.Config.Rounds+s.Config.Drain; round++ {
+		if round < s.Config.Rounds {
+			s.submitRound(round)
+		}
+		if err := s.awaitBlocks(round); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range s.inflight {
+		s.result.Transactions[t.record].Status = StatusPending
+	}
+	s.result.EndHeight = s.height
+	s.result.Finished = time.Now()
+	s.result.summarize()
+	return s.result, nil
+}
+
+// fund creates each agent and pays its outputs from funds, waiting until the
+// funding transactions are mined
+func (s *Simulator) fund(funds Funds) error {
+	var outputs []transaction.TxOutput
+	for gi := range s.Config.Agents {
+		g := &s.Config.Agents[gi]
+		for i := 0; i < g.Count; i++ {
+			key, err := transaction.GenerateKeyPair()
+			if err != nil {
+				return err
+			}
+			s.agents = append(s.agents, &agent{name: fmt.Sprintf("%s-%d", g.Name, i), group: g, key: key})
+			for j := 0; j < g.Outputs; j++ {
+				outputs = append(outputs, transaction.TxOutput{Value: s.Config.Value, ScriptPubKey: key.GetPublicKeyHex()})
+			}
+		}
+	}
+
+	// Spend the funds largest first, one funding transaction per fanOut outputs
+	utxos := append([]transaction.UTXO(nil), funds.UTXOs...)
+	sort.Slice(utxos, func(i, j int) bool { return utxos[i].Value > utxos[j].Value })
+	pending := make(map[string]bool)
+	for start := 0; start < len(outputs); start += fanOut {
+		batch := outputs[start:min(start+fanOut, len(outputs))]
+		need := int64(fanOutFee)
+		for _, out := range batch {
+			need += out.Value
+		}
+		var inputs []transaction.TxInput
+		owners := make(map[int]string)
+		var have int64
+		for have < need && len(utxos) > 0 {
+			u := utxos[0]
+			utxos = utxos[1:]
+			owners[len(inputs)] = u.ScriptPubKey
+			inputs = append(inputs, transaction.TxInput{TxID: u.TxID, OutIndex: u.OutIndex})
+			have += u.Value
+		}
+		if have < need {
+			return fmt.Errorf("funds fall short of the %d satoshi needed", s.Needed())
+		}
+		txOutputs := append([]transaction.TxOutput(nil), batch...)
+		if change := have - need; change > 0 {
+			txOutputs = append(txOutputs, transaction.TxOutput{Value: change, ScriptPubKey: owners[0]})
+		}
+		tx := transaction.NewUTXOTransaction(inputs, txOutputs)
+		if err := tx.SignWithPrivateKeys(owners, funds.Keys); err != nil {
+			return err
+		}
+		if err := s.Node.Submit(tx); err != nil {
+			return err
+		}
+		pending[tx.ID] = true
+	}
+	s.Logf("Funding %d agents with %d outputs in %d transactions", len(s.agents), len(outputs), len(pending))
+
+	height, _, err := s.Node.Status()
+	if err != nil {
+		return err
+	}
+	s.height = height
+	deadline := time.Now().Add(s.Timeout)
+	for len(pending) > 0 {
+		blocks, err := s.newBlocks(deadline)
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			for _, tx := range b.Transactions {
+				delete(pending, tx.ID)
+			}
+		}
+	}
+
+	for _, a := range s.agents {
+		utxos, err := s.Node.UTXOs(a.key.GetPublicKeyHex())
+		if err != nil {
+			return err
+		}
+		a.free = utxos
+	}
+	return nil
+}
+
+// newBlocks waits until the tip moves past the last seen height and returns
+// the new blocks, oldest first
+func (s *Simulator) newBlocks(deadline time.Time) ([]*block.Block, error) {
+	for {
+		height, _, err := s.Node.Status()
+		if err != nil {
+			return nil, err
+		}
+		if height > s.height {
+			var blocks []*block.Block
+			for h := s.height + 1; h <= height; h++ {
+				b, err := s.Node.Block(h)
+				if err != nil {
+					return nil, err
+				}
+				if b == nil {
+					return nil, fmt.Errorf("miner has no block #%d", h)
+				}
+				blocks = append(blocks, b)
+			}
+			s.height = height
+			return blocks, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no new block within %v", s.Timeout)
+		}
+		time.Sleep(s.PollInterval)
+	}
+}
+
+// submitRound sends each agent's demand for the round
+func (s *Simulator) submitRound(round int) {
+	for _, a := range s.agents {
+		a.owed += a.group.Demand.At(round)
+		for ; a.owed >= 1; a.owed-- {
+			s.submit(a, round)
+		}
+	}
+}
+
+// bid returns the fee the agent offers now
+func (s *Simulator) bid(a *agent) int64 {
+	b := a.group.Bidding
+	switch b.Strategy {
+	case StrategyRandom:
+		return b.Fee + s.rng.Int63n(b.MaxFee-b.Fee+1)
+	case StrategyAdaptive:
+		if s.cheapest == 0 {
+			return b.Fee
+		}
+		return min(max(int64(math.Ceil(float64(s.cheapest)*(1+b.Markup))), b.Fee), b.MaxFee)
+	}
+	return b.Fee
+}
+
+// submit has the agent spend one of its free outputs back to itself, paying
+// its bid, and records the submission
+func (s *Simulator) submit(a *agent, round int) {
+	record := TxRecord{Agent: a.name, Group: a.group.Name, Strategy: a.group.Bidding.Strategy, Round: round,
+		SubmitHeight: s.height, Submitted: time.Now()}
+	if len(a.free) == 0 {
+		record.Status = StatusUnfunded
+		s.result.Transactions = append(s.result.Transactions, record)
+		return
+	}
+	utxo := a.free[0]
+	record.Fee = s.bid(a)
+	if record.Fee >= utxo.Value {
+		record.Status = StatusUnfunded
+		s.result.Transactions = append(s.result.Transactions, record)
+		return
+	}
+
+	owner := a.key.GetPublicKeyHex()
+	tx := transaction.NewUTXOTransaction([]transaction.TxInput{{TxID: utxo.TxID, OutIndex: utxo.OutIndex}},
+		[]transaction.TxOutput{{Value: utxo.Value - record.Fee, ScriptPubKey: owner}})
+	if err := tx.SignWithPrivateKeys(map[int]string{0: owner}, map[string]string{owner: a.key.GetPrivateKeyHex()}); err != nil {
+		record.Status, record.Error = StatusRejected, err.Error()
+		s.result.Transactions = append(s.result.Transactions, record)
+		return
+	}
+	record.TxID = tx.ID
+	record.Size = mempool.Size(tx)
+	record.FeeRate = float64(record.Fee) / float64(record.Size)
+	if err := s.Node.Submit(tx); err != nil {
+		record.Status, record.Error = StatusRejected, err.Error()
+		s.result.Transactions = append(s.result.Transactions, record)
+		return
+	}
+	a.free = a.free[1:]
+	s.inflight[tx.ID] = &tracked{agent: a, record: len(s.result.Transactions)}
+	s.result.Transactions = append(s.result.Transactions, record)
+}
+
+// awaitBlocks waits for the next block and records what it included
+func (s *Simulator) awaitBlocks(round int) error {
+	blocks, err := s.newBlocks(time.Now().Add(s.Timeout))
+	if err != nil {
+		return err
+	}
+	_, pending, err := s.Node.Status()
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		rec := BlockRecord{Height: b.Index, Round: round, Timestamp: time.Unix(0, b.Timestamp), MinerID: b.MinerID,
+			Txs: len(b.Transactions) - 1, MempoolSize: pending}
+		var fees []int64
+		for _, tx := range b.Transactions {
+			t, ok := s.inflight[tx.ID]
+			if !ok {
+				continue
+			}
+			delete(s.inflight, tx.ID)
+			r := &s.result.Transactions[t.record]
+			r.Status = StatusIncluded
+			r.IncludedHeight = b.Index
+			r.WaitBlocks = b.Index - r.SubmitHeight
+			r.WaitTime = time.Unix(0, b.Timestamp).Sub(r.Submitted)
+			fees = append(fees, r.Fee)
+			// The agent's change is confirmed, so it can be spent again
+			t.agent.free = append(t.agent.free, transaction.UTXO{TxID: tx.ID, Value: tx.Outputs[0].Value,
+				ScriptPubKey: tx.Outputs[0].ScriptPubKey})
+		}
+		rec.SimTxs = len(fees)
+		rec.Backlog = len(s.inflight)
+		if len(fees) > 0 {
+			sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+			rec.MinFee, rec.MedianFee, rec.MaxFee = fees[0], fees[len(fees)/2], fees[len(fees)-1]
+			s.cheapest = fees[0]
+		}
+		s.result.Blocks = append(s.result.Blocks, rec)
+	}
+	s.Logf("Round %d: height %d, %d simulated transactions in flight", round, s.height, len(s.inflight))
+	return nil
+}
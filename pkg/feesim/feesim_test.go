@@ -0,0 +1,107 @@
+package feesim
+
+import (
+	"blockchain/pkg/network"
+	"blockchain/pkg/wallet"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDemandCurves(t *testing.T) {
+	wave := DemandCurve{Kind: DemandWave, Rate: 1, Peak: 5, Period: 4}
+	if wave.At(0) != 1 || wave.At(2) != 5 || wave.At(4) != 1 {
+		t.Errorf("A wave should rise from its rate to its peak and back, got %v %v %v", wave.At(0), wave.At(2), wave.At(4))
+	}
+	burst := DemandCurve{Kind: DemandBurst, Rate: 0.5, Peak: 8, Period: 3}
+	if burst.At(0) != 8 || burst.At(1) != 0.5 || burst.At(3) != 8 {
+		t.Errorf("A burst should peak on the first round of each period, got %v %v %v", burst.At(0), burst.At(1), burst.At(3))
+	}
+
+	cfg := DefaultConfig()
+	cfg.Agents[0].Bidding.Strategy = "sniper"
+	if _, err := New(cfg, nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("An unknown strategy should be refused, got %v", err)
+	}
+}
+
+func TestSimulationAgainstMiner(t *testing.T) {
+	payout, err := wallet.GenerateHDWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := network.NewMiner("feesim", "localhost:19141", 19, nil,
+		network.WithPayoutWallet(payout), network.WithMaxBlockTxs(2))
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer m.Stop()
+	m.StartMining()
+	defer m.StopMining()
+
+	node, err := Dial("localhost:19141", network.Credentials{})
+	if err != nil {
+		t.Fatalf("Failed to dial miner: %v", err)
+	}
+	defer node.Close()
+
+	cfg := Config{Rounds: 6, Drain: 4, Value: 100000, Seed: 1, Agents: []AgentConfig{
+		{Name: "cheap", Count: 2, Outputs: 2, Demand: DemandCurve{Kind: DemandConstant, Rate: 1},
+			Bidding: Bidding{Strategy: StrategyFixed, Fee: 100}},
+		{Name: "rich", Count: 1, Outputs: 3, Demand: DemandCurve{Kind: DemandBurst, Rate: 1, Peak: 3, Period: 3},
+			Bidding: Bidding{Strategy: StrategyAdaptive, Fee: 1000, MaxFee: 5000, Markup: 0.5}},
+	}}
+	sim, err := New(cfg, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.PollInterval = 5 * time.Millisecond
+	sim.Timeout = 30 * time.Second
+
+	var funds Funds
+	deadline := time.Now().Add(30 * time.Second)
+	for funds, err = PayoutFunds(node, payout, sim.Needed()); err != nil; funds, err = PayoutFunds(node, payout, sim.Needed()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("The miner never earned enough to fund the agents: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	result, err := sim.Run(funds)
+	if err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	if len(result.Groups) != 2 || len(result.Blocks) < cfg.Rounds+cfg.Drain {
+		t.Fatalf("Expected two groups and a record of every block, got %d groups and %d blocks", len(result.Groups), len(result.Blocks))
+	}
+	for _, g := range result.Groups {
+		if g.Wanted == 0 || g.Submitted == 0 || g.Included == 0 || g.Rejected != 0 {
+			t.Errorf("Group %s should submit and get transactions included, got %+v", g.Group, g)
+		}
+	}
+	for _, tx := range result.Transactions {
+		if tx.Status == StatusIncluded && (tx.IncludedHeight <= tx.SubmitHeight || tx.WaitBlocks != tx.IncludedHeight-tx.SubmitHeight) {
+			t.Errorf("Inclusion recorded inconsistently: %+v", tx)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := result.WriteDataset(dir); err != nil {
+		t.Fatalf("WriteDataset failed: %v", err)
+	}
+	f, err := os.Open(filepath.Join(dir, "transactions.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(rows) != len(result.Transactions)+1 {
+		t.Errorf("Expected a header and one row per transaction, got %d rows, %v", len(rows), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blocks.csv")); err != nil {
+		t.Errorf("blocks.csv missing: %v", err)
+	}
+}
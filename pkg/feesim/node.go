@@ -0,0 +1,95 @@
+package feesim
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/network"
+	"blockchain/pkg/transaction"
+	"blockchain/pkg/wallet"
+	"errors"
+	"net/rpc"
+)
+
+// RPCNode is a miner reached over its RPC interface
+type RPCNode struct {
+	client *rpc.Client
+}
+
+// Dial connects to the miner at address, presenting cred if it restricts access
+func Dial(address string, cred network.Credentials) (*RPCNode, error) {
+	client, err := network.DialMiner(address, cred)
+	if err != nil {
+		return nil, err
+	}
+	return &RPCNode{client: client}, nil
+}
+
+// Close closes the connection
+func (n *RPCNode) Close() error {
+	return n.client.Close()
+}
+
+// Status returns the height of the miner's tip and its pending transactions
+func (n *RPCNode) Status() (int64, int, error) {
+	var reply network.StatusReply
+	if err := n.client.Call("RPCService.GetStatus", &struct{}{}, &reply); err != nil {
+		return 0, 0, err
+	}
+	return int64(reply.ChainLength) - 1, reply.PendingTxs, nil
+}
+
+// Block returns the block at height, or nil if the chain is shorter
+func (n *RPCNode) Block(height int64) (*block.Block, error) {
+	var reply network.BlockQueryReply
+	if err := n.client.Call("RPCService.GetBlock", &network.BlockQueryArgs{Height: height}, &reply); err != nil {
+		return nil, err
+	}
+	if !reply.Found {
+		return nil, nil
+	}
+	return block.DeserializeBlock(reply.BlockData)
+}
+
+// UTXOs returns the unspent outputs of address
+func (n *RPCNode) UTXOs(address string) ([]transaction.UTXO, error) {
+	var reply network.UTXOsReply
+	if err := n.client.Call("RPCService.GetUTXOs", &network.AddressArgs{Address: address}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.UTXOs, nil
+}
+
+// Submit submits a signed transaction
+func (n *RPCNode) Submit(tx *transaction.Transaction) error {
+	_, err := network.SubmitRawTransaction(n.client, tx)
+	return err
+}
+
+// PayoutFunds collects at least need satoshi of unspent coinbase outputs paid
+// to w, searching down from the tip. A miner started with w as its payout
+// wallet pays the coinbase at height h to w's address at index h.
+func PayoutFunds(node Node, w *wallet.HDWallet, need int64) (Funds, error) {
+	funds := Funds{Keys: make(map[string]string)}
+	height, _, err := node.Status()
+	if err != nil {
+		return funds, err
+	}
+	var have int64
+	for h := height; h > 0 && have < need; h-- {
+		key := w.DeriveKey(uint32(h))
+		utxos, err := node.UTXOs(key.GetPublicKeyHex())
+		if err != nil {
+			return funds, err
+		}
+		for _, u := range utxos {
+			funds.UTXOs = append(funds.UTXOs, u)
+			have += u.Value
+		}
+		if len(utxos) > 0 {
+			funds.Keys[key.GetPublicKeyHex()] = key.GetPrivateKeyHex()
+		}
+	}
+	if have < need {
+		return funds, errors.New("the payout wallet's coinbases fall short of the funding needed; let the miner mine longer")
+	}
+	return funds, nil
+}
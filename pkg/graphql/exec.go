@@ -0,0 +1,253 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Resolver computes a field's value from its parent object and arguments.
+// Variables in args have already been substituted.
+type Resolver func(source any, args Args) (any, error)
+
+// Field describes one field of an object type
+type Field struct {
+	Type    string // Object type name of the value (or list elements); "" for scalars
+	Resolve Resolver
+}
+
+// Object maps field names to their definitions
+type Object map[string]Field
+
+// Schema is a set of object types and the root query type
+type Schema struct {
+	Query string
+	Types map[string]Object
+}
+
+// Error is a query error, with the response path of the failing field if any
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Response is the result of executing a query
+type Response struct {
+	Data   *OrderedMap `json:"data"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// OrderedMap is a JSON object that keeps its keys in selection order
+type OrderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]any)}
+}
+
+// Set sets a key, appending it if new
+func (m *OrderedMap) Set(key string, value any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value of a key
+func (m *OrderedMap) Get(key string) any {
+	return m.values[key]
+}
+
+// MarshalJSON encodes the map with keys in insertion order
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Args holds a field's argument values
+type Args map[string]any
+
+// Int returns an integer argument. JSON variables arrive as float64 and are
+// accepted when they hold a whole number.
+func (a Args) Int(name string) (int64, bool, error) {
+	v, ok := a[name]
+	if !ok || v == nil {
+		return 0, false, nil
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true, nil
+	case float64:
+		if n == float64(int64(n)) {
+			return int64(n), true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("argument %q must be an Int", name)
+}
+
+// String returns a string argument
+func (a Args) String(name string) (string, bool, error) {
+	v, ok := a[name]
+	if !ok || v == nil {
+		return "", false, nil
+	}
+	s, isString := v.(string)
+	if !isString {
+		return "", false, fmt.Errorf("argument %q must be a String", name)
+	}
+	return s, true, nil
+}
+
+// Execute parses and runs a query against root, the value of the query type
+func (s *Schema) Execute(query string, variables map[string]any, root any) *Response {
+	doc, err := Parse(query)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	vars := make(map[string]any)
+	for _, def := range doc.Variables {
+		v, ok := variables[def.Name]
+		if !ok {
+			v = def.Default
+		}
+		if v == nil && def.Required {
+			return &Response{Errors: []Error{{Message: fmt.Sprintf("variable $%s of type %s! is required", def.Name, def.Type)}}}
+		}
+		vars[def.Name] = v
+	}
+
+	e := &executor{schema: s, vars: vars}
+	data := e.selectFields(s.Query, root, doc.Selections, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+type executor struct {
+	schema *Schema
+	vars   map[string]any
+	errors []Error
+}
+
+func (e *executor) fail(path []any, format string, args ...any) {
+	e.errors = append(e.errors, Error{
+		Message: fmt.Sprintf(format, args...),
+		Path:    append([]any(nil), path...),
+	})
+}
+
+// selectFields resolves a selection set against an object of the given type
+func (e *executor) selectFields(typeName string, source any, sels []Selection, path []any) *OrderedMap {
+	obj := e.schema.Types[typeName]
+	out := newOrderedMap()
+	for _, sel := range sels {
+		fieldPath := append(path, sel.Alias)
+		if sel.Name == "__typename" {
+			out.Set(sel.Alias, typeName)
+			continue
+		}
+		field, ok := obj[sel.Name]
+		if !ok {
+			e.fail(fieldPath, "cannot query field %q on type %q", sel.Name, typeName)
+			out.Set(sel.Alias, nil)
+			continue
+		}
+
+		value, err := field.Resolve(source, e.resolveArgs(sel.Args))
+		if err != nil {
+			e.fail(fieldPath, "%v", err)
+			out.Set(sel.Alias, nil)
+			continue
+		}
+		out.Set(sel.Alias, e.complete(field.Type, value, sel, fieldPath))
+	}
+	return out
+}
+
+// complete turns a resolved value into its response form, recursing into
+// objects and lists according to the field's selection set
+func (e *executor) complete(typeName string, value any, sel Selection, path []any) any {
+	if isNil(value) {
+		return nil
+	}
+	if typeName == "" {
+		if len(sel.Selections) > 0 {
+			e.fail(path, "field %q is a scalar and has no subfields", sel.Name)
+			return nil
+		}
+		return value
+	}
+	if len(sel.Selections) == 0 {
+		e.fail(path, "field %q of type %q requires a selection of subfields", sel.Name, typeName)
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice {
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = e.complete(typeName, rv.Index(i).Interface(), sel, append(path, i))
+		}
+		return list
+	}
+	return e.selectFields(typeName, value, sel.Selections, path)
+}
+
+// resolveArgs substitutes variable references in argument values
+func (e *executor) resolveArgs(args map[string]any) Args {
+	out := make(Args, len(args))
+	for name, v := range args {
+		out[name] = e.substitute(v)
+	}
+	return out
+}
+
+func (e *executor) substitute(v any) any {
+	switch val := v.(type) {
+	case Variable:
+		return e.vars[string(val)]
+	case []any:
+		list := make([]any, len(val))
+		for i, item := range val {
+			list[i] = e.substitute(item)
+		}
+		return list
+	case map[string]any:
+		obj := make(map[string]any, len(val))
+		for k, item := range val {
+			obj[k] = e.substitute(item)
+		}
+		return obj
+	}
+	return v
+}
+
+// isNil reports whether v is nil or a typed nil pointer, slice, or map
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
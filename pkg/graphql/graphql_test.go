@@ -0,0 +1,141 @@
+package graphql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type book struct {
+	Title  string
+	Author *author
+}
+
+type author struct {
+	Name  string
+	Books []*book
+}
+
+func testSchema() *Schema {
+	tolkien := &author{Name: "Tolkien"}
+	tolkien.Books = []*book{{Title: "The Hobbit", Author: tolkien}, {Title: "The Silmarillion", Author: tolkien}}
+
+	return &Schema{
+		Query: "Query",
+		Types: map[string]Object{
+			"Query": {
+				"author": {Type: "Author", Resolve: func(_ any, args Args) (any, error) {
+					name, _, err := args.String("name")
+					if err != nil {
+						return nil, err
+					}
+					if name != tolkien.Name {
+						return nil, nil
+					}
+					return tolkien, nil
+				}},
+				"count": {Resolve: func(_ any, args Args) (any, error) {
+					n, _, err := args.Int("n")
+					return n, err
+				}},
+			},
+			"Author": {
+				"name":  {Resolve: func(src any, _ Args) (any, error) { return src.(*author).Name, nil }},
+				"books": {Type: "Book", Resolve: func(src any, _ Args) (any, error) { return src.(*author).Books, nil }},
+			},
+			"Book": {
+				"title":  {Resolve: func(src any, _ Args) (any, error) { return src.(*book).Title, nil }},
+				"author": {Type: "Author", Resolve: func(src any, _ Args) (any, error) { return src.(*book).Author, nil }},
+			},
+		},
+	}
+}
+
+func execute(t *testing.T, query string, vars map[string]any) (string, []Error) {
+	resp := testSchema().Execute(query, vars, nil)
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+	return string(data), resp.Errors
+}
+
+func TestExecuteNestedSelection(t *testing.T) {
+	data, errs := execute(t, `
+		# Aliases, nested lists, and __typename
+		query Books($who: String!) {
+			writer: author(name: $who) {
+				__typename
+				books { title author { name } }
+			}
+			missing: author(name: "Nobody") { name }
+		}`, map[string]any{"who": "Tolkien"})
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	want := `{"writer":{"__typename":"Author","books":[{"title":"The Hobbit","author":{"name":"Tolkien"}},` +
+		`{"title":"The Silmarillion","author":{"name":"Tolkien"}}]},"missing":null}`
+	if data != want {
+		t.Errorf("Unexpected data:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestExecuteArgumentsAndVariables(t *testing.T) {
+	// JSON variables decode as float64; whole numbers are accepted as Int
+	data, errs := execute(t, `query($n: Int = 3) { a: count(n: 7) b: count(n: $n) c: count(n: $m) }`,
+		map[string]any{"n": float64(5)})
+	if len(errs) != 0 || data != `{"a":7,"b":5,"c":0}` {
+		t.Errorf("Unexpected result %s %v", data, errs)
+	}
+
+	if _, errs := execute(t, `query($who: String!) { author(name: $who) { name } }`, nil); len(errs) != 1 {
+		t.Error("Missing required variable should be an error")
+	}
+	if _, errs := execute(t, `{ count(n: "seven") }`, nil); len(errs) != 1 || errs[0].Path[0] != "count" {
+		t.Errorf("Wrong argument type should be a field error, got %v", errs)
+	}
+}
+
+func TestExecuteFieldErrors(t *testing.T) {
+	data, errs := execute(t, `{ author(name: "Tolkien") { name age books } }`, nil)
+	if len(errs) != 2 {
+		t.Fatalf("Expected errors for the unknown field and the missing subselection, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Message, `"age"`) || !strings.Contains(errs[1].Message, "selection") {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if data != `{"author":{"name":"Tolkien","age":null,"books":null}}` {
+		t.Errorf("Failing fields should be null, got %s", data)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		`{ author(name: "Tolkien") { name }`,
+		`{ author(name: "unterminated) { name } }`,
+		`{ ...BookFields }`,
+		`mutation { count }`,
+		`{ count } { count }`,
+		`{}`,
+	} {
+		if _, err := Parse(query); err == nil {
+			t.Errorf("Expected a syntax error for %q", query)
+		}
+	}
+
+	doc, err := Parse(`query Q($ids: [String!]!, $n: Int = -2) { a: f(x: [1, 2.5, "s\nA"], y: {z: true, w: null}, e: ENUM) }`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if doc.Name != "Q" || doc.Variables[0].Type != "[String!]" || !doc.Variables[0].Required || doc.Variables[1].Default != int64(-2) {
+		t.Errorf("Unexpected variable definitions: %+v", doc.Variables)
+	}
+	args := doc.Selections[0].Args
+	if list := args["x"].([]any); list[0] != int64(1) || list[1] != 2.5 || list[2] != "s\nA" {
+		t.Errorf("Unexpected list argument: %v", list)
+	}
+	if args["e"] != "ENUM" || args["y"].(map[string]any)["z"] != true {
+		t.Errorf("Unexpected arguments: %v", args)
+	}
+}
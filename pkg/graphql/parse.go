@@ -0,0 +1,467 @@
+// Package graphql implements the subset of GraphQL needed to query chain data:
+// query operations with variables, aliases, arguments, nested selections, and
+// __typename. Fragments, directives, mutations, and introspection are not supported.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed query operation
+type Document struct {
+	Name       string
+	Variables  []VariableDef
+	Selections []Selection
+}
+
+// VariableDef declares an operation variable, e.g. $height: Int = 0
+type VariableDef struct {
+	Name     string
+	Type     string
+	Default  any
+	Required bool
+}
+
+// Selection is a field requested from an object, with its own sub-selections
+type Selection struct {
+	Alias      string // Response key; equal to Name unless aliased
+	Name       string
+	Args       map[string]any // Literal values, or Variable references
+	Selections []Selection
+}
+
+// Variable is an argument that refers to an operation variable
+type Variable string
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any // Decoded value of int, float, and string tokens
+	pos   int
+}
+
+type parser struct {
+	src    string
+	pos    int
+	tok    token
+	tokErr error
+}
+
+// Parse parses a query document containing a single query operation
+func Parse(src string) (*Document, error) {
+	p := &parser{src: src}
+	p.next()
+
+	doc := &Document{}
+	if p.tok.kind == tokName {
+		if p.tok.text != "query" {
+			return nil, p.errorf("unsupported operation %q", p.tok.text)
+		}
+		p.next()
+		if p.tok.kind == tokName {
+			doc.Name = p.tok.text
+			p.next()
+		}
+		if p.isPunct("(") {
+			vars, err := p.parseVariableDefs()
+			if err != nil {
+				return nil, err
+			}
+			doc.Variables = vars
+		}
+	}
+
+	sels, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	doc.Selections = sels
+	if p.tokErr != nil {
+		return nil, p.tokErr
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q after operation (only one operation is supported)", p.tok.text)
+	}
+	return doc, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isPunct(s string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == s
+}
+
+func (p *parser) expect(s string) error {
+	if p.tokErr != nil {
+		return p.tokErr
+	}
+	if !p.isPunct(s) {
+		return p.errorf("expected %q, found %q", s, p.tok.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseVariableDefs() ([]VariableDef, error) {
+	p.next() // (
+	var defs []VariableDef
+	for !p.isPunct(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokName {
+			return nil, p.errorf("expected variable name")
+		}
+		def := VariableDef{Name: p.tok.text}
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, required, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		def.Type, def.Required = typ, required
+		if p.isPunct("=") {
+			p.next()
+			if def.Default, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	p.next() // )
+	return defs, nil
+}
+
+// parseType parses a type reference such as Int, String!, or [String!]
+func (p *parser) parseType() (string, bool, error) {
+	var typ string
+	if p.isPunct("[") {
+		p.next()
+		inner, innerRequired, err := p.parseType()
+		if err != nil {
+			return "", false, err
+		}
+		if innerRequired {
+			inner += "!"
+		}
+		if err := p.expect("]"); err != nil {
+			return "", false, err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		if p.tok.kind != tokName {
+			return "", false, p.errorf("expected type name")
+		}
+		typ = p.tok.text
+		p.next()
+	}
+	if p.isPunct("!") {
+		p.next()
+		return typ, true, nil
+	}
+	return typ, false, nil
+}
+
+func (p *parser) parseSelectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []Selection
+	for !p.isPunct("}") {
+		if p.tokErr != nil {
+			return nil, p.tokErr
+		}
+		if p.isPunct("...") {
+			return nil, p.errorf("fragments are not supported")
+		}
+		if p.tok.kind != tokName {
+			return nil, p.errorf("expected field name, found %q", p.tok.text)
+		}
+		sel := Selection{Name: p.tok.text}
+		p.next()
+		if p.isPunct(":") {
+			p.next()
+			if p.tok.kind != tokName {
+				return nil, p.errorf("expected field name after alias %q", sel.Name)
+			}
+			sel.Alias, sel.Name = sel.Name, p.tok.text
+			p.next()
+		}
+		if sel.Alias == "" {
+			sel.Alias = sel.Name
+		}
+		if p.isPunct("(") {
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			sel.Args = args
+		}
+		if p.isPunct("@") {
+			return nil, p.errorf("directives are not supported")
+		}
+		if p.isPunct("{") {
+			sub, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			sel.Selections = sub
+		}
+		sels = append(sels, sel)
+	}
+	p.next() // }
+	if len(sels) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return sels, nil
+}
+
+func (p *parser) parseArguments() (map[string]any, error) {
+	p.next() // (
+	args := make(map[string]any)
+	for !p.isPunct(")") {
+		if p.tok.kind != tokName {
+			return nil, p.errorf("expected argument name, found %q", p.tok.text)
+		}
+		name := p.tok.text
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+	p.next() // )
+	return args, nil
+}
+
+// parseValue parses an argument value; constant values may not reference variables
+func (p *parser) parseValue(constant bool) (any, error) {
+	if p.tokErr != nil {
+		return nil, p.tokErr
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokInt, tokFloat, tokString:
+		p.next()
+		return tok.value, nil
+	case tokName:
+		p.next()
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return tok.text, nil // Enum values are passed as strings
+	case tokPunct:
+		switch tok.text {
+		case "$":
+			if constant {
+				return nil, p.errorf("variables are not allowed here")
+			}
+			p.next()
+			if p.tok.kind != tokName {
+				return nil, p.errorf("expected variable name")
+			}
+			name := p.tok.text
+			p.next()
+			return Variable(name), nil
+		case "[":
+			p.next()
+			list := []any{}
+			for !p.isPunct("]") {
+				v, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			p.next()
+			obj := make(map[string]any)
+			for !p.isPunct("}") {
+				if p.tok.kind != tokName {
+					return nil, p.errorf("expected object field name")
+				}
+				name := p.tok.text
+				p.next()
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				v, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				obj[name] = v
+			}
+			p.next()
+			return obj, nil
+		}
+	}
+	return nil, p.errorf("unexpected %q in value", tok.text)
+}
+
+// next advances to the next token, skipping whitespace, commas, and comments
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else {
+			break
+		}
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokPunct, text: "...", pos: start}
+	case strings.IndexByte("{}()[]:$!=@", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokPunct, text: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokName, text: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		p.lexNumber(start)
+	case c == '"':
+		p.lexString(start)
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.fail(start, fmt.Errorf("syntax error at offset %d: unexpected character %q", start, r))
+	}
+}
+
+func (p *parser) lexNumber(start int) {
+	p.pos++
+	float := false
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' || c == 'e' || c == 'E' || ((c == '+' || c == '-') && float) {
+			float = true
+		} else if !isDigit(c) {
+			break
+		}
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	if float {
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			p.fail(start, fmt.Errorf("syntax error at offset %d: invalid number %q", start, text))
+			return
+		}
+		p.tok = token{kind: tokFloat, text: text, value: v, pos: start}
+		return
+	}
+	v, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		p.fail(start, fmt.Errorf("syntax error at offset %d: invalid integer %q", start, text))
+		return
+	}
+	p.tok = token{kind: tokInt, text: text, value: v, pos: start}
+}
+
+func (p *parser) lexString(start int) {
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			p.tok = token{kind: tokString, text: p.src[start:p.pos], value: sb.String(), pos: start}
+			return
+		case c == '\n':
+			p.fail(start, fmt.Errorf("syntax error at offset %d: unterminated string", start))
+			return
+		case c == '\\' && p.pos+1 < len(p.src):
+			esc := p.src[p.pos+1]
+			p.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				sb.WriteByte(esc)
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.fail(start, fmt.Errorf("syntax error at offset %d: invalid unicode escape", start))
+					return
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.fail(start, fmt.Errorf("syntax error at offset %d: invalid unicode escape", start))
+					return
+				}
+				sb.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				p.fail(start, fmt.Errorf("syntax error at offset %d: invalid escape \\%c", start, esc))
+				return
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	p.fail(start, fmt.Errorf("syntax error at offset %d: unterminated string", start))
+}
+
+// fail records a lexical error and ends the token stream
+func (p *parser) fail(start int, err error) {
+	if p.tokErr == nil {
+		p.tokErr = err
+	}
+	p.pos = len(p.src)
+	p.tok = token{kind: tokEOF, pos: start}
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
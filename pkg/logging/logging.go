@@ -0,0 +1,140 @@
+// Package logging gives the standard logger levels. What the log package
+// prints is logged at info; Debugf, Warnf, and Errorf log at the other levels.
+// Setup picks where lines go and the lowest level written. Lines keep the log
+// package's format, with the level ahead of the message when it is not info:
+//
+//	2024/05/01 12:00:00 [m1] Mined block 12 in 1.2s
+//	2024/05/01 12:00:03 WARN [m1] Rejected block from m2: invalid PoW
+//
+// Until Setup is called, debug messages are dropped and the others go to the
+// standard logger.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ParseLevel reads a level name: debug, info, warn, or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn, or error)", name)
+	}
+	return level, nil
+}
+
+// Setup sends the lines of level and above to w, those of the log package
+// included
+func Setup(w io.Writer, level slog.Level) {
+	slog.SetDefault(slog.New(&handler{mu: &sync.Mutex{}, w: w, level: level}))
+}
+
+// Debugf logs a message only written at level debug
+func Debugf(format string, args ...any) {
+	logf(slog.LevelDebug, format, args...)
+}
+
+// Warnf logs a message about something wrong the process recovers from
+func Warnf(format string, args ...any) {
+	logf(slog.LevelWarn, format, args...)
+}
+
+// Errorf logs a message about an operation that failed
+func Errorf(format string, args ...any) {
+	logf(slog.LevelError, format, args...)
+}
+
+// Fatalf logs a message at level error, which every level writes, then exits
+func Fatalf(format string, args ...any) {
+	logf(slog.LevelError, format, args...)
+	os.Exit(1)
+}
+
+func logf(level slog.Level, format string, args ...any) {
+	logger := slog.Default()
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+	logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+// handler writes records as the log package would, with their level
+type handler struct {
+	mu     *sync.Mutex // Shared by the handlers derived with WithAttrs
+	w      io.Writer
+	level  slog.Level
+	attrs  string // Preformatted " key=value" pairs
+	prefix string // Group of keys added next
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	var buf []byte
+	if !r.Time.IsZero() {
+		buf = r.Time.AppendFormat(buf, "2006/01/02 15:04:05 ")
+	}
+	if r.Level != slog.LevelInfo {
+		buf = append(buf, r.Level.String()...)
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, r.Message...)
+	buf = append(buf, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf = appendAttr(buf, h.prefix, a)
+		return true
+	})
+	if len(buf) == 0 || buf[len(buf)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	var buf []byte
+	for _, a := range attrs {
+		buf = appendAttr(buf, h.prefix, a)
+	}
+	h2.attrs += string(buf)
+	return &h2
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// appendAttr appends a as " key=value", its key under prefix
+func appendAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			buf = appendAttr(buf, prefix, ga)
+		}
+		return buf
+	}
+	value := a.Value.String()
+	if strings.ContainsAny(value, " =\"") {
+		value = fmt.Sprintf("%q", value)
+	}
+	return fmt.Appendf(buf, " %s%s=%s", prefix, a.Key, value)
+}
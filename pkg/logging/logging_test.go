@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSetupFiltersByLevel(t *testing.T) {
+	defer Setup(os.Stderr, slog.LevelInfo)
+	var buf bytes.Buffer
+
+	Setup(&buf, slog.LevelWarn)
+	Debugf("debug %d", 1)
+	log.Printf("info %d", 1)
+	Warnf("warn %d", 1)
+	Errorf("error %d", 1)
+	if got := buf.String(); strings.Contains(got, "debug 1") || strings.Contains(got, "info 1") ||
+		!strings.Contains(got, " WARN warn 1\n") || !strings.Contains(got, " ERROR error 1\n") {
+		t.Errorf("Expected only warnings and errors at level warn, got:\n%s", got)
+	}
+
+	buf.Reset()
+	Setup(&buf, slog.LevelDebug)
+	Debugf("debug %d", 2)
+	log.Printf("[m1] info %d", 2)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines at level debug, got:\n%s", buf.String())
+	}
+	// Info lines look as the log package writes them
+	if !regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d DEBUG debug 2$`).MatchString(lines[0]) ||
+		!regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d \[m1\] info 2$`).MatchString(lines[1]) {
+		t.Errorf("Unexpected lines:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	slog.With("peer", "m2").WithGroup("block").Warn("rejected", "hash", "00ab", "reason", "invalid PoW")
+	if got := buf.String(); !strings.HasSuffix(got, ` WARN rejected peer=m2 block.hash=00ab block.reason="invalid PoW"`+"\n") {
+		t.Errorf("Unexpected attributes: %s", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an unknown level to be refused")
+	}
+}
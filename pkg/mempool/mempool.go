@@ -0,0 +1,383 @@
+// Package mempool holds a miner's pending transactions. The pool tracks each
+// transaction's fee, size, and age, keeps itself within size limits by an
+// eviction policy, expires transactions after a TTL, keeps out transactions
+// spending an output another pending one spends, and orders transactions by
+// fee rate for block assembly.
+package mempool
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxBytes is the default memory budget for pending transactions (32 MiB)
+	DefaultMaxBytes = 32 << 20
+
+	// DefaultTTL is how long a transaction may stay pending before it is dropped
+	DefaultTTL = 30 * time.Minute
+)
+
+var ErrFull = errors.New("mempool is full")
+
+// ErrConflict is returned by Add for a transaction spending an output that a
+// pending transaction already spends, unless it pays enough to replace it
+var ErrConflict = errors.New("conflicts with a pending transaction")
+
+// EvictionPolicy selects which pending transactions are dropped when over a limit
+type EvictionPolicy int
+
+const (
+	EvictOldest        EvictionPolicy = iota // Drop the longest-waiting transactions first
+	EvictLowestFeeRate                       // Drop the lowest fee-per-byte transactions first
+)
+
+// Config limits the pool
+type Config struct {
+	MaxBytes int64          // Approximate memory budget (0 = unlimited)
+	MaxTxs   int            // Maximum number of transactions (0 = unlimited)
+	Eviction EvictionPolicy // What to drop when over MaxBytes or MaxTxs
+	TTL      time.Duration  // How long a transaction may stay pending (0 = forever)
+}
+
+// DefaultConfig returns the limits used by a new miner
+func DefaultConfig() Config {
+	return Config{MaxBytes: DefaultMaxBytes, TTL: DefaultTTL}
+}
+
+// Entry is a pending transaction with what the pool knows about it
+type Entry struct {
+	Tx      *transaction.Transaction
+	Fee     int64 // Satoshi paid to the miner, as resolved on admission
+	Size    int64 // Approximate memory footprint in bytes
+	Arrival time.Time
+	Expires time.Time // Zero if the transaction never expires
+	seq     uint64    // Admission order, to break ties between equal arrivals
+}
+
+// FeeRate is the entry's fee per byte of Size
+func (e *Entry) FeeRate() float64 {
+	return float64(e.Fee) / float64(e.Size)
+}
+
+// Stats summarizes the pool
+type Stats struct {
+	Txs      int
+	Bytes    int64
+	Evicted  int64 // Transactions evicted over the pool's lifetime
+	Replaced int64 // Transactions replaced by a conflicting one paying more
+	Refused  int64 // Transactions refused for conflicting with a pending one
+	MaxBytes int64
+	MaxTxs   int
+}
+
+// Pool is a set of pending transactions, safe for concurrent use
+type Pool struct {
+	cfg      Config
+	entries  map[string]*Entry
+	spends   map[outpoint]string // Output -> ID of the pending transaction spending it
+	bytes    int64
+	evicted  int64
+	replaced int64
+	refused  int64
+	seq      uint64
+	mu       sync.RWMutex
+}
+
+// outpoint names a transaction output
+type outpoint struct {
+	txID  string
+	index int
+}
+
+// New creates an empty pool with the given limits
+func New(cfg Config) *Pool {
+	return &Pool{cfg: cfg, entries: make(map[string]*Entry), spends: make(map[outpoint]string)}
+}
+
+// Size approximates the in-memory footprint of a transaction, the unit of the
+// pool's byte budget and of fee rates
+func Size(tx *transaction.Transaction) int64 {
+	size := int64(len(tx.ID)) + 64
+	for _, in := range tx.Inputs {
+		size += int64(len(in.TxID)+len(in.ScriptSig)) + 48
+	}
+	for _, out := range tx.Outputs {
+		size += int64(len(out.ScriptPubKey)) + 32
+	}
+	return size + int64(len(tx.Memo))
+}
+
+// Add admits tx paying fee and evicts by policy until the pool is within its
+// limits. It returns the evicted entries, and ErrFull if tx was among them.
+// Adding a transaction already pending does nothing.
+//
+// If tx spends an output a pending transaction already spends, it replaces
+// every such conflict provided it pays a higher fee rate than each and a
+// higher fee than all of them together; otherwise it is refused with
+// ErrConflict. Either way only one spend of an output is ever pending.
+func (p *Pool) Add(tx *transaction.Transaction, fee int64) ([]Entry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.entries[tx.ID]; ok {
+		return nil, nil
+	}
+	p.seq++
+	e := &Entry{Tx: tx, Fee: fee, Size: Size(tx), Arrival: time.Now(), seq: p.seq}
+	if p.cfg.TTL > 0 {
+		e.Expires = e.Arrival.Add(p.cfg.TTL)
+	}
+
+	conflicts := p.conflictsLocked(tx)
+	if err := replaces(e, conflicts); err != nil {
+		p.refused++
+		return nil, err
+	}
+	for _, c := range conflicts {
+		p.removeLocked(c)
+	}
+	p.replaced += int64(len(conflicts))
+
+	p.entries[tx.ID] = e
+	p.bytes += e.Size
+	for _, in := range tx.Inputs {
+		p.spends[outpoint{in.TxID, in.OutIndex}] = tx.ID
+	}
+
+	evicted := p.enforceLocked()
+	if _, ok := p.entries[tx.ID]; !ok {
+		return evicted, ErrFull
+	}
+	return evicted, nil
+}
+
+// SetConfig replaces the pool's limits, restamping expiry times with the new
+// TTL, and returns the entries evicted to fit them
+func (p *Pool) SetConfig(cfg Config) []Entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+	for _, e := range p.entries {
+		e.Expires = time.Time{}
+		if cfg.TTL > 0 {
+			e.Expires = e.Arrival.Add(cfg.TTL)
+		}
+	}
+	return p.enforceLocked()
+}
+
+// Config returns the pool's limits
+func (p *Pool) Config() Config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg
+}
+
+// overLocked reports whether the pool exceeds its limits
+func (p *Pool) overLocked() bool {
+	return (p.cfg.MaxBytes > 0 && p.bytes > p.cfg.MaxBytes) ||
+		(p.cfg.MaxTxs > 0 && len(p.entries) > p.cfg.MaxTxs)
+}
+
+// enforceLocked evicts entries by policy until the pool fits its limits
+func (p *Pool) enforceLocked() []Entry {
+	if !p.overLocked() {
+		return nil
+	}
+	// Order eviction candidates: first element is evicted first
+	candidates := p.sortedLocked(func(a, b *Entry) bool {
+		if p.cfg.Eviction == EvictLowestFeeRate && a.FeeRate() != b.FeeRate() {
+			return a.FeeRate() < b.FeeRate()
+		}
+		return a.seq < b.seq
+	})
+	var evicted []Entry
+	for _, e := range candidates {
+		if !p.overLocked() {
+			break
+		}
+		p.removeLocked(e)
+		evicted = append(evicted, *e)
+	}
+	p.evicted += int64(len(evicted))
+	return evicted
+}
+
+func (p *Pool) removeLocked(e *Entry) {
+	delete(p.entries, e.Tx.ID)
+	p.bytes -= e.Size
+	for _, in := range e.Tx.Inputs {
+		op := outpoint{in.TxID, in.OutIndex}
+		if p.spends[op] == e.Tx.ID {
+			delete(p.spends, op)
+		}
+	}
+}
+
+// conflictsLocked returns the pending entries spending an output tx spends,
+// in arrival order
+func (p *Pool) conflictsLocked(tx *transaction.Transaction) []*Entry {
+	var conflicts []*Entry
+	for _, in := range tx.Inputs {
+		id, ok := p.spends[outpoint{in.TxID, in.OutIndex}]
+		if !ok {
+			continue
+		}
+		if e := p.entries[id]; !slices.Contains(conflicts, e) {
+			conflicts = append(conflicts, e)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return bySeq(conflicts[i], conflicts[j]) })
+	return conflicts
+}
+
+// replaces returns nil if e pays enough to replace the conflicting entries:
+// a higher fee rate than each, and a higher fee than all together, so that
+// the replacement pays for relaying it over the transactions it displaces
+func replaces(e *Entry, conflicts []*Entry) error {
+	var total int64
+	for _, c := range conflicts {
+		if e.FeeRate() <= c.FeeRate() {
+			return fmt.Errorf("%w %s paying %.6f sat/byte (offered %.6f)", ErrConflict, c.Tx.ID, c.FeeRate(), e.FeeRate())
+		}
+		total += c.Fee
+	}
+	if len(conflicts) > 0 && e.Fee <= total {
+		return fmt.Errorf("%w: replacing %d pending transactions needs a fee above %d satoshi, offered %d", ErrConflict, len(conflicts), total, e.Fee)
+	}
+	return nil
+}
+
+// Conflicts returns the pending transactions spending an output tx spends,
+// in arrival order; Add either refuses tx or replaces them
+func (p *Pool) Conflicts(tx *transaction.Transaction) []Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	conflicts := p.conflictsLocked(tx)
+	entries := make([]Entry, len(conflicts))
+	for i, e := range conflicts {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// sortedLocked returns the entries ordered by less
+func (p *Pool) sortedLocked(less func(a, b *Entry) bool) []*Entry {
+	entries := make([]*Entry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+	return entries
+}
+
+// Has reports whether a transaction is pending
+func (p *Pool) Has(txID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.entries[txID]
+	return ok
+}
+
+// Get returns a pending transaction's entry
+func (p *Pool) Get(txID string) (Entry, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	e, ok := p.entries[txID]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Remove drops the given transactions, ignoring any that are not pending
+func (p *Pool) Remove(txs []*transaction.Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tx := range txs {
+		if e, ok := p.entries[tx.ID]; ok {
+			p.removeLocked(e)
+		}
+	}
+}
+
+// Expire drops the entries whose TTL has passed at now and returns them
+func (p *Pool) Expire(now time.Time) []Entry {
+	return p.Filter(func(e *Entry) bool {
+		return e.Expires.IsZero() || !now.After(e.Expires)
+	})
+}
+
+// Filter drops the entries keep rejects and returns them in arrival order.
+// keep is called with the pool locked and must not use it.
+func (p *Pool) Filter(keep func(e *Entry) bool) []Entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var dropped []Entry
+	for _, e := range p.sortedLocked(bySeq) {
+		if !keep(e) {
+			p.removeLocked(e)
+			dropped = append(dropped, *e)
+		}
+	}
+	return dropped
+}
+
+// Transactions returns the pending transactions in arrival order
+func (p *Pool) Transactions() []*transaction.Transaction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return txsOf(p.sortedLocked(bySeq))
+}
+
+// ByFeeRate returns the pending transactions by descending fee rate, the
+// order a profit-seeking miner includes them in; equal rates keep arrival order
+func (p *Pool) ByFeeRate() []*transaction.Transaction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return txsOf(p.sortedLocked(func(a, b *Entry) bool {
+		if a.FeeRate() != b.FeeRate() {
+			return a.FeeRate() > b.FeeRate()
+		}
+		return a.seq < b.seq
+	}))
+}
+
+// Len returns the number of pending transactions
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.entries)
+}
+
+// Stats returns the pool's current size and limits
+func (p *Pool) Stats() Stats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return Stats{
+		Txs:      len(p.entries),
+		Bytes:    p.bytes,
+		Evicted:  p.evicted,
+		Replaced: p.replaced,
+		Refused:  p.refused,
+		MaxBytes: p.cfg.MaxBytes,
+		MaxTxs:   p.cfg.MaxTxs,
+	}
+}
+
+func bySeq(a, b *Entry) bool {
+	return a.seq < b.seq
+}
+
+func txsOf(entries []*Entry) []*transaction.Transaction {
+	txs := make([]*transaction.Transaction, len(entries))
+	for i, e := range entries {
+		txs[i] = e.Tx
+	}
+	return txs
+}
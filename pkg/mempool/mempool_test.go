@@ -0,0 +1,165 @@
+package mempool
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTx returns a distinct unsigned transaction; the pool never validates
+func newTx(i int) *transaction.Transaction {
+	tx := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: fmt.Sprintf("prev%d", i), OutIndex: 0, ScriptSig: "sig"}},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: "bob"}},
+	)
+	tx.ID = tx.CalculateHash()
+	return tx
+}
+
+func ids(txs []*transaction.Transaction) []string {
+	out := make([]string, len(txs))
+	for i, tx := range txs {
+		out[i] = tx.ID
+	}
+	return out
+}
+
+func TestAddAndOrder(t *testing.T) {
+	p := New(Config{})
+	txs := []*transaction.Transaction{newTx(0), newTx(1), newTx(2)}
+	for i, fee := range []int64{10, 300, 20} {
+		if _, err := p.Add(txs[i], fee); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	// A duplicate changes nothing
+	p.Add(txs[0], 1000)
+
+	if got := ids(p.Transactions()); fmt.Sprint(got) != fmt.Sprint(ids(txs)) {
+		t.Errorf("Transactions should be in arrival order, got %v", got)
+	}
+	want := []string{txs[1].ID, txs[2].ID, txs[0].ID}
+	if got := ids(p.ByFeeRate()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ByFeeRate should order by descending fee rate, got %v want %v", got, want)
+	}
+	if e, ok := p.Get(txs[0].ID); !ok || e.Fee != 10 {
+		t.Errorf("Duplicate add should keep the first entry, got %+v", e)
+	}
+
+	p.Remove(txs[:2])
+	if p.Len() != 1 || p.Stats().Bytes != Size(txs[2]) {
+		t.Errorf("Expected only the third transaction left, got %+v", p.Stats())
+	}
+}
+
+func TestEvictsLowestFeeRateOverTxLimit(t *testing.T) {
+	p := New(Config{MaxTxs: 2, Eviction: EvictLowestFeeRate})
+	low, mid, high := newTx(0), newTx(1), newTx(2)
+	p.Add(mid, 50)
+	p.Add(high, 100)
+
+	evicted, err := p.Add(low, 1)
+	if err != ErrFull || len(evicted) != 1 || evicted[0].Tx.ID != low.ID {
+		t.Fatalf("The new low-fee transaction should be evicted, got %v, %+v", err, evicted)
+	}
+
+	// Lowering the limit evicts the cheapest remaining transaction
+	evicted = p.SetConfig(Config{MaxTxs: 1, Eviction: EvictLowestFeeRate})
+	if len(evicted) != 1 || evicted[0].Tx.ID != mid.ID || !p.Has(high.ID) {
+		t.Errorf("Expected mid to be evicted, got %+v", evicted)
+	}
+	if stats := p.Stats(); stats.Evicted != 2 || stats.Txs != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestEvictsOldestOverByteLimit(t *testing.T) {
+	txs := []*transaction.Transaction{newTx(0), newTx(1), newTx(2)}
+	p := New(Config{MaxBytes: Size(txs[1]) + Size(txs[2]), Eviction: EvictOldest})
+	for _, tx := range txs {
+		p.Add(tx, 1000) // Fees don't matter to this policy
+	}
+	if p.Has(txs[0].ID) || p.Len() != 2 {
+		t.Errorf("Oldest transaction should be evicted, got %v", ids(p.Transactions()))
+	}
+}
+
+func TestExpireAndFilter(t *testing.T) {
+	p := New(Config{TTL: time.Minute})
+	a, b := newTx(0), newTx(1)
+	p.Add(a, 1)
+	p.Add(b, 2)
+
+	if expired := p.Expire(time.Now()); len(expired) != 0 {
+		t.Fatalf("Nothing should expire yet, got %d", len(expired))
+	}
+	if expired := p.Expire(time.Now().Add(2 * time.Minute)); len(expired) != 2 {
+		t.Fatalf("Both transactions should expire after the TTL, got %d", len(expired))
+	}
+
+	p.SetConfig(Config{})
+	p.Add(a, 1)
+	p.Add(b, 2)
+	if expired := p.Expire(time.Now().Add(time.Hour)); len(expired) != 0 {
+		t.Errorf("Without a TTL nothing expires, got %d", len(expired))
+	}
+	dropped := p.Filter(func(e *Entry) bool { return e.Fee > 1 })
+	if len(dropped) != 1 || dropped[0].Tx.ID != a.ID || p.Len() != 1 {
+		t.Errorf("Filter should drop only a, got %+v", dropped)
+	}
+}
+
+// spendOf returns a transaction spending output 0 of prev, distinct per payee
+func spendOf(prev, payee string) *transaction.Transaction {
+	tx := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: prev, OutIndex: 0, ScriptSig: "sig"}},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: payee}},
+	)
+	tx.ID = tx.CalculateHash()
+	return tx
+}
+
+func TestConflictingSpendsRefusedOrReplaced(t *testing.T) {
+	p := New(Config{})
+	first := spendOf("prev0", "bob")
+	if _, err := p.Add(first, 100); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// A second spend of the same output paying no more is refused
+	if _, err := p.Add(spendOf("prev0", "carol"), 100); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected ErrConflict, got %v", err)
+	}
+	if conflicts := p.Conflicts(spendOf("prev0", "dave")); len(conflicts) != 1 || conflicts[0].Tx.ID != first.ID {
+		t.Errorf("Expected the first spend as the conflict, got %+v", conflicts)
+	}
+
+	// One paying more than all it conflicts with replaces them
+	other := newTx(1)
+	p.Add(other, 100)
+	both := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{first.Inputs[0], other.Inputs[0]},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: "erin"}},
+	)
+	both.ID = both.CalculateHash()
+	if _, err := p.Add(both, 150); !errors.Is(err, ErrConflict) {
+		t.Errorf("A fee below the conflicts' total should be refused, got %v", err)
+	}
+	if _, err := p.Add(both, 500); err != nil {
+		t.Fatalf("Expected the replacement admitted, got %v", err)
+	}
+	if p.Len() != 1 || !p.Has(both.ID) {
+		t.Errorf("Expected only the replacement pending, got %v", ids(p.Transactions()))
+	}
+	if stats := p.Stats(); stats.Replaced != 2 || stats.Refused != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Once the replacement leaves the pool, its outputs are free to spend again
+	p.Remove([]*transaction.Transaction{both})
+	if _, err := p.Add(spendOf("prev0", "carol"), 1); err != nil {
+		t.Errorf("Expected the output spendable again, got %v", err)
+	}
+}
@@ -293,6 +293,15 @@ func VerifyProofWithRoot(txHash string, merkleRoot string, siblings []string, di
 // ComputeMerkleRoot computes the Merkle root from transaction hashes
 // This is a convenience function for creating blocks
 func ComputeMerkleRoot(txHashes []string) (string, error) {
+	if len(txHashes) == 1 {
+		// A lone leaf is the root; skip building the tree
+		data, err := hex.DecodeString(txHashes[0])
+		if err != nil {
+			data = []byte(txHashes[0])
+		}
+		hash := sha256.Sum256(data)
+		return hex.EncodeToString(hash[:]), nil
+	}
 	tree, err := NewMerkleTreeFromHashes(txHashes)
 	if err != nil {
 		return "", err
@@ -24,6 +24,20 @@ func TestNewMerkleTreeSingleElement(t *testing.T) {
 	}
 }
 
+func TestComputeMerkleRootSingleMatchesTree(t *testing.T) {
+	hash := sha256.Sum256([]byte("coinbase"))
+	for _, id := range []string{hex.EncodeToString(hash[:]), "not-hex"} {
+		root, err := ComputeMerkleRoot([]string{id})
+		if err != nil {
+			t.Fatalf("ComputeMerkleRoot failed: %v", err)
+		}
+		tree, _ := NewMerkleTreeFromHashes([]string{id})
+		if root != tree.GetRootHash() {
+			t.Errorf("Single-leaf root %s should match the tree's %s", root, tree.GetRootHash())
+		}
+	}
+}
+
 func TestNewMerkleTreeTwoElements(t *testing.T) {
 	data := [][]byte{[]byte("tx1"), []byte("tx2")}
 	tree, err := NewMerkleTree(data)
@@ -0,0 +1,164 @@
+// Package monitor detects watched nodes that have fallen behind the network:
+// unreachable nodes, tips lagging the majority height, and stale tips
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Kind classifies an alert
+type Kind string
+
+const (
+	KindDown    Kind = "down"    // Node could not be reached
+	KindLagging Kind = "lagging" // Tip is more than MaxLag blocks behind the majority
+	KindStale   Kind = "stale"   // Latest block is older than MaxTipAge
+)
+
+// NodeStatus is one observation of a watched node
+type NodeStatus struct {
+	Address string
+	Height  int64
+	TipTime time.Time
+	Err     error // Set if the node could not be queried
+}
+
+// Thresholds configure when a node is considered behind. Zero disables a check.
+type Thresholds struct {
+	MaxLag    int64
+	MaxTipAge time.Duration
+}
+
+// Alert describes one node that is behind
+type Alert struct {
+	Kind           Kind      `json:"kind"`
+	Address        string    `json:"address"`
+	Message        string    `json:"message"`
+	Height         int64     `json:"height"`
+	MajorityHeight int64     `json:"majority_height"`
+	Time           time.Time `json:"time"`
+	Resolved       bool      `json:"resolved"` // Set on the notification that the condition cleared
+}
+
+// key identifies an alert condition across polls
+func (a Alert) key() string {
+	return string(a.Kind) + "/" + a.Address
+}
+
+// MajorityHeight returns the height reported by the most reachable nodes,
+// preferring the higher height on a tie. ok is false if no node was reachable.
+func MajorityHeight(statuses []NodeStatus) (height int64, ok bool) {
+	counts := make(map[int64]int)
+	for _, s := range statuses {
+		if s.Err == nil {
+			counts[s.Height]++
+		}
+	}
+	best := -1
+	for h, n := range counts {
+		if n > best || (n == best && h > height) {
+			height, best = h, n
+		}
+	}
+	return height, best > 0
+}
+
+// Evaluate returns the alerts for one round of observations, sorted by address
+func Evaluate(statuses []NodeStatus, th Thresholds, now time.Time) []Alert {
+	majority, _ := MajorityHeight(statuses)
+
+	var alerts []Alert
+	for _, s := range statuses {
+		base := Alert{Address: s.Address, Height: s.Height, MajorityHeight: majority, Time: now}
+		if s.Err != nil {
+			a := base
+			a.Kind, a.Message = KindDown, fmt.Sprintf("%s is unreachable: %v", s.Address, s.Err)
+			alerts = append(alerts, a)
+			continue
+		}
+		if lag := majority - s.Height; th.MaxLag > 0 && lag > th.MaxLag {
+			a := base
+			a.Kind = KindLagging
+			a.Message = fmt.Sprintf("%s is %d blocks behind the majority (height %d vs %d)", s.Address, lag, s.Height, majority)
+			alerts = append(alerts, a)
+		}
+		if age := now.Sub(s.TipTime); th.MaxTipAge > 0 && age > th.MaxTipAge {
+			a := base
+			a.Kind = KindStale
+			a.Message = fmt.Sprintf("%s has not added a block for %s (tip #%d)", s.Address, age.Round(time.Second), s.Height)
+			alerts = append(alerts, a)
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Address < alerts[j].Address })
+	return alerts
+}
+
+// Monitor turns successive evaluations into notifications, so a condition is
+// reported once when it starts and once when it clears
+type Monitor struct {
+	thresholds Thresholds
+	active     map[string]Alert
+}
+
+// New creates a monitor with the given thresholds
+func New(th Thresholds) *Monitor {
+	return &Monitor{thresholds: th, active: make(map[string]Alert)}
+}
+
+// Update evaluates a round of observations and returns the alerts that
+// started and the ones that cleared (with Resolved set) since the last round
+func (m *Monitor) Update(statuses []NodeStatus, now time.Time) (raised, cleared []Alert) {
+	current := make(map[string]Alert)
+	for _, a := range Evaluate(statuses, m.thresholds, now) {
+		current[a.key()] = a
+		if _, ok := m.active[a.key()]; !ok {
+			raised = append(raised, a)
+		}
+	}
+	for key, a := range m.active {
+		if _, ok := current[key]; !ok {
+			a.Resolved, a.Time = true, now
+			a.Message = fmt.Sprintf("%s recovered (%s)", a.Address, a.Kind)
+			cleared = append(cleared, a)
+		}
+	}
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i].key() < cleared[j].key() })
+	m.active = current
+	return raised, cleared
+}
+
+// Active returns the conditions currently alerting
+func (m *Monitor) Active() []Alert {
+	var alerts []Alert
+	for _, a := range m.active {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].key() < alerts[j].key() })
+	return alerts
+}
+
+// webhookTimeout bounds how long a slow webhook can delay the next poll
+const webhookTimeout = 5 * time.Second
+
+// PostWebhook sends an alert as a JSON POST to url
+func PostWebhook(url string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMajorityHeight(t *testing.T) {
+	statuses := []NodeStatus{
+		{Address: "a", Height: 10},
+		{Address: "b", Height: 10},
+		{Address: "c", Height: 12},
+		{Address: "d", Height: 99, Err: errors.New("down")},
+	}
+	if h, ok := MajorityHeight(statuses); !ok || h != 10 {
+		t.Errorf("Expected majority height 10, got %d", h)
+	}
+
+	// Ties go to the higher height
+	if h, _ := MajorityHeight(statuses[1:3]); h != 12 {
+		t.Errorf("Expected tie to resolve to 12, got %d", h)
+	}
+	if _, ok := MajorityHeight(statuses[3:]); ok {
+		t.Error("No reachable node should mean no majority")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	statuses := []NodeStatus{
+		{Address: "a", Height: 20, TipTime: now.Add(-time.Minute)},
+		{Address: "b", Height: 20, TipTime: now.Add(-time.Minute)},
+		{Address: "c", Height: 15, TipTime: now.Add(-time.Hour)},
+		{Address: "d", Err: errors.New("connection refused")},
+	}
+	alerts := Evaluate(statuses, Thresholds{MaxLag: 3, MaxTipAge: 10 * time.Minute}, now)
+	if len(alerts) != 3 {
+		t.Fatalf("Expected lagging and stale alerts for c and down for d, got %+v", alerts)
+	}
+	if alerts[0].Kind != KindLagging || alerts[0].Address != "c" || alerts[0].MajorityHeight != 20 {
+		t.Errorf("Unexpected lag alert: %+v", alerts[0])
+	}
+	if alerts[1].Kind != KindStale || alerts[2].Kind != KindDown {
+		t.Errorf("Unexpected alerts: %+v", alerts)
+	}
+
+	// Zero thresholds disable the checks
+	if alerts := Evaluate(statuses[:3], Thresholds{}, now); len(alerts) != 0 {
+		t.Errorf("Expected no alerts with checks disabled, got %+v", alerts)
+	}
+}
+
+func TestMonitorReportsTransitionsOnce(t *testing.T) {
+	m := New(Thresholds{MaxLag: 2})
+	now := time.Now()
+	behind := []NodeStatus{{Address: "a", Height: 10}, {Address: "b", Height: 10}, {Address: "c", Height: 5}}
+
+	raised, cleared := m.Update(behind, now)
+	if len(raised) != 1 || raised[0].Address != "c" || len(cleared) != 0 {
+		t.Fatalf("Expected c to start lagging, got %+v %+v", raised, cleared)
+	}
+	if raised, _ := m.Update(behind, now); len(raised) != 0 {
+		t.Error("An ongoing condition should not be reported again")
+	}
+	if len(m.Active()) != 1 {
+		t.Error("The lag should still be active")
+	}
+
+	behind[2].Height = 10
+	raised, cleared = m.Update(behind, now)
+	if len(raised) != 0 || len(cleared) != 1 || !cleared[0].Resolved {
+		t.Errorf("Expected c to recover, got %+v %+v", raised, cleared)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var got Alert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	if err := PostWebhook(srv.URL, Alert{Kind: KindDown, Address: "a"}); err != nil {
+		t.Fatalf("Webhook failed: %v", err)
+	}
+	if got.Kind != KindDown || got.Address != "a" {
+		t.Errorf("Unexpected webhook payload: %+v", got)
+	}
+}
@@ -0,0 +1,164 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/logging"
+	"crypto/tls"
+	"fmt"
+	"net/rpc"
+	"sync"
+)
+
+// AuthArgs presents an API token, or a request signed by a registered key, for
+// the rest of the connection
+type AuthArgs struct {
+	Token  string
+	Signed *access.Signed // Used instead of Token when set
+}
+
+// authScope is the scope signed to authenticate an RPC connection
+const authScope = "RPCService.Authenticate"
+
+// Credentials identify a caller to miners that restrict access: an API token,
+// or a hex private key whose public key the miner's policy lists. A key is
+// never sent; each connection presents a fresh signature instead. With TLS
+// set, miners are dialed over TLS, and a client certificate in it
+// authenticates the connection too.
+type Credentials struct {
+	Token      string
+	SigningKey string
+	TLS        *tls.Config // If set, miners are dialed over TLS (see LoadTLSConfig)
+}
+
+// AuthReply reports the role the connection now has
+type AuthReply struct {
+	Success bool
+	Role    access.Role
+	Groups  []access.Group
+	Error   string
+}
+
+// WithAccessPolicy restricts RPC methods by role. Connections start with the
+// policy's anonymous role and may call Authenticate to take a token's role.
+// Peer gossip and chain sync stay open to every connection.
+func WithAccessPolicy(p *access.Policy) MinerOption {
+	return func(o *MinerOptions) {
+		o.Access = p
+	}
+}
+
+// session holds the role of one RPC connection
+type session struct {
+	mu     sync.RWMutex
+	role   access.Role
+	caller string // Identity of the token presented; "" until authenticated
+}
+
+// newSession returns the session for a new connection, or nil if the miner
+// has no access policy
+func (m *Miner) newSession() *session {
+	if m.options.Access == nil {
+		return nil
+	}
+	return &session{role: m.options.Access.Anonymous()}
+}
+
+func (s *session) currentRole() access.Role {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.role
+}
+
+// identity returns the connection's role and caller
+func (s *session) identity() (access.Role, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.role, s.caller
+}
+
+// authorize returns why the connection's role may not call method, or nil
+func (s *session) authorize(method string) error {
+	return access.Allowed(s.currentRole(), method)
+}
+
+// Authenticate RPC method to switch the connection to the role of an API token
+func (s *RPCService) Authenticate(args *AuthArgs, reply *AuthReply) error {
+	if s.session == nil {
+		// No access policy (or an in-process call): every method is allowed
+		reply.Success = true
+		reply.Role = access.RoleAdmin
+		reply.Groups = access.Groups(access.RoleAdmin)
+		return nil
+	}
+	var role access.Role
+	var caller string
+	var err error
+	if args.Signed != nil {
+		caller = access.KeyID(args.Signed.PublicKey)
+		role, err = s.miner.options.Access.AuthenticateSigned(*args.Signed, authScope)
+	} else {
+		caller = access.TokenID(args.Token)
+		role, err = s.miner.options.Access.Authenticate(args.Token)
+	}
+	if err != nil {
+		logging.Warnf("[%s] ACCESS: rejected %s from %s: %v", shortID(s.miner.ID), caller, s.peer, err)
+		reply.Error = err.Error()
+		return nil
+	}
+
+	s.session.mu.Lock()
+	s.session.role = role
+	s.session.caller = caller
+	s.session.mu.Unlock()
+
+	reply.Success = true
+	reply.Role = role
+	reply.Groups = access.Groups(role)
+	return nil
+}
+
+// DialMiner connects to a miner's RPC server and authenticates the connection
+// with cred, if it has any
+func DialMiner(address string, cred Credentials) (*rpc.Client, error) {
+	if cred.TLS != nil {
+		return dialMiner(TLSTransport{Config: cred.TLS}, address, cred)
+	}
+	return dialMiner(TCPTransport{}, address, cred)
+}
+
+func dialMiner(t Transport, address string, cred Credentials) (*rpc.Client, error) {
+	conn, err := t.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	client := rpc.NewClient(conn)
+	if err := AuthenticateClient(client, cred); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// AuthenticateClient presents cred on an open connection, preferring the
+// signing key; empty credentials keep the anonymous role
+func AuthenticateClient(client *rpc.Client, cred Credentials) error {
+	args := &AuthArgs{Token: cred.Token}
+	switch {
+	case cred.SigningKey != "":
+		signed, err := access.Sign(cred.SigningKey, authScope)
+		if err != nil {
+			return err
+		}
+		args = &AuthArgs{Signed: &signed}
+	case cred.Token == "":
+		return nil
+	}
+	var reply AuthReply
+	if err := client.Call("RPCService.Authenticate", args, &reply); err != nil {
+		return err
+	}
+	if !reply.Success {
+		return fmt.Errorf("authentication failed: %s", reply.Error)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/audit"
+	"blockchain/pkg/transaction"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEveryRPCMethodHasAccessGroup(t *testing.T) {
+	typ := reflect.TypeOf(&RPCService{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		name := typ.Method(i).Name
+		if _, ok := access.MethodGroup(name); !ok {
+			t.Errorf("RPCService.%s has no access group; add it to the access package", name)
+		}
+	}
+}
+
+func TestAccessPolicyRestrictsByRole(t *testing.T) {
+	policy := access.NewPolicy(access.RoleObserver)
+	policy.SetToken("op-token", access.RoleOperator)
+	miner := NewMiner("miner1", "localhost:19100", 2, nil, WithAccessPolicy(policy))
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	// Anonymous connections can read but not control mining
+	anon, err := DialMiner("localhost:19100", Credentials{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer anon.Close()
+	var status StatusReply
+	if err := anon.Call("RPCService.GetStatus", &struct{}{}, &status); err != nil {
+		t.Errorf("Observer should be able to read status: %v", err)
+	}
+	var mining MiningReply
+	err = anon.Call("RPCService.SetMining", &MiningArgs{Enabled: true}, &mining)
+	if err == nil || !strings.Contains(err.Error(), access.ErrAccessDenied.Error()) {
+		t.Fatalf("Observer should be denied SetMining, got %v", err)
+	}
+	if miner.IsMining() {
+		t.Fatal("Denied call must not start mining")
+	}
+	// The connection stays usable after a refusal
+	if err := anon.Call("RPCService.GetStatus", &struct{}{}, &status); err != nil {
+		t.Errorf("Connection should survive a denied call: %v", err)
+	}
+
+	if _, err := DialMiner("localhost:19100", Credentials{Token: "wrong-token"}); err == nil {
+		t.Error("Unknown token should fail to authenticate")
+	}
+
+	op, err := DialMiner("localhost:19100", Credentials{Token: "op-token"})
+	if err != nil {
+		t.Fatalf("Failed to authenticate operator: %v", err)
+	}
+	defer op.Close()
+	if err := op.Call("RPCService.SetMining", &MiningArgs{Enabled: true}, &mining); err != nil || !mining.Mining {
+		t.Fatalf("Operator should start mining, got %+v, %v", mining, err)
+	}
+	op.Call("RPCService.SetMining", &MiningArgs{Enabled: false}, &mining)
+
+	var peers PeersReply
+	err = op.Call("RPCService.UpdatePeers", &PeersArgs{Add: []PeerInfo{{ID: "p", Address: "localhost:19101"}}}, &peers)
+	if err != nil || len(peers.Peers) != 1 {
+		t.Errorf("Operator should add a peer, got %+v, %v", peers, err)
+	}
+	var bl BlacklistReply
+	err = op.Call("RPCService.UpdateBlacklist", &BlacklistArgs{}, &bl)
+	if err == nil || !strings.Contains(err.Error(), access.ErrAccessDenied.Error()) {
+		t.Errorf("Operator should be denied policy changes, got %v", err)
+	}
+}
+
+func TestAccessPolicyKeepsPeerProtocolOpen(t *testing.T) {
+	peer := NewMiner("peer", "localhost:19102", 1, nil, WithAccessPolicy(access.NewPolicy(access.RoleNone)))
+	peer.mineBlock()
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer peer.Stop()
+
+	honest := NewMiner("honest", "localhost:0", 1, nil)
+	if err := honest.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19102"}); err != nil {
+		t.Fatalf("Chain sync should not need a token: %v", err)
+	}
+	if honest.Blockchain.GetLength() != 2 {
+		t.Errorf("Expected to sync 2 blocks, got %d", honest.Blockchain.GetLength())
+	}
+
+	_, err := NewClient("client", nil).GetMinerStatus("localhost:19102")
+	if err == nil {
+		t.Error("Role none should not be able to read status")
+	}
+}
+
+func TestAuditLogRecordsAuthenticatedChanges(t *testing.T) {
+	policy := access.NewPolicy(access.RoleOperator)
+	policy.SetToken("op-token", access.RoleOperator)
+	policy.SetToken("admin-token", access.RoleAdmin)
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	miner := NewMiner("miner1", "localhost:19103", 2, nil,
+		WithAccessPolicy(policy), WithAuditLog(auditLog))
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	// Anonymous calls are not audited, nor are reads
+	anon, err := DialMiner("localhost:19103", Credentials{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer anon.Close()
+	var peers PeersReply
+	anon.Call("RPCService.UpdatePeers", &PeersArgs{Remove: []string{"nowhere"}}, &peers)
+
+	op, err := DialMiner("localhost:19103", Credentials{Token: "op-token"})
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	defer op.Close()
+	op.Call("RPCService.GetPeers", &struct{}{}, &peers)
+	op.Call("RPCService.UpdatePeers", &PeersArgs{Add: []PeerInfo{{ID: "p", Address: "localhost:19104"}}}, &peers)
+	var bl BlacklistReply
+	op.Call("RPCService.UpdateBlacklist", &BlacklistArgs{}, &bl)
+	var tx TransactionReply
+	op.Call("RPCService.SubmitTransaction", &TransactionArgs{}, &tx)
+
+	var reply AuditQueryReply
+	if err := op.Call("RPCService.GetAuditLog", &AuditQueryArgs{}, &reply); err == nil {
+		t.Error("Operator should not be able to read the audit log")
+	}
+	admin, err := DialMiner("localhost:19103", Credentials{Token: "admin-token"})
+	if err != nil {
+		t.Fatalf("Failed to authenticate admin: %v", err)
+	}
+	defer admin.Close()
+	if err := admin.Call("RPCService.GetAuditLog", &AuditQueryArgs{}, &reply); err != nil || !reply.Success {
+		t.Fatalf("Admin should read the audit log: %+v, %v", reply, err)
+	}
+
+	want := []struct {
+		method  string
+		outcome audit.Outcome
+	}{
+		{"RPCService.UpdatePeers", audit.OutcomeOK},
+		{"RPCService.UpdateBlacklist", audit.OutcomeDenied},
+		{"RPCService.SubmitTransaction", audit.OutcomeFailed},
+	}
+	if len(reply.Entries) != len(want) {
+		t.Fatalf("Expected %d audit entries, got %+v", len(want), reply.Entries)
+	}
+	for i, w := range want {
+		e := reply.Entries[i]
+		if e.Method != w.method || e.Outcome != w.outcome {
+			t.Errorf("Entry %d: expected %s %s, got %s %s", i, w.method, w.outcome, e.Method, e.Outcome)
+		}
+		if e.Caller != access.TokenID("op-token") || e.Role != string(access.RoleOperator) || e.ParamsDigest == "" {
+			t.Errorf("Entry %d should identify the operator and digest its parameters: %+v", i, e)
+		}
+	}
+}
+
+func TestSignedAuthentication(t *testing.T) {
+	bot, _ := transaction.GenerateKeyPair()
+	policy := access.NewPolicy(access.RoleNone)
+	policy.SetKey(bot.GetPublicKeyHex(), access.RoleOperator)
+	miner := NewMiner("miner1", "localhost:19105", 2, nil, WithAccessPolicy(policy))
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	op, err := DialMiner("localhost:19105", Credentials{SigningKey: bot.GetPrivateKeyHex()})
+	if err != nil {
+		t.Fatalf("Signed authentication failed: %v", err)
+	}
+	defer op.Close()
+	var mining MiningReply
+	if err := op.Call("RPCService.SetMining", &MiningArgs{Enabled: false}, &mining); err != nil {
+		t.Errorf("Signed operator should control mining: %v", err)
+	}
+
+	// A captured authentication cannot be replayed on another connection
+	signed, _ := access.Sign(bot.GetPrivateKeyHex(), authScope)
+	var reply AuthReply
+	op.Call("RPCService.Authenticate", &AuthArgs{Signed: &signed}, &reply)
+	other, err := DialMiner("localhost:19105", Credentials{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer other.Close()
+	reply = AuthReply{}
+	other.Call("RPCService.Authenticate", &AuthArgs{Signed: &signed}, &reply)
+	if reply.Success || !strings.Contains(reply.Error, access.ErrReplayedNonce.Error()) {
+		t.Errorf("Replayed signature should be rejected, got %+v", reply)
+	}
+
+	stranger, _ := transaction.GenerateKeyPair()
+	if _, err := DialMiner("localhost:19105", Credentials{SigningKey: stranger.GetPrivateKeyHex()}); err == nil {
+		t.Error("Unregistered key should fail to authenticate")
+	}
+}
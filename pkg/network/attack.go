@@ -0,0 +1,506 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// fakeLengthInflation is how far past its real tip a fake_length miner claims to be
+	fakeLengthInflation = 1000000
+
+	// fakeLengthBlocks is how many forged blocks a fake_length miner appends to
+	// chain replies, so peers that trust the claim have something to download
+	fakeLengthBlocks = 1000
+
+	// oversizedPayloadBytes is the padding an oversized miner puts in each pushed block
+	oversizedPayloadBytes = 32 << 20
+
+	// oversizedNestingDepth is how deeply an oversized miner nests its fake
+	// transactions; small enough to pass a size check, so only depth stops it
+	oversizedNestingDepth = 100000
+
+	// floodFanOut is how many outputs a tx_flood miner splits a coinbase into,
+	// each of which then funds one flood transaction
+	floodFanOut = 1000
+
+	// floodFee is what each flood transaction pays: valid, but barely a fee
+	floodFee = 1
+
+	// lowDifficultyClaim is the difficulty a low_difficulty miner writes into
+	// its blocks, whatever the network requires
+	lowDifficultyClaim = 1
+
+	// inflationFactor is how many block subsidies a coinbase_inflation miner
+	// pays itself per block
+	inflationFactor = 100
+
+	// lowDifficultyBlocks is how many cheap blocks a low_difficulty miner
+	// appends to chain replies to outgrow honest chains
+	lowDifficultyBlocks = 100
+
+	// futureTimestampSkew is how far ahead of its clock a future_timestamp
+	// miner dates its blocks, far past any sane clock drift allowance
+	futureTimestampSkew = 24 * time.Hour
+
+	// conflictFee is what the transactions a double_spend or duplicate_tx
+	// miner slips into its blocks pay
+	conflictFee = 1
+)
+
+// inflateChainReply implements the fake_length attack: the reply advertises a
+// chain far longer than the miner has, padded with forged blocks that link by
+// hash but were never mined
+func (m *Miner) inflateChainReply(reply *ChainReply) {
+	tip := m.Blockchain.GetLatestBlock()
+	for _, b := range forgeBlocks(tip, fakeLengthBlocks, m.ID) {
+		data, err := b.Serialize()
+		if err != nil {
+			return
+		}
+		reply.Blocks = append(reply.Blocks, data)
+	}
+	reply.Length += fakeLengthInflation
+	log.Printf("[MALICIOUS %s] Advertising fake chain length %d (%d forged blocks)",
+		shortID(m.ID), reply.Length, fakeLengthBlocks)
+}
+
+// forgeBlocks builds n blocks on top of tip without doing any proof of work
+func forgeBlocks(tip *block.Block, n int, minerID string) []*block.Block {
+	blocks := make([]*block.Block, 0, n)
+	prev := tip
+	for i := 0; i < n; i++ {
+		height := prev.Index + 1
+		coinbase := transaction.NewCoinbaseTransaction(minerID, 0, height)
+		b := block.NewBlock(height, []*transaction.Transaction{coinbase}, prev.Hash, prev.Difficulty, minerID,
+			block.WithMerkleTree(prev.UsesMerkleTree()), block.WithPowAlgorithm(prev.PowAlgorithm))
+		b.Hash = b.CalculateHash()
+		blocks = append(blocks, b)
+		prev = b
+	}
+	return blocks
+}
+
+// extendWithCheapBlocks implements the sync half of the low_difficulty attack:
+// the reply carries a longer chain of blocks that really meet their proof of
+// work, but only for the difficulty they claim
+func (m *Miner) extendWithCheapBlocks(reply *ChainReply) {
+	tip := m.Blockchain.GetLatestBlock()
+	for _, b := range grindBlocks(tip, lowDifficultyBlocks, m.ID, lowDifficultyClaim) {
+		data, err := b.Serialize()
+		if err != nil {
+			return
+		}
+		reply.Blocks = append(reply.Blocks, data)
+	}
+	reply.Length += lowDifficultyBlocks
+	log.Printf("[MALICIOUS %s] Serving %d blocks claiming difficulty %d",
+		shortID(m.ID), lowDifficultyBlocks, lowDifficultyClaim)
+}
+
+// grindBlocks mines n blocks on top of tip, each to the given difficulty
+func grindBlocks(tip *block.Block, n int, minerID string, difficulty int) []*block.Block {
+	blocks := forgeBlocks(tip, n, minerID)
+	prevHash := tip.Hash
+	for _, b := range blocks {
+		b.PrevHash = prevHash
+		b.Difficulty = difficulty
+		pow.NewProofOfWork(b).Mine(context.TODO(), nil)
+		prevHash = b.Hash
+	}
+	return blocks
+}
+
+// nextInflatedBlock returns the next block of the coinbase_inflation miner's
+// private branch, unmined. Each block's coinbase claims inflationFactor
+// subsidies; everything else about it is valid, so only economic validation
+// can refuse it.
+func (m *Miner) nextInflatedBlock() *block.Block {
+	return m.nextBranchBlock(func(int64) int64 { return inflationFactor * blockchain.BaseSubsidy })
+}
+
+// nextBranchBlock returns the next block of the miner's private branch,
+// unmined, with a coinbase paying reward(height). The branch forks from the
+// public tip when it starts.
+func (m *Miner) nextBranchBlock(reward func(height int64) int64) *block.Block {
+	m.branchMutex.Lock()
+	defer m.branchMutex.Unlock()
+	prev := m.Blockchain.GetLatestBlock()
+	if n := len(m.privateBranch); n > 0 {
+		prev = m.privateBranch[n-1]
+	}
+	height := prev.Index + 1
+	coinbase := transaction.NewCoinbaseTransaction(m.PayoutAddress(height), reward(height), height)
+	return block.NewBlock(height, []*transaction.Transaction{coinbase}, prev.Hash,
+		m.Blockchain.RequiredDifficulty(height), m.ID, block.WithMerkleTree(prev.UsesMerkleTree()),
+		block.WithPowAlgorithm(m.Blockchain.ContextAt(height).PowAlgorithm))
+}
+
+// extendPrivateBranch withholds a mined inflated block until the branch is
+// longer than the public chain, then announces the branch tip so peers sync it
+func (m *Miner) extendPrivateBranch(b *block.Block) {
+	m.branchMutex.Lock()
+	m.privateBranch = append(m.privateBranch, b)
+	length := len(m.privateBranch)
+	m.branchMutex.Unlock()
+
+	if b.Index <= m.Blockchain.GetLatestBlock().Index {
+		log.Printf("[MALICIOUS %s] Withholding inflated block #%d (%d on private branch)", shortID(m.ID), b.Index, length)
+		return
+	}
+	log.Printf("[MALICIOUS %s] Publishing private branch of %d blocks, tip #%d", shortID(m.ID), length, b.Index)
+	m.BroadcastBlock(b)
+}
+
+// servePrivateBranch replaces a chain reply from start with the public chain
+// up to the fork followed by the private branch, once the branch is the longer
+// of the two
+func (m *Miner) servePrivateBranch(reply *ChainReply, start int64) {
+	m.branchMutex.Lock()
+	branch := append([]*block.Block(nil), m.privateBranch...)
+	m.branchMutex.Unlock()
+	if len(branch) == 0 || int(branch[len(branch)-1].Index) < reply.Length {
+		return
+	}
+
+	public := m.Blockchain.GetBlocks()
+	if int(branch[0].Index) > len(public) {
+		return // The public chain reorganized below the fork
+	}
+	blocks := append(public[:branch[0].Index], branch...)
+	reply.Length = len(blocks)
+	blocks = blocks[min(max(start, 0), int64(len(blocks))):]
+	reply.Blocks = make([][]byte, len(blocks))
+	for i, b := range blocks {
+		data, err := b.Serialize()
+		if err != nil {
+			return
+		}
+		reply.Blocks[i] = data
+	}
+}
+
+// withholdBlock implements the selfish attack: a block the miner found is kept
+// on its private branch instead of being announced
+func (m *Miner) withholdBlock(b *block.Block) {
+	m.branchMutex.Lock()
+	m.privateBranch = append(m.privateBranch, b)
+	length := len(m.privateBranch)
+	m.branchMutex.Unlock()
+	log.Printf("[MALICIOUS %s] Withholding block #%d (%d on private branch, public tip #%d)",
+		shortID(m.ID), b.Index, length, m.Blockchain.GetLatestBlock().Index)
+}
+
+// releaseSelfishBranch publishes a selfish miner's private branch once the
+// honest chain has grown past the fork and come within one block of it: a
+// lead of one wins outright, and a tie splits the honest miners' work. A
+// branch the honest chain has overtaken is abandoned. The miner adopts the
+// branch itself before announcing it block by block, and mines on the public
+// tip from then on.
+func (m *Miner) releaseSelfishBranch() {
+	m.branchMutex.Lock()
+	branch := m.privateBranch
+	tip := m.Blockchain.GetLatestBlock()
+	if len(branch) == 0 || tip.Index < branch[0].Index || branch[len(branch)-1].Index-tip.Index > 1 {
+		m.branchMutex.Unlock()
+		return
+	}
+	m.privateBranch = nil
+	m.branchMutex.Unlock()
+
+	last := branch[len(branch)-1]
+	if tip.Index > last.Index {
+		log.Printf("[MALICIOUS %s] Abandoning private branch of %d blocks, overtaken at #%d",
+			shortID(m.ID), len(branch), tip.Index)
+		return
+	}
+	log.Printf("[MALICIOUS %s] Releasing private branch of %d blocks, tip #%d against public #%d",
+		shortID(m.ID), len(branch), last.Index, tip.Index)
+	for _, b := range branch {
+		if _, _, err := m.Blockchain.ProcessBlock(b); err != nil {
+			log.Printf("[MALICIOUS %s] Own chain refused withheld block #%d: %v", shortID(m.ID), b.Index, err)
+		}
+	}
+	for _, b := range branch {
+		m.BroadcastBlock(b)
+	}
+}
+
+// injectFault corrupts the contents of b, a block not yet mined, the way the
+// miner's type asks. The proof of work sealed afterwards is valid, so only
+// validating the block's transactions or timestamp can refuse it. Returns
+// false, leaving b alone, if the miner has nothing to inject yet: double_spend
+// and duplicate_tx need an output of their own to spend first.
+func (m *Miner) injectFault(b *block.Block) bool {
+	switch m.maliciousType {
+	case "excess_coinbase":
+		// Pay the coinbase many subsidies
+		b.Transactions[0] = transaction.NewCoinbaseTransaction(m.PayoutAddress(b.Index),
+			inflationFactor*m.Blockchain.Params().SubsidyAt(b.Index), b.Index)
+	case "missing_coinbase":
+		b.Transactions = b.Transactions[1:]
+	case "duplicate_tx":
+		var tx *transaction.Transaction
+		if len(b.Transactions) > 1 {
+			tx = b.Transactions[1]
+		} else if spends := m.conflictingSpends(); spends != nil {
+			tx = spends[0]
+		}
+		if tx == nil {
+			return false
+		}
+		b.Transactions = append(b.Transactions, tx, tx)
+	case "double_spend":
+		spends := m.conflictingSpends()
+		if spends == nil {
+			return false
+		}
+		b.Transactions = append(b.Transactions, spends...)
+	case "future_timestamp":
+		b.Timestamp = time.Now().Add(futureTimestampSkew).UnixNano()
+	default:
+		return false
+	}
+	if b.UsesMerkleTree() {
+		b.MerkleRoot = b.CalculateMerkleRoot()
+	}
+	return true
+}
+
+// conflictingSpends returns two signed transactions spending the same output
+// the miner owns, paying different amounts so their IDs differ, or nil if it
+// owns none yet
+func (m *Miner) conflictingSpends() []*transaction.Transaction {
+	utxoSet := m.Blockchain.GetUTXOSet()
+	keys := m.floodKeys()
+	for _, utxo := range utxoSet.GetAllUTXOs() {
+		kp := keys[utxo.ScriptPubKey]
+		if kp == nil || utxo.Value <= 2*conflictFee {
+			continue
+		}
+		first := spendUTXO(utxoSet, utxo, kp, []transaction.TxOutput{{Value: utxo.Value - conflictFee, ScriptPubKey: utxo.ScriptPubKey}})
+		second := spendUTXO(utxoSet, utxo, kp, []transaction.TxOutput{{Value: utxo.Value - 2*conflictFee, ScriptPubKey: utxo.ScriptPubKey}})
+		if first != nil && second != nil {
+			return []*transaction.Transaction{first, second}
+		}
+	}
+	return nil
+}
+
+// sendOversizedPayloads implements the oversized attack: every peer is pushed a
+// block padded to tens of megabytes and a "transaction" that is nothing but
+// deeply nested JSON. The requests are encoded once and written straight to
+// the connection, so the attacker doesn't wait for peers to reply.
+func (m *Miner) sendOversizedPayloads() {
+	blockReq, err := encodeRPCRequest("RPCService.ReceiveBlock", &BlockArgs{
+		BlockData: oversizedBlockPayload(m.Blockchain.GetLatestBlock(), m.ID, oversizedPayloadBytes),
+	})
+	if err != nil {
+		return
+	}
+	txReq, err := encodeRPCRequest("RPCService.ReceiveTransaction", &BlockArgs{
+		BlockData: nestedJSONPayload(oversizedNestingDepth),
+	})
+	if err != nil {
+		return
+	}
+	peers := m.GetPeers()
+	log.Printf("[MALICIOUS %s] Sending %d byte block and %d-deep transaction to %d peers",
+		shortID(m.ID), len(blockReq), oversizedNestingDepth, len(peers))
+	for _, peer := range peers {
+		go sendRawRequest(peer.Address, blockReq)
+		go sendRawRequest(peer.Address, txReq)
+	}
+}
+
+// oversizedBlockPayload serializes a block on top of tip whose coinbase script
+// is padded to size bytes
+func oversizedBlockPayload(tip *block.Block, minerID string, size int) []byte {
+	b := forgeBlocks(tip, 1, minerID)[0]
+	b.Transactions[0].Outputs[0].ScriptPubKey = strings.Repeat("x", size) // Not hex, which would pack to half
+	data, err := b.Serialize()
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// nestedJSONPayload returns depth nested arrays inside a transaction's Inputs
+func nestedJSONPayload(depth int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(2*depth + 16)
+	buf.WriteString(`{"Inputs":`)
+	for i := 0; i < depth; i++ {
+		buf.WriteByte('[')
+	}
+	for i := 0; i < depth; i++ {
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// encodeRPCRequest encodes a complete net/rpc request as it appears on the wire
+func encodeRPCRequest(method string, args any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(&rpc.Request{ServiceMethod: method}); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(args); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendRawRequest writes an encoded request to address and drains the reply
+// until the peer answers or hangs up
+func sendRawRequest(address string, req []byte) error {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	// A reply (or the peer closing) ends the exchange
+	_, err = io.ReadAtLeast(conn, make([]byte, 1), 1)
+	return err
+}
+
+// floodTransactions implements the tx_flood attack. The miner pays its
+// coinbases to its own keys, splits one into floodFanOut outputs (mined into
+// its next block), and floods every peer with one minimum-fee transaction per
+// output it owns. Each transaction is individually valid, so only mempool
+// caps, fee escalation, and per-peer rate limits stand in the way.
+func (m *Miner) floodTransactions() {
+	split, flood := buildFlood(m.Blockchain.GetUTXOSet(), m.floodKeys(), floodFanOut, floodFee)
+	if split != nil {
+		m.AddTransaction(split)
+	}
+	if len(flood) == 0 {
+		return
+	}
+	peers := m.GetPeers()
+	log.Printf("[MALICIOUS %s] Flooding %d peers with %d transactions", shortID(m.ID), len(peers), len(flood))
+	for _, peer := range peers {
+		go func(address string) {
+			result, err := floodPeer(address, flood)
+			if err != nil {
+				return
+			}
+			log.Printf("[MALICIOUS %s] Flood of %s: %d accepted, rejected %v", shortID(m.ID), address, result.accepted, result.rejected)
+		}(peer.Address)
+	}
+}
+
+// floodKeys returns the miner's payout keys for every height of its chain
+func (m *Miner) floodKeys() map[string]*transaction.KeyPair {
+	keys := make(map[string]*transaction.KeyPair)
+	if m.options.PayoutWallet == nil {
+		return keys
+	}
+	tip := m.Blockchain.GetLatestBlock().Index
+	for h := int64(1); h <= tip; h++ {
+		kp := m.options.PayoutWallet.DeriveKey(uint32(h))
+		keys[kp.GetPublicKeyHex()] = kp
+	}
+	return keys
+}
+
+// buildFlood spends every UTXO owned by keys in its own fee-paying transaction.
+// If there are fewer than fanOut, the largest is instead split into fanOut
+// outputs to fund the next round.
+func buildFlood(utxoSet *transaction.UTXOSet, keys map[string]*transaction.KeyPair, fanOut int, fee int64) (split *transaction.Transaction, flood []*transaction.Transaction) {
+	var owned []*transaction.UTXO
+	for _, utxo := range utxoSet.GetAllUTXOs() {
+		if keys[utxo.ScriptPubKey] != nil && utxo.Value > fee {
+			owned = append(owned, utxo)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].Value > owned[j].Value })
+
+	if len(owned) > 0 && len(owned) < fanOut && owned[0].Value >= int64(fanOut)*(fee+1) {
+		largest := owned[0]
+		owned = owned[1:]
+		outputs := make([]transaction.TxOutput, fanOut)
+		for i := range outputs {
+			outputs[i] = transaction.TxOutput{Value: largest.Value / int64(fanOut), ScriptPubKey: largest.ScriptPubKey}
+		}
+		outputs[0].Value += largest.Value % int64(fanOut)
+		split = spendUTXO(utxoSet, largest, keys[largest.ScriptPubKey], outputs)
+	}
+
+	for _, utxo := range owned {
+		outputs := []transaction.TxOutput{{Value: utxo.Value - fee, ScriptPubKey: utxo.ScriptPubKey}}
+		if tx := spendUTXO(utxoSet, utxo, keys[utxo.ScriptPubKey], outputs); tx != nil {
+			flood = append(flood, tx)
+		}
+	}
+	return split, flood
+}
+
+// spendUTXO signs a transaction spending a single UTXO
+func spendUTXO(utxoSet *transaction.UTXOSet, utxo *transaction.UTXO, kp *transaction.KeyPair, outputs []transaction.TxOutput) *transaction.Transaction {
+	tx, err := utxoSet.CreateTransaction(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: utxo.TxID, OutIndex: utxo.OutIndex}},
+		outputs,
+		map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		return nil
+	}
+	return tx
+}
+
+// floodResult tallies a peer's answers to a flood
+type floodResult struct {
+	accepted int
+	rejected map[string]int // Rejection reason -> count
+}
+
+// floodPeer relays txs to a peer over a single connection as fast as it answers
+func floodPeer(address string, txs []*transaction.Transaction) (*floodResult, error) {
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	result := &floodResult{rejected: make(map[string]int)}
+	for _, tx := range txs {
+		data, err := tx.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		var reply TransactionReply
+		if err := client.Call("RPCService.ReceiveTransaction", &BlockArgs{BlockData: data}, &reply); err != nil {
+			return result, err
+		}
+		if reply.Success {
+			result.accepted++
+		} else {
+			// Tally by reason, dropping per-transaction details
+			reason, _, _ := strings.Cut(reply.Error, ":")
+			result.rejected[reason]++
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,408 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/transaction"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncRejectsFakeChainLength(t *testing.T) {
+	attacker := NewMaliciousMiner("attacker", "localhost:19090", 2, nil, "fake_length")
+	if err := attacker.Start(); err != nil {
+		t.Fatalf("Failed to start attacker: %v", err)
+	}
+	defer attacker.Stop()
+	attacker.mineBlock()
+
+	honest := NewMiner("honest", "localhost:0", 2, nil)
+	honest.mineBlock()
+	honest.mineBlock()
+	tip := honest.Blockchain.GetLatestBlock().Hash
+
+	err := honest.SyncWithPeer(PeerInfo{ID: "attacker", Address: "localhost:19090"})
+	if !errors.Is(err, ErrInvalidPeerChain) || !strings.Contains(err.Error(), "advertised length") {
+		t.Fatalf("Expected the inflated length claim to be rejected, got %v", err)
+	}
+	if honest.Blockchain.GetLength() != 3 || honest.Blockchain.GetLatestBlock().Hash != tip {
+		t.Error("The honest chain should be unchanged")
+	}
+}
+
+func TestSyncRejectsForgedBlocksBeforeFullValidation(t *testing.T) {
+	// A longer chain whose length claim is consistent but whose tail was never mined
+	attacker := NewMiner("attacker", "localhost:19091", 2, nil)
+	attacker.mineBlock()
+	blocks := attacker.Blockchain.GetBlocks()
+	for _, b := range forgeBlocks(blocks[len(blocks)-1], 50, "attacker") {
+		// Make sure the forgery fails PoW even at this low difficulty
+		b.Hash = "ff" + b.Hash[2:]
+		blocks = append(blocks, b)
+	}
+	attacker.Blockchain = blockchain.NewBlockchainFromBlocks(blocks, 2)
+	if err := attacker.Start(); err != nil {
+		t.Fatalf("Failed to start attacker: %v", err)
+	}
+	defer attacker.Stop()
+
+	honest := NewMiner("honest", "localhost:0", 2, nil)
+	honest.mineBlock()
+
+	err := honest.SyncWithPeer(PeerInfo{ID: "attacker", Address: "localhost:19091"})
+	if !errors.Is(err, ErrInvalidPeerChain) || !strings.Contains(err.Error(), "block #2") {
+		t.Fatalf("Expected the first forged block to be rejected, got %v", err)
+	}
+	if honest.Blockchain.GetLength() != 2 {
+		t.Errorf("The honest chain should be unchanged, got length %d", honest.Blockchain.GetLength())
+	}
+}
+
+func TestTxFloodHeldByRelayDefenses(t *testing.T) {
+	// Fund the attacker: block 1 pays it, block 2's flood round splits that
+	// coinbase, and block 3 confirms the split
+	attacker := NewMaliciousMiner("attacker", "localhost:0", 1, nil, "tx_flood")
+	for i := 0; i < 3; i++ {
+		attacker.mineBlock()
+	}
+	_, flood := buildFlood(attacker.Blockchain.GetUTXOSet(), attacker.floodKeys(), floodFanOut, floodFee)
+	if len(flood) < floodFanOut {
+		t.Fatalf("Expected at least %d funded flood transactions, got %d", floodFanOut, len(flood))
+	}
+	// Hold one UTXO back for an honest, well-paying spend after the flood
+	reserved := flood[len(flood)-1]
+	flood = flood[:len(flood)-1]
+
+	const rate, burst, poolTxs = 100, 200, 50
+	honest := NewMiner("honest", "localhost:19094", 1, nil, WithRelayLimits(RelayLimits{
+		TxRate:             rate,
+		TxBurst:            burst,
+		IncrementalFeeRate: DefaultIncrementalFeeRate,
+	}))
+	honest.Blockchain = blockchain.NewBlockchainFromBlocks(attacker.Blockchain.GetBlocks(), 1)
+	budget := int64(poolTxs) * mempool.Size(flood[0])
+	honest.SetMempoolConfig(mempool.Config{MaxBytes: budget})
+	if err := honest.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer honest.Stop()
+
+	started := time.Now()
+	result, err := floodPeer("localhost:19094", flood)
+	elapsed := time.Since(started)
+	if err != nil {
+		t.Fatalf("Flood failed: %v", err)
+	}
+	t.Logf("Flood of %d: %d accepted, rejected %v", len(flood), result.accepted, result.rejected)
+
+	// Mempool cap: the pool never grows past its budget
+	usage := honest.GetMemoryUsage()
+	if usage.MempoolBytes > budget {
+		t.Errorf("Mempool holds %d bytes, over its %d byte budget", usage.MempoolBytes, budget)
+	}
+
+	// Per-peer rate limit: acceptance is bounded by the bucket, whatever the flood size
+	allowed := burst + int(rate*elapsed.Seconds()) + 1
+	limited := result.rejected[ErrRelayRateLimited.Error()]
+	if passed := len(flood) - limited; passed > allowed {
+		t.Errorf("Peer got %d transactions past the rate limit in %v, want at most %d", passed, elapsed, allowed)
+	}
+	if limited == 0 || int64(limited) != usage.RelayLimited {
+		t.Errorf("Expected rate-limited rejections to be counted, got %d (miner reports %d)", limited, usage.RelayLimited)
+	}
+
+	// Fee escalation: once the pool evicts, cheap transactions are refused outright
+	floodRate := feeRate(flood[0], honest.Blockchain.FindUTXO)
+	if result.rejected[ErrFeeTooLow.Error()] == 0 || honest.MinRelayFeeRate() <= floodRate {
+		t.Errorf("Minimum fee rate %.6f should have risen above the flood's %.6f, rejections %v",
+			honest.MinRelayFeeRate(), floodRate, result.rejected)
+	}
+
+	// A transaction that outbids the flood still gets in
+	keys := attacker.floodKeys()
+	utxo := honest.Blockchain.FindUTXO(reserved.Inputs[0].TxID, reserved.Inputs[0].OutIndex)
+	paying := spendUTXO(honest.Blockchain.GetUTXOSet(), utxo, keys[utxo.ScriptPubKey],
+		[]transaction.TxOutput{{Value: utxo.Value / 2, ScriptPubKey: utxo.ScriptPubKey}})
+	data, _ := paying.Serialize()
+	var reply TransactionReply
+	(&RPCService{miner: honest}).ReceiveTransaction(&BlockArgs{BlockData: data}, &reply)
+	if !reply.Success {
+		t.Errorf("A well-paying transaction should be accepted during the flood: %s", reply.Error)
+	}
+}
+
+func TestFeeFloorDecays(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil, WithRelayLimits(RelayLimits{MinFeeRate: 0.5, FeeFloorHalfLife: time.Minute}))
+	miner.txMutex.Lock()
+	miner.raiseFeeFloor(4)
+	miner.feeFloorSet = miner.feeFloorSet.Add(-2 * time.Minute)
+	miner.txMutex.Unlock()
+
+	if got := miner.MinRelayFeeRate(); got < 0.99 || got > 1.01 {
+		t.Errorf("Floor of 4 should halve twice in two half-lives, got %.3f", got)
+	}
+	miner.txMutex.Lock()
+	miner.feeFloorSet = miner.feeFloorSet.Add(-time.Hour)
+	miner.txMutex.Unlock()
+	if got := miner.MinRelayFeeRate(); got != 0.5 {
+		t.Errorf("Decayed floor should fall back to the static minimum, got %.3f", got)
+	}
+}
+
+func TestLowDifficultyBlocksRejected(t *testing.T) {
+	attacker := NewMaliciousMiner("attacker", "localhost:19095", 3, nil, "low_difficulty")
+	if err := attacker.Start(); err != nil {
+		t.Fatalf("Failed to start attacker: %v", err)
+	}
+	defer attacker.Stop()
+
+	honest := NewMiner("honest", "localhost:19096", 3, nil)
+	if err := honest.Start(); err != nil {
+		t.Fatalf("Failed to start honest miner: %v", err)
+	}
+	defer honest.Stop()
+
+	// Pushed blocks: the attacker mines to its claim and broadcasts
+	attacker.Peers = []PeerInfo{{ID: "honest", Address: "localhost:19096"}}
+	attacker.mineBlock()
+	if attacker.Blockchain.GetLength() != 1 {
+		t.Error("The attacker's own chain should reject its cheap block")
+	}
+	if honest.Blockchain.GetLength() != 1 {
+		t.Errorf("Honest miner accepted a pushed low-difficulty block, length %d", honest.Blockchain.GetLength())
+	}
+
+	// Synced blocks: a longer chain whose hashes meet only their own claims
+	err := honest.SyncWithPeer(PeerInfo{ID: "attacker", Address: "localhost:19095"})
+	if !errors.Is(err, ErrInvalidPeerChain) || !errors.Is(err, blockchain.ErrInsufficientDifficulty) {
+		t.Fatalf("Expected the cheap chain to be rejected, got %v", err)
+	}
+	if honest.Blockchain.GetLength() != 1 {
+		t.Errorf("The honest chain should be unchanged, got length %d", honest.Blockchain.GetLength())
+	}
+
+	// Directly, the rejection names the difficulty
+	var reply BlockReply
+	cheap := grindBlocks(honest.Blockchain.GetLatestBlock(), 1, "attacker", lowDifficultyClaim)[0]
+	data, _ := cheap.Serialize()
+	(&RPCService{miner: honest}).ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+	if reply.Success || !strings.Contains(reply.Error, "difficulty") {
+		t.Errorf("Expected a difficulty rejection, got %+v", reply)
+	}
+}
+
+func TestInvalidMerkleBlocksRejected(t *testing.T) {
+	honest := NewMiner("honest", "localhost:19097", 2, nil, WithChainOptions(blockchain.WithMerkleTree(true)))
+	if err := honest.Start(); err != nil {
+		t.Fatalf("Failed to start honest miner: %v", err)
+	}
+	defer honest.Stop()
+
+	attacker := NewMaliciousMiner("attacker", "localhost:0", 2,
+		[]PeerInfo{{ID: "honest", Address: "localhost:19097"}}, "invalid_merkle",
+		WithChainOptions(blockchain.WithMerkleTree(true)))
+	attacker.mineBlock()
+	if honest.Blockchain.GetLength() != 1 {
+		t.Fatalf("Honest miner accepted a block with a stale Merkle root, length %d", honest.Blockchain.GetLength())
+	}
+
+	// The same block passes the hash and PoW checks; only the root gives it away
+	var reply BlockReply
+	b := createMerkleMismatch(t, honest)
+	data, _ := b.Serialize()
+	(&RPCService{miner: honest}).ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+	if reply.Success || reply.Error != blockchain.ErrInvalidMerkleRoot.Error() {
+		t.Errorf("Expected a Merkle root rejection, got %+v", reply)
+	}
+}
+
+// createMerkleMismatch mines a block on m's tip, then swaps its coinbase
+func createMerkleMismatch(t *testing.T, m *Miner) *block.Block {
+	t.Helper()
+	b := grindBlocks(m.Blockchain.GetLatestBlock(), 1, "attacker", m.Blockchain.GetDifficulty())[0]
+	b.Transactions[0] = transaction.NewCoinbaseTransaction("attacker-swapped", 0, b.Index)
+	if !b.HasValidHash() || !b.HasValidPoW() {
+		t.Fatal("Swapping transactions should not disturb the header")
+	}
+	return b
+}
+
+func TestSyncRejectsInflatedPrivateBranch(t *testing.T) {
+	attacker := NewMaliciousMiner("attacker", "localhost:19098", 1, nil, "coinbase_inflation")
+	if err := attacker.Start(); err != nil {
+		t.Fatalf("Failed to start attacker: %v", err)
+	}
+	defer attacker.Stop()
+	for i := 0; i < 3; i++ {
+		attacker.mineBlock()
+	}
+	if attacker.Blockchain.GetLength() != 1 {
+		t.Fatal("The inflated branch should stay off the attacker's public chain")
+	}
+
+	honest := NewMiner("honest", "localhost:0", 1, nil)
+	honest.mineBlock()
+	honest.mineBlock()
+	tip := honest.Blockchain.GetLatestBlock().Hash
+
+	// The branch is longer and its headers are sound; only the coinbases give it away
+	err := honest.SyncWithPeer(PeerInfo{ID: "attacker", Address: "localhost:19098"})
+	if !errors.Is(err, blockchain.ErrExcessCoinbase) {
+		t.Fatalf("Expected the inflated branch to be rejected, got %v", err)
+	}
+	if honest.Blockchain.GetLength() != 3 || honest.Blockchain.GetLatestBlock().Hash != tip {
+		t.Error("The honest chain should be unchanged")
+	}
+}
+
+func TestCheckpointRefusesLongerRewrite(t *testing.T) {
+	params := blockchain.DefaultChainParams()
+	honest := NewMiner("honest", "localhost:0", 1, nil, WithChainOptions(blockchain.WithParams(params)))
+	honest.mineBlock()
+	honest.mineBlock()
+	params.Checkpoints = map[int64]string{1: honest.Blockchain.GetBlocks()[1].Hash}
+
+	attacker := NewMiner("attacker", "localhost:19146", 1, nil)
+	if err := attacker.Start(); err != nil {
+		t.Fatalf("Failed to start attacker: %v", err)
+	}
+	defer attacker.Stop()
+	for i := 0; i < 4; i++ {
+		attacker.mineBlock()
+	}
+
+	err := honest.SyncWithPeer(PeerInfo{ID: "attacker", Address: "localhost:19146"})
+	if !errors.Is(err, blockchain.ErrCheckpointMismatch) {
+		t.Fatalf("Expected the longer chain to be refused at the checkpoint, got %v", err)
+	}
+	if honest.Blockchain.GetLength() != 3 {
+		t.Errorf("The honest chain should be unchanged, got length %d", honest.Blockchain.GetLength())
+	}
+
+	// A block forking below the checkpoint is refused when pushed, too
+	var reply BlockReply
+	data, _ := attacker.Blockchain.GetBlocks()[1].Serialize()
+	service := &RPCService{miner: honest}
+	service.ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+	if reply.Success {
+		t.Error("Expected the pushed block to be refused")
+	}
+	var status StatusReply
+	service.GetStatus(&struct{}{}, &status)
+	if status.CheckpointViolations != 2 {
+		t.Errorf("Expected 2 checkpoint violations, got %d", status.CheckpointViolations)
+	}
+}
+
+func TestFaultyBlocksRejected(t *testing.T) {
+	tests := []struct {
+		faultType string
+		wantErr   error
+		score     int
+	}{
+		{"excess_coinbase", blockchain.ErrExcessCoinbase, ScoreInvalidBlock},
+		{"missing_coinbase", blockchain.ErrInvalidTransaction, ScoreInvalidBlock},
+		{"duplicate_tx", blockchain.ErrInvalidTransaction, ScoreInvalidBlock},
+		{"double_spend", blockchain.ErrInvalidTransaction, ScoreInvalidBlock},
+		{"future_timestamp", blockchain.ErrTimestampInFuture, 0}, // The sender's clock may just be wrong
+	}
+	for _, tt := range tests {
+		t.Run(tt.faultType, func(t *testing.T) {
+			// Spending faults first mine an honest block to their own keys
+			attacker := NewMaliciousMiner("attacker", "localhost:0", 1, nil, tt.faultType)
+			attacker.mineBlock()
+			honest := NewMiner("honest", "localhost:0", 1, nil)
+			honest.Blockchain = blockchain.NewBlockchainFromBlocks(attacker.Blockchain.GetBlocks(), 1)
+			length := honest.Blockchain.GetLength()
+
+			b, _ := attacker.assembleBlock()
+			if !attacker.injectFault(b) {
+				t.Fatal("The attacker should have a fault to inject")
+			}
+			result := attacker.Blockchain.Engine().Seal(context.Background(), b, 1)
+			if !result.Success || !result.Block.HasValidHash() {
+				t.Fatal("The faulty block should be sealed with valid proof of work")
+			}
+			if err := attacker.Blockchain.AddBlock(result.Block); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected the attacker's own chain to refuse with %v, got %v", tt.wantErr, err)
+			}
+
+			var reply BlockReply
+			data, _ := result.Block.Serialize()
+			(&RPCService{miner: honest, peer: "127.0.0.1"}).ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+			if reply.Success || !strings.Contains(reply.Error, tt.wantErr.Error()) {
+				t.Errorf("Expected a %v rejection, got %+v", tt.wantErr, reply)
+			}
+			if honest.Blockchain.GetLength() != length {
+				t.Errorf("The honest chain should be unchanged, got length %d", honest.Blockchain.GetLength())
+			}
+			score := 0
+			for _, p := range honest.PeerScores().Peers {
+				if p.Host == "127.0.0.1" {
+					score = p.Score
+				}
+			}
+			if score != tt.score {
+				t.Errorf("Expected the sender to be charged %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
+
+func TestSelfishMinerReleasesBranchWhenCaughtUp(t *testing.T) {
+	selfish := NewMaliciousMiner("selfish", "localhost:19157", 1,
+		[]PeerInfo{{ID: "honest", Address: "localhost:19158"}}, "selfish")
+	if err := selfish.Start(); err != nil {
+		t.Fatalf("Failed to start selfish miner: %v", err)
+	}
+	defer selfish.Stop()
+	honest := NewMiner("honest", "localhost:19158", 1,
+		[]PeerInfo{{ID: "selfish", Address: "localhost:19157"}})
+	honest.Blockchain = blockchain.NewBlockchainFromBlocks(selfish.Blockchain.GetBlocks(), 1)
+	if err := honest.Start(); err != nil {
+		t.Fatalf("Failed to start honest miner: %v", err)
+	}
+	defer honest.Stop()
+
+	// Two blocks are found and withheld
+	selfish.mineBlock()
+	selfish.mineBlock()
+	selfish.branchMutex.Lock()
+	branch := append([]*block.Block(nil), selfish.privateBranch...)
+	selfish.branchMutex.Unlock()
+	if len(branch) != 2 || selfish.Blockchain.GetLength() != 1 || honest.Blockchain.GetLength() != 1 {
+		t.Fatalf("Expected 2 withheld blocks and no public ones, got %d withheld, lengths %d and %d",
+			len(branch), selfish.Blockchain.GetLength(), honest.Blockchain.GetLength())
+	}
+
+	// The honest miner finds one; with a lead of one left, the branch is released
+	honest.mineBlock()
+	waitForLength(t, selfish, 2)
+	selfish.mineBlock()
+
+	waitForLength(t, honest, 3)
+	for i, b := range branch {
+		if got := honest.Blockchain.GetBlockByHeight(b.Index); got == nil || got.Hash != b.Hash {
+			t.Errorf("The honest miner should reorganize onto the released branch, block %d differs", i+1)
+		}
+	}
+	if honest.Blockchain.GetLength() != 3 {
+		t.Errorf("The block found after the release should be withheld, honest length %d", honest.Blockchain.GetLength())
+	}
+}
+
+// waitForLength waits up to 10 seconds for m's chain to reach length
+func waitForLength(t *testing.T, m *Miner, length int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for m.Blockchain.GetLength() < length && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if m.Blockchain.GetLength() < length {
+		t.Fatalf("%s reached length %d, expected %d", m.ID, m.Blockchain.GetLength(), length)
+	}
+}
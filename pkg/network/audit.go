@@ -0,0 +1,150 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/audit"
+	"blockchain/pkg/logging"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// AuditQueryArgs selects entries of the audit log
+type AuditQueryArgs struct {
+	Caller string // Token identity, as shown in entries
+	Method string // Full method name, e.g. RPCService.SetMining
+	Since  int64  // Unix nanoseconds
+	Limit  int    // Newest entries to return (0 = all)
+}
+
+// AuditQueryReply lists matching audit entries, oldest first
+type AuditQueryReply struct {
+	Success bool
+	Entries []audit.Entry
+	Error   string
+}
+
+// WithAuditLog records every mutating RPC call made on an authenticated
+// connection, including refused ones, to l. It needs WithAccessPolicy, since
+// without it no connection authenticates.
+func WithAuditLog(l *audit.Log) MinerOption {
+	return func(o *MinerOptions) {
+		o.Audit = l
+	}
+}
+
+// auditedCall is a call read from a connection whose response is not yet written
+type auditedCall struct {
+	method string
+	caller string
+	role   access.Role
+	digest string
+	denied bool
+}
+
+// callAuditor records the mutating calls of one authenticated connection.
+// Requests are read in order, but responses are written as handlers finish,
+// so calls are matched to their responses by sequence number.
+type callAuditor struct {
+	miner   *Miner
+	session *session
+	remote  string
+	pending map[uint64]auditedCall
+	mu      sync.Mutex
+}
+
+func newCallAuditor(m *Miner, sess *session, remote string) *callAuditor {
+	return &callAuditor{miner: m, session: sess, remote: remote, pending: make(map[uint64]auditedCall)}
+}
+
+// request notes a call whose arguments have been read
+func (a *callAuditor) request(seq uint64, method string, args any, denied error) {
+	role, caller := a.session.identity()
+	if caller == "" || !access.Mutating(method) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending[seq] = auditedCall{
+		method: method,
+		caller: caller,
+		role:   role,
+		digest: audit.Digest(args),
+		denied: denied != nil,
+	}
+}
+
+// response writes the audit entry of a noted call once its reply is known
+func (a *callAuditor) response(seq uint64, rpcErr string, reply any) {
+	a.mu.Lock()
+	call, ok := a.pending[seq]
+	delete(a.pending, seq)
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	entry := audit.Entry{
+		Timestamp:    time.Now().UnixNano(),
+		Caller:       call.caller,
+		Role:         string(call.role),
+		Remote:       a.remote,
+		Method:       call.method,
+		ParamsDigest: call.digest,
+		Outcome:      audit.OutcomeOK,
+	}
+	switch {
+	case call.denied:
+		entry.Outcome, entry.Error = audit.OutcomeDenied, rpcErr
+	case rpcErr != "":
+		entry.Outcome, entry.Error = audit.OutcomeError, rpcErr
+	default:
+		if failed, msg := replyFailed(reply); failed {
+			entry.Outcome, entry.Error = audit.OutcomeFailed, msg
+		}
+	}
+	if err := a.miner.options.Audit.Append(entry); err != nil {
+		logging.Warnf("[%s] AUDIT: %v", shortID(a.miner.ID), err)
+	}
+}
+
+// replyFailed reports whether a reply describes a failed call, by the
+// Success and Error fields most replies carry
+func replyFailed(reply any) (bool, string) {
+	v := reflect.ValueOf(reply)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false, ""
+	}
+	var msg string
+	if f := v.FieldByName("Error"); f.IsValid() && f.Kind() == reflect.String {
+		msg = f.String()
+	}
+	if f := v.FieldByName("Success"); f.IsValid() && f.Kind() == reflect.Bool && !f.Bool() {
+		return true, msg
+	}
+	return msg != "", msg
+}
+
+// GetAuditLog RPC method to query the audit log
+func (s *RPCService) GetAuditLog(args *AuditQueryArgs, reply *AuditQueryReply) error {
+	if s.miner.options.Audit == nil {
+		reply.Error = "audit log is not enabled on this miner"
+		return nil
+	}
+	entries, err := s.miner.options.Audit.Query(audit.Filter{
+		Caller: args.Caller,
+		Method: args.Method,
+		Since:  args.Since,
+		Limit:  args.Limit,
+	})
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Success = true
+	reply.Entries = entries
+	return nil
+}
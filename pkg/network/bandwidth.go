@@ -0,0 +1,264 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// trafficClass says which bandwidth cap a message on a peer connection
+// counts against
+type trafficClass int32
+
+const (
+	trafficNone  trafficClass = iota // Not capped: calls from clients
+	trafficSync                      // Chain and header downloads, either way
+	trafficRelay                     // Blocks, transactions, and other calls between peers
+)
+
+// syncMethods are the calls that download the chain
+var syncMethods = map[string]bool{
+	"RPCService.GetChain":   true,
+	"RPCService.GetHeaders": true,
+}
+
+// classifyCall returns the traffic class of a call. Every call the miner
+// makes goes to a peer; calls it serves may come from clients, which are not
+// capped.
+func classifyCall(method string, outgoing bool) trafficClass {
+	if syncMethods[method] {
+		return trafficSync
+	}
+	if outgoing {
+		return trafficRelay
+	}
+	if g, ok := access.MethodGroup(method); ok && g == access.GroupPeer {
+		return trafficRelay
+	}
+	return trafficNone
+}
+
+// BandwidthConfig caps the bytes per second the miner's peer connections
+// carry in each direction, separately for chain sync and for relay, so a
+// miner on a slow link can take part without saturating it
+type BandwidthConfig struct {
+	SyncBytesPerSec  int64 // GetChain and GetHeaders, fetched or served (0 = unlimited)
+	RelayBytesPerSec int64 // Every other call between peers (0 = unlimited)
+}
+
+// WithBandwidth caps the miner's sync and relay traffic
+func WithBandwidth(cfg BandwidthConfig) MinerOption {
+	return func(o *MinerOptions) {
+		o.Bandwidth = &cfg
+	}
+}
+
+// reserve removes n tokens, going into debt if there are too few, and
+// returns how long the caller must wait for the debt to be repaid. Later
+// callers wait out earlier debt, so callers sharing a bucket are paced in turn.
+func (b *tokenBucket) reserve(n, rate float64, burst int, now time.Time) time.Duration {
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// byteLimiter paces bytes through a token bucket holding one second's worth
+type byteLimiter struct {
+	mu      sync.Mutex
+	rate    int64
+	bucket  tokenBucket
+	bytes   int64
+	delayed time.Duration
+}
+
+func newByteLimiter(rate int64) *byteLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &byteLimiter{rate: rate, bucket: tokenBucket{tokens: float64(rate), last: time.Now()}}
+}
+
+// wait blocks until n bytes fit under the rate, taking at most a second's
+// worth at a time so a large message does not starve other connections
+func (l *byteLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	for n > 0 {
+		chunk := min(n, int(l.rate))
+		l.mu.Lock()
+		delay := l.bucket.reserve(float64(chunk), float64(l.rate), int(l.rate), time.Now())
+		l.bytes += int64(chunk)
+		l.delayed += delay
+		l.mu.Unlock()
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		n -= chunk
+	}
+}
+
+// stats returns the bytes paced and the time callers were held back
+func (l *byteLimiter) stats() BandwidthCounter {
+	if l == nil {
+		return BandwidthCounter{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return BandwidthCounter{Bytes: l.bytes, Delayed: l.delayed}
+}
+
+// bandwidthLimits holds a limiter per capped class and direction; nil
+// limiters are unlimited
+type bandwidthLimits struct {
+	syncIn, syncOut   *byteLimiter
+	relayIn, relayOut *byteLimiter
+}
+
+func newBandwidthLimits(cfg *BandwidthConfig) *bandwidthLimits {
+	if cfg == nil || (cfg.SyncBytesPerSec <= 0 && cfg.RelayBytesPerSec <= 0) {
+		return nil
+	}
+	return &bandwidthLimits{
+		syncIn:   newByteLimiter(cfg.SyncBytesPerSec),
+		syncOut:  newByteLimiter(cfg.SyncBytesPerSec),
+		relayIn:  newByteLimiter(cfg.RelayBytesPerSec),
+		relayOut: newByteLimiter(cfg.RelayBytesPerSec),
+	}
+}
+
+// limiter returns the limiter of a class and direction, or nil
+func (b *bandwidthLimits) limiter(class trafficClass, in bool) *byteLimiter {
+	switch {
+	case class == trafficSync && in:
+		return b.syncIn
+	case class == trafficSync:
+		return b.syncOut
+	case class == trafficRelay && in:
+		return b.relayIn
+	case class == trafficRelay:
+		return b.relayOut
+	}
+	return nil
+}
+
+// throttledConn paces a connection's writes, and through reader its reads,
+// by the class of the call being written or read, which the RPC codecs set
+// from each message header. Reads are paced as the decoder consumes them,
+// after the connection's read-ahead buffer, so each byte counts against the
+// call it belongs to; holding the decoder back holds back the peer through
+// TCP flow control.
+type throttledConn struct {
+	net.Conn
+	limits     *bandwidthLimits
+	readClass  atomic.Int32
+	writeClass atomic.Int32
+}
+
+// throttle wraps conn in the miner's bandwidth caps. It returns conn itself
+// and a nil handle if the miner has none.
+func (m *Miner) throttle(conn net.Conn) (net.Conn, *throttledConn) {
+	if m.bandwidth == nil {
+		return conn, nil
+	}
+	tc := &throttledConn{Conn: conn, limits: m.bandwidth}
+	return tc, tc
+}
+
+// setRead sets the class of the bytes read next; a nil handle is a no-op
+func (c *throttledConn) setRead(class trafficClass) {
+	if c != nil {
+		c.readClass.Store(int32(class))
+	}
+}
+
+// setWrite sets the class of the bytes written next; a nil handle is a no-op
+func (c *throttledConn) setWrite(class trafficClass) {
+	if c != nil {
+		c.writeClass.Store(int32(class))
+	}
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	c.limits.limiter(trafficClass(c.writeClass.Load()), false).wait(len(p))
+	return c.Conn.Write(p)
+}
+
+// reader paces what a decoder reads from r, a frameLimiter over the
+// connection; a nil handle returns r itself
+func (c *throttledConn) reader(r *frameLimiter) io.Reader {
+	if c == nil {
+		return r
+	}
+	return &throttledReader{r: r, conn: c}
+}
+
+// throttledReader paces reads by the connection's read class. It is a
+// ByteReader, like the frameLimiter it wraps, so gob adds no read-ahead.
+type throttledReader struct {
+	r    *frameLimiter
+	conn *throttledConn
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.conn.limits.limiter(trafficClass(t.conn.readClass.Load()), true).wait(n)
+	return n, err
+}
+
+func (t *throttledReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(t, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// BandwidthCounter reports the bytes of one class and direction and how long
+// they were held back by its cap
+type BandwidthCounter struct {
+	Bytes   int64
+	Delayed time.Duration
+}
+
+// BandwidthReply reports the miner's bandwidth caps and the traffic under them
+type BandwidthReply struct {
+	Enabled          bool
+	SyncBytesPerSec  int64 // 0 = unlimited
+	RelayBytesPerSec int64
+	SyncIn           BandwidthCounter // Counted only while the class is capped
+	SyncOut          BandwidthCounter
+	RelayIn          BandwidthCounter
+	RelayOut         BandwidthCounter
+}
+
+// Bandwidth returns the miner's bandwidth caps and traffic
+func (m *Miner) Bandwidth() BandwidthReply {
+	if m.bandwidth == nil {
+		return BandwidthReply{}
+	}
+	cfg := m.options.Bandwidth
+	b := m.bandwidth
+	return BandwidthReply{
+		Enabled:          true,
+		SyncBytesPerSec:  max(cfg.SyncBytesPerSec, 0),
+		RelayBytesPerSec: max(cfg.RelayBytesPerSec, 0),
+		SyncIn:           b.syncIn.stats(),
+		SyncOut:          b.syncOut.stats(),
+		RelayIn:          b.relayIn.stats(),
+		RelayOut:         b.relayOut.stats(),
+	}
+}
+
+// GetBandwidth RPC method to report the miner's bandwidth caps and traffic
+func (s *RPCService) GetBandwidth(args *struct{}, reply *BandwidthReply) error {
+	*reply = s.miner.Bandwidth()
+	return nil
+}
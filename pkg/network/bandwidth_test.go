@@ -0,0 +1,83 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestByteLimiterPacesToRate(t *testing.T) {
+	l := newByteLimiter(10000)
+	start := time.Now()
+	l.wait(10000) // A full bucket passes at once
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("A second's worth should pass without waiting, took %v", elapsed)
+	}
+	l.wait(5000)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("Another half second's worth should take about 500ms, took %v", elapsed)
+	}
+	if stats := l.stats(); stats.Bytes != 15000 || stats.Delayed < 400*time.Millisecond {
+		t.Errorf("Expected 15000 bytes held back about 500ms, got %+v", stats)
+	}
+	var unlimited *byteLimiter
+	unlimited.wait(1 << 30) // No cap: returns at once
+}
+
+func TestClassifyCall(t *testing.T) {
+	cases := []struct {
+		method   string
+		outgoing bool
+		want     trafficClass
+	}{
+		{"RPCService.GetChain", false, trafficSync},
+		{"RPCService.GetHeaders", true, trafficSync},
+		{"RPCService.ReceiveBlock", false, trafficRelay},
+		{"RPCService.GetStatus", true, trafficRelay}, // Asked of a peer
+		{"RPCService.GetStatus", false, trafficNone}, // Asked by a client
+		{"RPCService.SubmitRawTransaction", false, trafficNone},
+	}
+	for _, c := range cases {
+		if got := classifyCall(c.method, c.outgoing); got != c.want {
+			t.Errorf("classifyCall(%s, %v) = %d, want %d", c.method, c.outgoing, got, c.want)
+		}
+	}
+}
+
+func TestSyncIsCappedSeparatelyFromRelay(t *testing.T) {
+	peer := NewMiner("peer", "localhost:19142", 1, nil)
+	for i := 0; i < 10; i++ {
+		peer.mineBlock()
+	}
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer peer.Stop()
+
+	const rate = 2048
+	slow := NewMiner("slow", "localhost:0", 1, nil, WithBandwidth(BandwidthConfig{SyncBytesPerSec: rate, RelayBytesPerSec: 1 << 20}))
+	start := time.Now()
+	if err := slow.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19142"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	elapsed := time.Since(start)
+	if slow.Blockchain.GetLength() != peer.Blockchain.GetLength() {
+		t.Fatalf("Expected the peer's %d blocks, got %d", peer.Blockchain.GetLength(), slow.Blockchain.GetLength())
+	}
+
+	bw := slow.Bandwidth()
+	if !bw.Enabled || bw.SyncBytesPerSec != rate || bw.RelayBytesPerSec != 1<<20 {
+		t.Fatalf("Unexpected caps: %+v", bw)
+	}
+	// The first second's worth passes at once; the rest is paced
+	want := time.Duration(float64(bw.SyncIn.Bytes-rate) / rate * float64(time.Second))
+	if bw.SyncIn.Bytes <= 2*rate || elapsed < want*8/10 || bw.SyncIn.Delayed == 0 {
+		t.Errorf("Expected %d synced bytes paced over about %v, took %v (%+v)", bw.SyncIn.Bytes, want, elapsed, bw.SyncIn)
+	}
+	// Only the feature handshake on the sync connection counts as relay
+	if bw.RelayOut.Bytes == 0 || bw.RelayIn.Bytes >= bw.SyncIn.Bytes/4 {
+		t.Errorf("Expected a little relay traffic besides the sync, got in %+v, out %+v", bw.RelayIn, bw.RelayOut)
+	}
+	if peer.Bandwidth().Enabled {
+		t.Error("A miner without caps should report none")
+	}
+}
@@ -0,0 +1,339 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/transaction"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultCheckpointInterval is how many blocks apart checkpoints are signed
+	DefaultCheckpointInterval = 100
+
+	// DefaultCheckpointDepth is how many blocks must follow a header before it
+	// is signed, so a checkpoint is not undone by a short reorg
+	DefaultCheckpointDepth = 6
+
+	// checkpointPollInterval is how often the miner looks for a new checkpoint
+	// to sign, or re-reads its checkpoint file
+	checkpointPollInterval = 5 * time.Second
+)
+
+var (
+	ErrInvalidCheckpoint   = errors.New("invalid checkpoint")
+	ErrUntrustedCheckpoint = errors.New("checkpoint not signed by the trusted key")
+)
+
+// CheckpointConfig sets how a miner signs or serves header checkpoints. A
+// miner holding the signing key signs one every Interval blocks; others only
+// serve the latest checkpoint found in File, copied there from the signer.
+type CheckpointConfig struct {
+	SigningKey string // Hex private key checkpoints are signed with; empty to only serve File
+	TrustedKey string // Hex public key File's checkpoints must be signed by (default: SigningKey's)
+	Interval   int64  // Blocks between checkpoints (default DefaultCheckpointInterval)
+	Depth      int64  // Blocks that must follow a signed header (default DefaultCheckpointDepth)
+	File       string // Where new checkpoints are written, or served ones read from
+}
+
+// HeaderCheckpoint is a block header vouched for by a trusted key. A light
+// client that trusts the key takes the chain up to the header as given and
+// only downloads and checks the headers after it.
+type HeaderCheckpoint struct {
+	Header    BlockHeader
+	SignedAt  int64  // Unix seconds
+	Signer    string // Hex public key
+	Signature string // Hex ECDSA signature of CheckpointMessage
+}
+
+// CheckpointReply returns the miner's latest checkpoint, nil if it has none
+type CheckpointReply struct {
+	Enabled    bool
+	Checkpoint *HeaderCheckpoint
+}
+
+// WithCheckpoints makes the miner sign or serve header checkpoints for light
+// clients
+func WithCheckpoints(cfg CheckpointConfig) MinerOption {
+	return func(o *MinerOptions) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = DefaultCheckpointInterval
+		}
+		if cfg.Depth <= 0 {
+			cfg.Depth = DefaultCheckpointDepth
+		}
+		if cfg.TrustedKey == "" && cfg.SigningKey != "" {
+			if key, err := transaction.HexToPrivateKey(cfg.SigningKey); err == nil {
+				cfg.TrustedKey = transaction.PublicKeyToHex(&key.PublicKey)
+			}
+		}
+		o.Checkpoints = &cfg
+	}
+}
+
+// CheckpointMessage is the data signed for a checkpoint. The header's hash
+// commits to the rest of it, and so to every block before it.
+func CheckpointMessage(h BlockHeader, signedAt int64) string {
+	return "blockchain-checkpoint\n" + strconv.FormatInt(h.Index, 10) + "\n" + h.Hash + "\n" + strconv.FormatInt(signedAt, 10)
+}
+
+// SignCheckpoint signs h with a hex private key
+func SignCheckpoint(h BlockHeader, privateKeyHex string) (*HeaderCheckpoint, error) {
+	key, err := transaction.HexToPrivateKey(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", access.ErrInvalidKey, err)
+	}
+	c := &HeaderCheckpoint{
+		Header:   h,
+		SignedAt: time.Now().Unix(),
+		Signer:   transaction.PublicKeyToHex(&key.PublicKey),
+	}
+	c.Signature, err = transaction.SignECDSA(CheckpointMessage(h, c.SignedAt), privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Verify checks that the checkpoint is signed by trustedKey and that its
+// header's hash matches its fields, where the header carries a Merkle root
+func (c *HeaderCheckpoint) Verify(trustedKey string) error {
+	if c.Signer != trustedKey {
+		return fmt.Errorf("%w: signed by %s, trusted key is %s", ErrUntrustedCheckpoint,
+			access.KeyID(c.Signer), access.KeyID(trustedKey))
+	}
+	if !transaction.VerifyECDSA(CheckpointMessage(c.Header, c.SignedAt), c.Signature, c.Signer) {
+		return fmt.Errorf("%w: bad signature", ErrInvalidCheckpoint)
+	}
+	if b := c.Header.Block(); b.MerkleRoot != "" {
+		b.SetMerkleMode(true)
+		if !b.HasValidHash() {
+			return fmt.Errorf("%w: header #%d does not match its hash", ErrInvalidCheckpoint, c.Header.Index)
+		}
+	}
+	return nil
+}
+
+// LoadCheckpoint reads a checkpoint file. Its signature is not checked.
+func LoadCheckpoint(path string) (*HeaderCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c HeaderCheckpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidCheckpoint, path, err)
+	}
+	return &c, nil
+}
+
+// WriteCheckpoint writes c to path as indented JSON, replacing the file
+// atomically so a miner serving it never reads half a checkpoint
+func WriteCheckpoint(path string, c *HeaderCheckpoint) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// UpdateCheckpoint brings the miner's checkpoint up to date and returns it.
+// A signer signs the header at the highest multiple of the interval that is
+// at least the configured depth below the tip, unless already signed; other
+// miners pick up a newer checkpoint from their file.
+func (m *Miner) UpdateCheckpoint() (*HeaderCheckpoint, error) {
+	cfg := m.options.Checkpoints
+	if cfg == nil {
+		return nil, nil
+	}
+	current := m.Checkpoint()
+	if cfg.SigningKey == "" {
+		return m.reloadCheckpoint(current)
+	}
+
+	height := (int64(m.Blockchain.GetLength()) - 1 - cfg.Depth) / cfg.Interval * cfg.Interval
+	if height <= 0 {
+		return current, nil
+	}
+	b := m.Blockchain.GetBlockByHeight(height)
+	if b == nil || (current != nil && current.Header.Hash == b.Hash) {
+		return current, nil
+	}
+	c, err := SignCheckpoint(headerOf(b), cfg.SigningKey)
+	if err != nil {
+		return current, err
+	}
+	m.setCheckpoint(c)
+	log.Printf("[%s] CHECKPOINT: signed header #%d (%s)", shortID(m.ID), height, shortID(b.Hash))
+	if cfg.File != "" {
+		if err := WriteCheckpoint(cfg.File, c); err != nil {
+			return c, fmt.Errorf("failed to write checkpoint: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// reloadCheckpoint serves the checkpoint in the miner's file if it is newer
+// than current and signed by the trusted key
+func (m *Miner) reloadCheckpoint(current *HeaderCheckpoint) (*HeaderCheckpoint, error) {
+	cfg := m.options.Checkpoints
+	if cfg.File == "" {
+		return current, nil
+	}
+	c, err := LoadCheckpoint(cfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return current, nil
+	}
+	if err != nil {
+		return current, err
+	}
+	if current != nil && c.Header.Hash == current.Header.Hash {
+		return current, nil
+	}
+	if err := c.Verify(cfg.TrustedKey); err != nil {
+		return current, err
+	}
+	if current != nil && c.Header.Index < current.Header.Index {
+		return current, nil
+	}
+	m.setCheckpoint(c)
+	log.Printf("[%s] CHECKPOINT: serving header #%d (%s) signed by %s", shortID(m.ID), c.Header.Index,
+		shortID(c.Header.Hash), access.KeyID(c.Signer))
+	return c, nil
+}
+
+func (m *Miner) setCheckpoint(c *HeaderCheckpoint) {
+	m.checkpointMutex.Lock()
+	m.checkpoint = c
+	m.checkpointMutex.Unlock()
+}
+
+// Checkpoint returns the latest checkpoint the miner serves, nil if none
+func (m *Miner) Checkpoint() *HeaderCheckpoint {
+	m.checkpointMutex.Lock()
+	defer m.checkpointMutex.Unlock()
+	return m.checkpoint
+}
+
+// checkpointLoop runs UpdateCheckpoint periodically until the miner stops
+func (m *Miner) checkpointLoop() {
+	for {
+		if _, err := m.UpdateCheckpoint(); err != nil {
+			logging.Warnf("[%s] CHECKPOINT: %v", shortID(m.ID), err)
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(checkpointPollInterval):
+		}
+	}
+}
+
+// GetCheckpoint RPC method to get the latest header checkpoint
+func (s *RPCService) GetCheckpoint(args *struct{}, reply *CheckpointReply) error {
+	reply.Enabled = s.miner.options.Checkpoints != nil
+	reply.Checkpoint = s.miner.Checkpoint()
+	return nil
+}
+
+// GetCheckpoint gets a miner's latest header checkpoint, without checking it
+func (c *Client) GetCheckpoint(minerAddress string) (*HeaderCheckpoint, error) {
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	var reply CheckpointReply
+	if err := client.Call("RPCService.GetCheckpoint", &struct{}{}, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Checkpoint == nil {
+		return nil, fmt.Errorf("miner %s serves no checkpoint", minerAddress)
+	}
+	return reply.Checkpoint, nil
+}
+
+// SyncHeaders is a light client's sync: it checks that cp is signed by
+// trustedKey, then downloads the miner's headers after the checkpoint, page by
+// page, checking that they link back to it and meet their proof of work.
+// Nothing before the checkpoint is downloaded or checked; that part of the
+// chain is taken on the key's word. It returns the headers after cp.
+func (c *Client) SyncHeaders(minerAddress string, cp *HeaderCheckpoint, trustedKey string) ([]BlockHeader, error) {
+	if err := cp.Verify(trustedKey); err != nil {
+		return nil, err
+	}
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return headersAfter(client, cp.Header)
+}
+
+// headersAfter downloads the headers following base, which the miner's chain
+// must still hold
+func headersAfter(client *rpc.Client, base BlockHeader) ([]BlockHeader, error) {
+	headers := []BlockHeader{}
+	prev := base
+	start := base.Index
+	for {
+		var reply HeadersReply
+		args := &HeadersArgs{StartIndex: start, Count: MaxHeadersPerRequest}
+		if err := client.Call("RPCService.GetHeaders", args, &reply); err != nil {
+			return nil, err
+		}
+		page := reply.Headers
+		if start == base.Index {
+			if len(page) == 0 || page[0].Hash != base.Hash {
+				return nil, fmt.Errorf("%w: chain does not hold checkpoint #%d", ErrInvalidPeerChain, base.Index)
+			}
+			page = page[1:]
+		}
+		for _, h := range page {
+			if err := CheckHeaderLink(h, prev); err != nil {
+				return nil, fmt.Errorf("%w: header #%d: %w", ErrInvalidPeerChain, h.Index, err)
+			}
+			headers = append(headers, h)
+			prev = h
+		}
+		start = prev.Index + 1
+		if len(reply.Headers) == 0 || start >= int64(reply.Length) {
+			return headers, nil
+		}
+	}
+}
+
+// CheckHeaderLink checks that h follows prev and meets its proof of work. Its
+// hash is checked against its fields only if it carries a Merkle root; a
+// legacy header's hash commits to transactions a light client does not have.
+func CheckHeaderLink(h, prev BlockHeader) error {
+	b := h.Block()
+	if h.Index != prev.Index+1 {
+		return blockchain.ErrInvalidIndex
+	}
+	if h.PrevHash != prev.Hash {
+		return blockchain.ErrInvalidPrevHash
+	}
+	if b.MerkleRoot != "" {
+		b.SetMerkleMode(true)
+		if !b.HasValidHash() {
+			return blockchain.ErrInvalidBlock
+		}
+	}
+	if !b.HasValidPoW() {
+		return blockchain.ErrInvalidPoW
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"blockchain/pkg/testchain"
+	"blockchain/pkg/transaction"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLightClientSyncsFromCheckpoint(t *testing.T) {
+	instructor, _ := transaction.GenerateKeyPair()
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	signer := NewMiner("signer", "localhost:19139", 1, nil,
+		WithCheckpoints(CheckpointConfig{SigningKey: instructor.GetPrivateKeyHex(), Interval: 4, Depth: 2, File: file}))
+	if err := signer.Start(); err != nil {
+		t.Fatalf("Failed to start signer: %v", err)
+	}
+	defer signer.Stop()
+
+	// Nothing is signed until a multiple of the interval is deep enough
+	testchain.Extend(t, signer.Blockchain).MineToHeight(5)
+	if c, err := signer.UpdateCheckpoint(); c != nil || err != nil {
+		t.Fatalf("Header #4 is not yet deep enough to sign, got %+v, %v", c, err)
+	}
+	testchain.Extend(t, signer.Blockchain).MineToHeight(9)
+	cp, err := signer.UpdateCheckpoint()
+	if err != nil || cp == nil || cp.Header.Index != 4 || cp.Header.Hash != signer.Blockchain.GetBlockByHeight(4).Hash {
+		t.Fatalf("Expected a checkpoint of header #4, got %+v, %v", cp, err)
+	}
+	if err := cp.Verify(instructor.GetPublicKeyHex()); err != nil {
+		t.Fatalf("The checkpoint should verify against the instructor's key: %v", err)
+	}
+
+	// A miner without the key serves the checkpoint file once it verifies
+	server := NewMiner("server", "localhost:19140", 1, nil,
+		WithCheckpoints(CheckpointConfig{TrustedKey: instructor.GetPublicKeyHex(), File: file}))
+	var reply CheckpointReply
+	server.UpdateCheckpoint()
+	(&RPCService{miner: server}).GetCheckpoint(&struct{}{}, &reply)
+	if !reply.Enabled || reply.Checkpoint == nil || reply.Checkpoint.Header.Hash != cp.Header.Hash {
+		t.Fatalf("The serving miner should pick up the checkpoint file, got %+v", reply)
+	}
+
+	// The light client downloads only the headers after the checkpoint
+	client := NewClient("light", nil)
+	served, err := client.GetCheckpoint("localhost:19139")
+	if err != nil {
+		t.Fatalf("Failed to get checkpoint: %v", err)
+	}
+	headers, err := client.SyncHeaders("localhost:19139", served, instructor.GetPublicKeyHex())
+	if err != nil {
+		t.Fatalf("Light sync failed: %v", err)
+	}
+	tip := signer.Blockchain.GetLatestBlock()
+	if len(headers) != 5 || headers[0].Index != 5 || headers[len(headers)-1].Hash != tip.Hash {
+		t.Fatalf("Expected headers #5 to #9 ending at the tip, got %d headers", len(headers))
+	}
+
+	// Checkpoints signed by another key, or tampered with, are refused
+	other, _ := transaction.GenerateKeyPair()
+	if _, err := client.SyncHeaders("localhost:19139", served, other.GetPublicKeyHex()); !errors.Is(err, ErrUntrustedCheckpoint) {
+		t.Errorf("A checkpoint from an untrusted key should be refused, got %v", err)
+	}
+	forged := *served
+	forged.Header = headerOf(signer.Blockchain.GetBlockByHeight(8))
+	if _, err := client.SyncHeaders("localhost:19139", &forged, instructor.GetPublicKeyHex()); !errors.Is(err, ErrInvalidCheckpoint) {
+		t.Errorf("A checkpoint whose header was swapped should be refused, got %v", err)
+	}
+
+	// A checkpoint the miner's chain does not hold fails the sync
+	foreign := testchain.New(t, 1).MineToHeight(4)
+	stray, _ := SignCheckpoint(headerOf(foreign.Chain().GetBlockByHeight(4)), instructor.GetPrivateKeyHex())
+	if _, err := client.SyncHeaders("localhost:19139", stray, instructor.GetPublicKeyHex()); !errors.Is(err, ErrInvalidPeerChain) {
+		t.Errorf("Syncing from a checkpoint off the miner's chain should fail, got %v", err)
+	}
+}
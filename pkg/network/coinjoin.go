@@ -0,0 +1,142 @@
+package network
+
+import (
+	"blockchain/pkg/coinjoin"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/transaction"
+	"log"
+)
+
+// CoinJoinConfig enables the miner's coinjoin coordinator
+type CoinJoinConfig struct {
+	Denomination int64 // Value of every mixed output (satoshi)
+	Participants int   // Participants per round
+	Fee          int64 // Fee paid by each participant (satoshi)
+}
+
+// CoinJoinRegisterArgs registers a participant in the open round
+type CoinJoinRegisterArgs struct {
+	Inputs        []transaction.TxInput
+	MixAddress    string
+	ChangeAddress string
+}
+
+// CoinJoinRegisterReply returns the round the participant joined
+type CoinJoinRegisterReply struct {
+	Success bool
+	RoundID string
+	Error   string
+}
+
+// CoinJoinRoundArgs identifies a round
+type CoinJoinRoundArgs struct {
+	RoundID string
+}
+
+// CoinJoinRoundReply reports a round's progress and, once full, the unsigned transaction
+type CoinJoinRoundReply struct {
+	Success      bool
+	State        string
+	Denomination int64
+	Participants int
+	Size         int
+	TxData       []byte // Serialized combined transaction (signing and later states)
+	Error        string
+}
+
+// CoinJoinSignArgs submits signatures for a participant's inputs
+type CoinJoinSignArgs struct {
+	RoundID    string
+	Signatures map[string]string // "txid:index" -> scriptSig of that input of the combined transaction
+}
+
+// WithCoinJoin makes the miner coordinate coinjoin rounds over RPC
+func WithCoinJoin(cfg CoinJoinConfig) MinerOption {
+	return func(o *MinerOptions) {
+		o.CoinJoin = &cfg
+	}
+}
+
+// setupCoinJoin creates the coordinator; completed transactions enter the
+// mempool and are relayed like any client submission
+func (m *Miner) setupCoinJoin(cfg CoinJoinConfig) {
+	m.coinjoin = coinjoin.NewCoordinator(cfg.Denomination, cfg.Participants, cfg.Fee,
+		func(txID string, outIndex int) *transaction.UTXO {
+			return m.Blockchain.FindUTXO(txID, outIndex)
+		})
+	m.coinjoin.SetCompleteCallback(m.submitCoinJoin)
+}
+
+// submitCoinJoin validates a fully signed coinjoin transaction and relays it
+func (m *Miner) submitCoinJoin(tx *transaction.Transaction) {
+	if err := m.Blockchain.ValidateTransaction(tx); err != nil {
+		logging.Warnf("[%s] Coinjoin transaction %s rejected: %v", shortID(m.ID), shortID(tx.ID), err)
+		return
+	}
+	if err := m.AddTransaction(tx); err != nil {
+		log.Printf("[%s] Coinjoin transaction %s not added: %v", shortID(m.ID), shortID(tx.ID), err)
+		return
+	}
+	log.Printf("[%s] Coinjoin transaction %s complete: %d inputs, %d outputs",
+		shortID(m.ID), shortID(tx.ID), len(tx.Inputs), len(tx.Outputs))
+	go m.BroadcastTransaction(tx)
+}
+
+// CoinJoinRegister RPC method to join the open coinjoin round
+func (s *RPCService) CoinJoinRegister(args *CoinJoinRegisterArgs, reply *CoinJoinRegisterReply) error {
+	if s.miner.coinjoin == nil {
+		reply.Error = "coinjoin is not enabled on this miner"
+		return nil
+	}
+	id, err := s.miner.coinjoin.Register(coinjoin.Registration{
+		Inputs:        args.Inputs,
+		MixAddress:    args.MixAddress,
+		ChangeAddress: args.ChangeAddress,
+	})
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Success = true
+	reply.RoundID = id
+	return nil
+}
+
+// CoinJoinGetRound RPC method to poll a round's progress
+func (s *RPCService) CoinJoinGetRound(args *CoinJoinRoundArgs, reply *CoinJoinRoundReply) error {
+	if s.miner.coinjoin == nil {
+		reply.Error = "coinjoin is not enabled on this miner"
+		return nil
+	}
+	info, err := s.miner.coinjoin.Round(args.RoundID)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Success = true
+	reply.State = string(info.State)
+	reply.Denomination = info.Denomination
+	reply.Participants = info.Participants
+	reply.Size = info.Size
+	if info.Tx != nil {
+		reply.TxData, _ = info.Tx.SerializeJSON()
+	}
+	return nil
+}
+
+// CoinJoinSign RPC method to submit signatures for a participant's inputs
+func (s *RPCService) CoinJoinSign(args *CoinJoinSignArgs, reply *TransactionReply) error {
+	if s.miner.coinjoin == nil {
+		reply.Error = "coinjoin is not enabled on this miner"
+		return nil
+	}
+	if err := s.miner.coinjoin.Sign(args.RoundID, args.Signatures); err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Success = true
+	if info, err := s.miner.coinjoin.Round(args.RoundID); err == nil && info.State == coinjoin.StateComplete {
+		reply.TxID = info.Tx.ID
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"blockchain/pkg/transaction"
+	"fmt"
+	"testing"
+)
+
+func TestCoinJoinRPCRound(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil,
+		WithCoinJoin(CoinJoinConfig{Denomination: 5000, Participants: 2, Fee: 100}))
+	service := &RPCService{miner: miner}
+
+	// Fund two independent wallets directly in the chain state
+	var keys []*transaction.KeyPair
+	var coins []*transaction.Transaction
+	for i := 0; i < 2; i++ {
+		kp, _ := transaction.GenerateKeyPair()
+		coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 8000, int64(100+i))
+		miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+		keys = append(keys, kp)
+		coins = append(coins, coinbase)
+	}
+
+	var roundID string
+	for i, coin := range coins {
+		var reply CoinJoinRegisterReply
+		service.CoinJoinRegister(&CoinJoinRegisterArgs{
+			Inputs:        []transaction.TxInput{{TxID: coin.ID, OutIndex: 0}},
+			MixAddress:    fmt.Sprintf("mix%d", i),
+			ChangeAddress: fmt.Sprintf("change%d", i),
+		}, &reply)
+		if !reply.Success {
+			t.Fatalf("Register failed: %s", reply.Error)
+		}
+		roundID = reply.RoundID
+	}
+
+	var round CoinJoinRoundReply
+	service.CoinJoinGetRound(&CoinJoinRoundArgs{RoundID: roundID}, &round)
+	if round.State != "signing" || round.TxData == nil {
+		t.Fatalf("Full round should expose the transaction to sign, got %+v", round)
+	}
+	tx, err := transaction.DeserializeTransaction(round.TxData)
+	if err != nil {
+		t.Fatalf("Failed to deserialize round transaction: %v", err)
+	}
+
+	var signReply TransactionReply
+	for i, coin := range coins {
+		sig, _ := transaction.SignECDSA(tx.GetDataToSign(), keys[i].GetPrivateKeyHex())
+		service.CoinJoinSign(&CoinJoinSignArgs{
+			RoundID:    roundID,
+			Signatures: map[string]string{coin.ID + ":0": sig},
+		}, &signReply)
+		if !signReply.Success {
+			t.Fatalf("Sign failed: %s", signReply.Error)
+		}
+	}
+
+	if signReply.TxID == "" {
+		t.Fatal("Final signature should complete the round")
+	}
+	pending := miner.GetPendingTransactions()
+	if len(pending) != 1 || pending[0].ID != signReply.TxID {
+		t.Errorf("Completed coinjoin should be in the mempool, got %d pending", len(pending))
+	}
+}
+
+func TestCoinJoinDisabled(t *testing.T) {
+	service := &RPCService{miner: NewMiner("miner1", "localhost:0", 2, nil)}
+	var reply CoinJoinRegisterReply
+	service.CoinJoinRegister(&CoinJoinRegisterArgs{}, &reply)
+	if reply.Success || reply.Error == "" {
+		t.Error("Registration should fail when coinjoin is not enabled")
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"sync"
+)
+
+// ChainPageBlocks is how many blocks FetchChain asks for per GetChain call
+const ChainPageBlocks = 1000
+
+// Deprecated forms of RPC calls. Miners keep serving them so that older
+// clients and scripts go on working, but note each use in the reply's
+// Deprecation field and in GetDeprecations, so operators can tell when a
+// form is no longer used and can be dropped.
+const (
+	DeprecatedSubmitTransaction = "SubmitTransaction"
+	DeprecatedFullChain         = "GetChain without Count"
+)
+
+// deprecations maps each deprecated form to the call that replaces it
+var deprecations = []struct {
+	form        string
+	replacement string
+}{
+	{DeprecatedSubmitTransaction, "sign locally and call SubmitRawTransaction"},
+	{DeprecatedFullChain, fmt.Sprintf("page through the chain with Count (see FetchChain), at most %d blocks per call", ChainPageBlocks)},
+}
+
+// Deprecation reports how often a deprecated form of an RPC call was used
+type Deprecation struct {
+	Form        string
+	Replacement string
+	Calls       int64
+	Callers     int // Distinct remote hosts that used it
+}
+
+// DeprecationsReply lists the deprecated forms a miner still serves
+type DeprecationsReply struct {
+	Deprecations []Deprecation
+}
+
+// deprecationMeter counts uses of the deprecated forms
+type deprecationMeter struct {
+	mu      sync.Mutex
+	calls   map[string]int64
+	callers map[string]map[string]bool
+}
+
+// noteDeprecated records a use of form by peer, logging the first from each caller,
+// and returns the notice to put in the reply
+func (m *Miner) noteDeprecated(form, peer string) string {
+	var replacement string
+	for _, d := range deprecations {
+		if d.form == form {
+			replacement = d.replacement
+		}
+	}
+	notice := fmt.Sprintf("%s is deprecated: %s", form, replacement)
+
+	d := &m.deprecations
+	d.mu.Lock()
+	if d.calls == nil {
+		d.calls = make(map[string]int64)
+		d.callers = make(map[string]map[string]bool)
+	}
+	d.calls[form]++
+	if d.callers[form] == nil {
+		d.callers[form] = make(map[string]bool)
+	}
+	first := !d.callers[form][peer]
+	d.callers[form][peer] = true
+	d.mu.Unlock()
+
+	if first {
+		caller := peer
+		if caller == "" {
+			caller = "in-process caller"
+		}
+		log.Printf("[%s] %s used %s", shortID(m.ID), caller, notice)
+	}
+	return notice
+}
+
+// Deprecations returns the use counts of every deprecated form
+func (m *Miner) Deprecations() []Deprecation {
+	d := &m.deprecations
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]Deprecation, len(deprecations))
+	for i, dep := range deprecations {
+		result[i] = Deprecation{
+			Form:        dep.form,
+			Replacement: dep.replacement,
+			Calls:       d.calls[dep.form],
+			Callers:     len(d.callers[dep.form]),
+		}
+	}
+	return result
+}
+
+// GetDeprecations RPC method to list the deprecated forms and their use
+func (s *RPCService) GetDeprecations(args *struct{}, reply *DeprecationsReply) error {
+	reply.Deprecations = s.miner.Deprecations()
+	return nil
+}
+
+// FetchChain gets a miner's serialized blocks from startIndex to its tip,
+// ChainPageBlocks at a time. Miners predating Count send the rest of the
+// chain in the first reply. It stops early if the miner sends an empty page,
+// so an inflated Length cannot keep it asking.
+func FetchChain(client *rpc.Client, startIndex int64) ([][]byte, error) {
+	var blocks [][]byte
+	for {
+		args := &ChainArgs{StartIndex: startIndex + int64(len(blocks)), Count: ChainPageBlocks, Binary: true}
+		var reply ChainReply
+		if err := client.Call("RPCService.GetChain", args, &reply); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, reply.Blocks...)
+		if len(reply.Blocks) == 0 || args.StartIndex+int64(len(reply.Blocks)) >= int64(reply.Length) {
+			return blocks, nil
+		}
+	}
+}
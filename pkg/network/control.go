@@ -0,0 +1,100 @@
+package network
+
+import "log"
+
+// MiningArgs starts or stops mining
+type MiningArgs struct {
+	Enabled bool
+}
+
+// MiningReply reports whether the miner is mining after the change
+type MiningReply struct {
+	Mining bool
+	Paused string // Why mining is held off by the resource watchdog, if it is
+}
+
+// PeersArgs changes the miner's peer list
+type PeersArgs struct {
+	Add    []PeerInfo
+	Remove []string // Addresses of peers to drop
+}
+
+// PeersReply lists the miner's peers
+type PeersReply struct {
+	Peers    []PeerInfo
+	Features map[string][]string // Protocol features negotiated with each peer, by address
+}
+
+// GetPeers returns a copy of the miner's peer list
+func (m *Miner) GetPeers() []PeerInfo {
+	m.peerMutex.RLock()
+	defer m.peerMutex.RUnlock()
+	peers := make([]PeerInfo, len(m.Peers))
+	copy(peers, m.Peers)
+	return peers
+}
+
+// UpdatePeers drops the peers at the remove addresses, then adds the given
+// peers whose address is not already listed. It returns the new peer list.
+func (m *Miner) UpdatePeers(add []PeerInfo, remove []string) []PeerInfo {
+	m.peerMutex.Lock()
+	defer m.peerMutex.Unlock()
+
+	drop := make(map[string]bool, len(remove))
+	for _, addr := range remove {
+		drop[addr] = true
+	}
+	peers := make([]PeerInfo, 0, len(m.Peers)+len(add))
+	known := make(map[string]bool, len(m.Peers)+len(add))
+	for _, p := range append(m.Peers, add...) {
+		if drop[p.Address] || known[p.Address] {
+			continue
+		}
+		known[p.Address] = true
+		peers = append(peers, p)
+	}
+	m.Peers = peers
+
+	result := make([]PeerInfo, len(peers))
+	copy(result, peers)
+	return result
+}
+
+// IsMining returns true if the mining loop is running
+func (m *Miner) IsMining() bool {
+	m.miningMutex.RLock()
+	defer m.miningMutex.RUnlock()
+	return m.miningEnabled
+}
+
+// SetMining RPC method to start or stop mining
+func (s *RPCService) SetMining(args *MiningArgs, reply *MiningReply) error {
+	if args.Enabled {
+		s.miner.StartMining()
+	} else {
+		s.miner.StopMining()
+	}
+	reply.Mining = s.miner.IsMining()
+	reply.Paused = s.miner.resourcePressure()
+	return nil
+}
+
+// GetPeers RPC method to list the miner's peers
+func (s *RPCService) GetPeers(args *struct{}, reply *PeersReply) error {
+	reply.Peers = s.miner.GetPeers()
+	reply.Features = make(map[string][]string)
+	for _, p := range reply.Peers {
+		if features, ok := s.miner.negotiatedFeatures(p.Address); ok {
+			reply.Features[p.Address] = features
+		}
+	}
+	return nil
+}
+
+// UpdatePeers RPC method to add and remove peers
+func (s *RPCService) UpdatePeers(args *PeersArgs, reply *PeersReply) error {
+	reply.Peers = s.miner.UpdatePeers(args.Add, args.Remove)
+	log.Printf("[%s] Peer list updated (+%d/-%d), now %d peers", shortID(s.miner.ID),
+		len(args.Add), len(args.Remove), len(reply.Peers))
+	return nil
+}
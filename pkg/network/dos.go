@@ -0,0 +1,322 @@
+package network
+
+import (
+	"blockchain/pkg/logging"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxConns bounds the connections the miner serves at once
+	DefaultMaxConns = 256
+
+	// DefaultMaxConnsPerHost bounds the connections one host may hold open
+	DefaultMaxConnsPerHost = 64
+
+	// DefaultCallRate is how many RPC calls per second one host may make
+	DefaultCallRate = 500
+
+	// DefaultCallBurst is how many calls a host may make back to back
+	DefaultCallBurst = 1000
+
+	// DefaultBanThreshold is the misbehavior score at which a host is banned
+	DefaultBanThreshold = 100
+
+	// DefaultBanDuration is how long a ban lasts
+	DefaultBanDuration = 10 * time.Minute
+)
+
+// Misbehavior scores of the offenses a host is charged for. A host reaching
+// the ban threshold is banned, so with the defaults two blocks without valid
+// proof of work or five malformed messages get it banned.
+const (
+	ScoreInvalidPoW   = 50 // Block hash below its claimed difficulty
+	ScoreInvalidBlock = 50 // Block hash or Merkle root not matching its contents, or invalid transactions
+	ScoreMalformed    = 20 // Oversized, undecodable or ill-formed block or transaction
+	ScoreInvalidTx    = 20 // Relayed coinbase, ID not matching its contents, or bad signature or redeem script
+	ScoreBadPrevHash  = 10 // Block at the wrong height for the parent its previous hash names
+)
+
+var (
+	ErrCallRateLimited = errors.New("peer exceeded RPC call rate")
+	ErrPeerBanned      = errors.New("peer is banned")
+)
+
+// ServerLimits bounds what the miner's listener serves to any one host, so a
+// peer flooding it with connections, calls, or invalid data is cut off. Calls
+// made in-process are never limited.
+type ServerLimits struct {
+	MaxConns        int           // Connections served at once (0 = unlimited)
+	MaxConnsPerHost int           // Connections one host may hold open (0 = unlimited)
+	CallRate        float64       // RPC calls per second accepted from each host (0 = unlimited)
+	CallBurst       int           // Per-host burst allowance
+	BanThreshold    int           // Misbehavior score at which a host is banned (0 = never)
+	BanDuration     time.Duration // How long a ban lasts
+}
+
+// DefaultServerLimits returns the server limits used by NewMiner
+func DefaultServerLimits() ServerLimits {
+	return ServerLimits{
+		MaxConns:        DefaultMaxConns,
+		MaxConnsPerHost: DefaultMaxConnsPerHost,
+		CallRate:        DefaultCallRate,
+		CallBurst:       DefaultCallBurst,
+		BanThreshold:    DefaultBanThreshold,
+		BanDuration:     DefaultBanDuration,
+	}
+}
+
+// WithServerLimits sets the connection, call rate, and ban limits of the
+// miner's listener
+func WithServerLimits(limits ServerLimits) MinerOption {
+	return func(o *MinerOptions) {
+		if limits.CallBurst <= 0 {
+			limits.CallBurst = int(math.Ceil(limits.CallRate))
+		}
+		if limits.BanDuration <= 0 {
+			limits.BanDuration = DefaultBanDuration
+		}
+		o.Server = limits
+	}
+}
+
+// dosGuard is the listener's per-host state
+type dosGuard struct {
+	mu      sync.Mutex
+	conns   int
+	open    map[string]map[net.Conn]bool // Connections being served, by host
+	calls   map[string]*tokenBucket
+	scores  map[string]*misbehavior // Misbehavior since the host's last ban
+	banned  map[string]time.Time    // Ban expiry by host
+	refused int64                   // Connections and calls refused
+}
+
+// misbehavior is a host's misbehavior score and its latest offense
+type misbehavior struct {
+	score    int
+	offenses int
+	last     string
+	lastAt   time.Time
+}
+
+func newDOSGuard() *dosGuard {
+	return &dosGuard{
+		open:   make(map[string]map[net.Conn]bool),
+		calls:  make(map[string]*tokenBucket),
+		scores: make(map[string]*misbehavior),
+		banned: make(map[string]time.Time),
+	}
+}
+
+// bannedLocked reports whether host is banned, lifting an expired ban. The
+// caller holds mu.
+func (g *dosGuard) bannedLocked(host string, now time.Time) bool {
+	until, ok := g.banned[host]
+	if !ok {
+		return false
+	}
+	if now.Before(until) {
+		return true
+	}
+	delete(g.banned, host)
+	return false
+}
+
+// admitConn reserves a connection slot for conn, or returns why it is refused
+func (m *Miner) admitConn(conn net.Conn) error {
+	host := peerHost(conn.RemoteAddr().String())
+	limits := m.options.Server
+	g := m.dos
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var err error
+	switch {
+	case g.bannedLocked(host, time.Now()):
+		err = ErrPeerBanned
+	case limits.MaxConns > 0 && g.conns >= limits.MaxConns:
+		err = fmt.Errorf("connection limit of %d reached", limits.MaxConns)
+	case limits.MaxConnsPerHost > 0 && len(g.open[host]) >= limits.MaxConnsPerHost:
+		err = fmt.Errorf("connection limit of %d per host reached", limits.MaxConnsPerHost)
+	}
+	if err != nil {
+		g.refused++
+		return err
+	}
+	g.conns++
+	if g.open[host] == nil {
+		g.open[host] = make(map[net.Conn]bool)
+	}
+	g.open[host][conn] = true
+	return nil
+}
+
+// releaseConn frees the slot of a connection admitted by admitConn
+func (m *Miner) releaseConn(conn net.Conn) {
+	host := peerHost(conn.RemoteAddr().String())
+	g := m.dos
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.open[host][conn] {
+		return
+	}
+	g.conns--
+	if delete(g.open[host], conn); len(g.open[host]) == 0 {
+		delete(g.open, host)
+	}
+}
+
+// allowCall charges one RPC call to host, refusing it if the host is over its
+// call rate or was banned since it connected
+func (m *Miner) allowCall(host string) error {
+	limits := m.options.Server
+	g := m.dos
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if g.bannedLocked(host, now) {
+		g.refused++
+		return ErrPeerBanned
+	}
+	if limits.CallRate <= 0 {
+		return nil
+	}
+	b, ok := g.calls[host]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limits.CallBurst), last: now}
+		g.calls[host] = b
+	}
+	if b.take(limits.CallRate, limits.CallBurst, now) {
+		return nil
+	}
+	g.refused++
+	return ErrCallRateLimited
+}
+
+// misbehaving charges host score points for an offense and, once its score
+// reaches the ban threshold, bans it and drops its open connections.
+// In-process calls have no host and are not charged.
+func (m *Miner) misbehaving(host string, score int, offense string) {
+	limits := m.options.Server
+	if host == "" || limits.BanThreshold <= 0 {
+		return
+	}
+	g := m.dos
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	rec, ok := g.scores[host]
+	if !ok {
+		rec = &misbehavior{}
+		g.scores[host] = rec
+	}
+	rec.score += score
+	rec.offenses++
+	rec.last, rec.lastAt = offense, time.Now()
+	if rec.score < limits.BanThreshold {
+		return
+	}
+	delete(g.scores, host)
+	g.banned[host] = time.Now().Add(limits.BanDuration)
+	for conn := range g.open[host] {
+		conn.Close()
+	}
+	logging.Warnf("[%s] Banned %s for %v at misbehavior score %d, the last offense %s",
+		shortID(m.ID), host, limits.BanDuration, rec.score, offense)
+}
+
+// BannedPeers returns the hosts currently banned and when each ban expires
+func (m *Miner) BannedPeers() map[string]time.Time {
+	g := m.dos
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	banned := make(map[string]time.Time)
+	for host, until := range g.banned {
+		if !g.bannedLocked(host, now) {
+			continue
+		}
+		banned[host] = until
+	}
+	return banned
+}
+
+// PeerScore reports what the listener knows about one host
+type PeerScore struct {
+	Host          string
+	IDs           []string // Configured peers at the host
+	Conns         int      // Connections being served
+	Score         int      // Misbehavior score since the last ban
+	Offenses      int      // Offenses charged since the last ban
+	LastOffense   string
+	LastOffenseAt time.Time
+	BannedUntil   time.Time // Zero unless banned
+}
+
+// PeerInfoReply lists the hosts that are connected, have misbehaved, or are
+// banned, and the threshold their scores are held against
+type PeerInfoReply struct {
+	BanThreshold int
+	BanDuration  time.Duration
+	Peers        []PeerScore // Sorted by host
+}
+
+// PeerScores returns the connections, misbehavior scores, and bans of every
+// host the listener is tracking
+func (m *Miner) PeerScores() PeerInfoReply {
+	ids := make(map[string][]string)
+	for _, p := range m.GetPeers() {
+		host, _, err := net.SplitHostPort(p.Address)
+		if err != nil {
+			host = p.Address
+		}
+		if host == "localhost" {
+			host = "127.0.0.1"
+		}
+		ids[host] = append(ids[host], p.ID)
+	}
+
+	g := m.dos
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	peers := make(map[string]*PeerScore)
+	peer := func(host string) *PeerScore {
+		p, ok := peers[host]
+		if !ok {
+			p = &PeerScore{Host: host, IDs: ids[host]}
+			peers[host] = p
+		}
+		return p
+	}
+	for host, conns := range g.open {
+		peer(host).Conns = len(conns)
+	}
+	for host, rec := range g.scores {
+		p := peer(host)
+		p.Score, p.Offenses = rec.score, rec.offenses
+		p.LastOffense, p.LastOffenseAt = rec.last, rec.lastAt
+	}
+	for host, until := range g.banned {
+		if g.bannedLocked(host, now) {
+			peer(host).BannedUntil = until
+		}
+	}
+
+	reply := PeerInfoReply{BanThreshold: m.options.Server.BanThreshold, BanDuration: m.options.Server.BanDuration}
+	for _, p := range peers {
+		reply.Peers = append(reply.Peers, *p)
+	}
+	sort.Slice(reply.Peers, func(i, j int) bool { return reply.Peers[i].Host < reply.Peers[j].Host })
+	return reply
+}
+
+// GetPeerInfo RPC method to report each host's connections, misbehavior
+// score, and ban
+func (s *RPCService) GetPeerInfo(args *struct{}, reply *PeerInfoReply) error {
+	*reply = s.miner.PeerScores()
+	return nil
+}
@@ -0,0 +1,176 @@
+package network
+
+import (
+	"blockchain/pkg/transaction"
+	"fmt"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerLimitsRateLimitAndCapConnections(t *testing.T) {
+	miner := NewMiner("miner", "localhost:19154", 1, nil,
+		WithServerLimits(ServerLimits{MaxConnsPerHost: 1, CallRate: 1, CallBurst: 2}))
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	client, err := rpc.Dial("tcp", "localhost:19154")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	var status StatusReply
+	for i := 0; i < 2; i++ {
+		if err := client.Call("RPCService.GetStatus", &struct{}{}, &status); err != nil {
+			t.Fatalf("Call %d within the burst failed: %v", i+1, err)
+		}
+	}
+	if err := client.Call("RPCService.GetStatus", &struct{}{}, &status); err == nil || err.Error() != ErrCallRateLimited.Error() {
+		t.Errorf("Expected a call past the burst to be rate limited, got %v", err)
+	}
+
+	// The host already holds its one connection
+	second, err := rpc.Dial("tcp", "localhost:19154")
+	if err == nil {
+		defer second.Close()
+		err = second.Call("RPCService.GetStatus", &struct{}{}, &status)
+	}
+	if err == nil {
+		t.Error("A connection past the per-host cap should be refused")
+	}
+}
+
+func TestPeerBannedAfterInvalidBlocks(t *testing.T) {
+	miner := NewMiner("miner", "localhost:19155", 1, nil,
+		WithServerLimits(ServerLimits{BanThreshold: 3 * ScoreMalformed, BanDuration: time.Hour}))
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	client, err := rpc.Dial("tcp", "localhost:19155")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		var reply BlockReply
+		if err := client.Call("RPCService.ReceiveBlock", &BlockArgs{BlockData: []byte("not a block")}, &reply); err != nil || reply.Success {
+			t.Fatalf("Expected the malformed block to be rejected, got %+v, %v", reply, err)
+		}
+	}
+
+	var info PeerInfoReply
+	if err := client.Call("RPCService.GetPeerInfo", &struct{}{}, &info); err != nil {
+		t.Fatalf("GetPeerInfo failed: %v", err)
+	}
+	if len(info.Peers) != 1 {
+		t.Fatalf("Expected one host in the peer info, got %+v", info.Peers)
+	}
+	if p := info.Peers[0]; p.Host != "127.0.0.1" || p.Score != 2*ScoreMalformed || p.Offenses != 2 ||
+		p.LastOffense != "malformed block" || p.Conns != 1 || !p.BannedUntil.IsZero() {
+		t.Errorf("Unexpected peer info %+v", p)
+	}
+
+	// The third malformed block reaches the threshold, and the host is
+	// disconnected
+	var reply BlockReply
+	client.Call("RPCService.ReceiveBlock", &BlockArgs{BlockData: []byte("not a block")}, &reply)
+	if _, ok := miner.BannedPeers()["127.0.0.1"]; !ok {
+		t.Fatalf("Expected the host to be banned, got %v", miner.BannedPeers())
+	}
+	var status StatusReply
+	if err := client.Call("RPCService.GetStatus", &struct{}{}, &status); err == nil {
+		t.Error("Expected the banned host's connection to be dropped")
+	}
+	again, err := rpc.Dial("tcp", "localhost:19155")
+	if err == nil {
+		defer again.Close()
+		err = again.Call("RPCService.GetStatus", &struct{}{}, &status)
+	}
+	if err == nil {
+		t.Error("A banned host should not be served on a new connection")
+	}
+
+	// In-process calls are not attributed to any host
+	service := &RPCService{miner: miner}
+	if err := service.GetStatus(&struct{}{}, &status); err != nil || status.Banned != 1 || status.Refused < 1 {
+		t.Errorf("Expected one ban and the refusal in the status, got %d and %d (%v)", status.Banned, status.Refused, err)
+	}
+	if err := service.GetPeerInfo(&struct{}{}, &info); err != nil || len(info.Peers) != 1 {
+		t.Fatalf("Expected the banned host in the peer info, got %+v (%v)", info.Peers, err)
+	}
+	if p := info.Peers[0]; p.BannedUntil.IsZero() || p.Score != 0 {
+		t.Errorf("Expected a banned host with its score reset, got %+v", p)
+	}
+}
+
+func TestRelayedTransactionsChargedByCause(t *testing.T) {
+	miner := NewMiner("miner", "localhost:0", 1, nil,
+		WithServerLimits(ServerLimits{BanThreshold: 1000, BanDuration: time.Hour}))
+	kp, _ := transaction.GenerateKeyPair()
+	coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 10000, 100)
+	miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+	payment := func() *transaction.Transaction {
+		tx, err := miner.Blockchain.GetUTXOSet().CreateTransaction(
+			[]struct {
+				TxID     string
+				OutIndex int
+			}{{TxID: coinbase.ID, OutIndex: 0}},
+			[]transaction.TxOutput{{Value: 9000, ScriptPubKey: "bob"}},
+			map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create transaction: %v", err)
+		}
+		return tx
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(tx *transaction.Transaction)
+		score   int
+		offense string
+	}{
+		{"mismatched ID", func(tx *transaction.Transaction) {
+			tx.ID = strings.Repeat("0", 64)
+		}, ScoreInvalidTx, "transaction whose ID does not match its contents"},
+		{"ill-formed", func(tx *transaction.Transaction) {
+			tx.Outputs[0].Value = 0
+			tx.ID = tx.CalculateHash()
+		}, ScoreMalformed, "ill-formed transaction: output 0 has non-positive value 0"},
+		{"invalid signature", func(tx *transaction.Transaction) {
+			tx.Outputs[0].ScriptPubKey = "mallory"
+			tx.ID = tx.CalculateHash()
+		}, ScoreInvalidTx, "transaction with an invalid signature"},
+		{"unknown input", func(tx *transaction.Transaction) {
+			tx.Inputs[0].TxID = strings.Repeat("1", 64)
+			tx.ID = tx.CalculateHash()
+		}, 0, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := payment()
+			tt.tamper(tx)
+			data, _ := tx.Serialize()
+			host := fmt.Sprintf("10.0.0.%d", i+1)
+			var reply TransactionReply
+			(&RPCService{miner: miner, peer: host}).ReceiveTransaction(&BlockArgs{BlockData: data}, &reply)
+			if reply.Success {
+				t.Fatalf("Expected the transaction to be refused")
+			}
+			var got PeerScore
+			for _, p := range miner.PeerScores().Peers {
+				if p.Host == host {
+					got = p
+				}
+			}
+			if got.Score != tt.score || got.LastOffense != tt.offense {
+				t.Errorf("Expected a charge of %d for %q, got %d for %q (%s)", tt.score, tt.offense, got.Score, got.LastOffense, reply.Error)
+			}
+		})
+	}
+}
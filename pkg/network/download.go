@@ -0,0 +1,176 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/logging"
+	"fmt"
+	"log"
+	"net/rpc"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSyncPeers bounds how many peers a sync downloads from at once, the peer
+// whose chain is adopted included
+const maxSyncPeers = 4
+
+// blockRange is a run of missing blocks, as offsets into the sync's headers
+type blockRange struct {
+	start, count int
+}
+
+// fetchRange downloads one range of blocks from a peer and checks each block
+// against its header. prev is the block before the range; its header is
+// enough, as only its index and hash are compared. The time taken,
+// verification included, sizes the next batch asked of the peer.
+func (m *Miner) fetchRange(client *rpc.Client, address string, r blockRange, prev *block.Block, headers []BlockHeader) ([]*block.Block, error) {
+	started := time.Now()
+	blocks, err := m.requestRange(client, address, r, prev, headers)
+	m.syncMeter.observe(address, r.count, time.Since(started), err)
+	return blocks, err
+}
+
+func (m *Miner) requestRange(client *rpc.Client, address string, r blockRange, prev *block.Block, headers []BlockHeader) ([]*block.Block, error) {
+	want := headers[r.start : r.start+r.count]
+	args := &ChainArgs{
+		StartIndex: want[0].Index,
+		Count:      r.count,
+		Compress:   m.peerSupports(address, FeatureCompression),
+		Binary:     m.peerSupports(address, FeatureBinary),
+	}
+	var reply ChainReply
+	if err := client.Call("RPCService.GetChain", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to get chain: %v", err)
+	}
+	if len(reply.Blocks) < r.count {
+		return nil, fmt.Errorf("%w: sent %d blocks from #%d but its headers list %d",
+			ErrInvalidPeerChain, len(reply.Blocks), want[0].Index, r.count)
+	}
+	if len(reply.Blocks) > r.count {
+		m.syncMeter.noteOverrun()
+	}
+	data := reply.Blocks[:r.count]
+	if reply.Compressed {
+		if err := decompressBlocks(data, m.options.Limits.MaxBlockBytes); err != nil {
+			return nil, err
+		}
+	}
+	return m.decodePeerBlocks(data, prev, want)
+}
+
+// downloadBlocks fetches the bodies of headers, which follow prev (nil when
+// they start at genesis). The headers came from source, which can serve every
+// block; other peers download batches alongside it, each batch sized to what
+// its peer delivered before. A batch a helper fails to serve, or serves with
+// blocks not matching the headers, is fetched from source instead, and that
+// helper gets no more batches. Only a failure of source fails the download.
+// Only peers that negotiated FeatureRangeSync are asked for batches; source
+// without it sends every block at once.
+func (m *Miner) downloadBlocks(source *rpc.Client, peer PeerInfo, prev *block.Block, headers []BlockHeader) ([]*block.Block, error) {
+	if !m.peerSupports(peer.Address, FeatureRangeSync) {
+		return m.fetchRange(source, peer.Address, blockRange{0, len(headers)}, prev, headers)
+	}
+	schedule := newSyncSchedule(len(headers), &m.syncMeter)
+	rangePrev := func(r blockRange) *block.Block {
+		if r.start == 0 {
+			return prev
+		}
+		return headers[r.start-1].Block()
+	}
+
+	var mu sync.Mutex
+	served := 1 // Peers downloaded from, source included
+	var wg sync.WaitGroup
+	if len(headers) > m.syncMeter.batch(peer.Address) {
+		for _, helper := range m.syncHelpers(peer) {
+			wg.Add(1)
+			go func(helper PeerInfo) {
+				defer wg.Done()
+				client, err := m.dialPeer(helper.Address, m.options.Limits.MaxChainBytes)
+				m.notePeerResult(helper.Address, err)
+				if err != nil {
+					return
+				}
+				defer client.Close()
+				if !slices.Contains(m.peerFeatures(client, helper), FeatureRangeSync) {
+					return
+				}
+				delivered := false
+				defer func() {
+					if delivered {
+						mu.Lock()
+						served++
+						mu.Unlock()
+					}
+				}()
+				for {
+					r, ok := schedule.take(m.syncMeter.batch(helper.Address))
+					if !ok {
+						return
+					}
+					blocks, err := m.fetchRange(client, helper.Address, r, rangePrev(r), headers)
+					schedule.done(r, blocks)
+					if err != nil {
+						logging.Warnf("[%s] Range from #%d failed from helper %s, retrying from %s: %v",
+							shortID(m.ID), headers[r.start].Index, shortID(helper.ID), shortID(peer.ID), err)
+						return
+					}
+					delivered = true
+				}
+			}(helper)
+		}
+	}
+
+	// The source works through the schedule alongside the helpers, then takes
+	// over whatever they failed to deliver
+	var sourceErr error
+	for {
+		r, ok := schedule.take(m.syncMeter.batch(peer.Address))
+		if !ok {
+			break
+		}
+		var blocks []*block.Block
+		if blocks, sourceErr = m.fetchRange(source, peer.Address, r, rangePrev(r), headers); sourceErr != nil {
+			schedule.abort()
+			break
+		}
+		schedule.done(r, blocks)
+	}
+	wg.Wait()
+	if sourceErr != nil {
+		return nil, sourceErr
+	}
+	for {
+		r, ok := schedule.takeRetry()
+		if !ok {
+			break
+		}
+		m.syncMeter.noteRetry()
+		blocks, err := m.fetchRange(source, peer.Address, r, rangePrev(r), headers)
+		if err != nil {
+			return nil, err
+		}
+		schedule.done(r, blocks)
+	}
+
+	blocks := schedule.blocks()
+	if served > 1 {
+		log.Printf("[%s] Downloaded %d blocks from %d peers", shortID(m.ID), len(blocks), served)
+	}
+	return blocks, nil
+}
+
+// syncHelpers returns the peers besides source to download blocks from
+func (m *Miner) syncHelpers(source PeerInfo) []PeerInfo {
+	var helpers []PeerInfo
+	for _, p := range m.GetPeers() {
+		if len(helpers) == maxSyncPeers-1 {
+			break
+		}
+		if p.Address != source.Address {
+			helpers = append(helpers, p)
+		}
+	}
+	return helpers
+}
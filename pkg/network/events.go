@@ -0,0 +1,267 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of chain events
+const (
+	EventBlock = "block" // A block joined the main chain
+	EventTx    = "tx"    // A transaction was accepted into the mempool
+	EventReorg = "reorg" // Blocks left the main chain for another branch
+)
+
+const (
+	// maxRecentEvents bounds the events kept for GetEvents and for
+	// subscribers resuming after a disconnect
+	maxRecentEvents = 1000
+	// subscriptionBuffer is how many events a subscriber may fall behind by
+	// before it is dropped
+	subscriptionBuffer = 256
+)
+
+// BlockEvent describes a block that joined the main chain
+type BlockEvent struct {
+	Height    int64
+	Hash      string
+	PrevHash  string
+	MinerID   string
+	Timestamp int64
+	Txs       int  // Transactions, the coinbase included
+	Mined     bool // Mined by this miner rather than received or synchronized
+}
+
+// TxEvent describes a transaction accepted into the mempool
+type TxEvent struct {
+	TxID    string
+	Fee     int64
+	Inputs  int
+	Outputs int
+	Value   int64 // Total output value
+}
+
+// ReorgEvent describes a reorg. It is followed by a block event for each
+// attached block.
+type ReorgEvent struct {
+	ForkHeight int64    // Height of the last block both branches share (-1 = none)
+	Detached   []string // Hashes of the blocks that left the main chain, oldest first
+	Attached   []string // Hashes of the blocks that joined it, oldest first
+	Depth      int      // len(Detached)
+}
+
+// Event is a change to the miner's chain or mempool, pushed to subscribers
+// so frontends need not poll GetChain. Exactly one of Block, Tx, and Reorg is
+// set, according to Kind.
+type Event struct {
+	Seq   uint64 // Increases by one per event, so a client can resume after the last it saw
+	Time  time.Time
+	Kind  string
+	Block *BlockEvent `json:",omitempty"`
+	Tx    *TxEvent    `json:",omitempty"`
+	Reorg *ReorgEvent `json:",omitempty"`
+}
+
+// EventsArgs selects the events after Since, of the given kinds (none = all)
+type EventsArgs struct {
+	Since uint64
+	Kinds []string
+	Limit int // Oldest events returned (<= 0 = all kept)
+}
+
+// EventsReply returns events, oldest first
+type EventsReply struct {
+	Events []Event
+	Oldest uint64 // Seq of the oldest event kept; events before it are lost
+	Latest uint64 // Seq of the latest event, of any kind
+}
+
+// Subscription delivers the miner's events as they happen. C is closed when
+// the subscription is closed, the miner stops, or the subscriber falls more
+// than subscriptionBuffer events behind; Lagged reports the last case.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	kinds  []string
+	hub    *eventHub
+	lagged bool
+}
+
+// Lagged reports whether the subscription was dropped for falling behind.
+// It is only meaningful once C is closed.
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// wantsKind reports whether kinds (none = all) includes kind
+func wantsKind(kinds []string, kind string) bool {
+	return len(kinds) == 0 || slices.Contains(kinds, kind)
+}
+
+// eventHub numbers events, keeps the recent ones, and fans them out
+type eventHub struct {
+	mu     sync.Mutex
+	seq    uint64
+	recent []Event // Oldest first
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+// publish numbers e and delivers it to every subscriber that wants it
+func (h *eventHub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e.Seq = h.seq
+	e.Time = time.Now()
+	h.recent = append(h.recent, e)
+	if len(h.recent) > maxRecentEvents {
+		h.recent = h.recent[len(h.recent)-maxRecentEvents:]
+	}
+	for s := range h.subs {
+		if !wantsKind(s.kinds, e.Kind) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.lagged = true
+			h.drop(s)
+		}
+	}
+}
+
+// drop closes a subscription; the caller holds h.mu
+func (h *eventHub) drop(s *Subscription) {
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+// since returns the kept events after seq of the given kinds, oldest first
+// (the caller holds h.mu)
+func (h *eventHub) since(seq uint64, kinds []string) []Event {
+	events := []Event{}
+	for _, e := range h.recent {
+		if e.Seq > seq && wantsKind(kinds, e.Kind) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// SubscribeEvents returns a subscription to the miner's events of the given
+// kinds (none = all). With since > 0, the kept events after since are
+// delivered first, so a client that reconnects misses nothing still kept.
+func (m *Miner) SubscribeEvents(since uint64, kinds ...string) *Subscription {
+	h := &m.events
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var backlog []Event
+	if since > 0 {
+		backlog = h.since(since, kinds)
+	}
+	ch := make(chan Event, subscriptionBuffer+len(backlog))
+	for _, e := range backlog {
+		ch <- e
+	}
+	s := &Subscription{C: ch, ch: ch, kinds: kinds, hub: h}
+	if h.closed {
+		close(ch)
+		return s
+	}
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]bool)
+	}
+	h.subs[s] = true
+	return s
+}
+
+// closeEvents ends every subscription when the miner stops
+func (m *Miner) closeEvents() {
+	h := &m.events
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		h.drop(s)
+	}
+}
+
+// Events returns the kept events selected by args, oldest first
+func (m *Miner) Events(args EventsArgs) EventsReply {
+	h := &m.events
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	reply := EventsReply{Events: h.since(args.Since, args.Kinds), Latest: h.seq}
+	if len(h.recent) > 0 {
+		reply.Oldest = h.recent[0].Seq
+	}
+	if args.Limit > 0 && len(reply.Events) > args.Limit {
+		reply.Events = reply.Events[:args.Limit]
+	}
+	return reply
+}
+
+// publishBlocks publishes a block event for each block joining the main chain
+func (m *Miner) publishBlocks(blocks []*block.Block, mined bool) {
+	for _, b := range blocks {
+		m.events.publish(Event{Kind: EventBlock, Block: &BlockEvent{
+			Height:    b.Index,
+			Hash:      b.Hash,
+			PrevHash:  b.PrevHash,
+			MinerID:   b.MinerID,
+			Timestamp: b.Timestamp,
+			Txs:       len(b.Transactions),
+			Mined:     mined,
+		}})
+	}
+}
+
+// publishReorg publishes a reorg from the branch old to newBranch, which
+// both extend base (nil = genesis replaced), then the attached blocks
+func (m *Miner) publishReorg(base *block.Block, old, newBranch []*block.Block) {
+	e := &ReorgEvent{ForkHeight: -1, Detached: []string{}, Attached: []string{}, Depth: len(old)}
+	if base != nil {
+		e.ForkHeight = base.Index
+	}
+	for _, b := range old {
+		e.Detached = append(e.Detached, b.Hash)
+	}
+	for _, b := range newBranch {
+		e.Attached = append(e.Attached, b.Hash)
+	}
+	m.events.publish(Event{Kind: EventReorg, Reorg: e})
+	m.publishBlocks(newBranch, false)
+}
+
+// publishTx publishes a transaction accepted into the mempool
+func (m *Miner) publishTx(tx *transaction.Transaction, fee int64) {
+	m.events.publish(Event{Kind: EventTx, Tx: &TxEvent{
+		TxID:    tx.ID,
+		Fee:     fee,
+		Inputs:  len(tx.Inputs),
+		Outputs: len(tx.Outputs),
+		Value:   tx.TotalOutputValue(),
+	}})
+}
+
+// GetEvents RPC method to poll for the miner's events, for clients that
+// cannot hold a subscription open
+func (s *RPCService) GetEvents(args *EventsArgs, reply *EventsReply) error {
+	*reply = s.miner.Events(*args)
+	return nil
+}
@@ -0,0 +1,196 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the subscription's next event, failing after a second
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-sub.C:
+		if !ok {
+			t.Fatal("Subscription closed unexpectedly")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func TestEventsFollowChainAndMempool(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	genesis := miner.Blockchain.GetLatestBlock()
+	sub := miner.SubscribeEvents(0)
+	defer sub.Close()
+
+	miner.mineBlock()
+	e := nextEvent(t, sub)
+	if e.Kind != EventBlock || e.Block == nil || !e.Block.Mined || e.Block.Hash != miner.Blockchain.GetLatestBlock().Hash {
+		t.Errorf("Expected a block event for the mined block, got %+v", e)
+	}
+
+	tx := fundedTransactions(t, miner, []int64{25})[0]
+	if err := miner.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	e = nextEvent(t, sub)
+	if e.Kind != EventTx || e.Tx == nil || e.Tx.TxID != tx.ID || e.Tx.Fee != 25 {
+		t.Errorf("Expected a tx event paying 25, got %+v", e)
+	}
+
+	// A longer rival branch from genesis replaces the mined block
+	branch := grindBlocks(genesis, 2, "rival", miner.Blockchain.GetDifficulty())
+	service := &RPCService{miner: miner}
+	for _, b := range branch {
+		data, _ := b.Serialize()
+		service.ReceiveBlock(&BlockArgs{BlockData: data}, &BlockReply{})
+	}
+	e = nextEvent(t, sub)
+	if e.Kind != EventReorg || e.Reorg.ForkHeight != 0 || e.Reorg.Depth != 1 || len(e.Reorg.Attached) != 2 {
+		t.Fatalf("Expected a reorg from genesis attaching 2 blocks, got %+v", e)
+	}
+	for _, b := range branch {
+		if e = nextEvent(t, sub); e.Kind != EventBlock || e.Block.Hash != b.Hash || e.Block.Mined {
+			t.Errorf("Expected a block event for %s, got %+v", b.Hash, e)
+		}
+	}
+
+	// Polling and resuming see the same numbered events
+	all := miner.Events(EventsArgs{})
+	if len(all.Events) != 5 || all.Oldest != 1 || all.Latest != 5 {
+		t.Fatalf("Expected events 1 to 5, got %+v", all)
+	}
+	var reply EventsReply
+	service.GetEvents(&EventsArgs{Since: 1, Kinds: []string{EventTx, EventReorg}}, &reply)
+	if len(reply.Events) != 2 || reply.Events[0].Seq != 2 || reply.Events[1].Kind != EventReorg {
+		t.Errorf("Expected the tx and reorg events after 1, got %+v", reply.Events)
+	}
+	resumed := miner.SubscribeEvents(3, EventBlock)
+	defer resumed.Close()
+	if e = nextEvent(t, resumed); e.Seq != 4 || e.Block.Hash != branch[0].Hash {
+		t.Errorf("Expected the backlog from event 4, got %+v", e)
+	}
+
+	miner.Stop()
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected no further events")
+	}
+	if sub.Lagged() {
+		t.Error("A subscription ended by Stop should not be reported as lagged")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	sub := miner.SubscribeEvents(0, EventBlock)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		miner.events.publish(Event{Kind: EventBlock, Block: &BlockEvent{Height: int64(i)}})
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriptionBuffer || !sub.Lagged() {
+		t.Errorf("Expected %d buffered events and a lagged subscription, got %d, lagged %v", subscriptionBuffer, n, sub.Lagged())
+	}
+}
+
+// dialWebSocket performs a WebSocket handshake for path on srv
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, key)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the RFC 6455 sample accept key, got %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, br
+}
+
+// readServerFrame reads one unmasked frame with a short payload
+func readServerFrame(t *testing.T, conn net.Conn, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(br, ext[:])
+		n = int(ext[0])<<8 | int(ext[1])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestGatewayStreamsEvents(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	miner.mineBlock()
+	srv := httptest.NewServer(NewGateway(miner))
+	defer srv.Close()
+
+	var gwErr gatewayError
+	if code := getJSON(t, srv.URL+"/api/events", &gwErr); code != http.StatusUpgradeRequired {
+		t.Errorf("Expected 426 without a WebSocket upgrade, got %d", code)
+	}
+	if code := getJSON(t, srv.URL+"/api/events?kinds=block,gossip", &gwErr); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown kind, got %d", code)
+	}
+
+	// Without since, only events after the subscription are sent
+	conn, br := dialWebSocket(t, srv, "/api/events?kinds=block")
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond) // Let the handler subscribe
+	miner.mineBlock()
+	opcode, payload := readServerFrame(t, conn, br)
+	var e Event
+	if err := json.Unmarshal(payload, &e); opcode != wsText || err != nil {
+		t.Fatalf("Expected a JSON text message, got opcode %d %q: %v", opcode, payload, err)
+	}
+	if e.Kind != EventBlock || e.Seq != 2 || e.Block.Height != 2 {
+		t.Errorf("Expected the event of block 2, got %+v", e)
+	}
+
+	replay, rbr := dialWebSocket(t, srv, "/api/events?since=1")
+	defer replay.Close()
+	_, payload = readServerFrame(t, replay, rbr)
+	if err := json.Unmarshal(payload, &e); err != nil || e.Seq != 2 {
+		t.Errorf("Expected event 2 replayed, got %q", payload)
+	}
+
+	// A masked close frame from the client is answered with a close frame
+	replay.Write([]byte{0x88, 0x80, 1, 2, 3, 4})
+	if opcode, _ := readServerFrame(t, replay, rbr); opcode != wsClose {
+		t.Errorf("Expected a close frame, got opcode %d", opcode)
+	}
+
+	miner.Stop()
+	if opcode, payload := readServerFrame(t, conn, br); opcode != wsClose || len(payload) < 2 || int(payload[0])<<8|int(payload[1]) != wsCloseGoingAway {
+		t.Errorf("Expected a going-away close when the miner stops, got opcode %d %v", opcode, payload)
+	}
+}
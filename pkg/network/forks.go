@@ -0,0 +1,211 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/logging"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// DefaultForkReportDepth is the shallowest reorg the fork monitor reports
+	DefaultForkReportDepth = 2
+
+	// maxForkReports bounds the reports kept for GetForkReports
+	maxForkReports = 50
+)
+
+// ForkMonitorConfig sets which reorgs the miner reports and where
+type ForkMonitorConfig struct {
+	MinDepth int    // Reorgs removing at least this many of our blocks are reported (default DefaultForkReportDepth)
+	Dir      string // If set, each report is also written there as <ID>.json
+}
+
+// ForkReport describes a reorg: the branch the miner gave up, the branch it
+// adopted from a peer, who mined them, and which transactions moved
+type ForkReport struct {
+	ID         string
+	DetectedAt time.Time
+	Peer       PeerInfo // The peer whose chain was adopted
+	ForkHeight int64    // Height of the last block both branches share
+	ForkTime   int64    // Timestamp of that block (Unix nanoseconds)
+	Depth      int      // Blocks of ours the reorg removed
+	// Time from the first block after the fork, on either branch, to the reorg
+	Duration  time.Duration
+	OldBranch []BlockHeader // Our blocks after the fork, oldest first
+	NewBranch []BlockHeader // The adopted blocks after the fork, oldest first
+	OldMiners []string      // Distinct miners of the old branch
+	NewMiners []string      // Distinct miners of the new branch
+	// Transactions confirmed only on the old branch, now unconfirmed
+	DroppedTxs []string
+	// Transactions confirmed only on the new branch
+	AddedTxs []string
+}
+
+// ForkReportsArgs selects the most recent reports; Limit <= 0 means all kept
+type ForkReportsArgs struct {
+	Limit int
+}
+
+// ForkReportsReply returns fork reports, oldest first
+type ForkReportsReply struct {
+	Enabled  bool
+	MinDepth int
+	Reports  []ForkReport
+}
+
+// WithForkMonitor makes the miner write an incident report whenever adopting
+// a peer's chain removes at least MinDepth of its own blocks
+func WithForkMonitor(cfg ForkMonitorConfig) MinerOption {
+	return func(o *MinerOptions) {
+		if cfg.MinDepth <= 0 {
+			cfg.MinDepth = DefaultForkReportDepth
+		}
+		o.ForkMonitor = &cfg
+	}
+}
+
+// forkPoint returns the height of the first block of blocks that is not in
+// the miner's chain. Reorgs are usually shallow, so it searches from the tip.
+func (m *Miner) forkPoint(blocks []*block.Block) int64 {
+	for i := min(int64(len(blocks)), int64(m.Blockchain.GetLength())) - 1; i >= 0; i-- {
+		if b := m.Blockchain.GetBlockByHash(blocks[i].Hash); b != nil && b.Index == i {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// summarizeBranch returns the headers of a branch, its distinct miners, and
+// the IDs of the transactions it confirms, coinbases aside
+func summarizeBranch(blocks []*block.Block) ([]BlockHeader, []string, map[string]bool) {
+	headers := make([]BlockHeader, len(blocks))
+	miners := []string{}
+	txs := make(map[string]bool)
+	for i, b := range blocks {
+		headers[i] = headerOf(b)
+		if !slices.Contains(miners, b.MinerID) {
+			miners = append(miners, b.MinerID)
+		}
+		for _, tx := range b.Transactions {
+			if !tx.IsCoinbase() {
+				txs[tx.ID] = true
+			}
+		}
+	}
+	return headers, miners, txs
+}
+
+// onlyIn returns the IDs of the transactions confirmed by blocks that are
+// missing from other, in block order
+func onlyIn(blocks []*block.Block, other map[string]bool) []string {
+	ids := []string{}
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if !tx.IsCoinbase() && !other[tx.ID] {
+				ids = append(ids, tx.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// newForkReport builds the report of replacing old with newBranch from peer,
+// both following base (nil when they start at genesis)
+func newForkReport(peer PeerInfo, base *block.Block, old, newBranch []*block.Block) ForkReport {
+	now := time.Now()
+	forkHeight := int64(-1)
+	if base != nil {
+		forkHeight = base.Index
+	}
+	report := ForkReport{
+		ID:         fmt.Sprintf("fork-%d-%d", forkHeight, now.UnixNano()),
+		DetectedAt: now,
+		Peer:       peer,
+		ForkHeight: forkHeight,
+		Depth:      len(old),
+	}
+	if base != nil {
+		report.ForkTime = base.Timestamp
+	}
+
+	first := now.UnixNano()
+	for _, branch := range [][]*block.Block{old, newBranch} {
+		if len(branch) > 0 {
+			first = min(first, branch[0].Timestamp)
+		}
+	}
+	report.Duration = time.Duration(now.UnixNano() - first)
+
+	var oldTxs, newTxs map[string]bool
+	report.OldBranch, report.OldMiners, oldTxs = summarizeBranch(old)
+	report.NewBranch, report.NewMiners, newTxs = summarizeBranch(newBranch)
+	report.DroppedTxs = onlyIn(old, newTxs)
+	report.AddedTxs = onlyIn(newBranch, oldTxs)
+	return report
+}
+
+// noteReorg records a report of a reorg that replaced old with newBranch
+// above base, if it is deep enough, and writes it to the report directory
+func (m *Miner) noteReorg(peer PeerInfo, base *block.Block, old, newBranch []*block.Block) {
+	cfg := m.options.ForkMonitor
+	if len(old) < cfg.MinDepth {
+		return
+	}
+	report := newForkReport(peer, base, old, newBranch)
+	logging.Warnf("[%s] FORK ALERT: reorg of %d blocks below height %d to peer %s's chain (%d transactions dropped), report %s",
+		shortID(m.ID), report.Depth, report.ForkHeight, shortID(peer.ID), len(report.DroppedTxs), report.ID)
+
+	m.forkMutex.Lock()
+	m.forkReports = append(m.forkReports, report)
+	if len(m.forkReports) > maxForkReports {
+		m.forkReports = m.forkReports[len(m.forkReports)-maxForkReports:]
+	}
+	m.forkMutex.Unlock()
+
+	if cfg.Dir == "" {
+		return
+	}
+	if err := writeForkReport(cfg.Dir, report); err != nil {
+		logging.Errorf("[%s] Failed to write fork report %s: %v", shortID(m.ID), report.ID, err)
+	}
+}
+
+// writeForkReport writes report to dir as indented JSON
+func writeForkReport(dir string, report ForkReport) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, report.ID+".json"), data, 0644)
+}
+
+// ForkReports returns up to limit of the most recent fork reports, oldest first
+func (m *Miner) ForkReports(limit int) []ForkReport {
+	m.forkMutex.Lock()
+	defer m.forkMutex.Unlock()
+	reports := m.forkReports
+	if limit > 0 && len(reports) > limit {
+		reports = reports[len(reports)-limit:]
+	}
+	return append([]ForkReport(nil), reports...)
+}
+
+// GetForkReports RPC method to list the fork monitor's incident reports
+func (s *RPCService) GetForkReports(args *ForkReportsArgs, reply *ForkReportsReply) error {
+	cfg := s.miner.options.ForkMonitor
+	if cfg == nil {
+		return nil
+	}
+	reply.Enabled = true
+	reply.MinDepth = cfg.MinDepth
+	reply.Reports = s.miner.ForkReports(args.Limit)
+	return nil
+}
@@ -0,0 +1,164 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestForkMonitorReportsDeepReorg(t *testing.T) {
+	peer := NewMiner("peer", "localhost:19113", 1, nil)
+	peer.mineBlock()
+	shared := peer.Blockchain.GetBlocks()
+
+	dir := t.TempDir()
+	honest := NewMiner("honest", "localhost:0", 1, nil, WithForkMonitor(ForkMonitorConfig{Dir: dir}))
+	honest.Blockchain = blockchain.NewBlockchainFromBlocks(shared, 1)
+	pending := fundedTransactions(t, honest, []int64{10})[0]
+	honest.AddTransaction(pending)
+	honest.mineBlock()
+	honest.mineBlock()
+
+	for i := 0; i < 3; i++ {
+		peer.mineBlock()
+	}
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer peer.Stop()
+
+	if err := honest.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19113"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	reports := honest.ForkReports(0)
+	if len(reports) != 1 {
+		t.Fatalf("Expected one fork report, got %d", len(reports))
+	}
+	report := reports[0]
+	if report.ForkHeight != 1 || report.Depth != 2 || len(report.OldBranch) != 2 || len(report.NewBranch) != 3 {
+		t.Errorf("Expected 2 blocks replaced by 3 above height 1, got %+v", report)
+	}
+	if !slices.Equal(report.OldMiners, []string{"honest"}) || !slices.Equal(report.NewMiners, []string{"peer"}) {
+		t.Errorf("Unexpected miners: old %v, new %v", report.OldMiners, report.NewMiners)
+	}
+	if !slices.Equal(report.DroppedTxs, []string{pending.ID}) || len(report.AddedTxs) != 0 {
+		t.Errorf("Expected %s dropped, got dropped %v, added %v", pending.ID, report.DroppedTxs, report.AddedTxs)
+	}
+	if report.ForkTime != shared[1].Timestamp || report.Duration <= 0 {
+		t.Errorf("Unexpected timing: fork %d, duration %v", report.ForkTime, report.Duration)
+	}
+	if _, err := os.Stat(filepath.Join(dir, report.ID+".json")); err != nil {
+		t.Errorf("Report should be written to disk: %v", err)
+	}
+
+	var reply ForkReportsReply
+	(&RPCService{miner: honest}).GetForkReports(&ForkReportsArgs{}, &reply)
+	if !reply.Enabled || reply.MinDepth != DefaultForkReportDepth || len(reply.Reports) != 1 {
+		t.Errorf("Unexpected GetForkReports reply: %+v", reply)
+	}
+
+	// Extending the chain is not a reorg
+	peer.mineBlock()
+	if err := honest.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19113"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(honest.ForkReports(0)) != 1 {
+		t.Error("A plain extension should not be reported")
+	}
+}
+
+func TestReceiveBlockReorganizesToSideBranch(t *testing.T) {
+	honest := NewMiner("honest", "localhost:0", 1, nil, WithForkMonitor(ForkMonitorConfig{MinDepth: 1}))
+	genesis := honest.Blockchain.GetLatestBlock()
+	honest.mineBlock()
+
+	// A rival branch one block behind stays on the side, then overtakes
+	branch := grindBlocks(genesis, 2, "rival", honest.Blockchain.GetDifficulty())
+	service := &RPCService{miner: honest}
+	var reply BlockReply
+	data, _ := branch[0].Serialize()
+	service.ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+	if reply.Success || reply.Error != "kept on a side branch" {
+		t.Fatalf("Expected the block kept on a side branch, got %+v", reply)
+	}
+
+	reply = BlockReply{}
+	data, _ = branch[1].Serialize()
+	service.ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+	if !reply.Success || honest.Blockchain.GetLatestBlock().Hash != branch[1].Hash {
+		t.Fatalf("Expected a reorg to the rival branch, got %+v", reply)
+	}
+	reports := honest.ForkReports(0)
+	if len(reports) != 1 || reports[0].ForkHeight != 0 || reports[0].Depth != 1 || reports[0].Peer.ID != "rival" {
+		t.Errorf("Expected one report of a 1-block reorg by rival, got %+v", reports)
+	}
+}
+
+func TestReceiveBlockReturnsDetachedTransactions(t *testing.T) {
+	miner := NewMiner("honest", "localhost:0", 1, nil)
+	genesis := miner.Blockchain.GetLatestBlock()
+	kp, _ := transaction.GenerateKeyPair()
+	spend := func(coinbase *transaction.Transaction, to string) *transaction.Transaction {
+		tx, err := miner.Blockchain.GetUTXOSet().CreateTransaction(
+			[]struct {
+				TxID     string
+				OutIndex int
+			}{{TxID: coinbase.ID, OutIndex: 0}},
+			[]transaction.TxOutput{{Value: 9900, ScriptPubKey: to}},
+			map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create transaction: %v", err)
+		}
+		return tx
+	}
+	var txs []*transaction.Transaction
+	for i := int64(0); i < 3; i++ {
+		coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 10000, 100+i)
+		miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+		txs = append(txs, spend(coinbase, "bob"))
+	}
+	kept, confirmed, conflicted := txs[0], txs[1], txs[2]
+	rivalSpend := spend(&transaction.Transaction{ID: conflicted.Inputs[0].TxID}, "carol")
+	for _, tx := range txs {
+		if err := miner.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	miner.mineBlock()
+	if n := len(miner.GetPendingTransactions()); n != 0 || len(miner.Blockchain.GetLatestBlock().Transactions) != 4 {
+		t.Fatalf("Expected the three transactions mined, %d still pending", n)
+	}
+
+	// The rival branch confirms one of them and double-spends another
+	first := block.NewBlock(1, []*transaction.Transaction{transaction.NewCoinbaseTransaction("rival", 0, 1), confirmed, rivalSpend},
+		genesis.Hash, miner.Blockchain.GetDifficulty(), "rival",
+		block.WithMerkleTree(genesis.UsesMerkleTree()), block.WithPowAlgorithm(genesis.PowAlgorithm))
+	pow.NewProofOfWork(first).Mine(context.TODO(), nil)
+	service := &RPCService{miner: miner}
+	for _, b := range append([]*block.Block{first}, grindBlocks(first, 1, "rival", miner.Blockchain.GetDifficulty())...) {
+		data, _ := b.Serialize()
+		service.ReceiveBlock(&BlockArgs{BlockData: data}, &BlockReply{})
+	}
+	if tip := miner.Blockchain.GetLatestBlock(); tip.Index != 2 || tip.MinerID != "rival" {
+		t.Fatalf("Expected a reorg to the rival branch, tip is #%d by %s", tip.Index, tip.MinerID)
+	}
+
+	pending := miner.GetPendingTransactions()
+	if len(pending) != 1 || pending[0].ID != kept.ID {
+		t.Errorf("Expected only %s pending again, got %d transactions", kept.ID, len(pending))
+	}
+	if s := miner.TxStatus(confirmed.ID); s.Status != TxConfirmed {
+		t.Errorf("Expected the transaction the rival confirmed to stay confirmed, got %+v", s)
+	}
+	if s := miner.TxStatus(conflicted.ID); s.Status != TxDropped || !strings.Contains(s.Reason, "height 1 left the main chain") {
+		t.Errorf("Expected the double-spent transaction dropped, got %+v", s)
+	}
+}
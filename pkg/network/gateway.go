@@ -0,0 +1,515 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gatewayMaxBodyBytes bounds an HTTP request body (the same as a transaction)
+const gatewayMaxBodyBytes = DefaultMaxTxBytes
+
+// gatewayMethod is an RPCService method callable through the gateway
+type gatewayMethod struct {
+	fn        reflect.Value
+	argType   reflect.Type
+	replyType reflect.Type
+}
+
+// Gateway serves the miner's RPCService methods as an HTTP JSON API, so web
+// frontends can talk to a miner without the Go net/rpc protocol. Calls run
+// in-process under the same access policy and audit log as RPC connections;
+// a token is presented as "Authorization: Bearer <token>", or a request is
+// signed by a registered key in the X-Auth-* headers (see SignHTTPRequest).
+//
+//	GET  /api/status               GetStatus
+//	GET  /api/chain?start=<n>&count=<n> GetChain, with blocks as JSON objects (no count: deprecated, every block)
+//	GET  /api/blocks/{id}          GetBlock by hash or height
+//	GET  /api/address/{address}    GetAddress (balance, UTXOs, history)
+//	GET  /api/leaderboard          GetLeaderboard, heights ?from=&to= (default: all)
+//	GET  /api/miners/{id}/blocks   GetMinerBlocks, heights ?from=&to= (default: all)
+//	POST /api/transactions         SubmitTransaction (TransactionArgs as JSON; deprecated, carries private keys)
+//	POST /api/rpc/{method}         Any RPCService method, arguments as JSON
+//	GET  /api/events               WebSocket stream of events as JSON, ?kinds=block,tx,reorg&since=<seq>
+type Gateway struct {
+	miner   *Miner
+	methods map[string]gatewayMethod
+}
+
+// NewGateway returns an http.Handler serving m's JSON API under /api/
+func NewGateway(m *Miner) http.Handler {
+	g := newGateway(m)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", g.handleStatus)
+	mux.HandleFunc("GET /api/chain", g.handleChain)
+	mux.HandleFunc("GET /api/blocks/{id}", g.handleBlock)
+	mux.HandleFunc("GET /api/address/{address}", g.handleAddress)
+	mux.HandleFunc("GET /api/leaderboard", g.handleLeaderboard)
+	mux.HandleFunc("GET /api/miners/{id}/blocks", g.handleMinerBlocks)
+	mux.HandleFunc("POST /api/transactions", g.handleSubmit)
+	mux.HandleFunc("GET /api/transactions/{txid}", g.handleTxStatus)
+	mux.HandleFunc("GET /api/transactions/{txid}/proof", g.handleMerkleProof)
+	mux.HandleFunc("POST /api/rpc/{method}", g.handleRPC)
+	mux.HandleFunc("GET /api/events", g.handleEvents)
+	mux.HandleFunc("OPTIONS /api/", func(w http.ResponseWriter, r *http.Request) {})
+	return withCORS(mux)
+}
+
+// newGateway indexes m's RPCService methods for calls over HTTP
+func newGateway(m *Miner) *Gateway {
+	g := &Gateway{miner: m, methods: make(map[string]gatewayMethod)}
+	typ := reflect.TypeOf(&RPCService{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		mt := method.Type
+		// Authenticate only changes the role of a persistent connection
+		if method.Name == "Authenticate" || mt.NumIn() != 3 || mt.NumOut() != 1 ||
+			mt.In(1).Kind() != reflect.Pointer || mt.In(2).Kind() != reflect.Pointer {
+			continue
+		}
+		g.methods[method.Name] = gatewayMethod{
+			fn:        method.Func,
+			argType:   mt.In(1).Elem(),
+			replyType: mt.In(2).Elem(),
+		}
+	}
+	return g
+}
+
+// withCORS lets browser frontends served from other origins call the API
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+
+			"X-Auth-Key, X-Auth-Timestamp, X-Auth-Nonce, X-Auth-Signature")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gatewayError is the JSON body of a failed request
+type gatewayError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, gatewayError{Error: msg})
+}
+
+// Headers of a request signed by a registered key
+const (
+	headerAuthKey       = "X-Auth-Key"
+	headerAuthTimestamp = "X-Auth-Timestamp"
+	headerAuthNonce     = "X-Auth-Nonce"
+	headerAuthSignature = "X-Auth-Signature"
+)
+
+// httpScope is the scope signed for an HTTP request: its method, path and
+// query, and the SHA-256 of its body, so a signature covers exactly one call
+func httpScope(method, uri string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + " " + uri + " " + hex.EncodeToString(sum[:])
+}
+
+// SignHTTPRequest signs req for a gateway with a hex private key whose public
+// key is listed in the miner's access policy. Each signature is valid once,
+// so a retried request must be signed again.
+func SignHTTPRequest(req *http.Request, signingKey string) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	signed, err := access.Sign(signingKey, httpScope(req.Method, req.URL.RequestURI(), body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerAuthKey, signed.PublicKey)
+	req.Header.Set(headerAuthTimestamp, strconv.FormatInt(signed.Timestamp, 10))
+	req.Header.Set(headerAuthNonce, signed.Nonce)
+	req.Header.Set(headerAuthSignature, signed.Signature)
+	return nil
+}
+
+// session returns the session of an HTTP request: the anonymous role, or the
+// role of its bearer token, signing key, or TLS client certificate. It is nil
+// if the miner has no access policy.
+func (g *Gateway) session(r *http.Request) (*session, error) {
+	sess := g.miner.newSession()
+	if sess == nil {
+		return nil, nil
+	}
+	g.miner.certSession(sess, r.TLS)
+	if key := r.Header.Get(headerAuthKey); key != "" {
+		return g.signedSession(r, sess, key)
+	}
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return sess, nil
+	}
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return nil, fmt.Errorf("%w: expected a Bearer token", access.ErrInvalidToken)
+	}
+	role, err := g.miner.options.Access.Authenticate(token)
+	if err != nil {
+		return nil, err
+	}
+	sess.role = role
+	sess.caller = access.TokenID(token)
+	return sess, nil
+}
+
+// signedSession authenticates a request signed by key. The body is read to
+// check the signature and put back for the handler.
+func (g *Gateway) signedSession(r *http.Request, sess *session, key string) (*session, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, gatewayMaxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	timestamp, err := strconv.ParseInt(r.Header.Get(headerAuthTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s", access.ErrInvalidSignature, headerAuthTimestamp)
+	}
+	signed := access.Signed{
+		PublicKey: key,
+		Timestamp: timestamp,
+		Nonce:     r.Header.Get(headerAuthNonce),
+		Signature: r.Header.Get(headerAuthSignature),
+	}
+	role, err := g.miner.options.Access.AuthenticateSigned(signed, httpScope(r.Method, r.URL.RequestURI(), body))
+	if err != nil {
+		return nil, err
+	}
+	sess.role = role
+	sess.caller = access.KeyID(key)
+	return sess, nil
+}
+
+// call runs an RPCService method for an HTTP request, applying the access
+// policy and audit log. On failure it writes the error response and returns
+// false.
+func (g *Gateway) call(w http.ResponseWriter, r *http.Request, name string, args any) (any, bool) {
+	reply, status, err := g.invoke(r, name, args)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return nil, false
+	}
+	return reply, true
+}
+
+// invoke runs an RPCService method for an HTTP request, applying the access
+// policy and audit log. On failure it returns the HTTP status to answer with.
+func (g *Gateway) invoke(r *http.Request, name string, args any) (any, int, error) {
+	method, ok := g.methods[name]
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("unknown method %s", name)
+	}
+	sess, err := g.session(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	full := "RPCService." + name
+	remote := peerHost(r.RemoteAddr)
+	var auditor *callAuditor
+	var denied error
+	if sess != nil {
+		denied = sess.authorize(full)
+		if g.miner.options.Audit != nil {
+			auditor = newCallAuditor(g.miner, sess, remote)
+			auditor.request(0, full, args, denied)
+		}
+	}
+	if denied != nil {
+		if auditor != nil {
+			auditor.response(0, denied.Error(), nil)
+		}
+		return nil, http.StatusForbidden, denied
+	}
+
+	reply := reflect.New(method.replyType)
+	service := &RPCService{miner: g.miner, peer: remote, session: sess}
+	out := method.fn.Call([]reflect.Value{reflect.ValueOf(service), reflect.ValueOf(args), reply})
+	callErr, _ := out[0].Interface().(error)
+	if auditor != nil {
+		var errMsg string
+		if callErr != nil {
+			errMsg = callErr.Error()
+		}
+		auditor.response(0, errMsg, reply.Interface())
+	}
+	if callErr != nil {
+		return nil, http.StatusInternalServerError, callErr
+	}
+	return reply.Interface(), http.StatusOK, nil
+}
+
+// decodeArgs reads a method's JSON arguments from the request body; an empty
+// body leaves them zero. The body is put back for checking its signature.
+func (g *Gateway) decodeArgs(r *http.Request, name string) (any, error) {
+	method, ok := g.methods[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %s", name)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, gatewayMaxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	args := reflect.New(method.argType).Interface()
+	if err := json.Unmarshal(body, args); err != nil && len(bytes.TrimSpace(body)) > 0 {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	return args, nil
+}
+
+func (g *Gateway) handleRPC(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.PathValue("method"), "RPCService.")
+	if _, ok := g.methods[name]; !ok {
+		writeError(w, http.StatusNotFound, "unknown method "+name)
+		return
+	}
+	args, err := g.decodeArgs(r, name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reply, ok := g.call(w, r, name, args); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+func (g *Gateway) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if reply, ok := g.call(w, r, "GetStatus", &struct{}{}); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+// chainResponse is a chain reply with its blocks as JSON objects
+type chainResponse struct {
+	Length      int               `json:"length"`
+	Blocks      []json.RawMessage `json:"blocks"`
+	Deprecation string            `json:"deprecation,omitempty"`
+}
+
+func (g *Gateway) handleChain(w http.ResponseWriter, r *http.Request) {
+	var start int64
+	if s := r.URL.Query().Get("start"); s != "" {
+		var err error
+		if start, err = strconv.ParseInt(s, 10, 64); err != nil || start < 0 {
+			writeError(w, http.StatusBadRequest, "invalid start height "+s)
+			return
+		}
+	}
+	var count int
+	if s := r.URL.Query().Get("count"); s != "" {
+		var err error
+		if count, err = strconv.Atoi(s); err != nil || count <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid block count "+s)
+			return
+		}
+	}
+	reply, ok := g.call(w, r, "GetChain", &ChainArgs{StartIndex: start, Count: count})
+	if !ok {
+		return
+	}
+	chain := reply.(*ChainReply)
+	resp := chainResponse{Length: chain.Length, Blocks: make([]json.RawMessage, len(chain.Blocks)), Deprecation: chain.Deprecation}
+	for i, data := range chain.Blocks {
+		resp.Blocks[i] = data // Blocks are serialized as JSON
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (g *Gateway) handleBlock(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	args := &BlockQueryArgs{Hash: id}
+	if height, err := strconv.ParseInt(id, 10, 64); err == nil {
+		args = &BlockQueryArgs{Height: height}
+	}
+	reply, ok := g.call(w, r, "GetBlock", args)
+	if !ok {
+		return
+	}
+	found := reply.(*BlockQueryReply)
+	if !found.Found {
+		writeError(w, http.StatusNotFound, "block "+id+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(found.BlockData))
+}
+
+func (g *Gateway) handleAddress(w http.ResponseWriter, r *http.Request) {
+	if reply, ok := g.call(w, r, "GetAddress", &AddressArgs{Address: r.PathValue("address")}); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+func (g *Gateway) handleTxStatus(w http.ResponseWriter, r *http.Request) {
+	if reply, ok := g.call(w, r, "GetTxStatus", &TxQueryArgs{TxID: r.PathValue("txid")}); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+func (g *Gateway) handleMerkleProof(w http.ResponseWriter, r *http.Request) {
+	if reply, ok := g.call(w, r, "GetMerkleProof", &TxQueryArgs{TxID: r.PathValue("txid")}); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+// heightRange reads the from and to query parameters; both are optional
+func heightRange(r *http.Request) (HeightRangeArgs, error) {
+	args := HeightRangeArgs{ToHeight: -1}
+	for name, dst := range map[string]*int64{"from": &args.FromHeight, "to": &args.ToHeight} {
+		if v := r.URL.Query().Get(name); v != "" {
+			height, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return args, fmt.Errorf("invalid %s height %s", name, v)
+			}
+			*dst = height
+		}
+	}
+	return args, nil
+}
+
+func (g *Gateway) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	args, err := heightRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reply, ok := g.call(w, r, "GetLeaderboard", &args); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+func (g *Gateway) handleMinerBlocks(w http.ResponseWriter, r *http.Request) {
+	args, err := heightRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reply, ok := g.call(w, r, "GetMinerBlocks", &MinerBlocksArgs{MinerID: r.PathValue("id"), HeightRangeArgs: args}); ok {
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
+
+func (g *Gateway) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	args, err := g.decodeArgs(r, "SubmitTransaction")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	reply, ok := g.call(w, r, "SubmitTransaction", args)
+	if !ok {
+		return
+	}
+	status := http.StatusOK
+	if !reply.(*TransactionReply).Success {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, reply)
+}
+
+// handleEvents streams the miner's events over a WebSocket, one JSON Event
+// per text message, under the access policy of GetEvents. Browsers cannot
+// set headers on a WebSocket, so a token may also be given as ?token=.
+func (g *Gateway) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since uint64
+	if s := q.Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid event sequence "+s)
+			return
+		}
+	}
+	var kinds []string
+	if s := q.Get("kinds"); s != "" {
+		for _, kind := range strings.Split(s, ",") {
+			if kind != EventBlock && kind != EventTx && kind != EventReorg {
+				writeError(w, http.StatusBadRequest, "unknown event kind "+kind)
+				return
+			}
+			kinds = append(kinds, kind)
+		}
+	}
+	if token := q.Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	sess, err := g.session(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if sess != nil {
+		if denied := sess.authorize("RPCService.GetEvents"); denied != nil {
+			writeError(w, http.StatusForbidden, denied.Error())
+			return
+		}
+	}
+
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	sub := g.miner.SubscribeEvents(since, kinds...)
+	defer sub.Close()
+	closed := make(chan struct{})
+	go func() {
+		ws.readLoop()
+		close(closed)
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					ws.writeClose(wsClosePolicy, "fell too far behind; reconnect with since")
+				} else {
+					ws.writeClose(wsCloseGoingAway, "miner stopped")
+				}
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if err := ws.writeText(data); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := ws.writeFrame(wsPing, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s returned invalid JSON: %v", url, err)
+	}
+	return resp.StatusCode
+}
+
+func TestGatewayServesRPCMethods(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	miner.mineBlock()
+	srv := httptest.NewServer(NewGateway(miner))
+	defer srv.Close()
+
+	var status StatusReply
+	if code := getJSON(t, srv.URL+"/api/status", &status); code != http.StatusOK || status.ChainLength != 2 {
+		t.Errorf("Expected status of a 2-block chain, got %d %+v", code, status)
+	}
+
+	var chain struct {
+		Length int
+		Blocks []block.Block
+	}
+	getJSON(t, srv.URL+"/api/chain?start=1", &chain)
+	tip := miner.Blockchain.GetLatestBlock()
+	if chain.Length != 2 || len(chain.Blocks) != 1 || chain.Blocks[0].Hash != tip.Hash {
+		t.Errorf("Expected the tip block from height 1, got %+v", chain)
+	}
+
+	var b block.Block
+	if code := getJSON(t, srv.URL+"/api/blocks/"+tip.Hash, &b); code != http.StatusOK || b.Index != 1 {
+		t.Errorf("Expected block 1 by hash, got %d %+v", code, b)
+	}
+	var gwErr gatewayError
+	if code := getJSON(t, srv.URL+"/api/blocks/99", &gwErr); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing block, got %d", code)
+	}
+
+	var addr AddressReply
+	payee := tip.Transactions[0].Outputs[0].ScriptPubKey
+	getJSON(t, srv.URL+"/api/address/"+payee, &addr)
+	if addr.Balance != tip.Transactions[0].Outputs[0].Value || len(addr.UTXOs) != 1 {
+		t.Errorf("Expected the coinbase balance for %s, got %+v", payee, addr)
+	}
+
+	var board LeaderboardReply
+	if code := getJSON(t, srv.URL+"/api/leaderboard", &board); code != http.StatusOK ||
+		len(board.Miners) != 1 || board.Miners[0].MinerID != "miner1" || board.Miners[0].Blocks != 1 {
+		t.Errorf("Expected miner1 with one block on the leaderboard, got %d %+v", code, board)
+	}
+	var mined MinerBlocksReply
+	getJSON(t, srv.URL+"/api/miners/miner1/blocks?from=1&to=1", &mined)
+	if len(mined.Blocks) != 1 || mined.Blocks[0].Hash != tip.Hash {
+		t.Errorf("Expected miner1's block at height 1, got %+v", mined)
+	}
+	if code := getJSON(t, srv.URL+"/api/leaderboard?from=x", &gwErr); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid height, got %d", code)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/rpc/RPCService.GetBlock", "application/json", bytes.NewBufferString(`{"Height": 1}`))
+	if err != nil {
+		t.Fatalf("Generic RPC call failed: %v", err)
+	}
+	var found BlockQueryReply
+	json.NewDecoder(resp.Body).Decode(&found)
+	resp.Body.Close()
+	if !found.Found {
+		t.Errorf("Generic GetBlock should find block 1")
+	}
+
+	resp, _ = http.Post(srv.URL+"/api/transactions", "application/json", bytes.NewBufferString(`{"Outputs": []}`))
+	var txReply TransactionReply
+	json.NewDecoder(resp.Body).Decode(&txReply)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || txReply.Success || txReply.Error == "" {
+		t.Errorf("Invalid transaction should be rejected with 400, got %d %+v", resp.StatusCode, txReply)
+	}
+}
+
+func TestGatewayAppliesAccessPolicy(t *testing.T) {
+	policy := access.NewPolicy(access.RoleObserver)
+	policy.SetToken("op-token", access.RoleOperator)
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithAccessPolicy(policy))
+	srv := httptest.NewServer(NewGateway(miner))
+	defer srv.Close()
+
+	post := func(token string) int {
+		req, _ := http.NewRequest("POST", srv.URL+"/api/rpc/SetMining", bytes.NewBufferString(`{"Enabled": false}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(""); code != http.StatusForbidden {
+		t.Errorf("Anonymous observer should get 403, got %d", code)
+	}
+	if code := post("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Unknown token should get 401, got %d", code)
+	}
+	if code := post("op-token"); code != http.StatusOK {
+		t.Errorf("Operator should be allowed, got %d", code)
+	}
+
+	var status StatusReply
+	if code := getJSON(t, srv.URL+"/api/status", &status); code != http.StatusOK {
+		t.Errorf("Anonymous observer should read status, got %d", code)
+	}
+}
+
+func TestGatewayAcceptsSignedRequests(t *testing.T) {
+	bot, _ := transaction.GenerateKeyPair()
+	policy := access.NewPolicy(access.RoleObserver)
+	policy.SetKey(bot.GetPublicKeyHex(), access.RoleOperator)
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithAccessPolicy(policy))
+	srv := httptest.NewServer(NewGateway(miner))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL+"/api/rpc/SetMining", bytes.NewBufferString(`{"Enabled": false}`))
+	if err := SignHTTPRequest(req, bot.GetPrivateKeyHex()); err != nil {
+		t.Fatalf("SignHTTPRequest failed: %v", err)
+	}
+	replay, _ := http.NewRequest("POST", srv.URL+"/api/rpc/SetMining", bytes.NewBufferString(`{"Enabled": false}`))
+	replay.Header = req.Header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Signed operator request should be allowed, got %d", resp.StatusCode)
+	}
+
+	if resp, err = http.DefaultClient.Do(replay); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Replayed request should get 401, got %d", resp.StatusCode)
+		}
+	}
+
+	// The signature covers the body, so it cannot be moved to other arguments
+	signed, _ := http.NewRequest("POST", srv.URL+"/api/rpc/SetMining", bytes.NewBufferString(`{"Enabled": false}`))
+	SignHTTPRequest(signed, bot.GetPrivateKeyHex())
+	tampered, _ := http.NewRequest("POST", srv.URL+"/api/rpc/SetMining", bytes.NewBufferString(`{"Enabled": true}`))
+	tampered.Header = signed.Header
+	if resp, err = http.DefaultClient.Do(tampered); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Tampered request should get 401, got %d", resp.StatusCode)
+		}
+	}
+	if miner.IsMining() {
+		t.Error("Tampered request must not start mining")
+	}
+}
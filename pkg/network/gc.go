@@ -0,0 +1,177 @@
+package network
+
+import (
+	"blockchain/pkg/mempool"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultPeerRetention is how long a peer record survives without a successful contact
+	DefaultPeerRetention = 1 * time.Hour
+
+	// DefaultOrphanRetention is how long an orphan block waits for its parent
+	DefaultOrphanRetention = 30 * time.Minute
+
+	// DefaultGCInterval is how often garbage collection runs
+	DefaultGCInterval = 1 * time.Minute
+)
+
+// GCConfig controls retention of expired or rejected data. Pending
+// transactions expire by the mempool's TTL. Webhook alerts are posted once by
+// the client's monitor and leave no delivery record behind to collect.
+type GCConfig struct {
+	PeerRetention   time.Duration // Peer records without contact for this long are dropped (0 = never)
+	OrphanRetention time.Duration // Orphan blocks waiting this long for their parent are dropped (0 = never)
+	Interval        time.Duration // How often the collector runs
+}
+
+// GCStats reports what a garbage collection pass removed
+type GCStats struct {
+	ExpiredTxs   int // Pending transactions past the mempool TTL
+	InvalidTxs   int // Pending transactions spending outputs the chain no longer has unspent
+	DeadPeers    int // Peer records without contact within the retention window
+	StaleOrphans int // Orphan blocks whose parent did not arrive within the retention window
+	CollectedAt  time.Time
+}
+
+// PeerRecord tracks contact history with a peer
+type PeerRecord struct {
+	Address     string
+	FirstSeen   time.Time
+	LastSuccess time.Time
+	LastFailure time.Time
+	Failures    int
+	Features    []string // Protocol features negotiated in the last handshake; nil before one
+}
+
+// DefaultGCConfig returns the default retention settings
+func DefaultGCConfig() GCConfig {
+	return GCConfig{
+		PeerRetention:   DefaultPeerRetention,
+		OrphanRetention: DefaultOrphanRetention,
+		Interval:        DefaultGCInterval,
+	}
+}
+
+// SetGCConfig updates the retention settings used by CollectGarbage
+func (m *Miner) SetGCConfig(cfg GCConfig) {
+	m.gcMutex.Lock()
+	defer m.gcMutex.Unlock()
+	m.gcConfig = cfg
+}
+
+// notePeerResult records the outcome of contacting a peer
+func (m *Miner) notePeerResult(address string, err error) {
+	m.peerMutex.Lock()
+	defer m.peerMutex.Unlock()
+
+	now := time.Now()
+	rec := m.peerRecord(address)
+	if err != nil {
+		rec.LastFailure = now
+		rec.Failures++
+		rec.Features = nil // It may come back as another build; negotiate again
+	} else {
+		rec.LastSuccess = now
+		rec.Failures = 0
+	}
+}
+
+// peerRecord returns the record of the peer at address, creating it if
+// needed. The caller must hold peerMutex.
+func (m *Miner) peerRecord(address string) *PeerRecord {
+	rec, ok := m.peerRecords[address]
+	if !ok {
+		rec = &PeerRecord{Address: address, FirstSeen: time.Now()}
+		m.peerRecords[address] = rec
+	}
+	return rec
+}
+
+// GetPeerRecords returns a copy of the tracked peer records
+func (m *Miner) GetPeerRecords() []PeerRecord {
+	m.peerMutex.RLock()
+	defer m.peerMutex.RUnlock()
+
+	records := make([]PeerRecord, 0, len(m.peerRecords))
+	for _, rec := range m.peerRecords {
+		records = append(records, *rec)
+	}
+	return records
+}
+
+// CollectGarbage drops expired or invalid pending transactions, stale orphan
+// blocks, and stale peer records
+func (m *Miner) CollectGarbage() GCStats {
+	m.gcMutex.RLock()
+	cfg := m.gcConfig
+	m.gcMutex.RUnlock()
+
+	now := time.Now()
+	stats := GCStats{CollectedAt: now}
+
+	// Pending transactions: drop those past their TTL or no longer valid.
+	// They were validated when admitted, and only spend confirmed outputs, so
+	// they stay valid while their inputs are unspent.
+	expired := m.mempool.Expire(now)
+	m.journalDropped(expired, "expired from the mempool")
+	stats.ExpiredTxs = len(expired)
+	invalid := m.mempool.Filter(func(e *mempool.Entry) bool {
+		for _, in := range e.Tx.Inputs {
+			if !m.Blockchain.HasUTXO(in.TxID, in.OutIndex) {
+				return false
+			}
+		}
+		return true
+	})
+	m.journalDropped(invalid, "no longer valid against the chain")
+	stats.InvalidTxs = len(invalid)
+
+	// Orphans: side and orphan blocks deep below the tip are pruned as the
+	// chain grows, but an orphan above it can wait for a parent indefinitely
+	if cfg.OrphanRetention > 0 {
+		stats.StaleOrphans = m.Blockchain.ExpireOrphans(now.Add(-cfg.OrphanRetention))
+	}
+
+	// Peer records: drop those with no successful contact within the retention window
+	if cfg.PeerRetention > 0 {
+		m.peerMutex.Lock()
+		for addr, rec := range m.peerRecords {
+			lastContact := rec.LastSuccess
+			if lastContact.IsZero() {
+				lastContact = rec.FirstSeen
+			}
+			if now.Sub(lastContact) > cfg.PeerRetention {
+				delete(m.peerRecords, addr)
+				stats.DeadPeers++
+			}
+		}
+		m.peerMutex.Unlock()
+	}
+
+	if stats.ExpiredTxs+stats.InvalidTxs+stats.StaleOrphans+stats.DeadPeers > 0 {
+		log.Printf("[%s] GC removed %d expired txs, %d invalid txs, %d stale orphans, %d dead peer records",
+			shortID(m.ID), stats.ExpiredTxs, stats.InvalidTxs, stats.StaleOrphans, stats.DeadPeers)
+	}
+	return stats
+}
+
+// gcLoop runs CollectGarbage periodically until the miner stops
+func (m *Miner) gcLoop() {
+	for !m.IsStopped() {
+		m.gcMutex.RLock()
+		interval := m.gcConfig.Interval
+		m.gcMutex.RUnlock()
+		if interval <= 0 {
+			interval = DefaultGCInterval
+		}
+
+		select {
+		case <-m.done:
+			return
+		case <-time.After(interval):
+			m.CollectGarbage()
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbageExpiresPendingTxs(t *testing.T) {
+	minerKP, _ := transaction.GenerateKeyPair()
+	minerPub := minerKP.GetPublicKeyHex()
+
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	coinbase := transaction.NewCoinbaseTransaction(minerPub, 5000000000, 1)
+	miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+
+	utxoSet := miner.Blockchain.GetUTXOSet()
+	tx, err := utxoSet.CreateTransaction(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: coinbase.ID, OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 1000, ScriptPubKey: "bob"}},
+		map[string]string{minerPub: minerKP.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	miner.AddTransaction(tx)
+
+	miner.SetMempoolConfig(mempool.Config{TTL: time.Hour})
+	if stats := miner.CollectGarbage(); stats.ExpiredTxs != 0 || stats.InvalidTxs != 0 {
+		t.Fatalf("Fresh valid transaction should survive GC, got %+v", stats)
+	}
+
+	// Shorten the TTL so the transaction is already past it
+	miner.SetMempoolConfig(mempool.Config{TTL: time.Nanosecond})
+	stats := miner.CollectGarbage()
+	if stats.ExpiredTxs != 1 {
+		t.Errorf("Expected 1 expired transaction, got %+v", stats)
+	}
+	if len(miner.GetPendingTransactions()) != 0 {
+		t.Error("Expired transaction should be removed from the pending pool")
+	}
+}
+
+func TestCollectGarbageDropsInvalidPendingTxs(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+
+	// A transaction spending an output the chain doesn't know about
+	tx := transaction.NewUTXOTransaction(
+		[]transaction.TxInput{{TxID: "missing", OutIndex: 0, ScriptSig: "sig"}},
+		[]transaction.TxOutput{{Value: 10, ScriptPubKey: "bob"}},
+	)
+	tx.ID = tx.CalculateHash()
+	miner.AddTransaction(tx)
+
+	stats := miner.CollectGarbage()
+	if stats.InvalidTxs != 1 {
+		t.Errorf("Expected 1 invalid transaction, got %+v", stats)
+	}
+}
+
+func TestCollectGarbageDropsDeadPeers(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	miner.SetGCConfig(GCConfig{PeerRetention: time.Minute})
+
+	miner.notePeerResult("alive:1", nil)
+	miner.notePeerResult("dead:1", errors.New("connection refused"))
+	miner.peerRecords["dead:1"].FirstSeen = time.Now().Add(-time.Hour)
+
+	stats := miner.CollectGarbage()
+	if stats.DeadPeers != 1 {
+		t.Errorf("Expected 1 dead peer record, got %+v", stats)
+	}
+	records := miner.GetPeerRecords()
+	if len(records) != 1 || records[0].Address != "alive:1" {
+		t.Errorf("Only the live peer record should remain, got %+v", records)
+	}
+}
+
+func TestCollectGarbageDropsStaleOrphans(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	blocks := grindBlocks(miner.Blockchain.GetLatestBlock(), 2, "peer", miner.Blockchain.GetDifficulty())
+	if status, _, _ := miner.Blockchain.ProcessBlock(blocks[1]); status != blockchain.BlockOrphaned {
+		t.Fatalf("Expected the block orphaned, got %v", status)
+	}
+
+	miner.SetGCConfig(GCConfig{OrphanRetention: time.Hour})
+	if stats := miner.CollectGarbage(); stats.StaleOrphans != 0 || miner.Blockchain.TreeStats().Orphans != 1 {
+		t.Fatalf("A fresh orphan should survive GC, got %+v", stats)
+	}
+
+	miner.SetGCConfig(GCConfig{OrphanRetention: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+	if stats := miner.CollectGarbage(); stats.StaleOrphans != 1 || miner.Blockchain.TreeStats().Orphans != 0 {
+		t.Errorf("Expected the orphan dropped, got %+v", stats)
+	}
+}
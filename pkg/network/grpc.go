@@ -0,0 +1,465 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/proto"
+	"blockchain/pkg/transaction"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GRPCMaxBlocks is the most blocks one GetBlocks call returns
+const GRPCMaxBlocks = 100
+
+// grpcService is the service miner.proto defines
+const grpcService = "blockchain.Miner"
+
+// gRPC status codes
+const (
+	grpcOK                = 0
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcUnauthenticated   = 16
+)
+
+// grpcError is a failed call's gRPC status
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+// grpcMethod decodes a request message, answers it through the gateway's
+// RPCService methods, and returns the reply message
+type grpcMethod func(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error)
+
+// GRPCServer serves the miner API defined in miner.proto over gRPC, so
+// clients in other languages can use stubs generated from it. Each call runs
+// the RPCService method it names under the gateway's access policy and audit
+// log; a token is sent as "authorization: Bearer <token>" metadata.
+//
+// Native gRPC needs HTTP/2, which the server speaks over TLS. gRPC-Web
+// requests (application/grpc-web+proto), as browser frontends send them, are
+// also answered over HTTP/1.1, so a server without TLS still serves those.
+// Only unary calls with uncompressed messages are supported.
+type GRPCServer struct {
+	gateway *Gateway
+	methods map[string]grpcMethod
+}
+
+// NewGRPCServer returns an http.Handler serving m's gRPC API
+func NewGRPCServer(m *Miner) http.Handler {
+	return &GRPCServer{
+		gateway: newGateway(m),
+		methods: map[string]grpcMethod{
+			"GetStatus":       grpcGetStatus,
+			"GetBlock":        grpcGetBlock,
+			"GetBlocks":       grpcGetBlocks,
+			"GetTransaction":  grpcGetTransaction,
+			"GetAddress":      grpcGetAddress,
+			"SendTransaction": grpcSendTransaction,
+		},
+	}
+}
+
+func (s *GRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	web := strings.HasPrefix(contentType, "application/grpc-web")
+	if web || r.Method == http.MethodOptions {
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Grpc-Web, X-User-Agent, Grpc-Timeout")
+		h.Set("Access-Control-Expose-Headers", "Grpc-Status, Grpc-Message")
+		if r.Method == http.MethodOptions {
+			return
+		}
+	}
+	switch strings.TrimSuffix(contentType, "+proto") {
+	case "application/grpc", "application/grpc-web":
+	default:
+		http.Error(w, "expected a gRPC request (application/grpc or application/grpc-web+proto)", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC calls are POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reply proto.Marshaler
+	name, _ := strings.CutPrefix(r.URL.Path, "/"+grpcService+"/")
+	method, ok := s.methods[name]
+	req, err := readGRPCRequest(r)
+	if !ok {
+		err = &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path}
+	}
+	if err == nil {
+		reply, err = method(s.gateway, r, req)
+	}
+	writeGRPC(w, web, reply, err)
+}
+
+// readGRPCRequest reads a unary call's one length-prefixed message. The body
+// is put back for checking its signature.
+func readGRPCRequest(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, gatewayMaxBodyBytes+6))
+	if err != nil {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("failed to read request: %v", err)}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > gatewayMaxBodyBytes+5 {
+		return nil, &grpcError{grpcResourceExhausted, fmt.Sprintf("request larger than %d bytes", gatewayMaxBodyBytes)}
+	}
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return nil, &grpcError{grpcInvalidArgument, "expected one length-prefixed request message"}
+	}
+	if body[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	return body[5:], nil
+}
+
+// grpcFrame length-prefixes a message, or with flags 0x80 a gRPC-Web trailer
+func grpcFrame(flags byte, data []byte) []byte {
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+// writeGRPC answers a call with its reply message, if it succeeded, and its
+// status: in HTTP trailers, or for gRPC-Web in a trailer frame
+func writeGRPC(w http.ResponseWriter, web bool, reply proto.Marshaler, err error) {
+	code, msg := grpcOK, ""
+	if err != nil {
+		code, msg, reply = grpcUnknown, err.Error(), nil
+		var status *grpcError
+		if errors.As(err, &status) {
+			code = status.code
+		} else if errors.Is(err, proto.ErrMalformed) {
+			code = grpcInvalidArgument
+		}
+	}
+
+	h := w.Header()
+	if web {
+		h.Set("Content-Type", "application/grpc-web+proto")
+	} else {
+		h.Set("Content-Type", "application/grpc")
+		h.Set("Trailer", "Grpc-Status, Grpc-Message")
+	}
+	w.WriteHeader(http.StatusOK)
+	if reply != nil {
+		w.Write(grpcFrame(0, proto.Marshal(reply)))
+	}
+	if web {
+		trailer := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", code, grpcEscape(msg))
+		w.Write(grpcFrame(0x80, []byte(trailer)))
+		return
+	}
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	h.Set("Grpc-Message", grpcEscape(msg))
+}
+
+// grpcEscape percent-encodes a status message as gRPC requires
+func grpcEscape(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// grpcCall runs an RPCService method through the gateway, mapping a failure
+// to its gRPC status
+func grpcCall(g *Gateway, r *http.Request, name string, args any) (any, error) {
+	reply, status, err := g.invoke(r, name, args)
+	if err == nil {
+		return reply, nil
+	}
+	code := grpcUnknown
+	switch status {
+	case http.StatusUnauthorized:
+		code = grpcUnauthenticated
+	case http.StatusForbidden:
+		code = grpcPermissionDenied
+	case http.StatusNotFound:
+		code = grpcUnimplemented
+	}
+	return nil, &grpcError{code, err.Error()}
+}
+
+func grpcGetStatus(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error) {
+	reply, err := grpcCall(g, r, "GetStatus", &struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	status := reply.(*StatusReply)
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.String(1, status.ID)
+		e.Int64(2, int64(status.ChainLength))
+		e.Int64(3, int64(status.PendingTxs))
+		e.Int64(4, int64(status.Peers))
+		e.Bool(5, status.Mining)
+		e.Int64(6, int64(status.Difficulty))
+		e.Double(7, status.HashRate)
+		e.String(8, status.TipHash)
+		e.Int64(9, status.TipTime)
+		e.Int64(10, status.BlocksMined)
+		e.String(11, status.ParamsHash)
+		e.Bool(12, status.Replica)
+	}), nil
+}
+
+func grpcGetBlock(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error) {
+	var args BlockQueryArgs
+	err := proto.Decode(req, func(f proto.Field) error {
+		switch f.Num {
+		case 1:
+			args.Hash = f.String()
+		case 2:
+			args.Height = f.Int64()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := grpcCall(g, r, "GetBlock", &args)
+	if err != nil {
+		return nil, err
+	}
+	found := reply.(*BlockQueryReply)
+	if !found.Found {
+		return nil, &grpcError{grpcNotFound, "block not found"}
+	}
+	b, err := block.DeserializeBlock(found.BlockData)
+	if err != nil {
+		return nil, err
+	}
+	return protoBlock(b), nil
+}
+
+func grpcGetBlocks(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error) {
+	var args ChainArgs
+	err := proto.Decode(req, func(f proto.Field) error {
+		switch f.Num {
+		case 1:
+			args.StartIndex = f.Int64()
+		case 2:
+			args.Count = int(int32(f.Int64()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if args.StartIndex < 0 || args.Count < 0 {
+		return nil, &grpcError{grpcInvalidArgument, "start and count must not be negative"}
+	}
+	if args.Count == 0 || args.Count > GRPCMaxBlocks {
+		args.Count = GRPCMaxBlocks
+	}
+	args.Binary = true
+	reply, err := grpcCall(g, r, "GetChain", &args)
+	if err != nil {
+		return nil, err
+	}
+	chain := reply.(*ChainReply)
+	blocks := make([]*block.Block, len(chain.Blocks))
+	for i, data := range chain.Blocks {
+		if blocks[i], err = block.DeserializeBlock(data); err != nil {
+			return nil, err
+		}
+	}
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.Int64(1, int64(chain.Length))
+		for _, b := range blocks {
+			e.Message(2, protoBlock(b))
+		}
+	}), nil
+}
+
+func grpcGetTransaction(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error) {
+	var args TxQueryArgs
+	err := proto.Decode(req, func(f proto.Field) error {
+		if f.Num == 1 {
+			args.TxID = f.String()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := grpcCall(g, r, "GetTransaction", &args)
+	if err != nil {
+		return nil, err
+	}
+	found := reply.(*TxQueryReply)
+	if !found.Found {
+		return nil, &grpcError{grpcNotFound, "transaction " + args.TxID + " not found"}
+	}
+	tx, err := transaction.DeserializeTransaction(found.TxData)
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.Message(1, protoTransaction(tx))
+		e.Bool(2, found.Confirmed)
+		e.Int64(3, found.BlockHeight)
+		e.String(4, found.BlockHash)
+	}), nil
+}
+
+func grpcGetAddress(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error) {
+	var args AddressArgs
+	err := proto.Decode(req, func(f proto.Field) error {
+		if f.Num == 1 {
+			args.Address = f.String()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := grpcCall(g, r, "GetAddress", &args)
+	if err != nil {
+		return nil, err
+	}
+	addr := reply.(*AddressReply)
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.Int64(1, addr.Balance)
+		for _, u := range addr.UTXOs {
+			e.Message(2, proto.MarshalFunc(func(e *proto.Encoder) {
+				e.String(1, u.TxID)
+				e.Int64(2, int64(u.OutIndex))
+				e.Int64(3, u.Value)
+				e.String(4, u.ScriptPubKey)
+				e.Int64(5, u.Height)
+				e.Bool(6, u.Coinbase)
+			}))
+		}
+		e.Strings(3, addr.TxIDs)
+	}), nil
+}
+
+func grpcSendTransaction(g *Gateway, r *http.Request, req []byte) (proto.Marshaler, error) {
+	tx, err := decodeTransaction(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := grpcCall(g, r, "SubmitRawTransaction", &RawTransactionArgs{TxData: data})
+	if err != nil {
+		return nil, err
+	}
+	sent := reply.(*TransactionReply)
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.Bool(1, sent.Success)
+		e.String(2, sent.TxID)
+		e.String(3, sent.Error)
+	}), nil
+}
+
+// protoBlock encodes a block as miner.proto's Block
+func protoBlock(b *block.Block) proto.Marshaler {
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.Int64(1, b.Index)
+		e.Int64(2, b.Timestamp)
+		for _, tx := range b.Transactions {
+			e.Message(3, protoTransaction(tx))
+		}
+		e.String(4, b.MerkleRoot)
+		e.String(5, b.PrevHash)
+		e.String(6, b.Hash)
+		e.Int64(7, b.Nonce)
+		e.Int64(8, int64(b.Difficulty))
+		e.String(9, b.MinerID)
+		e.String(10, b.PowAlgorithm)
+	})
+}
+
+// protoTransaction encodes a transaction as miner.proto's Transaction
+func protoTransaction(tx *transaction.Transaction) proto.Marshaler {
+	return proto.MarshalFunc(func(e *proto.Encoder) {
+		e.String(1, tx.ID)
+		for _, in := range tx.Inputs {
+			e.Message(2, proto.MarshalFunc(func(e *proto.Encoder) {
+				e.String(1, in.TxID)
+				e.Int64(2, int64(in.OutIndex))
+				e.String(3, in.ScriptSig)
+			}))
+		}
+		for _, out := range tx.Outputs {
+			e.Message(3, proto.MarshalFunc(func(e *proto.Encoder) {
+				e.Int64(1, out.Value)
+				e.String(2, out.ScriptPubKey)
+			}))
+		}
+		e.Int64(4, tx.LockTime)
+		e.String(5, tx.Memo)
+	})
+}
+
+// decodeTransaction decodes miner.proto's Transaction
+func decodeTransaction(data []byte) (*transaction.Transaction, error) {
+	tx := &transaction.Transaction{}
+	err := proto.Decode(data, func(f proto.Field) error {
+		switch f.Num {
+		case 1:
+			tx.ID = f.String()
+		case 2:
+			var in transaction.TxInput
+			err := proto.Decode(f.Data, func(f proto.Field) error {
+				switch f.Num {
+				case 1:
+					in.TxID = f.String()
+				case 2:
+					in.OutIndex = int(int32(f.Int64()))
+				case 3:
+					in.ScriptSig = f.String()
+				}
+				return nil
+			})
+			tx.Inputs = append(tx.Inputs, in)
+			return err
+		case 3:
+			var out transaction.TxOutput
+			err := proto.Decode(f.Data, func(f proto.Field) error {
+				switch f.Num {
+				case 1:
+					out.Value = f.Int64()
+				case 2:
+					out.ScriptPubKey = f.String()
+				}
+				return nil
+			})
+			tx.Outputs = append(tx.Outputs, out)
+			return err
+		case 4:
+			tx.LockTime = f.Int64()
+		case 5:
+			tx.Memo = f.String()
+		}
+		return nil
+	})
+	return tx, err
+}
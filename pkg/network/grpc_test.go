@@ -0,0 +1,186 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/proto"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// grpcResult is a unary call's reply message and status
+type grpcResult struct {
+	msg    []byte
+	status int
+	errMsg string
+}
+
+// callGRPC makes a unary call, natively or as gRPC-Web, and splits the
+// response into its message and status
+func callGRPC(t *testing.T, client *http.Client, url, method string, req proto.Marshaler, web bool, token string) grpcResult {
+	t.Helper()
+	contentType := "application/grpc"
+	if web {
+		contentType = "application/grpc-web+proto"
+	}
+	httpReq, _ := http.NewRequest(http.MethodPost, url+"/"+grpcService+"/"+method,
+		bytes.NewReader(grpcFrame(0, proto.Marshal(req))))
+	httpReq.Header.Set("Content-Type", contentType)
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if !web && resp.ProtoMajor != 2 {
+		t.Fatalf("%s: native gRPC should run over HTTP/2, got %s", method, resp.Proto)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var result grpcResult
+	status := resp.Trailer.Get("Grpc-Status")
+	result.errMsg = resp.Trailer.Get("Grpc-Message")
+	for len(body) >= 5 {
+		size := binary.BigEndian.Uint32(body[1:5])
+		frame := body[5 : 5+size]
+		if body[0]&0x80 != 0 {
+			for _, line := range strings.Split(strings.TrimSpace(string(frame)), "\r\n") {
+				key, value, _ := strings.Cut(line, ": ")
+				switch key {
+				case "grpc-status":
+					status = value
+				case "grpc-message":
+					result.errMsg = value
+				}
+			}
+		} else {
+			result.msg = frame
+		}
+		body = body[5+size:]
+	}
+	if result.status, err = strconv.Atoi(status); err != nil {
+		t.Fatalf("%s returned no gRPC status", method)
+	}
+	return result
+}
+
+// protoFields decodes a message's fields by number
+func protoFields(t *testing.T, msg []byte) map[int][]proto.Field {
+	t.Helper()
+	fields := make(map[int][]proto.Field)
+	if err := proto.Decode(msg, func(f proto.Field) error {
+		fields[f.Num] = append(fields[f.Num], f)
+		return nil
+	}); err != nil {
+		t.Fatalf("Invalid reply message: %v", err)
+	}
+	return fields
+}
+
+func TestGRPCServesMinerAPI(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	miner.mineBlock()
+	srv := httptest.NewUnstartedServer(NewGRPCServer(miner))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	client := srv.Client()
+	empty := proto.MarshalFunc(func(e *proto.Encoder) {})
+
+	res := callGRPC(t, client, srv.URL, "GetStatus", empty, false, "")
+	if res.status != grpcOK {
+		t.Fatalf("GetStatus failed: %d %s", res.status, res.errMsg)
+	}
+	status := protoFields(t, res.msg)
+	if status[1][0].String() != "miner1" || status[2][0].Int64() != 2 {
+		t.Errorf("Expected the status of miner1's 2-block chain, got %v", status)
+	}
+
+	tip := miner.Blockchain.GetLatestBlock()
+	res = callGRPC(t, client, srv.URL, "GetBlocks", empty, false, "")
+	blocks := protoFields(t, res.msg)
+	if res.status != grpcOK || blocks[1][0].Int64() != 2 || len(blocks[2]) != 2 {
+		t.Fatalf("Expected both blocks, got %d %v", res.status, blocks)
+	}
+	if got := protoFields(t, blocks[2][1].Data); got[6][0].String() != tip.Hash || len(got[3]) != 1 {
+		t.Errorf("Expected the tip with its coinbase, got %v", got)
+	}
+
+	byHash := proto.MarshalFunc(func(e *proto.Encoder) { e.String(1, tip.Hash) })
+	res = callGRPC(t, client, srv.URL, "GetBlock", byHash, false, "")
+	if got := protoFields(t, res.msg); res.status != grpcOK || got[1][0].Int64() != 1 {
+		t.Errorf("Expected block 1 by hash, got %d %v", res.status, got)
+	}
+	missing := proto.MarshalFunc(func(e *proto.Encoder) { e.Int64(2, 99) })
+	if res = callGRPC(t, client, srv.URL, "GetBlock", missing, false, ""); res.status != grpcNotFound {
+		t.Errorf("Expected NOT_FOUND for a missing block, got %d", res.status)
+	}
+	if res = callGRPC(t, client, srv.URL, "Mine", empty, false, ""); res.status != grpcUnimplemented {
+		t.Errorf("Expected UNIMPLEMENTED for an unknown method, got %d", res.status)
+	}
+
+	// A transaction sent as a message reaches the mempool with its ID intact
+	tx := fundedTransactions(t, miner, []int64{10})[0]
+	res = callGRPC(t, client, srv.URL, "SendTransaction", protoTransaction(tx), false, "")
+	if sent := protoFields(t, res.msg); res.status != grpcOK || !sent[1][0].Bool() || sent[2][0].String() != tx.ID {
+		t.Fatalf("Expected the transaction to be accepted, got %d %v %s", res.status, sent, res.errMsg)
+	}
+	byID := proto.MarshalFunc(func(e *proto.Encoder) { e.String(1, tx.ID) })
+	res = callGRPC(t, client, srv.URL, "GetTransaction", byID, false, "")
+	found := protoFields(t, res.msg)
+	if res.status != grpcOK || len(found[2]) != 0 {
+		t.Fatalf("Expected the pending transaction, got %d %v", res.status, found)
+	}
+	if got, err := decodeTransaction(found[1][0].Data); err != nil || got.CalculateHash() != tx.ID {
+		t.Errorf("Transaction should survive the round trip, got %v", err)
+	}
+}
+
+func TestGRPCWebUnderAccessPolicy(t *testing.T) {
+	policy := access.NewPolicy(access.RoleObserver)
+	policy.SetToken("op-token", access.RoleOperator)
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithAccessPolicy(policy))
+	srv := httptest.NewServer(NewGRPCServer(miner))
+	defer srv.Close()
+	client := srv.Client()
+
+	// gRPC-Web needs no HTTP/2 and carries its status in a trailer frame
+	empty := proto.MarshalFunc(func(e *proto.Encoder) {})
+	res := callGRPC(t, client, srv.URL, "GetStatus", empty, true, "")
+	if status := protoFields(t, res.msg); res.status != grpcOK || status[2][0].Int64() != 1 {
+		t.Errorf("Expected an observer to read the status, got %d %v", res.status, status)
+	}
+
+	tx := fundedTransactions(t, miner, []int64{10})[0]
+	if res = callGRPC(t, client, srv.URL, "SendTransaction", protoTransaction(tx), true, ""); res.status != grpcPermissionDenied {
+		t.Errorf("Expected PERMISSION_DENIED for an observer, got %d", res.status)
+	}
+	if res = callGRPC(t, client, srv.URL, "SendTransaction", protoTransaction(tx), true, "bad-token"); res.status != grpcUnauthenticated {
+		t.Errorf("Expected UNAUTHENTICATED for an unknown token, got %d", res.status)
+	}
+	res = callGRPC(t, client, srv.URL, "SendTransaction", protoTransaction(tx), true, "op-token")
+	if sent := protoFields(t, res.msg); res.status != grpcOK || !sent[1][0].Bool() {
+		t.Errorf("Expected an operator to send the transaction, got %d %s", res.status, res.errMsg)
+	}
+
+	// A truncated message is refused
+	httpReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/"+grpcService+"/GetBlock",
+		bytes.NewReader(grpcFrame(0, []byte{0x12, 0x05})))
+	httpReq.Header.Set("Content-Type", "application/grpc-web+proto")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Contains(body, []byte("grpc-status: 3")) {
+		t.Errorf("Expected INVALID_ARGUMENT for a malformed message, got %q", body)
+	}
+}
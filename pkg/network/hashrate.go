@@ -0,0 +1,89 @@
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// hashRateWindow is how many recent mining rounds the hash rate averages over
+const hashRateWindow = 10
+
+// hashRateSample is the work done in one mining round
+type hashRateSample struct {
+	hashes  int64
+	workers []int64 // hashes split by PoW worker
+	elapsed time.Duration
+}
+
+// hashRateMeter averages hash rate over the most recent mining rounds
+type hashRateMeter struct {
+	samples []hashRateSample
+	mu      sync.Mutex
+}
+
+// add records the hashes each PoW worker computed during one mining round
+func (h *hashRateMeter) add(workers []int64, elapsed time.Duration) {
+	var hashes int64
+	for _, n := range workers {
+		hashes += n
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples = append(h.samples, hashRateSample{hashes: hashes, workers: workers, elapsed: elapsed})
+	if len(h.samples) > hashRateWindow {
+		h.samples = h.samples[len(h.samples)-hashRateWindow:]
+	}
+}
+
+// rate returns hashes per second over the recorded rounds (0 if none)
+func (h *hashRateMeter) rate() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var hashes int64
+	var elapsed time.Duration
+	for _, s := range h.samples {
+		hashes += s.hashes
+		elapsed += s.elapsed
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(hashes) / elapsed.Seconds()
+}
+
+// workerRates returns each PoW worker's hashes per second over the recorded
+// rounds, sized for the most recent round's workers (nil if none)
+func (h *hashRateMeter) workerRates() []float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) == 0 {
+		return nil
+	}
+	hashes := make([]int64, len(h.samples[len(h.samples)-1].workers))
+	var elapsed time.Duration
+	for _, s := range h.samples {
+		for i := 0; i < len(s.workers) && i < len(hashes); i++ {
+			hashes[i] += s.workers[i]
+		}
+		elapsed += s.elapsed
+	}
+	rates := make([]float64, len(hashes))
+	if elapsed <= 0 {
+		return rates
+	}
+	for i, n := range hashes {
+		rates[i] = float64(n) / elapsed.Seconds()
+	}
+	return rates
+}
+
+// HashRate returns the miner's recent hash rate in hashes per second
+func (m *Miner) HashRate() float64 {
+	return m.hashMeter.rate()
+}
+
+// WorkerHashRates returns the recent hash rate of each PoW worker in hashes
+// per second, so a miner running -threads can be checked for idle workers
+func (m *Miner) WorkerHashRates() []float64 {
+	return m.hashMeter.workerRates()
+}
@@ -0,0 +1,268 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/storage"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"strings"
+)
+
+// MaxHeadersPerRequest caps the headers a GetHeaders reply carries; syncing
+// peers page through longer chains
+const MaxHeadersPerRequest = 2000
+
+// BlockHeader is a block without its transactions. The hash commits to the
+// transactions, so a header chain can be linked and its proof of work checked
+// before any block body is downloaded.
+type BlockHeader struct {
+	Index        int64
+	Timestamp    int64
+	Hash         string
+	PrevHash     string
+	MerkleRoot   string
+	Nonce        int64
+	Difficulty   int
+	MinerID      string
+	PowAlgorithm string
+}
+
+// headerOf returns the header of b
+func headerOf(b *block.Block) BlockHeader {
+	return BlockHeader{
+		Index:        b.Index,
+		Timestamp:    b.Timestamp,
+		Hash:         b.Hash,
+		PrevHash:     b.PrevHash,
+		MerkleRoot:   b.MerkleRoot,
+		Nonce:        b.Nonce,
+		Difficulty:   b.Difficulty,
+		MinerID:      b.MinerID,
+		PowAlgorithm: b.PowAlgorithm,
+	}
+}
+
+// Block returns the header as a block with no transactions
+func (h BlockHeader) Block() *block.Block {
+	return &block.Block{
+		Index:        h.Index,
+		Timestamp:    h.Timestamp,
+		Hash:         h.Hash,
+		PrevHash:     h.PrevHash,
+		MerkleRoot:   h.MerkleRoot,
+		Nonce:        h.Nonce,
+		Difficulty:   h.Difficulty,
+		MinerID:      h.MinerID,
+		PowAlgorithm: h.PowAlgorithm,
+	}
+}
+
+// HeadersArgs selects up to Count headers starting at StartIndex. A Count of
+// zero or above MaxHeadersPerRequest asks for MaxHeadersPerRequest.
+type HeadersArgs struct {
+	StartIndex int64
+	Count      int
+}
+
+// HeadersReply returns block headers and the length of the whole chain
+type HeadersReply struct {
+	Headers []BlockHeader
+	Length  int
+}
+
+// GetHeaders RPC method to get block headers. A malicious miner's headers
+// describe the chain its GetChain replies would serve, so peers meet the same
+// attack whichever they ask for.
+func (s *RPCService) GetHeaders(args *HeadersArgs, reply *HeadersReply) error {
+	count := args.Count
+	if count <= 0 || count > MaxHeadersPerRequest {
+		count = MaxHeadersPerRequest
+	}
+
+	var blocks []*block.Block
+	if s.miner.isMalicious {
+		var chain ChainReply
+		if err := s.GetChain(&ChainArgs{StartIndex: args.StartIndex, Binary: true}, &chain); err != nil {
+			return err
+		}
+		for _, data := range chain.Blocks[:min(count, len(chain.Blocks))] {
+			b, err := block.DeserializeBlock(data)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, b)
+		}
+		reply.Length = chain.Length
+	} else {
+		blocks = s.miner.Blockchain.GetBlocksFrom(args.StartIndex)
+		blocks = blocks[:min(count, len(blocks))]
+		reply.Length = s.miner.Blockchain.GetLength()
+	}
+
+	reply.Headers = make([]BlockHeader, len(blocks))
+	for i, b := range blocks {
+		reply.Headers[i] = headerOf(b)
+	}
+	return nil
+}
+
+// methodUnsupported reports whether err is a peer refusing a call because it
+// predates the method
+func methodUnsupported(err error) bool {
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	return strings.Contains(string(serverErr), "can't find method") ||
+		strings.Contains(string(serverErr), access.ErrUnknownMethod.Error())
+}
+
+// fetchHeaders downloads a peer's header chain, page by page, and checks that
+// it links and meets its proof of work. Every page must hold as many headers
+// as the advertised length leaves, so an inflated length claim is refused
+// before anything is checked. Only the first page is fetched when the peer's
+// chain is no longer than ours.
+func (m *Miner) fetchHeaders(client *rpc.Client) ([]BlockHeader, error) {
+	var headers []BlockHeader
+	var prev *block.Block
+	length := -1
+	for length < 0 || len(headers) < length {
+		args := &HeadersArgs{StartIndex: int64(len(headers)), Count: MaxHeadersPerRequest}
+		var reply HeadersReply
+		if err := client.Call("RPCService.GetHeaders", args, &reply); err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			length = reply.Length
+		}
+		want := min(MaxHeadersPerRequest, length-len(headers))
+		if reply.Length != length || len(reply.Headers) != want {
+			return nil, fmt.Errorf("%w: advertised length %d but sent %d headers from #%d",
+				ErrInvalidPeerChain, reply.Length, len(reply.Headers), len(headers))
+		}
+		if length <= m.Blockchain.GetLength() {
+			return nil, nil // Our chain is longer or equal
+		}
+
+		for _, h := range reply.Headers {
+			b := h.Block()
+			if err := m.Blockchain.CheckHeader(b, prev); err != nil {
+				return nil, fmt.Errorf("%w: block #%d: %w", ErrInvalidPeerChain, len(headers), err)
+			}
+			headers = append(headers, h)
+			prev = b
+		}
+	}
+	return headers, nil
+}
+
+// GetChainCached gets the blockchain from a miner like GetChain, but reuses
+// the blocks in cache and downloads only those after the cached tip. If the
+// miner's chain no longer holds the cached tip, its headers are compared to
+// find where it forked and the blocks from there are downloaded again. Each
+// new block must link to its predecessor and meet its proof of work. It also
+// returns how many blocks were downloaded. The chain is saved back to the
+// cache; if that fails, the chain is returned along with the error.
+func (c *Client) GetChainCached(minerAddress string, cache *storage.BlockCache) ([]*block.Block, int, error) {
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer client.Close()
+
+	var genesis HeadersReply
+	err = client.Call("RPCService.GetHeaders", &HeadersArgs{StartIndex: 0, Count: 1}, &genesis)
+	if err != nil && methodUnsupported(err) {
+		blocks, err := c.GetChain(minerAddress)
+		return blocks, len(blocks), err
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(genesis.Headers) != 1 {
+		return nil, 0, fmt.Errorf("%w: no genesis header", ErrInvalidPeerChain)
+	}
+
+	cached := cache.Chain(genesis.Headers[0].Hash)
+	if len(cached) > 0 {
+		fork, err := cachedForkPoint(client, cached)
+		if err != nil {
+			return nil, 0, err
+		}
+		cached = cached[:fork]
+	}
+
+	chain, err := FetchChain(client, int64(len(cached)))
+	if err != nil {
+		return nil, 0, err
+	}
+	blocks := cached
+	for _, data := range chain {
+		b, err := block.DeserializeBlock(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := checkLink(b, blocks); err != nil {
+			return nil, 0, fmt.Errorf("%w: block #%d: %w", ErrInvalidPeerChain, len(blocks), err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	if err := cache.Save(blocks); err != nil {
+		return blocks, len(chain), err
+	}
+	return blocks, len(chain), nil
+}
+
+// cachedForkPoint returns how many blocks of cached the miner's chain still
+// holds. The cached tip is checked first; only if it is gone are the miner's
+// headers paged through to find the fork.
+func cachedForkPoint(client *rpc.Client, cached []*block.Block) (int, error) {
+	start := len(cached) - 1
+	for {
+		var reply HeadersReply
+		args := &HeadersArgs{StartIndex: int64(start), Count: len(cached) - start}
+		if err := client.Call("RPCService.GetHeaders", args, &reply); err != nil {
+			return 0, err
+		}
+		// Walk the page from its top down to the highest block still shared
+		for i := min(len(reply.Headers), len(cached)-start) - 1; i >= 0; i-- {
+			if reply.Headers[i].Hash == cached[start+i].Hash {
+				return start + i + 1, nil
+			}
+		}
+		if start == 0 {
+			return 0, nil
+		}
+		// The tip is gone: search the cached range below it, a page at a time
+		start = max(start-MaxHeadersPerRequest, 0)
+	}
+}
+
+// checkLink checks that b extends chain: the genesis block when chain is
+// empty, otherwise the next index linked by hash to the tip. Its hash must
+// match its contents and meet its proof of work.
+func checkLink(b *block.Block, chain []*block.Block) error {
+	if len(chain) > 0 {
+		tip := chain[len(chain)-1]
+		if b.Index != tip.Index+1 {
+			return blockchain.ErrInvalidIndex
+		}
+		if b.PrevHash != tip.Hash {
+			return blockchain.ErrInvalidPrevHash
+		}
+	} else if b.Index != 0 {
+		return blockchain.ErrInvalidGenesis
+	}
+	b.SetMerkleMode(b.MerkleRoot != "")
+	if !b.HasValidHash() {
+		return blockchain.ErrInvalidBlock
+	}
+	if len(chain) > 0 && !b.HasValidPoW() {
+		return blockchain.ErrInvalidPoW
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/transaction"
+	"sort"
+	"strings"
+)
+
+// BlockQueryArgs selects a block by hash, or by height when Hash is empty
+type BlockQueryArgs struct {
+	Hash   string
+	Height int64
+}
+
+// BlockQueryReply returns the serialized block if found
+type BlockQueryReply struct {
+	Found     bool
+	BlockData []byte
+}
+
+// TxQueryArgs selects a transaction by ID
+type TxQueryArgs struct {
+	TxID string
+}
+
+// TxQueryReply returns a transaction and where it is confirmed. Pending
+// transactions are found with Confirmed set to false.
+type TxQueryReply struct {
+	Found       bool
+	Confirmed   bool
+	TxData      []byte
+	BlockHeight int64
+	BlockHash   string
+	Position    int
+}
+
+// OutpointArgs selects a transaction output
+type OutpointArgs struct {
+	TxID     string
+	OutIndex int
+}
+
+// SpendingTxReply returns the confirmed input spending an output. Found is
+// false if the output is unspent, only spent by a pending transaction, or
+// unknown.
+type SpendingTxReply struct {
+	Found bool
+	Spend blockchain.Spend
+}
+
+// AddressArgs selects an address
+type AddressArgs struct {
+	Address string
+}
+
+// AddressReply summarizes an address's funds and history
+type AddressReply struct {
+	Balance int64
+	UTXOs   []transaction.UTXO
+	TxIDs   []string // Confirmed transactions touching the address, oldest first
+}
+
+// BalanceReply is an address's confirmed balance at a chain height
+type BalanceReply struct {
+	Balance int64
+	Height  int64 // Height of the tip the balance reflects
+}
+
+// UTXOsReply lists an address's unspent outputs at a chain height
+type UTXOsReply struct {
+	UTXOs   []transaction.UTXO
+	Balance int64 // Sum of the outputs
+	Height  int64 // Height of the tip the outputs reflect
+}
+
+// TxGraphArgs selects a confirmed transaction and how many hops of its
+// ancestors and descendants to walk (capped at blockchain.MaxTraceDepth)
+type TxGraphArgs struct {
+	TxID  string
+	Depth int
+}
+
+// SearchArgs holds a free-form search query
+type SearchArgs struct {
+	Query string
+}
+
+// SearchReply describes the matched entity. Type is "block", "transaction",
+// "address", or empty if nothing matched; the fields for that type are set.
+type SearchReply struct {
+	Type      string
+	MatchedBy string // "height", "hash", "txid", or "address"
+
+	BlockData []byte // Serialized block
+
+	TxData      []byte // Serialized transaction
+	Confirmed   bool
+	BlockHeight int64
+	BlockHash   string
+
+	Address string
+	Balance int64
+	TxCount int
+}
+
+// GetBlock RPC method to look up a block by hash or height
+func (s *RPCService) GetBlock(args *BlockQueryArgs, reply *BlockQueryReply) error {
+	bc := s.miner.Blockchain
+	b := bc.GetBlockByHash(args.Hash)
+	if args.Hash == "" {
+		b = bc.GetBlockByHeight(args.Height)
+	}
+	if b == nil {
+		return nil
+	}
+	data, err := b.SerializeJSON()
+	if err != nil {
+		return err
+	}
+	reply.Found = true
+	reply.BlockData = data
+	return nil
+}
+
+// GetTransaction RPC method to look up a confirmed or pending transaction
+func (s *RPCService) GetTransaction(args *TxQueryArgs, reply *TxQueryReply) error {
+	tx, loc := s.miner.Blockchain.GetTransaction(args.TxID)
+	if tx != nil {
+		reply.Confirmed = true
+		reply.BlockHeight = loc.BlockHeight
+		reply.BlockHash = loc.BlockHash
+		reply.Position = loc.Position
+	} else {
+		for _, pending := range s.miner.GetPendingTransactions() {
+			if pending.ID == args.TxID {
+				tx = pending
+				break
+			}
+		}
+	}
+	if tx == nil {
+		return nil
+	}
+	data, err := tx.SerializeJSON()
+	if err != nil {
+		return err
+	}
+	reply.Found = true
+	reply.TxData = data
+	return nil
+}
+
+// GetSpendingTx RPC method to find which confirmed transaction spent an
+// output, from the spent-output index
+func (s *RPCService) GetSpendingTx(args *OutpointArgs, reply *SpendingTxReply) error {
+	if spend := s.miner.Blockchain.GetSpendingTx(args.TxID, args.OutIndex); spend != nil {
+		reply.Found = true
+		reply.Spend = *spend
+	}
+	return nil
+}
+
+// GetAddress RPC method to look up an address's balance, UTXOs, and history
+func (s *RPCService) GetAddress(args *AddressArgs, reply *AddressReply) error {
+	reply.UTXOs, reply.Balance, _ = s.addressUTXOs(args.Address)
+	reply.TxIDs = s.miner.Blockchain.GetAddressTransactions(args.Address)
+	return nil
+}
+
+// GetBalance RPC method to look up an address's confirmed balance
+func (s *RPCService) GetBalance(args *AddressArgs, reply *BalanceReply) error {
+	_, reply.Balance, reply.Height = s.addressUTXOs(args.Address)
+	return nil
+}
+
+// GetUTXOs RPC method to list an address's unspent outputs, so wallets can
+// build transactions without downloading the chain
+func (s *RPCService) GetUTXOs(args *AddressArgs, reply *UTXOsReply) error {
+	reply.UTXOs, reply.Balance, reply.Height = s.addressUTXOs(args.Address)
+	return nil
+}
+
+// GetUTXOSnapshot RPC method to dump the whole UTXO set at the tip, for
+// comparing the consensus state of two nodes
+func (s *RPCService) GetUTXOSnapshot(args *struct{}, reply *blockchain.UTXOSnapshot) error {
+	*reply = s.miner.Blockchain.Snapshot()
+	return nil
+}
+
+// TraceTransaction RPC method to walk where a confirmed transaction's funds
+// came from and where its outputs went
+func (s *RPCService) TraceTransaction(args *TxGraphArgs, reply *blockchain.TxGraph) error {
+	g, err := s.miner.Blockchain.TraceTransaction(args.TxID, args.Depth)
+	if err != nil {
+		return err
+	}
+	*reply = *g
+	return nil
+}
+
+// addressUTXOs returns an address's unspent outputs in canonical order, so
+// replies from nodes with the same state are identical, their total, and the
+// tip height they reflect
+func (s *RPCService) addressUTXOs(address string) ([]transaction.UTXO, int64, int64) {
+	utxos, height := s.miner.Blockchain.FindAddressUTXOs(address)
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].TxID != utxos[j].TxID {
+			return utxos[i].TxID < utxos[j].TxID
+		}
+		return utxos[i].OutIndex < utxos[j].OutIndex
+	})
+	var total int64
+	for _, utxo := range utxos {
+		total += utxo.Value
+	}
+	return utxos, total, height
+}
+
+// Search RPC method to find a block, transaction, or address from a single query
+func (s *RPCService) Search(args *SearchArgs, reply *SearchReply) error {
+	bc := s.miner.Blockchain
+	result := bc.Search(args.Query)
+	if result.Kind == "" {
+		// Fall back to unconfirmed transactions
+		query := strings.TrimSpace(args.Query)
+		for _, tx := range s.miner.GetPendingTransactions() {
+			if tx.ID == query {
+				result = blockchain.SearchResult{Kind: blockchain.SearchTransaction, MatchedBy: "txid", Tx: tx}
+				break
+			}
+		}
+	}
+
+	reply.Type = string(result.Kind)
+	reply.MatchedBy = result.MatchedBy
+	var err error
+	switch result.Kind {
+	case blockchain.SearchBlock:
+		reply.BlockData, err = result.Block.SerializeJSON()
+	case blockchain.SearchTransaction:
+		reply.TxData, err = result.Tx.SerializeJSON()
+		if result.Location != nil {
+			reply.Confirmed = true
+			reply.BlockHeight = result.Location.BlockHeight
+			reply.BlockHash = result.Location.BlockHash
+		}
+	case blockchain.SearchAddress:
+		reply.Address = result.Address
+		reply.Balance = bc.GetBalance(result.Address)
+		reply.TxCount = len(bc.GetAddressTransactions(result.Address))
+	}
+	return err
+}
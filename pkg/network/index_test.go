@@ -0,0 +1,155 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"testing"
+)
+
+func TestIndexRPCs(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+	mined := miner.Blockchain.GetLatestBlock()
+
+	var byHeight, byHash BlockQueryReply
+	service.GetBlock(&BlockQueryArgs{Height: 1}, &byHeight)
+	service.GetBlock(&BlockQueryArgs{Hash: mined.Hash}, &byHash)
+	if !byHeight.Found || !byHash.Found {
+		t.Fatal("Mined block should be found by height and by hash")
+	}
+	b, _ := block.DeserializeBlock(byHash.BlockData)
+	if b.Index != 1 {
+		t.Errorf("Expected block #1, got #%d", b.Index)
+	}
+
+	var txReply TxQueryReply
+	service.GetTransaction(&TxQueryArgs{TxID: mined.Transactions[0].ID}, &txReply)
+	if !txReply.Found || !txReply.Confirmed || txReply.BlockHeight != 1 {
+		t.Errorf("Coinbase should be confirmed at height 1, got %+v", txReply)
+	}
+
+	pending := fundedTransactions(t, miner, []int64{10})[0]
+	miner.AddTransaction(pending)
+	txReply = TxQueryReply{}
+	service.GetTransaction(&TxQueryArgs{TxID: pending.ID}, &txReply)
+	if !txReply.Found || txReply.Confirmed {
+		t.Errorf("Pending transaction should be found unconfirmed, got %+v", txReply)
+	}
+
+	var addrReply AddressReply
+	service.GetAddress(&AddressArgs{Address: "miner1"}, &addrReply)
+	if addrReply.Balance != 5000000000 || len(addrReply.TxIDs) != 1 {
+		t.Errorf("Unexpected address summary: %+v", addrReply)
+	}
+
+	var spendReply SpendingTxReply
+	outpoint := &OutpointArgs{TxID: pending.Inputs[0].TxID, OutIndex: pending.Inputs[0].OutIndex}
+	service.GetSpendingTx(outpoint, &spendReply)
+	if spendReply.Found {
+		t.Error("An output spent only in the mempool should not be indexed as spent")
+	}
+	miner.mineBlock()
+	service.GetSpendingTx(outpoint, &spendReply)
+	if !spendReply.Found || spendReply.Spend.TxID != pending.ID || spendReply.Spend.BlockHeight != 2 {
+		t.Errorf("Mined spend should be indexed at height 2, got %+v", spendReply)
+	}
+}
+
+func TestBalanceAndUTXORPCs(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	miner.mineBlock()
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+
+	var balance BalanceReply
+	service.GetBalance(&AddressArgs{Address: "miner1"}, &balance)
+	if balance.Balance != 2*5000000000 || balance.Height != 2 {
+		t.Errorf("Expected two coinbases at height 2, got %+v", balance)
+	}
+
+	var utxos UTXOsReply
+	service.GetUTXOs(&AddressArgs{Address: "miner1"}, &utxos)
+	if len(utxos.UTXOs) != 2 || utxos.Balance != balance.Balance || utxos.Height != 2 {
+		t.Fatalf("Expected two coinbase outputs, got %+v", utxos)
+	}
+	if utxos.UTXOs[0].TxID > utxos.UTXOs[1].TxID {
+		t.Error("UTXOs should be sorted by transaction ID")
+	}
+
+	var none UTXOsReply
+	service.GetUTXOs(&AddressArgs{Address: "nobody"}, &none)
+	if len(none.UTXOs) != 0 || none.Balance != 0 {
+		t.Errorf("Unknown address should have no outputs, got %+v", none)
+	}
+}
+
+func TestSearchRPC(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+	mined := miner.Blockchain.GetLatestBlock()
+	pending := fundedTransactions(t, miner, []int64{10})[0]
+	miner.AddTransaction(pending)
+
+	cases := []struct {
+		query, typ, matchedBy string
+	}{
+		{"1", "block", "height"},
+		{mined.Hash, "block", "hash"},
+		{" " + mined.Transactions[0].ID + " ", "transaction", "txid"},
+		{pending.ID, "transaction", "txid"},
+		{"miner1", "address", "address"},
+		{"nothing-here", "", ""},
+	}
+	for _, c := range cases {
+		var reply SearchReply
+		if err := service.Search(&SearchArgs{Query: c.query}, &reply); err != nil {
+			t.Fatalf("Search(%q) failed: %v", c.query, err)
+		}
+		if reply.Type != c.typ || reply.MatchedBy != c.matchedBy {
+			t.Errorf("Search(%q) = %s by %s, want %s by %s", c.query, reply.Type, reply.MatchedBy, c.typ, c.matchedBy)
+		}
+	}
+
+	var reply SearchReply
+	service.Search(&SearchArgs{Query: pending.ID}, &reply)
+	if reply.Confirmed || len(reply.TxData) == 0 {
+		t.Errorf("Pending transaction should be returned unconfirmed, got %+v", reply)
+	}
+	reply = SearchReply{}
+	service.Search(&SearchArgs{Query: "miner1"}, &reply)
+	if reply.Balance != 5000000000 || reply.TxCount != 1 {
+		t.Errorf("Unexpected address result: %+v", reply)
+	}
+}
+
+func TestClientBlockAndTransactionLookups(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:19112", 1, nil)
+	miner.mineBlock()
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+	mined := miner.Blockchain.GetLatestBlock()
+	client := NewClient("test", nil)
+
+	b, err := client.GetBlockByIndex("localhost:19112", 1)
+	if err != nil || b == nil || b.Hash != mined.Hash {
+		t.Fatalf("Expected block #1, got %v (%v)", b, err)
+	}
+	b, err = client.GetBlockByHash("localhost:19112", mined.Hash)
+	if err != nil || b == nil || b.Index != 1 {
+		t.Fatalf("Expected block #1 by hash, got %v (%v)", b, err)
+	}
+	if b, err := client.GetBlockByIndex("localhost:19112", 5); err != nil || b != nil {
+		t.Errorf("A height past the tip should not be found, got %v (%v)", b, err)
+	}
+
+	tx, loc, err := client.GetTransaction("localhost:19112", mined.Transactions[0].ID)
+	if err != nil || tx == nil || tx.ID != mined.Transactions[0].ID || !loc.Confirmed || loc.BlockHash != mined.Hash {
+		t.Fatalf("Expected the coinbase confirmed in block #1, got %v %+v (%v)", tx, loc, err)
+	}
+	if tx, _, err := client.GetTransaction("localhost:19112", "missing"); err != nil || tx != nil {
+		t.Errorf("Unknown transaction should not be found, got %v (%v)", tx, err)
+	}
+}
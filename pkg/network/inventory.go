@@ -0,0 +1,83 @@
+package network
+
+import (
+	"fmt"
+	"net/rpc"
+	"slices"
+	"sync/atomic"
+)
+
+// Inventory item types
+const (
+	InvBlock = "block"
+	InvTx    = "tx"
+)
+
+// MaxInvItems bounds the items of a single announcement
+const MaxInvItems = 1000
+
+// InvItem names a block or transaction by hash
+type InvItem struct {
+	Type string // InvBlock or InvTx
+	Hash string // Block hash or transaction ID
+}
+
+// InvArgs announces blocks and transactions the sender has
+type InvArgs struct {
+	Items []InvItem
+}
+
+// InvReply lists the announced items the receiver wants the bodies of
+type InvReply struct {
+	Wanted []InvItem
+}
+
+// Inv RPC method to announce blocks and transactions by hash. The reply asks
+// for the bodies of those the miner does not have yet, which the sender then
+// pushes with ReceiveBlock and ReceiveTransaction. A read replica never asks
+// for transactions.
+func (s *RPCService) Inv(args *InvArgs, reply *InvReply) error {
+	if len(args.Items) > MaxInvItems {
+		return fmt.Errorf("%d inventory items exceed the limit of %d", len(args.Items), MaxInvItems)
+	}
+	for _, item := range args.Items {
+		if s.miner.wantsInv(item) {
+			reply.Wanted = append(reply.Wanted, item)
+		}
+	}
+	return nil
+}
+
+// wantsInv reports whether the miner lacks an announced item it would accept
+func (m *Miner) wantsInv(item InvItem) bool {
+	switch item.Type {
+	case InvBlock:
+		return !m.Blockchain.HasBlock(item.Hash)
+	case InvTx:
+		if m.IsReplica() || m.mempool.Has(item.Hash) {
+			return false
+		}
+		tx, _ := m.Blockchain.GetTransaction(item.Hash)
+		return tx == nil
+	}
+	return false
+}
+
+// announce offers an item to a peer over client and reports whether to send
+// its body. Peers that did not negotiate FeatureInventory are sent every body,
+// as are peers whose answer is lost; a body they already have is refused
+// cheaply on arrival.
+func (m *Miner) announce(client *rpc.Client, peer PeerInfo, item InvItem) bool {
+	if !slices.Contains(m.peerFeatures(client, peer), FeatureInventory) {
+		return true
+	}
+	var reply InvReply
+	if err := client.Call("RPCService.Inv", &InvArgs{Items: []InvItem{item}}, &reply); err != nil {
+		return true
+	}
+	if len(reply.Wanted) == 0 {
+		atomic.AddInt64(&m.relaySkipped, 1)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+	"testing"
+	"time"
+)
+
+func TestInventoryGossipSkipsKnownBodies(t *testing.T) {
+	receiver := NewMiner("receiver", "localhost:19152", 1, nil)
+	if err := receiver.Start(); err != nil {
+		t.Fatalf("Failed to start receiver: %v", err)
+	}
+	defer receiver.Stop()
+
+	sender := NewMiner("sender", "localhost:19153", 1, []PeerInfo{{ID: "receiver", Address: "localhost:19152"}})
+	defer sender.Stop()
+	sender.Blockchain = blockchain.NewBlockchainFromBlocks(receiver.Blockchain.GetBlocks(), 1)
+	genesis := sender.Blockchain.GetLatestBlock()
+
+	// Only blocks the receiver lacks are wanted
+	service := &RPCService{miner: receiver}
+	var reply InvReply
+	items := []InvItem{{Type: InvBlock, Hash: "unknown"}, {Type: InvBlock, Hash: genesis.Hash}, {Type: InvTx, Hash: genesis.Transactions[0].ID}}
+	if err := service.Inv(&InvArgs{Items: items}, &reply); err != nil || len(reply.Wanted) != 1 || reply.Wanted[0].Hash != "unknown" {
+		t.Fatalf("Expected only the unknown block to be wanted, got %+v (%v)", reply.Wanted, err)
+	}
+
+	// Mining announces the block and sends its body; announcing it again
+	// finds it known
+	sender.mineBlock()
+	tip := sender.Blockchain.GetLatestBlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for receiver.Blockchain.GetLength() != 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if receiver.Blockchain.GetLength() != 2 {
+		t.Fatalf("Receiver should ask for and accept the announced block, got length %d", receiver.Blockchain.GetLength())
+	}
+	sender.BroadcastBlock(tip)
+	var status StatusReply
+	for status.RelaySkipped == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		(&RPCService{miner: sender}).GetStatus(&struct{}{}, &status)
+	}
+	if status.RelaySkipped != 1 {
+		t.Errorf("Expected the known block's body to be skipped once, got %d", status.RelaySkipped)
+	}
+
+	if err := service.Inv(&InvArgs{Items: make([]InvItem, MaxInvItems+1)}, &reply); err == nil {
+		t.Error("An oversized announcement should be refused")
+	}
+}
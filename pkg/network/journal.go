@@ -0,0 +1,158 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/transaction"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// maxJournalEvents bounds the events kept for GetTxJournal
+const maxJournalEvents = 10000
+
+// Kinds of journal events
+const (
+	JournalSubmitted = "submitted" // Accepted from a client; the correlation ID starts here
+	JournalRelayed   = "relayed"   // Sent to a peer
+	JournalReceived  = "received"  // Accepted from a peer
+	JournalDuplicate = "duplicate" // Received from a peer while already pending
+	JournalRejected  = "rejected"  // Refused, from a client or a peer; Detail says why
+	JournalDropped   = "dropped"   // Removed from the mempool unconfirmed; Detail says why
+	JournalMined     = "mined"     // Included in a block this miner mined
+	JournalConfirmed = "confirmed" // Included in a block accepted from a peer
+)
+
+// JournalEvent is one step of a transaction's journey through a miner. A
+// correlation ID is assigned when a client submits the transaction and
+// travels with it on every relay, so the events every miner journals for it
+// can be merged into the journey across the network.
+type JournalEvent struct {
+	Time          time.Time
+	Node          string // ID of the miner journaling the event
+	Kind          string
+	TxID          string
+	CorrelationID string // Empty if the transaction reached the miner without one
+	Peer          string // Address of the peer relayed to or received from
+	Hops          int    // Relays between the submitting miner and this one
+	Height        int64  // Height of the including block, for mined and confirmed events
+	Detail        string
+}
+
+// TxJournalArgs selects journal events by transaction ID, correlation ID, or
+// both; with neither, the most recent events of any transaction
+type TxJournalArgs struct {
+	TxID          string
+	CorrelationID string
+	Limit         int // Most recent events returned (<= 0 = all kept)
+}
+
+// TxJournalReply returns journal events, oldest first
+type TxJournalReply struct {
+	Node   string
+	Events []JournalEvent
+}
+
+// newCorrelationID returns a random correlation ID
+func newCorrelationID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// journal records an event, logging it so a transaction can also be followed
+// through the miners' logs by its correlation ID
+func (m *Miner) journal(e JournalEvent) {
+	e.Time = time.Now()
+	e.Node = m.ID
+	m.journalMutex.Lock()
+	m.journalEvents = append(m.journalEvents, e)
+	if len(m.journalEvents) > maxJournalEvents {
+		m.journalEvents = m.journalEvents[len(m.journalEvents)-maxJournalEvents:]
+	}
+	m.journalMutex.Unlock()
+
+	corr := e.CorrelationID
+	if corr == "" {
+		corr = "-"
+	}
+	msg := ""
+	switch {
+	case e.Peer != "":
+		msg = " peer=" + e.Peer
+	case e.Kind == JournalMined || e.Kind == JournalConfirmed:
+		msg = fmt.Sprintf(" height=%d", e.Height)
+	}
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	logging.Debugf("[%s] JOURNAL corr=%s tx=%s %s hops=%d%s", shortID(m.ID), corr, shortID(e.TxID), e.Kind, e.Hops, msg)
+}
+
+// txCorrelation returns the correlation ID and hop count under which the
+// miner last journaled a transaction
+func (m *Miner) txCorrelation(txID string) (string, int) {
+	m.journalMutex.Lock()
+	defer m.journalMutex.Unlock()
+	for i := len(m.journalEvents) - 1; i >= 0; i-- {
+		if e := m.journalEvents[i]; e.TxID == txID && e.CorrelationID != "" {
+			return e.CorrelationID, e.Hops
+		}
+	}
+	return "", 0
+}
+
+// journalBlock journals the inclusion of a block's transactions
+func (m *Miner) journalBlock(b *block.Block, kind string) {
+	for _, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		corr, hops := m.txCorrelation(tx.ID)
+		m.journal(JournalEvent{Kind: kind, TxID: tx.ID, CorrelationID: corr, Hops: hops, Height: b.Index})
+	}
+}
+
+// journalDropped journals the removal of pending transactions for reason
+func (m *Miner) journalDropped(entries []mempool.Entry, reason string) {
+	for _, e := range entries {
+		corr, hops := m.txCorrelation(e.Tx.ID)
+		m.journal(JournalEvent{Kind: JournalDropped, TxID: e.Tx.ID, CorrelationID: corr, Hops: hops, Detail: reason})
+	}
+}
+
+// journalSubmitted journals a client's transaction under corr, or a new
+// correlation ID if corr is empty, and returns the ID used
+func (m *Miner) journalSubmitted(tx *transaction.Transaction, corr string) string {
+	if corr == "" {
+		corr = newCorrelationID()
+	}
+	m.journal(JournalEvent{Kind: JournalSubmitted, TxID: tx.ID, CorrelationID: corr})
+	return corr
+}
+
+// TxJournal returns the journaled events selected by args, oldest first
+func (m *Miner) TxJournal(args TxJournalArgs) []JournalEvent {
+	m.journalMutex.Lock()
+	defer m.journalMutex.Unlock()
+	events := []JournalEvent{}
+	for _, e := range m.journalEvents {
+		if (args.TxID == "" || e.TxID == args.TxID) && (args.CorrelationID == "" || e.CorrelationID == args.CorrelationID) {
+			events = append(events, e)
+		}
+	}
+	if args.Limit > 0 && len(events) > args.Limit {
+		events = events[len(events)-args.Limit:]
+	}
+	return events
+}
+
+// GetTxJournal RPC method to read the miner's transaction journal
+func (s *RPCService) GetTxJournal(args *TxJournalArgs, reply *TxJournalReply) error {
+	reply.Node = s.miner.ID
+	reply.Events = s.miner.TxJournal(*args)
+	return nil
+}
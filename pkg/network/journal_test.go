@@ -0,0 +1,54 @@
+package network
+
+import (
+	"blockchain/pkg/testchain"
+	"testing"
+	"time"
+)
+
+func TestJournalFollowsTransactionAcrossMiners(t *testing.T) {
+	receiver := NewMiner("receiver", "localhost:19138", 1, nil)
+	if err := receiver.Start(); err != nil {
+		t.Fatalf("Failed to start receiver: %v", err)
+	}
+	defer receiver.Stop()
+	submitter := NewMiner("submitter", "localhost:19137", 1, []PeerInfo{{ID: "receiver", Address: "localhost:19138"}})
+	if err := submitter.Start(); err != nil {
+		t.Fatalf("Failed to start submitter: %v", err)
+	}
+	defer submitter.Stop()
+
+	chain := testchain.Extend(t, submitter.Blockchain).Fund("alice", 1)
+	if err := receiver.SyncWithPeer(PeerInfo{ID: "submitter", Address: "localhost:19137"}); err != nil {
+		t.Fatalf("Failed to share the funding block: %v", err)
+	}
+	tx := chain.Pay("alice", "bob", 1000, 1000)
+	data, _ := tx.Serialize()
+
+	var reply TransactionReply
+	(&RPCService{miner: submitter}).SubmitRawTransaction(&RawTransactionArgs{TxData: data, CorrelationID: "lab-1"}, &reply)
+	if !reply.Success || reply.CorrelationID != "lab-1" {
+		t.Fatalf("Expected the submission to be accepted under the given ID, got %+v", reply)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(submitter.TxJournal(TxJournalArgs{TxID: tx.ID})) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	received := receiver.TxJournal(TxJournalArgs{CorrelationID: "lab-1"})
+	if len(received) != 1 || received[0].Kind != JournalReceived || received[0].Hops != 1 || received[0].TxID != tx.ID {
+		t.Fatalf("The receiver should journal the relayed transaction under its correlation ID, got %+v", received)
+	}
+
+	submitter.mineBlock()
+	kinds := []string{}
+	for _, e := range submitter.TxJournal(TxJournalArgs{TxID: tx.ID}) {
+		kinds = append(kinds, e.Kind)
+		if e.CorrelationID != "lab-1" {
+			t.Errorf("Event %s lost the correlation ID", e.Kind)
+		}
+	}
+	if len(kinds) != 3 || kinds[0] != JournalSubmitted || kinds[1] != JournalRelayed || kinds[2] != JournalMined {
+		t.Errorf("Expected submitted, relayed, mined on the submitter, got %v", kinds)
+	}
+}
@@ -0,0 +1,43 @@
+package network
+
+import "blockchain/pkg/blockchain"
+
+// HeightRangeArgs selects blocks between two heights, inclusive. A FromHeight
+// below 1 starts after genesis and a negative ToHeight ends at the tip.
+type HeightRangeArgs struct {
+	FromHeight int64
+	ToHeight   int64
+}
+
+// MinerBlocksArgs selects the blocks mined by one miner identity
+type MinerBlocksArgs struct {
+	MinerID string
+	HeightRangeArgs
+}
+
+// MinerBlocksReply lists a miner's blocks, oldest first
+type MinerBlocksReply struct {
+	Blocks []blockchain.MinedBlock
+	Height int64 // Height of the tip the reply reflects
+}
+
+// LeaderboardReply ranks miners by blocks mined, then by rewards
+type LeaderboardReply struct {
+	Miners []blockchain.MinerStats
+	Height int64 // Height of the tip the reply reflects
+}
+
+// GetMinerBlocks RPC method to list the blocks a miner produced over a height range
+func (s *RPCService) GetMinerBlocks(args *MinerBlocksArgs, reply *MinerBlocksReply) error {
+	reply.Blocks = s.miner.Blockchain.BlocksByMiner(args.MinerID, args.FromHeight, args.ToHeight)
+	reply.Height = int64(s.miner.Blockchain.GetLength()) - 1
+	return nil
+}
+
+// GetLeaderboard RPC method to rank the miners of a height range by blocks,
+// rewards, and average interval between their blocks
+func (s *RPCService) GetLeaderboard(args *HeightRangeArgs, reply *LeaderboardReply) error {
+	reply.Miners = s.miner.Blockchain.Leaderboard(args.FromHeight, args.ToHeight)
+	reply.Height = int64(s.miner.Blockchain.GetLength()) - 1
+	return nil
+}
@@ -0,0 +1,399 @@
+package network
+
+import (
+	"blockchain/pkg/codec"
+	"blockchain/pkg/logging"
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
+)
+
+const (
+	// DefaultMaxMessageBytes bounds a single RPC message read from a connection (8 MiB)
+	DefaultMaxMessageBytes = 8 << 20
+
+	// DefaultMaxBlockBytes bounds a serialized block (4 MiB)
+	DefaultMaxBlockBytes = 4 << 20
+
+	// DefaultMaxTxBytes bounds a serialized transaction (256 KiB)
+	DefaultMaxTxBytes = 256 << 10
+
+	// DefaultMaxChainBytes bounds a GetChain reply read while syncing (512 MiB)
+	DefaultMaxChainBytes = 512 << 20
+
+	// DefaultMaxJSONDepth bounds object/array nesting in a payload. Honest
+	// blocks nest about five levels deep.
+	DefaultMaxJSONDepth = 32
+)
+
+var (
+	ErrMessageTooLarge = errors.New("message exceeds size limit")
+	ErrPayloadTooDeep  = errors.New("payload is too deeply nested")
+)
+
+// MessageLimits bounds what a miner reads from its peers, so a malicious peer
+// can't make it buffer or decode arbitrarily large or deep payloads
+type MessageLimits struct {
+	MaxMessageBytes int64 // Largest RPC message accepted on an incoming connection
+	MaxBlockBytes   int   // Largest serialized block accepted
+	MaxTxBytes      int   // Largest serialized transaction accepted
+	MaxChainBytes   int64 // Largest chain reply read from a peer during sync
+	MaxJSONDepth    int   // Deepest nesting accepted in a block or transaction
+}
+
+// DefaultMessageLimits returns the limits used by NewMiner
+func DefaultMessageLimits() MessageLimits {
+	return MessageLimits{
+		MaxMessageBytes: DefaultMaxMessageBytes,
+		MaxBlockBytes:   DefaultMaxBlockBytes,
+		MaxTxBytes:      DefaultMaxTxBytes,
+		MaxChainBytes:   DefaultMaxChainBytes,
+		MaxJSONDepth:    DefaultMaxJSONDepth,
+	}
+}
+
+// WithMessageLimits sets the peer message limits; zero fields keep their defaults
+func WithMessageLimits(limits MessageLimits) MinerOption {
+	return func(o *MinerOptions) {
+		def := DefaultMessageLimits()
+		if limits.MaxMessageBytes <= 0 {
+			limits.MaxMessageBytes = def.MaxMessageBytes
+		}
+		if limits.MaxBlockBytes <= 0 {
+			limits.MaxBlockBytes = def.MaxBlockBytes
+		}
+		if limits.MaxTxBytes <= 0 {
+			limits.MaxTxBytes = def.MaxTxBytes
+		}
+		if limits.MaxChainBytes <= 0 {
+			limits.MaxChainBytes = def.MaxChainBytes
+		}
+		if limits.MaxJSONDepth <= 0 {
+			limits.MaxJSONDepth = def.MaxJSONDepth
+		}
+		o.Limits = limits
+	}
+}
+
+// checkPayload rejects a serialized block or transaction that is larger than
+// maxBytes or, as JSON, nests deeper than maxDepth, before it is handed to the
+// decoder. The binary encoding does not nest.
+func checkPayload(data []byte, maxBytes, maxDepth int) error {
+	if len(data) > maxBytes {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrMessageTooLarge, len(data), maxBytes)
+	}
+	if !codec.IsJSON(data) {
+		return nil
+	}
+	return checkJSONDepth(data, maxDepth)
+}
+
+// checkJSONDepth scans data once, without allocating, and fails as soon as
+// object/array nesting exceeds maxDepth. Brackets inside strings are ignored;
+// the JSON is otherwise left for the decoder to validate.
+func checkJSONDepth(data []byte, maxDepth int) error {
+	depth := 0
+	inString, escaped := false, false
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("%w: depth exceeds %d at offset %d", ErrPayloadTooDeep, maxDepth, i)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// frameLimiter sits between a connection and a gob decoder and enforces a
+// maximum gob message size. Every gob message starts with its byte count, so
+// an oversized message is refused from its header, before any of its body is
+// read or buffered.
+type frameLimiter struct {
+	r         *bufio.Reader
+	max       int64
+	header    []byte // Pending count bytes not yet passed to the decoder
+	remaining int64  // Body bytes of the current message still to pass through
+	err       error
+}
+
+func newFrameLimiter(r io.Reader, max int64) *frameLimiter {
+	return &frameLimiter{r: bufio.NewReader(r), max: max, header: make([]byte, 0, 9)}
+}
+
+// nextFrame reads and checks the count of the next gob message
+func (f *frameLimiter) nextFrame() error {
+	if f.err != nil {
+		return f.err
+	}
+	b, err := f.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	f.header = append(f.header[:0], b)
+	size := uint64(b)
+	if b > 0x7f {
+		// Large counts are a negated byte count followed by big-endian bytes
+		n := -int(int8(b))
+		if n < 1 || n > 8 {
+			f.header = f.header[:0]
+			f.err = fmt.Errorf("invalid gob message count prefix %#x", b)
+			return f.err
+		}
+		size = 0
+		for i := 0; i < n; i++ {
+			c, err := f.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			f.header = append(f.header, c)
+			size = size<<8 | uint64(c)
+		}
+	}
+	if size > uint64(f.max) {
+		f.header = f.header[:0]
+		f.err = fmt.Errorf("%w: %d byte message (max %d)", ErrMessageTooLarge, size, f.max)
+		return f.err
+	}
+	f.remaining = int64(size)
+	return nil
+}
+
+func (f *frameLimiter) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(f.header) == 0 && f.remaining == 0 {
+		if err := f.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if len(f.header) > 0 {
+		n := copy(p, f.header)
+		f.header = f.header[n:]
+		return n, nil
+	}
+	if int64(len(p)) > f.remaining {
+		p = p[:f.remaining]
+	}
+	n, err := f.r.Read(p)
+	f.remaining -= int64(n)
+	return n, err
+}
+
+// ReadByte keeps gob from wrapping the limiter in its own read-ahead buffer
+func (f *frameLimiter) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(f, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// limitedServerCodec is net/rpc's gob server codec with a message size limit.
+// If admit or authorize is set, calls either refuses are answered with its
+// error unexecuted; admit is asked first.
+// If auditor is set, it sees the arguments and outcome of every call.
+type limitedServerCodec struct {
+	rwc       io.ReadWriteCloser
+	dec       *gob.Decoder
+	enc       *gob.Encoder
+	encBuf    *bufio.Writer
+	closed    bool
+	dropped   bool
+	onDrop    func(error)
+	admit     func() error
+	authorize func(method string) error
+	auditor   *callAuditor
+	header    rpc.Request    // Header of the request whose body is read next
+	denied    error          // Refusal of that request
+	traffic   *throttledConn // If set, paced by the class of each call
+}
+
+func newLimitedServerCodec(conn io.ReadWriteCloser, maxMessageBytes int64, traffic *throttledConn, onDrop func(error)) *limitedServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &limitedServerCodec{
+		rwc:     conn,
+		dec:     gob.NewDecoder(traffic.reader(newFrameLimiter(conn, maxMessageBytes))),
+		enc:     gob.NewEncoder(buf),
+		encBuf:  buf,
+		onDrop:  onDrop,
+		traffic: traffic,
+	}
+}
+
+func (c *limitedServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.dec.Decode(r); err != nil {
+		return c.dropOnLimit(err)
+	}
+	c.header = *r
+	c.traffic.setRead(classifyCall(r.ServiceMethod, false))
+	if c.admit != nil {
+		c.denied = c.admit()
+	}
+	if c.denied == nil && c.authorize != nil {
+		c.denied = c.authorize(r.ServiceMethod)
+	}
+	return nil
+}
+
+// ReadRequestBody returns the refusal of a refused call after reading its
+// body, which net/rpc sends back as the call's error before reading the next
+// request. body is nil when the method does not exist.
+func (c *limitedServerCodec) ReadRequestBody(body any) error {
+	denied := c.denied
+	c.denied = nil
+	var err error
+	if body == nil {
+		err = c.dec.DecodeValue(reflect.Value{})
+	} else {
+		err = c.dec.Decode(body)
+	}
+	if err != nil {
+		return c.dropOnLimit(err)
+	}
+	if c.auditor != nil && body != nil {
+		c.auditor.request(c.header.Seq, c.header.ServiceMethod, body, denied)
+	}
+	return denied
+}
+
+func (c *limitedServerCodec) dropOnLimit(err error) error {
+	if errors.Is(err, ErrMessageTooLarge) && !c.dropped && c.onDrop != nil {
+		c.dropped = true
+		c.onDrop(err)
+	}
+	return err
+}
+
+func (c *limitedServerCodec) WriteResponse(r *rpc.Response, body any) error {
+	if c.auditor != nil {
+		c.auditor.response(r.Seq, r.Error, body)
+	}
+	c.traffic.setWrite(classifyCall(r.ServiceMethod, false))
+	if err := c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *limitedServerCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
+
+// limitedClientCodec is net/rpc's gob client codec with a reply size limit
+type limitedClientCodec struct {
+	rwc     io.ReadWriteCloser
+	dec     *gob.Decoder
+	enc     *gob.Encoder
+	encBuf  *bufio.Writer
+	traffic *throttledConn // If set, paced by the class of each call
+}
+
+func (c *limitedClientCodec) WriteRequest(r *rpc.Request, body any) error {
+	c.traffic.setWrite(classifyCall(r.ServiceMethod, true))
+	if err := c.enc.Encode(r); err != nil {
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *limitedClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+	c.traffic.setRead(classifyCall(r.ServiceMethod, true))
+	return nil
+}
+
+func (c *limitedClientCodec) ReadResponseBody(body any) error {
+	return c.dec.Decode(body)
+}
+
+func (c *limitedClientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+// dialPeer connects to a peer's RPC server, refusing any reply message larger
+// than maxReplyBytes
+func (m *Miner) dialPeer(address string, maxReplyBytes int64) (*rpc.Client, error) {
+	conn, err := m.transport().Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, traffic := m.throttle(conn)
+	buf := bufio.NewWriter(conn)
+	return rpc.NewClientWithCodec(&limitedClientCodec{
+		rwc:     conn,
+		dec:     gob.NewDecoder(traffic.reader(newFrameLimiter(conn, maxReplyBytes))),
+		enc:     gob.NewEncoder(buf),
+		encBuf:  buf,
+		traffic: traffic,
+	}), nil
+}
+
+// serveConn serves RPC requests on conn under the miner's message size limit,
+// call rate limit, and access policy, and frees its connection slot when done.
+// The service is bound to the connection so handlers know which peer is
+// calling and which role it authenticated as.
+func (m *Miner) serveConn(conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	defer m.releaseConn(conn)
+	sess := m.newSession()
+	if err := m.handshakeTLS(conn, sess); err != nil {
+		logging.Warnf("[%s] TLS handshake with %s failed: %v", shortID(m.ID), remote, err)
+		conn.Close()
+		return
+	}
+	conn, traffic := m.throttle(conn)
+	server := rpc.NewServer()
+	server.Register(&RPCService{miner: m, peer: peerHost(remote), session: sess})
+	codec := newLimitedServerCodec(conn, m.options.Limits.MaxMessageBytes, traffic, func(err error) {
+		logging.Warnf("[%s] Dropped connection from %s: %v", shortID(m.ID), remote, err)
+	})
+	codec.admit = func() error { return m.allowCall(peerHost(remote)) }
+	if sess != nil {
+		codec.authorize = sess.authorize
+		if m.options.Audit != nil {
+			codec.auditor = newCallAuditor(m, sess, peerHost(remote))
+		}
+	}
+	server.ServeCodec(codec)
+}
@@ -0,0 +1,116 @@
+package network
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckJSONDepth(t *testing.T) {
+	cases := []struct {
+		data string
+		ok   bool
+	}{
+		{`{"a":[{"b":[1,2]}]}`, true},
+		{`{"a":"[[[[[[[[[[[[[[[["}`, true},
+		{`{"a":"\"[[[[[[[[[[[[[[[["}`, true},
+		{`[[[[[[]]]]]]`, false},
+		{`{"a":"\\"}[[[[[[[[`, false},
+	}
+	for _, c := range cases {
+		err := checkJSONDepth([]byte(c.data), 4)
+		if (err == nil) != c.ok {
+			t.Errorf("checkJSONDepth(%s) = %v, want ok=%v", c.data, err, c.ok)
+		}
+		if err != nil && !errors.Is(err, ErrPayloadTooDeep) {
+			t.Errorf("Expected ErrPayloadTooDeep, got %v", err)
+		}
+	}
+}
+
+func TestReceiveRejectsOversizedAndNestedPayloads(t *testing.T) {
+	miner := NewMiner("honest", "localhost:0", 1, nil)
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+
+	var txReply TransactionReply
+	service.ReceiveTransaction(&BlockArgs{BlockData: nestedJSONPayload(oversizedNestingDepth)}, &txReply)
+	if txReply.Success || !strings.Contains(txReply.Error, ErrPayloadTooDeep.Error()) {
+		t.Errorf("Deeply nested transaction should be rejected, got %+v", txReply)
+	}
+
+	txReply = TransactionReply{}
+	huge := []byte(`{"ID":"` + strings.Repeat("a", DefaultMaxTxBytes) + `"}`)
+	service.ReceiveTransaction(&BlockArgs{BlockData: huge}, &txReply)
+	if txReply.Success || !strings.Contains(txReply.Error, ErrMessageTooLarge.Error()) {
+		t.Errorf("Oversized transaction should be rejected, got %+v", txReply)
+	}
+
+	var blockReply BlockReply
+	tip := miner.Blockchain.GetLatestBlock()
+	service.ReceiveBlock(&BlockArgs{BlockData: oversizedBlockPayload(tip, "attacker", DefaultMaxBlockBytes)}, &blockReply)
+	if blockReply.Success || !strings.Contains(blockReply.Error, ErrMessageTooLarge.Error()) {
+		t.Errorf("Oversized block should be rejected, got %+v", blockReply)
+	}
+	if miner.Blockchain.GetLength() != 2 {
+		t.Errorf("Chain should be unchanged, got length %d", miner.Blockchain.GetLength())
+	}
+}
+
+func TestOversizedMessageUsesBoundedMemory(t *testing.T) {
+	const limit = 1 << 20
+	honest := NewMiner("honest", "localhost:19092", 1, nil, WithMessageLimits(MessageLimits{MaxMessageBytes: limit}))
+	if err := honest.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer honest.Stop()
+
+	// Encode the attack up front so only the honest node allocates below
+	req, err := encodeRPCRequest("RPCService.ReceiveBlock", &BlockArgs{
+		BlockData: oversizedBlockPayload(honest.Blockchain.GetLatestBlock(), "attacker", 64<<20),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	sendRawRequest("localhost:19092", req)
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8<<20 {
+		t.Errorf("Receiving a %d byte message allocated %d bytes; the %d byte limit should bound it", len(req), allocated, limit)
+	}
+	if honest.Blockchain.GetLength() != 1 {
+		t.Errorf("Oversized block should not be accepted")
+	}
+
+	// The node keeps serving other connections
+	status, err := NewClient("client", nil).GetMinerStatus("localhost:19092")
+	if err != nil || status.ID != "honest" {
+		t.Errorf("Miner should still answer after dropping the attacker: %v", err)
+	}
+}
+
+func TestSyncRejectsOversizedChainReply(t *testing.T) {
+	peer := NewMiner("peer", "localhost:19093", 1, nil)
+	for i := 0; i < 3; i++ {
+		peer.mineBlock()
+	}
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer peer.Stop()
+
+	honest := NewMiner("honest", "localhost:0", 1, nil, WithMessageLimits(MessageLimits{MaxChainBytes: 256}))
+	err := honest.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19093"})
+	// net/rpc flattens client-side read errors to strings
+	if err == nil || !strings.Contains(err.Error(), ErrMessageTooLarge.Error()) {
+		t.Fatalf("Expected the chain reply to exceed the limit, got %v", err)
+	}
+	if honest.Blockchain.GetLength() != 1 {
+		t.Errorf("Chain should be unchanged, got length %d", honest.Blockchain.GetLength())
+	}
+}
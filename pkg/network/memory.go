@@ -0,0 +1,90 @@
+package network
+
+import (
+	"blockchain/pkg/logging"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/transaction"
+	"math"
+)
+
+// MemoryUsageReply reports approximate memory usage per component
+type MemoryUsageReply struct {
+	MempoolBytes    int64
+	MempoolTxs      int
+	MempoolMaxBytes int64
+	MempoolMaxTxs   int
+	MempoolEvicted  int64   // Transactions evicted over the miner's lifetime
+	MempoolReplaced int64   // Transactions replaced by a conflicting one paying more
+	MempoolRefused  int64   // Transactions refused for spending an output a pending one spends
+	MinRelayFeeRate float64 // Current minimum fee rate for new transactions (sat/byte)
+	RelayLimited    int64   // Relayed transactions refused by per-peer rate limits
+	UTXOBytes       int64
+	UTXOCount       int
+	OrphanBlocks    int   // Blocks waiting for their parent
+	OrphanBytes     int64 // Approximate memory of the orphan pool
+	OrphanMaxBytes  int64 // Memory budget of the orphan pool; the oldest orphans are evicted over it
+	ChainBlocks     int
+	Caches          transaction.CacheStats // Signature and public key caches, shared by every miner in the process
+}
+
+// WithMempool sets the limits, eviction policy, and TTL of the mempool
+func WithMempool(cfg mempool.Config) MinerOption {
+	return func(o *MinerOptions) {
+		o.Mempool = cfg
+	}
+}
+
+// SetMempoolConfig changes the mempool's limits and evicts immediately if
+// they are exceeded
+func (m *Miner) SetMempoolConfig(cfg mempool.Config) {
+	m.noteEvicted(m.mempool.SetConfig(cfg))
+}
+
+// noteEvicted raises the relay fee floor above the best fee rate the mempool
+// had to drop, so the evicted transactions are not simply relayed again
+func (m *Miner) noteEvicted(evicted []mempool.Entry) {
+	if len(evicted) == 0 {
+		return
+	}
+	var bestEvictedRate float64
+	for i := range evicted {
+		bestEvictedRate = math.Max(bestEvictedRate, evicted[i].FeeRate())
+	}
+	m.txMutex.Lock()
+	m.raiseFeeFloor(bestEvictedRate)
+	m.journalDropped(evicted, "evicted from the full mempool")
+	m.txMutex.Unlock()
+	logging.Warnf("[%s] Mempool over budget, evicted %d transactions", shortID(m.ID), len(evicted))
+}
+
+// GetMemoryUsage returns approximate memory usage of the miner's pools and chain state
+func (m *Miner) GetMemoryUsage() *MemoryUsageReply {
+	stats := m.mempool.Stats()
+	reply := &MemoryUsageReply{
+		MempoolBytes:    stats.Bytes,
+		MempoolTxs:      stats.Txs,
+		MempoolMaxBytes: stats.MaxBytes,
+		MempoolMaxTxs:   stats.MaxTxs,
+		MempoolEvicted:  stats.Evicted,
+		MempoolReplaced: stats.Replaced,
+		MempoolRefused:  stats.Refused,
+		MinRelayFeeRate: m.MinRelayFeeRate(),
+	}
+
+	m.relayMutex.Lock()
+	reply.RelayLimited = m.relayLimited
+	m.relayMutex.Unlock()
+
+	reply.UTXOCount, reply.UTXOBytes = m.Blockchain.UTXOSize()
+	tree := m.Blockchain.TreeStats()
+	reply.OrphanBlocks, reply.OrphanBytes, reply.OrphanMaxBytes = tree.Orphans, tree.OrphanBytes, tree.OrphanMaxBytes
+	reply.ChainBlocks = m.Blockchain.GetLength()
+	reply.Caches = transaction.GetCacheStats()
+	return reply
+}
+
+// GetMemoryUsage RPC method to report approximate memory usage
+func (s *RPCService) GetMemoryUsage(args *struct{}, reply *MemoryUsageReply) error {
+	*reply = *s.miner.GetMemoryUsage()
+	return nil
+}
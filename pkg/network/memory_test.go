@@ -0,0 +1,235 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/transaction"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// fundedTransactions creates n signed transactions, each spending its own UTXO
+// in the miner's chain state and paying the corresponding fee
+func fundedTransactions(t *testing.T, miner *Miner, fees []int64) []*transaction.Transaction {
+	kp, err := transaction.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	pub := kp.GetPublicKeyHex()
+
+	var txs []*transaction.Transaction
+	for i, fee := range fees {
+		coinbase := transaction.NewCoinbaseTransaction(pub, 10000, int64(100+i))
+		miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+		tx, err := miner.Blockchain.GetUTXOSet().CreateTransaction(
+			[]struct {
+				TxID     string
+				OutIndex int
+			}{{TxID: coinbase.ID, OutIndex: 0}},
+			[]transaction.TxOutput{{Value: 10000 - fee, ScriptPubKey: fmt.Sprintf("bob%d", i)}},
+			map[string]string{pub: kp.GetPrivateKeyHex()},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create transaction: %v", err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func TestMempoolBudgetEvictsOldest(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	txs := fundedTransactions(t, miner, []int64{10, 20, 30})
+
+	// Signature lengths vary slightly, so size the budget to the two newest exactly
+	miner.SetMempoolConfig(mempool.Config{MaxBytes: mempool.Size(txs[1]) + mempool.Size(txs[2]), Eviction: mempool.EvictOldest})
+	for _, tx := range txs {
+		miner.AddTransaction(tx)
+	}
+
+	pending := miner.GetPendingTransactions()
+	if len(pending) != 2 {
+		t.Fatalf("Expected 2 transactions within budget, got %d", len(pending))
+	}
+	for _, tx := range pending {
+		if tx.ID == txs[0].ID {
+			t.Error("Oldest transaction should have been evicted")
+		}
+	}
+
+	usage := miner.GetMemoryUsage()
+	if usage.MempoolEvicted != 1 || usage.MempoolBytes > usage.MempoolMaxBytes {
+		t.Errorf("Unexpected memory usage: %+v", usage)
+	}
+}
+
+func TestMempoolBudgetEvictsLowestFeeRate(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	txs := fundedTransactions(t, miner, []int64{50, 5, 30})
+
+	miner.SetMempoolConfig(mempool.Config{MaxBytes: mempool.Size(txs[0]) + mempool.Size(txs[2]), Eviction: mempool.EvictLowestFeeRate})
+	miner.AddTransaction(txs[0])
+	miner.AddTransaction(txs[2])
+
+	// The new low-fee transaction is the one that gets evicted
+	if err := miner.AddTransaction(txs[1]); err != mempool.ErrFull {
+		t.Errorf("Expected mempool.ErrFull for the lowest fee-rate transaction, got %v", err)
+	}
+	if len(miner.GetPendingTransactions()) != 2 {
+		t.Errorf("Expected 2 pending transactions, got %d", len(miner.GetPendingTransactions()))
+	}
+}
+
+func TestMemoryUsageAccounting(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	txs := fundedTransactions(t, miner, []int64{10, 10})
+	for _, tx := range txs {
+		miner.AddTransaction(tx)
+	}
+
+	usage := miner.GetMemoryUsage()
+	if usage.MempoolTxs != 2 || usage.MempoolBytes != mempool.Size(txs[0])+mempool.Size(txs[1]) {
+		t.Errorf("Unexpected mempool accounting: %+v", usage)
+	}
+	if usage.UTXOCount == 0 || usage.UTXOBytes == 0 {
+		t.Error("UTXO usage should be reported")
+	}
+	if usage.OrphanBlocks != 0 || usage.OrphanMaxBytes != blockchain.DefaultMaxOrphanBytes {
+		t.Errorf("Unexpected orphan pool accounting: %+v", usage)
+	}
+
+	miner.RemoveTransactions(txs)
+	if usage := miner.GetMemoryUsage(); usage.MempoolBytes != 0 {
+		t.Errorf("Mempool bytes should return to 0, got %d", usage.MempoolBytes)
+	}
+}
+
+func TestAssembleBlockPrefersHighFeeRate(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil, WithMaxBlockTxs(2))
+	txs := fundedTransactions(t, miner, []int64{5, 50, 30})
+	for _, tx := range txs {
+		miner.AddTransaction(tx)
+	}
+
+	_, included := miner.assembleBlock()
+	if len(included) != 3 {
+		t.Fatalf("Expected a coinbase and 2 transactions, got %d", len(included))
+	}
+	if included[1].ID != txs[1].ID || included[2].ID != txs[2].ID {
+		t.Error("Block should include the two highest fee-rate transactions, best first")
+	}
+	if fees := included[0].TotalOutputValue() - 5000000000; fees != 80 {
+		t.Errorf("Coinbase should collect 80 satoshi in fees, got %d", fees)
+	}
+}
+
+func TestAssembleBlockRespectsConsensusLimits(t *testing.T) {
+	params := blockchain.DefaultChainParams()
+	params.MaxBlockTxs = 2
+	miner := NewMiner("miner1", "localhost:0", 1, nil, WithChainOptions(blockchain.WithParams(params)))
+	txs := fundedTransactions(t, miner, []int64{5, 50, 30})
+	for _, tx := range txs {
+		miner.AddTransaction(tx)
+	}
+
+	// The consensus limit is tighter than the miner's own
+	b, included := miner.assembleBlock()
+	if len(included) != 3 || included[1].ID != txs[1].ID || included[2].ID != txs[2].ID {
+		t.Fatalf("Expected a coinbase and the two highest fee-rate transactions, got %d", len(included))
+	}
+	if err := miner.Blockchain.ValidateBlockTransactions(b); err != nil {
+		t.Errorf("Assembled block should pass validation: %v", err)
+	}
+
+	// Room for the coinbase and the best transaction, a byte short of another
+	largest := transaction.NewCoinbaseTransaction(miner.PayoutAddress(1), math.MaxInt64, 1)
+	params.MaxBlockTxs = 0
+	params.MaxBlockBytes = blockchain.TxSize(largest) + blockchain.TxSize(txs[1]) + min(blockchain.TxSize(txs[0]), blockchain.TxSize(txs[2])) - 1
+	b, included = miner.assembleBlock()
+	if len(included) != 2 || included[1].ID != txs[1].ID {
+		t.Fatalf("Expected a coinbase and the highest fee-rate transaction, got %d", len(included))
+	}
+	if err := miner.Blockchain.ValidateBlockTransactions(b); err != nil {
+		t.Errorf("Assembled block should pass validation: %v", err)
+	}
+}
+
+func TestReceiveTransactionRefusesDoubleSpend(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	kp, _ := transaction.GenerateKeyPair()
+	coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 10000, 100)
+	miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+	spend := func(fee int64, payee string) []byte {
+		tx, err := miner.Blockchain.GetUTXOSet().CreateTransaction(
+			[]struct {
+				TxID     string
+				OutIndex int
+			}{{TxID: coinbase.ID, OutIndex: 0}},
+			[]transaction.TxOutput{{Value: 10000 - fee, ScriptPubKey: payee}},
+			map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create transaction: %v", err)
+		}
+		data, _ := tx.Serialize()
+		return data
+	}
+	service := &RPCService{miner: miner}
+
+	var first, second, bump TransactionReply
+	service.ReceiveTransaction(&BlockArgs{BlockData: spend(100, "bob")}, &first)
+	service.ReceiveTransaction(&BlockArgs{BlockData: spend(100, "mallory")}, &second)
+	if !first.Success || second.Success || !strings.Contains(second.Error, mempool.ErrConflict.Error()) {
+		t.Fatalf("Expected the second spend refused, got %+v, %+v", first, second)
+	}
+
+	// A spend paying a higher fee replaces the pending one
+	service.ReceiveTransaction(&BlockArgs{BlockData: spend(500, "bob")}, &bump)
+	pending := miner.GetPendingTransactions()
+	if !bump.Success || len(pending) != 1 || pending[0].ID != bump.TxID {
+		t.Fatalf("Expected the higher-fee spend to replace the first, got %+v", bump)
+	}
+	if usage := miner.GetMemoryUsage(); usage.MempoolReplaced != 1 || usage.MempoolRefused != 1 {
+		t.Errorf("Unexpected memory usage: %+v", usage)
+	}
+}
+
+func TestMemoRelayPolicy(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil, WithRelayLimits(RelayLimits{MaxMemoBytes: 16}))
+	kp, _ := transaction.GenerateKeyPair()
+	service := &RPCService{miner: miner}
+	submit := func(i int, memo string) TransactionReply {
+		coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 10000, int64(100+i))
+		miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+		tx, err := miner.Blockchain.GetUTXOSet().CreateTransactionWithMemo(
+			[]struct {
+				TxID     string
+				OutIndex int
+			}{{TxID: coinbase.ID, OutIndex: 0}},
+			[]transaction.TxOutput{{Value: 9900, ScriptPubKey: "bob"}},
+			memo,
+			map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create transaction: %v", err)
+		}
+		data, _ := tx.Serialize()
+		var reply TransactionReply
+		service.ReceiveTransaction(&BlockArgs{BlockData: data}, &reply)
+		return reply
+	}
+
+	if reply := submit(0, "order #1001"); !reply.Success {
+		t.Fatalf("A short printable memo should relay: %s", reply.Error)
+	}
+	if pending := miner.GetPendingTransactions(); len(pending) != 1 || pending[0].Memo != "order #1001" {
+		t.Fatalf("Expected the memo kept in the mempool, got %+v", pending)
+	}
+	for i, memo := range []string{"a memo longer than sixteen", "bell\a", "tab\tstop"} {
+		if reply := submit(i+1, memo); reply.Success || !strings.Contains(reply.Error, ErrNonStandardMemo.Error()) {
+			t.Errorf("Expected memo %q refused as non-standard, got %+v", memo, reply)
+		}
+	}
+}
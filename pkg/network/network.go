@@ -2,22 +2,34 @@
 package network
 
 import (
+	"blockchain/pkg/access"
+	"blockchain/pkg/audit"
 	"blockchain/pkg/block"
 	"blockchain/pkg/blockchain"
+	"blockchain/pkg/coinjoin"
 	"blockchain/pkg/config"
-	"blockchain/pkg/pow"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/policy"
 	"blockchain/pkg/transaction"
+	"blockchain/pkg/wallet"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/rpc"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrInvalidPeerChain is returned when a peer's chain fails verification during sync
+var ErrInvalidPeerChain = errors.New("peer sent an invalid chain")
+
 // shortID returns the first 6 characters of an ID for logging
 func shortID(id string) string {
 	if len(id) <= 6 {
@@ -52,49 +64,109 @@ type PeerInfo struct {
 
 // Miner represents a mining node in the network
 type Miner struct {
-	ID            string
-	Address       string
-	Blockchain    *blockchain.Blockchain
-	PendingTxs    []*transaction.Transaction
-	Peers         []PeerInfo
-	txMutex       sync.RWMutex
-	listener      net.Listener
-	rpcServer     *rpc.Server
-	blockCallback func(*block.Block)
-	miningEnabled bool
-	miningMutex   sync.RWMutex
-	stopMining    chan struct{}
-	isMalicious   bool // For testing: if true, creates invalid blocks
-	maliciousType string
-	stopped       bool
-	stoppedMutex  sync.RWMutex
+	ID                   string
+	Address              string
+	Blockchain           *blockchain.Blockchain
+	Peers                []PeerInfo // Guarded by peerMutex once the miner is started
+	txMutex              sync.RWMutex
+	listener             net.Listener
+	blockCallback        func(*block.Block)
+	miningEnabled        bool
+	miningMutex          sync.RWMutex
+	stopMining           chan struct{}
+	newTip               chan struct{}    // Closed when a peer's block changes the tip; see tipChanged
+	newTx                chan struct{}    // Closed when a transaction enters the mempool; see txArrived
+	tipMutex             sync.Mutex       // Guards newTip and newTx
+	templates            []*blockTemplate // Handed out to external miners, oldest first
+	templateMutex        sync.Mutex
+	isMalicious          bool // For testing: if true, creates invalid blocks
+	maliciousType        string
+	stopped              bool
+	stoppedMutex         sync.RWMutex
+	recorder             *MessageRecorder // Optional replay log of received payloads
+	peerRecords          map[string]*PeerRecord
+	peerMutex            sync.RWMutex
+	gcConfig             GCConfig
+	gcMutex              sync.RWMutex
+	done                 chan struct{} // Closed when the miner stops
+	mempool              *mempool.Pool
+	coinjoin             *coinjoin.Coordinator
+	hashMeter            hashRateMeter
+	workMeter            workMeter
+	syncMeter            syncMeter
+	blocksMined          int64
+	feeFloor             float64   // Escalated minimum fee rate, guarded by txMutex
+	feeFloorSet          time.Time // When feeFloor was last raised
+	relayBuckets         map[string]*tokenBucket
+	relayLimited         int64 // Relayed transactions refused by the per-peer rate limit
+	checkpointViolations int64 // Peer chains and blocks refused for contradicting a checkpoint
+	relayMutex           sync.Mutex
+	privateBranch        []*block.Block // coinbase_inflation or selfish blocks withheld from the public chain
+	branchMutex          sync.Mutex
+	watchdog             *watchdog // Resource watchdog state, nil if disabled
+	watchMutex           sync.Mutex
+	standby              *standby // Failover state, nil unless a standby
+	standbyMutex         sync.Mutex
+	forkReports          []ForkReport // Recent reorg reports, oldest first
+	forkMutex            sync.Mutex
+	journalEvents        []JournalEvent // Recent transaction journal, oldest first
+	journalMutex         sync.Mutex
+	checkpoint           *HeaderCheckpoint // Latest header checkpoint signed or served
+	checkpointMutex      sync.Mutex
+	events               eventHub         // Chain and mempool events for subscribers
+	bandwidth            *bandwidthLimits // Sync and relay caps, nil if unlimited
+	resync               resync           // Tip seen by the resync loop
+	resyncMutex          sync.Mutex
+	resyncs              int64     // Resyncs triggered by a stale tip or a longer peer chain
+	syncPending          int32     // Set while a sync started by requestSync runs
+	relaySkipped         int64     // Announced blocks and transactions the peer already had
+	dos                  *dosGuard // Connection, call rate, and ban state of the listener
+	deprecations         deprecationMeter
+	options              MinerOptions
 }
 
 // RPCService provides RPC methods for the miner
 type RPCService struct {
-	miner *Miner
+	miner   *Miner
+	peer    string   // Remote host of the connection; "" for in-process calls
+	session *session // Role of the connection; nil if access is not restricted
 }
 
-// TransactionArgs represents arguments for submitting a transaction
+// TransactionArgs represents arguments for submitting a transaction for the
+// miner to build and sign.
+//
+// Deprecated: the private keys travel to the miner. Sign locally and use
+// RawTransactionArgs with SubmitRawTransaction instead.
 type TransactionArgs struct {
 	InputSpecs []struct {
 		TxID     string
 		OutIndex int
 	} // UTXOs to spend
-	Outputs     []transaction.TxOutput // Transaction outputs
-	PrivateKeys map[string]string      // Map of public key hex -> private key hex
+	Outputs       []transaction.TxOutput // Transaction outputs
+	PrivateKeys   map[string]string      // Map of public key hex -> private key hex
+	CorrelationID string                 // Journal the transaction under this ID (default: a new one)
+}
+
+// RawTransactionArgs carries a transaction the client built and signed itself
+type RawTransactionArgs struct {
+	TxData        []byte // Serialized, fully signed transaction
+	CorrelationID string // Journal the transaction under this ID (default: a new one)
 }
 
 // TransactionReply represents the reply after submitting a transaction
 type TransactionReply struct {
-	Success bool
-	TxID    string
-	Error   string
+	Success       bool
+	TxID          string
+	Error         string
+	Deprecation   string // Set if the call used a deprecated form
+	CorrelationID string // ID the miners journal the submitted transaction under; see GetTxJournal
 }
 
 // BlockArgs represents arguments for receiving a block
 type BlockArgs struct {
-	BlockData []byte
+	BlockData     []byte
+	CorrelationID string // For relayed transactions, the ID they are journaled under
+	Hops          int    // For relayed transactions, relays since the submitting miner
 }
 
 // BlockReply represents the reply after receiving a block
@@ -103,58 +175,185 @@ type BlockReply struct {
 	Error   string
 }
 
-// ChainArgs represents arguments for chain synchronization
+// ChainArgs represents arguments for chain synchronization. A Count of zero
+// (or one past the tip) selects every block from StartIndex on; miners
+// predating Count ignore it and always send the rest of the chain.
 type ChainArgs struct {
 	StartIndex int64
+	Count      int
+	Compress   bool // Ask for gzipped blocks; see FeatureCompression
+	Binary     bool // Ask for binary-encoded blocks; see FeatureBinary
 }
 
 // ChainReply represents the reply with chain data
 type ChainReply struct {
-	Blocks [][]byte
-	Length int
+	Blocks      [][]byte
+	Length      int
+	Compressed  bool   // Each block is gzipped
+	Deprecation string // Set if the call used a deprecated form
 }
 
 // StatusReply represents the miner status
 type StatusReply struct {
-	ID          string
-	ChainLength int
-	PendingTxs  int
-	Peers       int
-	Mining      bool
+	ID                   string
+	ChainLength          int
+	PendingTxs           int
+	Peers                int
+	Mining               bool
+	Paused               string // Why mining and relay are paused by the resource watchdog, if they are
+	Difficulty           int
+	HashRate             float64   // Hashes per second over recent mining rounds
+	Threads              int       // Parallel PoW workers per mining round
+	WorkerRates          []float64 // HashRate split by worker
+	BlocksMined          int64     // Blocks this miner mined and added to its chain
+	CheckpointViolations int64     // Peer chains and blocks refused for contradicting a checkpoint
+	Resyncs              int64     // Resyncs triggered by a stale tip or a longer peer chain
+	RelaySkipped         int64     // Block and transaction bodies not sent because the peer already had them
+	Banned               int       // Hosts banned for sending invalid blocks and transactions
+	Refused              int64     // Connections and calls refused by the server limits
+	TipHash              string
+	TipTime              int64                    // Timestamp of the latest block (Unix nanoseconds)
+	Tree                 blockchain.TreeStats     // Side branches, orphans, and reorgs seen
+	ParamsHash           string                   // Fingerprint of the chain params the node runs with
+	Upgrades             []blockchain.ParamChange // Scheduled parameter changes, applied or not
+	Replica              bool                     // The node is a read replica: it never mines or takes transactions
+}
+
+// MinerOptions configures a single Miner
+type MinerOptions struct {
+	MiningThreads   int                 // Parallel PoW workers (1 = sequential)
+	ChainOptions    []blockchain.Option // Options for the miner's Blockchain
+	PayoutWallet    *wallet.HDWallet    // If set, each coinbase pays a fresh derived address
+	CoinJoin        *CoinJoinConfig     // If set, the miner coordinates coinjoin rounds
+	Blacklist       *policy.Blacklist   // If set, filtered transactions are neither relayed nor mined
+	Limits          MessageLimits       // Size and nesting limits on peer messages
+	Relay           RelayLimits         // Fee and rate limits on incoming transactions
+	Access          *access.Policy      // If set, RPC methods are restricted by the caller's role
+	Audit           *audit.Log          // If set, authenticated mutating calls are recorded
+	Mempool         mempool.Config      // Limits, eviction policy, and TTL of pending transactions
+	MaxBlockTxs     int                 // Most pending transactions included in a mined block
+	TemplateRefresh time.Duration       // How long a round mines its template before new transactions may replace it (0 = never)
+	Watchdog        *WatchdogConfig     // If set, mining and relay pause under resource pressure
+	ForkMonitor     *ForkMonitorConfig  // If set, deep reorgs are written up as fork reports
+	Features        []string            // Protocol features offered to peers (nil = every supported feature)
+	Transport       Transport           // How the miner listens for and dials peers (nil = TCP)
+	CertRole        access.Role         // Role of connections with a verified TLS client certificate ("" = none)
+	Standby         *StandbyConfig      // If set, the miner stays idle until its primary fails
+	Replica         *ReplicaConfig      // If set, the miner only follows the chain and serves queries
+	Checkpoints     *CheckpointConfig   // If set, the miner signs or serves header checkpoints
+	Bandwidth       *BandwidthConfig    // If set, sync and relay traffic are capped in bytes per second
+	Resync          ResyncConfig        // When the miner resyncs on its own after missing blocks
+	Server          ServerLimits        // Connection caps, call rates, and bans on the listener
+}
+
+// MinerOption sets a field of MinerOptions
+type MinerOption func(*MinerOptions)
+
+// WithMiningThreads sets the number of parallel mining threads (<= 0 means 1)
+func WithMiningThreads(threads int) MinerOption {
+	return func(o *MinerOptions) {
+		if threads <= 0 {
+			threads = 1
+		}
+		o.MiningThreads = threads
+	}
+}
+
+// WithChainOptions sets the options used to create the miner's Blockchain
+func WithChainOptions(opts ...blockchain.Option) MinerOption {
+	return func(o *MinerOptions) {
+		o.ChainOptions = append(o.ChainOptions, opts...)
+	}
+}
+
+// DefaultMaxBlockTxs is how many pending transactions a mined block includes
+const DefaultMaxBlockTxs = 10
+
+// WithMaxBlockTxs sets how many pending transactions a mined block includes,
+// picked by fee rate (<= 0 means no limit)
+func WithMaxBlockTxs(n int) MinerOption {
+	return func(o *MinerOptions) {
+		o.MaxBlockTxs = n
+	}
+}
+
+// WithPayoutWallet rotates the coinbase payout address per block, deriving the
+// address for block height h at index h of the wallet
+func WithPayoutWallet(w *wallet.HDWallet) MinerOption {
+	return func(o *MinerOptions) {
+		o.PayoutWallet = w
+	}
 }
 
 // NewMiner creates a new mining node
-func NewMiner(id, address string, difficulty int, peers []PeerInfo) *Miner {
-	return &Miner{
+func NewMiner(id, address string, difficulty int, peers []PeerInfo, opts ...MinerOption) *Miner {
+	options := MinerOptions{
+		MiningThreads:   config.MiningThreads(),
+		Limits:          DefaultMessageLimits(),
+		Relay:           DefaultRelayLimits(),
+		Mempool:         mempool.DefaultConfig(),
+		MaxBlockTxs:     DefaultMaxBlockTxs,
+		TemplateRefresh: DefaultTemplateRefresh,
+		Resync:          DefaultResyncConfig(),
+		Server:          DefaultServerLimits(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	m := &Miner{
 		ID:            id,
 		Address:       address,
-		Blockchain:    blockchain.NewBlockchain(difficulty),
-		PendingTxs:    make([]*transaction.Transaction, 0),
+		Blockchain:    blockchain.NewBlockchain(difficulty, options.ChainOptions...),
+		options:       options,
 		Peers:         peers,
 		miningEnabled: false,
 		stopMining:    make(chan struct{}),
+		newTip:        make(chan struct{}),
+		newTx:         make(chan struct{}),
 		isMalicious:   false,
+		peerRecords:   make(map[string]*PeerRecord),
+		relayBuckets:  make(map[string]*tokenBucket),
+		gcConfig:      DefaultGCConfig(),
+		done:          make(chan struct{}),
+		mempool:       mempool.New(options.Mempool),
+		watchdog:      newWatchdog(options.Watchdog),
+		standby:       newStandby(options.Standby),
+		bandwidth:     newBandwidthLimits(options.Bandwidth),
+		dos:           newDOSGuard(),
 	}
+	if options.CoinJoin != nil {
+		m.setupCoinJoin(*options.CoinJoin)
+	}
+	return m
 }
 
 // NewMaliciousMiner creates a miner that generates invalid blocks for testing
-func NewMaliciousMiner(id, address string, difficulty int, peers []PeerInfo, maliciousType string) *Miner {
-	miner := NewMiner(id, address, difficulty, peers)
+func NewMaliciousMiner(id, address string, difficulty int, peers []PeerInfo, maliciousType string, opts ...MinerOption) *Miner {
+	miner := NewMiner(id, address, difficulty, peers, opts...)
 	miner.isMalicious = true
 	miner.maliciousType = maliciousType
+	switch maliciousType {
+	case "tx_flood", "double_spend", "duplicate_tx":
+		// These spend coinbases, so they must be paid to keys the miner controls
+		if miner.options.PayoutWallet == nil {
+			if w, err := wallet.GenerateHDWallet(); err == nil {
+				miner.options.PayoutWallet = w
+			}
+		}
+	}
 	return miner
 }
 
 // Start starts the miner's RPC server
 func (m *Miner) Start() error {
-	m.rpcServer = rpc.NewServer()
-	service := &RPCService{miner: m}
-	err := m.rpcServer.Register(service)
+	// Each connection gets its own server (see serveConn); check registration up front
+	err := rpc.NewServer().Register(&RPCService{miner: m})
 	if err != nil {
 		return fmt.Errorf("failed to register RPC service: %v", err)
 	}
 
-	listener, err := net.Listen("tcp", m.Address)
+	listener, err := m.transport().Listen(m.Address)
 	if err != nil {
 		return fmt.Errorf("failed to start listener: %v", err)
 	}
@@ -167,10 +366,31 @@ func (m *Miner) Start() error {
 				// Listener was closed
 				return
 			}
-			go m.rpcServer.ServeConn(conn)
+			if err := m.admitConn(conn); err != nil {
+				conn.Close()
+				continue
+			}
+			go m.serveConn(conn)
 		}
 	}()
 
+	go m.gcLoop()
+	if m.watchdog != nil {
+		go m.watchdogLoop()
+	}
+	if m.standby != nil {
+		go m.standbyLoop()
+	}
+	if m.IsReplica() {
+		go m.replicaLoop()
+	}
+	if m.options.Checkpoints != nil {
+		go m.checkpointLoop()
+	}
+	if m.options.Resync.Interval > 0 && !m.IsReplica() {
+		go m.resyncLoop()
+	}
+
 	log.Printf("[%s] Miner started on %s", shortID(m.ID), m.Address)
 	return nil
 }
@@ -178,6 +398,9 @@ func (m *Miner) Start() error {
 // Stop stops the miner
 func (m *Miner) Stop() {
 	m.stoppedMutex.Lock()
+	if !m.stopped {
+		close(m.done)
+	}
 	m.stopped = true
 	m.stoppedMutex.Unlock()
 
@@ -185,6 +408,7 @@ func (m *Miner) Stop() {
 	if m.listener != nil {
 		m.listener.Close()
 	}
+	m.closeEvents()
 	log.Printf("[%s] Miner stopped", shortID(m.ID))
 }
 
@@ -195,8 +419,24 @@ func (m *Miner) IsStopped() bool {
 	return m.stopped
 }
 
-// SubmitTransaction RPC method to receive a transaction from a client
+// SubmitTransaction RPC method to build, sign, and accept a transaction from
+// a client's UTXO selection and private keys.
+//
+// Deprecated: the client's private keys are sent to the miner. Clients sign
+// locally and call SubmitRawTransaction instead.
 func (s *RPCService) SubmitTransaction(args *TransactionArgs, reply *TransactionReply) error {
+	reply.Deprecation = s.miner.noteDeprecated(DeprecatedSubmitTransaction, s.peer)
+	if err := s.miner.checkReplica(); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+	if err := s.miner.checkPressure(); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+
 	// Create a transaction using the provided UTXO inputs and outputs
 	utxoSet := s.miner.Blockchain.GetUTXOSet()
 
@@ -208,137 +448,337 @@ func (s *RPCService) SubmitTransaction(args *TransactionArgs, reply *Transaction
 		return nil
 	}
 
+	s.acceptClientTransaction(tx, args.CorrelationID, reply)
+	return nil
+}
+
+// SubmitRawTransaction RPC method to accept a transaction the client signed
+// itself; no private key leaves the client
+func (s *RPCService) SubmitRawTransaction(args *RawTransactionArgs, reply *TransactionReply) error {
+	if err := s.miner.checkReplica(); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+	limits := s.miner.options.Limits
+	if err := checkPayload(args.TxData, limits.MaxTxBytes, limits.MaxJSONDepth); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+	if err := s.miner.checkPressure(); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+
+	tx, err := transaction.DeserializeTransaction(args.TxData)
+	if err != nil {
+		reply.Success = false
+		reply.Error = fmt.Sprintf("invalid transaction data: %v", err)
+		return nil
+	}
+	// The ID names the transaction in the mempool and in blocks, so it must
+	// be the hash of what was signed
+	if tx.ID != tx.CalculateHash() {
+		reply.Success = false
+		reply.Error = "transaction ID does not match its contents"
+		return nil
+	}
+
+	s.acceptClientTransaction(tx, args.CorrelationID, reply)
+	return nil
+}
+
+// acceptClientTransaction validates a transaction submitted by a client,
+// adds it to the mempool, and relays it to peers. Accepted transactions are
+// journaled under corr, or a new correlation ID.
+func (s *RPCService) acceptClientTransaction(tx *transaction.Transaction, corr string, reply *TransactionReply) {
+	defer func() {
+		if !reply.Success {
+			s.miner.journal(JournalEvent{Kind: JournalRejected, TxID: tx.ID, CorrelationID: corr, Detail: reply.Error})
+		}
+	}()
+
 	// Reject coinbase-like transactions coming over RPC; they must be locally mined
 	if tx.IsCoinbase() {
 		reply.Success = false
 		reply.Error = "coinbase transactions cannot be submitted via RPC"
-		return nil
+		return
 	}
 
-	if !tx.Verify() {
+	if err := tx.Check(); err != nil {
 		reply.Success = false
-		reply.Error = "invalid transaction"
-		return nil
+		reply.Error = fmt.Sprintf("invalid transaction: %v", err)
+		return
+	}
+
+	if err := s.miner.checkPolicy(tx, s.miner.Blockchain.FindUTXO, "accept"); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return
 	}
 
 	// Validate against UTXO set (includes signature verification)
 	if err := s.miner.Blockchain.ValidateTransaction(tx); err != nil {
 		reply.Success = false
 		reply.Error = fmt.Sprintf("transaction validation failed: %v", err)
-		return nil
+		return
+	}
+
+	if err := s.miner.checkMemo(tx); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return
+	}
+
+	if err := s.miner.checkFeeRate(tx, s.miner.Blockchain.FindUTXO); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return
 	}
 
-	s.miner.AddTransaction(tx)
+	if err := s.miner.AddTransaction(tx); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return
+	}
 	reply.Success = true
 	reply.TxID = tx.ID
+	reply.CorrelationID = s.miner.journalSubmitted(tx, corr)
 
 	// Broadcast transaction to peers
 	go s.miner.BroadcastTransaction(tx)
 
-	log.Printf("[%s] Received transaction: %s", shortID(s.miner.ID), tx.String())
-	return nil
+	logging.Debugf("[%s] Received transaction: %s", shortID(s.miner.ID), tx.String())
 }
 
 // ReceiveTransaction RPC method to receive a transaction from another miner
 func (s *RPCService) ReceiveTransaction(args *BlockArgs, reply *TransactionReply) error {
+	if err := s.miner.checkReplica(); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+	limits := s.miner.options.Limits
+	if err := checkPayload(args.BlockData, limits.MaxTxBytes, limits.MaxJSONDepth); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		s.miner.misbehaving(s.peer, ScoreMalformed, "oversized transaction")
+		return nil
+	}
+	if err := s.miner.checkPressure(); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+	if !s.miner.allowRelay(s.peer) {
+		reply.Success = false
+		reply.Error = ErrRelayRateLimited.Error()
+		return nil
+	}
+	s.miner.recordMessage(MsgTransaction, args.BlockData)
+
 	tx, err := transaction.DeserializeTransaction(args.BlockData)
 	if err != nil {
 		reply.Success = false
 		reply.Error = err.Error()
+		s.miner.misbehaving(s.peer, ScoreMalformed, "malformed transaction")
 		return nil
 	}
+	kind := JournalReceived
+	defer func() {
+		event := JournalEvent{Kind: kind, TxID: tx.ID, CorrelationID: args.CorrelationID, Peer: s.peer, Hops: args.Hops}
+		if !reply.Success {
+			event.Kind, event.Detail = JournalRejected, reply.Error
+		}
+		s.miner.journal(event)
+	}()
 
 	// Reject coinbase-like transactions from peers; only locally mined coinbase is valid
 	if tx.IsCoinbase() {
 		reply.Success = false
 		reply.Error = "coinbase transactions cannot be relayed"
+		s.miner.misbehaving(s.peer, ScoreInvalidTx, "relayed coinbase transaction")
+		return nil
+	}
+
+	if tx.ID != tx.CalculateHash() {
+		reply.Success = false
+		reply.Error = "transaction ID does not match its contents"
+		s.miner.misbehaving(s.peer, ScoreInvalidTx, "transaction whose ID does not match its contents")
 		return nil
 	}
 
-	if !tx.Verify() {
+	if err := tx.Check(); err != nil {
 		reply.Success = false
-		reply.Error = "invalid transaction"
+		reply.Error = fmt.Sprintf("invalid transaction: %v", err)
+		s.miner.misbehaving(s.peer, ScoreMalformed, "ill-formed transaction: "+err.Error())
 		return nil
 	}
 
 	// Check if we already have this transaction
-	s.miner.txMutex.RLock()
-	for _, existingTx := range s.miner.PendingTxs {
-		if existingTx.ID == tx.ID {
-			s.miner.txMutex.RUnlock()
-			reply.Success = true
-			reply.TxID = tx.ID
-			return nil
-		}
+	if s.miner.mempool.Has(tx.ID) {
+		kind = JournalDuplicate
+		reply.Success = true
+		reply.TxID = tx.ID
+		return nil
+	}
+
+	if err := s.miner.checkPolicy(tx, s.miner.Blockchain.FindUTXO, "relay"); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
 	}
-	s.miner.txMutex.RUnlock()
 
 	// Validate against UTXO set
+	// Spends of unknown or immature outputs may just race a block, but an
+	// input that does not unlock its output was never valid anywhere
 	if err := s.miner.Blockchain.ValidateTransaction(tx); err != nil {
 		reply.Success = false
 		reply.Error = fmt.Sprintf("transaction validation failed: %v", err)
+		switch {
+		case errors.Is(err, transaction.ErrInvalidSignature):
+			s.miner.misbehaving(s.peer, ScoreInvalidTx, "transaction with an invalid signature")
+		case errors.Is(err, transaction.ErrScriptFailed):
+			s.miner.misbehaving(s.peer, ScoreInvalidTx, "transaction failing its redeem script")
+		}
 		return nil
 	}
 
-	s.miner.AddTransaction(tx)
+	if err := s.miner.checkMemo(tx); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if err := s.miner.checkFeeRate(tx, s.miner.Blockchain.FindUTXO); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if err := s.miner.AddTransaction(tx); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		return nil
+	}
 	reply.Success = true
 	reply.TxID = tx.ID
 
-	log.Printf("[%s] Received transaction from peer: %s", shortID(s.miner.ID), tx.String())
+	logging.Debugf("[%s] Received transaction from peer: %s", shortID(s.miner.ID), tx.String())
 	return nil
 }
 
 // ReceiveBlock RPC method to receive a block from another miner
 func (s *RPCService) ReceiveBlock(args *BlockArgs, reply *BlockReply) error {
+	limits := s.miner.options.Limits
+	if err := checkPayload(args.BlockData, limits.MaxBlockBytes, limits.MaxJSONDepth); err != nil {
+		reply.Success = false
+		reply.Error = err.Error()
+		logging.Warnf("[%s] Rejected block payload: %v", shortID(s.miner.ID), err)
+		s.miner.misbehaving(s.peer, ScoreMalformed, "oversized block")
+		return nil
+	}
+	s.miner.recordMessage(MsgBlock, args.BlockData)
+
 	newBlock, err := block.DeserializeBlock(args.BlockData)
 	if err != nil {
 		reply.Success = false
 		reply.Error = fmt.Sprintf("failed to deserialize block: %v", err)
+		s.miner.misbehaving(s.peer, ScoreMalformed, "malformed block")
 		return nil
 	}
 
-	// Validate the block
+	// Validate the block using this chain's hashing options
+	s.miner.Blockchain.ConfigureBlock(newBlock)
 	if !newBlock.HasValidHash() {
 		reply.Success = false
 		reply.Error = "invalid block hash"
-		log.Printf("[%s] Rejected block with invalid hash from miner %s", shortID(s.miner.ID), shortID(newBlock.MinerID))
+		logging.Warnf("[%s] Rejected block with invalid hash from miner %s", shortID(s.miner.ID), shortID(newBlock.MinerID))
+		s.miner.misbehaving(s.peer, ScoreInvalidBlock, "block with an invalid hash")
 		return nil
 	}
 
-	if !newBlock.HasValidPoW() {
+	if newBlock.UsesMerkleTree() && !newBlock.HasValidMerkleRoot() {
 		reply.Success = false
-		reply.Error = "invalid proof of work"
-		log.Printf("[%s] Rejected block with invalid PoW from miner %s", shortID(s.miner.ID), shortID(newBlock.MinerID))
+		reply.Error = blockchain.ErrInvalidMerkleRoot.Error()
+		logging.Warnf("[%s] Rejected block with mismatched Merkle root from miner %s", shortID(s.miner.ID), shortID(newBlock.MinerID))
+		s.miner.misbehaving(s.peer, ScoreInvalidBlock, "block with a mismatched Merkle root")
 		return nil
 	}
 
-	if !pow.Validate(newBlock) {
+	if err := s.miner.Blockchain.Engine().ValidateHeader(newBlock); err != nil {
 		reply.Success = false
-		reply.Error = "PoW validation failed"
-		log.Printf("[%s] Rejected block - PoW validation failed from miner %s", shortID(s.miner.ID), shortID(newBlock.MinerID))
+		reply.Error = err.Error()
+		logging.Warnf("[%s] Rejected block with invalid PoW from miner %s", shortID(s.miner.ID), shortID(newBlock.MinerID))
+		s.miner.misbehaving(s.peer, ScoreInvalidPoW, "block with invalid proof of work")
 		return nil
 	}
 
-	// Try to add the block
-	err = s.miner.Blockchain.AddBlock(newBlock)
+	// Place the block on the tip, a side branch, or in the orphan pool
+	status, reorg, err := s.miner.Blockchain.ProcessBlock(newBlock)
 	if err != nil {
+		s.miner.noteCheckpointViolation(newBlock.MinerID, err)
+		// A block whose parent is unknown may just be from a branch we never
+		// saw, but one claiming the wrong height over a known parent is invalid
+		if errors.Is(err, blockchain.ErrInvalidIndex) {
+			s.miner.misbehaving(s.peer, ScoreBadPrevHash, "block not following its previous hash")
+		}
+		// Transactions are valid or not on the parent's UTXO set alone, so
+		// no honest miner sends such a block
+		if errors.Is(err, blockchain.ErrInvalidTransaction) {
+			s.miner.misbehaving(s.peer, ScoreInvalidBlock, "block with invalid transactions")
+		}
+		// Without dynamic difficulty every height's requirement is known, so
+		// no honest miner sends an orphan claiming less
+		if errors.Is(err, blockchain.ErrOrphanTooEasy) && !s.miner.Blockchain.Options().UseDynamicDifficulty {
+			s.miner.misbehaving(s.peer, ScoreInvalidPoW, "orphan below the required difficulty")
+		}
 		// If block doesn't fit, might need chain sync
 		if errors.Is(err, blockchain.ErrInvalidPrevHash) || errors.Is(err, blockchain.ErrInvalidIndex) {
 			// Check if their chain might be longer
 			if newBlock.Index > s.miner.Blockchain.GetLatestBlock().Index {
 				// Try to sync with the sender (async to not block RPC)
-				go s.miner.SyncWithAllPeers()
+				s.miner.requestSync()
 			}
 		}
 		reply.Success = false
 		reply.Error = err.Error()
 		return nil
 	}
+	if status == blockchain.BlockSideBranch && reorg == nil {
+		log.Printf("[%s] Kept block #%d from miner %s on a side branch", shortID(s.miner.ID), newBlock.Index, shortID(newBlock.MinerID))
+		reply.Success = false
+		reply.Error = "kept on a side branch"
+		return nil
+	}
 
-	log.Printf("[%s] Accepted block #%d from miner %s", shortID(s.miner.ID), newBlock.Index, shortID(newBlock.MinerID))
-
-	// Remove transactions that are now in the block
-	s.miner.RemoveTransactions(newBlock.Transactions)
+	if reorg != nil {
+		log.Printf("[%s] Reorganized to block #%d from miner %s: %d blocks detached, %d attached",
+			shortID(s.miner.ID), newBlock.Index, shortID(newBlock.MinerID), len(reorg.Detached), len(reorg.Attached))
+		if s.miner.options.ForkMonitor != nil {
+			s.miner.noteReorg(PeerInfo{ID: newBlock.MinerID}, reorg.Base, reorg.Detached, reorg.Attached)
+		}
+	} else {
+		log.Printf("[%s] Accepted block #%d from miner %s", shortID(s.miner.ID), newBlock.Index, shortID(newBlock.MinerID))
+	}
+	s.miner.notifyNewTip()
+
+	// Remove transactions that are now in the main chain
+	if reorg != nil {
+		s.miner.restoreDetached(reorg.Detached, reorg.Attached)
+		for _, b := range reorg.Attached {
+			s.miner.RemoveTransactions(b.Transactions)
+			s.miner.journalBlock(b, JournalConfirmed)
+		}
+		s.miner.publishReorg(reorg.Base, reorg.Detached, reorg.Attached)
+	} else {
+		s.miner.RemoveTransactions(newBlock.Transactions)
+		s.miner.journalBlock(newBlock, JournalConfirmed)
+		// Orphans waiting on the block joined the chain behind it
+		s.miner.publishBlocks(s.miner.Blockchain.GetBlocksFrom(newBlock.Index), false)
+	}
 
 	// Notify callback if set
 	if s.miner.blockCallback != nil {
@@ -352,115 +792,225 @@ func (s *RPCService) ReceiveBlock(args *BlockArgs, reply *BlockReply) error {
 // GetChain RPC method to get the blockchain
 func (s *RPCService) GetChain(args *ChainArgs, reply *ChainReply) error {
 	blocks := s.miner.Blockchain.GetBlocksFrom(args.StartIndex)
+	if args.Count > 0 && args.Count < len(blocks) {
+		blocks = blocks[:args.Count]
+	}
+	binary := args.Binary && slices.Contains(s.miner.features(), FeatureBinary)
 	reply.Blocks = make([][]byte, len(blocks))
 	for i, b := range blocks {
-		data, err := b.Serialize()
+		data, err := serializeAs(b, binary)
 		if err != nil {
 			return err
 		}
 		reply.Blocks[i] = data
 	}
 	reply.Length = s.miner.Blockchain.GetLength()
+	if args.Count == 0 {
+		reply.Deprecation = s.miner.noteDeprecated(DeprecatedFullChain, s.peer)
+	}
+	if s.miner.isMalicious {
+		switch s.miner.maliciousType {
+		case "fake_length":
+			s.miner.inflateChainReply(reply)
+		case "low_difficulty":
+			s.miner.extendWithCheapBlocks(reply)
+		case "coinbase_inflation":
+			s.miner.servePrivateBranch(reply, args.StartIndex)
+		}
+	}
+	if args.Compress && slices.Contains(s.miner.features(), FeatureCompression) {
+		if err := compressBlocks(reply.Blocks); err != nil {
+			return err
+		}
+		reply.Compressed = true
+	}
 	return nil
 }
 
 // GetStatus RPC method to get miner status
 func (s *RPCService) GetStatus(args *struct{}, reply *StatusReply) error {
-	s.miner.txMutex.RLock()
-	pendingCount := len(s.miner.PendingTxs)
-	s.miner.txMutex.RUnlock()
-
 	s.miner.miningMutex.RLock()
 	mining := s.miner.miningEnabled
 	s.miner.miningMutex.RUnlock()
 
 	reply.ID = s.miner.ID
 	reply.ChainLength = s.miner.Blockchain.GetLength()
-	reply.PendingTxs = pendingCount
-	reply.Peers = len(s.miner.Peers)
+	reply.PendingTxs = s.miner.mempool.Len()
+	reply.Peers = len(s.miner.GetPeers())
 	reply.Mining = mining
+	reply.Paused = s.miner.resourcePressure()
+	reply.Difficulty = s.miner.Blockchain.GetDifficulty()
+	reply.HashRate = s.miner.HashRate()
+	reply.Threads = max(s.miner.options.MiningThreads, 1)
+	reply.WorkerRates = s.miner.WorkerHashRates()
+	reply.BlocksMined = atomic.LoadInt64(&s.miner.blocksMined)
+	reply.CheckpointViolations = atomic.LoadInt64(&s.miner.checkpointViolations)
+	reply.Resyncs = atomic.LoadInt64(&s.miner.resyncs)
+	reply.RelaySkipped = atomic.LoadInt64(&s.miner.relaySkipped)
+	reply.Banned = len(s.miner.BannedPeers())
+	s.miner.dos.mu.Lock()
+	reply.Refused = s.miner.dos.refused
+	s.miner.dos.mu.Unlock()
+	tip := s.miner.Blockchain.GetLatestBlock()
+	reply.TipHash = tip.Hash
+	reply.TipTime = tip.Timestamp
+	reply.Tree = s.miner.Blockchain.TreeStats()
+	params := s.miner.Blockchain.Params()
+	reply.ParamsHash = params.Fingerprint()
+	if params != nil {
+		reply.Upgrades = params.Changes
+	}
+	reply.Replica = s.miner.IsReplica()
 	return nil
 }
 
-// AddTransaction adds a transaction to the pending pool
-func (m *Miner) AddTransaction(tx *transaction.Transaction) {
-	m.txMutex.Lock()
-	defer m.txMutex.Unlock()
-
-	// Check for duplicates
-	for _, existingTx := range m.PendingTxs {
-		if existingTx.ID == tx.ID {
-			return
+// AddTransaction adds a transaction to the pending pool, recording the fee it
+// pays against the current chain. Returns mempool.ErrFull if the pool's limits
+// evicted the transaction right away, and mempool.ErrConflict if it spends an
+// output a pending transaction spends without paying enough to replace it.
+func (m *Miner) AddTransaction(tx *transaction.Transaction) error {
+	conflicts := m.mempool.Conflicts(tx)
+	fee := txFee(tx, m.Blockchain.FindUTXO)
+	evicted, err := m.mempool.Add(tx, fee)
+	m.noteEvicted(evicted)
+	if err == nil {
+		m.publishTx(tx, fee)
+		m.notifyNewTx()
+	}
+	if err == nil || errors.Is(err, mempool.ErrFull) {
+		for _, c := range conflicts {
+			log.Printf("[%s] Transaction %s replaced conflicting %s", shortID(m.ID), shortID(tx.ID), shortID(c.Tx.ID))
 		}
+		m.journalDropped(conflicts, "replaced by "+tx.ID)
 	}
-	m.PendingTxs = append(m.PendingTxs, tx)
+	return err
 }
 
-// RemoveTransactions removes transactions from the pending pool
-func (m *Miner) RemoveTransactions(txs []*transaction.Transaction) {
-	m.txMutex.Lock()
-	defer m.txMutex.Unlock()
-
-	txMap := make(map[string]bool)
-	for _, tx := range txs {
-		txMap[tx.ID] = true
+// restoreDetached returns to the pending pool the transactions of blocks a
+// reorg detached. Coinbases stay out, as do transactions the attached blocks
+// confirmed or spent an input of, and those spending outputs of any left out.
+func (m *Miner) restoreDetached(detached, attached []*block.Block) {
+	confirmed := make(map[string]bool)
+	spent := make(map[string]bool)
+	for _, b := range attached {
+		for _, tx := range b.Transactions {
+			confirmed[tx.ID] = true
+			for _, in := range tx.Inputs {
+				spent[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)] = true
+			}
+		}
 	}
-
-	newPending := make([]*transaction.Transaction, 0)
-	for _, tx := range m.PendingTxs {
-		if !txMap[tx.ID] {
-			newPending = append(newPending, tx)
+	gone := make(map[string]bool)
+	restored := 0
+	for _, b := range detached {
+		for _, tx := range b.Transactions {
+			if tx.IsCoinbase() || confirmed[tx.ID] || slices.ContainsFunc(tx.Inputs, func(in transaction.TxInput) bool {
+				return gone[in.TxID] || spent[fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)]
+			}) {
+				gone[tx.ID] = !confirmed[tx.ID]
+				continue
+			}
+			if err := m.AddTransaction(tx); err != nil {
+				logging.Debugf("[%s] Could not return detached transaction %s to the mempool: %v", shortID(m.ID), shortID(tx.ID), err)
+				gone[tx.ID] = true
+				continue
+			}
+			restored++
 		}
 	}
-	m.PendingTxs = newPending
+	if restored > 0 {
+		log.Printf("[%s] Returned %d transactions of detached blocks to the mempool", shortID(m.ID), restored)
+	}
 }
 
-// GetPendingTransactions returns a copy of pending transactions
-func (m *Miner) GetPendingTransactions() []*transaction.Transaction {
-	m.txMutex.RLock()
-	defer m.txMutex.RUnlock()
+// RemoveTransactions removes transactions from the pending pool
+func (m *Miner) RemoveTransactions(txs []*transaction.Transaction) {
+	m.mempool.Remove(txs)
+}
 
-	txs := make([]*transaction.Transaction, len(m.PendingTxs))
-	copy(txs, m.PendingTxs)
-	return txs
+// GetPendingTransactions returns the pending transactions in arrival order
+func (m *Miner) GetPendingTransactions() []*transaction.Transaction {
+	return m.mempool.Transactions()
 }
 
-// BroadcastTransaction broadcasts a transaction to all peers
+// BroadcastTransaction relays a transaction to all peers. Peers supporting
+// FeatureInventory are sent it only if they ask for it when it is announced.
 func (m *Miner) BroadcastTransaction(tx *transaction.Transaction) {
-	data, err := tx.Serialize()
+	binaryData, err := tx.Serialize()
 	if err != nil {
-		log.Printf("[%s] Failed to serialize transaction: %v", shortID(m.ID), err)
+		logging.Errorf("[%s] Failed to serialize transaction: %v", shortID(m.ID), err)
+		return
+	}
+	jsonData, err := tx.SerializeJSON()
+	if err != nil {
+		logging.Errorf("[%s] Failed to serialize transaction: %v", shortID(m.ID), err)
 		return
 	}
 
-	for _, peer := range m.Peers {
+	corr, hops := m.txCorrelation(tx.ID)
+	for _, peer := range m.GetPeers() {
 		go func(p PeerInfo) {
-			client, err := rpc.Dial("tcp", p.Address)
+			client, err := m.dialPeer(p.Address, m.options.Limits.MaxMessageBytes)
+			m.notePeerResult(p.Address, err)
 			if err != nil {
 				return
 			}
 			defer client.Close()
+			if !m.announce(client, p, InvItem{Type: InvTx, Hash: tx.ID}) {
+				return
+			}
 
-			args := &BlockArgs{BlockData: data}
+			data := jsonData
+			if m.peerSupports(p.Address, FeatureBinary) {
+				data = binaryData
+			}
+			args := &BlockArgs{BlockData: data, CorrelationID: corr, Hops: hops + 1}
 			var reply TransactionReply
-			client.Call("RPCService.ReceiveTransaction", args, &reply)
+			if client.Call("RPCService.ReceiveTransaction", args, &reply) == nil {
+				m.journal(JournalEvent{Kind: JournalRelayed, TxID: tx.ID, CorrelationID: corr, Peer: p.Address, Hops: hops})
+			}
 		}(peer)
 	}
 }
 
 // filterValidTransactions filters transactions that are valid against current UTXO set
 func (m *Miner) filterValidTransactions(txs []*transaction.Transaction) []*transaction.Transaction {
+	return m.selectTransactions(txs, 0, 0)
+}
+
+// selectTransactions filters transactions that are valid against current UTXO
+// set, in the given order, taking at most maxTxs of them in at most maxBytes
+// serialized bytes (0 = unlimited). A transaction too large for the space left
+// is passed over for smaller ones after it; its children then fail validation
+// and are passed over too.
+func (m *Miner) selectTransactions(txs []*transaction.Transaction, maxTxs int, maxBytes int64) []*transaction.Transaction {
 	validTxs := make([]*transaction.Transaction, 0)
+	var size int64
 
 	// Create a temporary UTXO set to track spending within this batch
 	tempUTXO := m.Blockchain.GetUTXOSet()
 
 	for _, tx := range txs {
+		if maxTxs > 0 && len(validTxs) >= maxTxs {
+			break
+		}
+
 		// Skip coinbase transactions (they shouldn't be in pending)
 		if tx.IsCoinbase() {
 			continue
 		}
 
+		// Skip transactions that would overflow the block
+		txSize := blockchain.TxSize(tx)
+		if maxBytes > 0 && size+txSize > maxBytes {
+			continue
+		}
+
+		// Skip transactions the node's policy refuses to mine
+		if m.checkPolicy(tx, tempUTXO.FindUTXO, "mine") != nil {
+			continue
+		}
+
 		// Validate against temp UTXO set
 		if err := tempUTXO.ValidateTransaction(tx); err != nil {
 			// Invalid transaction, skip it
@@ -470,12 +1020,14 @@ func (m *Miner) filterValidTransactions(txs []*transaction.Transaction) []*trans
 		// Process transaction to update temp UTXO (prevent double-spend in same block)
 		tempUTXO.ProcessTransaction(tx)
 		validTxs = append(validTxs, tx)
+		size += txSize
 	}
 
 	return validTxs
 }
 
-// BroadcastBlock broadcasts a block to all peers
+// BroadcastBlock relays a block to all peers. Peers supporting
+// FeatureInventory are sent it only if they ask for it when it is announced.
 func (m *Miner) BroadcastBlock(b *block.Block) {
 	// Don't broadcast if miner is stopped
 	if m.IsStopped() {
@@ -484,29 +1036,42 @@ func (m *Miner) BroadcastBlock(b *block.Block) {
 
 	// Validate all transactions before broadcasting
 	if !b.ValidateTransactions() {
-		log.Printf("[%s] Block has invalid transactions, not broadcasting", shortID(m.ID))
+		logging.Warnf("[%s] Block has invalid transactions, not broadcasting", shortID(m.ID))
 		return
 	}
 
-	data, err := b.Serialize()
+	binaryData, err := b.Serialize()
 	if err != nil {
-		log.Printf("[%s] Failed to serialize block: %v", shortID(m.ID), err)
+		logging.Errorf("[%s] Failed to serialize block: %v", shortID(m.ID), err)
+		return
+	}
+	jsonData, err := b.SerializeJSON()
+	if err != nil {
+		logging.Errorf("[%s] Failed to serialize block: %v", shortID(m.ID), err)
 		return
 	}
 
-	for _, peer := range m.Peers {
+	for _, peer := range m.GetPeers() {
 		go func(p PeerInfo) {
 			// Check again before connecting
 			if m.IsStopped() {
 				return
 			}
-			client, err := rpc.Dial("tcp", p.Address)
+			client, err := m.dialPeer(p.Address, m.options.Limits.MaxMessageBytes)
+			m.notePeerResult(p.Address, err)
 			if err != nil {
 				// Silently ignore connection errors (peer may be down)
 				return
 			}
 			defer client.Close()
+			if !m.announce(client, p, InvItem{Type: InvBlock, Hash: b.Hash}) {
+				return
+			}
 
+			data := jsonData
+			if m.peerSupports(p.Address, FeatureBinary) {
+				data = binaryData
+			}
 			args := &BlockArgs{BlockData: data}
 			var reply BlockReply
 			client.Call("RPCService.ReceiveBlock", args, &reply)
@@ -517,6 +1082,18 @@ func (m *Miner) BroadcastBlock(b *block.Block) {
 
 // StartMining starts the mining process
 func (m *Miner) StartMining() {
+	if m.deferMining() {
+		log.Printf("[%s] Mining deferred until resource pressure clears", shortID(m.ID))
+		return
+	}
+	if m.standbyIdle() {
+		log.Printf("[%s] Standing by; mining starts if the primary fails", shortID(m.ID))
+		return
+	}
+	if m.IsReplica() {
+		log.Printf("[%s] Read replicas do not mine", shortID(m.ID))
+		return
+	}
 	m.miningMutex.Lock()
 	if m.miningEnabled {
 		m.miningMutex.Unlock()
@@ -524,9 +1101,10 @@ func (m *Miner) StartMining() {
 	}
 	m.miningEnabled = true
 	m.stopMining = make(chan struct{})
+	stop := m.stopMining
 	m.miningMutex.Unlock()
 
-	go m.miningLoop()
+	go m.miningLoop(stop)
 	log.Printf("[%s] Mining started", shortID(m.ID))
 }
 
@@ -543,82 +1121,150 @@ func (m *Miner) StopMining() {
 	log.Printf("[%s] Mining stopped", shortID(m.ID))
 }
 
-// miningLoop is the main mining loop
-func (m *Miner) miningLoop() {
+// miningLoop is the main mining loop. It mines until stop, the channel
+// StartMining made for it, is closed: once mining restarts, the next loop has
+// a channel of its own.
+func (m *Miner) miningLoop(stop <-chan struct{}) {
 	for {
 		select {
-		case <-m.stopMining:
+		case <-stop:
 			return
 		default:
-			m.mineBlock()
+			m.mineBlockUntil(stop)
 		}
 	}
 }
 
-// mineBlock attempts to mine a new block
-func (m *Miner) mineBlock() {
-	// Get pending transactions (limit to 10 per block for simplicity)
-	pendingTxs := m.GetPendingTransactions()
-
-	// Filter and validate pending transactions against current UTXO set
-	validTxs := m.filterValidTransactions(pendingTxs)
-	if len(validTxs) > 10 {
-		validTxs = validTxs[:10]
+// PayoutAddress returns the address that receives the coinbase of the block at height
+func (m *Miner) PayoutAddress(height int64) string {
+	if m.options.PayoutWallet == nil {
+		return m.ID
 	}
+	return m.options.PayoutWallet.Address(uint32(height))
+}
 
-	// Calculate total fees from transactions
+// assembleBlock builds the next block to mine from the mempool and returns
+// it with its transactions, coinbase first
+func (m *Miner) assembleBlock() (*block.Block, []*transaction.Transaction) {
+	// Best-paying transactions first, up to the block's transaction limit
+	pendingTxs := m.mempool.ByFeeRate()
+	var validTxs []*transaction.Transaction
 	var totalFees int64
-	utxoSet := m.Blockchain.GetUTXOSet()
-	for _, tx := range validTxs {
-		totalFees += tx.GetFee(utxoSet)
+	height := m.Blockchain.GetLatestBlock().Index + 1
+
+	// An empty mempool, the usual case, needs no UTXO snapshots or fee lookups
+	if len(pendingTxs) > 0 {
+		// Fill the block up to the tighter of our own limit and the consensus
+		// limits, leaving room for a coinbase paying any reward
+		maxTxs, maxBytes := m.Blockchain.Params().BlockLimits()
+		if limit := m.options.MaxBlockTxs; limit > 0 && (maxTxs == 0 || limit < maxTxs) {
+			maxTxs = limit
+		}
+		if maxBytes > 0 {
+			largest := transaction.NewCoinbaseTransaction(m.PayoutAddress(height), math.MaxInt64, height)
+			maxBytes = max(maxBytes-blockchain.TxSize(largest), 1)
+		}
+
+		// Filter and validate pending transactions against current UTXO set
+		validTxs = m.selectTransactions(pendingTxs, maxTxs, maxBytes)
+
+		// Calculate total fees from transactions
+		utxoSet := m.Blockchain.GetUTXOSet()
+		for _, tx := range validTxs {
+			totalFees += tx.GetFee(utxoSet)
+		}
 	}
 
-	// Add coinbase transaction (mining reward + fees)
-	// 50 BTC = 5,000,000,000 satoshi
-	reward := int64(5000000000) + totalFees
-	coinbase := transaction.NewCoinbaseTransaction(m.ID, reward, m.Blockchain.GetLatestBlock().Index+1)
+	// Add coinbase transaction (mining reward + fees); the subsidy follows
+	// any scheduled change in the chain params
+	reward := m.Blockchain.Params().SubsidyAt(height) + totalFees
+	coinbase := transaction.NewCoinbaseTransaction(m.PayoutAddress(height), reward, height)
 	txs := append([]*transaction.Transaction{coinbase}, validTxs...)
 
-	// Create new block
-	newBlock := m.Blockchain.CreateBlock(txs, m.ID)
+	// Create new block, claiming exactly what consensus requires (e.g. once
+	// a scheduled difficulty offset applies)
+	b := m.Blockchain.CreateBlock(txs, m.ID)
+	b.Difficulty = m.Blockchain.RequiredDifficulty(b.Index)
 
-	// Mine the block
-	powInstance := pow.NewProofOfWork(newBlock)
+	// Date it after the recent blocks even if peers' clocks run ahead of ours
+	if mtp := m.Blockchain.MedianTimePast(); b.Timestamp <= mtp {
+		b.Timestamp = mtp + 1
+	}
+	return b, txs
+}
 
+// mineBlock attempts to mine a new block, abandoned if mining stops
+func (m *Miner) mineBlock() {
 	m.miningMutex.RLock()
-	stopChan := m.stopMining
+	stop := m.stopMining
 	m.miningMutex.RUnlock()
+	m.mineBlockUntil(stop)
+}
 
-	// Use context for cancellation
-	done := make(chan struct{})
-	var result *pow.MiningResult
+// mineBlockUntil attempts to mine a new block, abandoned once stop is closed.
+// The round is also abandoned as soon as a block from a peer changes the tip,
+// since its block could no longer be added, and once TemplateRefresh has
+// passed if new transactions would pay more fees, so the next round mines them.
+func (m *Miner) mineBlockUntil(stop <-chan struct{}) {
+	newTip := m.tipChanged()
+	newBlock, txs := m.assembleBlock()
+	faulty := false
+	if m.isMalicious {
+		switch m.maliciousType {
+		case "low_difficulty":
+			// Claim a trivial difficulty and mine only to that claim
+			newBlock.Difficulty = lowDifficultyClaim
+		case "coinbase_inflation":
+			// Mine on the withheld branch instead of the public tip
+			newBlock = m.nextInflatedBlock()
+		case "selfish":
+			// Publish the withheld branch if honest miners caught up, and
+			// mine on whatever is still withheld
+			m.releaseSelfishBranch()
+			newBlock = m.nextBranchBlock(m.Blockchain.Params().SubsidyAt)
+		default:
+			faulty = m.injectFault(newBlock)
+		}
+	}
 
+	// Stopping mining, a new tip, or a better template cancels the round; the
+	// PoW returns with its attempt count. A malicious round mines as it began.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stale, refreshed atomic.Bool
 	go func() {
-		// Use parallel mining if threads > 1, otherwise use sequential mining
-		threads := config.MiningThreads()
-		if threads > 1 {
-			result = powInstance.MineParallel(context.TODO(), threads)
-		} else {
-			// Replace nil with context.TODO() to avoid passing a nil context
-			result = powInstance.Mine(context.TODO(), func(nonce int64) {
-				select {
-				case <-stopChan:
-					return
-				default:
-				}
-			})
-		}
-		close(done)
+		select {
+		case <-stop:
+			cancel()
+		case <-newTip:
+			stale.Store(true)
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
-
-	// Wait for mining to complete or be cancelled
-	select {
-	case <-stopChan:
-		return
-	case <-done:
+	if !m.isMalicious {
+		go func() {
+			if m.watchTemplate(txs, ctx.Done()) {
+				refreshed.Store(true)
+				cancel()
+			}
+		}()
 	}
 
-	if result == nil || !result.Success {
+	started := time.Now()
+	// Seal the block, on parallel workers if threads > 1
+	result := m.Blockchain.Engine().Seal(ctx, newBlock, m.options.MiningThreads)
+
+	m.hashMeter.add(result.WorkerAttempts, time.Since(started))
+	if !result.Success {
+		if stale.Load() {
+			m.workMeter.discard(restartNewTip, result.Attempts)
+		} else if refreshed.Load() {
+			m.workMeter.discard(restartRefresh, result.Attempts)
+			logging.Debugf("[%s] Refreshing block template for new transactions", shortID(m.ID))
+		} else {
+			m.workMeter.discard(restartCancelled, result.Attempts)
+		}
 		return
 	}
 
@@ -636,6 +1282,41 @@ func (m *Miner) mineBlock() {
 			// Corrupt the previous hash
 			result.Block.PrevHash = "0000000000000000000000000000000000000000000000000000000000000001"
 			result.Block.Hash = result.Block.CalculateHash()
+		case "tx_flood":
+			// Mine honestly to fund the flood
+			m.floodTransactions()
+		case "oversized":
+			// Mine honestly, but flood peers with oversized payloads
+			m.sendOversizedPayloads()
+		case "invalid_merkle":
+			// Swap the coinbase after mining; the hash still commits to the old root
+			coinbase := txs[0]
+			result.Block.Transactions[0] = transaction.NewCoinbaseTransaction(m.ID+"-swapped", coinbase.TotalOutputValue(), result.Block.Index)
+			log.Printf("[MALICIOUS %s] Pushing block #%d whose transactions don't match its Merkle root",
+				shortID(m.ID), result.Block.Index)
+			m.BroadcastBlock(result.Block)
+			return
+		case "coinbase_inflation":
+			m.extendPrivateBranch(result.Block)
+			return
+		case "selfish":
+			m.withholdBlock(result.Block)
+			return
+		case "excess_coinbase", "missing_coinbase", "duplicate_tx", "double_spend", "future_timestamp":
+			if !faulty {
+				break // Mine honestly until there is something to inject
+			}
+			// Our own chain rejects the block, so push it to peers directly
+			log.Printf("[MALICIOUS %s] Pushing %s block #%d with %d transactions",
+				shortID(m.ID), m.maliciousType, result.Block.Index, len(result.Block.Transactions))
+			m.BroadcastBlock(result.Block)
+			return
+		case "low_difficulty":
+			// Our own chain rejects the block too, so push it to peers directly
+			log.Printf("[MALICIOUS %s] Pushing block #%d claiming difficulty %d (%d attempts)",
+				shortID(m.ID), result.Block.Index, result.Block.Difficulty, result.Attempts)
+			m.BroadcastBlock(result.Block)
+			return
 		}
 	}
 
@@ -644,69 +1325,194 @@ func (m *Miner) mineBlock() {
 	if err != nil {
 		// This is normal during blockchain competition, another miner beat us
 		// No need to log this as it's expected behavior
+		if m.Blockchain.GetLatestBlock().Hash != result.Block.PrevHash {
+			m.workMeter.discard(restartNewTip, result.Attempts)
+		} else {
+			m.workMeter.discard(restartTemplate, result.Attempts)
+		}
 		return
 	}
 
+	m.workMeter.accept(result.Attempts)
 	log.Printf("[%s] Mined block #%d with %d transactions, nonce: %d",
 		shortID(m.ID), result.Block.Index, len(result.Block.Transactions), result.Nonce)
-
-	// Remove included transactions from pending pool
-	m.RemoveTransactions(txs)
-
-	// Broadcast the block
-	m.BroadcastBlock(result.Block)
-
-	// Notify callback
-	if m.blockCallback != nil {
-		m.blockCallback(result.Block)
-	}
+	m.acceptMinedBlock(result.Block, txs)
 }
 
-// SyncWithPeer synchronizes the blockchain with a peer
-func (m *Miner) SyncWithPeer(peer PeerInfo) error {
-	client, err := rpc.Dial("tcp", peer.Address)
+// SyncWithPeer synchronizes the blockchain with a peer, headers first: the
+// peer's header chain is fetched and checked (hash link and proof of work),
+// then only the blocks past the point where it forks from ours are downloaded
+// and each must match its header. The peer's advertised length is never
+// trusted on its own, so a forged chain is dropped at its first bad header
+// before any body is fetched. Peers without GetHeaders send their full chain.
+// Which protocol features to use is negotiated on first contact.
+// Replies are bounded by MaxChainBytes and each block by the block limits.
+func (m *Miner) SyncWithPeer(peer PeerInfo) (err error) {
+	defer func() { m.noteCheckpointViolation(peer.ID, err) }()
+	client, err := m.dialPeer(peer.Address, m.options.Limits.MaxChainBytes)
+	m.notePeerResult(peer.Address, err)
 	if err != nil {
 		return fmt.Errorf("failed to connect to peer: %v", err)
 	}
 	defer client.Close()
 
-	args := &ChainArgs{StartIndex: 0}
+	if !slices.Contains(m.peerFeatures(client, peer), FeatureHeaders) {
+		return m.syncFullChain(client, peer)
+	}
+	headers, err := m.fetchHeaders(client)
+	if err != nil && methodUnsupported(err) {
+		return m.syncFullChain(client, peer)
+	}
+	if errors.Is(err, ErrInvalidPeerChain) {
+		logging.Warnf("[%s] Rejected chain from peer %s: %v", shortID(m.ID), shortID(peer.ID), err)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get headers: %v", err)
+	}
+	if headers == nil {
+		return nil // Our chain is longer or equal
+	}
+
+	// Keep our blocks up to the fork; download the rest
+	local := m.Blockchain.GetBlocks()
+	fork := 0
+	for fork < len(local) && local[fork].Hash == headers[fork].Hash {
+		fork++
+	}
+	var prev *block.Block
+	if fork > 0 {
+		prev = local[fork-1]
+	}
+	bodies, err := m.downloadBlocks(client, peer, prev, headers[fork:])
+	if errors.Is(err, ErrInvalidPeerChain) {
+		logging.Warnf("[%s] Rejected chain from peer %s: %v", shortID(m.ID), shortID(peer.ID), err)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	blocks := append(local[:fork:fork], bodies...)
+	if err := m.adoptPeerChain(peer, blocks); err != nil {
+		return err
+	}
+
+	log.Printf("[%s] Synchronized chain with peer %s, new length: %d (downloaded %d blocks)",
+		shortID(m.ID), shortID(peer.ID), len(blocks), len(bodies))
+	return nil
+}
+
+// syncFullChain synchronizes with a peer that predates GetHeaders by
+// downloading its whole chain. The advertised length must match the blocks
+// actually sent.
+func (m *Miner) syncFullChain(client *rpc.Client, peer PeerInfo) error {
+	args := &ChainArgs{StartIndex: 0, Binary: m.peerSupports(peer.Address, FeatureBinary)}
 	var reply ChainReply
-	err = client.Call("RPCService.GetChain", args, &reply)
+	err := client.Call("RPCService.GetChain", args, &reply)
 	if err != nil {
 		return fmt.Errorf("failed to get chain: %v", err)
 	}
 
-	if reply.Length <= m.Blockchain.GetLength() {
+	if reply.Length != len(reply.Blocks) {
+		err := fmt.Errorf("%w: advertised length %d but sent %d blocks", ErrInvalidPeerChain, reply.Length, len(reply.Blocks))
+		logging.Warnf("[%s] Rejected chain from peer %s: %v", shortID(m.ID), shortID(peer.ID), err)
+		return err
+	}
+	if len(reply.Blocks) <= m.Blockchain.GetLength() {
 		return nil // Our chain is longer or equal
 	}
 
-	// Deserialize blocks
-	blocks := make([]*block.Block, len(reply.Blocks))
-	for i, data := range reply.Blocks {
-		b, err := block.DeserializeBlock(data)
+	blocks, err := m.decodePeerBlocks(reply.Blocks, nil, nil)
+	if err != nil {
+		logging.Warnf("[%s] Rejected chain from peer %s: %v", shortID(m.ID), shortID(peer.ID), err)
+		return err
+	}
+	if err := m.adoptPeerChain(peer, blocks); err != nil {
+		return err
+	}
+
+	log.Printf("[%s] Synchronized chain with peer %s, new length: %d", shortID(m.ID), shortID(peer.ID), len(blocks))
+	return nil
+}
+
+// decodePeerBlocks deserializes blocks sent by a peer, verifying each header
+// as it is decoded. The first block must follow prev (nil for a chain from
+// genesis) and, when headers is given, each block must match its header.
+func (m *Miner) decodePeerBlocks(data [][]byte, prev *block.Block, headers []BlockHeader) ([]*block.Block, error) {
+	blocks := make([]*block.Block, len(data))
+	limits := m.options.Limits
+	for i, raw := range data {
+		height := i
+		if prev != nil {
+			height += int(prev.Index) + 1
+		}
+		if err := checkPayload(raw, limits.MaxBlockBytes, limits.MaxJSONDepth); err != nil {
+			return nil, fmt.Errorf("%w: block #%d: %w", ErrInvalidPeerChain, height, err)
+		}
+		b, err := block.DeserializeBlock(raw)
 		if err != nil {
-			return fmt.Errorf("failed to deserialize block: %v", err)
+			return nil, fmt.Errorf("failed to deserialize block: %v", err)
+		}
+		data[i] = nil // Decoded; let the raw bytes be collected
+		if headers != nil && b.Hash != headers[i].Hash {
+			return nil, fmt.Errorf("%w: block #%d does not match its header", ErrInvalidPeerChain, height)
+		}
+		if err := m.Blockchain.VerifyHeader(b, prev); err != nil {
+			return nil, fmt.Errorf("%w: block #%d: %w", ErrInvalidPeerChain, height, err)
 		}
 		blocks[i] = b
+		prev = b
 	}
+	return blocks, nil
+}
 
-	// Replace chain if valid and longer
-	err = m.Blockchain.ReplaceChain(blocks)
-	if err != nil {
-		return fmt.Errorf("failed to replace chain: %v", err)
+// adoptPeerChain records a chain synchronized from a peer and replaces ours
+// with it if it is valid and longer. With the fork monitor on, a reorg deep
+// enough is reported.
+func (m *Miner) adoptPeerChain(peer PeerInfo, blocks []*block.Block) error {
+	if m.recorder != nil {
+		if data, err := SerializeBlocks(blocks); err == nil {
+			m.recordMessage(MsgResponseChain, data)
+		}
 	}
 
-	log.Printf("[%s] Synchronized chain with peer %s, new length: %d", shortID(m.ID), shortID(peer.ID), len(blocks))
+	fork := m.forkPoint(blocks)
+	old := m.Blockchain.GetBlocksFrom(fork)
+	if err := m.Blockchain.ReplaceChain(blocks); err != nil {
+		return fmt.Errorf("failed to replace chain: %w", err)
+	}
+	m.notifyNewTip()
+	var base *block.Block
+	if fork > 0 {
+		base = blocks[fork-1]
+	}
+	if m.options.ForkMonitor != nil {
+		m.noteReorg(peer, base, old, blocks[fork:])
+	}
+	if len(old) > 0 {
+		m.publishReorg(base, old, blocks[fork:])
+	} else {
+		m.publishBlocks(blocks[fork:], false)
+	}
 	return nil
 }
 
+// noteCheckpointViolation counts and logs a chain or block from source that
+// was refused for contradicting a checkpoint. Any other error is ignored.
+func (m *Miner) noteCheckpointViolation(source string, err error) {
+	if !errors.Is(err, blockchain.ErrCheckpointMismatch) {
+		return
+	}
+	atomic.AddInt64(&m.checkpointViolations, 1)
+	logging.Warnf("[%s] CHECKPOINT: refused chain from %s: %v", shortID(m.ID), shortID(source), err)
+}
+
 // SyncWithAllPeers synchronizes with all peers
 func (m *Miner) SyncWithAllPeers() {
 	if m.IsStopped() {
 		return
 	}
-	for _, peer := range m.Peers {
+	for _, peer := range m.GetPeers() {
 		if m.IsStopped() {
 			return
 		}
@@ -728,8 +1534,10 @@ func (m *Miner) SetDifficulty(difficulty int) {
 
 // Client represents a blockchain client (wallet)
 type Client struct {
-	ID     string
-	Miners []PeerInfo
+	ID        string
+	Miners    []PeerInfo
+	Auth      Credentials // Presented to miners that restrict access; zero for anonymous
+	Transport Transport   // How miners are dialed; nil for TCP
 }
 
 // NewClient creates a new client
@@ -740,7 +1548,9 @@ func NewClient(id string, miners []PeerInfo) *Client {
 	}
 }
 
-// SubmitTransaction submits a transaction to a miner
+// SubmitTransaction builds and signs a transaction locally and submits it to
+// the first reachable miner. The outputs being spent are looked up by the
+// owners' addresses, so private keys never leave the client.
 // inputSpecs: UTXOs to spend
 // outputs: transaction outputs
 // privateKeys: map of public key -> private key for signing
@@ -758,35 +1568,56 @@ func (c *Client) SubmitTransaction(
 
 	// Connect to first available miner
 	for _, miner := range c.Miners {
-		client, err := rpc.Dial("tcp", miner.Address)
+		client, err := c.dial(miner.Address)
 		if err != nil {
 			continue
 		}
 		defer client.Close()
 
-		args := &TransactionArgs{
-			InputSpecs:  inputSpecs,
-			Outputs:     outputs,
-			PrivateKeys: privateKeys,
+		// The miner only needs to tell us the owners' outputs
+		utxoSet := transaction.NewUTXOSet()
+		for address := range privateKeys {
+			var utxos UTXOsReply
+			if err = client.Call("RPCService.GetUTXOs", &AddressArgs{Address: address}, &utxos); err != nil {
+				break
+			}
+			for _, u := range utxos.UTXOs {
+				utxoSet.AddUTXO(u.TxID, u.OutIndex, u.Value, u.ScriptPubKey)
+			}
 		}
-		var reply TransactionReply
-		err = client.Call("RPCService.SubmitTransaction", args, &reply)
 		if err != nil {
 			continue
 		}
-
-		if reply.Success {
-			return reply.TxID, nil
+		tx, err := utxoSet.CreateTransaction(inputSpecs, outputs, privateKeys)
+		if err != nil {
+			return "", err
 		}
-		return "", errors.New(reply.Error)
+		return SubmitRawTransaction(client, tx)
 	}
 
 	return "", errors.New("failed to connect to any miner")
 }
 
+// SubmitRawTransaction submits a transaction signed by the caller over an
+// open connection and returns its ID
+func SubmitRawTransaction(client *rpc.Client, tx *transaction.Transaction) (string, error) {
+	data, err := tx.SerializeJSON()
+	if err != nil {
+		return "", err
+	}
+	var reply TransactionReply
+	if err := client.Call("RPCService.SubmitRawTransaction", &RawTransactionArgs{TxData: data}, &reply); err != nil {
+		return "", err
+	}
+	if !reply.Success {
+		return "", errors.New(reply.Error)
+	}
+	return reply.TxID, nil
+}
+
 // GetMinerStatus gets the status of a miner
 func (c *Client) GetMinerStatus(minerAddress string) (*StatusReply, error) {
-	client, err := rpc.Dial("tcp", minerAddress)
+	client, err := c.dial(minerAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -801,23 +1632,78 @@ func (c *Client) GetMinerStatus(minerAddress string) (*StatusReply, error) {
 	return &reply, nil
 }
 
+// GetBlockByHash gets one block from a miner by hash, or nil if the miner has
+// no such block
+func (c *Client) GetBlockByHash(minerAddress, hash string) (*block.Block, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	return c.getBlock(minerAddress, &BlockQueryArgs{Hash: hash})
+}
+
+// GetBlockByIndex gets the block at a height of a miner's chain, or nil if the
+// chain is shorter
+func (c *Client) GetBlockByIndex(minerAddress string, index int64) (*block.Block, error) {
+	return c.getBlock(minerAddress, &BlockQueryArgs{Height: index})
+}
+
+// getBlock looks up a block with the GetBlock RPC
+func (c *Client) getBlock(minerAddress string, args *BlockQueryArgs) (*block.Block, error) {
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var reply BlockQueryReply
+	if err := client.Call("RPCService.GetBlock", args, &reply); err != nil {
+		return nil, err
+	}
+	if !reply.Found {
+		return nil, nil
+	}
+	return block.DeserializeBlock(reply.BlockData)
+}
+
+// GetTransaction gets a confirmed or pending transaction from a miner, along
+// with where it is confirmed. The transaction is nil if the miner doesn't
+// know it.
+func (c *Client) GetTransaction(minerAddress, txID string) (*transaction.Transaction, *TxQueryReply, error) {
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+
+	var reply TxQueryReply
+	if err := client.Call("RPCService.GetTransaction", &TxQueryArgs{TxID: txID}, &reply); err != nil {
+		return nil, nil, err
+	}
+	if !reply.Found {
+		return nil, &reply, nil
+	}
+	tx, err := transaction.DeserializeTransaction(reply.TxData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, &reply, nil
+}
+
 // GetChain gets the blockchain from a miner
 func (c *Client) GetChain(minerAddress string) ([]*block.Block, error) {
-	client, err := rpc.Dial("tcp", minerAddress)
+	client, err := c.dial(minerAddress)
 	if err != nil {
 		return nil, err
 	}
 	defer client.Close()
 
-	args := &ChainArgs{StartIndex: 0}
-	var reply ChainReply
-	err = client.Call("RPCService.GetChain", args, &reply)
+	chain, err := FetchChain(client, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	blocks := make([]*block.Block, len(reply.Blocks))
-	for i, data := range reply.Blocks {
+	blocks := make([]*block.Block, len(chain))
+	for i, data := range chain {
 		b, err := block.DeserializeBlock(data)
 		if err != nil {
 			return nil, err
@@ -2,8 +2,13 @@ package network
 
 import (
 	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/storage"
+	"blockchain/pkg/stress"
 	"blockchain/pkg/transaction"
+	"blockchain/pkg/wallet"
 	"fmt"
+	"math"
 	"net/rpc"
 	"sync"
 	"testing"
@@ -95,6 +100,57 @@ func TestSubmitTransaction(t *testing.T) {
 	}
 }
 
+func TestSubmitRawTransaction(t *testing.T) {
+	kp, err := transaction.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	pub := kp.GetPublicKeyHex()
+
+	miner := NewMiner("miner1", "localhost:19110", 2, nil)
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+	service := &RPCService{miner: miner}
+
+	funding := transaction.NewCoinbaseTransaction(pub, 5000000000, 0)
+	miner.Blockchain.UTXOSet.ProcessTransaction(funding)
+	inputs := []struct {
+		TxID     string
+		OutIndex int
+	}{{TxID: funding.ID, OutIndex: 0}}
+
+	// A tampered ID is refused before validation
+	tx, err := miner.Blockchain.GetUTXOSet().CreateTransaction(inputs,
+		[]transaction.TxOutput{{Value: 4000000000, ScriptPubKey: "bob"}},
+		map[string]string{pub: kp.GetPrivateKeyHex()})
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	tx.ID = "forged"
+	data, _ := tx.Serialize()
+	var reply TransactionReply
+	service.SubmitRawTransaction(&RawTransactionArgs{TxData: data}, &reply)
+	if reply.Success || len(miner.GetPendingTransactions()) != 0 {
+		t.Fatalf("Transaction with a forged ID should be rejected, got %+v", reply)
+	}
+
+	// The client signs with keys the miner never sees
+	client := NewClient("test", []PeerInfo{{ID: "miner1", Address: "localhost:19110"}})
+	txID, err := client.SubmitTransaction(inputs,
+		[]transaction.TxOutput{{Value: 4000000000, ScriptPubKey: "bob"}},
+		map[string]string{pub: kp.GetPrivateKeyHex()})
+	if err != nil {
+		t.Fatalf("Failed to submit transaction: %v", err)
+	}
+	pending := miner.GetPendingTransactions()
+	if len(pending) != 1 || pending[0].ID != txID {
+		t.Errorf("Expected the submitted transaction to be pending, got %d", len(pending))
+	}
+
+}
+
 func TestMiningProducesBlocks(t *testing.T) {
 	miner := NewMiner("miner1", "localhost:19003", 2, nil)
 	err := miner.Start()
@@ -367,6 +423,155 @@ func TestGetChain(t *testing.T) {
 	}
 }
 
+func TestSyncDownloadsOnlyMissingBlocks(t *testing.T) {
+	peer := NewMiner("peer", "localhost:19111", 1, nil)
+	for i := 0; i < 12; i++ {
+		peer.mineBlock()
+	}
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer peer.Stop()
+
+	service := &RPCService{miner: peer}
+	var headers HeadersReply
+	if err := service.GetHeaders(&HeadersArgs{StartIndex: 10, Count: 2}, &headers); err != nil {
+		t.Fatalf("GetHeaders failed: %v", err)
+	}
+	if headers.Length != 13 || len(headers.Headers) != 2 || headers.Headers[0].Hash != peer.Blockchain.GetBlockByHeight(10).Hash {
+		t.Fatalf("Expected headers 10 and 11 of 13, got %+v", headers)
+	}
+
+	// The first ten blocks are shared. A limit below the size of the whole
+	// chain as JSON only lets the sync through if it skips them.
+	blocks := peer.Blockchain.GetBlocks()
+	var chainBytes int64
+	for _, b := range blocks {
+		data, _ := b.SerializeJSON()
+		chainBytes += int64(len(data))
+	}
+	honest := NewMiner("honest", "localhost:0", 1, nil, WithMessageLimits(MessageLimits{MaxChainBytes: chainBytes}))
+	honest.Blockchain = blockchain.NewBlockchainFromBlocks(blocks[:10], 1)
+
+	if err := honest.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19111"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if honest.Blockchain.GetLength() != 13 || honest.Blockchain.GetLatestBlock().Hash != blocks[12].Hash {
+		t.Errorf("Expected the peer's chain of 13 blocks, got %d", honest.Blockchain.GetLength())
+	}
+
+	// Syncing from scratch without compression or the binary encoding needs
+	// the whole chain as JSON in one reply
+	fresh := NewMiner("fresh", "localhost:0", 1, nil, WithMessageLimits(MessageLimits{MaxChainBytes: chainBytes}),
+		WithFeatures([]string{FeatureHeaders, FeatureRangeSync}))
+	if err := fresh.SyncWithPeer(PeerInfo{ID: "peer", Address: "localhost:19111"}); err == nil {
+		t.Error("A full chain download should exceed the limit")
+	}
+}
+
+func TestSyncDownloadsRangesFromSeveralPeers(t *testing.T) {
+	source := NewMiner("source", "localhost:19117", 1, nil)
+	for i := 0; i < 2*syncRangeBlocks+20; i++ {
+		source.mineBlock()
+	}
+	blocks := source.Blockchain.GetBlocks()
+
+	// One helper shares the chain, one has a chain of its own, and one is down
+	helper := NewMiner("helper", "localhost:19118", 1, nil)
+	helper.Blockchain = blockchain.NewBlockchainFromBlocks(blocks, 1)
+	divergent := NewMiner("divergent", "localhost:19119", 1, nil)
+	for i := 0; i < len(blocks); i++ {
+		divergent.mineBlock()
+	}
+	for _, m := range []*Miner{source, helper, divergent} {
+		if err := m.Start(); err != nil {
+			t.Fatalf("Failed to start %s: %v", m.ID, err)
+		}
+		defer m.Stop()
+	}
+
+	honest := NewMiner("honest", "localhost:0", 1, []PeerInfo{
+		{ID: "source", Address: "localhost:19117"},
+		{ID: "helper", Address: "localhost:19118"},
+		{ID: "divergent", Address: "localhost:19119"},
+		{ID: "offline", Address: "localhost:19120"},
+	})
+	if err := honest.SyncWithPeer(PeerInfo{ID: "source", Address: "localhost:19117"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if honest.Blockchain.GetLength() != len(blocks) || honest.Blockchain.GetLatestBlock().Hash != blocks[len(blocks)-1].Hash {
+		t.Fatalf("Expected the source's chain of %d blocks, got %d", len(blocks), honest.Blockchain.GetLength())
+	}
+
+	contacted := make(map[string]bool)
+	for _, rec := range honest.GetPeerRecords() {
+		contacted[rec.Address] = !rec.LastSuccess.IsZero()
+	}
+	if !contacted["localhost:19118"] || !contacted["localhost:19119"] {
+		t.Errorf("Expected both running helpers to be contacted, got %v", contacted)
+	}
+	if contacted["localhost:19120"] {
+		t.Error("The offline helper should be recorded as failed")
+	}
+
+	// Every batch the divergent helper served was fetched again from the source
+	stats := honest.SyncStats()
+	var failures int64
+	for _, p := range stats.Peers {
+		failures += p.Failures
+	}
+	if stats.Blocks != int64(len(blocks)) || stats.Retries != failures {
+		t.Errorf("Expected %d blocks and a retry per failed batch, got %+v", len(blocks), stats)
+	}
+}
+
+func TestGetChainCachedDownloadsOnlyNewBlocks(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:19115", 1, nil)
+	for i := 0; i < 3; i++ {
+		miner.mineBlock()
+	}
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	cache, err := storage.OpenBlockCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	client := NewClient("test", nil)
+	fetch := func(wantLength, wantDownloaded int) {
+		t.Helper()
+		blocks, downloaded, err := client.GetChainCached("localhost:19115", cache)
+		if err != nil {
+			t.Fatalf("GetChainCached failed: %v", err)
+		}
+		if len(blocks) != wantLength || downloaded != wantDownloaded {
+			t.Fatalf("Expected %d blocks with %d downloaded, got %d with %d", wantLength, wantDownloaded, len(blocks), downloaded)
+		}
+		if blocks[len(blocks)-1].Hash != miner.Blockchain.GetLatestBlock().Hash {
+			t.Fatal("Cached chain should end at the miner's tip")
+		}
+	}
+
+	fetch(4, 4)
+	fetch(4, 0)
+	miner.mineBlock()
+	miner.mineBlock()
+	fetch(6, 2)
+
+	// A longer branch forking after block 2 replaces the cached tip
+	fork := NewMiner("fork", "localhost:0", 1, nil)
+	fork.Blockchain = blockchain.NewBlockchainFromBlocks(miner.Blockchain.GetBlocks()[:3], 1)
+	for i := 0; i < 4; i++ {
+		fork.mineBlock()
+	}
+	if err := miner.Blockchain.ReplaceChain(fork.Blockchain.GetBlocks()); err != nil {
+		t.Fatalf("Failed to reorganize: %v", err)
+	}
+	fetch(7, 4)
+}
+
 func TestLongestChainWins(t *testing.T) {
 	// Create two separate chains, then sync
 	miner1 := NewMiner("miner1", "localhost:19060", 2, nil)
@@ -505,3 +710,131 @@ func TestFiveMinersGenerateBlocks(t *testing.T) {
 		}
 	}
 }
+
+func TestMinerOptions(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil,
+		WithMiningThreads(4),
+		WithChainOptions(blockchain.WithMerkleTree(false)),
+	)
+	if miner.options.MiningThreads != 4 {
+		t.Errorf("Expected 4 mining threads, got %d", miner.options.MiningThreads)
+	}
+	if miner.Blockchain.Options().UseMerkleTree {
+		t.Error("Chain option should disable Merkle mode for this miner only")
+	}
+
+	other := NewMiner("miner2", "localhost:0", 2, nil, WithMiningThreads(0))
+	if other.options.MiningThreads != 1 {
+		t.Errorf("Non-positive thread count should default to 1, got %d", other.options.MiningThreads)
+	}
+	if !other.Blockchain.Options().UseMerkleTree {
+		t.Error("Another miner's options must not leak into this one")
+	}
+}
+
+func TestPayoutWalletRotatesCoinbaseAddress(t *testing.T) {
+	w, err := wallet.GenerateHDWallet()
+	if err != nil {
+		t.Fatalf("Failed to generate wallet: %v", err)
+	}
+	miner := NewMiner("miner1", "localhost:0", 1, nil, WithPayoutWallet(w))
+
+	miner.mineBlock()
+	miner.mineBlock()
+	if miner.Blockchain.GetLength() != 3 {
+		t.Fatalf("Expected 2 mined blocks, chain length %d", miner.Blockchain.GetLength())
+	}
+
+	blocks := miner.Blockchain.GetBlocks()
+	for _, b := range blocks[1:] {
+		payee := b.Transactions[0].Outputs[0].ScriptPubKey
+		if payee != w.Address(uint32(b.Index)) {
+			t.Errorf("Block #%d coinbase should pay the address derived at its height", b.Index)
+		}
+	}
+	if blocks[1].Transactions[0].Outputs[0].ScriptPubKey == blocks[2].Transactions[0].Outputs[0].ScriptPubKey {
+		t.Error("Consecutive blocks should pay different addresses")
+	}
+}
+
+func TestStatusReportsHashRate(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 8, nil)
+	miner.mineBlock()
+	miner.mineBlock()
+
+	var status StatusReply
+	(&RPCService{miner: miner}).GetStatus(&struct{}{}, &status)
+	if status.BlocksMined != 2 {
+		t.Errorf("Expected 2 blocks mined, got %d", status.BlocksMined)
+	}
+	if status.HashRate <= 0 {
+		t.Errorf("Hash rate should be positive after mining, got %f", status.HashRate)
+	}
+	if status.Difficulty != 8 {
+		t.Errorf("Expected difficulty 8, got %d", status.Difficulty)
+	}
+}
+
+func TestStatusReportsWorkerHashRates(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 12, nil, WithMiningThreads(4))
+	miner.mineBlock()
+	miner.mineBlock()
+
+	var status StatusReply
+	(&RPCService{miner: miner}).GetStatus(&struct{}{}, &status)
+	if status.Threads != 4 || len(status.WorkerRates) != 4 {
+		t.Fatalf("Expected rates for 4 workers, got %d threads and %v", status.Threads, status.WorkerRates)
+	}
+	// A worker may find the block before the others are scheduled, so only
+	// the total is certain to be positive
+	var total float64
+	for _, rate := range status.WorkerRates {
+		total += rate
+	}
+	if total <= 0 || math.Abs(total-status.HashRate) > status.HashRate*1e-9 {
+		t.Errorf("Worker rates sum to %f, hash rate is %f", total, status.HashRate)
+	}
+}
+
+func TestMinerFollowsScheduledParamChange(t *testing.T) {
+	offset, subsidy := 1, int64(1000)
+	params := blockchain.DefaultChainParams()
+	params.Changes = []blockchain.ParamChange{{Height: 2, Name: "drill", DifficultyOffset: &offset, Subsidy: &subsidy}}
+	miner := NewMiner("miner1", "localhost:0", 1, nil, WithChainOptions(blockchain.WithParams(params)))
+	miner.mineBlock()
+	miner.mineBlock()
+
+	if miner.Blockchain.GetLength() != 3 {
+		t.Fatalf("Both blocks should be accepted, chain length %d", miner.Blockchain.GetLength())
+	}
+	before, after := miner.Blockchain.GetBlockByHeight(1), miner.Blockchain.GetBlockByHeight(2)
+	if before.Difficulty != 1 || before.Transactions[0].TotalOutputValue() != blockchain.BaseSubsidy {
+		t.Errorf("Block 1 predates the change: %s", before)
+	}
+	if after.Difficulty != 2 || after.Transactions[0].TotalOutputValue() != subsidy {
+		t.Errorf("Block 2 should claim difficulty 2 and the new subsidy: %s", after)
+	}
+
+	var status StatusReply
+	(&RPCService{miner: miner}).GetStatus(&struct{}{}, &status)
+	if status.ParamsHash != params.Fingerprint() || len(status.Upgrades) != 1 || status.Upgrades[0].Name != "drill" {
+		t.Errorf("Status should report the params and their scheduled change, got %s %+v", status.ParamsHash, status.Upgrades)
+	}
+}
+
+// BenchmarkAssembleBlock measures building a block template from an empty
+// mempool on top of a chain with thousands of unspent outputs
+func BenchmarkAssembleBlock(b *testing.B) {
+	f, err := stress.Generate(stress.Config{Blocks: 1, TxsPerBlock: 2000, Keys: 16, UseMerkleTree: true})
+	if err != nil {
+		b.Fatalf("Failed to generate fixture: %v", err)
+	}
+	miner := NewMiner("bench", "localhost:0", 1, nil)
+	if miner.Blockchain, err = f.NewLoadedChain(); err != nil {
+		b.Fatalf("Failed to load chain: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		miner.assembleBlock()
+	}
+}
@@ -0,0 +1,197 @@
+package networktest
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/network"
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+)
+
+// handler answers one scripted method
+type handler struct {
+	newArgs func() any                  // Allocates the arguments to decode into
+	call    func(args any) (any, error) // Returns the reply
+}
+
+// MockNode answers RPCService calls with scripted responses. A method with
+// no script fails the way net/rpc fails an unknown method, which nodes treat
+// as a peer predating it. It speaks the same gob encoding as a miner, so
+// miners and clients talk to it unchanged.
+type MockNode struct {
+	ID       string
+	mu       sync.Mutex
+	handlers map[string]handler
+	calls    map[string]int
+	listener net.Listener
+}
+
+// NewMockNode creates a mock node with no methods scripted
+func NewMockNode(id string) *MockNode {
+	return &MockNode{ID: id, handlers: make(map[string]handler), calls: make(map[string]int)}
+}
+
+// Handle scripts method (e.g. "GetStatus") of n to answer with fn, replacing
+// any earlier script. fn fills in the reply; an error it returns reaches
+// the caller as an rpc.ServerError.
+func Handle[A, R any](n *MockNode, method string, fn func(args *A, reply *R) error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[method] = handler{
+		newArgs: func() any { return new(A) },
+		call: func(args any) (any, error) {
+			reply := new(R)
+			return reply, fn(args.(*A), reply)
+		},
+	}
+}
+
+// Fail scripts method of n to fail with err
+func (n *MockNode) Fail(method string, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[method] = handler{
+		newArgs: func() any { return nil },
+		call:    func(any) (any, error) { return nil, err },
+	}
+}
+
+// ServeChain scripts n to serve blocks as its chain: GetStatus reports its
+// length, and GetHeaders and GetChain page through it like a miner's
+func (n *MockNode) ServeChain(blocks []*block.Block) {
+	Handle(n, "GetStatus", func(args *struct{}, reply *network.StatusReply) error {
+		reply.ID = n.ID
+		reply.ChainLength = len(blocks)
+		if len(blocks) > 0 {
+			reply.TipHash = blocks[len(blocks)-1].Hash
+		}
+		return nil
+	})
+	Handle(n, "GetHeaders", func(args *network.HeadersArgs, reply *network.HeadersReply) error {
+		count := args.Count
+		if count <= 0 || count > network.MaxHeadersPerRequest {
+			count = network.MaxHeadersPerRequest
+		}
+		for _, b := range page(blocks, args.StartIndex, count) {
+			reply.Headers = append(reply.Headers, network.BlockHeader{
+				Index:        b.Index,
+				Timestamp:    b.Timestamp,
+				Hash:         b.Hash,
+				PrevHash:     b.PrevHash,
+				MerkleRoot:   b.MerkleRoot,
+				Nonce:        b.Nonce,
+				Difficulty:   b.Difficulty,
+				MinerID:      b.MinerID,
+				PowAlgorithm: b.PowAlgorithm,
+			})
+		}
+		reply.Length = len(blocks)
+		return nil
+	})
+	Handle(n, "GetChain", func(args *network.ChainArgs, reply *network.ChainReply) error {
+		for _, b := range page(blocks, args.StartIndex, args.Count) {
+			data, err := b.Serialize()
+			if err != nil {
+				return err
+			}
+			reply.Blocks = append(reply.Blocks, data)
+		}
+		reply.Length = len(blocks)
+		return nil
+	})
+}
+
+// page returns up to count blocks from start; count <= 0 selects the rest
+func page(blocks []*block.Block, start int64, count int) []*block.Block {
+	if start < 0 || start >= int64(len(blocks)) {
+		return nil
+	}
+	blocks = blocks[start:]
+	if count > 0 && count < len(blocks) {
+		blocks = blocks[:count]
+	}
+	return blocks
+}
+
+// Calls returns how many times method was called, scripted or not
+func (n *MockNode) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+// Listen serves n on address through t until Close
+func (n *MockNode) Listen(t network.Transport, address string) error {
+	l, err := t.Listen(address)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.listener = l
+	n.mu.Unlock()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.ServeConn(conn)
+		}
+	}()
+	return nil
+}
+
+// Close stops accepting connections
+func (n *MockNode) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.listener != nil {
+		n.listener.Close()
+	}
+}
+
+// ServeConn answers the calls on conn until the caller hangs up. Calls on
+// one connection are answered one at a time, in order.
+func (n *MockNode) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	dec := gob.NewDecoder(conn)
+	buf := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(buf)
+	for {
+		var req rpc.Request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		method := strings.TrimPrefix(req.ServiceMethod, "RPCService.")
+		n.mu.Lock()
+		n.calls[method]++
+		h, ok := n.handlers[method]
+		n.mu.Unlock()
+
+		var args any
+		if ok {
+			args = h.newArgs()
+		}
+		// Decoding into nil discards the arguments
+		if err := dec.Decode(args); err != nil {
+			return
+		}
+		var reply any
+		err := fmt.Errorf("rpc: can't find method %s", req.ServiceMethod)
+		if ok {
+			reply, err = h.call(args)
+		}
+		resp := rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}
+		if err != nil {
+			resp.Error = err.Error()
+			reply = struct{}{}
+		}
+		if enc.Encode(&resp) != nil || enc.Encode(reply) != nil || buf.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package networktest provides an in-memory transport and scriptable mock
+// nodes, so wallet and sync logic can be tested without opening sockets or
+// running real miners.
+//
+// Miners join a Network with network.WithTransport and clients by setting
+// Client.Transport; addresses are plain names, resolved only within the
+// Network. A MockNode answers RPC calls with scripted responses.
+package networktest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ErrConnectionRefused is returned when dialing an address nothing listens on
+var ErrConnectionRefused = errors.New("connection refused")
+
+// Network is an in-memory network.Transport. Each connection is a
+// synchronous net.Pipe, so a call blocks until the other end reads it, as
+// over a socket with no buffering.
+type Network struct {
+	mu        sync.Mutex
+	listeners map[string]*listener
+	down      map[string]bool // Addresses whose dials fail, see SetDown
+	dials     int
+}
+
+// NewNetwork creates an empty in-memory network
+func NewNetwork() *Network {
+	return &Network{listeners: make(map[string]*listener), down: make(map[string]bool)}
+}
+
+// Listen listens on address, which must not be taken
+func (n *Network) Listen(address string) (net.Listener, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.listeners[address]; ok {
+		return nil, fmt.Errorf("listen %s: address already in use", address)
+	}
+	l := &listener{
+		network: n,
+		addr:    addr(address),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[address] = l
+	return l, nil
+}
+
+// Dial connects to the listener on address
+func (n *Network) Dial(address string) (net.Conn, error) {
+	n.mu.Lock()
+	l, ok := n.listeners[address]
+	down := n.down[address]
+	n.dials++
+	client := addr(fmt.Sprintf("client-%d:%d", n.dials, n.dials))
+	n.mu.Unlock()
+	if !ok || down {
+		return nil, fmt.Errorf("dial %s: %w", address, ErrConnectionRefused)
+	}
+
+	local, remote := net.Pipe()
+	select {
+	case l.conns <- &conn{Conn: remote, local: l.addr, remote: client}:
+		return &conn{Conn: local, local: client, remote: l.addr}, nil
+	case <-l.closed:
+		local.Close()
+		remote.Close()
+		return nil, fmt.Errorf("dial %s: %w", address, ErrConnectionRefused)
+	}
+}
+
+// SetDown makes dials to address fail while down is true, as if the node
+// had crashed, without closing its listener or open connections
+func (n *Network) SetDown(address string, down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.down[address] = down
+}
+
+// Dials returns how many connections were attempted on the network
+func (n *Network) Dials() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dials
+}
+
+// listener accepts the connections dialed to its address
+type listener struct {
+	network   *Network
+	addr      addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.network.mu.Lock()
+		if l.network.listeners[string(l.addr)] == l {
+			delete(l.network.listeners, string(l.addr))
+		}
+		l.network.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// conn is one end of a pipe, reporting the addresses of the dialer and
+// the listener
+type conn struct {
+	net.Conn
+	local, remote addr
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+// addr is an address on a Network
+type addr string
+
+func (a addr) Network() string { return "mem" }
+func (a addr) String() string  { return string(a) }
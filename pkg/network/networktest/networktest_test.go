@@ -0,0 +1,145 @@
+package networktest
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/network"
+	"blockchain/pkg/testchain"
+	"blockchain/pkg/transaction"
+	"errors"
+	"testing"
+)
+
+// mineBlocks mines n blocks onto the miner's chain and returns the chain
+func mineBlocks(t *testing.T, miner *network.Miner, n int) []*block.Block {
+	return testchain.Extend(t, miner.Blockchain).MineTo(miner.ID, n).Blocks()
+}
+
+func TestMinerSyncsFromMockNode(t *testing.T) {
+	net := NewNetwork()
+	mock := NewMockNode("mock")
+	source := network.NewMiner("source", "source", 1, nil)
+	blocks := mineBlocks(t, source, 5)
+	mock.ServeChain(blocks)
+	if err := mock.Listen(net, "mock"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer mock.Close()
+
+	miner := network.NewMiner("fresh", "fresh", 1, nil, network.WithTransport(net))
+	if err := miner.SyncWithPeer(network.PeerInfo{ID: "mock", Address: "mock"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if miner.Blockchain.GetLength() != len(blocks) || miner.Blockchain.GetLatestBlock().Hash != blocks[5].Hash {
+		t.Fatalf("Expected the mock's chain, got length %d", miner.Blockchain.GetLength())
+	}
+
+	// The unscripted Handshake looks like a peer predating it, so the miner
+	// falls back to the headers-first sync every peer supports
+	if mock.Calls("Handshake") != 1 || mock.Calls("GetHeaders") == 0 || mock.Calls("GetChain") == 0 {
+		t.Errorf("Unexpected calls: handshake %d, headers %d, chain %d",
+			mock.Calls("Handshake"), mock.Calls("GetHeaders"), mock.Calls("GetChain"))
+	}
+
+	// A peer refusing to serve blocks fails the sync without touching the chain
+	mock.Fail("GetChain", errors.New("disk error"))
+	longer := mineBlocks(t, source, 2)
+	Handle(mock, "GetHeaders", func(args *network.HeadersArgs, reply *network.HeadersReply) error {
+		for _, b := range longer[args.StartIndex:] {
+			reply.Headers = append(reply.Headers, network.BlockHeader{Index: b.Index, Timestamp: b.Timestamp, Hash: b.Hash,
+				PrevHash: b.PrevHash, MerkleRoot: b.MerkleRoot, Nonce: b.Nonce, Difficulty: b.Difficulty, MinerID: b.MinerID})
+		}
+		reply.Length = len(longer)
+		return nil
+	})
+	if err := miner.SyncWithPeer(network.PeerInfo{ID: "mock", Address: "mock"}); err == nil {
+		t.Error("Expected the sync to fail")
+	}
+	if miner.Blockchain.GetLength() != len(blocks) {
+		t.Errorf("The chain should be unchanged, got length %d", miner.Blockchain.GetLength())
+	}
+}
+
+func TestMinersTalkInMemory(t *testing.T) {
+	net := NewNetwork()
+	source := network.NewMiner("source", "source", 1, nil, network.WithTransport(net))
+	mineBlocks(t, source, 3)
+	if err := source.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer source.Stop()
+
+	peer := network.NewMiner("peer", "peer", 1, []network.PeerInfo{{ID: "source", Address: "source"}}, network.WithTransport(net))
+	if err := peer.SyncWithPeer(network.PeerInfo{ID: "source", Address: "source"}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if peer.Blockchain.GetLength() != 4 {
+		t.Errorf("Expected 4 blocks, got %d", peer.Blockchain.GetLength())
+	}
+
+	client := network.NewClient("client", nil)
+	client.Transport = net
+	status, err := client.GetMinerStatus("source")
+	if err != nil || status.ChainLength != 4 {
+		t.Fatalf("Unexpected status %+v, %v", status, err)
+	}
+
+	net.SetDown("source", true)
+	if _, err := client.GetMinerStatus("source"); !errors.Is(err, ErrConnectionRefused) {
+		t.Errorf("Expected ErrConnectionRefused from a node that is down, got %v", err)
+	}
+	if _, err := net.Listen("source"); err == nil {
+		t.Error("A taken address should not be listened on again")
+	}
+}
+
+func TestClientSignsWithScriptedUTXOs(t *testing.T) {
+	kp, _ := transaction.GenerateKeyPair()
+	owner := kp.GetPublicKeyHex()
+	net := NewNetwork()
+	mock := NewMockNode("mock")
+	Handle(mock, "GetUTXOs", func(args *network.AddressArgs, reply *network.UTXOsReply) error {
+		if args.Address == owner {
+			reply.UTXOs = []transaction.UTXO{{TxID: "funding", OutIndex: 0, Value: 1000, ScriptPubKey: owner}}
+		}
+		return nil
+	})
+	var submitted *transaction.Transaction
+	Handle(mock, "SubmitRawTransaction", func(args *network.RawTransactionArgs, reply *network.TransactionReply) error {
+		tx, err := transaction.DeserializeTransaction(args.TxData)
+		if err != nil {
+			return err
+		}
+		submitted = tx
+		reply.Success = true
+		reply.TxID = tx.ID
+		return nil
+	})
+	if err := mock.Listen(net, "mock"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer mock.Close()
+
+	// The first miner is down, so the client moves on to the mock
+	client := network.NewClient("client", []network.PeerInfo{{ID: "down", Address: "down"}, {ID: "mock", Address: "mock"}})
+	client.Transport = net
+	txID, err := client.SubmitTransaction(
+		[]struct {
+			TxID     string
+			OutIndex int
+		}{{TxID: "funding", OutIndex: 0}},
+		[]transaction.TxOutput{{Value: 900, ScriptPubKey: "bob"}},
+		map[string]string{owner: kp.GetPrivateKeyHex()},
+	)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if submitted == nil || submitted.ID != txID || submitted.Inputs[0].TxID != "funding" {
+		t.Fatalf("Expected the transaction to reach the mock, got %+v", submitted)
+	}
+	if mock.Calls("SubmitTransaction") != 0 {
+		t.Error("The client should never send private keys")
+	}
+	if net.Dials() != 2 {
+		t.Errorf("Expected a dial to each miner, got %d", net.Dials())
+	}
+}
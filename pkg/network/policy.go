@@ -0,0 +1,90 @@
+package network
+
+import (
+	"blockchain/pkg/logging"
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/policy"
+	"blockchain/pkg/transaction"
+	"log"
+)
+
+// BlacklistArgs changes the miner's blacklist
+type BlacklistArgs struct {
+	Add    policy.BlacklistEntries
+	Remove policy.BlacklistEntries
+}
+
+// BlacklistReply reports the blacklist after an update
+type BlacklistReply struct {
+	Success bool
+	Entries policy.BlacklistEntries
+	Purged  int // Pending transactions dropped because of the update
+	Error   string
+}
+
+// WithBlacklist makes the miner refuse to relay or mine transactions touching
+// blacklisted addresses or transactions. Blocks from other miners are unaffected.
+func WithBlacklist(b *policy.Blacklist) MinerOption {
+	return func(o *MinerOptions) {
+		o.Blacklist = b
+	}
+}
+
+// checkPolicy returns why the miner's policy filters tx, logging the decision,
+// or nil if tx is allowed. lookup resolves the outputs tx spends.
+func (m *Miner) checkPolicy(tx *transaction.Transaction, lookup policy.UTXOLookup, action string) error {
+	if m.options.Blacklist == nil {
+		return nil
+	}
+	if err := m.options.Blacklist.Check(tx, lookup); err != nil {
+		logging.Warnf("[%s] POLICY: refusing to %s transaction %s: %v", shortID(m.ID), action, shortID(tx.ID), err)
+		return err
+	}
+	return nil
+}
+
+// purgeFiltered drops pending transactions that the current policy filters
+func (m *Miner) purgeFiltered() int {
+	if m.options.Blacklist == nil {
+		return 0
+	}
+	utxoSet := m.Blockchain.GetUTXOSet()
+
+	dropped := m.mempool.Filter(func(e *mempool.Entry) bool {
+		return m.options.Blacklist.Check(e.Tx, utxoSet.FindUTXO) == nil
+	})
+	for _, e := range dropped {
+		m.checkPolicy(e.Tx, utxoSet.FindUTXO, "keep pending")
+	}
+	m.journalDropped(dropped, "filtered by the blacklist policy")
+	return len(dropped)
+}
+
+// UpdateBlacklist RPC method to add and remove blacklist entries
+func (s *RPCService) UpdateBlacklist(args *BlacklistArgs, reply *BlacklistReply) error {
+	bl := s.miner.options.Blacklist
+	if bl == nil {
+		reply.Error = "blacklist policy is not enabled on this miner"
+		return nil
+	}
+	bl.Remove(args.Remove)
+	bl.Add(args.Add)
+	log.Printf("[%s] POLICY: blacklist updated (+%d/-%d addresses, +%d/-%d transactions)", shortID(s.miner.ID),
+		len(args.Add.Addresses), len(args.Remove.Addresses), len(args.Add.Transactions), len(args.Remove.Transactions))
+
+	reply.Success = true
+	reply.Purged = s.miner.purgeFiltered()
+	reply.Entries = bl.Entries()
+	return nil
+}
+
+// GetBlacklist RPC method to list the blacklist
+func (s *RPCService) GetBlacklist(args *struct{}, reply *BlacklistReply) error {
+	if s.miner.options.Blacklist == nil {
+		reply.Error = "blacklist policy is not enabled on this miner"
+		return nil
+	}
+	reply.Success = true
+	reply.Entries = s.miner.options.Blacklist.Entries()
+	return nil
+}
@@ -0,0 +1,53 @@
+package network
+
+import (
+	"blockchain/pkg/policy"
+	"testing"
+)
+
+func TestBlacklistFiltersRelayAndPending(t *testing.T) {
+	bl := policy.NewBlacklist()
+	bl.Add(policy.BlacklistEntries{Addresses: []string{"bob1"}})
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithBlacklist(bl))
+	service := &RPCService{miner: miner}
+	txs := fundedTransactions(t, miner, []int64{10, 10})
+
+	// A transaction paying a blacklisted address is not relayed
+	data, _ := txs[1].Serialize()
+	var reply TransactionReply
+	service.ReceiveTransaction(&BlockArgs{BlockData: data}, &reply)
+	if reply.Success {
+		t.Error("Transaction paying a blacklisted address should be refused")
+	}
+
+	data, _ = txs[0].Serialize()
+	service.ReceiveTransaction(&BlockArgs{BlockData: data}, &reply)
+	if !reply.Success {
+		t.Fatalf("Clean transaction should be accepted: %s", reply.Error)
+	}
+
+	// Blacklisting an address later purges pending transactions that touch it
+	var blReply BlacklistReply
+	service.UpdateBlacklist(&BlacklistArgs{Add: policy.BlacklistEntries{Addresses: []string{"bob0"}}}, &blReply)
+	if !blReply.Success || blReply.Purged != 1 {
+		t.Errorf("Expected one purged transaction, got %+v", blReply)
+	}
+	if len(miner.GetPendingTransactions()) != 0 {
+		t.Error("Mempool should be empty after purge")
+	}
+	if len(blReply.Entries.Addresses) != 2 {
+		t.Errorf("Expected 2 blacklisted addresses, got %v", blReply.Entries.Addresses)
+	}
+}
+
+func TestFilteredTransactionsAreNotMined(t *testing.T) {
+	bl := policy.NewBlacklist()
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithBlacklist(bl))
+	txs := fundedTransactions(t, miner, []int64{10, 10})
+
+	bl.Add(policy.BlacklistEntries{Transactions: []string{txs[0].ID}})
+	valid := miner.filterValidTransactions(txs)
+	if len(valid) != 1 || valid[0].ID != txs[1].ID {
+		t.Errorf("Only the unlisted transaction should be selected for mining, got %d", len(valid))
+	}
+}
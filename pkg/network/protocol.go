@@ -0,0 +1,199 @@
+package network
+
+import (
+	"blockchain/pkg/logging"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/rpc"
+	"slices"
+	"strings"
+)
+
+// Protocol features a miner can advertise in the handshake. Each names an
+// extension of the peer protocol, and a miner uses one with a peer only if
+// both advertise it, so a feature rolls out as nodes upgrade, pair by pair.
+// Names a build does not know are ignored, which leaves room for later
+// features such as compact blocks or block filters.
+const (
+	FeatureHeaders     = "headers"     // GetHeaders, for headers-first sync
+	FeatureRangeSync   = "range-sync"  // GetChain honors Count, so batches can come from several peers
+	FeatureCompression = "compression" // GetChain gzips each block when asked
+	FeatureBinary      = "binary"      // Blocks and transactions travel in the binary encoding
+	FeatureInventory   = "inventory"   // Blocks and transactions are announced by hash first; see Inv
+)
+
+// supportedFeatures lists the features this build implements, in order of preference
+var supportedFeatures = []string{FeatureHeaders, FeatureRangeSync, FeatureCompression, FeatureBinary, FeatureInventory}
+
+// legacyFeatures is what a peer predating the handshake is assumed to offer
+var legacyFeatures = []string{FeatureHeaders}
+
+// SupportedFeatures returns the protocol features this build implements
+func SupportedFeatures() []string {
+	return slices.Clone(supportedFeatures)
+}
+
+// ParseFeatures parses a comma-separated list of supported features; an
+// empty list is valid and turns every feature off
+func ParseFeatures(list string) ([]string, error) {
+	features := []string{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(supportedFeatures, name) {
+			return nil, fmt.Errorf("unknown protocol feature %q (supported: %s)", name, strings.Join(supportedFeatures, ", "))
+		}
+		if !slices.Contains(features, name) {
+			features = append(features, name)
+		}
+	}
+	return features, nil
+}
+
+// WithFeatures restricts the protocol features the miner offers to peers (nil
+// offers every supported feature)
+func WithFeatures(features []string) MinerOption {
+	return func(o *MinerOptions) {
+		o.Features = features
+	}
+}
+
+// features returns the protocol features the miner offers
+func (m *Miner) features() []string {
+	if m.options.Features == nil {
+		return supportedFeatures
+	}
+	return m.options.Features
+}
+
+// commonFeatures returns the features of ours that theirs also lists, in our
+// order of preference
+func commonFeatures(ours, theirs []string) []string {
+	common := []string{}
+	for _, f := range ours {
+		if slices.Contains(theirs, f) {
+			common = append(common, f)
+		}
+	}
+	return common
+}
+
+// HandshakeArgs introduces a miner and the protocol features it offers
+type HandshakeArgs struct {
+	ID       string
+	Features []string
+}
+
+// HandshakeReply returns the features the peer offers and those both share
+type HandshakeReply struct {
+	ID       string
+	Features []string
+	Common   []string
+}
+
+// Handshake RPC method to negotiate protocol features. Both sides compute
+// the common set the same way, so the caller need not trust Common.
+func (s *RPCService) Handshake(args *HandshakeArgs, reply *HandshakeReply) error {
+	reply.ID = s.miner.ID
+	reply.Features = s.miner.features()
+	reply.Common = commonFeatures(reply.Features, args.Features)
+	return nil
+}
+
+// peerFeatures returns the features negotiated with a peer, handshaking over
+// client on first contact. A peer without Handshake gets legacyFeatures; if
+// the handshake fails otherwise, so does this contact, and it is tried again
+// on the next one.
+func (m *Miner) peerFeatures(client *rpc.Client, peer PeerInfo) []string {
+	if features, ok := m.negotiatedFeatures(peer.Address); ok {
+		return features
+	}
+	args := &HandshakeArgs{ID: m.ID, Features: m.features()}
+	var reply HandshakeReply
+	err := client.Call("RPCService.Handshake", args, &reply)
+	switch {
+	case err == nil:
+		reply.Features = commonFeatures(args.Features, reply.Features)
+	case methodUnsupported(err):
+		reply.Features = commonFeatures(args.Features, legacyFeatures)
+	default:
+		return commonFeatures(args.Features, legacyFeatures)
+	}
+
+	m.peerMutex.Lock()
+	rec := m.peerRecord(peer.Address)
+	rec.Features = reply.Features
+	m.peerMutex.Unlock()
+	logging.Debugf("[%s] Negotiated features with peer %s: %s", shortID(m.ID), shortID(peer.ID), strings.Join(reply.Features, ", "))
+	return reply.Features
+}
+
+// negotiatedFeatures returns the features negotiated with the peer at
+// address, if a handshake with it succeeded since it last failed to respond
+func (m *Miner) negotiatedFeatures(address string) ([]string, bool) {
+	m.peerMutex.RLock()
+	defer m.peerMutex.RUnlock()
+	rec, ok := m.peerRecords[address]
+	if !ok || rec.Features == nil {
+		return nil, false
+	}
+	return rec.Features, true
+}
+
+// peerSupports reports whether a feature was negotiated with the peer at address
+func (m *Miner) peerSupports(address, feature string) bool {
+	features, _ := m.negotiatedFeatures(address)
+	return slices.Contains(features, feature)
+}
+
+// serializer is a block or transaction, which encode as binary or JSON
+type serializer interface {
+	Serialize() ([]byte, error)
+	SerializeJSON() ([]byte, error)
+}
+
+// serializeAs encodes v in the binary encoding, or as JSON for peers and
+// clients that predate FeatureBinary. Decoders accept either.
+func serializeAs(v serializer, binary bool) ([]byte, error) {
+	if binary {
+		return v.Serialize()
+	}
+	return v.SerializeJSON()
+}
+
+// compressBlocks gzips each serialized block in place
+func compressBlocks(blocks [][]byte) error {
+	for i, data := range blocks {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		blocks[i] = buf.Bytes()
+	}
+	return nil
+}
+
+// decompressBlocks reverses compressBlocks. Each block is read to at most one
+// byte past maxBytes, enough for the block limits to refuse it without
+// inflating a compression bomb.
+func decompressBlocks(blocks [][]byte, maxBytes int) error {
+	for i, data := range blocks {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: block %d: %v", ErrInvalidPeerChain, i, err)
+		}
+		blocks[i], err = io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+		if err != nil {
+			return fmt.Errorf("%w: block %d: %v", ErrInvalidPeerChain, i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/codec"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	features, err := ParseFeatures(" compression, headers,compression")
+	if err != nil || !slices.Equal(features, []string{FeatureCompression, FeatureHeaders}) {
+		t.Errorf("Unexpected features %v, %v", features, err)
+	}
+	if features, err := ParseFeatures(""); err != nil || features == nil || len(features) != 0 {
+		t.Errorf("An empty list should turn every feature off, got %v, %v", features, err)
+	}
+	if _, err := ParseFeatures("headers,compact-blocks"); err == nil {
+		t.Error("A feature this build lacks should be refused")
+	}
+
+	common := commonFeatures(supportedFeatures, []string{"compact-blocks", FeatureCompression, FeatureHeaders})
+	if !slices.Equal(common, []string{FeatureHeaders, FeatureCompression}) {
+		t.Errorf("Expected the shared features in our order, got %v", common)
+	}
+}
+
+func TestSyncUsesNegotiatedFeatures(t *testing.T) {
+	peer := NewMiner("peer", "localhost:19122", 1, nil)
+	for i := 0; i < 5; i++ {
+		peer.mineBlock()
+	}
+	if err := peer.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer peer.Stop()
+	info := PeerInfo{ID: "peer", Address: "localhost:19122"}
+
+	// Both sides offer everything: blocks come compressed, in batches
+	full := NewMiner("full", "localhost:0", 1, []PeerInfo{info})
+	if err := full.SyncWithPeer(info); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got, _ := full.negotiatedFeatures(info.Address); !slices.Equal(got, supportedFeatures) {
+		t.Errorf("Expected every feature negotiated, got %v", got)
+	}
+	if full.Blockchain.GetLength() != peer.Blockchain.GetLength() {
+		t.Fatalf("Expected the peer's chain, got length %d", full.Blockchain.GetLength())
+	}
+
+	// A node offering no features falls back to downloading the full chain
+	bare := NewMiner("bare", "localhost:0", 1, nil, WithFeatures([]string{}))
+	if err := bare.SyncWithPeer(info); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got, ok := bare.negotiatedFeatures(info.Address); !ok || len(got) != 0 {
+		t.Errorf("Expected no features negotiated, got %v, %v", got, ok)
+	}
+	if bare.Blockchain.GetLength() != peer.Blockchain.GetLength() || bare.SyncStats().Requests != 0 {
+		t.Errorf("Expected a full-chain sync, got length %d, stats %+v", bare.Blockchain.GetLength(), bare.SyncStats())
+	}
+
+	// Headers without range sync: the missing blocks come in one request
+	headersOnly := NewMiner("headers", "localhost:0", 1, nil, WithFeatures([]string{FeatureHeaders}))
+	if err := headersOnly.SyncWithPeer(info); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if stats := headersOnly.SyncStats(); stats.Requests != 1 || stats.Blocks != int64(peer.Blockchain.GetLength()) {
+		t.Errorf("Expected one request for every block, got %+v", stats)
+	}
+
+	var reply PeersReply
+	(&RPCService{miner: full}).GetPeers(&struct{}{}, &reply)
+	if !slices.Equal(reply.Features[info.Address], supportedFeatures) {
+		t.Errorf("Expected GetPeers to report the negotiated features, got %v", reply.Features)
+	}
+
+	// A failed contact forgets the negotiation, as the peer may come back upgraded
+	full.notePeerResult(info.Address, errors.New("connection refused"))
+	if _, ok := full.negotiatedFeatures(info.Address); ok {
+		t.Error("Expected the features forgotten after a failure")
+	}
+}
+
+func TestGetChainCompressesOnRequest(t *testing.T) {
+	miner := NewMiner("miner", "localhost:0", 1, nil)
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+
+	var plain, packed ChainReply
+	service.GetChain(&ChainArgs{}, &plain)
+	service.GetChain(&ChainArgs{Compress: true}, &packed)
+	if plain.Compressed || !packed.Compressed {
+		t.Fatalf("Expected only the second reply compressed")
+	}
+	if err := decompressBlocks(packed.Blocks, miner.options.Limits.MaxBlockBytes); err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	for i := range plain.Blocks {
+		if !slices.Equal(plain.Blocks[i], packed.Blocks[i]) {
+			t.Errorf("Block %d changed in compression", i)
+		}
+	}
+
+	// With compression turned off the request is served uncompressed
+	off := &RPCService{miner: NewMiner("off", "localhost:0", 1, nil, WithFeatures([]string{FeatureHeaders}))}
+	var reply ChainReply
+	off.GetChain(&ChainArgs{Compress: true}, &reply)
+	if reply.Compressed {
+		t.Error("A miner not offering compression should not compress")
+	}
+}
+
+func TestGetChainEncodesOnRequest(t *testing.T) {
+	miner := NewMiner("miner", "localhost:0", 1, nil)
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+
+	// Older peers and clients get JSON unless they ask for the binary encoding
+	var plain, binary ChainReply
+	service.GetChain(&ChainArgs{}, &plain)
+	service.GetChain(&ChainArgs{Binary: true}, &binary)
+	for i := range plain.Blocks {
+		if !codec.IsJSON(plain.Blocks[i]) || codec.IsJSON(binary.Blocks[i]) {
+			t.Fatalf("Block %d: expected JSON, then the binary encoding", i)
+		}
+		if 2*len(binary.Blocks[i]) > len(plain.Blocks[i]) {
+			t.Errorf("Block %d: binary encoding should be under half the JSON size", i)
+		}
+		a, _ := block.DeserializeBlock(plain.Blocks[i])
+		b, _ := block.DeserializeBlock(binary.Blocks[i])
+		if a == nil || b == nil || a.Hash != b.Hash || !b.HasValidHash() {
+			t.Errorf("Block %d differs between encodings", i)
+		}
+	}
+
+	// With the binary encoding turned off the request is served as JSON
+	off := &RPCService{miner: NewMiner("off", "localhost:0", 1, nil, WithFeatures([]string{FeatureHeaders}))}
+	var reply ChainReply
+	off.GetChain(&ChainArgs{Binary: true}, &reply)
+	if !codec.IsJSON(reply.Blocks[0]) {
+		t.Error("A miner not offering the binary encoding should send JSON")
+	}
+}
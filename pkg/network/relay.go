@@ -0,0 +1,199 @@
+package network
+
+import (
+	"blockchain/pkg/mempool"
+	"blockchain/pkg/policy"
+	"blockchain/pkg/transaction"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+	"unicode"
+)
+
+const (
+	// DefaultTxRelayRate is how many transactions per second one peer may relay to us
+	DefaultTxRelayRate = 100
+
+	// DefaultTxRelayBurst is how many transactions a peer may relay back to back
+	DefaultTxRelayBurst = 500
+
+	// DefaultIncrementalFeeRate is added to the fee rate of the best evicted
+	// transaction to form the mempool's minimum, in satoshi per byte
+	DefaultIncrementalFeeRate = 0.001
+
+	// DefaultFeeFloorHalfLife is how quickly the escalated minimum decays once
+	// the mempool stops evicting
+	DefaultFeeFloorHalfLife = 10 * time.Minute
+)
+
+var (
+	ErrRelayRateLimited = errors.New("peer exceeded transaction relay rate")
+	ErrFeeTooLow        = errors.New("fee rate below mempool minimum")
+	ErrNonStandardMemo  = errors.New("non-standard memo")
+)
+
+// RelayLimits bounds how much transaction traffic the miner admits. Fee rates
+// are in satoshi per byte of mempool.Size, the unit the mempool budget uses.
+type RelayLimits struct {
+	MinFeeRate         float64       // Static minimum fee rate for new transactions
+	IncrementalFeeRate float64       // Margin above the best evicted fee rate
+	FeeFloorHalfLife   time.Duration // Decay of the escalated minimum
+	TxRate             float64       // Transactions per second accepted from each peer (0 = unlimited)
+	TxBurst            int           // Per-peer burst allowance
+	MaxMemoBytes       int           // Longest memo relayed (0 = the consensus limit, negative = none)
+}
+
+// DefaultRelayLimits returns the relay limits used by NewMiner
+func DefaultRelayLimits() RelayLimits {
+	return RelayLimits{
+		IncrementalFeeRate: DefaultIncrementalFeeRate,
+		FeeFloorHalfLife:   DefaultFeeFloorHalfLife,
+		TxRate:             DefaultTxRelayRate,
+		TxBurst:            DefaultTxRelayBurst,
+	}
+}
+
+// WithRelayLimits sets the transaction relay limits
+func WithRelayLimits(limits RelayLimits) MinerOption {
+	return func(o *MinerOptions) {
+		if limits.FeeFloorHalfLife <= 0 {
+			limits.FeeFloorHalfLife = DefaultFeeFloorHalfLife
+		}
+		if limits.TxBurst <= 0 {
+			limits.TxBurst = int(math.Ceil(limits.TxRate))
+		}
+		o.Relay = limits
+	}
+}
+
+// tokenBucket is a rate limiter refilled continuously at rate tokens per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes one token if available, refilling for the time since the last call
+func (b *tokenBucket) take(rate float64, burst int, now time.Time) bool {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// peerHost returns the host part of a remote address, so every connection
+// from the same machine shares one rate limit
+func peerHost(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// allowRelay charges one relayed transaction to peer. In-process calls have
+// no peer and are not limited.
+func (m *Miner) allowRelay(peer string) bool {
+	limits := m.options.Relay
+	if peer == "" || limits.TxRate <= 0 {
+		return true
+	}
+	m.relayMutex.Lock()
+	defer m.relayMutex.Unlock()
+	now := time.Now()
+	b, ok := m.relayBuckets[peer]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limits.TxBurst), last: now}
+		m.relayBuckets[peer] = b
+	}
+	if b.take(limits.TxRate, limits.TxBurst, now) {
+		return true
+	}
+	m.relayLimited++
+	return false
+}
+
+// MinRelayFeeRate returns the fee rate a new transaction must pay. It is the
+// static minimum, escalated after evictions to just above the best fee rate
+// the mempool had to drop, so a flood of cheap transactions is refused at the
+// door instead of churning the pool. The escalation halves every FeeFloorHalfLife.
+func (m *Miner) MinRelayFeeRate() float64 {
+	m.txMutex.RLock()
+	defer m.txMutex.RUnlock()
+	return m.minRelayFeeRateLocked(time.Now())
+}
+
+func (m *Miner) minRelayFeeRateLocked(now time.Time) float64 {
+	limits := m.options.Relay
+	floor := m.feeFloor
+	if floor > 0 {
+		halvings := now.Sub(m.feeFloorSet).Seconds() / limits.FeeFloorHalfLife.Seconds()
+		floor *= math.Pow(0.5, halvings)
+	}
+	return math.Max(limits.MinFeeRate, floor)
+}
+
+// raiseFeeFloor escalates the minimum after evicting a transaction paying
+// evictedRate. Callers hold txMutex.
+func (m *Miner) raiseFeeFloor(evictedRate float64) {
+	now := time.Now()
+	floor := evictedRate + m.options.Relay.IncrementalFeeRate
+	if floor > m.minRelayFeeRateLocked(now) {
+		m.feeFloor = floor
+		m.feeFloorSet = now
+	}
+}
+
+// txFee is the fee a transaction pays. lookup resolves the outputs tx spends;
+// unknown inputs count as zero.
+func txFee(tx *transaction.Transaction, lookup policy.UTXOLookup) int64 {
+	fee := -tx.TotalOutputValue()
+	for _, in := range tx.Inputs {
+		if utxo := lookup(in.TxID, in.OutIndex); utxo != nil {
+			fee += utxo.Value
+		}
+	}
+	return max(fee, 0)
+}
+
+// feeRate is a transaction's fee per byte of mempool footprint
+func feeRate(tx *transaction.Transaction, lookup policy.UTXOLookup) float64 {
+	return float64(txFee(tx, lookup)) / float64(mempool.Size(tx))
+}
+
+// checkFeeRate rejects a transaction paying less than the current minimum
+func (m *Miner) checkFeeRate(tx *transaction.Transaction, lookup policy.UTXOLookup) error {
+	rate, min := feeRate(tx, lookup), m.MinRelayFeeRate()
+	if rate < min {
+		return fmt.Errorf("%w: %.6f < %.6f sat/byte", ErrFeeTooLow, rate, min)
+	}
+	return nil
+}
+
+// checkMemo rejects a memo longer than the relay limit or holding characters
+// that are not printable, such as control characters that would garble
+// explorers and terminals. Consensus only asks for valid UTF-8 within
+// transaction.MaxMemoBytes. Memo bytes count towards mempool.Size, so they
+// also pay the fee rate.
+func (m *Miner) checkMemo(tx *transaction.Transaction) error {
+	if tx.Memo == "" {
+		return nil
+	}
+	limit := m.options.Relay.MaxMemoBytes
+	if limit == 0 {
+		limit = transaction.MaxMemoBytes
+	}
+	if len(tx.Memo) > limit {
+		return fmt.Errorf("%w: %d bytes, relay limit %d", ErrNonStandardMemo, len(tx.Memo), max(limit, 0))
+	}
+	for _, r := range tx.Memo {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("%w: contains unprintable character %U", ErrNonStandardMemo, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/logging"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedMessage is a single received payload captured in a replay log
+type RecordedMessage struct {
+	Timestamp int64       `json:"timestamp"` // Unix nanoseconds when the payload was received
+	Type      MessageType `json:"type"`
+	Payload   []byte      `json:"payload"`
+}
+
+// MessageRecorder appends received block/transaction payloads to a log file
+type MessageRecorder struct {
+	file *os.File
+	enc  *json.Encoder
+	mu   sync.Mutex
+}
+
+// ReplayResult summarizes the outcome of replaying a message log
+type ReplayResult struct {
+	Blocks       int
+	Transactions int
+	Chains       int
+	Accepted     int
+	Rejected     int
+}
+
+// NewMessageRecorder opens (or creates) a replay log for appending
+func NewMessageRecorder(path string) (*MessageRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay log: %v", err)
+	}
+	return &MessageRecorder{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// Record writes a payload of the given type to the log
+func (r *MessageRecorder) Record(msgType MessageType, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(&RecordedMessage{
+		Timestamp: time.Now().UnixNano(),
+		Type:      msgType,
+		Payload:   payload,
+	})
+}
+
+// Close flushes and closes the log file
+func (r *MessageRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// ReadMessageLog loads all messages from a replay log
+func ReadMessageLog(path string) ([]RecordedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay log: %v", err)
+	}
+	defer file.Close()
+
+	var msgs []RecordedMessage
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for dec.More() {
+		var msg RecordedMessage
+		if err := dec.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("corrupt replay log entry %d: %v", len(msgs), err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// SetRecorder starts recording received payloads to the given recorder.
+// The miner's current chain is written first as a snapshot so a replay can
+// start from the exact same state (each node has its own genesis block).
+func (m *Miner) SetRecorder(r *MessageRecorder) error {
+	data, err := SerializeBlocks(m.Blockchain.GetBlocks())
+	if err != nil {
+		return fmt.Errorf("failed to serialize chain snapshot: %v", err)
+	}
+	if err := r.Record(MsgResponseChain, data); err != nil {
+		return fmt.Errorf("failed to write chain snapshot: %v", err)
+	}
+	m.recorder = r
+	return nil
+}
+
+// recordMessage writes a received payload to the replay log if recording is enabled
+func (m *Miner) recordMessage(msgType MessageType, payload []byte) {
+	if m.recorder == nil {
+		return
+	}
+	if err := m.recorder.Record(msgType, payload); err != nil {
+		logging.Errorf("[%s] Failed to record message: %v", shortID(m.ID), err)
+	}
+}
+
+// ReplayMessages feeds recorded messages through the same RPC handlers used for
+// live traffic. A leading chain snapshot resets the miner's chain to that state.
+func (m *Miner) ReplayMessages(msgs []RecordedMessage) *ReplayResult {
+	service := &RPCService{miner: m}
+	result := &ReplayResult{}
+
+	for i, msg := range msgs {
+		var accepted bool
+		var reason string
+
+		switch msg.Type {
+		case MsgBlock:
+			result.Blocks++
+			var reply BlockReply
+			service.ReceiveBlock(&BlockArgs{BlockData: msg.Payload}, &reply)
+			accepted, reason = reply.Success, reply.Error
+		case MsgTransaction:
+			result.Transactions++
+			var reply TransactionReply
+			service.ReceiveTransaction(&BlockArgs{BlockData: msg.Payload}, &reply)
+			accepted, reason = reply.Success, reply.Error
+		case MsgResponseChain:
+			result.Chains++
+			blocks, err := DeserializeBlocks(msg.Payload)
+			if err != nil {
+				reason = fmt.Sprintf("failed to deserialize chain: %v", err)
+				break
+			}
+			if i == 0 {
+				m.Blockchain = blockchain.NewBlockchainFromBlocks(blocks, m.Blockchain.GetDifficulty(),
+					blockchain.WithOptions(m.Blockchain.Options()))
+				accepted = true
+				break
+			}
+			if err := m.Blockchain.ReplaceChain(blocks); err != nil {
+				reason = err.Error()
+				break
+			}
+			accepted = true
+		default:
+			reason = fmt.Sprintf("unknown message type %d", msg.Type)
+		}
+
+		if accepted {
+			result.Accepted++
+		} else {
+			result.Rejected++
+		}
+		log.Printf("[%s] Replay #%d type=%d at %s accepted=%v %s", shortID(m.ID), i, msg.Type,
+			time.Unix(0, msg.Timestamp).Format(time.RFC3339Nano), accepted, reason)
+	}
+
+	return result
+}
@@ -0,0 +1,67 @@
+package network
+
+import (
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndReplayMessages(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "replay.log")
+
+	// The recording node receives blocks produced on its own chain
+	recorded := NewMiner("recorder", "localhost:0", 2, nil)
+	recorder, err := NewMessageRecorder(logPath)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	if err := recorded.SetRecorder(recorder); err != nil {
+		t.Fatalf("Failed to set recorder: %v", err)
+	}
+
+	service := &RPCService{miner: recorded}
+	for i := 0; i < 3; i++ {
+		coinbase := transaction.NewCoinbaseTransaction("peer", 5000000000, recorded.Blockchain.GetLatestBlock().Index+1)
+		newBlock := recorded.Blockchain.CreateBlock([]*transaction.Transaction{coinbase}, "peer")
+		result := pow.NewProofOfWork(newBlock).Mine(context.TODO(), nil)
+		data, _ := result.Block.Serialize()
+
+		var reply BlockReply
+		service.ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+		if !reply.Success {
+			t.Fatalf("Block %d should be accepted: %s", i, reply.Error)
+		}
+	}
+
+	// A malformed payload must be recorded too
+	var reply TransactionReply
+	service.ReceiveTransaction(&BlockArgs{BlockData: []byte("garbage")}, &reply)
+	recorder.Close()
+
+	msgs, err := ReadMessageLog(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if len(msgs) != 5 {
+		t.Fatalf("Expected 5 recorded messages (snapshot, 3 blocks, 1 tx), got %d", len(msgs))
+	}
+
+	// Replay into a fresh node with a different genesis
+	fresh := NewMiner("fresh", "localhost:0", 2, nil)
+	result := fresh.ReplayMessages(msgs)
+
+	if result.Blocks != 3 || result.Transactions != 1 || result.Chains != 1 {
+		t.Errorf("Unexpected replay counts: %+v", result)
+	}
+	if result.Accepted != 4 || result.Rejected != 1 {
+		t.Errorf("Expected 4 accepted and 1 rejected, got %+v", result)
+	}
+	if fresh.Blockchain.GetLength() != recorded.Blockchain.GetLength() {
+		t.Errorf("Replayed chain length %d, expected %d", fresh.Blockchain.GetLength(), recorded.Blockchain.GetLength())
+	}
+	if fresh.Blockchain.GetLatestBlock().Hash != recorded.Blockchain.GetLatestBlock().Hash {
+		t.Error("Replayed chain tip should match the recording node")
+	}
+}
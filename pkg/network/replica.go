@@ -0,0 +1,58 @@
+package network
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultReplicaSyncInterval is how often a read replica pulls new blocks
+// from its peers
+const DefaultReplicaSyncInterval = 5 * time.Second
+
+// ErrReadReplica is returned for transactions sent to a read replica, which
+// neither accepts nor relays them
+var ErrReadReplica = errors.New("read replica: transactions are not accepted here, submit them to a mining node")
+
+// ReplicaConfig configures a read replica
+type ReplicaConfig struct {
+	SyncInterval time.Duration // How often blocks are pulled from peers (default DefaultReplicaSyncInterval)
+}
+
+// WithReplica runs the miner as a read replica: it follows its peers' chain,
+// pulling blocks every cfg.SyncInterval as well as accepting those pushed to
+// it, and serves every query, but never mines and refuses transactions from
+// clients and peers alike. Pointing explorers and analytics at replicas keeps
+// their load off the mining nodes, and a replica has no say in what is mined.
+func WithReplica(cfg ReplicaConfig) MinerOption {
+	return func(o *MinerOptions) {
+		if cfg.SyncInterval <= 0 {
+			cfg.SyncInterval = DefaultReplicaSyncInterval
+		}
+		o.Replica = &cfg
+	}
+}
+
+// IsReplica reports whether the miner runs as a read replica
+func (m *Miner) IsReplica() bool {
+	return m.options.Replica != nil
+}
+
+// checkReplica returns ErrReadReplica if the miner is a read replica
+func (m *Miner) checkReplica() error {
+	if m.IsReplica() {
+		return ErrReadReplica
+	}
+	return nil
+}
+
+// replicaLoop pulls blocks from the peers periodically until the miner stops
+func (m *Miner) replicaLoop() {
+	for {
+		m.SyncWithAllPeers()
+		select {
+		case <-m.done:
+			return
+		case <-time.After(m.options.Replica.SyncInterval):
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package network
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicaFollowsChainWithoutMiningOrRelaying(t *testing.T) {
+	source := NewMiner("source", "localhost:19135", 1, nil)
+	if err := source.Start(); err != nil {
+		t.Fatalf("Failed to start source: %v", err)
+	}
+	defer source.Stop()
+	source.mineBlock()
+	source.mineBlock()
+
+	replica := NewMiner("replica", "localhost:19136", 1, []PeerInfo{{ID: "source", Address: "localhost:19135"}},
+		WithReplica(ReplicaConfig{SyncInterval: 50 * time.Millisecond}))
+	if err := replica.Start(); err != nil {
+		t.Fatalf("Failed to start replica: %v", err)
+	}
+	defer replica.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for replica.Blockchain.GetLength() != source.Blockchain.GetLength() && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if replica.Blockchain.GetLength() != source.Blockchain.GetLength() {
+		t.Fatalf("Replica should pull the source's chain, got length %d", replica.Blockchain.GetLength())
+	}
+
+	replica.StartMining()
+	if replica.IsMining() {
+		t.Error("A replica should never mine")
+	}
+
+	service := &RPCService{miner: replica}
+	var submitted, received TransactionReply
+	service.SubmitRawTransaction(&RawTransactionArgs{TxData: []byte("{}")}, &submitted)
+	service.ReceiveTransaction(&BlockArgs{BlockData: []byte("{}")}, &received)
+	for _, reply := range []TransactionReply{submitted, received} {
+		if reply.Success || !strings.Contains(reply.Error, "read replica") {
+			t.Errorf("A replica should refuse transactions, got %+v", reply)
+		}
+	}
+
+	var status StatusReply
+	service.GetStatus(&struct{}{}, &status)
+	if !status.Replica || status.Mining {
+		t.Errorf("Status should report a non-mining replica, got %+v", status)
+	}
+}
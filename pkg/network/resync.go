@@ -0,0 +1,159 @@
+package network
+
+import (
+	"blockchain/pkg/difficulty"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultResyncInterval is how often a miner checks whether it fell behind
+	DefaultResyncInterval = 15 * time.Second
+
+	// DefaultStaleTipBlocks is how many target block times may pass without a
+	// new block before the miner resyncs
+	DefaultStaleTipBlocks = 3
+)
+
+// ResyncConfig sets when a miner pulls blocks from its peers on its own,
+// rather than waiting for a broadcast it may have missed
+type ResyncConfig struct {
+	Interval   time.Duration // How often to check (0 = never)
+	StaleAfter time.Duration // Resync when the tip has not changed for this long (default DefaultStaleTipBlocks target block times)
+}
+
+// DefaultResyncConfig returns the resync settings miners start with
+func DefaultResyncConfig() ResyncConfig {
+	return ResyncConfig{
+		Interval:   DefaultResyncInterval,
+		StaleAfter: DefaultStaleTipBlocks * difficulty.TargetBlockTime,
+	}
+}
+
+// WithResync sets how the miner recovers from missed broadcasts, such as
+// blocks mined on the other side of a network partition. Every cfg.Interval it
+// resyncs with all peers if its tip has not changed for cfg.StaleAfter or a
+// peer reports a longer chain. An Interval of zero turns this off.
+func WithResync(cfg ResyncConfig) MinerOption {
+	return func(o *MinerOptions) {
+		if cfg.StaleAfter <= 0 {
+			cfg.StaleAfter = DefaultStaleTipBlocks * difficulty.TargetBlockTime
+		}
+		o.Resync = cfg
+	}
+}
+
+// resync is the state of the resync loop, guarded by resyncMutex
+type resync struct {
+	tip   string    // Tip hash at the last check
+	since time.Time // When the tip last changed, or the last resync
+}
+
+// CheckResync checks once whether the miner fell behind its peers and, if it
+// did, resyncs with all of them. Returns why it resynced, or "" if it did not.
+func (m *Miner) CheckResync() string {
+	cfg := m.options.Resync
+	tip := m.Blockchain.GetLatestBlock()
+	now := time.Now()
+
+	m.resyncMutex.Lock()
+	if m.resync.tip != tip.Hash {
+		m.resync.tip = tip.Hash
+		m.resync.since = now
+	}
+	idle := now.Sub(m.resync.since)
+	m.resyncMutex.Unlock()
+
+	reason := ""
+	if idle >= cfg.StaleAfter {
+		reason = fmt.Sprintf("no new block for %v", idle.Round(time.Second))
+	} else {
+		reason = m.longerPeerChain(int(tip.Index) + 1)
+	}
+	if reason == "" {
+		return ""
+	}
+
+	log.Printf("[%s] Resyncing with all peers: %s", shortID(m.ID), reason)
+	m.SyncWithAllPeers()
+	atomic.AddInt64(&m.resyncs, 1)
+
+	m.resyncMutex.Lock()
+	m.resync.tip = m.Blockchain.GetLatestBlock().Hash
+	m.resync.since = time.Now()
+	m.resyncMutex.Unlock()
+	return reason
+}
+
+// longerPeerChain asks each peer for its status and describes the first one
+// reporting a chain longer than length, or returns "" if none does. Peers that
+// do not answer within the resync interval are skipped.
+func (m *Miner) longerPeerChain(length int) string {
+	timeout := m.options.Resync.Interval
+	if timeout <= 0 {
+		timeout = DefaultResyncInterval
+	}
+	for _, peer := range m.GetPeers() {
+		if m.IsStopped() {
+			return ""
+		}
+		status, err := m.peerStatus(peer.Address, timeout)
+		if err != nil {
+			continue
+		}
+		if status.ChainLength > length {
+			return fmt.Sprintf("peer %s reports length %d, ours is %d", shortID(peer.ID), status.ChainLength, length)
+		}
+	}
+	return ""
+}
+
+// peerStatus asks the peer at address for its status, giving up after timeout
+func (m *Miner) peerStatus(address string, timeout time.Duration) (*StatusReply, error) {
+	client, err := m.dialPeer(address, m.options.Limits.MaxMessageBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	var reply StatusReply
+	call := client.Go("RPCService.GetStatus", &struct{}{}, &reply, nil)
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return nil, call.Error
+		}
+		return &reply, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no answer within %v", timeout)
+	}
+}
+
+// requestSync starts a sync with all peers in the background unless one
+// started this way is still running, so a burst of blocks that do not fit the
+// chain triggers one sync rather than one per block
+func (m *Miner) requestSync() {
+	if !atomic.CompareAndSwapInt32(&m.syncPending, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&m.syncPending, 0)
+		m.SyncWithAllPeers()
+	}()
+}
+
+// resyncLoop checks for missed blocks periodically until the miner stops. A
+// standby waiting on its primary already follows the primary's chain.
+func (m *Miner) resyncLoop() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-time.After(m.options.Resync.Interval):
+		}
+		if !m.standbyIdle() {
+			m.CheckResync()
+		}
+	}
+}
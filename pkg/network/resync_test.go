@@ -0,0 +1,45 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResyncAfterMissedBlocks(t *testing.T) {
+	ahead := NewMiner("ahead", "localhost:19150", 1, nil, WithResync(ResyncConfig{}))
+	if err := ahead.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer ahead.Stop()
+
+	behind := NewMiner("behind", "localhost:19151", 1, []PeerInfo{{ID: "ahead", Address: "localhost:19150"}},
+		WithResync(ResyncConfig{Interval: 10 * time.Second, StaleAfter: time.Hour}))
+	defer behind.Stop()
+
+	// Nothing missed yet: no resync
+	if reason := behind.CheckResync(); reason != "" {
+		t.Fatalf("Expected no resync while in step with peers, got %q", reason)
+	}
+
+	// Blocks the behind miner never heard about, as across a partition
+	ahead.mineBlock()
+	ahead.mineBlock()
+	if reason := behind.CheckResync(); reason == "" {
+		t.Fatal("A peer reporting a longer chain should trigger a resync")
+	}
+	if behind.Blockchain.GetLength() != ahead.Blockchain.GetLength() {
+		t.Errorf("Expected the resync to catch up to length %d, got %d",
+			ahead.Blockchain.GetLength(), behind.Blockchain.GetLength())
+	}
+
+	// A tip that stays put past StaleAfter resyncs even if no peer says so
+	behind.options.Resync.StaleAfter = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	if reason := behind.CheckResync(); reason == "" {
+		t.Error("A stale tip should trigger a resync")
+	}
+	var status StatusReply
+	if err := (&RPCService{miner: behind}).GetStatus(&struct{}{}, &status); err != nil || status.Resyncs != 2 {
+		t.Errorf("Expected 2 resyncs in the status, got %d (%v)", status.Resyncs, err)
+	}
+}
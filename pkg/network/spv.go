@@ -0,0 +1,146 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/merkle"
+	"blockchain/pkg/transaction"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTxNotConfirmed     = errors.New("transaction is not in the main chain")
+	ErrNoMerkleRoot       = errors.New("block has no Merkle root to prove inclusion against")
+	ErrInvalidMerkleProof = errors.New("invalid Merkle proof")
+)
+
+// SPVProofArgs asks for a proof that a transaction is in the main chain
+type SPVProofArgs struct {
+	TxID string
+}
+
+// SPVProofReply proves a transaction's inclusion in a block to a light client
+// holding only headers: hashing the transaction ID up through the siblings
+// must give the Merkle root of the header at BlockHeight with BlockHash
+type SPVProofReply struct {
+	Transaction *transaction.Transaction // Its ID is the proven leaf
+	BlockHeight int64
+	BlockHash   string
+	MerkleRoot  string
+	Siblings    []string // Sibling hashes from the leaf up to the root
+	Directions  []bool   // true = sibling is on the right
+	Height      int64    // The miner's tip height
+}
+
+// MerkleProofReply proves a confirmed transaction's inclusion in a block: the
+// proof's root is the Merkle root the header commits to, and the header
+// hashes to BlockHash
+type MerkleProofReply struct {
+	BlockHash string
+	Header    BlockHeader
+	Proof     *merkle.MerkleProof
+	Height    int64 // The miner's tip height
+}
+
+// inclusionProof finds a confirmed transaction and proves its inclusion in
+// its block. Blocks hashed without a Merkle root cannot be proven: their
+// headers commit to the transaction list itself.
+func (m *Miner) inclusionProof(txID string) (*transaction.Transaction, *block.Block, *merkle.MerkleProof, error) {
+	tx, loc := m.Blockchain.GetTransaction(txID)
+	if tx == nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrTxNotConfirmed, txID)
+	}
+	b := m.Blockchain.GetBlockByHash(loc.BlockHash)
+	if b == nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrTxNotConfirmed, txID)
+	}
+	if b.MerkleRoot == "" {
+		return nil, nil, nil, fmt.Errorf("%w: block #%d", ErrNoMerkleRoot, b.Index)
+	}
+	proof, err := b.GenerateSPVProof(txID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if proof.MerkleRoot != b.MerkleRoot {
+		return nil, nil, nil, fmt.Errorf("block #%d's Merkle root does not match its transactions", b.Index)
+	}
+	return tx, b, proof, nil
+}
+
+// MerkleProof returns the header of the block holding a confirmed
+// transaction and a Merkle proof of its inclusion
+func (m *Miner) MerkleProof(txID string) (*MerkleProofReply, error) {
+	_, b, proof, err := m.inclusionProof(txID)
+	if err != nil {
+		return nil, err
+	}
+	return &MerkleProofReply{
+		BlockHash: b.Hash,
+		Header:    headerOf(b),
+		Proof:     proof,
+		Height:    m.Blockchain.GetLatestBlock().Index,
+	}, nil
+}
+
+// SPVProof returns a confirmed transaction with a Merkle proof of its
+// inclusion in its block, for light clients holding the block's header
+func (m *Miner) SPVProof(txID string) (*SPVProofReply, error) {
+	tx, b, proof, err := m.inclusionProof(txID)
+	if err != nil {
+		return nil, err
+	}
+	return &SPVProofReply{
+		Transaction: tx,
+		BlockHeight: b.Index,
+		BlockHash:   b.Hash,
+		MerkleRoot:  b.MerkleRoot,
+		Siblings:    proof.Siblings,
+		Directions:  proof.Directions,
+		Height:      m.Blockchain.GetLatestBlock().Index,
+	}, nil
+}
+
+// GetMerkleProof RPC method to get a confirmed transaction's block header
+// and Merkle proof, to verify its inclusion without downloading the block
+func (s *RPCService) GetMerkleProof(args *TxQueryArgs, reply *MerkleProofReply) error {
+	proof, err := s.miner.MerkleProof(args.TxID)
+	if err != nil {
+		return err
+	}
+	*reply = *proof
+	return nil
+}
+
+// GetSPVProof RPC method to prove a transaction's inclusion to a light client
+func (s *RPCService) GetSPVProof(args *SPVProofArgs, reply *SPVProofReply) error {
+	proof, err := s.miner.SPVProof(args.TxID)
+	if err != nil {
+		return err
+	}
+	*reply = *proof
+	return nil
+}
+
+// VerifyMerkleProof checks a proof on its own: the header must hash to
+// BlockHash and meet its proof of work, and the proof must lead from the
+// transaction ID to the header's Merkle root. Whether the block is in the main
+// chain is left to the caller, who must hold the header chain to know.
+func VerifyMerkleProof(txID string, reply *MerkleProofReply) error {
+	h := reply.Header
+	if h.Hash != reply.BlockHash || h.MerkleRoot == "" {
+		return fmt.Errorf("%w: header does not match block %s", ErrInvalidMerkleProof, reply.BlockHash)
+	}
+	b := h.Block()
+	b.SetMerkleMode(true)
+	if !b.HasValidHash() {
+		return fmt.Errorf("%w: header does not hash to %s", ErrInvalidMerkleProof, h.Hash)
+	}
+	if h.Index > 0 && !b.HasValidPoW() {
+		return fmt.Errorf("%w: header does not meet its proof of work", ErrInvalidMerkleProof)
+	}
+	p := reply.Proof
+	if p == nil || p.TxHash != txID || p.MerkleRoot != h.MerkleRoot || !merkle.VerifyProof(p) {
+		return fmt.Errorf("%w: path does not lead from %s to the header's Merkle root", ErrInvalidMerkleProof, txID)
+	}
+	return nil
+}
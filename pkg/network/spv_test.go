@@ -0,0 +1,92 @@
+package network
+
+import (
+	"blockchain/pkg/merkle"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSPVProofLeadsToMerkleRoot(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	txs := fundedTransactions(t, miner, []int64{10, 20, 30})
+	for _, tx := range txs {
+		if err := miner.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	miner.mineBlock()
+	miner.mineBlock()
+
+	tip := miner.Blockchain.GetLatestBlock()
+	for _, tx := range txs {
+		proof, err := miner.SPVProof(tx.ID)
+		if err != nil {
+			t.Fatalf("SPVProof failed: %v", err)
+		}
+		b := miner.Blockchain.GetBlockByHash(proof.BlockHash)
+		if b == nil || b.Index != proof.BlockHeight || proof.Height != tip.Index || proof.Transaction.ID != tx.ID {
+			t.Fatalf("Proof names the wrong block or transaction: %+v", proof)
+		}
+		if !merkle.VerifyProofWithRoot(tx.ID, b.MerkleRoot, proof.Siblings, proof.Directions) {
+			t.Errorf("Proof of %s does not lead to block #%d's Merkle root", tx.ID, b.Index)
+		}
+	}
+
+	if _, err := miner.SPVProof("nonexistent"); !errors.Is(err, ErrTxNotConfirmed) {
+		t.Errorf("Expected an unconfirmed transaction to have no proof, got %v", err)
+	}
+}
+
+func TestGetMerkleProofVerifiesAgainstHeader(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	txs := fundedTransactions(t, miner, []int64{10, 20, 30})
+	for _, tx := range txs {
+		if err := miner.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	miner.mineBlock()
+	service := &RPCService{miner: miner}
+
+	for _, tx := range txs {
+		var reply MerkleProofReply
+		if err := service.GetMerkleProof(&TxQueryArgs{TxID: tx.ID}, &reply); err != nil {
+			t.Fatalf("GetMerkleProof failed: %v", err)
+		}
+		b := miner.Blockchain.GetBlockByHash(reply.BlockHash)
+		if b == nil || reply.Header.Index != b.Index || reply.Header.MerkleRoot != b.MerkleRoot {
+			t.Fatalf("Proof names the wrong block: %+v", reply)
+		}
+		if err := VerifyMerkleProof(tx.ID, &reply); err != nil {
+			t.Errorf("Proof of %s did not verify: %v", tx.ID, err)
+		}
+		if err := VerifyMerkleProof(txs[0].ID+"00", &reply); !errors.Is(err, ErrInvalidMerkleProof) {
+			t.Errorf("Expected a proof for another transaction to fail, got %v", err)
+		}
+
+		// A header claiming another root no longer hashes to the block
+		forged := reply
+		forged.Header.MerkleRoot = reply.BlockHash
+		forged.Proof = &merkle.MerkleProof{TxHash: tx.ID, MerkleRoot: reply.BlockHash}
+		if err := VerifyMerkleProof(tx.ID, &forged); !errors.Is(err, ErrInvalidMerkleProof) {
+			t.Errorf("Expected a forged header to fail, got %v", err)
+		}
+	}
+
+	var reply MerkleProofReply
+	if err := service.GetMerkleProof(&TxQueryArgs{TxID: "nonexistent"}, &reply); !errors.Is(err, ErrTxNotConfirmed) {
+		t.Errorf("Expected an unconfirmed transaction to have no proof, got %v", err)
+	}
+
+	srv := httptest.NewServer(NewGateway(miner))
+	defer srv.Close()
+	var served MerkleProofReply
+	if code := getJSON(t, srv.URL+"/api/transactions/"+txs[1].ID+"/proof", &served); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if err := VerifyMerkleProof(txs[1].ID, &served); err != nil {
+		t.Errorf("Proof served over HTTP did not verify: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package network
+
+import (
+	"blockchain/pkg/logging"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often a standby checks on its primary
+	DefaultHeartbeatInterval = 2 * time.Second
+
+	// DefaultHeartbeatMisses is how many heartbeats in a row the primary may
+	// miss before the standby takes over
+	DefaultHeartbeatMisses = 3
+)
+
+// StandbyConfig pairs a warm standby with the primary it stands in for
+type StandbyConfig struct {
+	Primary  PeerInfo
+	Interval time.Duration // How often the primary is polled (default DefaultHeartbeatInterval)
+	Misses   int           // Missed heartbeats in a row before taking over (default DefaultHeartbeatMisses)
+}
+
+// StandbyStatusReply reports a standby's view of its primary
+type StandbyStatusReply struct {
+	Enabled       bool
+	Primary       PeerInfo
+	Active        bool      // The standby has taken over and is mining
+	Misses        int       // Heartbeats missed in a row
+	LastHeartbeat time.Time // When the primary last answered
+	Takeovers     int       // How often the standby has taken over
+	Announced     int       // Peers that added the standby on its last takeover
+}
+
+// AnnounceArgs tells a miner that Peer has taken over from the peer at Replaces
+type AnnounceArgs struct {
+	Peer     PeerInfo
+	Replaces string
+}
+
+// AnnounceReply reports whether the announced peer was added
+type AnnounceReply struct {
+	Added bool
+}
+
+// WithStandby runs the miner as a warm standby for cfg.Primary: it follows
+// the primary's chain but does not mine. Once the primary misses cfg.Misses
+// heartbeats in a row the standby starts mining and announces itself to its
+// peers in the primary's place; when the primary answers again it goes back
+// to standby, so the pair never mines on both sides for long. Peers the
+// announcement does not reach are tried again at each heartbeat the primary
+// misses.
+func WithStandby(cfg StandbyConfig) MinerOption {
+	return func(o *MinerOptions) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = DefaultHeartbeatInterval
+		}
+		if cfg.Misses <= 0 {
+			cfg.Misses = DefaultHeartbeatMisses
+		}
+		o.Standby = &cfg
+	}
+}
+
+// standby is the failover state of a standby miner, guarded by standbyMutex
+type standby struct {
+	misses        int
+	active        bool
+	lastHeartbeat time.Time
+	takeovers     int
+	announced     int             // Peers that added the standby on the current takeover
+	told          map[string]bool // Addresses of the peers that answered the announcement
+}
+
+// newStandby returns the standby state for the miner's options, or nil if
+// the miner is not a standby
+func newStandby(cfg *StandbyConfig) *standby {
+	if cfg == nil {
+		return nil
+	}
+	return &standby{}
+}
+
+// standbyIdle reports whether the miner is a standby whose primary is up,
+// and so must not mine
+func (m *Miner) standbyIdle() bool {
+	if m.standby == nil {
+		return false
+	}
+	m.standbyMutex.Lock()
+	defer m.standbyMutex.Unlock()
+	return !m.standby.active
+}
+
+// heartbeat asks the primary for its status, giving up after one interval
+func (m *Miner) heartbeat() (*StatusReply, error) {
+	cfg := m.options.Standby
+	return m.peerStatus(cfg.Primary.Address, cfg.Interval)
+}
+
+// CheckPrimary polls the primary once. A standby whose primary answers
+// catches up with its chain, stepping down first if it had taken over; one
+// whose primary has missed enough heartbeats takes over.
+func (m *Miner) CheckPrimary() {
+	s := m.standby
+	if s == nil {
+		return
+	}
+	cfg := m.options.Standby
+	status, err := m.heartbeat()
+
+	m.standbyMutex.Lock()
+	wasActive := s.active
+	if err == nil {
+		s.misses = 0
+		s.lastHeartbeat = time.Now()
+		s.active = false
+	} else {
+		s.misses++
+		if s.misses >= cfg.Misses && !s.active {
+			s.active = true
+			s.takeovers++
+			s.announced, s.told = 0, make(map[string]bool)
+		}
+	}
+	active, misses := s.active, s.misses
+	m.standbyMutex.Unlock()
+
+	switch {
+	case err == nil && wasActive:
+		log.Printf("[%s] STANDBY: primary %s is back; stopping mining", shortID(m.ID), shortID(cfg.Primary.ID))
+		m.StopMining()
+	case err != nil && !wasActive && active:
+		logging.Warnf("[%s] STANDBY: primary %s missed %d heartbeats (%v); taking over", shortID(m.ID),
+			shortID(cfg.Primary.ID), misses, err)
+		m.StartMining()
+		m.announceTakeover()
+	case err != nil && wasActive:
+		// Peers the announcement missed so far
+		m.announceTakeover()
+	case err != nil && !active:
+		logging.Warnf("[%s] STANDBY: primary %s missed heartbeat %d of %d: %v", shortID(m.ID),
+			shortID(cfg.Primary.ID), misses, cfg.Misses, err)
+	}
+
+	if status != nil && (status.ChainLength > m.Blockchain.GetLength() ||
+		(status.ChainLength == m.Blockchain.GetLength() && status.TipHash != m.Blockchain.GetLatestBlock().Hash)) {
+		if err := m.SyncWithPeer(cfg.Primary); err != nil {
+			logging.Errorf("[%s] STANDBY: failed to sync with primary: %v", shortID(m.ID), err)
+		}
+	}
+}
+
+// announceTakeover tells each peer but the primary that this miner now
+// stands in for the primary, unless the peer already answered since the
+// takeover. Peers predating AnnouncePeer are skipped; those that cannot be
+// reached are left for the next call.
+func (m *Miner) announceTakeover() {
+	primary := m.options.Standby.Primary
+	args := &AnnounceArgs{Peer: PeerInfo{ID: m.ID, Address: m.Address}, Replaces: primary.Address}
+	m.standbyMutex.Lock()
+	var pending []PeerInfo
+	for _, p := range m.GetPeers() {
+		if p.Address != primary.Address && !m.standby.told[p.Address] {
+			pending = append(pending, p)
+		}
+	}
+	m.standbyMutex.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	added := 0
+	var told []string
+	for _, p := range pending {
+		client, err := m.dialPeer(p.Address, m.options.Limits.MaxMessageBytes)
+		if err != nil {
+			logging.Warnf("[%s] STANDBY: failed to reach %s at %s to announce takeover, retrying at the next heartbeat: %v",
+				shortID(m.ID), shortID(p.ID), p.Address, err)
+			continue
+		}
+		var reply AnnounceReply
+		err = client.Call("RPCService.AnnouncePeer", args, &reply)
+		client.Close()
+		switch {
+		case err == nil || methodUnsupported(err):
+			told = append(told, p.Address)
+			if reply.Added {
+				added++
+			}
+		default:
+			logging.Warnf("[%s] STANDBY: failed to announce takeover to %s at %s, retrying at the next heartbeat: %v",
+				shortID(m.ID), shortID(p.ID), p.Address, err)
+		}
+	}
+	m.standbyMutex.Lock()
+	for _, address := range told {
+		m.standby.told[address] = true
+	}
+	m.standby.announced += added
+	announced := m.standby.announced
+	m.standbyMutex.Unlock()
+	log.Printf("[%s] STANDBY: announced takeover to %d more peers, %d in all", shortID(m.ID), added, announced)
+}
+
+// StandbyStatus returns the standby's view of its primary
+func (m *Miner) StandbyStatus() StandbyStatusReply {
+	if m.standby == nil {
+		return StandbyStatusReply{}
+	}
+	m.standbyMutex.Lock()
+	defer m.standbyMutex.Unlock()
+	s := m.standby
+	return StandbyStatusReply{
+		Enabled:       true,
+		Primary:       m.options.Standby.Primary,
+		Active:        s.active,
+		Misses:        s.misses,
+		LastHeartbeat: s.lastHeartbeat,
+		Takeovers:     s.takeovers,
+		Announced:     s.announced,
+	}
+}
+
+// standbyLoop runs CheckPrimary periodically until the miner stops
+func (m *Miner) standbyLoop() {
+	for {
+		m.CheckPrimary()
+		select {
+		case <-m.done:
+			return
+		case <-time.After(m.options.Standby.Interval):
+		}
+	}
+}
+
+// GetStandbyStatus RPC method to report a standby's failover state
+func (s *RPCService) GetStandbyStatus(args *struct{}, reply *StandbyStatusReply) error {
+	*reply = s.miner.StandbyStatus()
+	return nil
+}
+
+// AnnouncePeer RPC method for a standby to announce it has taken over from
+// one of this miner's peers. The announced peer is added only in place of a
+// peer already listed, so a caller cannot grow the peer list at will; the
+// replaced peer is kept, as it may come back.
+func (s *RPCService) AnnouncePeer(args *AnnounceArgs, reply *AnnounceReply) error {
+	if args.Peer.Address == "" {
+		return fmt.Errorf("announced peer has no address")
+	}
+	listed := false
+	for _, p := range s.miner.GetPeers() {
+		listed = listed || p.Address == args.Replaces
+	}
+	if !listed {
+		return nil
+	}
+	before := len(s.miner.GetPeers())
+	reply.Added = len(s.miner.UpdatePeers([]PeerInfo{args.Peer}, nil)) > before
+	if reply.Added {
+		log.Printf("[%s] Standby %s took over from %s; added it as a peer", shortID(s.miner.ID),
+			shortID(args.Peer.ID), args.Replaces)
+	}
+	return nil
+}
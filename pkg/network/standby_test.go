@@ -0,0 +1,132 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// freeAddress returns a local address no one is listening on
+func freeAddress(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("No free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// pollStandby runs standby's heartbeat until done reports true, failing the
+// test if it does not within a few seconds
+func pollStandby(t *testing.T, standby *Miner, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		standby.CheckPrimary()
+		if done() {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s, standby status %+v", what, standby.StandbyStatus())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestStandbyTakesOverAndStepsDown(t *testing.T) {
+	primaryAddr, otherAddr, standbyAddr := freeAddress(t), freeAddress(t), freeAddress(t)
+	primary := NewMiner("primary", primaryAddr, 1, nil)
+	if err := primary.Start(); err != nil {
+		t.Fatalf("Failed to start primary: %v", err)
+	}
+	primary.mineBlock()
+	defer primary.Stop()
+
+	other := NewMiner("other", otherAddr, 1, []PeerInfo{{ID: "primary", Address: primaryAddr}})
+	if err := other.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer other.Stop()
+
+	standby := NewMiner("standby", standbyAddr, 1,
+		[]PeerInfo{{ID: "primary", Address: primaryAddr}, {ID: "other", Address: otherAddr}},
+		WithStandby(StandbyConfig{Primary: PeerInfo{ID: "primary", Address: primaryAddr}, Interval: 5 * time.Second, Misses: 2}))
+	defer standby.Stop()
+
+	// While the primary answers, the standby follows its chain but does not mine
+	standby.StartMining()
+	pollStandby(t, standby, "the standby to follow the primary's chain", func() bool {
+		return standby.Blockchain.GetLength() == primary.Blockchain.GetLength()
+	})
+	if standby.IsMining() {
+		t.Fatal("A standby should not mine while its primary is up")
+	}
+
+	// One missed heartbeat is tolerated, the second triggers the takeover
+	primary.Stop()
+	standby.CheckPrimary()
+	if standby.IsMining() {
+		t.Fatal("A single missed heartbeat should not trigger a takeover")
+	}
+	defer standby.StopMining()
+	pollStandby(t, standby, "the standby to take over and announce itself", func() bool {
+		status := standby.StandbyStatus()
+		return standby.IsMining() && status.Active && status.Announced == 1
+	})
+	if status := standby.StandbyStatus(); status.Takeovers != 1 {
+		t.Errorf("Expected one takeover, got %+v", status)
+	}
+	found := false
+	for _, p := range other.GetPeers() {
+		found = found || p.Address == standbyAddr
+	}
+	if !found {
+		t.Error("The peer should add the standby in the primary's place")
+	}
+
+	// Announcements naming a peer the receiver does not know are ignored
+	var reply AnnounceReply
+	err := (&RPCService{miner: other}).AnnouncePeer(&AnnounceArgs{Peer: PeerInfo{ID: "x", Address: "elsewhere:1"}, Replaces: "unknown:1"}, &reply)
+	if err != nil || reply.Added {
+		t.Errorf("An announcement replacing an unknown peer should not be added, got %+v, %v", reply, err)
+	}
+
+	// The primary comes back: the standby stops mining
+	restarted := NewMiner("primary", primaryAddr, 1, nil)
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Failed to restart primary: %v", err)
+	}
+	defer restarted.Stop()
+	pollStandby(t, standby, "the standby to step down", func() bool {
+		return !standby.IsMining() && !standby.StandbyStatus().Active
+	})
+}
+
+func TestStandbyRetriesUnreachedPeers(t *testing.T) {
+	primaryAddr, otherAddr := freeAddress(t), freeAddress(t)
+	standby := NewMiner("standby", freeAddress(t), 1,
+		[]PeerInfo{{ID: "primary", Address: primaryAddr}, {ID: "other", Address: otherAddr}},
+		WithStandby(StandbyConfig{Primary: PeerInfo{ID: "primary", Address: primaryAddr}, Interval: time.Second, Misses: 1}))
+	defer standby.StopMining()
+
+	// Neither the primary nor the other peer is up: the takeover reaches no one
+	standby.CheckPrimary()
+	if status := standby.StandbyStatus(); !status.Active || status.Announced != 0 {
+		t.Fatalf("Expected a takeover announced to no one, got %+v", status)
+	}
+
+	// The peer comes up listing the primary: the next missed heartbeat tells it
+	other := NewMiner("other", otherAddr, 1, []PeerInfo{{ID: "primary", Address: primaryAddr}})
+	if err := other.Start(); err != nil {
+		t.Fatalf("Failed to start peer: %v", err)
+	}
+	defer other.Stop()
+	pollStandby(t, standby, "the announcement to reach the peer", func() bool {
+		return standby.StandbyStatus().Announced == 1
+	})
+
+	// A peer that answered is not told again
+	standby.CheckPrimary()
+	if status := standby.StandbyStatus(); status.Announced != 1 || status.Takeovers != 1 {
+		t.Errorf("Expected one announcement of one takeover, got %+v", status)
+	}
+}
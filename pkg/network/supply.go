@@ -0,0 +1,16 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+)
+
+// SupplyReply carries the emission schedule and the current coin supply
+type SupplyReply struct {
+	blockchain.Supply
+}
+
+// GetSupply RPC method to report the emission schedule, circulating supply, and burned coins
+func (s *RPCService) GetSupply(args *struct{}, reply *SupplyReply) error {
+	reply.Supply = s.miner.Blockchain.Supply()
+	return nil
+}
@@ -0,0 +1,261 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// syncRangeBlocks is how many blocks the first request to a peer asks
+	// for, before its speed is known
+	syncRangeBlocks = 256
+
+	// minSyncBatch and maxSyncBatch bound the blocks one request asks for
+	minSyncBatch = 16
+	maxSyncBatch = 2048
+
+	// syncBatchTarget is how long one request should take, download and
+	// verification together. Batches grow for fast peers and shrink for slow
+	// ones, or when this node is slow to verify.
+	syncBatchTarget = time.Second
+
+	// syncWindowBlocks bounds the blocks requested but not yet verified,
+	// across all peers of a sync, so fast peers cannot swamp a slow node
+	syncWindowBlocks = 4096
+)
+
+// peerSyncMeter is what a miner learned about downloading blocks from one peer
+type peerSyncMeter struct {
+	batch    int           // Blocks the next request asks for
+	rate     float64       // Blocks per second, moving average
+	latency  time.Duration // Time per request, moving average
+	requests int64
+	failures int64
+}
+
+// syncMeter adapts sync batch sizes to each peer and counts the batches
+type syncMeter struct {
+	mu       sync.Mutex
+	peers    map[string]*peerSyncMeter
+	requests int64
+	blocks   int64
+	retries  int64
+	overruns int64
+	stalls   int64
+}
+
+func (s *syncMeter) peer(address string) *peerSyncMeter {
+	if s.peers == nil {
+		s.peers = make(map[string]*peerSyncMeter)
+	}
+	p, ok := s.peers[address]
+	if !ok {
+		p = &peerSyncMeter{batch: syncRangeBlocks}
+		s.peers[address] = p
+	}
+	return p
+}
+
+// batch returns how many blocks to ask of a peer next
+func (s *syncMeter) batch(address string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peer(address).batch
+}
+
+// observe records a request for n blocks to a peer that took elapsed. A
+// success sizes the peer's next batch to take about syncBatchTarget at its
+// measured speed, at most doubling it; a failure halves it.
+func (s *syncMeter) observe(address string, n int, elapsed time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.peer(address)
+	s.requests++
+	p.requests++
+	if err != nil {
+		p.failures++
+		p.batch = max(p.batch/2, minSyncBatch)
+		return
+	}
+	s.blocks += int64(n)
+
+	rate := float64(n) / max(elapsed, time.Millisecond).Seconds()
+	if p.rate == 0 {
+		p.rate, p.latency = rate, elapsed
+	} else {
+		p.rate = (p.rate + rate) / 2
+		p.latency = (p.latency + elapsed) / 2
+	}
+	target := int(p.rate * syncBatchTarget.Seconds())
+	p.batch = min(max(target, minSyncBatch), 2*p.batch, maxSyncBatch)
+}
+
+// noteRetry records a batch fetched again from the synced peer
+func (s *syncMeter) noteRetry() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries++
+}
+
+// noteOverrun records a reply with more blocks than requested
+func (s *syncMeter) noteOverrun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overruns++
+}
+
+// noteStall records a request held back by a full sync window
+func (s *syncMeter) noteStall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stalls++
+}
+
+// syncSchedule hands out the missing blocks of one sync in batches and
+// collects them, keeping at most syncWindowBlocks in flight
+type syncSchedule struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	meter    *syncMeter
+	next     int // Offset of the first block not handed out
+	total    int
+	inFlight int
+	results  map[int][]*block.Block // Verified blocks by range start
+	retry    []blockRange
+}
+
+func newSyncSchedule(total int, meter *syncMeter) *syncSchedule {
+	s := &syncSchedule{meter: meter, total: total, results: make(map[int][]*block.Block)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// take hands out the next range of up to want blocks, waiting while the
+// window is full. It returns false once every block is handed out.
+func (s *syncSchedule) take(want int) (blockRange, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next < s.total && s.inFlight >= syncWindowBlocks {
+		s.meter.noteStall()
+		for s.next < s.total && s.inFlight >= syncWindowBlocks {
+			s.cond.Wait()
+		}
+	}
+	if s.next >= s.total {
+		return blockRange{}, false
+	}
+	n := min(want, syncWindowBlocks-s.inFlight, s.total-s.next)
+	r := blockRange{s.next, n}
+	s.next += n
+	s.inFlight += n
+	return r, true
+}
+
+// done stores a range's verified blocks, or queues it for retry if blocks is nil
+func (s *syncSchedule) done(r blockRange, blocks []*block.Block) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if blocks == nil {
+		s.retry = append(s.retry, r)
+	} else {
+		s.results[r.start] = blocks
+	}
+	s.inFlight -= r.count
+	s.cond.Broadcast()
+}
+
+// abort stops handing out ranges
+func (s *syncSchedule) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = s.total
+	s.cond.Broadcast()
+}
+
+// takeRetry returns a range that failed, if any is left
+func (s *syncSchedule) takeRetry() (blockRange, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.retry) == 0 {
+		return blockRange{}, false
+	}
+	r := s.retry[0]
+	s.retry = s.retry[1:]
+	return r, true
+}
+
+// blocks reassembles the downloaded ranges in order
+func (s *syncSchedule) blocks() []*block.Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blocks := make([]*block.Block, 0, s.total)
+	for len(blocks) < s.total {
+		rangeBlocks, ok := s.results[len(blocks)]
+		if !ok {
+			break
+		}
+		blocks = append(blocks, rangeBlocks...)
+	}
+	return blocks
+}
+
+// PeerSyncStats is what a miner learned about downloading blocks from a peer
+type PeerSyncStats struct {
+	Address      string
+	Batch        int           // Blocks the next request asks for
+	BlocksPerSec float64       // Recent download speed, verification included
+	Latency      time.Duration // Recent time per request
+	Requests     int64
+	Failures     int64
+}
+
+// SyncStatsReply reports how the miner batched block downloads during sync
+type SyncStatsReply struct {
+	Requests int64   // Batches requested from peers
+	Blocks   int64   // Blocks received and verified
+	Retries  int64   // Batches fetched again from the synced peer after a helper failed
+	Overruns int64   // Replies carrying more blocks than requested
+	Stalls   int64   // Requests held back until the in-flight window had room
+	AvgBatch float64 // Blocks per successful request (0 before the first)
+	Peers    []PeerSyncStats
+}
+
+// SyncStats returns the miner's sync batching metrics, peers sorted by address
+func (m *Miner) SyncStats() SyncStatsReply {
+	s := &m.syncMeter
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply := SyncStatsReply{
+		Requests: s.requests,
+		Blocks:   s.blocks,
+		Retries:  s.retries,
+		Overruns: s.overruns,
+		Stalls:   s.stalls,
+	}
+	var failures int64
+	for addr, p := range s.peers {
+		failures += p.failures
+		reply.Peers = append(reply.Peers, PeerSyncStats{
+			Address:      addr,
+			Batch:        p.batch,
+			BlocksPerSec: p.rate,
+			Latency:      p.latency,
+			Requests:     p.requests,
+			Failures:     p.failures,
+		})
+	}
+	if ok := s.requests - failures; ok > 0 {
+		reply.AvgBatch = float64(s.blocks) / float64(ok)
+	}
+	sort.Slice(reply.Peers, func(i, j int) bool { return reply.Peers[i].Address < reply.Peers[j].Address })
+	return reply
+}
+
+// GetSyncStats RPC method to get the miner's sync batching metrics
+func (s *RPCService) GetSyncStats(args *struct{}, reply *SyncStatsReply) error {
+	*reply = s.miner.SyncStats()
+	return nil
+}
@@ -0,0 +1,81 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSyncMeterAdaptsBatchToPeerSpeed(t *testing.T) {
+	miner := &Miner{}
+	meter := &miner.syncMeter
+	if b := meter.batch("fast"); b != syncRangeBlocks {
+		t.Fatalf("An unmeasured peer should get %d blocks, got %d", syncRangeBlocks, b)
+	}
+
+	// A fast peer's batch at most doubles per request, up to the cap
+	for _, want := range []int{512, 1024, maxSyncBatch, maxSyncBatch} {
+		meter.observe("fast", meter.batch("fast"), 10*time.Millisecond, nil)
+		if b := meter.batch("fast"); b != want {
+			t.Errorf("Expected the fast peer's batch to be %d, got %d", want, b)
+		}
+	}
+
+	// A slow peer's batch shrinks to what it delivers in syncBatchTarget
+	meter.observe("slow", 100, 10*time.Second, nil)
+	if b := meter.batch("slow"); b != minSyncBatch {
+		t.Errorf("Expected the slow peer's batch to drop to %d, got %d", minSyncBatch, b)
+	}
+
+	meter.observe("flaky", syncRangeBlocks, 0, errors.New("timeout"))
+	if b := meter.batch("flaky"); b != syncRangeBlocks/2 {
+		t.Errorf("A failure should halve the batch, got %d", b)
+	}
+
+	stats := miner.SyncStats()
+	if stats.Requests != 6 || len(stats.Peers) != 3 || stats.Peers[0].Address != "fast" || stats.Peers[0].Failures != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.AvgBatch != float64(stats.Blocks)/5 {
+		t.Errorf("Average batch should leave out the failed request, got %f", stats.AvgBatch)
+	}
+}
+
+func TestSyncScheduleBoundsBlocksInFlight(t *testing.T) {
+	var meter syncMeter
+	schedule := newSyncSchedule(3*syncWindowBlocks, &meter)
+	first, _ := schedule.take(syncWindowBlocks / 2)
+	second, _ := schedule.take(syncWindowBlocks)
+	if second.count != syncWindowBlocks/2 {
+		t.Fatalf("The window should cap the second batch at %d, got %d", syncWindowBlocks/2, second.count)
+	}
+
+	taken := make(chan blockRange)
+	go func() {
+		r, _ := schedule.take(syncWindowBlocks)
+		taken <- r
+	}()
+	select {
+	case <-taken:
+		t.Fatal("A full window should hold the request back")
+	case <-time.After(50 * time.Millisecond):
+	}
+	schedule.done(first, make([]*block.Block, first.count))
+	if r := <-taken; r.start != syncWindowBlocks || r.count != first.count {
+		t.Errorf("Expected the freed room to be handed out, got %+v", r)
+	}
+	if meter.stalls != 1 {
+		t.Errorf("Expected one stall, got %d", meter.stalls)
+	}
+
+	// Failed ranges come back for retry; abort ends the schedule
+	schedule.done(second, nil)
+	if r, ok := schedule.takeRetry(); !ok || r != second {
+		t.Errorf("Expected %+v back for retry, got %+v", second, r)
+	}
+	schedule.abort()
+	if _, ok := schedule.take(1); ok {
+		t.Error("An aborted schedule should hand out nothing")
+	}
+}
@@ -0,0 +1,233 @@
+package network
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// maxBlockTemplates is how many templates handed out to external miners are
+// kept for SubmitBlock; older ones expire
+const maxBlockTemplates = 16
+
+var (
+	ErrUnknownTemplate = errors.New("unknown or expired block template")
+	ErrNotMining       = errors.New("read replicas do not mine")
+)
+
+// blockTemplate is a block handed out by GetBlockTemplate for an external
+// process to find the nonce of
+type blockTemplate struct {
+	id    string
+	block *block.Block
+	txs   []*transaction.Transaction // Coinbase first
+}
+
+// BlockTemplateReply is a block for an external miner to solve: find a nonce
+// such that the PowAlgorithm hash of HashPrefix, the nonce in decimal, and
+// HashSuffix has at least Difficulty leading zero bits, and pass it to SubmitBlock with
+// TemplateID. The other fields describe the block; BlockData holds all of it,
+// with nonce 0, for miners that hash it themselves.
+type BlockTemplateReply struct {
+	TemplateID   string
+	Height       int64
+	PrevHash     string
+	Timestamp    int64  // Unix nanoseconds
+	MerkleRoot   string // "" if the chain hashes transaction IDs instead
+	Difficulty   int    // Leading zero bits the block hash needs
+	MinerID      string
+	PowAlgorithm string // Hash function, by hashfn name ("" = sha256)
+	Transactions int    // Including the coinbase
+	Fees         int64  // Collected by the coinbase on top of the subsidy
+	HashPrefix   string // Hex bytes hashed before the nonce
+	HashSuffix   string // Hex bytes hashed after the nonce
+	BlockData    []byte // JSON encoded
+}
+
+// SubmitBlockArgs is a solved template, or a whole solved block
+type SubmitBlockArgs struct {
+	TemplateID string
+	Nonce      int64
+	BlockData  []byte // If set, submitted instead of a template
+}
+
+// SubmitBlockReply reports whether a submitted block joined the chain
+type SubmitBlockReply struct {
+	Success bool
+	Error   string
+	Hash    string
+	Height  int64
+}
+
+// BlockTemplate builds a block from the mempool, as a mining round would, and
+// keeps it for SubmitBlock. Templates on an earlier tip are dropped.
+func (m *Miner) BlockTemplate() (*BlockTemplateReply, error) {
+	if m.IsReplica() {
+		return nil, ErrNotMining
+	}
+	b, txs := m.assembleBlock()
+	prefix, suffix := b.HashParts()
+	sum := sha256.Sum256(append(append(append([]byte(nil), prefix...), '/'), suffix...))
+	t := &blockTemplate{id: hex.EncodeToString(sum[:8]), block: b, txs: txs}
+
+	m.templateMutex.Lock()
+	kept := m.templates[:0]
+	for _, old := range m.templates {
+		if old.block.PrevHash == b.PrevHash && old.id != t.id {
+			kept = append(kept, old)
+		}
+	}
+	m.templates = append(kept, t)
+	if len(m.templates) > maxBlockTemplates {
+		m.templates = m.templates[len(m.templates)-maxBlockTemplates:]
+	}
+	m.templateMutex.Unlock()
+
+	data, err := b.SerializeJSON()
+	if err != nil {
+		return nil, err
+	}
+	return &BlockTemplateReply{
+		TemplateID:   t.id,
+		Height:       b.Index,
+		PrevHash:     b.PrevHash,
+		Timestamp:    b.Timestamp,
+		MerkleRoot:   b.MerkleRoot,
+		Difficulty:   b.Difficulty,
+		MinerID:      b.MinerID,
+		PowAlgorithm: b.PowAlgorithm,
+		Transactions: len(txs),
+		Fees:         txs[0].TotalOutputValue() - m.Blockchain.Params().SubsidyAt(b.Index),
+		HashPrefix:   hex.EncodeToString(prefix),
+		HashSuffix:   hex.EncodeToString(suffix),
+		BlockData:    data,
+	}, nil
+}
+
+// SubmitBlock adds a block solved outside the node to the chain and relays
+// it, as if the node had mined it. The block is the template named by id with
+// nonce set, or b if it is not nil.
+func (m *Miner) SubmitBlock(id string, nonce int64, b *block.Block) (*block.Block, error) {
+	if m.IsReplica() {
+		return nil, ErrNotMining
+	}
+	var txs []*transaction.Transaction
+	if b == nil {
+		m.templateMutex.Lock()
+		for _, t := range m.templates {
+			if t.id == id {
+				b, txs = t.block.Clone(), t.txs
+			}
+		}
+		m.templateMutex.Unlock()
+		if b == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownTemplate, id)
+		}
+		b.Nonce = nonce
+		b.SetHash()
+	} else {
+		txs = b.Transactions
+	}
+	if err := m.Blockchain.Engine().ValidateHeader(b); err != nil {
+		return nil, fmt.Errorf("block %s is not sealed: %w", shortID(b.Hash), err)
+	}
+	if err := m.Blockchain.AddBlock(b); err != nil {
+		if tip := m.Blockchain.GetLatestBlock(); tip.Hash != b.PrevHash {
+			return nil, fmt.Errorf("block is no longer on the tip (now #%d): %w", tip.Index, err)
+		}
+		return nil, err
+	}
+
+	// A round mining on the old tip can no longer add its block
+	m.notifyNewTip()
+	m.acceptMinedBlock(b, txs)
+	log.Printf("[%s] Accepted externally mined block #%d", shortID(m.ID), b.Index)
+	return b, nil
+}
+
+// acceptMinedBlock finishes a block the node mined, or was handed solved,
+// once it joined the chain: its transactions leave the mempool and the block
+// is announced
+func (m *Miner) acceptMinedBlock(b *block.Block, txs []*transaction.Transaction) {
+	atomic.AddInt64(&m.blocksMined, 1)
+	m.RemoveTransactions(txs)
+	m.journalBlock(b, JournalMined)
+	m.publishBlocks([]*block.Block{b}, true)
+	m.BroadcastBlock(b)
+	if m.blockCallback != nil {
+		m.blockCallback(b)
+	}
+}
+
+// GetBlockTemplate RPC method to hand out a block for an external process to
+// mine
+func (s *RPCService) GetBlockTemplate(args *struct{}, reply *BlockTemplateReply) error {
+	t, err := s.miner.BlockTemplate()
+	if err != nil {
+		return err
+	}
+	*reply = *t
+	return nil
+}
+
+// SubmitBlock RPC method to add a block solved by an external process
+func (s *RPCService) SubmitBlock(args *SubmitBlockArgs, reply *SubmitBlockReply) error {
+	var b *block.Block
+	if len(args.BlockData) > 0 {
+		limits := s.miner.options.Limits
+		if err := checkPayload(args.BlockData, limits.MaxBlockBytes, limits.MaxJSONDepth); err != nil {
+			reply.Error = err.Error()
+			return nil
+		}
+		var err error
+		if b, err = block.DeserializeBlock(args.BlockData); err != nil {
+			reply.Error = fmt.Sprintf("invalid block data: %v", err)
+			return nil
+		}
+	}
+	b, err := s.miner.SubmitBlock(args.TemplateID, args.Nonce, b)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Success = true
+	reply.Hash = b.Hash
+	reply.Height = b.Index
+	return nil
+}
+
+// GetBlockTemplate gets a block for this process to mine from a miner
+func (c *Client) GetBlockTemplate(minerAddress string) (*BlockTemplateReply, error) {
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	var reply BlockTemplateReply
+	if err := client.Call("RPCService.GetBlockTemplate", &struct{}{}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// SubmitBlock submits the nonce solving a template to a miner
+func (c *Client) SubmitBlock(minerAddress, templateID string, nonce int64) (*SubmitBlockReply, error) {
+	client, err := c.dial(minerAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	var reply SubmitBlockReply
+	if err := client.Call("RPCService.SubmitBlock", &SubmitBlockArgs{TemplateID: templateID, Nonce: nonce}, &reply); err != nil {
+		return nil, err
+	}
+	if !reply.Success {
+		return &reply, errors.New(reply.Error)
+	}
+	return &reply, nil
+}
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"strconv"
+	"testing"
+)
+
+// solveTemplate finds the first nonce for which meetsTemplate is want
+func solveTemplate(t *testing.T, tmpl *BlockTemplateReply, want bool) int64 {
+	t.Helper()
+	for nonce := int64(0); ; nonce++ {
+		if meetsTemplate(t, tmpl, nonce) == want {
+			return nonce
+		}
+	}
+}
+
+// meetsTemplate checks nonce against tmpl from its hash parts alone, as an
+// external miner would
+func meetsTemplate(t *testing.T, tmpl *BlockTemplateReply, nonce int64) bool {
+	prefix, err1 := hex.DecodeString(tmpl.HashPrefix)
+	suffix, err2 := hex.DecodeString(tmpl.HashSuffix)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Hash parts should be hex: %v, %v", err1, err2)
+	}
+	sum := sha256.Sum256(append(strconv.AppendInt(prefix, nonce, 10), suffix...))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= tmpl.Difficulty
+}
+
+func TestExternallyMinedTemplate(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 6, nil)
+	txs := fundedTransactions(t, miner, []int64{300})
+	if err := miner.AddTransaction(txs[0]); err != nil {
+		t.Fatalf("Failed to add transaction: %v", err)
+	}
+	service := &RPCService{miner: miner}
+
+	var tmpl BlockTemplateReply
+	if err := service.GetBlockTemplate(&struct{}{}, &tmpl); err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if tmpl.Height != 1 || tmpl.Transactions != 2 || tmpl.Fees != 300 || tmpl.Difficulty != 6 {
+		t.Errorf("Unexpected template: %+v", tmpl)
+	}
+
+	nonce := solveTemplate(t, &tmpl, true)
+	var reply SubmitBlockReply
+	service.SubmitBlock(&SubmitBlockArgs{TemplateID: tmpl.TemplateID, Nonce: nonce}, &reply)
+	if !reply.Success {
+		t.Fatalf("Solved template should be accepted: %s", reply.Error)
+	}
+	if tip := miner.Blockchain.GetLatestBlock(); tip.Hash != reply.Hash || len(tip.Transactions) != 2 {
+		t.Errorf("Expected the template's block on the tip")
+	}
+	if len(miner.GetPendingTransactions()) != 0 || miner.WorkStats().AcceptedBlocks != 1 {
+		t.Error("The block should count as mined and clear its transaction from the mempool")
+	}
+
+	// The solution cannot be submitted again
+	reply = SubmitBlockReply{}
+	service.SubmitBlock(&SubmitBlockArgs{TemplateID: tmpl.TemplateID, Nonce: nonce}, &reply)
+	if reply.Success || reply.Error == "" {
+		t.Error("A block already on the chain should be refused")
+	}
+}
+
+func TestSubmitBlockRefusals(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 12, nil)
+	tmpl, err := miner.BlockTemplate()
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+
+	if _, err := miner.SubmitBlock("nope", 0, nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Expected ErrUnknownTemplate, got %v", err)
+	}
+	if _, err := miner.SubmitBlock(tmpl.TemplateID, solveTemplate(t, tmpl, false), nil); err == nil {
+		t.Error("A nonce missing the target should be refused")
+	}
+
+	// A block mined in the meantime makes the template stale
+	miner.mineBlock()
+	if miner.Blockchain.GetLength() != 2 {
+		t.Fatal("Expected a block mined")
+	}
+	if _, err := miner.SubmitBlock(tmpl.TemplateID, solveTemplate(t, tmpl, true), nil); err == nil {
+		t.Error("A template on an old tip should be refused")
+	}
+
+	replica := NewMiner("replica", "localhost:0", 1, nil, WithReplica(ReplicaConfig{}))
+	if _, err := replica.BlockTemplate(); !errors.Is(err, ErrNotMining) {
+		t.Errorf("Expected ErrNotMining from a replica, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// tlsHandshakeTimeout bounds how long a connection may take to complete its
+// TLS handshake before the listener gives up on it
+const tlsHandshakeTimeout = 10 * time.Second
+
+var ErrNoCertificate = errors.New("TLS listener needs a certificate")
+
+// LoadTLSConfig builds the TLS settings of a miner or client. certFile and
+// keyFile are the certificate it presents; miners need one to listen, clients
+// only to authenticate with it. caFile, if given, holds the CA certificates
+// that server certificates are checked against and that client certificates
+// must chain to in order to authenticate (see WithTLS). Without it the
+// system's roots are used and client certificates are not requested.
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// TLSTransport is the Transport over TCP with TLS. Miners using it only talk
+// to peers that use it too.
+type TLSTransport struct {
+	Config *tls.Config
+}
+
+// Listen listens for TLS connections on address
+func (t TLSTransport) Listen(address string) (net.Listener, error) {
+	if t.Config == nil || len(t.Config.Certificates) == 0 && t.Config.GetCertificate == nil {
+		return nil, ErrNoCertificate
+	}
+	return tls.Listen("tcp", address, t.Config)
+}
+
+// Dial connects to address over TLS, checking the server's certificate
+// against the host in address unless the config names a server
+func (t TLSTransport) Dial(address string) (net.Conn, error) {
+	cfg := &tls.Config{}
+	if t.Config != nil {
+		cfg = t.Config.Clone()
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+	return tls.Dial("tcp", address, cfg)
+}
+
+// WithTLS serves RPC and dials peers over TLS with cfg, as returned by
+// LoadTLSConfig. Under an access policy, a connection presenting a client
+// certificate that chains to cfg's CAs takes certRole, as if it had
+// authenticated with a token; an empty certRole ignores client certificates.
+func WithTLS(cfg *tls.Config, certRole access.Role) MinerOption {
+	return func(o *MinerOptions) {
+		o.Transport = TLSTransport{Config: cfg}
+		o.CertRole = certRole
+	}
+}
+
+// handshakeTLS completes the TLS handshake of conn, if it is a TLS
+// connection, and gives sess the certificate role if its client certificate
+// was verified
+func (m *Miner) handshakeTLS(conn net.Conn, sess *session) error {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	tc.SetDeadline(time.Time{})
+	state := tc.ConnectionState()
+	m.certSession(sess, &state)
+	return nil
+}
+
+// certSession gives sess the certificate role if state carries a verified
+// client certificate. Sessions and certificates are otherwise left alone.
+func (m *Miner) certSession(sess *session, state *tls.ConnectionState) {
+	if sess == nil || state == nil || m.options.CertRole == "" || len(state.VerifiedChains) == 0 {
+		return
+	}
+	leaf := state.VerifiedChains[0][0]
+	sess.mu.Lock()
+	sess.role = m.options.CertRole
+	sess.caller = "cert:" + leaf.Subject.CommonName
+	sess.mu.Unlock()
+}
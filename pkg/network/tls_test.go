@@ -0,0 +1,122 @@
+package network
+
+import (
+	"blockchain/pkg/access"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert issues a certificate for name and 127.0.0.1, signed by the CA
+// (or self-signed as a CA if ca is nil), and writes it and its key as PEM
+// files in dir. Returns the file paths, the certificate, and its key.
+func writeTestCert(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (string, string, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		parent, signer = ca, caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+".key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath, cert, key
+}
+
+func TestTLSClientCertificateGrantsRole(t *testing.T) {
+	dir := t.TempDir()
+	caPath, _, ca, caKey := writeTestCert(t, dir, "ca", nil, nil)
+	minerCert, minerKey, _, _ := writeTestCert(t, dir, "miner", ca, caKey)
+	opsCert, opsKey, _, _ := writeTestCert(t, dir, "ops", ca, caKey)
+
+	serverTLS, err := LoadTLSConfig(minerCert, minerKey, caPath)
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %v", err)
+	}
+	policy := access.NewPolicy(access.RoleObserver)
+	miner := NewMiner("miner", "localhost:19156", 1, nil,
+		WithAccessPolicy(policy), WithTLS(serverTLS, access.RoleOperator))
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	defer miner.Stop()
+
+	// Plain TCP clients are not served
+	var status StatusReply
+	plain, err := DialMiner("localhost:19156", Credentials{})
+	if err == nil {
+		defer plain.Close()
+		err = plain.Call("RPCService.GetStatus", &struct{}{}, &status)
+	}
+	if err == nil {
+		t.Error("A plain TCP client should not be served by a TLS miner")
+	}
+
+	// Without a client certificate the connection keeps the anonymous role
+	clientTLS, err := LoadTLSConfig("", "", caPath)
+	if err != nil {
+		t.Fatalf("Failed to load client TLS config: %v", err)
+	}
+	anon, err := DialMiner("localhost:19156", Credentials{TLS: clientTLS})
+	if err != nil {
+		t.Fatalf("Failed to connect over TLS: %v", err)
+	}
+	defer anon.Close()
+	if err := anon.Call("RPCService.GetStatus", &struct{}{}, &status); err != nil {
+		t.Errorf("Observer should be able to read status over TLS: %v", err)
+	}
+	var mining MiningReply
+	err = anon.Call("RPCService.SetMining", &MiningArgs{Enabled: true}, &mining)
+	if err == nil || !strings.Contains(err.Error(), access.ErrAccessDenied.Error()) {
+		t.Fatalf("Observer should be denied SetMining, got %v", err)
+	}
+
+	// A certificate issued by the CA takes the operator role
+	opsTLS, err := LoadTLSConfig(opsCert, opsKey, caPath)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	ops, err := DialMiner("localhost:19156", Credentials{TLS: opsTLS})
+	if err != nil {
+		t.Fatalf("Failed to connect with a client certificate: %v", err)
+	}
+	defer ops.Close()
+	if err := ops.Call("RPCService.SetMining", &MiningArgs{Enabled: false}, &mining); err != nil {
+		t.Errorf("A client certificate from the CA should grant SetMining: %v", err)
+	}
+}
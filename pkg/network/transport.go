@@ -0,0 +1,60 @@
+package network
+
+import (
+	"net"
+	"net/rpc"
+)
+
+// Transport carries RPC connections between nodes: miners listen and dial
+// peers through it, and clients dial miners. The default is TCP;
+// networktest.Network connects nodes in memory, so tests need no sockets.
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(address string) (net.Conn, error)
+}
+
+// TCPTransport is the Transport over TCP
+type TCPTransport struct{}
+
+// Listen listens for TCP connections on address
+func (TCPTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+// Dial connects to address over TCP
+func (TCPTransport) Dial(address string) (net.Conn, error) {
+	return net.Dial("tcp", address)
+}
+
+// WithTransport sets how the miner listens for and dials peers (nil = TCP)
+func WithTransport(t Transport) MinerOption {
+	return func(o *MinerOptions) {
+		o.Transport = t
+	}
+}
+
+// transport returns the miner's transport
+func (m *Miner) transport() Transport {
+	if m.options.Transport == nil {
+		return TCPTransport{}
+	}
+	return m.options.Transport
+}
+
+// transport returns the client's transport, TLS if its credentials carry a
+// TLS config
+func (c *Client) transport() Transport {
+	if c.Transport == nil {
+		if c.Auth.TLS != nil {
+			return TLSTransport{Config: c.Auth.TLS}
+		}
+		return TCPTransport{}
+	}
+	return c.Transport
+}
+
+// dial connects to a miner through the client's transport and authenticates
+// with the client's credentials
+func (c *Client) dial(address string) (*rpc.Client, error) {
+	return dialMiner(c.transport(), address, c.Auth)
+}
@@ -0,0 +1,86 @@
+package network
+
+import (
+	"fmt"
+	"time"
+)
+
+// Transaction statuses reported by GetTxStatus
+const (
+	TxPending   = "pending"   // Waiting in the mempool
+	TxConfirmed = "confirmed" // Included in a block of the main chain
+	TxDropped   = "dropped"   // Seen by the miner but neither pending nor confirmed; Reason says why
+	TxUnknown   = "unknown"   // Never seen, or forgotten along with the oldest journal events
+)
+
+// TxStatusReply reports where a transaction stands on the miner
+type TxStatusReply struct {
+	TxID   string
+	Status string
+	Height int64 // The miner's tip height
+
+	// Confirmed transactions
+	BlockHeight   int64
+	BlockHash     string
+	Confirmations int64 // Blocks from the including one to the tip, both included
+
+	// Pending transactions
+	Fee     int64
+	FeeRate float64 // Satoshi per byte of mempool.Size
+	Pending time.Duration
+
+	Reason string // Why a transaction was dropped
+}
+
+// TxStatus reports whether a transaction is pending, confirmed and how
+// deeply, or was dropped. Dropped transactions are recognized by the
+// journal, so a miner only reports those it saw within its last
+// maxJournalEvents events.
+func (m *Miner) TxStatus(txID string) TxStatusReply {
+	tip := m.Blockchain.GetLatestBlock()
+	reply := TxStatusReply{TxID: txID, Height: tip.Index}
+	if tx, loc := m.Blockchain.GetTransaction(txID); tx != nil {
+		reply.Status = TxConfirmed
+		reply.BlockHeight = loc.BlockHeight
+		reply.BlockHash = loc.BlockHash
+		reply.Confirmations = tip.Index - loc.BlockHeight + 1
+		return reply
+	}
+	if e, ok := m.mempool.Get(txID); ok {
+		reply.Status = TxPending
+		reply.Fee = e.Fee
+		reply.FeeRate = e.FeeRate()
+		reply.Pending = time.Since(e.Arrival)
+		return reply
+	}
+
+	events := m.TxJournal(TxJournalArgs{TxID: txID})
+	if len(events) == 0 {
+		reply.Status = TxUnknown
+		return reply
+	}
+	reply.Status = TxDropped
+	reply.Reason = dropReason(events)
+	return reply
+}
+
+// dropReason explains, from its journal events, why a transaction that is
+// neither pending nor confirmed is gone
+func dropReason(events []JournalEvent) string {
+	for i := len(events) - 1; i >= 0; i-- {
+		switch e := events[i]; e.Kind {
+		case JournalDropped, JournalRejected:
+			return e.Detail
+		case JournalMined, JournalConfirmed:
+			return fmt.Sprintf("its block at height %d left the main chain", e.Height)
+		}
+	}
+	return "no longer pending"
+}
+
+// GetTxStatus RPC method to follow a submitted transaction until it is
+// confirmed or dropped
+func (s *RPCService) GetTxStatus(args *TxQueryArgs, reply *TxStatusReply) error {
+	*reply = s.miner.TxStatus(args.TxID)
+	return nil
+}
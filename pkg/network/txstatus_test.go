@@ -0,0 +1,80 @@
+package network
+
+import (
+	"blockchain/pkg/transaction"
+	"testing"
+)
+
+func TestTxStatusFollowsTransaction(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	genesis := miner.Blockchain.GetLatestBlock()
+	service := &RPCService{miner: miner}
+	status := func(txID string) TxStatusReply {
+		var reply TxStatusReply
+		service.GetTxStatus(&TxQueryArgs{TxID: txID}, &reply)
+		return reply
+	}
+
+	if s := status("nonexistent"); s.Status != TxUnknown {
+		t.Errorf("Expected an unseen transaction to be unknown, got %+v", s)
+	}
+
+	tx := fundedTransactions(t, miner, []int64{40})[0]
+	if err := miner.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if s := status(tx.ID); s.Status != TxPending || s.Fee != 40 || s.FeeRate <= 0 {
+		t.Errorf("Expected a pending transaction paying 40, got %+v", s)
+	}
+
+	miner.mineBlock()
+	miner.mineBlock()
+	s := status(tx.ID)
+	if s.Status != TxConfirmed || s.BlockHeight != 1 || s.Confirmations != 2 || s.Height != 2 {
+		t.Fatalf("Expected confirmation at height 1 with 2 confirmations, got %+v", s)
+	}
+
+	// A longer rival branch from genesis drops the block holding it, which
+	// returns it to the mempool
+	for _, b := range grindBlocks(genesis, 3, "rival", miner.Blockchain.GetDifficulty()) {
+		data, _ := b.Serialize()
+		service.ReceiveBlock(&BlockArgs{BlockData: data}, &BlockReply{})
+	}
+	if s := status(tx.ID); s.Status != TxPending || s.Fee != 40 {
+		t.Errorf("Expected the transaction pending again after the reorg, got %+v", s)
+	}
+}
+
+func TestTxStatusReportsReplacement(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	kp, _ := transaction.GenerateKeyPair()
+	coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 10000, 100)
+	miner.Blockchain.UTXOSet.ProcessTransaction(coinbase)
+	spend := func(fee int64) *transaction.Transaction {
+		tx, err := miner.Blockchain.GetUTXOSet().CreateTransaction(
+			[]struct {
+				TxID     string
+				OutIndex int
+			}{{TxID: coinbase.ID, OutIndex: 0}},
+			[]transaction.TxOutput{{Value: 10000 - fee, ScriptPubKey: "bob"}},
+			map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create transaction: %v", err)
+		}
+		return tx
+	}
+
+	first, bump := spend(100), spend(500)
+	miner.AddTransaction(first)
+	if err := miner.AddTransaction(bump); err != nil {
+		t.Fatalf("Expected the higher-fee spend to replace the first: %v", err)
+	}
+	s := miner.TxStatus(first.ID)
+	if s.Status != TxDropped || s.Reason != "replaced by "+bump.ID {
+		t.Errorf("Expected the first spend dropped as replaced, got %+v", s)
+	}
+	if s := miner.TxStatus(bump.ID); s.Status != TxPending {
+		t.Errorf("Expected the replacement pending, got %+v", s)
+	}
+}
@@ -0,0 +1,191 @@
+package network
+
+import (
+	"blockchain/pkg/logging"
+	"blockchain/pkg/resource"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWatchdogInterval is how often the resource watchdog samples the host
+	DefaultWatchdogInterval = 10 * time.Second
+
+	// maxResourceAlerts bounds the alert history kept for GetResourceStatus
+	maxResourceAlerts = 50
+)
+
+var ErrResourcePressure = errors.New("node paused under resource pressure")
+
+// WatchdogConfig sets when the miner pauses for lack of resources
+type WatchdogConfig struct {
+	Path       string // Directory whose filesystem is watched, usually the datadir ("" = memory only)
+	Thresholds resource.Thresholds
+	Interval   time.Duration // How often to sample (default DefaultWatchdogInterval)
+}
+
+// ResourceAlert records the miner pausing for, or recovering from, resource pressure
+type ResourceAlert struct {
+	Time     time.Time
+	Message  string
+	Resolved bool // Set on the alert that the pressure cleared
+}
+
+// ResourceStatusReply reports the watchdog's latest sample and decisions
+type ResourceStatusReply struct {
+	Enabled    bool
+	Usage      resource.Usage
+	Thresholds resource.Thresholds
+	Paused     bool
+	Reasons    []string        // Resources below their thresholds
+	Alerts     []ResourceAlert // Recent alerts, oldest first
+}
+
+// WithWatchdog pauses mining and transaction acceptance while free disk space
+// or available memory is below the configured thresholds, so a full disk
+// cannot corrupt the datadir mid-write. Both resume once pressure clears.
+func WithWatchdog(cfg WatchdogConfig) MinerOption {
+	return func(o *MinerOptions) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = DefaultWatchdogInterval
+		}
+		o.Watchdog = &cfg
+	}
+}
+
+// watchdog is the resource watchdog's state, guarded by watchMutex
+type watchdog struct {
+	probe   func() (resource.Usage, error)
+	usage   resource.Usage
+	reasons []string
+	resume  bool // Mining was on when paused, or was requested while paused
+	alerts  []ResourceAlert
+}
+
+// newWatchdog returns the watchdog for the miner's options, or nil if disabled
+func newWatchdog(cfg *WatchdogConfig) *watchdog {
+	if cfg == nil {
+		return nil
+	}
+	return &watchdog{probe: func() (resource.Usage, error) { return resource.Sample(cfg.Path) }}
+}
+
+// resourcePressure returns why the miner is paused, or "" if it is not
+func (m *Miner) resourcePressure() string {
+	if m.watchdog == nil {
+		return ""
+	}
+	m.watchMutex.Lock()
+	defer m.watchMutex.Unlock()
+	return strings.Join(m.watchdog.reasons, ", ")
+}
+
+// checkPressure returns ErrResourcePressure while the miner is paused
+func (m *Miner) checkPressure() error {
+	if reason := m.resourcePressure(); reason != "" {
+		return fmt.Errorf("%w: %s", ErrResourcePressure, reason)
+	}
+	return nil
+}
+
+// CheckResources samples the host and pauses or resumes the miner as needed
+func (m *Miner) CheckResources() {
+	w := m.watchdog
+	if w == nil {
+		return
+	}
+	usage, err := w.probe()
+	if err != nil && !errors.Is(err, resource.ErrUnsupported) {
+		logging.Warnf("[%s] WATCHDOG: failed to sample resources: %v", shortID(m.ID), err)
+	}
+	reasons := m.options.Watchdog.Thresholds.Pressure(usage)
+
+	m.watchMutex.Lock()
+	wasPaused := len(w.reasons) > 0
+	w.usage, w.reasons = usage, reasons
+	paused := len(reasons) > 0
+	var resume bool
+	switch {
+	case paused && !wasPaused:
+		w.resume = m.IsMining()
+		w.alert(ResourceAlert{Message: "paused mining and transaction relay: " + strings.Join(reasons, ", ")})
+	case !paused && wasPaused:
+		resume, w.resume = w.resume, false
+		w.alert(ResourceAlert{Message: "resource pressure cleared, resuming", Resolved: true})
+	}
+	m.watchMutex.Unlock()
+
+	switch {
+	case paused && !wasPaused:
+		logging.Warnf("[%s] WATCHDOG ALERT: %s; pausing mining and transaction relay", shortID(m.ID), strings.Join(reasons, ", "))
+		m.StopMining()
+	case !paused && wasPaused:
+		log.Printf("[%s] WATCHDOG: resource pressure cleared; resuming", shortID(m.ID))
+		if resume {
+			m.StartMining()
+		}
+	}
+}
+
+// alert records a in the bounded history. Callers hold watchMutex.
+func (w *watchdog) alert(a ResourceAlert) {
+	a.Time = time.Now()
+	w.alerts = append(w.alerts, a)
+	if len(w.alerts) > maxResourceAlerts {
+		w.alerts = w.alerts[len(w.alerts)-maxResourceAlerts:]
+	}
+}
+
+// deferMining notes a request to mine while paused, to be honored on
+// recovery. It reports false if the miner is not paused.
+func (m *Miner) deferMining() bool {
+	if m.watchdog == nil {
+		return false
+	}
+	m.watchMutex.Lock()
+	defer m.watchMutex.Unlock()
+	if len(m.watchdog.reasons) == 0 {
+		return false
+	}
+	m.watchdog.resume = true
+	return true
+}
+
+// ResourceStatus returns the watchdog's latest sample, pause state, and alerts
+func (m *Miner) ResourceStatus() ResourceStatusReply {
+	if m.watchdog == nil {
+		return ResourceStatusReply{}
+	}
+	m.watchMutex.Lock()
+	defer m.watchMutex.Unlock()
+	w := m.watchdog
+	return ResourceStatusReply{
+		Enabled:    true,
+		Usage:      w.usage,
+		Thresholds: m.options.Watchdog.Thresholds,
+		Paused:     len(w.reasons) > 0,
+		Reasons:    append([]string(nil), w.reasons...),
+		Alerts:     append([]ResourceAlert(nil), w.alerts...),
+	}
+}
+
+// watchdogLoop runs CheckResources periodically until the miner stops
+func (m *Miner) watchdogLoop() {
+	for {
+		m.CheckResources()
+		select {
+		case <-m.done:
+			return
+		case <-time.After(m.options.Watchdog.Interval):
+		}
+	}
+}
+
+// GetResourceStatus RPC method to report the resource watchdog's state
+func (s *RPCService) GetResourceStatus(args *struct{}, reply *ResourceStatusReply) error {
+	*reply = s.miner.ResourceStatus()
+	return nil
+}
@@ -0,0 +1,74 @@
+package network
+
+import (
+	"blockchain/pkg/resource"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWatchdogPausesAndResumes(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithWatchdog(WatchdogConfig{
+		Thresholds: resource.Thresholds{MinDiskFree: 100 << 20},
+	}))
+	usage := resource.Usage{DiskFree: 1 << 30}
+	miner.watchdog.probe = func() (resource.Usage, error) { return usage, nil }
+
+	miner.StartMining()
+	defer miner.StopMining()
+	miner.CheckResources()
+	if !miner.IsMining() || miner.resourcePressure() != "" {
+		t.Fatal("Miner should keep mining with enough disk space")
+	}
+
+	// Disk space runs low: mining stops and transactions are refused
+	usage.DiskFree = 10 << 20
+	miner.CheckResources()
+	if miner.IsMining() {
+		t.Error("Mining should pause under disk pressure")
+	}
+	if reason := miner.resourcePressure(); !strings.Contains(reason, "disk free") {
+		t.Errorf("Expected a disk pressure reason, got %q", reason)
+	}
+	service := &RPCService{miner: miner}
+	var reply TransactionReply
+	service.ReceiveTransaction(&BlockArgs{BlockData: []byte("{}")}, &reply)
+	if reply.Success || !strings.Contains(reply.Error, ErrResourcePressure.Error()) {
+		t.Errorf("Relayed transactions should be refused while paused, got %+v", reply)
+	}
+	if err := miner.checkPressure(); !errors.Is(err, ErrResourcePressure) {
+		t.Errorf("Expected ErrResourcePressure, got %v", err)
+	}
+
+	// Asking to mine while paused waits for the pressure to clear
+	miner.StartMining()
+	if miner.IsMining() {
+		t.Error("Mining should not start while paused")
+	}
+
+	usage.DiskFree = 1 << 30
+	miner.CheckResources()
+	if !miner.IsMining() || miner.checkPressure() != nil {
+		t.Error("Mining should resume once pressure clears")
+	}
+
+	status := miner.ResourceStatus()
+	if !status.Enabled || status.Paused || len(status.Alerts) != 2 || !status.Alerts[1].Resolved {
+		t.Errorf("Expected a pause and a resolved alert, got %+v", status)
+	}
+}
+
+func TestWatchdogResumesOnlyIfMining(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil, WithWatchdog(WatchdogConfig{
+		Thresholds: resource.Thresholds{MinMemAvailable: 64 << 20},
+	}))
+	usage := resource.Usage{MemAvailable: 1 << 20}
+	miner.watchdog.probe = func() (resource.Usage, error) { return usage, nil }
+
+	miner.CheckResources()
+	usage.MemAvailable = 1 << 30
+	miner.CheckResources()
+	if miner.IsMining() {
+		t.Error("An idle miner should stay idle after pressure clears")
+	}
+}
@@ -0,0 +1,172 @@
+package network
+
+import (
+	"blockchain/pkg/transaction"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTemplateRefresh is how long a mining round keeps its block template
+// before transactions that arrived since may replace it
+const DefaultTemplateRefresh = 5 * time.Second
+
+// WithTemplateRefresh sets how long a mining round keeps its block template
+// before rebuilding it, if transactions paying more fees have arrived since
+// (0 = never; a round then mines the transactions pending when it started)
+func WithTemplateRefresh(d time.Duration) MinerOption {
+	return func(o *MinerOptions) {
+		o.TemplateRefresh = d
+	}
+}
+
+// restartReason says why a mining round's hashing work was thrown away
+type restartReason int
+
+const (
+	restartNewTip    restartReason = iota // Another block extended or replaced the tip first
+	restartTemplate                       // The block was rejected on the unchanged tip
+	restartCancelled                      // Mining was stopped mid-round
+	restartRefresh                        // The template was rebuilt to include new transactions
+)
+
+// workMeter tallies hashing work kept in accepted blocks versus work discarded
+type workMeter struct {
+	mu       sync.Mutex
+	useful   int64
+	wasted   [4]int64 // Hashes discarded, indexed by restartReason
+	restarts [4]int64 // Rounds discarded, indexed by restartReason
+}
+
+// accept records the hashes of a round whose block joined the chain
+func (w *workMeter) accept(hashes int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.useful += hashes
+}
+
+// discard records the hashes of a round whose work was thrown away
+func (w *workMeter) discard(reason restartReason, hashes int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wasted[reason] += hashes
+	w.restarts[reason]++
+}
+
+// tipChanged returns a channel that is closed the next time a block from
+// another miner changes the tip, so a round mining on the old tip can stop
+func (m *Miner) tipChanged() <-chan struct{} {
+	m.tipMutex.Lock()
+	defer m.tipMutex.Unlock()
+	return m.newTip
+}
+
+// notifyNewTip wakes every round waiting on tipChanged
+func (m *Miner) notifyNewTip() {
+	m.tipMutex.Lock()
+	defer m.tipMutex.Unlock()
+	close(m.newTip)
+	m.newTip = make(chan struct{})
+}
+
+// txArrived returns a channel that is closed the next time a transaction
+// enters the mempool, so a round can consider refreshing its template
+func (m *Miner) txArrived() <-chan struct{} {
+	m.tipMutex.Lock()
+	defer m.tipMutex.Unlock()
+	return m.newTx
+}
+
+// notifyNewTx wakes every round waiting on txArrived
+func (m *Miner) notifyNewTx() {
+	m.tipMutex.Lock()
+	defer m.tipMutex.Unlock()
+	close(m.newTx)
+	m.newTx = make(chan struct{})
+}
+
+// watchTemplate waits until the round mining txs should rebuild its template:
+// once the miner's TemplateRefresh has passed and a transaction has arrived
+// that a fresh template would pay more fees for. It returns false if done is
+// closed first, and never returns true with refreshing disabled.
+func (m *Miner) watchTemplate(txs []*transaction.Transaction, done <-chan struct{}) bool {
+	interval := m.options.TemplateRefresh
+	if interval <= 0 {
+		<-done
+		return false
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+		return false
+	}
+
+	// Anything pending now was passed over when the template was built, or
+	// arrived since; check once, then on each arrival
+	for {
+		arrived := m.txArrived()
+		if m.templateFees() > txs[0].TotalOutputValue() {
+			return true
+		}
+		select {
+		case <-arrived:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// templateFees returns what the coinbase of a template built now would claim
+func (m *Miner) templateFees() int64 {
+	_, txs := m.assembleBlock()
+	return txs[0].TotalOutputValue()
+}
+
+// WorkStatsReply reports how much of the miner's hashing went into accepted blocks
+type WorkStatsReply struct {
+	AcceptedBlocks   int64   // Blocks this miner mined and added to its chain
+	UsefulHashes     int64   // Hashes spent on rounds that produced an accepted block
+	WastedHashes     int64   // Hashes spent on rounds that were discarded, for any reason
+	NewTipHashes     int64   // Discarded because another block extended or replaced the tip first
+	TemplateHashes   int64   // Discarded because the block was rejected on the unchanged tip
+	CancelledHashes  int64   // Discarded because mining was stopped mid-round
+	NewTipRestarts   int64   // Rounds discarded for a new tip
+	TemplateRestarts int64   // Rounds discarded for a rejected template
+	CancelRestarts   int64   // Rounds discarded by cancellation
+	RefreshHashes    int64   // Discarded because the template was rebuilt to include new transactions
+	RefreshRestarts  int64   // Rounds discarded for a refreshed template
+	WastedPerBlock   float64 // WastedHashes per accepted block (0 until a block is accepted)
+}
+
+// WorkStats returns the miner's useful and discarded hashing work so far
+func (m *Miner) WorkStats() WorkStatsReply {
+	w := &m.workMeter
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	reply := WorkStatsReply{
+		AcceptedBlocks:   atomic.LoadInt64(&m.blocksMined),
+		UsefulHashes:     w.useful,
+		NewTipHashes:     w.wasted[restartNewTip],
+		TemplateHashes:   w.wasted[restartTemplate],
+		CancelledHashes:  w.wasted[restartCancelled],
+		NewTipRestarts:   w.restarts[restartNewTip],
+		TemplateRestarts: w.restarts[restartTemplate],
+		CancelRestarts:   w.restarts[restartCancelled],
+		RefreshHashes:    w.wasted[restartRefresh],
+		RefreshRestarts:  w.restarts[restartRefresh],
+	}
+	reply.WastedHashes = reply.NewTipHashes + reply.TemplateHashes + reply.CancelledHashes + reply.RefreshHashes
+	if reply.AcceptedBlocks > 0 {
+		reply.WastedPerBlock = float64(reply.WastedHashes) / float64(reply.AcceptedBlocks)
+	}
+	return reply
+}
+
+// GetWorkStats RPC method to report useful versus discarded hashing work
+func (s *RPCService) GetWorkStats(args *struct{}, reply *WorkStatsReply) error {
+	*reply = s.miner.WorkStats()
+	return nil
+}
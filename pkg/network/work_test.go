@@ -0,0 +1,160 @@
+package network
+
+import (
+	"blockchain/pkg/blockchain"
+	"testing"
+	"time"
+)
+
+func TestWorkStatsCountsAcceptedRounds(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 8, nil)
+	miner.mineBlock()
+	miner.mineBlock()
+
+	var stats WorkStatsReply
+	(&RPCService{miner: miner}).GetWorkStats(&struct{}{}, &stats)
+	if stats.AcceptedBlocks != 2 {
+		t.Errorf("Expected 2 accepted blocks, got %d", stats.AcceptedBlocks)
+	}
+	if stats.UsefulHashes <= 0 {
+		t.Errorf("Useful hashes should be positive after mining, got %d", stats.UsefulHashes)
+	}
+	if stats.WastedHashes != 0 || stats.WastedPerBlock != 0 {
+		t.Errorf("No work should be wasted by uncontested rounds: %+v", stats)
+	}
+}
+
+func TestWorkStatsCountsCancelledRound(t *testing.T) {
+	// Unreachable difficulty, so the round only ends when mining stops
+	miner := NewMiner("miner1", "localhost:0", 64, nil)
+	miner.StartMining()
+	miner.StopMining()
+	miner.mineBlock()
+
+	stats := miner.WorkStats()
+	if stats.CancelRestarts < 1 {
+		t.Fatalf("Expected a cancelled round, got %+v", stats)
+	}
+	if stats.AcceptedBlocks != 0 || stats.UsefulHashes != 0 {
+		t.Errorf("Cancelled rounds should not count as useful work: %+v", stats)
+	}
+	if stats.WastedHashes != stats.CancelledHashes {
+		t.Errorf("Wasted hashes %d should all be cancelled hashes %d", stats.WastedHashes, stats.CancelledHashes)
+	}
+}
+
+func TestWorkStatsWastedPerBlock(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 2, nil)
+	miner.workMeter.discard(restartNewTip, 300)
+	miner.workMeter.discard(restartNewTip, 200)
+	miner.workMeter.discard(restartTemplate, 100)
+	miner.workMeter.accept(50)
+	miner.blocksMined = 2
+
+	stats := miner.WorkStats()
+	if stats.NewTipHashes != 500 || stats.NewTipRestarts != 2 {
+		t.Errorf("Expected 500 hashes over 2 new-tip restarts, got %d over %d", stats.NewTipHashes, stats.NewTipRestarts)
+	}
+	if stats.TemplateHashes != 100 || stats.TemplateRestarts != 1 {
+		t.Errorf("Expected 100 hashes over 1 template restart, got %d over %d", stats.TemplateHashes, stats.TemplateRestarts)
+	}
+	if stats.WastedHashes != 600 {
+		t.Errorf("Expected 600 wasted hashes, got %d", stats.WastedHashes)
+	}
+	if stats.WastedPerBlock != 300 {
+		t.Errorf("Expected 300 wasted hashes per block, got %f", stats.WastedPerBlock)
+	}
+}
+
+func TestNewTipAbandonsRound(t *testing.T) {
+	// Unreachable difficulty, so the round only ends when the tip changes
+	miner := NewMiner("miner1", "localhost:0", 64, nil)
+	done := make(chan struct{})
+	go func() {
+		miner.mineBlock()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	miner.notifyNewTip()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mining should stop when the tip changes")
+	}
+
+	stats := miner.WorkStats()
+	if stats.NewTipRestarts != 1 || stats.CancelRestarts != 0 {
+		t.Errorf("Expected one new-tip restart, got %+v", stats)
+	}
+}
+
+func TestReceivedBlockSignalsNewTip(t *testing.T) {
+	peer := NewMiner("peer", "localhost:0", 1, nil)
+	miner := NewMiner("miner1", "localhost:0", 1, nil)
+	miner.Blockchain = blockchain.NewBlockchainFromBlocks(peer.Blockchain.GetBlocks(), 1)
+	newTip := miner.tipChanged()
+
+	peer.mineBlock()
+	data, _ := peer.Blockchain.GetLatestBlock().Serialize()
+	var reply BlockReply
+	(&RPCService{miner: miner}).ReceiveBlock(&BlockArgs{BlockData: data}, &reply)
+	if !reply.Success {
+		t.Fatalf("Block should be accepted: %s", reply.Error)
+	}
+	select {
+	case <-newTip:
+	default:
+		t.Error("Accepting a peer's block should signal a new tip")
+	}
+}
+
+func TestTemplateRefreshesForNewTransactions(t *testing.T) {
+	// Unreachable difficulty, so the round only ends when it is abandoned
+	miner := NewMiner("miner1", "localhost:0", 64, nil, WithTemplateRefresh(100*time.Millisecond))
+	txs := fundedTransactions(t, miner, []int64{500})
+	done := make(chan struct{})
+	go func() {
+		miner.mineBlock()
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := miner.AddTransaction(txs[0]); err != nil {
+		t.Fatalf("Failed to add transaction: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("A transaction paying fees should refresh the template")
+	}
+
+	stats := miner.WorkStats()
+	if stats.RefreshRestarts != 1 || stats.WastedHashes != stats.RefreshHashes {
+		t.Errorf("Expected one refresh restart, got %+v", stats)
+	}
+	if _, next := miner.assembleBlock(); len(next) != 2 || next[1].ID != txs[0].ID {
+		t.Error("The next template should include the new transaction")
+	}
+}
+
+func TestTemplateKeptWithoutBetterTransactions(t *testing.T) {
+	miner := NewMiner("miner1", "localhost:0", 64, nil, WithTemplateRefresh(20*time.Millisecond))
+	txs := fundedTransactions(t, miner, []int64{0})
+	done := make(chan struct{})
+	go func() {
+		miner.mineBlock()
+		close(done)
+	}()
+
+	// A transaction paying no fee does not improve the template
+	miner.AddTransaction(txs[0])
+	time.Sleep(100 * time.Millisecond)
+	miner.notifyNewTip()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mining should stop when the tip changes")
+	}
+	if stats := miner.WorkStats(); stats.RefreshRestarts != 0 || stats.NewTipRestarts != 1 {
+		t.Errorf("Expected the round kept until the new tip, got %+v", stats)
+	}
+}
@@ -0,0 +1,130 @@
+// Package policy implements optional, node-local transaction policies. They
+// only control what a node relays and mines; blocks mined by others are still
+// accepted under consensus rules alone.
+package policy
+
+import (
+	"blockchain/pkg/transaction"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+var ErrBlacklisted = errors.New("transaction touches a blacklisted entry")
+
+// UTXOLookup resolves an input reference to the output it spends
+type UTXOLookup func(txID string, outIndex int) *transaction.UTXO
+
+// BlacklistEntries lists blacklisted addresses and transaction IDs
+type BlacklistEntries struct {
+	Addresses    []string `json:"addresses"`
+	Transactions []string `json:"transactions"`
+}
+
+// Blacklist refuses transactions that pay to or spend from listed addresses,
+// are themselves listed, or spend outputs of listed transactions
+type Blacklist struct {
+	addresses map[string]bool
+	txids     map[string]bool
+	mu        sync.RWMutex
+}
+
+// NewBlacklist creates an empty blacklist
+func NewBlacklist() *Blacklist {
+	return &Blacklist{
+		addresses: make(map[string]bool),
+		txids:     make(map[string]bool),
+	}
+}
+
+// LoadBlacklist reads blacklist entries from a JSON file
+func LoadBlacklist(path string) (*Blacklist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blacklist: %v", err)
+	}
+	var entries BlacklistEntries
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse blacklist: %v", err)
+	}
+	b := NewBlacklist()
+	b.Add(entries)
+	return b, nil
+}
+
+// Add blacklists the given addresses and transactions
+func (b *Blacklist) Add(entries BlacklistEntries) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, addr := range entries.Addresses {
+		b.addresses[addr] = true
+	}
+	for _, id := range entries.Transactions {
+		b.txids[id] = true
+	}
+}
+
+// Remove lifts the given addresses and transactions from the blacklist
+func (b *Blacklist) Remove(entries BlacklistEntries) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, addr := range entries.Addresses {
+		delete(b.addresses, addr)
+	}
+	for _, id := range entries.Transactions {
+		delete(b.txids, id)
+	}
+}
+
+// Entries returns the current blacklist in sorted order
+func (b *Blacklist) Entries() BlacklistEntries {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entries := BlacklistEntries{
+		Addresses:    make([]string, 0, len(b.addresses)),
+		Transactions: make([]string, 0, len(b.txids)),
+	}
+	for addr := range b.addresses {
+		entries.Addresses = append(entries.Addresses, addr)
+	}
+	for id := range b.txids {
+		entries.Transactions = append(entries.Transactions, id)
+	}
+	sort.Strings(entries.Addresses)
+	sort.Strings(entries.Transactions)
+	return entries
+}
+
+// Check returns an error describing why tx is filtered, or nil if it is allowed.
+// lookup may be nil, in which case spent-from addresses are not checked.
+func (b *Blacklist) Check(tx *transaction.Transaction, lookup UTXOLookup) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.txids[tx.ID] {
+		return fmt.Errorf("%w: transaction %s is blacklisted", ErrBlacklisted, tx.ID)
+	}
+	for i, out := range tx.Outputs {
+		if b.addresses[out.ScriptPubKey] {
+			return fmt.Errorf("%w: output %d pays blacklisted address %s", ErrBlacklisted, i, out.ScriptPubKey)
+		}
+	}
+	if tx.IsCoinbase() {
+		return nil
+	}
+	for i, in := range tx.Inputs {
+		if b.txids[in.TxID] {
+			return fmt.Errorf("%w: input %d spends blacklisted transaction %s", ErrBlacklisted, i, in.TxID)
+		}
+		if lookup == nil {
+			continue
+		}
+		if utxo := lookup(in.TxID, in.OutIndex); utxo != nil && b.addresses[utxo.ScriptPubKey] {
+			return fmt.Errorf("%w: input %d spends from blacklisted address %s", ErrBlacklisted, i, utxo.ScriptPubKey)
+		}
+	}
+	return nil
+}
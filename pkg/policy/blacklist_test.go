@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"blockchain/pkg/transaction"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlacklistCheck(t *testing.T) {
+	b := NewBlacklist()
+	b.Add(BlacklistEntries{Addresses: []string{"mallory"}, Transactions: []string{"badtx"}})
+
+	utxos := map[string]*transaction.UTXO{
+		"fromMallory": {TxID: "fromMallory", Value: 10, ScriptPubKey: "mallory"},
+		"fromAlice":   {TxID: "fromAlice", Value: 10, ScriptPubKey: "alice"},
+	}
+	lookup := func(txID string, outIndex int) *transaction.UTXO { return utxos[txID] }
+
+	tests := []struct {
+		name    string
+		input   string
+		payee   string
+		blocked bool
+	}{
+		{"clean", "fromAlice", "bob", false},
+		{"pays blacklisted address", "fromAlice", "mallory", true},
+		{"spends from blacklisted address", "fromMallory", "bob", true},
+		{"spends blacklisted transaction", "badtx", "bob", true},
+	}
+	for _, tt := range tests {
+		tx := transaction.NewUTXOTransaction(
+			[]transaction.TxInput{{TxID: tt.input, OutIndex: 0, ScriptSig: "sig"}},
+			[]transaction.TxOutput{{Value: 10, ScriptPubKey: tt.payee}},
+		)
+		tx.ID = tx.CalculateHash()
+		err := b.Check(tx, lookup)
+		if blocked := errors.Is(err, ErrBlacklisted); blocked != tt.blocked {
+			t.Errorf("%s: expected blocked=%v, got %v", tt.name, tt.blocked, err)
+		}
+	}
+}
+
+func TestBlacklistAddRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+	os.WriteFile(path, []byte(`{"addresses": ["b", "a"], "transactions": ["t1"]}`), 0644)
+
+	b, err := LoadBlacklist(path)
+	if err != nil {
+		t.Fatalf("Failed to load blacklist: %v", err)
+	}
+	entries := b.Entries()
+	if len(entries.Addresses) != 2 || entries.Addresses[0] != "a" || len(entries.Transactions) != 1 {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+
+	b.Remove(BlacklistEntries{Addresses: []string{"a"}, Transactions: []string{"t1"}})
+	entries = b.Entries()
+	if len(entries.Addresses) != 1 || len(entries.Transactions) != 0 {
+		t.Errorf("Entries should be removed: %+v", entries)
+	}
+}
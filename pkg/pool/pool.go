@@ -0,0 +1,312 @@
+// Package pool runs a mining pool for one node. Workers hash the node's block
+// templates at a lower share difficulty and submit every share they find; a
+// share that also meets the block's difficulty is submitted to the node. Each
+// block's reward is split among the shares of the round that found it, in
+// proportion to how many each worker submitted. The coinbase still pays the
+// node's address: the pool keeps the books, and the operator pays out from
+// them.
+//
+//	p := pool.New(pool.Node{Client: &network.Client{}, Address: "localhost:8001"}, 0, pool.DefaultRefresh)
+//	go p.Serve(listener)
+//	pool.Work(ctx, listener.Addr().String(), "alice", 4, pool.DefaultRefresh, nil)
+package pool
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/logging"
+	"blockchain/pkg/network"
+	"blockchain/pkg/pow"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRefresh is how long a job is handed out before the pool fetches
+	// a new template, so new transactions and tips are picked up
+	DefaultRefresh = network.DefaultTemplateRefresh
+
+	// DefaultShareBits is how many fewer leading zero bits a share needs
+	// than a block, when the pool's share difficulty is not set: a worker
+	// then submits about 16 shares per block it finds
+	DefaultShareBits = 4
+
+	// maxJobs is how many jobs on the current tip are kept for late shares
+	maxJobs = 8
+)
+
+var (
+	ErrUnknownJob     = errors.New("unknown or stale job")
+	ErrLowShare       = errors.New("share does not meet the share difficulty")
+	ErrDuplicateShare = errors.New("share already submitted")
+)
+
+// Upstream is the node a pool mines for
+type Upstream interface {
+	GetBlockTemplate() (*network.BlockTemplateReply, error)
+	SubmitBlock(templateID string, nonce int64) (*network.SubmitBlockReply, error)
+}
+
+// Node is the upstream of a pool mining for the miner at Address
+type Node struct {
+	Client  *network.Client
+	Address string
+}
+
+func (n Node) GetBlockTemplate() (*network.BlockTemplateReply, error) {
+	return n.Client.GetBlockTemplate(n.Address)
+}
+
+func (n Node) SubmitBlock(templateID string, nonce int64) (*network.SubmitBlockReply, error) {
+	return n.Client.SubmitBlock(n.Address, templateID, nonce)
+}
+
+// Job is a block for workers to hash: they look for nonces whose block hash
+// has ShareDifficulty leading zero bits, and submit each with the job's ID
+type Job struct {
+	ID              string // The template's ID at the node
+	Height          int64
+	Difficulty      int    // Leading zero bits a block needs
+	ShareDifficulty int    // Leading zero bits a share needs
+	BlockData       []byte // The block with nonce 0, JSON encoded
+}
+
+// job is a Job with what the pool needs to check its shares
+type job struct {
+	Job
+	block   *block.Block
+	reward  int64 // Subsidy and fees the coinbase collects
+	fetched time.Time
+	nonces  map[int64]bool // Shares submitted
+}
+
+// ShareResult reports what a share was worth
+type ShareResult struct {
+	Block  bool   // The share solved the block and the node accepted it
+	Hash   string // The share's block hash
+	Height int64
+	Error  string // Why the node refused a share that met the block's difficulty
+}
+
+// WorkerStats is a worker's account with the pool
+type WorkerStats struct {
+	Name        string
+	Shares      int64 // Shares accepted
+	RoundShares int64 // Shares since the last block, which will split the next reward
+	Blocks      int   // Blocks its shares solved
+	Earned      int64 // Reward owed from the rounds it took part in
+}
+
+// FoundBlock is a block the pool's workers found
+type FoundBlock struct {
+	Height int64
+	Hash   string
+	Worker string
+	Reward int64
+	Shares int64 // Shares of the round it ended
+}
+
+// Stats is the pool's books
+type Stats struct {
+	Upstream        string
+	ShareDifficulty int // Configured; 0 = DefaultShareBits below each block's
+	Height          int64
+	Shares          int64
+	Stale           int64 // Shares for unknown or stale jobs
+	Workers         []WorkerStats
+	Blocks          []FoundBlock
+}
+
+// Pool hands out jobs from its upstream, checks and counts the shares workers
+// submit, and splits each block's reward among its round's shares
+type Pool struct {
+	upstream        Upstream
+	shareDifficulty int
+	refresh         time.Duration
+
+	mu      sync.Mutex
+	jobs    []*job // On the current tip, newest last
+	workers map[string]*WorkerStats
+	shares  int64
+	stale   int64
+	blocks  []FoundBlock
+}
+
+// New creates a pool mining for upstream. shareDifficulty is the leading zero
+// bits a share needs (0 = DefaultShareBits fewer than the block); a new
+// template is fetched once a job is older than refresh.
+func New(upstream Upstream, shareDifficulty int, refresh time.Duration) *Pool {
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	return &Pool{
+		upstream:        upstream,
+		shareDifficulty: shareDifficulty,
+		refresh:         refresh,
+		workers:         make(map[string]*WorkerStats),
+	}
+}
+
+// Job returns the job workers should hash, fetching a new template from the
+// upstream if the current job is older than the pool's refresh
+func (p *Pool) Job() (*Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.jobs); n > 0 && time.Since(p.jobs[n-1].fetched) < p.refresh {
+		j := p.jobs[n-1].Job
+		return &j, nil
+	}
+	j, err := p.fetchJob()
+	if err != nil {
+		return nil, err
+	}
+	job := j.Job
+	return &job, nil
+}
+
+// fetchJob fetches a template and makes it the current job, dropping jobs on
+// an earlier tip. p.mu must be held.
+func (p *Pool) fetchJob() (*job, error) {
+	tmpl, err := p.upstream.GetBlockTemplate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block template: %v", err)
+	}
+	b, err := block.DeserializeBlock(tmpl.BlockData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block template: %v", err)
+	}
+	share := p.shareDifficulty
+	if share <= 0 {
+		share = b.Difficulty - DefaultShareBits
+	}
+	share = max(1, min(share, b.Difficulty))
+	j := &job{
+		Job:     Job{ID: tmpl.TemplateID, Height: b.Index, Difficulty: b.Difficulty, ShareDifficulty: share, BlockData: tmpl.BlockData},
+		block:   b,
+		reward:  b.Transactions[0].TotalOutputValue(),
+		fetched: time.Now(),
+		nonces:  make(map[int64]bool),
+	}
+
+	kept := p.jobs[:0]
+	for _, old := range p.jobs {
+		if old.block.PrevHash == b.PrevHash && old.ID != j.ID {
+			kept = append(kept, old)
+		}
+	}
+	p.jobs = append(kept, j)
+	if len(p.jobs) > maxJobs {
+		p.jobs = p.jobs[len(p.jobs)-maxJobs:]
+	}
+	return j, nil
+}
+
+// Submit checks a share worker found for the job with jobID and credits it.
+// A share that solves the block is submitted to the upstream; if accepted,
+// the round's reward is split among its shares and a new round begins.
+func (p *Pool) Submit(worker, jobID string, nonce int64) (*ShareResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var j *job
+	for _, candidate := range p.jobs {
+		if candidate.ID == jobID {
+			j = candidate
+		}
+	}
+	if j == nil {
+		p.stale++
+		return nil, fmt.Errorf("%w: %q", ErrUnknownJob, jobID)
+	}
+	if j.nonces[nonce] {
+		return nil, ErrDuplicateShare
+	}
+	b := j.block.Clone()
+	b.Nonce = nonce
+	b.SetHash()
+	if !pow.ValidateHash(b.Hash, j.ShareDifficulty) {
+		return nil, ErrLowShare
+	}
+
+	j.nonces[nonce] = true
+	w := p.worker(worker)
+	w.Shares++
+	w.RoundShares++
+	p.shares++
+	result := &ShareResult{Hash: b.Hash, Height: b.Index}
+	if !pow.ValidateHash(b.Hash, j.Difficulty) {
+		return result, nil
+	}
+
+	reply, err := p.upstream.SubmitBlock(j.ID, nonce)
+	if err != nil {
+		// Most likely another miner extended the tip first
+		result.Error = err.Error()
+		logging.Warnf("[POOL] Block #%d from %s refused: %v", b.Index, worker, err)
+		p.jobs = nil
+		return result, nil
+	}
+	result.Block, result.Hash, result.Height = true, reply.Hash, reply.Height
+	w.Blocks++
+	p.blocks = append(p.blocks, FoundBlock{Height: reply.Height, Hash: reply.Hash, Worker: worker, Reward: j.reward, Shares: p.splitReward(j.reward, worker)})
+	log.Printf("[POOL] Block #%d found by %s, reward %d split among the round's shares", reply.Height, worker, j.reward)
+
+	// Every job was on the tip the block replaced
+	p.jobs = nil
+	return result, nil
+}
+
+// splitReward credits reward to the workers in proportion to their shares
+// of the round, the remainder of the division to finder, starts a new round,
+// and returns the round's shares. p.mu must be held.
+func (p *Pool) splitReward(reward int64, finder string) int64 {
+	var round int64
+	for _, w := range p.workers {
+		round += w.RoundShares
+	}
+	paid := int64(0)
+	for _, w := range p.workers {
+		share := reward * w.RoundShares / round
+		w.Earned += share
+		paid += share
+		w.RoundShares = 0
+	}
+	p.workers[finder].Earned += reward - paid
+	return round
+}
+
+// worker returns the account of name, opening it if new. p.mu must be held.
+func (p *Pool) worker(name string) *WorkerStats {
+	w, ok := p.workers[name]
+	if !ok {
+		w = &WorkerStats{Name: name}
+		p.workers[name] = w
+	}
+	return w
+}
+
+// Stats returns a copy of the pool's books, workers by name
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := Stats{
+		ShareDifficulty: p.shareDifficulty,
+		Shares:          p.shares,
+		Stale:           p.stale,
+		Workers:         []WorkerStats{},
+		Blocks:          append([]FoundBlock{}, p.blocks...),
+	}
+	if node, ok := p.upstream.(Node); ok {
+		stats.Upstream = node.Address
+	}
+	if n := len(p.jobs); n > 0 {
+		stats.Height = p.jobs[n-1].Height
+	}
+	for _, w := range p.workers {
+		stats.Workers = append(stats.Workers, *w)
+	}
+	sort.Slice(stats.Workers, func(i, j int) bool { return stats.Workers[i].Name < stats.Workers[j].Name })
+	return stats
+}
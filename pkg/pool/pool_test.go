@@ -0,0 +1,169 @@
+package pool
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/network"
+	"blockchain/pkg/pow"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// minerUpstream mines for an in-process miner
+type minerUpstream struct {
+	m *network.Miner
+}
+
+func (u minerUpstream) GetBlockTemplate() (*network.BlockTemplateReply, error) {
+	return u.m.BlockTemplate()
+}
+
+func (u minerUpstream) SubmitBlock(templateID string, nonce int64) (*network.SubmitBlockReply, error) {
+	b, err := u.m.SubmitBlock(templateID, nonce, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &network.SubmitBlockReply{Success: true, Hash: b.Hash, Height: b.Index}, nil
+}
+
+// nonces returns the first n nonces after start whose hash of the job's
+// block has at least share but fewer than block leading zero bits, or with
+// block set, the first that has block
+func nonces(t *testing.T, j *Job, start int64, n int, solve bool) []int64 {
+	t.Helper()
+	b, err := block.DeserializeBlock(j.BlockData)
+	if err != nil {
+		t.Fatalf("Invalid job: %v", err)
+	}
+	var found []int64
+	for nonce := start; len(found) < n; nonce++ {
+		b.Nonce = nonce
+		hash := b.CalculateHash()
+		if pow.ValidateHash(hash, j.Difficulty) == solve && pow.ValidateHash(hash, j.ShareDifficulty) {
+			found = append(found, nonce)
+		}
+	}
+	return found
+}
+
+func TestPoolSplitsRewardByRoundShares(t *testing.T) {
+	miner := network.NewMiner("miner1", "localhost:0", 8, nil)
+	p := New(minerUpstream{miner}, 3, time.Hour)
+	j, err := p.Job()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if j.Height != 1 || j.Difficulty != 8 || j.ShareDifficulty != 3 {
+		t.Fatalf("Unexpected job %+v", j)
+	}
+
+	shares := nonces(t, j, 0, 4, false)
+	for i, nonce := range shares {
+		worker := "alice"
+		if i == 3 {
+			worker = "bob"
+		}
+		result, err := p.Submit(worker, j.ID, nonce)
+		if err != nil || result.Block {
+			t.Fatalf("Expected share %d accepted short of a block, got %+v, %v", i, result, err)
+		}
+	}
+	if _, err := p.Submit("alice", j.ID, shares[0]); !errors.Is(err, ErrDuplicateShare) {
+		t.Errorf("Expected ErrDuplicateShare, got %v", err)
+	}
+	if _, err := p.Submit("alice", "nope", shares[0]); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Expected ErrUnknownJob, got %v", err)
+	}
+	low := int64(0)
+	for b, _ := block.DeserializeBlock(j.BlockData); ; low++ {
+		b.Nonce = low
+		if !pow.ValidateHash(b.CalculateHash(), j.ShareDifficulty) {
+			break
+		}
+	}
+	if _, err := p.Submit("alice", j.ID, low); !errors.Is(err, ErrLowShare) {
+		t.Errorf("Expected ErrLowShare, got %v", err)
+	}
+
+	// Bob solves the block: the reward is split 3:2
+	solution := nonces(t, j, 0, 1, true)[0]
+	result, err := p.Submit("bob", j.ID, solution)
+	if err != nil || !result.Block || result.Height != 1 {
+		t.Fatalf("Expected the solution to be accepted as block #1, got %+v, %v", result, err)
+	}
+	if tip := miner.Blockchain.GetLatestBlock(); tip.Hash != result.Hash {
+		t.Fatalf("Expected the pool's block on the node's tip")
+	}
+	reward := miner.Blockchain.GetLatestBlock().Transactions[0].TotalOutputValue()
+	stats := p.Stats()
+	if len(stats.Workers) != 2 || stats.Shares != 5 || len(stats.Blocks) != 1 || stats.Blocks[0].Shares != 5 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	alice, bob := stats.Workers[0], stats.Workers[1]
+	if alice.Earned != reward*3/5 || bob.Earned != reward-alice.Earned || bob.Blocks != 1 {
+		t.Errorf("Expected a 3:2 split of %d, got alice %+v, bob %+v", reward, alice, bob)
+	}
+	if alice.RoundShares != 0 || bob.RoundShares != 0 {
+		t.Error("A block should start a new round")
+	}
+
+	// Shares of the solved job are stale; the next job builds on the block
+	if _, err := p.Submit("alice", j.ID, shares[1]); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Expected the solved job to be gone, got %v", err)
+	}
+	if next, err := p.Job(); err != nil || next.Height != 2 {
+		t.Errorf("Expected a job for block #2, got %+v, %v", next, err)
+	}
+}
+
+func TestWorkersMineThroughPool(t *testing.T) {
+	miner := network.NewMiner("miner1", "localhost:0", 10, nil)
+	p := New(minerUpstream{miner}, 0, time.Second)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go p.Serve(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results := make(chan WorkStats, 2)
+	for _, name := range []string{"alice", "bob"} {
+		go func() {
+			stats, err := Work(ctx, l.Addr().String(), name, 1, time.Second, func(reply ShareReply) {
+				if reply.Result.Block {
+					cancel()
+				}
+			})
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+			results <- stats
+		}()
+	}
+	var accepted int
+	for i := 0; i < 2; i++ {
+		accepted += (<-results).Accepted
+	}
+
+	stats, err := GetStats(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if len(stats.Blocks) == 0 || miner.Blockchain.GetLength() < 2 {
+		t.Fatalf("Expected the workers to find a block within the timeout, got %+v", stats)
+	}
+	if int64(accepted) != stats.Shares || stats.Blocks[0].Reward <= 0 {
+		t.Errorf("Expected the pool to count the %d accepted shares, got %+v", accepted, stats)
+	}
+	var earned int64
+	for _, w := range stats.Workers {
+		earned += w.Earned
+	}
+	if earned != stats.Blocks[0].Reward*int64(len(stats.Blocks)) {
+		t.Errorf("Expected the whole reward split among the workers, got %d", earned)
+	}
+}
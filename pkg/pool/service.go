@@ -0,0 +1,184 @@
+package pool
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/pow"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"strings"
+	"time"
+)
+
+// JobArgs asks the pool for a job
+type JobArgs struct {
+	Worker string
+}
+
+// ShareArgs is a share found by a worker
+type ShareArgs struct {
+	Worker string
+	JobID  string
+	Nonce  int64
+}
+
+// ShareReply reports whether a share was accepted, and whether it solved the
+// block. Stale is set if the job is gone, so the worker should fetch another.
+type ShareReply struct {
+	Accepted bool
+	Stale    bool
+	Result   ShareResult
+	Error    string
+}
+
+// Service is the RPC interface of a pool, served under the name "Pool"
+type Service struct {
+	pool *Pool
+}
+
+// GetJob RPC method to get the job to hash
+func (s *Service) GetJob(args *JobArgs, reply *Job) error {
+	j, err := s.pool.Job()
+	if err != nil {
+		return err
+	}
+	*reply = *j
+	return nil
+}
+
+// SubmitShare RPC method to submit a share
+func (s *Service) SubmitShare(args *ShareArgs, reply *ShareReply) error {
+	if args.Worker == "" {
+		reply.Error = "worker name required"
+		return nil
+	}
+	result, err := s.pool.Submit(args.Worker, args.JobID, args.Nonce)
+	if err != nil {
+		reply.Stale = errors.Is(err, ErrUnknownJob)
+		reply.Error = err.Error()
+		return nil
+	}
+	reply.Accepted = true
+	reply.Result = *result
+	return nil
+}
+
+// GetStats RPC method to get the pool's books
+func (s *Service) GetStats(args *struct{}, reply *Stats) error {
+	*reply = s.pool.Stats()
+	return nil
+}
+
+// Serve answers workers on l until it is closed
+func (p *Pool) Serve(l net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Pool", &Service{pool: p}); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// WorkStats reports a worker's run
+type WorkStats struct {
+	Hashes   int64
+	Jobs     int
+	Accepted int // Shares accepted
+	Rejected int // Shares refused, other than for a stale job
+	Blocks   int
+}
+
+// Work hashes jobs from the pool at address as worker, on threads goroutines,
+// submitting every share, until ctx is done. A job is refetched after refresh,
+// or as soon as the pool says it is stale. onShare, if set, is called with
+// each reply.
+func Work(ctx context.Context, address, worker string, threads int, refresh time.Duration, onShare func(ShareReply)) (WorkStats, error) {
+	var stats WorkStats
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return stats, fmt.Errorf("failed to connect to pool: %v", err)
+	}
+	defer client.Close()
+
+	for ctx.Err() == nil {
+		var j Job
+		if err := client.Call("Pool.GetJob", &JobArgs{Worker: worker}, &j); err != nil {
+			return stats, fmt.Errorf("failed to get job: %v", err)
+		}
+		stats.Jobs++
+		b, err := block.DeserializeBlock(j.BlockData)
+		if err != nil {
+			return stats, fmt.Errorf("invalid job: %v", err)
+		}
+
+		jobCtx, cancel := context.WithTimeout(ctx, refresh)
+		for jobCtx.Err() == nil {
+			result := (&pow.ProofOfWork{Block: b, Difficulty: j.ShareDifficulty}).MineParallel(jobCtx, threads)
+			stats.Hashes += result.Attempts
+			if !result.Success {
+				break
+			}
+			var reply ShareReply
+			err := client.Call("Pool.SubmitShare", &ShareArgs{Worker: worker, JobID: j.ID, Nonce: result.Nonce}, &reply)
+			if err != nil {
+				cancel()
+				return stats, fmt.Errorf("failed to submit share: %v", err)
+			}
+			if onShare != nil {
+				onShare(reply)
+			}
+			if reply.Stale {
+				break
+			}
+			if !reply.Accepted {
+				stats.Rejected++
+				continue
+			}
+			stats.Accepted++
+			if reply.Result.Block {
+				stats.Blocks++
+			}
+			if reply.Result.Block || reply.Result.Error != "" {
+				// The tip moved: the job is spent
+				break
+			}
+		}
+		cancel()
+	}
+	return stats, nil
+}
+
+// GetStats fetches the books of the pool at address
+func GetStats(address string) (*Stats, error) {
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to pool: %v", err)
+	}
+	defer client.Close()
+	var stats Stats
+	if err := client.Call("Pool.GetStats", &struct{}{}, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// String summarizes a worker's run on one line
+func (s WorkStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d hashes over %d jobs, %d shares accepted", s.Hashes, s.Jobs, s.Accepted)
+	if s.Rejected > 0 {
+		fmt.Fprintf(&b, ", %d rejected", s.Rejected)
+	}
+	fmt.Fprintf(&b, ", %d blocks", s.Blocks)
+	return b.String()
+}
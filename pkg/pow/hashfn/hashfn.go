@@ -0,0 +1,138 @@
+// Package hashfn implements the hash functions a chain's proof of work can
+// use. A block names its function in its header, and the chain params decide
+// which one blocks at each height must use, so mining behaviour can be
+// compared across functions that favour different hardware.
+package hashfn
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Names of the hash functions
+const (
+	SHA256     = "sha256"      // SHA-256 of the header, the default
+	SHA256d    = "sha256d"     // SHA-256 of the SHA-256, as in Bitcoin
+	ScryptLite = "scrypt-lite" // Sequential memory-hard, after scrypt's ROMix, with 32 KiB per hash
+	MemoryHard = "memhard"     // Balloon-style memory-hard, with 128 KiB per hash
+)
+
+// Size is the length of every function's hash in bytes
+const Size = sha256.Size
+
+var ErrUnknown = errors.New("unknown proof-of-work hash function")
+
+// Func computes one hash function. It may keep scratch memory between calls,
+// so it is not safe for concurrent use; each worker needs its own.
+type Func interface {
+	Sum(data []byte, out *[Size]byte)
+}
+
+// New returns the hash function called name ("" is SHA256)
+func New(name string) (Func, error) {
+	switch name {
+	case "", SHA256:
+		return sha256Func{}, nil
+	case SHA256d:
+		return sha256dFunc{}, nil
+	case ScryptLite:
+		return &roMix{cells: make([][Size]byte, scryptLiteCells)}, nil
+	case MemoryHard:
+		return &balloon{cells: make([][Size]byte, memoryHardCells)}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknown, name)
+}
+
+// Names lists the hash functions New knows
+func Names() []string {
+	return []string{SHA256, SHA256d, ScryptLite, MemoryHard}
+}
+
+// Canonical returns how a block header names the function: SHA256, the
+// function of every block before functions could be chosen, is named by
+// leaving the name empty, so those blocks keep their hashes
+func Canonical(name string) string {
+	if name == SHA256 {
+		return ""
+	}
+	return name
+}
+
+type sha256Func struct{}
+
+func (sha256Func) Sum(data []byte, out *[Size]byte) {
+	*out = sha256.Sum256(data)
+}
+
+type sha256dFunc struct{}
+
+func (sha256dFunc) Sum(data []byte, out *[Size]byte) {
+	first := sha256.Sum256(data)
+	*out = sha256.Sum256(first[:])
+}
+
+// scryptLiteCells is the number of hashes roMix keeps (32 KiB)
+const scryptLiteCells = 1024
+
+// roMix is scrypt's ROMix with SHA-256 as its mixing function: it fills
+// memory with a hash chain, then walks it in an order that depends on what
+// it has read so far, so hashing without the whole table costs recomputing it
+type roMix struct {
+	cells [][Size]byte
+}
+
+func (f *roMix) Sum(data []byte, out *[Size]byte) {
+	x := sha256.Sum256(data)
+	for i := range f.cells {
+		f.cells[i] = x
+		x = sha256.Sum256(x[:])
+	}
+	n := uint32(len(f.cells))
+	for range f.cells {
+		v := &f.cells[binary.LittleEndian.Uint32(x[:4])%n]
+		for k := range x {
+			x[k] ^= v[k]
+		}
+		x = sha256.Sum256(x[:])
+	}
+	*out = x
+}
+
+// memoryHardCells is the number of hashes balloon keeps (128 KiB)
+const memoryHardCells = 4096
+
+// balloon is a toy Balloon hash with one mixing round: every cell is
+// rewritten from its predecessor, itself, and a cell its predecessor picks,
+// so cells are both read and overwritten in data-dependent order
+type balloon struct {
+	cells [][Size]byte
+	buf   [8 + 3*Size]byte
+}
+
+func (f *balloon) Sum(data []byte, out *[Size]byte) {
+	n := uint64(len(f.cells))
+	f.cells[0] = sha256.Sum256(data)
+	for i := uint64(1); i < n; i++ {
+		f.hash(i, &f.cells[i-1], nil, nil, &f.cells[i])
+	}
+	for i := uint64(0); i < n; i++ {
+		prev := &f.cells[(i+n-1)%n]
+		other := &f.cells[binary.LittleEndian.Uint64(prev[:8])%n]
+		f.hash(n+i, prev, &f.cells[i], other, &f.cells[i])
+	}
+	*out = f.cells[n-1]
+}
+
+// hash writes the SHA-256 of counter and the given cells into dst
+func (f *balloon) hash(counter uint64, a, b, c *[Size]byte, dst *[Size]byte) {
+	binary.LittleEndian.PutUint64(f.buf[:8], counter)
+	size := 8
+	for _, cell := range []*[Size]byte{a, b, c} {
+		if cell != nil {
+			size += copy(f.buf[size:], cell[:])
+		}
+	}
+	*dst = sha256.Sum256(f.buf[:size])
+}
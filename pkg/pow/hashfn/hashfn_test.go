@@ -0,0 +1,70 @@
+package hashfn
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestFunctionsAreDeterministicAndDistinct(t *testing.T) {
+	data := []byte("block header")
+	seen := make(map[[Size]byte]string)
+	for _, name := range Names() {
+		f, err := New(name)
+		if err != nil {
+			t.Fatalf("New(%q): %v", name, err)
+		}
+		var first, again, other [Size]byte
+		f.Sum(data, &first)
+		f.Sum(data, &again) // Scratch memory must not leak between calls
+		f.Sum([]byte("block heades"), &other)
+		if first != again {
+			t.Errorf("%s: hashing twice gave different results", name)
+		}
+		if first == other {
+			t.Errorf("%s: different data gave the same hash", name)
+		}
+		if prev, ok := seen[first]; ok {
+			t.Errorf("%s hashes like %s", name, prev)
+		}
+		seen[first] = name
+	}
+}
+
+func TestKnownHashes(t *testing.T) {
+	data := []byte("abc")
+	var got [Size]byte
+	f, _ := New("")
+	f.Sum(data, &got)
+	if got != sha256.Sum256(data) {
+		t.Error("The default should be SHA-256")
+	}
+	f, _ = New(SHA256d)
+	f.Sum(data, &got)
+	first := sha256.Sum256(data)
+	if got != sha256.Sum256(first[:]) {
+		t.Error("sha256d should hash the SHA-256 again")
+	}
+}
+
+func TestUnknownFunction(t *testing.T) {
+	if _, err := New("md5"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("Expected ErrUnknown, got %v", err)
+	}
+	if Canonical(SHA256) != "" || Canonical(SHA256d) != SHA256d {
+		t.Error("Only SHA-256 should be named by leaving the name empty")
+	}
+}
+
+func BenchmarkFunctions(b *testing.B) {
+	data := make([]byte, 200)
+	for _, name := range Names() {
+		b.Run(name, func(b *testing.B) {
+			f, _ := New(name)
+			var out [Size]byte
+			for i := 0; i < b.N; i++ {
+				f.Sum(data, &out)
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
-// Package pow implements the Proof of Work consensus algorithm
+// Package pow implements the Proof of Work consensus algorithm. Blocks are
+// hashed with the function their PowAlgorithm names; package hashfn holds the
+// functions a chain can choose from.
 package pow
 
 import (
 	"blockchain/pkg/block"
+	"blockchain/pkg/pow/hashfn"
 	"context"
+	"encoding/hex"
+	"math/bits"
 	"math/rand/v2"
 	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -17,9 +23,14 @@ type ProofOfWork struct {
 
 // MiningResult represents the result of a mining operation
 type MiningResult struct {
-	Block   *block.Block
-	Success bool
-	Nonce   int64
+	Block    *block.Block
+	Success  bool
+	Nonce    int64
+	Attempts int64 // Hashes computed before returning
+
+	// WorkerAttempts splits Attempts by worker: one entry per MineParallel
+	// worker, a single entry for Mine
+	WorkerAttempts []int64
 }
 
 // NewProofOfWork creates a new PoW instance for a block
@@ -66,6 +77,24 @@ func leadingZeroBits(hash string) (int, bool) {
 	return zeros, true
 }
 
+// sumLeadingZeroBits returns the count of leading zero bits in a raw hash
+func sumLeadingZeroBits(sum *[hashfn.Size]byte) int {
+	zeros := 0
+	for _, b := range sum {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// sumMeetsDifficulty is meetsDifficulty for a raw hash, so the mining loop
+// only hex-encodes the winning hash
+func sumMeetsDifficulty(sum *[hashfn.Size]byte, difficulty int) bool {
+	return difficulty <= 0 || sumLeadingZeroBits(sum) >= difficulty
+}
+
 func meetsDifficulty(hash string, difficulty int) bool {
 	if difficulty <= 0 {
 		return true
@@ -84,30 +113,40 @@ func meetsDifficulty(hash string, difficulty int) bool {
 func (pow *ProofOfWork) Mine(ctx context.Context, callback func(nonce int64)) *MiningResult {
 	// Start from a random nonce to distribute mining attempts across miners
 	var nonce int64 = rand.Int64()
+	var attempts int64
 	reportInterval := int64(100000) // Report every 100k attempts
 
+	// Hash into a reused buffer; the hex string is only built for the winner
+	hasher := pow.Block.NewHasher()
+	var sum [hashfn.Size]byte
+
 	for {
 		if ctx != nil {
 			select {
 			case <-ctx.Done():
 				return &MiningResult{
-					Block:   pow.Block,
-					Success: false,
-					Nonce:   nonce,
+					Block:          pow.Block,
+					Success:        false,
+					Nonce:          nonce,
+					Attempts:       attempts,
+					WorkerAttempts: []int64{attempts},
 				}
 			default:
 			}
 		}
 
 		pow.Block.Nonce = nonce
-		hash := pow.Block.CalculateHash()
+		hasher.HashInto(nonce, &sum)
+		attempts++
 
-		if meetsDifficulty(hash, pow.Difficulty) {
-			pow.Block.Hash = hash
+		if sumMeetsDifficulty(&sum, pow.Difficulty) {
+			pow.Block.Hash = hex.EncodeToString(sum[:])
 			return &MiningResult{
-				Block:   pow.Block,
-				Success: true,
-				Nonce:   nonce,
+				Block:          pow.Block,
+				Success:        true,
+				Nonce:          nonce,
+				Attempts:       attempts,
+				WorkerAttempts: []int64{attempts},
 			}
 		}
 
@@ -125,15 +164,24 @@ func (pow *ProofOfWork) MineParallel(ctx context.Context, workers int) *MiningRe
 
 	resultChan := make(chan *MiningResult, workers)
 	var found int32 = 0
+	attempts := make([]int64, workers) // Each worker writes only its own entry
+	var wg sync.WaitGroup
 
 	for i := 0; i < workers; i++ {
+		wg.Add(1)
 		go func(workerID int) {
+			defer wg.Done()
+
 			// Each worker starts from a random nonce + worker offset to avoid duplication
 			// This ensures different miners and workers explore different nonce spaces
 			var nonce int64 = rand.Int64() + int64(workerID)
+			var workerAttempts int64
+			defer func() { attempts[workerID] = workerAttempts }()
 
 			// Create a copy of the block for this worker
 			workerBlock := pow.Block.Clone()
+			hasher := workerBlock.NewHasher()
+			var sum [hashfn.Size]byte
 
 			for {
 				// Check if someone else found the solution
@@ -145,13 +193,14 @@ func (pow *ProofOfWork) MineParallel(ctx context.Context, workers int) *MiningRe
 				case <-ctx.Done():
 					return
 				default:
-					workerBlock.Nonce = nonce
-					hash := workerBlock.CalculateHash()
+					hasher.HashInto(nonce, &sum)
+					workerAttempts++
 
-					if meetsDifficulty(hash, pow.Difficulty) {
+					if sumMeetsDifficulty(&sum, pow.Difficulty) {
 						// Found a valid solution
 						if atomic.CompareAndSwapInt32(&found, 0, 1) {
-							workerBlock.Hash = hash
+							workerBlock.Nonce = nonce
+							workerBlock.Hash = hex.EncodeToString(sum[:])
 							resultChan <- &MiningResult{
 								Block:   workerBlock,
 								Success: true,
@@ -167,16 +216,25 @@ func (pow *ProofOfWork) MineParallel(ctx context.Context, workers int) *MiningRe
 		}(i)
 	}
 
+	var result *MiningResult
 	select {
-	case result := <-resultChan:
-		return result
+	case result = <-resultChan:
 	case <-ctx.Done():
-		return &MiningResult{
+		result = &MiningResult{
 			Block:   pow.Block,
 			Success: false,
 			Nonce:   0,
 		}
 	}
+
+	// Stop the remaining workers so their attempts are counted
+	cancel()
+	wg.Wait()
+	result.WorkerAttempts = attempts
+	for _, n := range attempts {
+		result.Attempts += n
+	}
+	return result
 }
 
 // Validate checks if a block has a valid proof of work
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"blockchain/pkg/transaction"
 	"context"
+	"encoding/hex"
 	"testing"
 	"time"
 )
@@ -98,6 +99,31 @@ func TestMineParallelWithCancellation(t *testing.T) {
 	}
 }
 
+func TestMiningCountsAttempts(t *testing.T) {
+	pow, _ := setupTestPoW(10)
+	result := pow.Mine(context.Background(), nil)
+	if result.Attempts < 1 {
+		t.Errorf("Sequential mining should count its hashes, got %d", result.Attempts)
+	}
+
+	pow, _ = setupTestPoW(24)
+	ctx, _ := createCancellableContext(50 * time.Millisecond)
+	result = pow.MineParallel(ctx, 4)
+	if result.Success || result.Attempts < 4 {
+		t.Errorf("Cancelled parallel mining should still report attempts from every worker, got %d", result.Attempts)
+	}
+	if len(result.WorkerAttempts) != 4 {
+		t.Fatalf("Expected attempts for 4 workers, got %v", result.WorkerAttempts)
+	}
+	var sum int64
+	for _, n := range result.WorkerAttempts {
+		sum += n
+	}
+	if sum != result.Attempts {
+		t.Errorf("Worker attempts sum to %d, total is %d", sum, result.Attempts)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	pow, _ := setupTestPoW(10)
 	result := pow.Mine(context.Background(), nil)
@@ -255,3 +281,29 @@ func BenchmarkMineParallelWorkers(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkHashRate reports the single-threaded hash rate of Mine
+func BenchmarkHashRate(b *testing.B) {
+	pow, testBlock := setupTestPoW(16)
+	var attempts int64
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		testBlock.Timestamp++ // A fresh search each time
+		attempts += pow.Mine(context.Background(), nil).Attempts
+	}
+	b.ReportMetric(float64(attempts)/b.Elapsed().Seconds(), "hashes/s")
+	b.ReportMetric(float64(attempts)/float64(b.N), "hashes/op")
+}
+
+func TestSumLeadingZeroBitsMatchesHex(t *testing.T) {
+	for _, h := range []string{"00", "0f", "10", "80", "0001", "000000ff"} {
+		var sum [32]byte
+		raw, _ := hex.DecodeString(h)
+		copy(sum[:], raw)
+		sum[len(raw)] = 0xff // Stop the count right after the prefix
+		want, _ := leadingZeroBits(hex.EncodeToString(sum[:]))
+		if got := sumLeadingZeroBits(&sum); got != want {
+			t.Errorf("%s: got %d leading zero bits, want %d", h, got, want)
+		}
+	}
+}
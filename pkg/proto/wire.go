@@ -0,0 +1,176 @@
+// Package proto encodes and decodes the protocol buffers wire format, enough
+// for the miner's gRPC API to exchange the messages defined in
+// pkg/network/miner.proto without generated code. Messages encode their own
+// fields by number; proto3 defaults (zero, empty, false) are left out, as
+// generated code in other languages does.
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrMalformed = errors.New("malformed protobuf message")
+
+// Wire types
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+// Marshaler is a message that can encode its fields
+type Marshaler interface {
+	MarshalProto(e *Encoder)
+}
+
+// MarshalFunc adapts a function encoding a message's fields to a Marshaler
+type MarshalFunc func(e *Encoder)
+
+// MarshalProto calls f
+func (f MarshalFunc) MarshalProto(e *Encoder) { f(e) }
+
+// Unmarshaler is a message that can decode its fields
+type Unmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
+
+// Marshal encodes a message
+func Marshal(m Marshaler) []byte {
+	var e Encoder
+	m.MarshalProto(&e)
+	return e.buf
+}
+
+// Encoder appends fields to a message
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+// Int64 encodes an int64 or int32 field; negative values take ten bytes, as
+// in other implementations
+func (e *Encoder) Int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, WireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+// Bool encodes a bool field
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Int64(field, 1)
+	}
+}
+
+// Double encodes a double field
+func (e *Encoder) Double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, WireFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+// String encodes a string field
+func (e *Encoder) String(field int, s string) {
+	if s != "" {
+		e.Bytes(field, []byte(s))
+	}
+}
+
+// Strings encodes a repeated string field, empty strings included
+func (e *Encoder) Strings(field int, ss []string) {
+	for _, s := range ss {
+		e.Bytes(field, []byte(s))
+	}
+}
+
+// Bytes encodes a bytes field, or one element of a repeated one
+func (e *Encoder) Bytes(field int, b []byte) {
+	e.tag(field, WireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// Message encodes a nested message, or one element of a repeated one. A nil
+// message is left out.
+func (e *Encoder) Message(field int, m Marshaler) {
+	if m != nil {
+		e.Bytes(field, Marshal(m))
+	}
+}
+
+// Field is a decoded field's value, by wire type: varints and fixed-width
+// values are in Value, length-delimited ones in Data
+type Field struct {
+	Num   int
+	Wire  int
+	Value uint64
+	Data  []byte
+}
+
+// Int64 returns a varint field as an int64 (or int32)
+func (f Field) Int64() int64 { return int64(f.Value) }
+
+// Bool returns a varint field as a bool
+func (f Field) Bool() bool { return f.Value != 0 }
+
+// Double returns a fixed64 field as a double
+func (f Field) Double() float64 { return math.Float64frombits(f.Value) }
+
+// String returns a length-delimited field as a string
+func (f Field) String() string { return string(f.Data) }
+
+// Decode calls fn for each field of a message in order. Fields fn does not
+// know should be ignored, so older decoders read newer messages.
+func Decode(data []byte, fn func(f Field) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return fmt.Errorf("%w: bad field key", ErrMalformed)
+		}
+		data = data[n:]
+		f := Field{Num: int(key >> 3), Wire: int(key & 7)}
+		switch f.Wire {
+		case WireVarint:
+			if f.Value, n = binary.Uvarint(data); n <= 0 {
+				return fmt.Errorf("%w: bad varint in field %d", ErrMalformed, f.Num)
+			}
+			data = data[n:]
+		case WireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("%w: truncated field %d", ErrMalformed, f.Num)
+			}
+			f.Value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case WireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("%w: truncated field %d", ErrMalformed, f.Num)
+			}
+			f.Value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case WireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return fmt.Errorf("%w: truncated field %d", ErrMalformed, f.Num)
+			}
+			f.Data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d in field %d", ErrMalformed, f.Wire, f.Num)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
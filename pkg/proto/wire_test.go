@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncodeMatchesReferenceEncoding(t *testing.T) {
+	// Examples from the protocol buffers encoding guide
+	msg := Marshal(MarshalFunc(func(e *Encoder) {
+		e.Int64(1, 150)
+		e.String(2, "testing")
+		e.Int64(3, 0) // Defaults are left out
+		e.String(4, "")
+	}))
+	want := []byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}
+	if !bytes.Equal(msg, want) {
+		t.Errorf("Expected % x, got % x", want, msg)
+	}
+
+	// Negative int32 values are sign-extended to ten bytes
+	if msg := Marshal(MarshalFunc(func(e *Encoder) { e.Int64(1, -1) })); len(msg) != 11 {
+		t.Errorf("Expected -1 to take 10 bytes after its key, got % x", msg)
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	inner := MarshalFunc(func(e *Encoder) { e.String(1, "in") })
+	msg := Marshal(MarshalFunc(func(e *Encoder) {
+		e.Int64(1, -1)
+		e.Double(2, 1.5)
+		e.Message(3, inner)
+		e.Strings(4, []string{"a", ""})
+		e.Bool(5, true)
+		e.Bytes(6, []byte{0xff})
+	}))
+
+	var seen []int
+	err := Decode(msg, func(f Field) error {
+		seen = append(seen, f.Num)
+		switch f.Num {
+		case 1:
+			if int32(f.Int64()) != -1 {
+				t.Errorf("Expected -1, got %d", f.Int64())
+			}
+		case 2:
+			if f.Double() != 1.5 {
+				t.Errorf("Expected 1.5, got %v", f.Double())
+			}
+		case 3:
+			Decode(f.Data, func(f Field) error {
+				if f.String() != "in" {
+					t.Errorf("Expected the nested string, got %q", f.String())
+				}
+				return nil
+			})
+		case 5:
+			if !f.Bool() {
+				t.Error("Expected true")
+			}
+		}
+		return nil
+	})
+	if err != nil || len(seen) != 7 {
+		t.Errorf("Expected 7 fields, got %v (%v)", seen, err)
+	}
+
+	for _, bad := range [][]byte{{0x12, 0x05, 'a'}, {0x08}, {0x00, 0x01}, {0x0b}} {
+		if err := Decode(bad, func(Field) error { return nil }); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Expected % x to be malformed, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package quorum cross-checks answers from several nodes so a client does not
+// have to trust any single RPC endpoint: an answer is accepted only when k of
+// the n queried nodes return it byte-for-byte
+package quorum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrNoQuorum = errors.New("no answer reached quorum")
+
+// Spec is a k-of-n agreement requirement
+type Spec struct {
+	K, N int
+}
+
+// ParseSpec parses "k/n", e.g. "2/3"
+func ParseSpec(s string) (Spec, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Spec{}, fmt.Errorf("quorum must be k/n, got %q", s)
+	}
+	k, errK := strconv.Atoi(strings.TrimSpace(parts[0]))
+	n, errN := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errK != nil || errN != nil || k < 1 || n < k {
+		return Spec{}, fmt.Errorf("quorum must satisfy 1 <= k <= n, got %q", s)
+	}
+	return Spec{K: k, N: n}, nil
+}
+
+func (s Spec) String() string {
+	return fmt.Sprintf("%d/%d", s.K, s.N)
+}
+
+// Response is one node's answer to a query
+type Response struct {
+	Node  string
+	Value any
+	Err   error
+}
+
+// Dissent is a node whose answer differs from the accepted one
+type Dissent struct {
+	Node        string `json:"node"`
+	Fingerprint string `json:"fingerprint,omitempty"` // Identifies the node's answer; equal fingerprints are equal answers
+	Answer      any    `json:"answer,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Result is the outcome of comparing the nodes' answers
+type Result struct {
+	Value       any       `json:"-"`
+	Fingerprint string    `json:"fingerprint"`
+	Agreed      []string  `json:"agreed"` // Nodes that returned the accepted answer
+	Dissent     []Dissent `json:"dissent,omitempty"`
+	OK          bool      `json:"ok"`
+}
+
+// Fingerprint returns a short digest of a value's JSON encoding
+func Fingerprint(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Decide groups responses by answer and accepts the most common answer if at
+// least k nodes returned it. Every other node is listed as dissenting.
+func Decide(responses []Response, k int) Result {
+	groups := make(map[string][]int)
+	fingerprints := make([]string, len(responses))
+	for i, r := range responses {
+		if r.Err != nil {
+			continue
+		}
+		fp, err := Fingerprint(r.Value)
+		if err != nil {
+			responses[i].Err = err
+			continue
+		}
+		fingerprints[i] = fp
+		groups[fp] = append(groups[fp], i)
+	}
+
+	// Most common answer wins; break ties deterministically
+	var best string
+	for fp, members := range groups {
+		if best == "" || len(members) > len(groups[best]) || (len(members) == len(groups[best]) && fp < best) {
+			best = fp
+		}
+	}
+
+	result := Result{Fingerprint: best, OK: best != "" && len(groups[best]) >= k}
+	if best != "" {
+		result.Value = responses[groups[best][0]].Value
+	}
+	for i, r := range responses {
+		switch {
+		case r.Err != nil:
+			result.Dissent = append(result.Dissent, Dissent{Node: r.Node, Error: r.Err.Error()})
+		case fingerprints[i] == best:
+			result.Agreed = append(result.Agreed, r.Node)
+		default:
+			result.Dissent = append(result.Dissent, Dissent{Node: r.Node, Fingerprint: fingerprints[i], Answer: r.Value})
+		}
+	}
+	sort.Strings(result.Agreed)
+	sort.Slice(result.Dissent, func(i, j int) bool { return result.Dissent[i].Node < result.Dissent[j].Node })
+	return result
+}
+
+// Query runs call against every node concurrently
+func Query(nodes []string, call func(node string) (any, error)) []Response {
+	responses := make([]Response, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			value, err := call(node)
+			responses[i] = Response{Node: node, Value: value, Err: err}
+		}(i, node)
+	}
+	wg.Wait()
+	return responses
+}
+
+// Ask queries the nodes and decides on an answer, returning ErrNoQuorum (with
+// the partial result) if fewer than spec.K nodes agree
+func Ask(spec Spec, nodes []string, call func(node string) (any, error)) (Result, error) {
+	if len(nodes) != spec.N {
+		return Result{}, fmt.Errorf("quorum %s needs %d nodes, got %d", spec, spec.N, len(nodes))
+	}
+	result := Decide(Query(nodes, call), spec.K)
+	if !result.OK {
+		return result, fmt.Errorf("%w: best answer from %d of %d nodes, %d required",
+			ErrNoQuorum, len(result.Agreed), spec.N, spec.K)
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package quorum
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec("2/3")
+	if err != nil || spec.K != 2 || spec.N != 3 || spec.String() != "2/3" {
+		t.Errorf("Unexpected spec %v, %v", spec, err)
+	}
+	for _, bad := range []string{"", "3", "0/3", "4/3", "a/b", "1/2/3"} {
+		if _, err := ParseSpec(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+type tip struct {
+	Height int64
+	Hash   string
+}
+
+func TestDecideAcceptsMajorityAnswer(t *testing.T) {
+	result := Decide([]Response{
+		{Node: "a", Value: tip{10, "abc"}},
+		{Node: "b", Value: tip{10, "abc"}},
+		{Node: "c", Value: tip{10, "evil"}},
+		{Node: "d", Err: errors.New("timeout")},
+	}, 2)
+
+	if !result.OK || result.Value.(tip).Hash != "abc" {
+		t.Fatalf("Expected the answer of a and b to be accepted, got %+v", result)
+	}
+	if len(result.Agreed) != 2 || len(result.Dissent) != 2 {
+		t.Fatalf("Unexpected agreement: %+v", result)
+	}
+	if result.Dissent[0].Node != "c" || result.Dissent[0].Answer.(tip).Hash != "evil" || result.Dissent[1].Error != "timeout" {
+		t.Errorf("Dissent should identify the lying and the failing node: %+v", result.Dissent)
+	}
+}
+
+func TestAskRequiresQuorum(t *testing.T) {
+	answers := map[string]tip{"a": {10, "x"}, "b": {11, "y"}, "c": {10, "x"}}
+	call := func(node string) (any, error) { return answers[node], nil }
+
+	if _, err := Ask(Spec{K: 3, N: 3}, []string{"a", "b", "c"}, call); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("3/3 should fail when one node disagrees, got %v", err)
+	}
+	result, err := Ask(Spec{K: 2, N: 3}, []string{"a", "b", "c"}, call)
+	if err != nil || result.Value.(tip).Hash != "x" {
+		t.Errorf("2/3 should accept x, got %+v %v", result, err)
+	}
+	if _, err := Ask(Spec{K: 2, N: 3}, []string{"a", "b"}, call); err == nil {
+		t.Error("Node count must match n")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package resource
+
+// DiskFree is not measured on this platform
+func DiskFree(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,109 @@
+// Package resource samples the host resources a node depends on, free disk
+// space and available memory, and checks them against thresholds.
+package resource
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned when a resource cannot be measured on this platform
+var ErrUnsupported = errors.New("resource measurement not supported on this platform")
+
+// Usage is one sample of the host's resources. A zero field was not measured.
+type Usage struct {
+	DiskFree     uint64 // Bytes available to unprivileged users on the watched filesystem
+	MemAvailable uint64 // Bytes of memory available without swapping
+}
+
+// Thresholds are the minimum resources a node needs. Zero disables a check.
+type Thresholds struct {
+	MinDiskFree     uint64
+	MinMemAvailable uint64
+}
+
+// Sample measures the filesystem holding path and the host's memory. Resources
+// that cannot be measured are left zero; the first error is returned with the
+// partial sample.
+func Sample(path string) (Usage, error) {
+	var u Usage
+	var firstErr error
+	if path != "" {
+		free, err := DiskFree(path)
+		if err != nil {
+			firstErr = err
+		}
+		u.DiskFree = free
+	}
+	mem, err := MemAvailable()
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	u.MemAvailable = mem
+	return u, firstErr
+}
+
+// Pressure lists the resources in u below their thresholds, as messages.
+// Unmeasured resources never count as pressure.
+func (t Thresholds) Pressure(u Usage) []string {
+	var reasons []string
+	if t.MinDiskFree > 0 && u.DiskFree > 0 && u.DiskFree < t.MinDiskFree {
+		reasons = append(reasons, fmt.Sprintf("disk free %s below %s", FormatBytes(u.DiskFree), FormatBytes(t.MinDiskFree)))
+	}
+	if t.MinMemAvailable > 0 && u.MemAvailable > 0 && u.MemAvailable < t.MinMemAvailable {
+		reasons = append(reasons, fmt.Sprintf("memory available %s below %s", FormatBytes(u.MemAvailable), FormatBytes(t.MinMemAvailable)))
+	}
+	return reasons
+}
+
+// MemAvailable returns the host's available memory, from /proc/meminfo
+func MemAvailable() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if os.IsNotExist(err) {
+		return 0, ErrUnsupported
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseMemAvailable(f)
+}
+
+// parseMemAvailable reads the MemAvailable line of /proc/meminfo, in kB
+func parseMemAvailable(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemAvailable %q: %v", fields[1], err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, ErrUnsupported
+}
+
+// FormatBytes renders a byte count with a binary unit, e.g. "512.0 MiB"
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
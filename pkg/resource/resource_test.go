@@ -0,0 +1,42 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMemAvailable(t *testing.T) {
+	meminfo := "MemTotal:       16318480 kB\nMemFree:         1236112 kB\nMemAvailable:    8159240 kB\n"
+	got, err := parseMemAvailable(strings.NewReader(meminfo))
+	if err != nil || got != 8159240*1024 {
+		t.Errorf("Expected %d bytes, got %d, %v", 8159240*1024, got, err)
+	}
+	if _, err := parseMemAvailable(strings.NewReader("MemTotal: 1 kB\n")); err != ErrUnsupported {
+		t.Errorf("Expected ErrUnsupported without a MemAvailable line, got %v", err)
+	}
+}
+
+func TestPressure(t *testing.T) {
+	th := Thresholds{MinDiskFree: 1 << 30, MinMemAvailable: 256 << 20}
+	if reasons := th.Pressure(Usage{DiskFree: 2 << 30, MemAvailable: 1 << 30}); len(reasons) != 0 {
+		t.Errorf("Expected no pressure, got %v", reasons)
+	}
+	reasons := th.Pressure(Usage{DiskFree: 512 << 20, MemAvailable: 1 << 30})
+	if len(reasons) != 1 || reasons[0] != "disk free 512.0 MiB below 1.0 GiB" {
+		t.Errorf("Expected disk pressure, got %v", reasons)
+	}
+	// Unmeasured resources are not pressure
+	if reasons := th.Pressure(Usage{}); len(reasons) != 0 {
+		t.Errorf("Unmeasured usage should not be pressure, got %v", reasons)
+	}
+}
+
+func TestSampleDisk(t *testing.T) {
+	u, err := Sample(t.TempDir())
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	if err != nil || u.DiskFree == 0 {
+		t.Errorf("Expected free disk space, got %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,308 @@
+// Package script implements a minimal stack-based script engine for
+// pay-to-script-hash style outputs. Instead of a bare public key, such an
+// output is locked to the hash of a redeem script naming its spending
+// conditions; the spender reveals the script together with the arguments
+// that satisfy it, such as signatures.
+//
+// A script is a space-separated list of tokens. Opcodes are upper case;
+// every other token is pushed onto the stack as data, numbers in decimal and
+// public keys in hex:
+//
+//	<pk> CHECKSIG                                   pay to one key
+//	2 <pk1> <pk2> <pk3> 3 CHECKMULTISIG             two signatures of three keys
+//	<height> CHECKLOCKTIMEVERIFY DROP <pk> CHECKSIG  one key, from a block height on
+//
+// Signatures are checked through a Checker, so the engine knows nothing of
+// transactions.
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScriptHashPrefix marks a scriptPubKey locked to a redeem script's hash
+// ("p2sh:<sha256 hex>") and a scriptSig spending one
+// ("p2sh:<redeem script hex> <arg>...")
+const ScriptHashPrefix = "p2sh:"
+
+const (
+	OpCheckSig            = "CHECKSIG"            // <sig> <pubkey> -> 1 if sig is the pubkey's, else 0
+	OpCheckMultiSig       = "CHECKMULTISIG"       // <sig>*m m <pubkey>*n n -> 1 if the sigs match keys in order, else 0
+	OpCheckLockTimeVerify = "CHECKLOCKTIMEVERIFY" // <height> -> <height>, failing unless the spend is locked to height
+	OpDrop                = "DROP"                // <x> ->
+)
+
+const (
+	MaxScriptBytes  = 1024 // Longest redeem script
+	MaxArgs         = 20   // Most arguments a scriptSig may push
+	MaxMultiSigKeys = 16   // Most public keys of a CHECKMULTISIG
+)
+
+var (
+	ErrInvalidScript = errors.New("invalid script")
+	ErrScriptFailed  = errors.New("script failed")
+)
+
+// Checker resolves what a script cannot check by itself: signatures over
+// the spending transaction and its lock time
+type Checker interface {
+	// CheckSig reports whether sig, a scriptSig-style signature, signs the
+	// spending input with pubKey
+	CheckSig(sig, pubKey string) bool
+
+	// CheckLockTime reports whether the spending transaction cannot be
+	// mined below height
+	CheckLockTime(height int64) bool
+}
+
+// Parse splits a script into its tokens, rejecting unknown opcodes
+func Parse(src string) ([]string, error) {
+	if len(src) > MaxScriptBytes {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrInvalidScript, len(src), MaxScriptBytes)
+	}
+	tokens := strings.Fields(src)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidScript)
+	}
+	for _, tok := range tokens {
+		if isOpcode(tok) && !knownOpcode(tok) {
+			return nil, fmt.Errorf("%w: unknown opcode %s", ErrInvalidScript, tok)
+		}
+	}
+	return tokens, nil
+}
+
+// isOpcode reports whether tok is written as an opcode
+func isOpcode(tok string) bool {
+	return strings.ToUpper(tok) == tok && strings.ContainsAny(tok, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// knownOpcode reports whether op is one the engine executes
+func knownOpcode(op string) bool {
+	switch op {
+	case OpCheckSig, OpCheckMultiSig, OpCheckLockTimeVerify, OpDrop:
+		return true
+	}
+	return false
+}
+
+// Execute pushes args and runs the redeem script on them. It succeeds if the
+// script leaves exactly one true item on the stack.
+func Execute(redeem string, args []string, c Checker) error {
+	tokens, err := Parse(redeem)
+	if err != nil {
+		return err
+	}
+	if len(args) > MaxArgs {
+		return fmt.Errorf("%w: %d arguments, at most %d", ErrInvalidScript, len(args), MaxArgs)
+	}
+	s := &stack{items: append([]string(nil), args...)}
+	for _, tok := range tokens {
+		if err := s.step(tok, c); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrScriptFailed, tok, err)
+		}
+	}
+	if len(s.items) != 1 || !truthy(s.items[0]) {
+		return fmt.Errorf("%w: ended with stack %v", ErrScriptFailed, s.items)
+	}
+	return nil
+}
+
+// stack is the engine's data stack, top last
+type stack struct {
+	items []string
+}
+
+func (s *stack) push(item string) {
+	s.items = append(s.items, item)
+}
+
+func (s *stack) pop() (string, error) {
+	if len(s.items) == 0 {
+		return "", errors.New("stack is empty")
+	}
+	item := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return item, nil
+}
+
+// popInt pops a number no greater than max
+func (s *stack) popInt(max int64) (int64, error) {
+	item, err := s.pop()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(item, 10, 64)
+	if err != nil || n < 0 || n > max {
+		return 0, fmt.Errorf("%q is not a number from 0 to %d", item, max)
+	}
+	return n, nil
+}
+
+// step executes one token
+func (s *stack) step(tok string, c Checker) error {
+	switch tok {
+	case OpCheckSig:
+		pubKey, err := s.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := s.pop()
+		if err != nil {
+			return err
+		}
+		s.push(boolItem(c.CheckSig(sig, pubKey)))
+	case OpCheckMultiSig:
+		n, err := s.popInt(MaxMultiSigKeys)
+		if err != nil {
+			return err
+		}
+		pubKeys := make([]string, n)
+		for i := n - 1; i >= 0; i-- {
+			if pubKeys[i], err = s.pop(); err != nil {
+				return err
+			}
+		}
+		m, err := s.popInt(n)
+		if err != nil {
+			return err
+		}
+		sigs := make([]string, m)
+		for i := m - 1; i >= 0; i-- {
+			if sigs[i], err = s.pop(); err != nil {
+				return err
+			}
+		}
+		s.push(boolItem(checkMultiSig(sigs, pubKeys, c)))
+	case OpCheckLockTimeVerify:
+		if len(s.items) == 0 {
+			return errors.New("stack is empty")
+		}
+		height, err := strconv.ParseInt(s.items[len(s.items)-1], 10, 64)
+		if err != nil || height < 0 {
+			return fmt.Errorf("%q is not a height", s.items[len(s.items)-1])
+		}
+		if !c.CheckLockTime(height) {
+			return fmt.Errorf("spend is not locked to height %d", height)
+		}
+	case OpDrop:
+		if _, err := s.pop(); err != nil {
+			return err
+		}
+	default:
+		s.push(tok)
+	}
+	return nil
+}
+
+// checkMultiSig reports whether each signature matches a distinct public
+// key, in the keys' order
+func checkMultiSig(sigs, pubKeys []string, c Checker) bool {
+	k := 0
+	for _, sig := range sigs {
+		for k < len(pubKeys) && !c.CheckSig(sig, pubKeys[k]) {
+			k++
+		}
+		if k == len(pubKeys) {
+			return false
+		}
+		k++
+	}
+	return true
+}
+
+func boolItem(ok bool) string {
+	if ok {
+		return "1"
+	}
+	return "0"
+}
+
+// truthy reports whether a stack item counts as true: anything but an empty
+// item or a zero
+func truthy(item string) bool {
+	if n, err := strconv.ParseInt(item, 10, 64); err == nil {
+		return n != 0
+	}
+	return item != ""
+}
+
+// Hash returns the hex SHA-256 of a redeem script
+func Hash(redeem string) string {
+	sum := sha256.Sum256([]byte(redeem))
+	return hex.EncodeToString(sum[:])
+}
+
+// PayToScriptHash returns the scriptPubKey locking an output to redeem
+func PayToScriptHash(redeem string) (string, error) {
+	if _, err := Parse(redeem); err != nil {
+		return "", err
+	}
+	return ScriptHashPrefix + Hash(redeem), nil
+}
+
+// IsScriptHash reports whether scriptPubKey is locked to a redeem script
+func IsScriptHash(scriptPubKey string) bool {
+	return strings.HasPrefix(scriptPubKey, ScriptHashPrefix)
+}
+
+// SpendScriptHash returns the scriptSig revealing redeem and pushing args,
+// in order, for it to run on
+func SpendScriptHash(redeem string, args ...string) string {
+	fields := append([]string{hex.EncodeToString([]byte(redeem))}, args...)
+	return ScriptHashPrefix + strings.Join(fields, " ")
+}
+
+// ParseScriptHashSig splits a scriptSig made by SpendScriptHash into its
+// redeem script and arguments
+func ParseScriptHashSig(scriptSig string) (string, []string, error) {
+	rest, ok := strings.CutPrefix(scriptSig, ScriptHashPrefix)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: scriptSig does not reveal a redeem script", ErrInvalidScript)
+	}
+	fields := strings.Split(rest, " ")
+	redeem, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: redeem script is not hex", ErrInvalidScript)
+	}
+	for _, arg := range fields[1:] {
+		if arg == "" {
+			return "", nil, fmt.Errorf("%w: empty argument", ErrInvalidScript)
+		}
+	}
+	return string(redeem), fields[1:], nil
+}
+
+// VerifyScriptHash checks that scriptSig reveals the redeem script that
+// scriptPubKey is locked to, and that the script succeeds on its arguments
+func VerifyScriptHash(scriptPubKey, scriptSig string, c Checker) error {
+	redeem, args, err := ParseScriptHashSig(scriptSig)
+	if err != nil {
+		return err
+	}
+	if ScriptHashPrefix+Hash(redeem) != scriptPubKey {
+		return fmt.Errorf("%w: redeem script does not match the output's hash", ErrScriptFailed)
+	}
+	return Execute(redeem, args, c)
+}
+
+// PubKey returns a redeem script paying to one public key
+func PubKey(pubKey string) string {
+	return pubKey + " " + OpCheckSig
+}
+
+// MultiSig returns a redeem script needing m signatures of pubKeys, given
+// in the keys' order
+func MultiSig(m int, pubKeys ...string) string {
+	return fmt.Sprintf("%d %s %d %s", m, strings.Join(pubKeys, " "), len(pubKeys), OpCheckMultiSig)
+}
+
+// TimeLocked returns a redeem script paying to pubKey from block height on
+func TimeLocked(height int64, pubKey string) string {
+	return fmt.Sprintf("%d %s %s %s", height, OpCheckLockTimeVerify, OpDrop, PubKey(pubKey))
+}
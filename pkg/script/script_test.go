@@ -0,0 +1,71 @@
+package script
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeChecker accepts a signature "sig-<key>" for key, and lock times up to
+// the spend's
+type fakeChecker struct {
+	lockTime int64
+}
+
+func (c fakeChecker) CheckSig(sig, pubKey string) bool {
+	return sig == "sig-"+pubKey
+}
+
+func (c fakeChecker) CheckLockTime(height int64) bool {
+	return c.lockTime >= height
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name   string
+		redeem string
+		args   []string
+		lock   int64
+		ok     bool
+	}{
+		{"single key", PubKey("alice"), []string{"sig-alice"}, 0, true},
+		{"wrong key", PubKey("alice"), []string{"sig-bob"}, 0, false},
+		{"two of three", MultiSig(2, "a", "b", "c"), []string{"sig-a", "sig-c"}, 0, true},
+		{"two of three, out of order", MultiSig(2, "a", "b", "c"), []string{"sig-c", "sig-a"}, 0, false},
+		{"two of three, same key twice", MultiSig(2, "a", "b", "c"), []string{"sig-b", "sig-b"}, 0, false},
+		{"two of three, one signature", MultiSig(2, "a", "b", "c"), []string{"sig-a"}, 0, false},
+		{"timelock reached", TimeLocked(10, "alice"), []string{"sig-alice"}, 10, true},
+		{"timelock not reached", TimeLocked(10, "alice"), []string{"sig-alice"}, 9, false},
+		{"extra argument", PubKey("alice"), []string{"junk", "sig-alice"}, 0, false},
+		{"empty stack", OpCheckSig, nil, 0, false},
+	}
+	for _, tt := range tests {
+		err := Execute(tt.redeem, tt.args, fakeChecker{lockTime: tt.lock})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+
+	if err := Execute("alice CHECKSIGVERIFY", []string{"sig-alice"}, fakeChecker{}); !errors.Is(err, ErrInvalidScript) {
+		t.Errorf("Unknown opcodes should make the script invalid, got %v", err)
+	}
+}
+
+func TestScriptHashRoundTrip(t *testing.T) {
+	redeem := MultiSig(1, "a", "b")
+	scriptPubKey, err := PayToScriptHash(redeem)
+	if err != nil || !IsScriptHash(scriptPubKey) {
+		t.Fatalf("Failed to lock to script: %q, %v", scriptPubKey, err)
+	}
+
+	scriptSig := SpendScriptHash(redeem, "sig-b")
+	if err := VerifyScriptHash(scriptPubKey, scriptSig, fakeChecker{}); err != nil {
+		t.Errorf("Revealed script should spend the output: %v", err)
+	}
+	other := SpendScriptHash(PubKey("b"), "sig-b")
+	if err := VerifyScriptHash(scriptPubKey, other, fakeChecker{}); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("A different script should not spend the output, got %v", err)
+	}
+	if _, err := PayToScriptHash("a NOSUCHOP"); err == nil {
+		t.Error("Outputs should not be locked to invalid scripts")
+	}
+}
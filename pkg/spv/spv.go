@@ -0,0 +1,246 @@
+// Package spv is a light client node for simplified payment verification. It
+// downloads only block headers, checking that they link and meet their proof
+// of work, and verifies that a transaction is in the chain from a Merkle proof
+// served by a full miner, checked against its own headers. No block body is
+// downloaded, so a proof tells the node that a transaction was included, not
+// that it was valid; that part is left to the miners' proof of work.
+package spv
+
+import (
+	"blockchain/pkg/merkle"
+	"blockchain/pkg/network"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"sync"
+)
+
+var (
+	ErrNoHeaders       = errors.New("no headers synced")
+	ErrGenesisMismatch = errors.New("chain starts from a different genesis block")
+	ErrInvalidProof    = errors.New("invalid SPV proof")
+)
+
+// Node keeps the longest valid header chain its miners offer
+type Node struct {
+	Miners  []string            // Addresses of the full miners to sync from and ask for proofs
+	Auth    network.Credentials // Presented to miners that restrict access
+	Genesis string              // Genesis block hash to require; empty to adopt the first synced
+
+	syncMu  sync.Mutex // Serializes syncs
+	mu      sync.RWMutex
+	headers []network.BlockHeader
+}
+
+// NewNode creates a light client node with no headers
+func NewNode(miners []string, genesis string) *Node {
+	return &Node{Miners: miners, Genesis: genesis}
+}
+
+// Tip returns the header of the local chain's tip
+func (n *Node) Tip() (network.BlockHeader, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if len(n.headers) == 0 {
+		return network.BlockHeader{}, false
+	}
+	return n.headers[len(n.headers)-1], true
+}
+
+// Header returns the local chain's header at a height
+func (n *Node) Header(height int64) (network.BlockHeader, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if height < 0 || height >= int64(len(n.headers)) {
+		return network.BlockHeader{}, false
+	}
+	return n.headers[height], true
+}
+
+// Length returns the number of headers held
+func (n *Node) Length() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.headers)
+}
+
+// Sync downloads headers from every miner and keeps the longest chain that
+// checks out. It returns the errors of the miners whose chains could not be
+// used, joined; the node keeps whatever the others offered.
+func (n *Node) Sync() error {
+	n.syncMu.Lock()
+	defer n.syncMu.Unlock()
+	var errs []error
+	for _, addr := range n.Miners {
+		if err := n.syncFrom(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncFrom fetches a miner's headers after the local tip, or its whole header
+// chain if it no longer holds the tip, and adopts them if they are valid and
+// longer than the local chain
+func (n *Node) syncFrom(addr string) error {
+	client, err := network.DialMiner(addr, n.Auth)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	n.mu.RLock()
+	local := n.headers
+	n.mu.RUnlock()
+
+	// Ask from the local tip, so a page not starting with it reveals a fork
+	base := max(len(local)-1, 0)
+	page, length, err := fetchPage(client, int64(base))
+	if err != nil {
+		return err
+	}
+	if length <= len(local) {
+		return nil
+	}
+	if len(local) > 0 && (len(page) == 0 || page[0].Hash != local[base].Hash) {
+		base = 0
+		if page, _, err = fetchPage(client, 0); err != nil {
+			return err
+		}
+	}
+
+	chain := append([]network.BlockHeader{}, local[:base]...)
+	for {
+		for _, h := range page {
+			if err := n.check(h, chain); err != nil {
+				return fmt.Errorf("%w: header #%d: %w", network.ErrInvalidPeerChain, h.Index, err)
+			}
+			chain = append(chain, h)
+		}
+		if len(page) == 0 || len(chain) >= length {
+			break
+		}
+		if page, _, err = fetchPage(client, int64(len(chain))); err != nil {
+			return err
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(chain) > len(n.headers) {
+		n.headers = chain
+		if n.Genesis == "" {
+			n.Genesis = chain[0].Hash // Later chains must share it
+		}
+	}
+	return nil
+}
+
+// fetchPage requests the headers from start and the chain length the miner
+// advertises
+func fetchPage(client *rpc.Client, start int64) ([]network.BlockHeader, int, error) {
+	var reply network.HeadersReply
+	args := &network.HeadersArgs{StartIndex: start, Count: network.MaxHeadersPerRequest}
+	if err := client.Call("RPCService.GetHeaders", args, &reply); err != nil {
+		return nil, 0, err
+	}
+	return reply.Headers, reply.Length, nil
+}
+
+// check checks that h extends chain: a genesis header must match the
+// required one, if any, and every later header must link to its predecessor
+// and meet its proof of work
+func (n *Node) check(h network.BlockHeader, chain []network.BlockHeader) error {
+	if len(chain) == 0 {
+		if h.Index != 0 {
+			return fmt.Errorf("expected the genesis header, got #%d", h.Index)
+		}
+		if n.Genesis != "" && h.Hash != n.Genesis {
+			return fmt.Errorf("%w: %s", ErrGenesisMismatch, h.Hash)
+		}
+		return nil
+	}
+	return network.CheckHeaderLink(h, chain[len(chain)-1])
+}
+
+// Inclusion is a transaction verified to be in the local header chain
+type Inclusion struct {
+	TxID          string
+	BlockHeight   int64
+	BlockHash     string
+	Confirmations int64  // Headers from the including one to the local tip, both included
+	Miner         string // The miner that served the proof
+	Proof         *network.SPVProofReply
+}
+
+// VerifyTransaction asks the miners in turn for a proof that a transaction
+// is confirmed and checks it against the local headers, syncing first if the
+// proof names a block beyond the local tip. The first proof that checks out
+// is returned; the errors of every miner otherwise.
+func (n *Node) VerifyTransaction(txID string) (*Inclusion, error) {
+	var errs []error
+	for _, addr := range n.Miners {
+		inc, err := n.verifyFrom(addr, txID)
+		if err == nil {
+			return inc, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (n *Node) verifyFrom(addr, txID string) (*Inclusion, error) {
+	client, err := network.DialMiner(addr, n.Auth)
+	if err != nil {
+		return nil, err
+	}
+	var proof network.SPVProofReply
+	err = client.Call("RPCService.GetSPVProof", &network.SPVProofArgs{TxID: txID}, &proof)
+	client.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if tip, _ := n.Tip(); proof.BlockHeight > tip.Index || n.Length() == 0 {
+		n.Sync()
+	}
+	if err := n.CheckProof(txID, &proof); err != nil {
+		return nil, err
+	}
+	tip, _ := n.Tip()
+	return &Inclusion{
+		TxID:          txID,
+		BlockHeight:   proof.BlockHeight,
+		BlockHash:     proof.BlockHash,
+		Confirmations: tip.Index - proof.BlockHeight + 1,
+		Miner:         addr,
+		Proof:         &proof,
+	}, nil
+}
+
+// CheckProof checks that a proof shows txID in a block of the local header
+// chain: the proven transaction must hash to txID, and hashing txID up
+// through the siblings must give the Merkle root of the local header at the
+// proof's height, which must be the block the proof names
+func (n *Node) CheckProof(txID string, proof *network.SPVProofReply) error {
+	if proof.Transaction == nil || proof.Transaction.ID != txID || proof.Transaction.CalculateHash() != txID {
+		return fmt.Errorf("%w: transaction does not hash to %s", ErrInvalidProof, txID)
+	}
+	header, ok := n.Header(proof.BlockHeight)
+	if !ok {
+		if n.Length() == 0 {
+			return ErrNoHeaders
+		}
+		return fmt.Errorf("%w: no local header at height %d", ErrInvalidProof, proof.BlockHeight)
+	}
+	if header.Hash != proof.BlockHash {
+		return fmt.Errorf("%w: block %s is not in the local chain at height %d", ErrInvalidProof, proof.BlockHash, proof.BlockHeight)
+	}
+	if header.MerkleRoot == "" {
+		return fmt.Errorf("%w: header #%d has no Merkle root", ErrInvalidProof, header.Index)
+	}
+	if !merkle.VerifyProofWithRoot(txID, header.MerkleRoot, proof.Siblings, proof.Directions) {
+		return fmt.Errorf("%w: path does not lead to header #%d's Merkle root", ErrInvalidProof, header.Index)
+	}
+	return nil
+}
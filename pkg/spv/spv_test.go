@@ -0,0 +1,102 @@
+package spv
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/network"
+	"blockchain/pkg/testchain"
+	"errors"
+	"testing"
+)
+
+// serve starts a full miner holding chain
+func serve(t *testing.T, addr string, chain *blockchain.Blockchain) {
+	m := network.NewMiner("full-"+addr, addr, 1, nil)
+	m.Blockchain = chain
+	if err := m.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	t.Cleanup(m.Stop)
+}
+
+func TestVerifyTransactionFromHeaders(t *testing.T) {
+	b := testchain.New(t, 1)
+	b.Fund("alice", 1)
+	tx := b.Pay("alice", "bob", 1000, 100)
+	b.Mine(3)
+	serve(t, "localhost:19143", b.Chain())
+
+	node := NewNode([]string{"localhost:19143"}, "")
+	if err := node.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if tip, _ := node.Tip(); node.Length() != 5 || tip.Hash != b.Chain().GetLatestBlock().Hash {
+		t.Fatalf("Expected the miner's 5 headers, got %d ending at %+v", node.Length(), tip)
+	}
+
+	inc, err := node.VerifyTransaction(tx.ID)
+	if err != nil {
+		t.Fatalf("VerifyTransaction failed: %v", err)
+	}
+	if inc.BlockHeight != 2 || inc.Confirmations != 3 || inc.Miner != "localhost:19143" {
+		t.Errorf("Expected inclusion at height 2 with 3 confirmations, got %+v", inc)
+	}
+	if _, err := node.VerifyTransaction("nonexistent"); err == nil {
+		t.Error("Expected an unknown transaction to fail verification")
+	}
+
+	// Tampering with any part of the proof breaks it
+	tampered := *inc.Proof
+	tampered.Siblings = append([]string{}, inc.Proof.Siblings...)
+	tampered.Siblings[0] = inc.Proof.BlockHash
+	if err := node.CheckProof(tx.ID, &tampered); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected a tampered sibling to be caught, got %v", err)
+	}
+	tampered = *inc.Proof
+	tampered.BlockHash = b.Blocks()[3].Hash
+	if err := node.CheckProof(tx.ID, &tampered); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected a proof naming another block to be caught, got %v", err)
+	}
+	tampered = *inc.Proof
+	fake := *tx
+	fake.Outputs = append(fake.Outputs[:0:0], fake.Outputs...)
+	fake.Outputs[0].Value *= 1000
+	tampered.Transaction = &fake
+	if err := node.CheckProof(tx.ID, &tampered); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected a transaction not hashing to its ID to be caught, got %v", err)
+	}
+}
+
+func TestSyncFollowsLongestChain(t *testing.T) {
+	b := testchain.New(t, 1)
+	b.Fund("alice", 1)
+	tx := b.Pay("alice", "bob", 1000, 100)
+	b.Mine(3)
+	fork := b.Fork(1).Mine(5) // Drops the block holding tx
+	serve(t, "localhost:19144", b.Chain())
+	serve(t, "localhost:19145", fork.Chain())
+
+	node := NewNode([]string{"localhost:19144"}, "")
+	if err := node.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, err := node.VerifyTransaction(tx.ID); err != nil {
+		t.Fatalf("Expected tx verified on the first chain: %v", err)
+	}
+
+	// The longer branch replaces the local chain from the fork point
+	node.Miners = append(node.Miners, "localhost:19145")
+	if err := node.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if tip, _ := node.Tip(); tip.Hash != fork.Chain().GetLatestBlock().Hash {
+		t.Fatalf("Expected the longer branch's tip, got %+v", tip)
+	}
+	if _, err := node.VerifyTransaction(tx.ID); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected the proof of a block off the local chain to be refused, got %v", err)
+	}
+
+	stranger := NewNode([]string{"localhost:19144"}, "not-the-genesis")
+	if err := stranger.Sync(); !errors.Is(err, ErrGenesisMismatch) || stranger.Length() != 0 {
+		t.Errorf("Expected a chain from another genesis to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"blockchain/pkg/block"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// BlockCache keeps blocks a client downloaded on disk, one file per block
+// keyed by hash, plus the chain they form for each genesis block seen. Unlike
+// Store it is only a cache: a missing or damaged entry just cuts the cached
+// chain short, and the blocks past it are downloaded again.
+type BlockCache struct {
+	dir string
+}
+
+// OpenBlockCache opens (or creates) a block cache in dir
+func OpenBlockCache(dir string) (*BlockCache, error) {
+	for _, sub := range []string{"blocks", "chains"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create block cache: %v", err)
+		}
+	}
+	return &BlockCache{dir: dir}, nil
+}
+
+// isHash reports whether s is a hex SHA-256 hash. Hashes come from miners and
+// name cache files, so nothing else may reach a path.
+func isHash(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 2*sha256.Size
+}
+
+func (c *BlockCache) blockPath(hash string) string {
+	return filepath.Join(c.dir, "blocks", hash+".json")
+}
+
+func (c *BlockCache) chainPath(genesisHash string) string {
+	return filepath.Join(c.dir, "chains", genesisHash+".json")
+}
+
+// Chain returns the cached chain starting at the genesis block with the given
+// hash. Loading stops at the first block that is missing, is not stored under
+// its own hash, or does not follow its predecessor, so the result is always a
+// linked prefix of what was saved.
+func (c *BlockCache) Chain(genesisHash string) []*block.Block {
+	if !isHash(genesisHash) {
+		return nil
+	}
+	data, err := os.ReadFile(c.chainPath(genesisHash))
+	if err != nil {
+		return nil
+	}
+	var hashes []string
+	if err := json.Unmarshal(data, &hashes); err != nil || len(hashes) == 0 || hashes[0] != genesisHash {
+		return nil
+	}
+
+	var blocks []*block.Block
+	for i, hash := range hashes {
+		data, err := os.ReadFile(c.blockPath(hash))
+		if err != nil {
+			break
+		}
+		b, err := block.DeserializeBlock(data)
+		if err != nil || !isHash(hash) || b.Hash != hash || b.Index != int64(i) {
+			break
+		}
+		if i > 0 && b.PrevHash != blocks[i-1].Hash {
+			break
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// Save caches a chain, writing the blocks not cached yet and recording it as
+// the chain of its genesis block
+func (c *BlockCache) Save(blocks []*block.Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	hashes := make([]string, len(blocks))
+	for i, b := range blocks {
+		if !isHash(b.Hash) {
+			return fmt.Errorf("block #%d has a malformed hash", b.Index)
+		}
+		hashes[i] = b.Hash
+		path := c.blockPath(b.Hash)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		data, err := b.SerializeJSON()
+		if err != nil {
+			return fmt.Errorf("failed to serialize block: %v", err)
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return fmt.Errorf("failed to encode chain: %v", err)
+	}
+	return writeFileAtomic(c.chainPath(blocks[0].Hash), data)
+}
+
+// writeFileAtomic replaces path with data, so readers see the old contents
+// or the new, never a mix
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", filepath.Base(path), err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to install %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
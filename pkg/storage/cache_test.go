@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"blockchain/pkg/blockchain"
+	"os"
+	"testing"
+)
+
+func TestBlockCacheSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenBlockCache(dir)
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	bc := blockchain.NewBlockchain(1)
+	for i := 0; i < 3; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	blocks := bc.GetBlocks()
+	if err := cache.Save(blocks); err != nil {
+		t.Fatalf("Failed to save chain: %v", err)
+	}
+
+	cached := cache.Chain(blocks[0].Hash)
+	if len(cached) != 4 || cached[3].Hash != blocks[3].Hash {
+		t.Fatalf("Expected the 4 saved blocks, got %d", len(cached))
+	}
+	if cache.Chain("../chains/x") != nil || cache.Chain(blocks[1].Hash) != nil {
+		t.Error("An unknown genesis should have no cached chain")
+	}
+
+	// A damaged block cuts the chain short at that height
+	if err := os.WriteFile(cache.blockPath(blocks[2].Hash), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cached := cache.Chain(blocks[0].Hash); len(cached) != 2 {
+		t.Errorf("Expected the 2 blocks below the damaged one, got %d", len(cached))
+	}
+}
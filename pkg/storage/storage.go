@@ -0,0 +1,450 @@
+// Package storage implements crash-safe on-disk persistence of the chain
+package storage
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/transaction"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// BlocksFile is the append-only log of connected blocks, each a record of
+	// its length and CRC-32 (4 bytes each, big-endian) and its binary encoding
+	BlocksFile = "blocks.dat"
+
+	// LegacyBlocksFile is the block log of older versions (one JSON block per
+	// line), which Open migrates to BlocksFile
+	LegacyBlocksFile = "blocks.jsonl"
+
+	// WALFile holds the pending chain change that is being applied
+	WALFile = "wal.json"
+)
+
+// WAL operations
+const (
+	OpConnect = "connect"
+	OpReplace = "replace"
+)
+
+var (
+	ErrCorruptWAL = errors.New("corrupt write-ahead log")
+)
+
+// walRecord is the intent written to the WAL before a change is applied
+type walRecord struct {
+	Op     string                 `json:"op"`
+	Block  *block.Block           `json:"block,omitempty"`
+	Delta  *transaction.UTXODelta `json:"delta,omitempty"`
+	Blocks []*block.Block         `json:"blocks,omitempty"`
+}
+
+// RecoveryInfo describes what Open had to repair to reach a consistent tip
+type RecoveryInfo struct {
+	TruncatedBytes int64 // Bytes of a torn trailing block record discarded
+	RolledForward  bool  // A pending WAL change was completed
+	RolledBack     bool  // A pending WAL change was discarded
+}
+
+// Store persists the chain to a data directory
+type Store struct {
+	dir    string
+	blocks *os.File
+	tip    *block.Block
+	mu     sync.Mutex
+}
+
+// Open opens (or creates) a data directory, repairs any torn state left by a
+// crash, and returns the store together with the recovered chain.
+func Open(dir string) (*Store, []*block.Block, *RecoveryInfo, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create data dir: %v", err)
+	}
+
+	s := &Store{dir: dir}
+	if err := s.migrateLegacyBlocks(); err != nil {
+		s.Close()
+		return nil, nil, nil, err
+	}
+
+	info := &RecoveryInfo{}
+	blocks, err := loadBlocks(filepath.Join(dir, BlocksFile), info)
+	if err != nil {
+		s.Close()
+		return nil, nil, nil, err
+	}
+
+	if s.blocks == nil {
+		if err := s.openBlocksFile(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if len(blocks) > 0 {
+		s.tip = blocks[len(blocks)-1]
+	}
+
+	blocks, err = s.recoverWAL(blocks, info)
+	if err != nil {
+		s.Close()
+		return nil, nil, nil, err
+	}
+
+	return s, blocks, info, nil
+}
+
+// migrateLegacyBlocks rewrites a JSON-lines block log left by an older
+// version as BlocksFile. The legacy log is removed only once its blocks are
+// durable in the new one, so a crash midway migrates again on the next Open.
+func (s *Store) migrateLegacyBlocks() error {
+	legacy := filepath.Join(s.dir, LegacyBlocksFile)
+	if _, err := os.Stat(legacy); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, BlocksFile)); err == nil {
+		// Migrated already; only the removal was lost
+		return os.Remove(legacy)
+	}
+
+	blocks, err := loadLegacyBlocks(legacy)
+	if err != nil {
+		return err
+	}
+	if len(blocks) > 0 {
+		if err := s.rewriteBlocks(blocks); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(legacy); err != nil {
+		return fmt.Errorf("failed to remove legacy block log: %v", err)
+	}
+	syncDir(s.dir)
+	return nil
+}
+
+// loadLegacyBlocks reads a JSON-lines block log up to its first bad line,
+// dropping a torn final line as older versions did
+func loadLegacyBlocks(path string) ([]*block.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy block log: %v", err)
+	}
+	var blocks []*block.Block
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		b, err := block.DeserializeBlock(line)
+		if err != nil {
+			break
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// recordHeaderSize is the length and CRC-32 before each block log record
+const recordHeaderSize = 8
+
+// encodeRecord frames a block as a block log record
+func encodeRecord(b *block.Block) ([]byte, error) {
+	data, err := b.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize block: %v", err)
+	}
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(data))
+	return append(record, data...), nil
+}
+
+// loadBlocks reads the block log, truncating a partially written final record
+func loadBlocks(path string, info *RecoveryInfo) ([]*block.Block, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open block log: %v", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat block log: %v", err)
+	}
+
+	var blocks []*block.Block
+	var goodOffset int64
+	reader := bufio.NewReader(file)
+	header := make([]byte, recordHeaderSize)
+	for stat.Size()-goodOffset >= recordHeaderSize {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, fmt.Errorf("failed to read block log: %v", err)
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		if size > stat.Size()-goodOffset-recordHeaderSize {
+			break // Torn before the record's end
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("failed to read block log: %v", err)
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		b, err := block.DeserializeBlock(data)
+		if err != nil {
+			break
+		}
+		blocks = append(blocks, b)
+		goodOffset += recordHeaderSize + size
+	}
+
+	if stat.Size() > goodOffset {
+		info.TruncatedBytes = stat.Size() - goodOffset
+		if err := file.Truncate(goodOffset); err != nil {
+			return nil, fmt.Errorf("failed to truncate torn block log: %v", err)
+		}
+		if err := file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	return blocks, nil
+}
+
+// recoverWAL completes or discards a change that was interrupted by a crash
+func (s *Store) recoverWAL(blocks []*block.Block, info *RecoveryInfo) ([]*block.Block, error) {
+	data, err := os.ReadFile(s.walPath())
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return blocks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL: %v", err)
+	}
+
+	var rec walRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		// The WAL itself was torn, so the change never started being applied
+		info.RolledBack = true
+		return blocks, s.clearWAL()
+	}
+
+	switch rec.Op {
+	case OpConnect:
+		if rec.Block == nil {
+			return nil, ErrCorruptWAL
+		}
+		switch {
+		case s.tip != nil && s.tip.Hash == rec.Block.Hash:
+			// Block reached the log; only the WAL clear was lost
+		case s.extendsTip(rec.Block) && deltaApplies(blocks, rec.Delta):
+			if err := s.appendBlock(rec.Block); err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, rec.Block)
+			info.RolledForward = true
+		default:
+			info.RolledBack = true
+		}
+	case OpReplace:
+		if len(rec.Blocks) == 0 {
+			return nil, ErrCorruptWAL
+		}
+		if err := s.rewriteBlocks(rec.Blocks); err != nil {
+			return nil, err
+		}
+		blocks = rec.Blocks
+		info.RolledForward = true
+	default:
+		return nil, ErrCorruptWAL
+	}
+
+	return blocks, s.clearWAL()
+}
+
+// extendsTip reports whether b connects directly on top of the stored tip
+func (s *Store) extendsTip(b *block.Block) bool {
+	if s.tip == nil {
+		return b.Index == 0
+	}
+	return b.Index == s.tip.Index+1 && b.PrevHash == s.tip.Hash
+}
+
+// deltaApplies checks that every output the delta spends from the existing
+// chain is still unspent, so rolling the block forward is consistent.
+func deltaApplies(blocks []*block.Block, delta *transaction.UTXODelta) bool {
+	if delta == nil {
+		return true
+	}
+	utxoSet := transaction.NewUTXOSet()
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			utxoSet.ProcessTransaction(tx)
+		}
+	}
+	created := make(map[string]bool)
+	for _, utxo := range delta.Created {
+		created[fmt.Sprintf("%s:%d", utxo.TxID, utxo.OutIndex)] = true
+	}
+	for _, spent := range delta.Spent {
+		if created[fmt.Sprintf("%s:%d", spent.TxID, spent.OutIndex)] {
+			continue
+		}
+		existing := utxoSet.FindUTXO(spent.TxID, spent.OutIndex)
+		if existing == nil || existing.Value != spent.Value || existing.ScriptPubKey != spent.ScriptPubKey {
+			return false
+		}
+	}
+	return true
+}
+
+// ConnectBlock durably appends a block: WAL first, then the block log
+func (s *Store) ConnectBlock(b *block.Block, delta *transaction.UTXODelta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writeWAL(&walRecord{Op: OpConnect, Block: b, Delta: delta}); err != nil {
+		return err
+	}
+	if err := s.appendBlock(b); err != nil {
+		return err
+	}
+	return s.clearWAL()
+}
+
+// ReplaceChain durably replaces the whole stored chain
+func (s *Store) ReplaceChain(blocks []*block.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writeWAL(&walRecord{Op: OpReplace, Blocks: blocks}); err != nil {
+		return err
+	}
+	if err := s.rewriteBlocks(blocks); err != nil {
+		return err
+	}
+	return s.clearWAL()
+}
+
+// Close closes the block log
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.blocks == nil {
+		return nil
+	}
+	err := s.blocks.Close()
+	s.blocks = nil
+	return err
+}
+
+func (s *Store) walPath() string {
+	return filepath.Join(s.dir, WALFile)
+}
+
+func (s *Store) openBlocksFile() error {
+	file, err := os.OpenFile(filepath.Join(s.dir, BlocksFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open block log: %v", err)
+	}
+	s.blocks = file
+	return nil
+}
+
+func (s *Store) appendBlock(b *block.Block) error {
+	record, err := encodeRecord(b)
+	if err != nil {
+		return err
+	}
+	if _, err := s.blocks.Write(record); err != nil {
+		return fmt.Errorf("failed to append block: %v", err)
+	}
+	if err := s.blocks.Sync(); err != nil {
+		return fmt.Errorf("failed to sync block log: %v", err)
+	}
+	s.tip = b
+	return nil
+}
+
+// rewriteBlocks atomically swaps the block log for the given chain
+func (s *Store) rewriteBlocks(blocks []*block.Block) error {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		record, err := encodeRecord(b)
+		if err != nil {
+			return err
+		}
+		buf.Write(record)
+	}
+
+	path := filepath.Join(s.dir, BlocksFile)
+	if err := writeFileSync(path+".tmp", buf.Bytes()); err != nil {
+		return err
+	}
+	if s.blocks != nil {
+		s.blocks.Close()
+		s.blocks = nil
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to install block log: %v", err)
+	}
+	syncDir(s.dir)
+	if err := s.openBlocksFile(); err != nil {
+		return err
+	}
+	s.tip = blocks[len(blocks)-1]
+	return nil
+}
+
+func (s *Store) writeWAL(rec *walRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode WAL record: %v", err)
+	}
+	if err := writeFileSync(s.walPath(), data); err != nil {
+		return err
+	}
+	syncDir(s.dir)
+	return nil
+}
+
+func (s *Store) clearWAL() error {
+	if err := os.Remove(s.walPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear WAL: %v", err)
+	}
+	syncDir(s.dir)
+	return nil
+}
+
+// writeFileSync writes data to path and fsyncs it before returning
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", filepath.Base(path), err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %v", filepath.Base(path), err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %v", filepath.Base(path), err)
+	}
+	return file.Close()
+}
+
+// syncDir fsyncs a directory so renames and removals are durable
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
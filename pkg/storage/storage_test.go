@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createValidBlock(bc *blockchain.Blockchain, minerID string) *block.Block {
+	coinbase := transaction.NewCoinbaseTransaction(minerID, 5000000000, bc.GetLatestBlock().Index+1)
+	newBlock := bc.CreateBlock([]*transaction.Transaction{coinbase}, minerID)
+	for nonce := int64(0); ; nonce++ {
+		newBlock.Nonce = nonce
+		hash := newBlock.CalculateHash()
+		if pow.ValidateHash(hash, bc.Difficulty) {
+			newBlock.Hash = hash
+			return newBlock
+		}
+	}
+}
+
+// newPersistedChain creates a chain backed by a store in dir with n mined blocks
+func newPersistedChain(t *testing.T, dir string, n int) (*blockchain.Blockchain, *Store) {
+	store, blocks, _, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if len(blocks) != 0 {
+		t.Fatalf("Expected empty store, got %d blocks", len(blocks))
+	}
+
+	bc := blockchain.NewBlockchain(2)
+	if err := store.ReplaceChain(bc.GetBlocks()); err != nil {
+		t.Fatalf("Failed to persist genesis: %v", err)
+	}
+	bc.SetStore(store)
+
+	for i := 0; i < n; i++ {
+		if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+			t.Fatalf("Failed to add block: %v", err)
+		}
+	}
+	return bc, store
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	bc, store := newPersistedChain(t, dir, 3)
+	store.Close()
+
+	store, blocks, info, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if len(blocks) != 4 {
+		t.Fatalf("Expected 4 blocks, got %d", len(blocks))
+	}
+	if blocks[3].Hash != bc.GetLatestBlock().Hash {
+		t.Error("Recovered tip does not match")
+	}
+	if info.TruncatedBytes != 0 || info.RolledForward || info.RolledBack {
+		t.Errorf("Clean shutdown should need no recovery, got %+v", info)
+	}
+}
+
+func TestStoreTruncatesTornBlock(t *testing.T) {
+	dir := t.TempDir()
+	_, store := newPersistedChain(t, dir, 2)
+	store.Close()
+
+	// Simulate a crash halfway through appending a block record
+	f, _ := os.OpenFile(filepath.Join(dir, BlocksFile), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"index":3,"timestamp":12`)
+	f.Close()
+
+	store, blocks, info, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if len(blocks) != 3 {
+		t.Errorf("Expected 3 intact blocks, got %d", len(blocks))
+	}
+	if info.TruncatedBytes == 0 {
+		t.Error("Torn record should have been truncated")
+	}
+}
+
+func TestStoreRollsForwardPendingConnect(t *testing.T) {
+	dir := t.TempDir()
+	bc, store := newPersistedChain(t, dir, 2)
+
+	// Crash after the WAL write but before the block reached the log
+	next := createValidBlock(bc, "miner1")
+	delta := bc.GetUTXOSet().ComputeDelta(next.Transactions)
+	if err := store.writeWAL(&walRecord{Op: OpConnect, Block: next, Delta: delta}); err != nil {
+		t.Fatalf("Failed to write WAL: %v", err)
+	}
+	store.Close()
+
+	store, blocks, info, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if !info.RolledForward {
+		t.Error("Pending connect should be rolled forward")
+	}
+	if len(blocks) != 4 || blocks[3].Hash != next.Hash {
+		t.Fatalf("Expected pending block to be the new tip")
+	}
+	if _, err := os.Stat(filepath.Join(dir, WALFile)); !os.IsNotExist(err) {
+		t.Error("WAL should be cleared after recovery")
+	}
+
+	// The recovered chain must be a valid chain
+	if err := blockchain.NewBlockchainFromBlocks(blocks, 2).ValidateChain(); err != nil {
+		t.Errorf("Recovered chain is invalid: %v", err)
+	}
+}
+
+func TestStoreRollsBackStaleConnect(t *testing.T) {
+	dir := t.TempDir()
+	bc, store := newPersistedChain(t, dir, 2)
+
+	// A WAL entry for a block that doesn't extend the stored tip
+	stale := createValidBlock(bc, "miner1")
+	stale.PrevHash = "deadbeef"
+	store.writeWAL(&walRecord{Op: OpConnect, Block: stale})
+	store.Close()
+
+	store, blocks, info, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if !info.RolledBack {
+		t.Error("Stale connect should be rolled back")
+	}
+	if len(blocks) != 3 {
+		t.Errorf("Expected 3 blocks after rollback, got %d", len(blocks))
+	}
+}
+
+func TestStoreRedoesPendingReplace(t *testing.T) {
+	dir := t.TempDir()
+	_, store := newPersistedChain(t, dir, 1)
+
+	other := blockchain.NewBlockchain(2)
+	for i := 0; i < 3; i++ {
+		other.AddBlock(createValidBlock(other, "miner2"))
+	}
+	data, _ := json.Marshal(&walRecord{Op: OpReplace, Blocks: other.GetBlocks()})
+	os.WriteFile(filepath.Join(dir, WALFile), data, 0644)
+	store.Close()
+
+	store, blocks, info, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if !info.RolledForward {
+		t.Error("Pending replace should be redone")
+	}
+	if len(blocks) != 4 || blocks[3].Hash != other.GetLatestBlock().Hash {
+		t.Error("Stored chain should match the replacement chain")
+	}
+}
+
+func TestStoreMigratesLegacyLog(t *testing.T) {
+	dir := t.TempDir()
+	bc := blockchain.NewBlockchain(2)
+	for i := 0; i < 2; i++ {
+		bc.AddBlock(createValidBlock(bc, "miner1"))
+	}
+
+	// A JSON-lines log as older versions wrote it, torn mid-record
+	var legacy []byte
+	for _, b := range bc.GetBlocks() {
+		data, _ := b.SerializeJSON()
+		legacy = append(append(legacy, data...), '\n')
+	}
+	legacy = append(legacy, `{"index":3,"timestamp":12`...)
+	os.WriteFile(filepath.Join(dir, LegacyBlocksFile), legacy, 0644)
+
+	store, blocks, _, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open legacy store: %v", err)
+	}
+	if len(blocks) != 3 || blocks[2].Hash != bc.GetLatestBlock().Hash {
+		t.Fatalf("Expected the 3 intact legacy blocks, got %d", len(blocks))
+	}
+	if _, err := os.Stat(filepath.Join(dir, LegacyBlocksFile)); !os.IsNotExist(err) {
+		t.Error("Legacy log should be removed once migrated")
+	}
+
+	// The migrated log takes appends and reopens in the new format
+	bc.SetStore(store)
+	if err := bc.AddBlock(createValidBlock(bc, "miner1")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	store.Close()
+	store, blocks, _, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	if len(blocks) != 4 {
+		t.Fatalf("Expected 4 blocks after reopening, got %d", len(blocks))
+	}
+	if err := blockchain.NewBlockchainFromBlocks(blocks, 2).ValidateChain(); err != nil {
+		t.Errorf("Migrated chain is invalid: %v", err)
+	}
+}
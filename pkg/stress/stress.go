@@ -0,0 +1,322 @@
+// Package stress generates chains of blocks packed with signed transactions
+// and measures how long each phase of validating them takes, as a baseline
+// for work on validation throughput
+package stress
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Validation phases, in the order a received block goes through them
+const (
+	PhaseDeserialize = "deserialize" // JSON decoding of the block
+	PhaseHeader      = "header"      // Hash and proof of work
+	PhaseMerkle      = "merkle"      // Rebuilding the Merkle root from the transactions
+	PhaseSignatures  = "signatures"  // UTXO lookups and ECDSA verification of every input
+	PhaseUTXO        = "utxo"        // Copying the UTXO set and applying the block to it
+)
+
+// Phases lists the measured phases in report order
+var Phases = []string{PhaseDeserialize, PhaseHeader, PhaseMerkle, PhaseSignatures, PhaseUTXO}
+
+// fee is what every generated transaction pays
+const fee = 1
+
+// Config describes the chain to generate
+type Config struct {
+	Blocks        int  `json:"blocks"`          // Blocks to validate
+	TxsPerBlock   int  `json:"txs_per_block"`   // Signed transactions per block, besides the coinbase
+	Keys          int  `json:"keys"`            // Distinct signing keys the transactions rotate through
+	UseMerkleTree bool `json:"use_merkle_tree"` // Hash blocks through their Merkle root
+}
+
+// DefaultConfig returns a config of a few blocks with thousands of transactions each
+func DefaultConfig() Config {
+	return Config{Blocks: 5, TxsPerBlock: 2000, Keys: 16, UseMerkleTree: true}
+}
+
+// Fixture is a generated chain: a base that funds TxsPerBlock outputs, and
+// serialized blocks on top of it whose transactions each spend one of the
+// previous block's outputs
+type Fixture struct {
+	Config Config
+	Base   []*block.Block // Genesis and the funding blocks
+	Blocks [][]byte       // Blocks to validate, serialized as received from a peer
+}
+
+// Generate builds a fixture. Blocks are mined at difficulty 1, so proof of
+// work is cheap to produce and check and does not skew the measurements.
+func Generate(cfg Config) (*Fixture, error) {
+	if cfg.Blocks < 1 || cfg.TxsPerBlock < 0 {
+		return nil, fmt.Errorf("need at least one block and no negative transaction count")
+	}
+	if cfg.Keys < 1 {
+		cfg.Keys = 1
+	}
+	keys := make([]*transaction.KeyPair, cfg.Keys)
+	privateKeys := make(map[string]string)
+	for i := range keys {
+		kp, err := transaction.GenerateKeyPair()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %v", err)
+		}
+		keys[i] = kp
+		privateKeys[kp.GetPublicKeyHex()] = kp.GetPrivateKeyHex()
+	}
+
+	chain := blockchain.NewBlockchain(1, blockchain.WithMerkleTree(cfg.UseMerkleTree))
+	funder := keys[0].GetPublicKeyHex()
+	if _, err := mineOnto(chain, nil, funder); err != nil {
+		return nil, err
+	}
+
+	// Split the first coinbase into one output per transaction of a block
+	var spendable []*transaction.UTXO
+	if cfg.TxsPerBlock > 0 {
+		coinbase := chain.GetLatestBlock().Transactions[0]
+		value := (coinbase.Outputs[0].Value - fee) / int64(cfg.TxsPerBlock)
+		if value <= int64(cfg.Blocks)*fee {
+			return nil, fmt.Errorf("%d transactions per block over %d blocks exceed the funding", cfg.TxsPerBlock, cfg.Blocks)
+		}
+		outputs := make([]transaction.TxOutput, cfg.TxsPerBlock)
+		for i := range outputs {
+			outputs[i] = transaction.TxOutput{Value: value, ScriptPubKey: keys[i%len(keys)].GetPublicKeyHex()}
+		}
+		split, err := spend(&transaction.UTXO{TxID: coinbase.ID, ScriptPubKey: funder}, outputs, privateKeys)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := mineOnto(chain, []*transaction.Transaction{split}, funder); err != nil {
+			return nil, err
+		}
+		for i, out := range split.Outputs {
+			spendable = append(spendable, &transaction.UTXO{TxID: split.ID, OutIndex: i, Value: out.Value, ScriptPubKey: out.ScriptPubKey})
+		}
+	}
+	f := &Fixture{Config: cfg, Base: chain.GetBlocks()}
+
+	// Each block moves every output on by one transaction
+	for n := 0; n < cfg.Blocks; n++ {
+		txs := make([]*transaction.Transaction, len(spendable))
+		for i, utxo := range spendable {
+			tx, err := spend(utxo, []transaction.TxOutput{{Value: utxo.Value - fee, ScriptPubKey: utxo.ScriptPubKey}}, privateKeys)
+			if err != nil {
+				return nil, err
+			}
+			txs[i] = tx
+			spendable[i] = &transaction.UTXO{TxID: tx.ID, Value: tx.Outputs[0].Value, ScriptPubKey: utxo.ScriptPubKey}
+		}
+		b, err := mineOnto(chain, txs, funder)
+		if err != nil {
+			return nil, err
+		}
+		data, err := b.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		f.Blocks = append(f.Blocks, data)
+	}
+	return f, nil
+}
+
+// spend signs a transaction moving one UTXO to outputs
+func spend(utxo *transaction.UTXO, outputs []transaction.TxOutput, privateKeys map[string]string) (*transaction.Transaction, error) {
+	tx := transaction.NewUTXOTransaction([]transaction.TxInput{{TxID: utxo.TxID, OutIndex: utxo.OutIndex}}, outputs)
+	if err := tx.SignWithPrivateKeys(map[int]string{0: utxo.ScriptPubKey}, privateKeys); err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	return tx, nil
+}
+
+// mineOnto mines txs into the next block of chain, paying the subsidy and fees to payee
+func mineOnto(chain *blockchain.Blockchain, txs []*transaction.Transaction, payee string) (*block.Block, error) {
+	height := chain.GetLatestBlock().Index + 1
+	reward := chain.Params().SubsidyAt(height) + int64(len(txs))*fee
+	coinbase := transaction.NewCoinbaseTransaction(payee, reward, height)
+	b := chain.CreateBlock(append([]*transaction.Transaction{coinbase}, txs...), payee)
+	pow.NewProofOfWork(b).Mine(context.Background(), nil)
+	if err := chain.AddBlock(b); err != nil {
+		return nil, fmt.Errorf("generated block #%d is invalid: %v", height, err)
+	}
+	return b, nil
+}
+
+// NewChain returns a chain holding the fixture's base, ready to accept Blocks
+func (f *Fixture) NewChain() *blockchain.Blockchain {
+	base := make([]*block.Block, len(f.Base))
+	for i, b := range f.Base {
+		base[i] = b.Clone()
+	}
+	return blockchain.NewBlockchainFromBlocks(base, 1, blockchain.WithMerkleTree(f.Config.UseMerkleTree))
+}
+
+// NewLoadedChain returns a chain holding the base and every block of the
+// fixture, for measuring work done on top of a large UTXO set
+func (f *Fixture) NewLoadedChain() (*blockchain.Blockchain, error) {
+	chain := f.NewChain()
+	for _, data := range f.Blocks {
+		b, err := block.DeserializeBlock(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := chain.AddBlock(b); err != nil {
+			return nil, fmt.Errorf("AddBlock #%d: %v", b.Index, err)
+		}
+	}
+	return chain, nil
+}
+
+// PhaseResult is the time spent in one phase across all blocks
+type PhaseResult struct {
+	Name  string        `json:"name"`
+	Total time.Duration `json:"total_ns"`
+	PerTx time.Duration `json:"per_tx_ns"`
+	Share float64       `json:"share"` // Fraction of the summed phase time
+}
+
+// Report is the outcome of a validation run
+type Report struct {
+	Config     Config        `json:"config"`
+	Blocks     int           `json:"blocks"`
+	Txs        int           `json:"txs"` // Transactions validated, coinbases included
+	Bytes      int           `json:"bytes"`
+	Phases     []PhaseResult `json:"phases"`
+	PhaseTotal time.Duration `json:"phase_total_ns"`
+	AddBlock   time.Duration `json:"add_block_ns"` // Blockchain.AddBlock end to end, after deserialization
+	TxPerSec   float64       `json:"tx_per_sec"`   // Transactions per second through AddBlock
+}
+
+// Run validates every block of the fixture twice: once phase by phase with
+// each phase timed on its own, and once through Blockchain.AddBlock, which is
+// what a miner actually runs and what the phases should add up to.
+func (f *Fixture) Run() (*Report, error) {
+	report := &Report{Config: f.Config, Blocks: len(f.Blocks)}
+	totals := make(map[string]time.Duration)
+	utxo := f.NewChain().GetUTXOSet()
+	timed := func(phase string, fn func() error) error {
+		start := time.Now()
+		err := fn()
+		totals[phase] += time.Since(start)
+		if err != nil {
+			return fmt.Errorf("%s: %v", phase, err)
+		}
+		return nil
+	}
+
+	for _, data := range f.Blocks {
+		report.Bytes += len(data)
+		var b *block.Block
+		err := timed(PhaseDeserialize, func() (err error) {
+			b, err = block.DeserializeBlock(data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.SetMerkleMode(f.Config.UseMerkleTree)
+		report.Txs += len(b.Transactions)
+
+		err = timed(PhaseHeader, func() error {
+			if !b.HasValidHash() || !b.HasValidPoW() {
+				return fmt.Errorf("block #%d has an invalid header", b.Index)
+			}
+			return nil
+		})
+		if err == nil {
+			err = timed(PhaseMerkle, func() error {
+				if b.UsesMerkleTree() && !b.HasValidMerkleRoot() {
+					return fmt.Errorf("block #%d has a mismatched Merkle root", b.Index)
+				}
+				return nil
+			})
+		}
+		if err == nil {
+			err = timed(PhaseSignatures, func() error {
+				for _, tx := range b.Transactions {
+					if err := utxo.ValidateTransaction(tx); err != nil {
+						return fmt.Errorf("block #%d: %v", b.Index, err)
+					}
+				}
+				return nil
+			})
+		}
+		if err == nil {
+			err = timed(PhaseUTXO, func() error {
+				utxo = utxo.Copy()
+				for _, tx := range b.Transactions {
+					utxo.ProcessTransaction(tx)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain := f.NewChain()
+	for _, data := range f.Blocks {
+		b, err := block.DeserializeBlock(data)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		err = chain.AddBlock(b)
+		report.AddBlock += time.Since(start)
+		if err != nil {
+			return nil, fmt.Errorf("AddBlock #%d: %v", b.Index, err)
+		}
+	}
+
+	for _, phase := range Phases {
+		report.PhaseTotal += totals[phase]
+	}
+	for _, phase := range Phases {
+		result := PhaseResult{Name: phase, Total: totals[phase]}
+		if report.Txs > 0 {
+			result.PerTx = totals[phase] / time.Duration(report.Txs)
+		}
+		if report.PhaseTotal > 0 {
+			result.Share = float64(totals[phase]) / float64(report.PhaseTotal)
+		}
+		report.Phases = append(report.Phases, result)
+	}
+	if report.AddBlock > 0 {
+		report.TxPerSec = float64(report.Txs) / report.AddBlock.Seconds()
+	}
+	return report, nil
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Validated %d blocks, %d transactions, %d bytes (Merkle mode: %v)\n\n",
+		r.Blocks, r.Txs, r.Bytes, r.Config.UseMerkleTree)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "phase\ttotal\tper tx\tshare\t")
+	for _, p := range r.Phases {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%.1f%%\t\n", p.Name, p.Total.Round(time.Microsecond), p.PerTx, 100*p.Share)
+	}
+	fmt.Fprintf(tw, "sum\t%v\t\t\t\n", r.PhaseTotal.Round(time.Microsecond))
+	fmt.Fprintf(tw, "AddBlock\t%v\t\t\t\n", r.AddBlock.Round(time.Microsecond))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nThroughput: %.0f tx/s through AddBlock\n", r.TxPerSec)
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,106 @@
+package stress
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/transaction"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRunReportsEveryPhase(t *testing.T) {
+	f, err := Generate(Config{Blocks: 2, TxsPerBlock: 20, Keys: 3, UseMerkleTree: true})
+	if err != nil {
+		t.Fatalf("Failed to generate fixture: %v", err)
+	}
+	report, err := f.Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if report.Blocks != 2 || report.Txs != 2*21 {
+		t.Errorf("Expected 2 blocks and 42 transactions, got %d and %d", report.Blocks, report.Txs)
+	}
+	if len(report.Phases) != len(Phases) {
+		t.Fatalf("Expected %d phases, got %d", len(Phases), len(report.Phases))
+	}
+	for i, p := range report.Phases {
+		if p.Name != Phases[i] || p.Total <= 0 {
+			t.Errorf("Phase %d: got %+v", i, p)
+		}
+	}
+	if report.AddBlock <= 0 || report.TxPerSec <= 0 {
+		t.Errorf("AddBlock should have been timed: %+v", report)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if !strings.Contains(text.String(), PhaseSignatures) || !strings.Contains(text.String(), "tx/s") {
+		t.Errorf("Text report is missing fields:\n%s", text.String())
+	}
+}
+
+func TestGenerateCoinbaseOnlyBlocks(t *testing.T) {
+	f, err := Generate(Config{Blocks: 3, UseMerkleTree: false})
+	if err != nil {
+		t.Fatalf("Failed to generate fixture: %v", err)
+	}
+	if _, err := f.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
+
+// BenchmarkAddBlock measures Blockchain.AddBlock on received blocks by size
+func BenchmarkAddBlock(b *testing.B) {
+	for _, txs := range []int{0, 100, 1000} {
+		b.Run(fmt.Sprintf("txs=%d", txs), func(b *testing.B) {
+			f, err := Generate(Config{Blocks: 1, TxsPerBlock: txs, Keys: 16, UseMerkleTree: true})
+			if err != nil {
+				b.Fatalf("Failed to generate fixture: %v", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				chain := f.NewChain()
+				blk, _ := block.DeserializeBlock(f.Blocks[0])
+				b.StartTimer()
+				if err := chain.AddBlock(blk); err != nil {
+					b.Fatalf("AddBlock failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCoinbaseOnly measures validating an empty block on top of a chain
+// with thousands of unspent outputs
+func BenchmarkCoinbaseOnly(b *testing.B) {
+	f, err := Generate(Config{Blocks: 1, TxsPerBlock: 2000, Keys: 16, UseMerkleTree: true})
+	if err != nil {
+		b.Fatalf("Failed to generate fixture: %v", err)
+	}
+	chain, err := f.NewLoadedChain()
+	if err != nil {
+		b.Fatalf("Failed to load chain: %v", err)
+	}
+	height := chain.GetLatestBlock().Index + 1
+	coinbase := transaction.NewCoinbaseTransaction("miner", blockchain.BaseSubsidy, height)
+	empty := chain.CreateBlock([]*transaction.Transaction{coinbase}, "miner")
+
+	b.Run("validate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := chain.ValidateBlockTransactions(empty); err != nil {
+				b.Fatalf("Validation failed: %v", err)
+			}
+		}
+	})
+	b.Run("merkle-root", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			empty.CalculateMerkleRoot()
+		}
+	})
+}
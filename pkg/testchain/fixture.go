@@ -0,0 +1,83 @@
+package testchain
+
+import (
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/storage"
+	"blockchain/pkg/transaction"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// WalletsFile holds a fixture's wallets as a JSON object of name ->
+// private key hex, next to the chain in storage.BlocksFile
+const WalletsFile = "wallets.json"
+
+// WriteFixture writes the chain to dir in the layout of a miner's data
+// directory, so LoadFixture, storage.Open, and miners started on it with
+// -datadir all read it, and the wallets to WalletsFile in the same
+// directory. Pending transactions are not written.
+func (b *Builder) WriteFixture(dir string) {
+	b.t.Helper()
+	store, _, _, err := storage.Open(dir)
+	if err != nil {
+		b.t.Fatalf("testchain: %v", err)
+	}
+	defer store.Close()
+	if err := store.ReplaceChain(b.Blocks()); err != nil {
+		b.t.Fatalf("testchain: failed to write chain: %v", err)
+	}
+
+	keys := make(map[string]string, len(b.wallets))
+	for name, kp := range b.wallets {
+		keys[name] = kp.GetPrivateKeyHex()
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		b.t.Fatalf("testchain: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, WalletsFile), data, 0600); err != nil {
+		b.t.Fatalf("testchain: failed to write wallets: %v", err)
+	}
+}
+
+// LoadFixture loads a chain and its wallets written by WriteFixture and
+// returns a builder to extend it. The chain is validated with opts, which
+// should match those it was built with.
+func LoadFixture(t testing.TB, dir string, opts ...blockchain.Option) *Builder {
+	t.Helper()
+	store, blocks, _, err := storage.Open(dir)
+	if err != nil {
+		t.Fatalf("testchain: %v", err)
+	}
+	store.Close()
+	if len(blocks) == 0 {
+		t.Fatalf("testchain: no chain in %s", dir)
+	}
+	chain := blockchain.NewBlockchainFromBlocks(blocks, blocks[len(blocks)-1].Difficulty, opts...)
+	if err := chain.ValidateChain(); err != nil {
+		t.Fatalf("testchain: fixture chain in %s is invalid: %v", dir, err)
+	}
+
+	b := Extend(t, chain)
+	data, err := os.ReadFile(filepath.Join(dir, WalletsFile))
+	if os.IsNotExist(err) {
+		return b
+	}
+	if err != nil {
+		t.Fatalf("testchain: failed to read wallets: %v", err)
+	}
+	var keys map[string]string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		t.Fatalf("testchain: failed to parse wallets: %v", err)
+	}
+	for name, priv := range keys {
+		key, err := transaction.HexToPrivateKey(priv)
+		if err != nil {
+			t.Fatalf("testchain: wallet %s: %v", name, err)
+		}
+		b.wallets[name] = &transaction.KeyPair{PrivateKey: key, PublicKey: &key.PublicKey}
+	}
+	return b
+}
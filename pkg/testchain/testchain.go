@@ -0,0 +1,230 @@
+// Package testchain builds chains of a given shape for tests: heights,
+// forks, and blocks holding chosen transactions and fees, mined and
+// validated like any other block.
+//
+// Coins belong to named wallets, whose key pairs are made on first use, so
+// a test can say "fund alice, then have alice pay bob 1 BTC" without
+// handling keys or UTXOs:
+//
+//	b := testchain.New(t, 1)
+//	b.Fund("alice", 1)
+//	b.Pay("alice", "bob", 100000000, 1000)
+//	b.Mine(1)
+//
+// Chains can be written to a directory as fixtures and loaded back; see
+// WriteFixture.
+package testchain
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"sort"
+	"testing"
+)
+
+// DefaultMiner is the wallet Mine pays coinbases to
+const DefaultMiner = "miner"
+
+// Builder extends a chain one mined block at a time. Transactions queued
+// with Pay, Fees, or Include go into the next block. Failures stop the test.
+type Builder struct {
+	t       testing.TB
+	chain   *blockchain.Blockchain
+	wallets map[string]*transaction.KeyPair // Shared with forks
+	pending []*transaction.Transaction
+	fees    int64                // Fees of the pending transactions
+	view    *transaction.UTXOSet // The chain's UTXO set with pending applied
+}
+
+// New starts a chain holding only its genesis block
+func New(t testing.TB, difficulty int, opts ...blockchain.Option) *Builder {
+	return Extend(t, blockchain.NewBlockchain(difficulty, opts...))
+}
+
+// Extend builds onto an existing chain, such as a miner's
+func Extend(t testing.TB, chain *blockchain.Blockchain) *Builder {
+	return &Builder{
+		t:       t,
+		chain:   chain,
+		wallets: make(map[string]*transaction.KeyPair),
+		view:    chain.GetUTXOSet(),
+	}
+}
+
+// Chain returns the chain being built
+func (b *Builder) Chain() *blockchain.Blockchain {
+	return b.chain
+}
+
+// Blocks returns the chain's blocks, genesis first
+func (b *Builder) Blocks() []*block.Block {
+	return b.chain.GetBlocks()
+}
+
+// Height returns the height of the chain's tip
+func (b *Builder) Height() int64 {
+	return b.chain.GetLatestBlock().Index
+}
+
+// Wallet returns the key pair of the named wallet, making it on first use
+func (b *Builder) Wallet(name string) *transaction.KeyPair {
+	kp, ok := b.wallets[name]
+	if !ok {
+		var err error
+		if kp, err = transaction.GenerateKeyPair(); err != nil {
+			b.t.Fatalf("testchain: failed to generate key pair: %v", err)
+		}
+		b.wallets[name] = kp
+	}
+	return kp
+}
+
+// Address returns the address (public key hex) of the named wallet
+func (b *Builder) Address(name string) string {
+	return b.Wallet(name).GetPublicKeyHex()
+}
+
+// Balance returns what the named wallet owns on chain and in pending transactions
+func (b *Builder) Balance(name string) int64 {
+	return b.view.GetBalance(b.Address(name))
+}
+
+// Mine mines n blocks paying DefaultMiner. The pending transactions go into
+// the first.
+func (b *Builder) Mine(n int) *Builder {
+	return b.MineTo(b.Address(DefaultMiner), n)
+}
+
+// Fund mines n blocks paying their coinbase to the named wallet
+func (b *Builder) Fund(name string, n int) *Builder {
+	return b.MineTo(b.Address(name), n)
+}
+
+// MineTo mines n blocks paying their coinbase, subsidy and fees, to address
+func (b *Builder) MineTo(address string, n int) *Builder {
+	b.t.Helper()
+	for i := 0; i < n; i++ {
+		height := b.Height() + 1
+		reward := b.chain.Options().Params.SubsidyAt(height) + b.fees
+		coinbase := transaction.NewCoinbaseTransaction(address, reward, height)
+		blk := b.chain.CreateBlock(append([]*transaction.Transaction{coinbase}, b.pending...), address)
+		if result := pow.NewProofOfWork(blk).Mine(context.Background(), nil); !result.Success {
+			b.t.Fatalf("testchain: failed to mine block %d", height)
+		}
+		if err := b.chain.AddBlock(blk); err != nil {
+			b.t.Fatalf("testchain: block %d refused: %v", height, err)
+		}
+		b.pending, b.fees = nil, 0
+		b.view = b.chain.GetUTXOSet()
+	}
+	return b
+}
+
+// MineToHeight mines blocks paying DefaultMiner until the tip is at height
+func (b *Builder) MineToHeight(height int64) *Builder {
+	return b.Mine(int(height - b.Height()))
+}
+
+// Pay queues a transaction in which the named wallet from pays value to
+// wallet to and fee to the miner, returning its change to itself. It may
+// spend outputs of transactions already queued.
+func (b *Builder) Pay(from, to string, value, fee int64) *transaction.Transaction {
+	b.t.Helper()
+	return b.spend(from, []transaction.TxOutput{{Value: value, ScriptPubKey: b.Address(to)}}, fee)
+}
+
+// Fees queues one transaction per fee, each paying the named wallet a small
+// amount from itself, to give the next block a chosen fee distribution
+func (b *Builder) Fees(from string, fees ...int64) []*transaction.Transaction {
+	b.t.Helper()
+	var txs []*transaction.Transaction
+	for _, fee := range fees {
+		txs = append(txs, b.spend(from, []transaction.TxOutput{{Value: 1000, ScriptPubKey: b.Address(from)}}, fee))
+	}
+	return txs
+}
+
+// Include queues transactions built elsewhere. They are not checked until
+// the block holding them is added, so invalid ones make the next Mine fail.
+func (b *Builder) Include(txs ...*transaction.Transaction) *Builder {
+	for _, tx := range txs {
+		b.queue(tx)
+	}
+	return b
+}
+
+// spend queues a transaction from the named wallet paying outputs and fee,
+// selecting its spendable outputs oldest-outpoint first
+func (b *Builder) spend(from string, outputs []transaction.TxOutput, fee int64) *transaction.Transaction {
+	b.t.Helper()
+	address := b.Address(from)
+	var need int64 = fee
+	for _, out := range outputs {
+		need += out.Value
+	}
+
+	utxos := b.view.FindUTXOsForAddress(address)
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].TxID != utxos[j].TxID {
+			return utxos[i].TxID < utxos[j].TxID
+		}
+		return utxos[i].OutIndex < utxos[j].OutIndex
+	})
+	var inputs []struct {
+		TxID     string
+		OutIndex int
+	}
+	var total int64
+	for _, utxo := range utxos {
+		if total >= need {
+			break
+		}
+		if !b.view.Matured(utxo) {
+			continue
+		}
+		inputs = append(inputs, struct {
+			TxID     string
+			OutIndex int
+		}{utxo.TxID, utxo.OutIndex})
+		total += utxo.Value
+	}
+	if total < need {
+		b.t.Fatalf("testchain: %s has %d, needs %d", from, total, need)
+	}
+	if change := total - need; change > 0 {
+		outputs = append(outputs, transaction.TxOutput{Value: change, ScriptPubKey: address})
+	}
+
+	tx, err := b.view.CreateTransaction(inputs, outputs, map[string]string{address: b.Wallet(from).GetPrivateKeyHex()})
+	if err != nil {
+		b.t.Fatalf("testchain: failed to create transaction from %s: %v", from, err)
+	}
+	b.queue(tx)
+	return tx
+}
+
+// queue adds tx to the next block, applying it to the view
+func (b *Builder) queue(tx *transaction.Transaction) {
+	b.fees += tx.GetFee(b.view)
+	b.view.ProcessTransaction(tx)
+	b.pending = append(b.pending, tx)
+}
+
+// Fork returns a builder for a branch off the block at height. Blocks mined
+// on it do not touch b's chain; hand them over with ProcessBlock or
+// ReplaceChain to exercise a reorganization. Wallets are shared.
+func (b *Builder) Fork(height int64) *Builder {
+	b.t.Helper()
+	blocks := b.Blocks()
+	if height < 0 || height >= int64(len(blocks)) {
+		b.t.Fatalf("testchain: cannot fork at height %d of a chain of %d blocks", height, len(blocks))
+	}
+	chain := blockchain.NewBlockchainFromBlocks(blocks[:height+1], b.chain.GetDifficulty(),
+		blockchain.WithOptions(b.chain.Options()))
+	fork := Extend(b.t, chain)
+	fork.wallets = b.wallets
+	return fork
+}
@@ -0,0 +1,80 @@
+package testchain
+
+import (
+	"blockchain/pkg/blockchain"
+	"testing"
+)
+
+func TestBuilderPaysAndCollectsFees(t *testing.T) {
+	b := New(t, 1)
+	b.Fund("alice", 2)
+	pay := b.Pay("alice", "bob", 100000000, 5000)
+	spent := b.Pay("bob", "carol", 40000000, 1000)
+	fees := b.Fees("alice", 300, 200, 100)
+	b.Mine(1)
+
+	if b.Height() != 3 {
+		t.Fatalf("Expected height 3, got %d", b.Height())
+	}
+	tip := b.Chain().GetLatestBlock()
+	if len(tip.Transactions) != 6 || tip.Transactions[1].ID != pay.ID || tip.Transactions[2].ID != spent.ID || tip.Transactions[5].ID != fees[2].ID {
+		t.Fatalf("Expected the queued transactions in order, got %d transactions", len(tip.Transactions))
+	}
+	if got := tip.Transactions[0].TotalOutputValue(); got != blockchain.BaseSubsidy+6600 {
+		t.Errorf("Coinbase should collect subsidy and fees, got %d", got)
+	}
+	if b.Balance("bob") != 59999000 || b.Balance("carol") != 40000000 {
+		t.Errorf("Unexpected balances: bob %d, carol %d", b.Balance("bob"), b.Balance("carol"))
+	}
+	if err := b.Chain().ValidateChain(); err != nil {
+		t.Errorf("Built chain should validate: %v", err)
+	}
+}
+
+func TestForkReorganizes(t *testing.T) {
+	b := New(t, 1)
+	b.Fund("alice", 1).MineToHeight(3)
+
+	fork := b.Fork(1)
+	fork.Pay("alice", "bob", 1000000, 1000)
+	fork.Mine(3)
+	if b.Height() != 3 || fork.Height() != 4 {
+		t.Fatalf("Fork should not touch the main chain: heights %d and %d", b.Height(), fork.Height())
+	}
+
+	for _, blk := range fork.Blocks()[2:] {
+		if _, _, err := b.Chain().ProcessBlock(blk); err != nil {
+			t.Fatalf("Failed to process fork block %d: %v", blk.Index, err)
+		}
+	}
+	if b.Chain().GetLatestBlock().Hash != fork.Chain().GetLatestBlock().Hash {
+		t.Error("The longer fork should become the main chain")
+	}
+	if b.Chain().GetBalance(b.Address("bob")) != 1000000 {
+		t.Error("The fork's payment should be confirmed after the reorganization")
+	}
+}
+
+func TestFixtureRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	b := New(t, 1)
+	b.Fund("alice", 1)
+	b.Pay("alice", "bob", 2500, 100)
+	b.Mine(1)
+	b.WriteFixture(dir)
+
+	loaded := LoadFixture(t, dir)
+	if loaded.Height() != 2 || loaded.Chain().GetLatestBlock().Hash != b.Chain().GetLatestBlock().Hash {
+		t.Fatalf("Expected the written chain, got height %d", loaded.Height())
+	}
+	if loaded.Address("bob") != b.Address("bob") || loaded.Balance("bob") != 2500 {
+		t.Fatal("Wallets should survive the round trip")
+	}
+
+	// The loaded wallets can still spend
+	loaded.Pay("bob", "alice", 2000, 100)
+	loaded.Mine(1)
+	if loaded.Balance("bob") != 400 {
+		t.Errorf("Expected bob's change, got %d", loaded.Balance("bob"))
+	}
+}
@@ -0,0 +1,489 @@
+// Package testnet runs a network of real miners in one process for
+// integration tests and demos: each listens on a free local port, every miner
+// is the others' peer, and they share a genesis chain that has already paid
+// coins to named wallets.
+//
+//	tn := testnet.New(t, testnet.Config{Miners: 4, Fund: map[string]int{"alice": 2}})
+//	tn.Pay("alice", "bob", 100000000, 1000)
+//	tn.MineUntilHeight(5)
+//	tn.PartitionNetwork([]int{0, 1}, []int{2, 3})
+//	tn.MineUntilHeight(8)
+//	tn.Heal()
+//	tn.MineUntilHeight(9) // Breaks the tie between the branches
+//	tn.WaitForConsensus()
+//
+// Failures stop the test, as in package testchain.
+package testnet
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/blockchain"
+	"blockchain/pkg/network"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/testchain"
+	"blockchain/pkg/transaction"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// DefaultMiners is how many miners New starts when Config.Miners is unset
+	DefaultMiners = 3
+
+	// DefaultTimeout is how long MineUntilHeight and WaitForConsensus wait
+	DefaultTimeout = time.Minute
+
+	// pollInterval is how often heights and tips are checked while waiting
+	pollInterval = 50 * time.Millisecond
+)
+
+// ErrPartitioned is returned for dials across a partition
+var ErrPartitioned = errors.New("testnet: peer is on the other side of a partition")
+
+// Config describes the network to start
+type Config struct {
+	Miners       int                   // Miners to start (default DefaultMiners)
+	Difficulty   int                   // Mining difficulty (default 1)
+	Fund         map[string]int        // Coinbases each named wallet gets in the genesis chain
+	Options      []network.MinerOption // Applied to every miner, before the testnet's own
+	ChainOptions []blockchain.Option   // Options of every miner's chain
+	Timeout      time.Duration         // How long waits last (default DefaultTimeout)
+}
+
+// Testnet is a running network of miners. Miners are numbered from 0 in the
+// order they were started.
+type Testnet struct {
+	t       testing.TB
+	cfg     Config
+	funded  *testchain.Builder // Genesis chain and the wallets' keys
+	miners  []*network.Miner
+	mu      sync.Mutex
+	groups  map[string]int // Partition of each miner by address; empty when whole
+	stopped bool
+}
+
+// New starts cfg.Miners miners on free ports, wired to each other, on a
+// genesis chain funding cfg.Fund. They are stopped when the test ends.
+func New(t testing.TB, cfg Config) *Testnet {
+	t.Helper()
+	if cfg.Miners <= 0 {
+		cfg.Miners = DefaultMiners
+	}
+	if cfg.Difficulty <= 0 {
+		cfg.Difficulty = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	tn := &Testnet{
+		t:      t,
+		cfg:    cfg,
+		funded: testchain.New(t, cfg.Difficulty, cfg.ChainOptions...),
+		groups: make(map[string]int),
+	}
+
+	// Fund the wallets in name order, so the genesis chain does not depend
+	// on map order
+	names := make([]string, 0, len(cfg.Fund))
+	for name := range cfg.Fund {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tn.funded.Fund(name, cfg.Fund[name])
+	}
+
+	addresses := make([]string, cfg.Miners)
+	for i := range addresses {
+		addresses[i] = freeAddress(t)
+	}
+	t.Cleanup(tn.Stop)
+	for i, address := range addresses {
+		var peers []network.PeerInfo
+		for j, other := range addresses {
+			if j != i {
+				peers = append(peers, network.PeerInfo{ID: minerID(j), Address: other})
+			}
+		}
+		opts := append(append([]network.MinerOption{}, cfg.Options...), network.WithTransport(link{tn: tn, from: address}))
+		m := network.NewMiner(minerID(i), address, cfg.Difficulty, peers, opts...)
+		m.Blockchain = blockchain.NewBlockchainFromBlocks(tn.funded.Blocks(), cfg.Difficulty, cfg.ChainOptions...)
+		if err := m.Start(); err != nil {
+			t.Fatalf("testnet: failed to start %s: %v", m.ID, err)
+		}
+		tn.miners = append(tn.miners, m)
+	}
+	return tn
+}
+
+// minerID names the miner numbered i
+func minerID(i int) string {
+	return fmt.Sprintf("miner%d", i)
+}
+
+// freeAddress returns a local address no one is listening on
+func freeAddress(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testnet: no free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// Config returns the configuration the network was started with, defaults
+// filled in
+func (tn *Testnet) Config() Config {
+	return tn.cfg
+}
+
+// Miners returns the miners
+func (tn *Testnet) Miners() []*network.Miner {
+	return tn.miners
+}
+
+// Miner returns the miner numbered i
+func (tn *Testnet) Miner(i int) *network.Miner {
+	return tn.miners[i]
+}
+
+// Client returns a client of every miner, trying them in order
+func (tn *Testnet) Client() *network.Client {
+	var miners []network.PeerInfo
+	for _, m := range tn.miners {
+		miners = append(miners, network.PeerInfo{ID: m.ID, Address: m.Address})
+	}
+	return network.NewClient("testnet-client", miners)
+}
+
+// Wallet returns the key pair of the named wallet, making it on first use
+func (tn *Testnet) Wallet(name string) *transaction.KeyPair {
+	return tn.funded.Wallet(name)
+}
+
+// Address returns the address (public key hex) of the named wallet
+func (tn *Testnet) Address(name string) string {
+	return tn.funded.Address(name)
+}
+
+// Balance returns what the named wallet owns on the chain of miner i
+func (tn *Testnet) Balance(i int, name string) int64 {
+	return tn.miners[i].Blockchain.GetBalance(tn.Address(name))
+}
+
+// Height returns the height of miner i's tip
+func (tn *Testnet) Height(i int) int64 {
+	return tn.miners[i].Blockchain.GetLatestBlock().Index
+}
+
+// Pay has the named wallet from pay value to wallet to, and fee to the miner,
+// submitting the transaction to miner 0 over RPC. Miners only take spends of
+// confirmed outputs, so it spends outputs confirmed on miner 0's chain that
+// no transaction pending there spends: payments made before the next block
+// need an output each. Returns the transaction ID.
+func (tn *Testnet) Pay(from, to string, value, fee int64) string {
+	tn.t.Helper()
+	tx, err := tn.payment(from, to, value, fee)
+	if err != nil {
+		tn.t.Fatalf("testnet: %v", err)
+	}
+	client, err := network.DialMiner(tn.miners[0].Address, network.Credentials{})
+	if err != nil {
+		tn.t.Fatalf("testnet: %v", err)
+	}
+	defer client.Close()
+	txID, err := network.SubmitRawTransaction(client, tx)
+	if err != nil {
+		tn.t.Fatalf("testnet: payment from %s to %s refused: %v", from, to, err)
+	}
+	return txID
+}
+
+// payment builds the transaction of Pay, selecting the payer's spendable
+// outputs oldest-outpoint first as package testchain does
+func (tn *Testnet) payment(from, to string, value, fee int64) (*transaction.Transaction, error) {
+	m := tn.miners[0]
+	utxoSet := m.Blockchain.GetUTXOSet()
+	for _, tx := range m.GetPendingTransactions() {
+		for _, in := range tx.Inputs {
+			utxoSet.RemoveUTXO(in.TxID, in.OutIndex)
+		}
+	}
+
+	address := tn.Address(from)
+	utxos := utxoSet.FindUTXOsForAddress(address)
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].TxID != utxos[j].TxID {
+			return utxos[i].TxID < utxos[j].TxID
+		}
+		return utxos[i].OutIndex < utxos[j].OutIndex
+	})
+	var inputs []struct {
+		TxID     string
+		OutIndex int
+	}
+	var total int64
+	for _, utxo := range utxos {
+		if total >= value+fee {
+			break
+		}
+		if !utxoSet.Matured(utxo) {
+			continue
+		}
+		inputs = append(inputs, struct {
+			TxID     string
+			OutIndex int
+		}{utxo.TxID, utxo.OutIndex})
+		total += utxo.Value
+	}
+	if total < value+fee {
+		return nil, fmt.Errorf("%s has %d confirmed and unspent, needs %d", from, total, value+fee)
+	}
+
+	outputs := []transaction.TxOutput{{Value: value, ScriptPubKey: tn.Address(to)}}
+	if change := total - value - fee; change > 0 {
+		outputs = append(outputs, transaction.TxOutput{Value: change, ScriptPubKey: address})
+	}
+	tx, err := utxoSet.CreateTransaction(inputs, outputs, map[string]string{address: tn.Wallet(from).GetPrivateKeyHex()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction from %s: %v", from, err)
+	}
+	return tx, nil
+}
+
+// MineUntilHeight mines blocks until every miner's tip is at height or above.
+// Each partition mines its own branch one block at a time, the miners taking
+// turns: a block is solved on the template of the miner whose turn it is and
+// submitted to it, and the next waits until the rest of its partition has it.
+// Blocks hold the transactions pending at the miner whose turn it is.
+func (tn *Testnet) MineUntilHeight(height int64) {
+	tn.t.Helper()
+	deadline := time.Now().Add(tn.cfg.Timeout)
+	for _, group := range tn.partitions() {
+		for turn := 0; tn.Height(group[0]) < height; turn++ {
+			if time.Now().After(deadline) {
+				tn.t.Fatalf("testnet: miners did not reach height %d within %v (heights %v)", height, tn.cfg.Timeout, tn.heights())
+			}
+			i := group[turn%len(group)]
+			_, mined, err := tn.mineOne(i)
+			if err != nil {
+				tn.t.Fatalf("testnet: %s failed to mine: %v", tn.miners[i].ID, err)
+			}
+			if err := tn.waitForHeight(group, mined); err != nil {
+				tn.t.Fatalf("testnet: block #%d from %s did not reach its partition (heights %v)", mined, tn.miners[i].ID, tn.heights())
+			}
+		}
+	}
+}
+
+// MineBlock mines one block on the template of miner i, as MineUntilHeight
+// does, and returns its hash and height. The other miners get it by
+// broadcast, which is not waited for.
+func (tn *Testnet) MineBlock(i int) (string, int64) {
+	tn.t.Helper()
+	hash, height, err := tn.mineOne(i)
+	if err != nil {
+		tn.t.Fatalf("testnet: %s failed to mine: %v", tn.miners[i].ID, err)
+	}
+	return hash, height
+}
+
+// mineOne solves the block template of miner i and submits it, returning
+// the block's hash and the height it was added at
+func (tn *Testnet) mineOne(i int) (string, int64, error) {
+	client := &network.Client{}
+	address := tn.miners[i].Address
+	tmpl, err := client.GetBlockTemplate(address)
+	if err != nil {
+		return "", 0, err
+	}
+	b, err := block.DeserializeBlock(tmpl.BlockData)
+	if err != nil {
+		return "", 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tn.cfg.Timeout)
+	defer cancel()
+	result := pow.NewProofOfWork(b).MineParallel(ctx, 1)
+	if !result.Success {
+		return "", 0, fmt.Errorf("no nonce found for block #%d", tmpl.Height)
+	}
+	reply, err := client.SubmitBlock(address, tmpl.TemplateID, result.Nonce)
+	if err != nil {
+		return "", 0, err
+	}
+	return reply.Hash, reply.Height, nil
+}
+
+// waitForHeight waits until every miner in group has a tip at height or
+// above, resyncing those that lag
+func (tn *Testnet) waitForHeight(group []int, height int64) error {
+	var last time.Time
+	return tn.waitFor(func() bool {
+		for _, i := range group {
+			if tn.Height(i) < height {
+				return false
+			}
+		}
+		return true
+	}, func() {
+		if time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+		for _, i := range group {
+			if tn.Height(i) < height {
+				tn.miners[i].SyncWithAllPeers()
+			}
+		}
+	})
+}
+
+// partitions returns the miners by partition, each in miner order; one group
+// of every miner when the network is whole
+func (tn *Testnet) partitions() [][]int {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	byGroup := make(map[int][]int)
+	var order []int
+	for i, m := range tn.miners {
+		g := tn.groups[m.Address]
+		if _, ok := byGroup[g]; !ok {
+			order = append(order, g)
+		}
+		byGroup[g] = append(byGroup[g], i)
+	}
+	groups := make([][]int, len(order))
+	for k, g := range order {
+		groups[k] = byGroup[g]
+	}
+	return groups
+}
+
+// WaitForConsensus waits until every miner has the same tip, resyncing
+// miners with their peers meanwhile. Miners keep the first of two branches as
+// long as each other, so after healing a partition mine a block first.
+func (tn *Testnet) WaitForConsensus() {
+	tn.t.Helper()
+	var last time.Time
+	err := tn.waitFor(tn.agreed, func() {
+		if time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+		for _, m := range tn.miners {
+			m.SyncWithAllPeers()
+		}
+	})
+	if err != nil {
+		tn.t.Fatalf("testnet: miners did not agree on a tip within %v (heights %v)", tn.cfg.Timeout, tn.heights())
+	}
+}
+
+// agreed reports whether every miner has the same tip
+func (tn *Testnet) agreed() bool {
+	tip := tn.miners[0].Blockchain.GetLatestBlock().Hash
+	for _, m := range tn.miners[1:] {
+		if m.Blockchain.GetLatestBlock().Hash != tip {
+			return false
+		}
+	}
+	return true
+}
+
+// heights returns the height of every miner's tip
+func (tn *Testnet) heights() []int64 {
+	heights := make([]int64, len(tn.miners))
+	for i := range tn.miners {
+		heights[i] = tn.Height(i)
+	}
+	return heights
+}
+
+// waitFor polls done until it returns true or the timeout passes, calling
+// between, if set, after each false
+func (tn *Testnet) waitFor(done func() bool, between func()) error {
+	deadline := time.Now().Add(tn.cfg.Timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", tn.cfg.Timeout)
+		}
+		if between != nil {
+			between()
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
+
+// PartitionNetwork splits the miners into groups, given by miner number, that
+// can only reach miners in their own group. Miners left out of every group
+// form one more group. Connections already open are not cut.
+func (tn *Testnet) PartitionNetwork(groups ...[]int) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	tn.groups = make(map[string]int)
+	for _, m := range tn.miners {
+		tn.groups[m.Address] = len(groups)
+	}
+	for g, members := range groups {
+		for _, i := range members {
+			tn.groups[tn.miners[i].Address] = g
+		}
+	}
+}
+
+// Heal rejoins the partitions. Miners catch up on the blocks they missed at
+// their next resync; WaitForConsensus forces one.
+func (tn *Testnet) Heal() {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	tn.groups = make(map[string]int)
+}
+
+// reachable reports whether the miner at from may dial address. Addresses
+// that are not miners are always reachable.
+func (tn *Testnet) reachable(from, address string) bool {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	g, ok := tn.groups[address]
+	return !ok || tn.groups[from] == g
+}
+
+// Stop stops every miner
+func (tn *Testnet) Stop() {
+	tn.mu.Lock()
+	if tn.stopped {
+		tn.mu.Unlock()
+		return
+	}
+	tn.stopped = true
+	tn.mu.Unlock()
+	for _, m := range tn.miners {
+		m.StopMining()
+		m.Stop()
+	}
+}
+
+// link is the transport of one miner: TCP, with dials across a partition
+// refused
+type link struct {
+	tn   *Testnet
+	from string // Address of the miner dialing
+}
+
+func (l link) Listen(address string) (net.Listener, error) {
+	return network.TCPTransport{}.Listen(address)
+}
+
+func (l link) Dial(address string) (net.Conn, error) {
+	if !l.tn.reachable(l.from, address) {
+		return nil, fmt.Errorf("dial %s: %w", address, ErrPartitioned)
+	}
+	return network.TCPTransport{}.Dial(address)
+}
@@ -0,0 +1,65 @@
+package testnet
+
+import (
+	"testing"
+)
+
+func TestPartitionedMinersConvergeAfterHealing(t *testing.T) {
+	tn := New(t, Config{Miners: 4, Fund: map[string]int{"alice": 2}})
+	start := tn.Height(0)
+	for i := range tn.Miners() {
+		if tn.Height(i) != start || tn.Balance(i, "alice") == 0 {
+			t.Fatalf("Miner %d should start on the funded chain, got height %d and balance %d", i, tn.Height(i), tn.Balance(i, "alice"))
+		}
+	}
+
+	funds := tn.Balance(0, "alice")
+	tn.Pay("alice", "bob", funds/2, 1000)
+	tn.MineUntilHeight(start + 2)
+	tn.WaitForConsensus()
+	for i := range tn.Miners() {
+		if got := tn.Balance(i, "bob"); got != funds/2 {
+			t.Errorf("Miner %d: expected bob to hold %d, got %d", i, funds/2, got)
+		}
+	}
+
+	// Each side of the partition extends its own branch
+	tn.PartitionNetwork([]int{0, 1}, []int{2, 3})
+	base := tn.Height(0)
+	tn.MineUntilHeight(base + 3)
+	if tn.Miner(0).Blockchain.GetBlockByHeight(base+1).Hash == tn.Miner(2).Blockchain.GetBlockByHeight(base+1).Hash {
+		t.Error("Expected the partitions to mine different blocks")
+	}
+
+	// The branches are as long as each other until the next block
+	tn.Heal()
+	tn.MineUntilHeight(base + 4)
+	tn.WaitForConsensus()
+	if tn.Height(0) != base+4 {
+		t.Errorf("Expected the longer branch to win, got height %d", tn.Height(0))
+	}
+}
+
+func TestPaymentsBeforeMiningSpendSeparateOutputs(t *testing.T) {
+	tn := New(t, Config{Miners: 2, Fund: map[string]int{"alice": 2}})
+	start := tn.Height(0)
+	funds := tn.Balance(0, "alice")
+
+	// The second payment must not spend the first one's unconfirmed change
+	tn.Pay("alice", "bob", funds/4, 1000)
+	tn.Pay("alice", "carol", funds/4, 1000)
+	if got := len(tn.Miner(0).GetPendingTransactions()); got != 2 {
+		t.Fatalf("Expected both payments pending, got %d", got)
+	}
+
+	tn.MineUntilHeight(start + 1)
+	tn.WaitForConsensus()
+	for i := range tn.Miners() {
+		if got := tn.Balance(i, "bob"); got != funds/4 {
+			t.Errorf("Miner %d: expected bob to hold %d, got %d", i, funds/4, got)
+		}
+		if got := tn.Balance(i, "carol"); got != funds/4 {
+			t.Errorf("Miner %d: expected carol to hold %d, got %d", i, funds/4, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package transaction
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// SigCheck is one ECDSA signature to verify: Sig, in hex, of Data by the
+// owner of PubKey
+type SigCheck struct {
+	Data   string
+	Sig    string
+	PubKey string
+}
+
+// Verify reports whether the signature holds
+func (c SigCheck) Verify() bool {
+	return VerifyECDSA(c.Data, c.Sig, c.PubKey)
+}
+
+// BatchVerify verifies checks concurrently, on up to one worker per CPU, and
+// reports whether each holds, in order
+func BatchVerify(checks []SigCheck) []bool {
+	results := make([]bool, len(checks))
+	workers := min(runtime.GOMAXPROCS(0), len(checks))
+	if workers <= 1 {
+		for i, c := range checks {
+			results[i] = c.Verify()
+		}
+		return results
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(checks) {
+					return
+				}
+				results[i] = checks[i].Verify()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// InputSpend is input Input of Tx, taken to spend Spent
+type InputSpend struct {
+	Tx    *Transaction
+	Input int
+	Spent TxOutput
+}
+
+// VerifySpends checks the signatures of spends with BatchVerify and returns
+// a cache of those that hold, for ValidateTransaction to skip. Spends of
+// script outputs, and signatures that fail, are left out, so
+// ValidateTransaction checks them itself and reports why they fail. Spends
+// already in the process-wide signature cache, such as those of transactions
+// validated for the mempool, are left out too, as ValidateTransaction finds
+// them there.
+func VerifySpends(spends []InputSpend) *SigCache {
+	cache := NewSigCache()
+	checks := make([]SigCheck, 0, len(spends))
+	batched := make([]InputSpend, 0, len(spends))
+	digests := make([]txDigest, 0, len(spends))
+	seen := make(map[*Transaction]txDigest)
+	for _, s := range spends {
+		digest, ok := seen[s.Tx]
+		if !ok {
+			digest = digestTransaction(s.Tx)
+			seen[s.Tx] = digest
+		}
+		scriptSig := s.Tx.Inputs[s.Input].ScriptSig
+		if verifiedBefore(digest, s.Input, scriptSig, s.Spent) {
+			continue
+		}
+		if check, ok := s.Tx.InputSigCheck(s.Input, scriptSig, s.Spent); ok {
+			checks = append(checks, check)
+			batched = append(batched, s)
+			digests = append(digests, digest)
+		}
+	}
+	for i, ok := range BatchVerify(checks) {
+		if ok {
+			s := batched[i]
+			cache.Add(s.Tx, s.Input, s.Spent)
+			rememberVerified(digests[i], s.Input, s.Tx.Inputs[s.Input].ScriptSig, s.Spent)
+		}
+	}
+	return cache
+}
@@ -0,0 +1,109 @@
+package transaction
+
+import (
+	"blockchain/pkg/script"
+	"slices"
+	"testing"
+)
+
+func TestBatchVerify(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	bob := mustGenerateKeyPair(t)
+	var checks []SigCheck
+	var want []bool
+	for i := 0; i < 20; i++ {
+		data := string(rune('a' + i))
+		sig, err := SignECDSA(data, alice.GetPrivateKeyHex())
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		key := alice.GetPublicKeyHex()
+		if i%3 == 0 {
+			key = bob.GetPublicKeyHex() // Signed by someone else
+		}
+		checks = append(checks, SigCheck{Data: data, Sig: sig, PubKey: key})
+		want = append(want, i%3 != 0)
+	}
+	if got := BatchVerify(checks); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := BatchVerify(nil); len(got) != 0 {
+		t.Errorf("Expected no results, got %v", got)
+	}
+}
+
+func TestInputSigCheckMatchesSpendsOutput(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	spent := TxOutput{Value: 5000, ScriptPubKey: alice.GetPublicKeyHex()}
+	tx := NewUTXOTransaction([]TxInput{{TxID: "aa", OutIndex: 0}}, []TxOutput{{Value: 4000, ScriptPubKey: "bob"}})
+
+	v1, _ := tx.SignInput(0, alice.GetPrivateKeyHex())
+	v2, _ := tx.SignInputWithFlag(0, alice.GetPrivateKeyHex(), SigHashSingle)
+	v3, _ := tx.SignInputSpending(0, alice.GetPrivateKeyHex(), SigHashAll, spent)
+	wrongValue := spent
+	wrongValue.Value++
+	for _, tc := range []struct {
+		name      string
+		scriptSig string
+		spent     TxOutput
+	}{
+		{"v1", v1, spent},
+		{"v2", v2, spent},
+		{"v3", v3, spent},
+		{"v3 of another value", v3, wrongValue},
+		{"garbage", "v9:zz", spent},
+	} {
+		check, ok := tx.InputSigCheck(0, tc.scriptSig, tc.spent)
+		if want := tx.SpendsOutput(0, tc.scriptSig, tc.spent) == nil; (ok && check.Verify()) != want {
+			t.Errorf("%s: InputSigCheck disagrees with SpendsOutput (%v)", tc.name, want)
+		}
+	}
+
+	p2sh, _ := script.PayToScriptHash(script.PubKey(alice.GetPublicKeyHex()))
+	if _, ok := tx.InputSigCheck(0, v1, TxOutput{Value: 5000, ScriptPubKey: p2sh}); ok {
+		t.Error("A script output should be left to SpendsOutput")
+	}
+}
+
+func TestVerifySpendsCachesValidSignatures(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	spent := TxOutput{Value: 5000, ScriptPubKey: alice.GetPublicKeyHex()}
+	good := NewUTXOTransaction([]TxInput{{TxID: "aa", OutIndex: 0}}, []TxOutput{{Value: 4000, ScriptPubKey: "bob"}})
+	good.Inputs[0].ScriptSig, _ = good.SignInputSpending(0, alice.GetPrivateKeyHex(), SigHashAll, spent)
+	bad := NewUTXOTransaction([]TxInput{{TxID: "bb", OutIndex: 0}}, []TxOutput{{Value: 4000, ScriptPubKey: "bob"}})
+	bad.Inputs[0].ScriptSig = good.Inputs[0].ScriptSig // Signs another transaction
+
+	cache := VerifySpends([]InputSpend{{good, 0, spent}, {bad, 0, spent}})
+	if cache.Len() != 1 || !cache.Verified(good, 0, spent) || cache.Verified(bad, 0, spent) {
+		t.Errorf("Expected only the valid signature cached, got %d entries", cache.Len())
+	}
+	if cache.Verified(good, 0, TxOutput{Value: 1, ScriptPubKey: spent.ScriptPubKey}) {
+		t.Error("A cached signature should not vouch for spending another output")
+	}
+
+	// A set consults the cache but still checks what the cache lacks
+	utxos := NewUTXOSet()
+	utxos.putUTXO(UTXO{TxID: "aa", OutIndex: 0, Value: 5000, ScriptPubKey: spent.ScriptPubKey})
+	utxos.putUTXO(UTXO{TxID: "bb", OutIndex: 0, Value: 5000, ScriptPubKey: spent.ScriptPubKey})
+	utxos.Sigs = cache
+	if err := utxos.ValidateTransaction(good); err != nil {
+		t.Errorf("Cached spend should validate: %v", err)
+	}
+	if err := utxos.ValidateTransaction(bad); err == nil {
+		t.Error("Uncached bad signature should still be refused")
+	}
+}
+
+func BenchmarkBatchVerify(b *testing.B) {
+	kp, _ := GenerateKeyPair()
+	checks := make([]SigCheck, 64)
+	for i := range checks {
+		data := string(rune('a' + i))
+		sig, _ := SignECDSA(data, kp.GetPrivateKeyHex())
+		checks[i] = SigCheck{Data: data, Sig: sig, PubKey: kp.GetPublicKeyHex()}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BatchVerify(checks)
+	}
+}
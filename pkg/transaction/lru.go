@@ -0,0 +1,93 @@
+package transaction
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a fixed-size map that evicts its least recently used entry, safe
+// for concurrent use
+type lru[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Front is the most recently used
+	entries map[K]*list.Element
+	hits    int64
+	misses  int64
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRU[K comparable, V any](size int) *lru[K, V] {
+	return &lru[K, V]{size: size, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+// get returns the value stored under key and marks it recently used
+func (c *lru[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry[K, V]).value, true
+}
+
+// put stores value under key, evicting the least recently used entry if the
+// cache is full
+func (c *lru[K, V]) put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key, value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*lruEntry[K, V])
+		delete(c.entries, oldest.key)
+	}
+}
+
+// resize changes the most entries the cache holds, evicting the least
+// recently used ones over it
+func (c *lru[K, V]) resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	for c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*lruEntry[K, V])
+		delete(c.entries, oldest.key)
+	}
+}
+
+// capacity returns the most entries the cache holds
+func (c *lru[K, V]) capacity() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// stats returns the number of entries, hits, and misses
+func (c *lru[K, V]) stats() (int, int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.hits, c.misses
+}
+
+// clear removes every entry and resets the counters
+func (c *lru[K, V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[K]*list.Element)
+	c.hits, c.misses = 0, 0
+}
@@ -0,0 +1,179 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// SigCache records inputs whose scriptSig is known to unlock the output they
+// spend, so ValidateTransaction need not verify them again. It lets the
+// signatures of many blocks be checked in parallel ahead of the serial pass
+// that applies them. Entries are keyed by the transaction itself, so a cache
+// is only meaningful while the transactions it saw are left unchanged.
+type SigCache struct {
+	verified map[sigCacheKey]TxOutput
+}
+
+type sigCacheKey struct {
+	tx        *Transaction
+	input     int
+	scriptSig string
+}
+
+// NewSigCache creates an empty signature cache
+func NewSigCache() *SigCache {
+	return &SigCache{verified: make(map[sigCacheKey]TxOutput)}
+}
+
+// Add records that input i of tx, with its current scriptSig, unlocks spent.
+// The caller must have verified it, as SpendsOutput or VerifySpends do.
+func (c *SigCache) Add(tx *Transaction, i int, spent TxOutput) {
+	c.verified[sigCacheKey{tx, i, tx.Inputs[i].ScriptSig}] = spent
+}
+
+// Verified reports whether input i of tx was recorded as unlocking spent. A
+// nil cache has no entries.
+func (c *SigCache) Verified(tx *Transaction, i int, spent TxOutput) bool {
+	if c == nil {
+		return false
+	}
+	out, ok := c.verified[sigCacheKey{tx, i, tx.Inputs[i].ScriptSig}]
+	return ok && out == spent
+}
+
+// Len returns the number of inputs recorded
+func (c *SigCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.verified)
+}
+
+// Default sizes of the process-wide caches. A transaction is validated when
+// it enters the mempool, again when a block template is filled, and again in
+// the block that confirms it; the caches let only the first of those do
+// ECDSA work.
+const (
+	SignatureCacheSize = 32768 // Inputs whose signature or script held
+	PubKeyCacheSize    = 4096  // Parsed public keys
+)
+
+// Approximate memory of a cache entry, with its list element and map slot
+const (
+	signatureEntryBytes = 512 // A digest, a scriptSig, and the spent output's script
+	pubKeyEntryBytes    = 320 // A hex key and the parsed key
+)
+
+var (
+	signatureCache = newLRU[signatureKey, signatureEntry](SignatureCacheSize)
+	pubKeyCache    = newLRU[string, *ecdsa.PublicKey](PubKeyCacheSize)
+)
+
+// SetCacheSizes changes the most entries the process-wide signature and
+// public key caches hold, evicting the least recently used entries over it.
+// A size of 0 disables a cache.
+func SetCacheSizes(signatures, pubKeys int) {
+	signatureCache.resize(max(signatures, 0))
+	pubKeyCache.resize(max(pubKeys, 0))
+}
+
+// signatureKey names an input by the content digest of its transaction
+type signatureKey struct {
+	tx    txDigest
+	input int
+}
+
+// txDigest hashes everything an input's signature or script can depend on
+// but the scriptSigs. Unlike CalculateHash, which concatenates fields without
+// delimiters, it length-prefixes each field, so two different transactions
+// never share a digest and one's cached signatures never vouch for the other.
+type txDigest [sha256.Size]byte
+
+// digestTransaction returns the txDigest of tx
+func digestTransaction(tx *Transaction) txDigest {
+	var buf []byte
+	field := func(s string) {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		field(in.TxID)
+		buf = binary.AppendVarint(buf, int64(in.OutIndex))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		buf = binary.AppendVarint(buf, out.Value)
+		field(out.ScriptPubKey)
+	}
+	buf = binary.AppendVarint(buf, tx.LockTime)
+	field(tx.Memo)
+	return sha256.Sum256(buf)
+}
+
+// signatureEntry is what the cached input was verified with
+type signatureEntry struct {
+	scriptSig string
+	spent     TxOutput
+}
+
+// CacheStats reports the use of the process-wide signature and public key
+// caches
+type CacheStats struct {
+	Signatures      int   // Inputs cached as verified
+	MaxSignatures   int   // Most inputs the cache holds
+	SignatureHits   int64 // Verifications skipped
+	SignatureMisses int64
+	PubKeys         int // Public keys cached as parsed
+	MaxPubKeys      int // Most public keys the cache holds
+	PubKeyHits      int64
+	PubKeyMisses    int64
+	Bytes           int64 // Approximate memory of both caches' entries
+	MaxBytes        int64 // Approximate memory of both caches when full
+}
+
+// GetCacheStats returns the current use of the process-wide caches
+func GetCacheStats() CacheStats {
+	var s CacheStats
+	s.Signatures, s.SignatureHits, s.SignatureMisses = signatureCache.stats()
+	s.PubKeys, s.PubKeyHits, s.PubKeyMisses = pubKeyCache.stats()
+	s.MaxSignatures, s.MaxPubKeys = signatureCache.capacity(), pubKeyCache.capacity()
+	s.Bytes = int64(s.Signatures)*signatureEntryBytes + int64(s.PubKeys)*pubKeyEntryBytes
+	s.MaxBytes = int64(s.MaxSignatures)*signatureEntryBytes + int64(s.MaxPubKeys)*pubKeyEntryBytes
+	return s
+}
+
+// ResetCaches empties the process-wide caches, as for a benchmark of cold
+// validation
+func ResetCaches() {
+	signatureCache.clear()
+	pubKeyCache.clear()
+}
+
+// verifiedBefore reports whether input i of the transaction with digest was
+// verified to spend spent with scriptSig
+func verifiedBefore(digest txDigest, i int, scriptSig string, spent TxOutput) bool {
+	entry, ok := signatureCache.get(signatureKey{digest, i})
+	return ok && entry == signatureEntry{scriptSig, spent}
+}
+
+// rememberVerified records that input i of the transaction with digest
+// verified to spend spent with scriptSig
+func rememberVerified(digest txDigest, i int, scriptSig string, spent TxOutput) {
+	signatureCache.put(signatureKey{digest, i}, signatureEntry{scriptSig, spent})
+}
+
+// parsePublicKey is HexToPublicKey through the public key cache. Callers
+// share the key returned and must not modify it.
+func parsePublicKey(hexStr string) (*ecdsa.PublicKey, error) {
+	if key, ok := pubKeyCache.get(hexStr); ok {
+		return key, nil
+	}
+	key, err := HexToPublicKey(hexStr)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyCache.put(hexStr, key)
+	return key, nil
+}
@@ -0,0 +1,119 @@
+package transaction
+
+import "testing"
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRU[string, int](2)
+	c.put("a", 1)
+	c.put("b", 2)
+	c.get("a") // b is now the oldest
+	c.put("c", 3)
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected b evicted")
+	}
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("Expected a kept, got %d, %v", v, ok)
+	}
+	if n, hits, misses := c.stats(); n != 2 || hits != 2 || misses != 1 {
+		t.Errorf("Expected 2 entries, 2 hits, 1 miss; got %d, %d, %d", n, hits, misses)
+	}
+}
+
+func TestValidateTransactionCachesSignatures(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("aa", 0, 5000, alice.GetPublicKeyHex())
+	tx := NewUTXOTransaction([]TxInput{{TxID: "aa", OutIndex: 0}}, []TxOutput{{Value: 4000, ScriptPubKey: "bob"}})
+	tx.Inputs[0].ScriptSig, _ = tx.SignInput(0, alice.GetPrivateKeyHex())
+
+	ResetCaches()
+	for i := 0; i < 3; i++ {
+		if err := utxos.ValidateTransaction(tx); err != nil {
+			t.Fatalf("Validation %d failed: %v", i, err)
+		}
+	}
+	if s := GetCacheStats(); s.Signatures != 1 || s.SignatureHits != 2 || s.PubKeyMisses != 1 {
+		t.Errorf("Expected one verification and two cache hits, got %+v", s)
+	}
+
+	// Another transaction claiming the same ID must not borrow the entry
+	forged := NewUTXOTransaction(tx.Inputs, []TxOutput{{Value: 4000, ScriptPubKey: "mallory"}})
+	forged.ID = tx.ID
+	if err := utxos.ValidateTransaction(forged); err == nil {
+		t.Error("Forged transaction should not validate")
+	}
+
+	// Nor may the entry vouch for another output under the same outpoint
+	other := NewUTXOSet()
+	other.AddUTXO("aa", 0, 5000, mustGenerateKeyPair(t).GetPublicKeyHex())
+	if err := other.ValidateTransaction(tx); err == nil {
+		t.Error("Signature should not unlock another key's output")
+	}
+}
+
+func TestSignatureCacheSeparatesTransactionsWithTheSameHash(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("aa1", 0, 5000, alice.GetPublicKeyHex())
+	utxos.AddUTXO("aa", 10, 5000, alice.GetPublicKeyHex())
+	outputs := []TxOutput{{Value: 4000, ScriptPubKey: "bob"}}
+
+	// "aa1" then "0" and "aa" then "10" concatenate to the same string
+	signed := NewUTXOTransaction([]TxInput{{TxID: "aa1", OutIndex: 0}}, outputs)
+	signed.Inputs[0].ScriptSig, _ = signed.SignInput(0, alice.GetPrivateKeyHex())
+	other := NewUTXOTransaction([]TxInput{{TxID: "aa", OutIndex: 10, ScriptSig: signed.Inputs[0].ScriptSig}}, outputs)
+	if signed.CalculateHash() != other.CalculateHash() {
+		t.Fatal("Expected the transactions to share a hash")
+	}
+
+	ResetCaches()
+	if err := utxos.ValidateTransaction(signed); err != nil {
+		t.Fatalf("Signed transaction should validate: %v", err)
+	}
+	if err := utxos.ValidateTransaction(other); err == nil {
+		t.Error("The signed transaction's cache entry should not vouch for another with the same hash")
+	}
+	if s := GetCacheStats(); s.SignatureHits != 0 {
+		t.Errorf("Expected no cache hits, got %+v", s)
+	}
+}
+
+func TestSetCacheSizesEvictsOverTheLimit(t *testing.T) {
+	defer SetCacheSizes(SignatureCacheSize, PubKeyCacheSize)
+	ResetCaches()
+	for i := 0; i < 3; i++ {
+		rememberVerified(txDigest{byte(i)}, 0, "sig", TxOutput{})
+	}
+
+	SetCacheSizes(1, 0)
+	s := GetCacheStats()
+	if s.Signatures != 1 || s.MaxSignatures != 1 || s.MaxPubKeys != 0 {
+		t.Fatalf("Expected one signature kept and no public keys, got %+v", s)
+	}
+	if s.Bytes != signatureEntryBytes || s.MaxBytes != signatureEntryBytes {
+		t.Errorf("Expected the bytes of one entry, got %+v", s)
+	}
+	if !verifiedBefore(txDigest{2}, 0, "sig", TxOutput{}) {
+		t.Error("Expected the most recent signature kept")
+	}
+}
+
+func TestVerifySpendsSkipsCachedSignatures(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	spent := TxOutput{Value: 5000, ScriptPubKey: alice.GetPublicKeyHex()}
+	tx := NewUTXOTransaction([]TxInput{{TxID: "aa", OutIndex: 0}}, []TxOutput{{Value: 4000, ScriptPubKey: "bob"}})
+	tx.Inputs[0].ScriptSig, _ = tx.SignInput(0, alice.GetPrivateKeyHex())
+
+	ResetCaches()
+	if VerifySpends([]InputSpend{{tx, 0, spent}}).Len() != 1 {
+		t.Fatal("Expected the spend verified")
+	}
+	if VerifySpends([]InputSpend{{tx, 0, spent}}).Len() != 0 {
+		t.Error("A spend verified before should be left to the process-wide cache")
+	}
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("aa", 0, 5000, spent.ScriptPubKey)
+	if err := utxos.ValidateTransaction(tx); err != nil || GetCacheStats().SignatureHits == 0 {
+		t.Errorf("Expected validation to find the spend cached: %v", err)
+	}
+}
@@ -2,6 +2,8 @@
 package transaction
 
 import (
+	"blockchain/pkg/codec"
+	"blockchain/pkg/script"
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -9,9 +11,12 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 // Satoshi constants
@@ -19,6 +24,27 @@ const (
 	SatoshiPerBTC = 100_000_000 // 1 BTC = 100,000,000 satoshi
 )
 
+// Errors of an input that does not unlock the output it spends
+var (
+	ErrInvalidSignature = errors.New("signature verification failed")
+	ErrScriptFailed     = errors.New("redeem script failed")
+)
+
+// MaxMemoBytes is the consensus limit on a transaction memo
+const MaxMemoBytes = 80
+
+// checkMemo enforces the consensus rules on a memo: at most MaxMemoBytes of
+// valid UTF-8, which is all JSON can carry unchanged
+func checkMemo(memo string) error {
+	if len(memo) > MaxMemoBytes {
+		return fmt.Errorf("memo of %d bytes exceeds the %d byte limit", len(memo), MaxMemoBytes)
+	}
+	if !utf8.ValidString(memo) {
+		return fmt.Errorf("memo is not valid UTF-8")
+	}
+	return nil
+}
+
 // TxInput represents a transaction input (reference to a previous output)
 type TxInput struct {
 	TxID      string `json:"txid"`      // Previous transaction ID
@@ -34,9 +60,11 @@ type TxOutput struct {
 
 // Transaction represents a UTXO-based transaction
 type Transaction struct {
-	ID      string     `json:"id"`
-	Inputs  []TxInput  `json:"inputs"`
-	Outputs []TxOutput `json:"outputs"`
+	ID       string     `json:"id"`
+	Inputs   []TxInput  `json:"inputs"`
+	Outputs  []TxOutput `json:"outputs"`
+	LockTime int64      `json:"locktime,omitempty"` // Lowest height of a block that may include it (0 = any)
+	Memo     string     `json:"memo,omitempty"`     // Free text such as a payment reference, at most MaxMemoBytes
 }
 
 // IsCoinbase checks if this is a coinbase transaction (mining reward)
@@ -95,6 +123,15 @@ func (tx *Transaction) CalculateHash() string {
 		buf.WriteString(out.ScriptPubKey)
 	}
 
+	// Only a set lock time or memo is hashed, so transactions without one
+	// keep their IDs. The memo is quoted so no memo can pass for another field.
+	if tx.LockTime != 0 {
+		buf.WriteString(fmt.Sprintf("locktime:%d", tx.LockTime))
+	}
+	if tx.Memo != "" {
+		buf.WriteString(fmt.Sprintf("memo:%q", tx.Memo))
+	}
+
 	hash := sha256.Sum256(buf.Bytes())
 	return hex.EncodeToString(hash[:])
 }
@@ -114,9 +151,405 @@ func (tx *Transaction) GetDataToSign() string {
 		buf.WriteString(out.ScriptPubKey)
 	}
 
+	if tx.LockTime != 0 {
+		buf.WriteString(fmt.Sprintf("locktime:%d", tx.LockTime))
+	}
+	if tx.Memo != "" {
+		buf.WriteString(fmt.Sprintf("memo:%q", tx.Memo))
+	}
+
 	return buf.String()
 }
 
+// IsFinal reports whether the transaction may be included in a block at height
+func (tx *Transaction) IsFinal(height int64) bool {
+	return tx.LockTime <= height
+}
+
+// SigHashVersion selects what an input's signature commits to
+type SigHashVersion int
+
+const (
+	// SigHashLegacy signs GetDataToSign, which singles out no input, so one
+	// signature is valid for every input spending outputs of the same key
+	SigHashLegacy SigHashVersion = 0
+
+	// SigHashV1 also commits to the signed input's index and the outpoint it
+	// spends, so a signature cannot be moved to another input
+	SigHashV1 SigHashVersion = 1
+
+	// SigHashV2 commits to the input like SigHashV1, and to the parts of the
+	// transaction its SigHashFlag selects. The flag is part of the scriptSig
+	// and of the signed data, so it cannot be changed after signing.
+	SigHashV2 SigHashVersion = 2
+
+	// SigHashV3 commits to what SigHashV2 does, and to the value and
+	// scriptPubKey of the output the input spends. A signer that is shown a
+	// false input value, such as an offline wallet fed by a compromised host,
+	// then makes a signature that does not verify, rather than one paying
+	// a larger fee than it displayed. Verifying it needs the spent output.
+	SigHashV3 SigHashVersion = 3
+)
+
+// SigHashFlag selects which inputs and outputs a SigHashV2 signature covers.
+// The rest of the transaction may change without invalidating it, which lets
+// several parties build one transaction: pledges signed ALL|ANYONECANPAY
+// can be combined into a crowdfunding transaction, and SINGLE lets each
+// party of a swap or coinjoin sign only for the output it cares about.
+type SigHashFlag byte
+
+const (
+	// SigHashAll covers every output; legacy and v1 signatures behave so
+	SigHashAll SigHashFlag = 0x01
+
+	// SigHashSingle covers only the output at the signed input's index,
+	// which must exist; other outputs may be added, removed, or changed
+	SigHashSingle SigHashFlag = 0x03
+
+	// SigHashAnyoneCanPay is combined with ALL or SINGLE and covers only the
+	// signed input, so others can add inputs of their own
+	SigHashAnyoneCanPay SigHashFlag = 0x80
+)
+
+// Valid reports whether the flag is ALL or SINGLE, optionally with ANYONECANPAY
+func (f SigHashFlag) Valid() bool {
+	base := f &^ SigHashAnyoneCanPay
+	return base == SigHashAll || base == SigHashSingle
+}
+
+// String names the flag as in "ALL|ANYONECANPAY"
+func (f SigHashFlag) String() string {
+	var name string
+	switch f &^ SigHashAnyoneCanPay {
+	case SigHashAll:
+		name = "ALL"
+	case SigHashSingle:
+		name = "SINGLE"
+	default:
+		return fmt.Sprintf("0x%02x", byte(f))
+	}
+	if f&SigHashAnyoneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// ParseSigHashFlag parses a flag name as printed by String, case-insensitively
+func ParseSigHashFlag(name string) (SigHashFlag, error) {
+	var flag SigHashFlag
+	for _, part := range strings.Split(strings.ToUpper(name), "|") {
+		switch strings.TrimSpace(part) {
+		case "ALL":
+			flag |= SigHashAll
+		case "SINGLE":
+			flag |= SigHashSingle
+		case "ANYONECANPAY":
+			flag |= SigHashAnyoneCanPay
+		default:
+			return 0, fmt.Errorf("unknown sighash flag %q", part)
+		}
+	}
+	if !flag.Valid() {
+		return 0, fmt.Errorf("invalid sighash flag %q: need ALL or SINGLE, optionally with ANYONECANPAY", name)
+	}
+	return flag, nil
+}
+
+// sigHashV1Prefix marks a scriptSig holding a SigHashV1 signature, and
+// sigHashV2Prefix one holding a SigHashV2 signature as "v2:<flag hex>:<sig>";
+// sigHashV3Prefix is laid out like it. Legacy scriptSigs are the bare hex
+// signature.
+const (
+	sigHashV1Prefix = "v1:"
+	sigHashV2Prefix = "v2:"
+	sigHashV3Prefix = "v3:"
+)
+
+// SigHash returns the data the signature of input i commits to under version.
+// A SigHashV2 signature commits to SigHashAll; see FlaggedSigHash for the others,
+// and SpentSigHash for SigHashV3.
+func (tx *Transaction) SigHash(version SigHashVersion, i int) string {
+	switch version {
+	case SigHashLegacy:
+		return tx.GetDataToSign()
+	case SigHashV2:
+		data, _ := tx.FlaggedSigHash(SigHashAll, i)
+		return data
+	}
+	in := tx.Inputs[i]
+	return fmt.Sprintf("sighash-v1\n%d\n%s:%d\n%s", i, in.TxID, in.OutIndex, tx.GetDataToSign())
+}
+
+// FlaggedSigHash returns the data a SigHashV2 signature of input i with flag
+// commits to. Without ANYONECANPAY it covers the input's index and every
+// outpoint spent; with it, only the input's own outpoint, so the input may
+// end up at any position. SINGLE covers the output at index i, and its
+// index, instead of every output. It fails for an invalid flag, and for
+// SINGLE when there is no output i.
+func (tx *Transaction) FlaggedSigHash(flag SigHashFlag, i int) (string, error) {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "sighash-v2\n%02x\n", byte(flag))
+	if err := tx.writeFlaggedSigHash(&buf, flag, i); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SpentSigHash returns the data a SigHashV3 signature of input i with flag
+// commits to: what FlaggedSigHash covers, and the output spent by input i
+func (tx *Transaction) SpentSigHash(flag SigHashFlag, i int, spent TxOutput) (string, error) {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "sighash-v3\n%02x\n", byte(flag))
+	if err := tx.writeFlaggedSigHash(&buf, flag, i); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&buf, "spent %d %s\n", spent.Value, spent.ScriptPubKey)
+	return buf.String(), nil
+}
+
+// writeFlaggedSigHash writes the inputs and outputs flag selects for input i
+func (tx *Transaction) writeFlaggedSigHash(buf *strings.Builder, flag SigHashFlag, i int) error {
+	if !flag.Valid() {
+		return fmt.Errorf("invalid sighash flag %s", flag)
+	}
+	if i < 0 || i >= len(tx.Inputs) {
+		return fmt.Errorf("no input %d", i)
+	}
+	if flag&SigHashAnyoneCanPay != 0 {
+		fmt.Fprintf(buf, "%s:%d\n", tx.Inputs[i].TxID, tx.Inputs[i].OutIndex)
+	} else {
+		fmt.Fprintf(buf, "%d\n", i)
+		for _, in := range tx.Inputs {
+			fmt.Fprintf(buf, "%s:%d\n", in.TxID, in.OutIndex)
+		}
+	}
+	if flag&^SigHashAnyoneCanPay == SigHashSingle {
+		if i >= len(tx.Outputs) {
+			return fmt.Errorf("SINGLE signature of input %d has no output %d", i, i)
+		}
+		out := tx.Outputs[i]
+		fmt.Fprintf(buf, "%d\n%d %s\n", i, out.Value, out.ScriptPubKey)
+	} else {
+		for _, out := range tx.Outputs {
+			fmt.Fprintf(buf, "%d %s\n", out.Value, out.ScriptPubKey)
+		}
+	}
+	if tx.LockTime != 0 {
+		fmt.Fprintf(buf, "locktime %d\n", tx.LockTime)
+	}
+	if tx.Memo != "" {
+		fmt.Fprintf(buf, "memo %q\n", tx.Memo)
+	}
+	return nil
+}
+
+// ParseScriptSig splits a scriptSig into its sighash version, flag, and hex
+// signature. Legacy and v1 signatures report SigHashAll. It reports false
+// for an unknown version or an invalid flag.
+func ParseScriptSig(scriptSig string) (SigHashVersion, SigHashFlag, string, bool) {
+	if sig, ok := strings.CutPrefix(scriptSig, sigHashV1Prefix); ok {
+		return SigHashV1, SigHashAll, sig, true
+	}
+	for version, prefix := range map[SigHashVersion]string{SigHashV2: sigHashV2Prefix, SigHashV3: sigHashV3Prefix} {
+		rest, ok := strings.CutPrefix(scriptSig, prefix)
+		if !ok {
+			continue
+		}
+		flagHex, sig, ok := strings.Cut(rest, ":")
+		raw, err := hex.DecodeString(flagHex)
+		if !ok || err != nil || len(raw) != 1 || !SigHashFlag(raw[0]).Valid() {
+			return 0, 0, "", false
+		}
+		return version, SigHashFlag(raw[0]), sig, true
+	}
+	if strings.Contains(scriptSig, ":") {
+		return 0, 0, "", false
+	}
+	return SigHashLegacy, SigHashAll, scriptSig, true
+}
+
+// SignInput signs input i under SigHashV1 and returns its scriptSig
+func (tx *Transaction) SignInput(i int, privateKeyHex string) (string, error) {
+	sig, err := SignECDSA(tx.SigHash(SigHashV1, i), privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return sigHashV1Prefix + sig, nil
+}
+
+// SignInputWithFlag signs input i under SigHashV2 with flag and returns its
+// scriptSig
+func (tx *Transaction) SignInputWithFlag(i int, privateKeyHex string, flag SigHashFlag) (string, error) {
+	data, err := tx.FlaggedSigHash(flag, i)
+	if err != nil {
+		return "", err
+	}
+	sig, err := SignECDSA(data, privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%02x:%s", sigHashV2Prefix, byte(flag), sig), nil
+}
+
+// SignInputSpending signs input i, which spends spent, under SigHashV3 with
+// flag and returns its scriptSig
+func (tx *Transaction) SignInputSpending(i int, privateKeyHex string, flag SigHashFlag, spent TxOutput) (string, error) {
+	data, err := tx.SpentSigHash(flag, i, spent)
+	if err != nil {
+		return "", err
+	}
+	sig, err := SignECDSA(data, privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%02x:%s", sigHashV3Prefix, byte(flag), sig), nil
+}
+
+// VerifyInput checks that scriptSig is a valid signature of input i by the
+// owner of publicKeyHex, under whichever sighash version and flag it declares.
+// A SigHashV3 signature never verifies here, as the spent value is unknown;
+// use VerifyInputSpending.
+func (tx *Transaction) VerifyInput(i int, scriptSig, publicKeyHex string) bool {
+	version, flag, sig, ok := ParseScriptSig(scriptSig)
+	if !ok {
+		return false
+	}
+	switch version {
+	case SigHashV2:
+		data, err := tx.FlaggedSigHash(flag, i)
+		if err != nil {
+			return false
+		}
+		return VerifyECDSA(data, sig, publicKeyHex)
+	case SigHashV3:
+		return false
+	}
+	return VerifyECDSA(tx.SigHash(version, i), sig, publicKeyHex)
+}
+
+// VerifyInputSpending checks that scriptSig is a valid signature of input i
+// by the owner of spent, the output the input spends, under any sighash
+// version, or satisfies spent's redeem script; see SpendsOutput
+func (tx *Transaction) VerifyInputSpending(i int, scriptSig string, spent TxOutput) bool {
+	return tx.SpendsOutput(i, scriptSig, spent) == nil
+}
+
+// SpendsOutput checks that scriptSig lets input i spend spent. An output
+// locked to a public key needs that key's signature; one locked to a script
+// hash needs its redeem script, run on the scriptSig's arguments, to succeed.
+// Failures wrap ErrInvalidSignature or ErrScriptFailed.
+func (tx *Transaction) SpendsOutput(i int, scriptSig string, spent TxOutput) error {
+	if script.IsScriptHash(spent.ScriptPubKey) {
+		if err := script.VerifyScriptHash(spent.ScriptPubKey, scriptSig, inputChecker{tx: tx, i: i, spent: spent}); err != nil {
+			return fmt.Errorf("%w: %v", ErrScriptFailed, err)
+		}
+		return nil
+	}
+	if !tx.verifyInputKey(i, scriptSig, spent, spent.ScriptPubKey) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verifyInputKey checks that scriptSig is a valid signature of input i,
+// which spends spent, by the owner of publicKeyHex
+func (tx *Transaction) verifyInputKey(i int, scriptSig string, spent TxOutput, publicKeyHex string) bool {
+	check, ok := tx.inputKeyCheck(i, scriptSig, spent, publicKeyHex)
+	return ok && check.Verify()
+}
+
+// InputSigCheck returns the signature check that lets input i, with
+// scriptSig, spend spent, for an output locked to a public key. It reports
+// false for an output locked to a script hash, whose redeem script may check
+// any number of signatures, and for a scriptSig that can never verify;
+// SpendsOutput checks both.
+func (tx *Transaction) InputSigCheck(i int, scriptSig string, spent TxOutput) (SigCheck, bool) {
+	if script.IsScriptHash(spent.ScriptPubKey) {
+		return SigCheck{}, false
+	}
+	return tx.inputKeyCheck(i, scriptSig, spent, spent.ScriptPubKey)
+}
+
+// inputKeyCheck returns the check of scriptSig as a signature of input i,
+// which spends spent, by the owner of publicKeyHex, under whichever sighash
+// version and flag it declares
+func (tx *Transaction) inputKeyCheck(i int, scriptSig string, spent TxOutput, publicKeyHex string) (SigCheck, bool) {
+	version, flag, sig, ok := ParseScriptSig(scriptSig)
+	if !ok {
+		return SigCheck{}, false
+	}
+	var data string
+	var err error
+	switch version {
+	case SigHashV3:
+		data, err = tx.SpentSigHash(flag, i, spent)
+	case SigHashV2:
+		data, err = tx.FlaggedSigHash(flag, i)
+	default:
+		data = tx.SigHash(version, i)
+	}
+	if err != nil {
+		return SigCheck{}, false
+	}
+	return SigCheck{Data: data, Sig: sig, PubKey: publicKeyHex}, true
+}
+
+// inputChecker checks the signatures and lock time a script asks about for
+// input i of tx, which spends spent
+type inputChecker struct {
+	tx    *Transaction
+	i     int
+	spent TxOutput
+}
+
+func (c inputChecker) CheckSig(sig, pubKey string) bool {
+	return c.tx.verifyInputKey(c.i, sig, c.spent, pubKey)
+}
+
+func (c inputChecker) CheckLockTime(height int64) bool {
+	return c.tx.LockTime >= height
+}
+
+// inputSignatures returns the signatures in a scriptSig: the arguments of
+// one spending a script hash, or the scriptSig itself
+func inputSignatures(scriptSig string) []string {
+	if _, args, err := script.ParseScriptHashSig(scriptSig); err == nil {
+		return args
+	}
+	return []string{scriptSig}
+}
+
+// HasLegacySignatures reports whether any input is signed under SigHashLegacy
+func (tx *Transaction) HasLegacySignatures() bool {
+	if tx.IsCoinbase() {
+		return false
+	}
+	for _, in := range tx.Inputs {
+		for _, sig := range inputSignatures(in.ScriptSig) {
+			if version, _, _, ok := ParseScriptSig(sig); ok && version == SigHashLegacy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignsSpentValues reports whether every input signature, including those
+// passed to redeem scripts, is made under SigHashV3
+func (tx *Transaction) SignsSpentValues() bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	for _, in := range tx.Inputs {
+		for _, sig := range inputSignatures(in.ScriptSig) {
+			if version, _, _, ok := ParseScriptSig(sig); !ok || version != SigHashV3 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // KeyPair represents an ECDSA key pair for signing transactions
 type KeyPair struct {
 	PrivateKey *ecdsa.PrivateKey
@@ -142,6 +575,17 @@ func PublicKeyToHex(pubKey *ecdsa.PublicKey) string {
 	return hex.EncodeToString(pubBytes)
 }
 
+// IsUnspendable reports whether an output script can never be spent. Outputs
+// are locked to a public key or a script hash, so anything else (for example
+// a plain miner ID) provably burns its value.
+func IsUnspendable(scriptPubKey string) bool {
+	if script.IsScriptHash(scriptPubKey) {
+		return false
+	}
+	_, err := HexToPublicKey(scriptPubKey)
+	return err != nil
+}
+
 // HexToPublicKey converts a hex string back to a public key
 func HexToPublicKey(hexStr string) (*ecdsa.PublicKey, error) {
 	pubBytes, err := hex.DecodeString(hexStr)
@@ -214,7 +658,7 @@ func SignECDSA(dataToSign string, privateKeyHex string) (string, error) {
 // VerifyECDSA verifies an ECDSA signature
 // The signature is expected to be ASN.1 DER encoded
 func VerifyECDSA(dataToSign, signatureHex, publicKeyHex string) bool {
-	publicKey, err := HexToPublicKey(publicKeyHex)
+	publicKey, err := parsePublicKey(publicKeyHex)
 	if err != nil {
 		return false
 	}
@@ -232,7 +676,7 @@ func VerifyECDSA(dataToSign, signatureHex, publicKeyHex string) bool {
 }
 
 // SignWithPrivateKeys signs the transaction with multiple private keys (ECDSA)
-// Each input must be signed by the owner of the referenced UTXO
+// Each input must be signed by the owner of the referenced UTXO, under SigHashV1
 // utxoOwners maps input index -> public key hex
 // privateKeys maps public key hex -> private key hex
 func (tx *Transaction) SignWithPrivateKeys(utxoOwners map[int]string, privateKeys map[string]string) error {
@@ -240,9 +684,6 @@ func (tx *Transaction) SignWithPrivateKeys(utxoOwners map[int]string, privateKey
 		return nil // Coinbase transactions don't need signing
 	}
 
-	// Get the data to sign (with all scriptSigs cleared)
-	dataToSign := tx.GetDataToSign()
-
 	// Sign each input with the corresponding owner's private key
 	for i := range tx.Inputs {
 		owner, ok := utxoOwners[i]
@@ -256,7 +697,7 @@ func (tx *Transaction) SignWithPrivateKeys(utxoOwners map[int]string, privateKey
 		}
 
 		// Generate ECDSA signature for this input
-		signature, err := SignECDSA(dataToSign, privateKey)
+		signature, err := tx.SignInput(i, privateKey)
 		if err != nil {
 			return fmt.Errorf("failed to sign input %d: %v", i, err)
 		}
@@ -271,70 +712,83 @@ func (tx *Transaction) SignWithPrivateKeys(utxoOwners map[int]string, privateKey
 // Verify verifies the transaction's basic structural validity
 // Note: Full signature verification requires access to the UTXO set
 func (tx *Transaction) Verify() bool {
+	return tx.Check() == nil
+}
+
+// Check is Verify reporting which rule the transaction breaks
+func (tx *Transaction) Check() error {
+	if err := checkMemo(tx.Memo); err != nil {
+		return err
+	}
+
 	// Coinbase transactions have special rules
 	if tx.IsCoinbase() {
 		if len(tx.Inputs) != 1 {
-			return false
+			return fmt.Errorf("coinbase has %d inputs", len(tx.Inputs))
 		}
 		if len(tx.Outputs) == 0 {
-			return false
+			return fmt.Errorf("coinbase has no outputs")
 		}
 		// Coinbase output must have positive value
-		for _, out := range tx.Outputs {
+		for i, out := range tx.Outputs {
 			if out.Value < 0 {
-				return false
+				return fmt.Errorf("coinbase output %d has negative value %d", i, out.Value)
 			}
 			if out.ScriptPubKey == "" {
-				return false
+				return fmt.Errorf("coinbase output %d has no scriptPubKey", i)
 			}
 		}
-		return true
+		return nil
 	}
 
 	// Must have at least one input and one output
-	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
-		return false
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("no inputs")
+	}
+	if len(tx.Outputs) == 0 {
+		return fmt.Errorf("no outputs")
 	}
 
 	// All inputs must have non-empty values
-	for _, in := range tx.Inputs {
+	for i, in := range tx.Inputs {
 		if in.ScriptSig == "" {
-			return false
+			return fmt.Errorf("input %d is unsigned", i)
 		}
 		if in.TxID == "" {
-			return false
+			return fmt.Errorf("input %d names no transaction", i)
 		}
 	}
 
 	// All outputs must have positive value
-	for _, out := range tx.Outputs {
+	for i, out := range tx.Outputs {
 		if out.Value <= 0 {
-			return false
+			return fmt.Errorf("output %d has non-positive value %d", i, out.Value)
 		}
 		if out.ScriptPubKey == "" {
-			return false
+			return fmt.Errorf("output %d has no scriptPubKey", i)
 		}
 	}
 
-	return true
+	return nil
 }
 
 // VerifySignatures verifies all input signatures against their corresponding UTXO public keys
 // utxoPublicKeys maps input index -> public key hex (scriptPubKey from the referenced UTXO)
+// Legacy and SigHashV1 signatures are both accepted; consensus rules decide
+// from which height legacy signatures are refused. SigHashV3 signatures
+// need the spent outputs; see VerifySpentSignatures.
 func (tx *Transaction) VerifySignatures(utxoPublicKeys map[int]string) bool {
 	if tx.IsCoinbase() {
 		return true // Coinbase doesn't need signature verification
 	}
 
-	dataToSign := tx.GetDataToSign()
-
 	for i, in := range tx.Inputs {
 		publicKey, ok := utxoPublicKeys[i]
 		if !ok {
 			return false // No public key provided for this input
 		}
 
-		if !VerifyECDSA(dataToSign, in.ScriptSig, publicKey) {
+		if !tx.VerifyInput(i, in.ScriptSig, publicKey) {
 			return false // Signature verification failed
 		}
 	}
@@ -342,6 +796,22 @@ func (tx *Transaction) VerifySignatures(utxoPublicKeys map[int]string) bool {
 	return true
 }
 
+// VerifySpentSignatures verifies all input signatures against the outputs
+// they spend, under any sighash version
+// spent maps input index -> the output the input spends
+func (tx *Transaction) VerifySpentSignatures(spent map[int]TxOutput) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	for i, in := range tx.Inputs {
+		out, ok := spent[i]
+		if !ok || !tx.VerifyInputSpending(i, in.ScriptSig, out) {
+			return false
+		}
+	}
+	return true
+}
+
 // TotalOutputValue calculates total output value
 func (tx *Transaction) TotalOutputValue() int64 {
 	var total int64
@@ -378,16 +848,69 @@ func (tx *Transaction) GetFee(utxoSet *UTXOSet) int64 {
 	return 0
 }
 
-// Serialize converts the transaction to JSON bytes
+// Serialize converts the transaction to its binary encoding, the form peers
+// exchange and size limits count
 func (tx *Transaction) Serialize() ([]byte, error) {
+	w := codec.NewWriter()
+	tx.EncodeTo(w)
+	return w.Bytes(), nil
+}
+
+// SerializeJSON converts the transaction to JSON bytes, the form clients read
+func (tx *Transaction) SerializeJSON() ([]byte, error) {
 	return json.Marshal(tx)
 }
 
-// DeserializeTransaction converts JSON bytes to a Transaction
+// EncodeTo appends the transaction's fields to a binary encoding. Every field
+// is written in order; a new field needs a new codec.Version, which
+// DecodeTransactionFrom checks before reading it.
+func (tx *Transaction) EncodeTo(w *codec.Writer) {
+	w.String(tx.ID)
+	w.Uvarint(uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		w.String(in.TxID)
+		w.Varint(int64(in.OutIndex))
+		w.String(in.ScriptSig)
+	}
+	w.Uvarint(uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		w.Varint(out.Value)
+		w.String(out.ScriptPubKey)
+	}
+	w.Varint(tx.LockTime)
+	w.String(tx.Memo)
+}
+
+// DecodeTransactionFrom reads a transaction written by EncodeTo
+func DecodeTransactionFrom(r *codec.Reader) *Transaction {
+	tx := &Transaction{ID: r.String()}
+	if n := r.Count(); n > 0 {
+		tx.Inputs = make([]TxInput, n)
+		for i := range tx.Inputs {
+			tx.Inputs[i] = TxInput{TxID: r.String(), OutIndex: int(r.Varint()), ScriptSig: r.String()}
+		}
+	}
+	if n := r.Count(); n > 0 {
+		tx.Outputs = make([]TxOutput, n)
+		for i := range tx.Outputs {
+			tx.Outputs[i] = TxOutput{Value: r.Varint(), ScriptPubKey: r.String()}
+		}
+	}
+	tx.LockTime = r.Varint()
+	tx.Memo = r.String()
+	return tx
+}
+
+// DeserializeTransaction converts binary or JSON bytes to a Transaction
 func DeserializeTransaction(data []byte) (*Transaction, error) {
-	var tx Transaction
-	err := json.Unmarshal(data, &tx)
-	return &tx, err
+	if codec.IsJSON(data) {
+		var tx Transaction
+		err := json.Unmarshal(data, &tx)
+		return &tx, err
+	}
+	r := codec.NewReader(data)
+	tx := DecodeTransactionFrom(r)
+	return tx, r.Err()
 }
 
 // String returns a string representation of the transaction
@@ -406,40 +929,124 @@ type UTXO struct {
 	OutIndex     int    `json:"out_index"`
 	Value        int64  `json:"value"`
 	ScriptPubKey string `json:"scriptpubkey"`
+	Height       int64  `json:"height,omitempty"`   // Height of the block that created it
+	Coinbase     bool   `json:"coinbase,omitempty"` // Created by a coinbase, so subject to maturity
+}
+
+// Output returns the transaction output the UTXO holds
+func (u *UTXO) Output() TxOutput {
+	return TxOutput{Value: u.Value, ScriptPubKey: u.ScriptPubKey}
 }
 
 // UTXOSet manages the set of unspent transaction outputs
 type UTXOSet struct {
-	UTXOs map[string]map[int]*UTXO // txid -> outIndex -> UTXO
+	UTXOs map[string]map[int]*UTXO // txid -> outIndex -> UTXO; change only through the set's methods
+
+	// byAddress indexes the outpoints of UTXOs by their scriptPubKey, so an
+	// address's UTXOs are found without scanning the whole set
+	byAddress map[string]map[outpoint]struct{}
+
+	// count and bytes track the set's size as outputs come and go, so its
+	// memory use is known without walking it
+	count int
+	bytes int64
+
+	// Height is that of the block whose transactions are validated and
+	// applied next. ProcessTransaction records it in the outputs it creates,
+	// and ValidateTransaction checks lock times and coinbase maturity against it.
+	Height int64
+
+	// CoinbaseMaturity is how many blocks after its own a coinbase output
+	// must wait before it is spent (0 = none)
+	CoinbaseMaturity int64
+
+	// Sigs holds inputs whose signatures were verified ahead of time, which
+	// ValidateTransaction then skips (nil = verify every input). Copy does
+	// not carry it over.
+	Sigs *SigCache
 }
 
 // NewUTXOSet creates a new UTXO set
 func NewUTXOSet() *UTXOSet {
 	return &UTXOSet{
-		UTXOs: make(map[string]map[int]*UTXO),
+		UTXOs:     make(map[string]map[int]*UTXO),
+		byAddress: make(map[string]map[outpoint]struct{}),
 	}
 }
 
-// AddUTXO adds a UTXO to the set
+// outpoint names a transaction output
+type outpoint struct {
+	txID     string
+	outIndex int
+}
+
+// AddUTXO adds a UTXO to the set, as created by a non-coinbase transaction
+// at the set's Height
 func (us *UTXOSet) AddUTXO(txID string, outIndex int, value int64, scriptPubKey string) {
-	if us.UTXOs[txID] == nil {
-		us.UTXOs[txID] = make(map[int]*UTXO)
-	}
-	us.UTXOs[txID][outIndex] = &UTXO{
+	us.putUTXO(UTXO{
 		TxID:         txID,
 		OutIndex:     outIndex,
 		Value:        value,
 		ScriptPubKey: scriptPubKey,
+		Height:       us.Height,
+	})
+}
+
+// utxoEntryOverhead approximates the map and struct overhead of a UTXO and
+// its entry in the address index
+const utxoEntryOverhead = 96
+
+// utxoBytes approximates the memory a UTXO takes in the set
+func utxoBytes(utxo *UTXO) int64 {
+	return int64(len(utxo.TxID)+len(utxo.ScriptPubKey)) + utxoEntryOverhead
+}
+
+// Size returns the number of unspent outputs and their approximate memory
+// use in bytes
+func (us *UTXOSet) Size() (int, int64) {
+	return us.count, us.bytes
+}
+
+// putUTXO adds a copy of utxo to the set, replacing any at its outpoint
+func (us *UTXOSet) putUTXO(utxo UTXO) {
+	us.RemoveUTXO(utxo.TxID, utxo.OutIndex)
+	us.count++
+	us.bytes += utxoBytes(&utxo)
+	if us.UTXOs[utxo.TxID] == nil {
+		us.UTXOs[utxo.TxID] = make(map[int]*UTXO)
 	}
+	us.UTXOs[utxo.TxID][utxo.OutIndex] = &utxo
+
+	op := outpoint{utxo.TxID, utxo.OutIndex}
+	if us.byAddress[utxo.ScriptPubKey] == nil {
+		us.byAddress[utxo.ScriptPubKey] = make(map[outpoint]struct{})
+	}
+	us.byAddress[utxo.ScriptPubKey][op] = struct{}{}
+}
+
+// Matured reports whether utxo may be spent in the block at the set's Height:
+// a coinbase output only once CoinbaseMaturity blocks have followed its own
+func (us *UTXOSet) Matured(utxo *UTXO) bool {
+	return !utxo.Coinbase || us.Height-utxo.Height >= us.CoinbaseMaturity
 }
 
 // RemoveUTXO removes a UTXO from the set (when it's spent)
 func (us *UTXOSet) RemoveUTXO(txID string, outIndex int) {
-	if us.UTXOs[txID] != nil {
-		delete(us.UTXOs[txID], outIndex)
-		if len(us.UTXOs[txID]) == 0 {
-			delete(us.UTXOs, txID)
-		}
+	utxo := us.FindUTXO(txID, outIndex)
+	if utxo == nil {
+		return
+	}
+	us.count--
+	us.bytes -= utxoBytes(utxo)
+	delete(us.UTXOs[txID], outIndex)
+	if len(us.UTXOs[txID]) == 0 {
+		delete(us.UTXOs, txID)
+	}
+
+	outpoints := us.byAddress[utxo.ScriptPubKey]
+	delete(outpoints, outpoint{txID, outIndex})
+	if len(outpoints) == 0 {
+		delete(us.byAddress, utxo.ScriptPubKey)
 	}
 }
 
@@ -454,15 +1061,12 @@ func (us *UTXOSet) FindUTXO(txID string, outIndex int) *UTXO {
 	return nil
 }
 
-// FindUTXOsForAddress finds all UTXOs belonging to an address
+// FindUTXOsForAddress finds all UTXOs belonging to an address, in time
+// proportional to their number rather than the set's size
 func (us *UTXOSet) FindUTXOsForAddress(address string) []*UTXO {
 	var utxos []*UTXO
-	for _, outputs := range us.UTXOs {
-		for _, utxo := range outputs {
-			if utxo.ScriptPubKey == address {
-				utxos = append(utxos, utxo)
-			}
-		}
+	for op := range us.byAddress[address] {
+		utxos = append(utxos, us.UTXOs[op.txID][op.outIndex])
 	}
 	return utxos
 }
@@ -493,43 +1097,65 @@ func (us *UTXOSet) ProcessTransaction(tx *Transaction) {
 
 	// Add new UTXOs (outputs)
 	for i, out := range tx.Outputs {
-		us.AddUTXO(tx.ID, i, out.Value, out.ScriptPubKey)
+		us.putUTXO(UTXO{TxID: tx.ID, OutIndex: i, Value: out.Value, ScriptPubKey: out.ScriptPubKey,
+			Height: us.Height, Coinbase: tx.IsCoinbase()})
 	}
 }
 
 // ValidateTransaction validates a transaction against the UTXO set
 // This includes checking UTXO existence, balance, and signature verification
 func (us *UTXOSet) ValidateTransaction(tx *Transaction) error {
+	if err := checkMemo(tx.Memo); err != nil {
+		return err
+	}
+
 	// Coinbase transactions don't spend UTXOs
 	if tx.IsCoinbase() {
 		return nil
 	}
 
-	var inputTotal int64
-	utxoPublicKeys := make(map[int]string)
+	if !tx.IsFinal(us.Height) {
+		return fmt.Errorf("transaction locked until height %d, block is at %d", tx.LockTime, us.Height)
+	}
 
+	digest := digestTransaction(tx)
+	var inputTotal int64
+	seen := make(map[string]bool, len(tx.Inputs))
 	for i, in := range tx.Inputs {
+		// An output listed twice would count its value twice
+		key := fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)
+		if seen[key] {
+			return fmt.Errorf("input %d spends %s a second time", i, key)
+		}
+		seen[key] = true
+
 		// Check if UTXO exists
 		utxo := us.FindUTXO(in.TxID, in.OutIndex)
 		if utxo == nil {
 			return fmt.Errorf("UTXO not found: %s:%d", in.TxID, in.OutIndex)
 		}
+		if !us.Matured(utxo) {
+			return fmt.Errorf("immature coinbase output %s:%d: created at height %d, spendable from %d",
+				in.TxID, in.OutIndex, utxo.Height, utxo.Height+us.CoinbaseMaturity)
+		}
 
 		// Check for empty signature
 		if in.ScriptSig == "" {
 			return fmt.Errorf("missing signature for input %s:%d", in.TxID, in.OutIndex)
 		}
 
-		// Store the public key for signature verification
-		utxoPublicKeys[i] = utxo.ScriptPubKey
+		// Verify the signature, or run the redeem script of a script output,
+		// unless it was verified ahead of time or on an earlier validation
+		spent := utxo.Output()
+		if !us.Sigs.Verified(tx, i, spent) && !verifiedBefore(digest, i, in.ScriptSig, spent) {
+			if err := tx.SpendsOutput(i, in.ScriptSig, spent); err != nil {
+				return fmt.Errorf("input %d (%s:%d): %w", i, in.TxID, in.OutIndex, err)
+			}
+			rememberVerified(digest, i, in.ScriptSig, spent)
+		}
 		inputTotal += utxo.Value
 	}
 
-	// Verify all signatures
-	if !tx.VerifySignatures(utxoPublicKeys) {
-		return fmt.Errorf("signature verification failed")
-	}
-
 	outputTotal := tx.TotalOutputValue()
 
 	// Input total must be >= output total (difference is fee)
@@ -540,12 +1166,65 @@ func (us *UTXOSet) ValidateTransaction(tx *Transaction) error {
 	return nil
 }
 
+// UTXODelta records the outputs a batch of transactions spends and creates
+type UTXODelta struct {
+	Spent   []UTXO `json:"spent"`
+	Created []UTXO `json:"created"`
+}
+
+// ComputeDelta returns the changes applying txs in order would make to the set.
+// The set itself is not modified. Outputs created and spent within txs appear in both lists.
+func (us *UTXOSet) ComputeDelta(txs []*Transaction) *UTXODelta {
+	delta := &UTXODelta{}
+	created := make(map[string]UTXO)
+
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				key := fmt.Sprintf("%s:%d", in.TxID, in.OutIndex)
+				if utxo, ok := created[key]; ok {
+					delta.Spent = append(delta.Spent, utxo)
+					delete(created, key)
+					continue
+				}
+				if utxo := us.FindUTXO(in.TxID, in.OutIndex); utxo != nil {
+					delta.Spent = append(delta.Spent, *utxo)
+				}
+			}
+		}
+		for i, out := range tx.Outputs {
+			utxo := UTXO{TxID: tx.ID, OutIndex: i, Value: out.Value, ScriptPubKey: out.ScriptPubKey,
+				Height: us.Height, Coinbase: tx.IsCoinbase()}
+			created[fmt.Sprintf("%s:%d", tx.ID, i)] = utxo
+			delta.Created = append(delta.Created, utxo)
+		}
+	}
+	return delta
+}
+
+// RevertDelta undoes a delta computed by ComputeDelta and then applied: the
+// outputs it created are removed and those it spent restored, except outputs
+// both created and spent within it, which the set never held before
+func (us *UTXOSet) RevertDelta(delta *UTXODelta) {
+	created := make(map[string]bool, len(delta.Created))
+	for _, utxo := range delta.Created {
+		us.RemoveUTXO(utxo.TxID, utxo.OutIndex)
+		created[fmt.Sprintf("%s:%d", utxo.TxID, utxo.OutIndex)] = true
+	}
+	for _, utxo := range delta.Spent {
+		if !created[fmt.Sprintf("%s:%d", utxo.TxID, utxo.OutIndex)] {
+			us.putUTXO(utxo)
+		}
+	}
+}
+
 // Copy creates a deep copy of the UTXO set
 func (us *UTXOSet) Copy() *UTXOSet {
 	newSet := NewUTXOSet()
-	for txID, outputs := range us.UTXOs {
-		for outIndex, utxo := range outputs {
-			newSet.AddUTXO(txID, outIndex, utxo.Value, utxo.ScriptPubKey)
+	newSet.Height, newSet.CoinbaseMaturity = us.Height, us.CoinbaseMaturity
+	for _, outputs := range us.UTXOs {
+		for _, utxo := range outputs {
+			newSet.putUTXO(*utxo)
 		}
 	}
 	return newSet
@@ -555,7 +1234,8 @@ func (us *UTXOSet) Copy() *UTXOSet {
 // inputSpecs: list of UTXOs to spend (txID and output index)
 // outputs: list of transaction outputs (recipients and amounts)
 // privateKeys: map of public key hex -> private key hex for signing
-// This function automatically finds UTXO owners and signs with the provided private keys
+// This function automatically finds UTXO owners and signs with the provided private keys,
+// under SigHashV3 so each signature commits to the value it spends
 func (us *UTXOSet) CreateTransaction(
 	inputSpecs []struct {
 		TxID     string
@@ -564,9 +1244,28 @@ func (us *UTXOSet) CreateTransaction(
 	outputs []TxOutput,
 	privateKeys map[string]string,
 ) (*Transaction, error) {
+	return us.CreateTransactionWithMemo(inputSpecs, outputs, "", privateKeys)
+}
+
+// CreateTransactionWithMemo is CreateTransaction for a transaction carrying
+// memo, which the signatures commit to
+func (us *UTXOSet) CreateTransactionWithMemo(
+	inputSpecs []struct {
+		TxID     string
+		OutIndex int
+	},
+	outputs []TxOutput,
+	memo string,
+	privateKeys map[string]string,
+) (*Transaction, error) {
+	if err := checkMemo(memo); err != nil {
+		return nil, err
+	}
+
 	// Create inputs and collect owners
 	var inputs []TxInput
 	utxoOwners := make(map[int]string)
+	spent := make(map[int]TxOutput)
 	var totalInput int64
 
 	for i, spec := range inputSpecs {
@@ -580,6 +1279,7 @@ func (us *UTXOSet) CreateTransaction(
 			OutIndex: spec.OutIndex,
 		})
 		utxoOwners[i] = utxo.ScriptPubKey
+		spent[i] = utxo.Output()
 		totalInput += utxo.Value
 	}
 
@@ -602,12 +1302,17 @@ func (us *UTXOSet) CreateTransaction(
 	}
 
 	tx := NewUTXOTransaction(inputs, outputs)
+	tx.Memo = memo
 
 	// Sign with multiple private keys
-	err := tx.SignWithPrivateKeys(utxoOwners, privateKeys)
-	if err != nil {
-		return nil, err
+	for i := range tx.Inputs {
+		signature, err := tx.SignInputSpending(i, privateKeys[utxoOwners[i]], SigHashAll, spent[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign input %d: %v", i, err)
+		}
+		tx.Inputs[i].ScriptSig = signature
 	}
+	tx.ID = tx.CalculateHash()
 
 	return tx, nil
 }
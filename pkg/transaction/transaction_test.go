@@ -1,6 +1,11 @@
 package transaction
 
 import (
+	"blockchain/pkg/script"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -231,6 +236,49 @@ func TestTransactionSerialization(t *testing.T) {
 	}
 }
 
+func TestTransactionBinaryEncoding(t *testing.T) {
+	aliceKP := mustGenerateKeyPair(t)
+	alicePubHex := aliceKP.GetPublicKeyHex()
+	utxoSet := NewUTXOSet()
+	coinbase := NewCoinbaseTransaction(alicePubHex, 5000000000, 0)
+	utxoSet.ProcessTransaction(coinbase)
+	inputSpecs := []struct {
+		TxID     string
+		OutIndex int
+	}{{TxID: coinbase.ID, OutIndex: 0}}
+	outputs := []TxOutput{{Value: 1000, ScriptPubKey: "bob"}, {Value: 4999998000, ScriptPubKey: alicePubHex}}
+	tx, err := utxoSet.CreateTransactionWithMemo(inputSpecs, outputs, "invoice 7",
+		map[string]string{alicePubHex: aliceKP.GetPrivateKeyHex()})
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	tx.LockTime = 12
+	tx.ID = tx.CalculateHash()
+
+	data, _ := tx.Serialize()
+	jsonData, _ := tx.SerializeJSON()
+	if 2*len(data) > len(jsonData) {
+		t.Errorf("Binary encoding should be under half the JSON size, got %d vs %d", len(data), len(jsonData))
+	}
+	for _, encoded := range [][]byte{data, jsonData} {
+		got, err := DeserializeTransaction(encoded)
+		if err != nil {
+			t.Fatalf("Failed to deserialize transaction: %v", err)
+		}
+		if !reflect.DeepEqual(got, tx) || got.CalculateHash() != tx.ID {
+			t.Errorf("Transaction changed in the round trip: %+v", got)
+		}
+	}
+
+	// Encoding is deterministic, and a torn encoding is refused
+	if again, _ := tx.Serialize(); !bytes.Equal(again, data) {
+		t.Error("Serializing twice should give the same bytes")
+	}
+	if _, err := DeserializeTransaction(data[:len(data)-1]); err == nil {
+		t.Error("Truncated transaction should fail to deserialize")
+	}
+}
+
 func TestUTXOSet(t *testing.T) {
 	utxoSet := NewUTXOSet()
 
@@ -367,6 +415,17 @@ func TestUTXOSetValidateTransaction(t *testing.T) {
 	if err == nil {
 		t.Error("Transaction with non-existent UTXO should fail validation")
 	}
+
+	// Transaction listing the same UTXO twice to spend its value twice
+	doubleTx, err := utxoSet.CreateTransaction(append(inputSpecs, inputSpecs[0]),
+		[]TxOutput{{Value: 10000000000, ScriptPubKey: bobPubHex}}, privateKeys)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	err = utxoSet.ValidateTransaction(doubleTx)
+	if err == nil || !strings.Contains(err.Error(), "a second time") {
+		t.Errorf("Transaction spending a UTXO twice should fail validation, got %v", err)
+	}
 }
 
 func TestCreateTransactionInsufficientFunds(t *testing.T) {
@@ -480,6 +539,92 @@ func TestUTXOSetCopy(t *testing.T) {
 	}
 }
 
+func TestUTXOSetSizeTracksChanges(t *testing.T) {
+	utxoSet := NewUTXOSet()
+	utxoSet.AddUTXO("tx1", 0, 1000, "alice")
+	utxoSet.AddUTXO("tx1", 1, 2000, "bob")
+	utxoSet.AddUTXO("tx1", 1, 2000, "carol") // Replaces bob's output
+	utxoSet.AddUTXO("tx2", 0, 3000, "dave")
+	utxoSet.RemoveUTXO("tx2", 0)
+	utxoSet.RemoveUTXO("missing", 0)
+
+	// The running totals match a walk of the set
+	var bytes int64
+	for _, utxo := range utxoSet.GetAllUTXOs() {
+		bytes += utxoBytes(utxo)
+	}
+	count, got := utxoSet.Size()
+	if count != 2 || got != bytes {
+		t.Errorf("Expected 2 outputs of %d bytes, got %d of %d", bytes, count, got)
+	}
+	if count, got := utxoSet.Copy().Size(); count != 2 || got != bytes {
+		t.Errorf("Copy should keep the size, got %d of %d", count, got)
+	}
+}
+
+func TestUTXOSetRevertDelta(t *testing.T) {
+	utxoSet := NewUTXOSet()
+	utxoSet.AddUTXO("tx1", 0, 1000000, "alice")
+
+	// tx2 spends tx1:0, tx3 spends tx2:0 in the same batch
+	tx2 := &Transaction{ID: "tx2", Inputs: []TxInput{{TxID: "tx1", OutIndex: 0}}, Outputs: []TxOutput{{Value: 900000, ScriptPubKey: "bob"}}}
+	tx3 := &Transaction{ID: "tx3", Inputs: []TxInput{{TxID: "tx2", OutIndex: 0}}, Outputs: []TxOutput{{Value: 800000, ScriptPubKey: "carol"}}}
+	delta := utxoSet.ComputeDelta([]*Transaction{tx2, tx3})
+	utxoSet.ProcessTransaction(tx2)
+	utxoSet.ProcessTransaction(tx3)
+
+	utxoSet.RevertDelta(delta)
+	if !utxoSet.HasUTXO("tx1", 0) {
+		t.Error("Reverting should restore tx1:0")
+	}
+	if utxoSet.HasUTXO("tx2", 0) || utxoSet.HasUTXO("tx3", 0) {
+		t.Error("Reverting should remove the outputs the batch created, including those it spent")
+	}
+}
+
+func TestUTXOSetAddressIndex(t *testing.T) {
+	utxoSet := NewUTXOSet()
+	for i := 0; i < 100; i++ {
+		utxoSet.AddUTXO(fmt.Sprintf("other%d", i), 0, 1, "bob")
+	}
+	utxoSet.AddUTXO("tx1", 0, 1000, "alice")
+	utxoSet.AddUTXO("tx1", 1, 2000, "alice")
+	utxoSet.AddUTXO("tx2", 0, 4000, "alice")
+
+	utxoSet.RemoveUTXO("tx1", 0)
+	utxoSet.AddUTXO("tx2", 0, 4000, "carol") // Replaces alice's output
+	if got := utxoSet.GetBalance("alice"); got != 2000 {
+		t.Errorf("Expected alice's balance 2000, got %d", got)
+	}
+	if got := utxoSet.GetBalance("carol"); got != 4000 {
+		t.Errorf("Expected carol's balance 4000, got %d", got)
+	}
+
+	// Copies and reverts keep the index with the set
+	copy := utxoSet.Copy()
+	tx := &Transaction{ID: "tx3", Inputs: []TxInput{{TxID: "tx1", OutIndex: 1}}, Outputs: []TxOutput{{Value: 1500, ScriptPubKey: "dave"}}}
+	delta := copy.ComputeDelta([]*Transaction{tx})
+	copy.ProcessTransaction(tx)
+	if copy.GetBalance("alice") != 0 || copy.GetBalance("dave") != 1500 || utxoSet.GetBalance("alice") != 2000 {
+		t.Error("Spending in a copy should move its balances only")
+	}
+	copy.RevertDelta(delta)
+	if copy.GetBalance("alice") != 2000 || copy.GetBalance("dave") != 0 || len(copy.byAddress) != 3 {
+		t.Errorf("Reverting should restore the index, got %d addresses", len(copy.byAddress))
+	}
+}
+
+func BenchmarkUTXOSetGetBalance(b *testing.B) {
+	utxoSet := NewUTXOSet()
+	for i := 0; i < 100000; i++ {
+		utxoSet.AddUTXO(fmt.Sprintf("tx%d", i), 0, 1, fmt.Sprintf("owner%d", i%1000))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		utxoSet.GetBalance("owner7")
+	}
+}
+
 func TestTransactionString(t *testing.T) {
 	coinbase := NewCoinbaseTransaction("miner", 5000000000, 0)
 	str := coinbase.String()
@@ -949,3 +1094,330 @@ func TestMultipleKeyPairsUniqueness(t *testing.T) {
 		t.Error("Two key pairs should have different private keys")
 	}
 }
+
+func TestIsUnspendable(t *testing.T) {
+	kp := mustGenerateKeyPair(t)
+	if IsUnspendable(kp.GetPublicKeyHex()) {
+		t.Error("A public key should be spendable")
+	}
+	for _, script := range []string{"", "miner1", "04deadbeef"} {
+		if !IsUnspendable(script) {
+			t.Errorf("%q is not a public key and should be unspendable", script)
+		}
+	}
+}
+
+func TestSigHashV1BindsSignatureToInput(t *testing.T) {
+	aliceKP := mustGenerateKeyPair(t)
+	alicePub := aliceKP.GetPublicKeyHex()
+
+	// Two outputs owned by alice spent together
+	tx := NewUTXOTransaction(
+		[]TxInput{{TxID: "tx1", OutIndex: 0}, {TxID: "tx2", OutIndex: 1}},
+		[]TxOutput{{Value: 10000000, ScriptPubKey: "recipient"}},
+	)
+	owners := map[int]string{0: alicePub, 1: alicePub}
+	if err := tx.SignWithPrivateKeys(owners, map[string]string{alicePub: aliceKP.GetPrivateKeyHex()}); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if !tx.VerifySignatures(owners) || tx.HasLegacySignatures() {
+		t.Fatal("Versioned signatures should verify")
+	}
+
+	// A versioned signature is only valid for the input it was made for
+	spliced := *tx
+	spliced.Inputs = []TxInput{tx.Inputs[0], tx.Inputs[1]}
+	spliced.Inputs[1].ScriptSig = tx.Inputs[0].ScriptSig
+	if spliced.VerifySignatures(owners) {
+		t.Error("A signature copied to another input should not verify")
+	}
+
+	// A legacy signature covers every input of the same key: still accepted
+	legacy, _ := SignECDSA(tx.GetDataToSign(), aliceKP.GetPrivateKeyHex())
+	spliced.Inputs[0].ScriptSig = legacy
+	spliced.Inputs[1].ScriptSig = legacy
+	if !spliced.VerifySignatures(owners) || !spliced.HasLegacySignatures() {
+		t.Error("Legacy signatures should verify during the transition")
+	}
+
+	spliced.Inputs[1].ScriptSig = "v9:" + legacy
+	if spliced.VerifySignatures(owners) {
+		t.Error("An unknown sighash version should not verify")
+	}
+}
+
+func TestSigHashV3CommitsToSpentOutput(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("fund", 0, 100000000, alice.GetPublicKeyHex())
+	inputs := []struct {
+		TxID     string
+		OutIndex int
+	}{{TxID: "fund", OutIndex: 0}}
+
+	tx, err := utxos.CreateTransaction(inputs, []TxOutput{{Value: 90000000, ScriptPubKey: "bob"}},
+		map[string]string{alice.GetPublicKeyHex(): alice.GetPrivateKeyHex()})
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	if !tx.SignsSpentValues() || !strings.HasPrefix(tx.Inputs[0].ScriptSig, "v3:01:") {
+		t.Fatalf("Expected a v3 signature, got %q", tx.Inputs[0].ScriptSig)
+	}
+	if err := utxos.ValidateTransaction(tx); err != nil {
+		t.Fatalf("v3 signature should validate: %v", err)
+	}
+	if tx.VerifyInput(0, tx.Inputs[0].ScriptSig, alice.GetPublicKeyHex()) {
+		t.Error("A v3 signature should not verify without the spent output")
+	}
+
+	// A signer told the input is worth less signs a smaller fee than it pays
+	lied := TxOutput{Value: 91000000, ScriptPubKey: alice.GetPublicKeyHex()}
+	tx.Inputs[0].ScriptSig, _ = tx.SignInputSpending(0, alice.GetPrivateKeyHex(), SigHashAll, lied)
+	if !tx.VerifyInputSpending(0, tx.Inputs[0].ScriptSig, lied) {
+		t.Error("The signature should verify against the output it was made for")
+	}
+	if utxos.ValidateTransaction(tx) == nil {
+		t.Error("A signature over a false input value should not validate")
+	}
+
+	// Older versions still verify through the spent output
+	tx.Inputs[0].ScriptSig, _ = tx.SignInput(0, alice.GetPrivateKeyHex())
+	if err := utxos.ValidateTransaction(tx); err != nil || tx.SignsSpentValues() {
+		t.Errorf("v1 signatures should still validate: %v", err)
+	}
+}
+
+func TestSigHashFlagsCoverSelectedParts(t *testing.T) {
+	alice, bob := mustGenerateKeyPair(t), mustGenerateKeyPair(t)
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("fundA", 0, 60, alice.GetPublicKeyHex())
+	utxos.AddUTXO("fundB", 0, 50, bob.GetPublicKeyHex())
+	goal := []TxOutput{{Value: 100, ScriptPubKey: "project"}}
+
+	// Crowdfunding: each pledge commits to the goal and its own input only
+	pledge := func(kp *KeyPair, txID string) TxInput {
+		tx := NewUTXOTransaction([]TxInput{{TxID: txID, OutIndex: 0}}, goal)
+		sig, err := tx.SignInputWithFlag(0, kp.GetPrivateKeyHex(), SigHashAll|SigHashAnyoneCanPay)
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		return TxInput{TxID: txID, OutIndex: 0, ScriptSig: sig}
+	}
+	funded := NewUTXOTransaction([]TxInput{pledge(bob, "fundB"), pledge(alice, "fundA")}, goal)
+	if err := utxos.ValidateTransaction(funded); err != nil {
+		t.Fatalf("Combined pledges should validate: %v", err)
+	}
+	if funded.HasLegacySignatures() {
+		t.Error("Flagged signatures are not legacy")
+	}
+	redirected := NewUTXOTransaction(funded.Inputs, []TxOutput{{Value: 100, ScriptPubKey: "thief"}})
+	if utxos.ValidateTransaction(redirected) == nil {
+		t.Error("Pledges should not validate once the goal output changes")
+	}
+
+	// Without ANYONECANPAY adding an input breaks the signature
+	tx := NewUTXOTransaction([]TxInput{{TxID: "fundA", OutIndex: 0}}, goal)
+	tx.Inputs[0].ScriptSig, _ = tx.SignInputWithFlag(0, alice.GetPrivateKeyHex(), SigHashAll)
+	grown := NewUTXOTransaction(append([]TxInput{tx.Inputs[0]}, pledge(bob, "fundB")), goal)
+	if grown.VerifyInput(0, grown.Inputs[0].ScriptSig, alice.GetPublicKeyHex()) {
+		t.Error("An ALL signature should not survive an added input")
+	}
+
+	// SINGLE covers only the output paired with the input
+	tx = NewUTXOTransaction([]TxInput{{TxID: "fundA", OutIndex: 0}}, []TxOutput{{Value: 40, ScriptPubKey: "carol"}})
+	tx.Inputs[0].ScriptSig, _ = tx.SignInputWithFlag(0, alice.GetPrivateKeyHex(), SigHashSingle)
+	tx.Outputs = append(tx.Outputs, TxOutput{Value: 20, ScriptPubKey: "anyone"})
+	if err := utxos.ValidateTransaction(tx); err != nil {
+		t.Errorf("A SINGLE signature should allow other outputs: %v", err)
+	}
+	tx.Outputs[0].Value = 10
+	if utxos.ValidateTransaction(tx) == nil {
+		t.Error("A SINGLE signature should cover its own output")
+	}
+	if _, err := tx.SignInputWithFlag(0, alice.GetPrivateKeyHex(), SigHashSingle); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	tx.Outputs = nil
+	if _, err := tx.SignInputWithFlag(0, alice.GetPrivateKeyHex(), SigHashSingle); err == nil {
+		t.Error("SINGLE without a matching output should not sign")
+	}
+
+	// The flag is signed, so it cannot be swapped for a looser one
+	sig := funded.Inputs[1].ScriptSig
+	funded.Inputs[1].ScriptSig = strings.Replace(sig, "v2:81:", "v2:01:", 1)
+	if funded.VerifyInput(1, funded.Inputs[1].ScriptSig, alice.GetPublicKeyHex()) {
+		t.Error("A changed flag should not verify")
+	}
+	if _, _, _, ok := ParseScriptSig(strings.Replace(sig, "v2:81:", "v2:05:", 1)); ok {
+		t.Error("An invalid flag should not parse")
+	}
+
+	if flag, err := ParseSigHashFlag("single|anyonecanpay"); err != nil || flag.String() != "SINGLE|ANYONECANPAY" {
+		t.Errorf("Unexpected flag %v, %v", flag, err)
+	}
+	if _, err := ParseSigHashFlag("anyonecanpay"); err == nil {
+		t.Error("ANYONECANPAY alone should be refused")
+	}
+}
+
+func TestLockTimeAndCoinbaseMaturity(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	utxos := NewUTXOSet()
+	utxos.Height, utxos.CoinbaseMaturity = 5, 3
+	utxos.ProcessTransaction(NewCoinbaseTransaction(alice.GetPublicKeyHex(), 100000000, 5))
+	reward := utxos.FindUTXOsForAddress(alice.GetPublicKeyHex())[0]
+	if !reward.Coinbase || reward.Height != 5 {
+		t.Fatalf("The set should record the reward's height and origin, got %+v", reward)
+	}
+
+	inputs := []struct {
+		TxID     string
+		OutIndex int
+	}{{TxID: reward.TxID, OutIndex: 0}}
+	tx, err := utxos.CreateTransaction(inputs, []TxOutput{{Value: 90000000, ScriptPubKey: "bob"}},
+		map[string]string{alice.GetPublicKeyHex(): alice.GetPrivateKeyHex()})
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+
+	utxos.Height = 7
+	if err := utxos.ValidateTransaction(tx); err == nil || !strings.Contains(err.Error(), "immature") {
+		t.Errorf("A coinbase output should not be spent before maturity, got %v", err)
+	}
+	utxos.Height = 8
+	if err := utxos.ValidateTransaction(tx); err != nil {
+		t.Errorf("A matured coinbase output should be spendable: %v", err)
+	}
+	if copied := utxos.Copy(); !copied.Matured(copied.FindUTXO(reward.TxID, 0)) || copied.Height != 8 {
+		t.Error("Copies should keep heights and maturity")
+	}
+
+	// A lock time is signed, changes the ID, and holds the transaction back
+	id := tx.ID
+	tx.LockTime = 9
+	tx.ID = tx.CalculateHash()
+	if tx.ID == id || utxos.ValidateTransaction(tx) == nil {
+		t.Fatal("Changing the lock time should change the ID and break the signature")
+	}
+	tx.Inputs[0].ScriptSig, _ = tx.SignInputSpending(0, alice.GetPrivateKeyHex(), SigHashAll, reward.Output())
+	if err := utxos.ValidateTransaction(tx); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("A transaction should not be valid before its lock time, got %v", err)
+	}
+	utxos.Height = 9
+	if err := utxos.ValidateTransaction(tx); err != nil {
+		t.Errorf("A transaction should be valid from its lock time: %v", err)
+	}
+}
+
+func TestMemoIsCommittedAndCapped(t *testing.T) {
+	alice := mustGenerateKeyPair(t)
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("fund", 0, 100000, alice.GetPublicKeyHex())
+	inputs := []struct {
+		TxID     string
+		OutIndex int
+	}{{TxID: "fund", OutIndex: 0}}
+	outputs := []TxOutput{{Value: 90000, ScriptPubKey: "bob"}}
+	keys := map[string]string{alice.GetPublicKeyHex(): alice.GetPrivateKeyHex()}
+
+	plain, err := utxos.CreateTransaction(inputs, outputs, keys)
+	if err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	tx, err := utxos.CreateTransactionWithMemo(inputs, outputs, "invoice 42", keys)
+	if err != nil {
+		t.Fatalf("Failed to create transaction with memo: %v", err)
+	}
+	if tx.ID == plain.ID || tx.Memo != "invoice 42" {
+		t.Fatal("A memo should change the ID")
+	}
+	if err := utxos.ValidateTransaction(tx); err != nil || !tx.Verify() {
+		t.Fatalf("A transaction with a memo should be valid: %v", err)
+	}
+	data, _ := tx.Serialize()
+	restored, err := DeserializeTransaction(data)
+	if err != nil || restored.Memo != tx.Memo || restored.CalculateHash() != tx.ID {
+		t.Errorf("The memo should survive serialization, got %+v: %v", restored, err)
+	}
+
+	// The memo is signed, and quoted so it cannot imitate a lock time
+	tx.Memo = "invoice 43"
+	if utxos.ValidateTransaction(tx) == nil {
+		t.Error("Changing the memo should break the signature")
+	}
+	a := &Transaction{Outputs: outputs, Memo: "x\"locktime:5"}
+	b := &Transaction{Outputs: outputs, Memo: "x", LockTime: 5}
+	if a.CalculateHash() == b.CalculateHash() {
+		t.Error("A memo should not hash like another field")
+	}
+
+	long := strings.Repeat("m", MaxMemoBytes+1)
+	if _, err := utxos.CreateTransactionWithMemo(inputs, outputs, long, keys); err == nil {
+		t.Error("A memo over the limit should not be signed")
+	}
+	tx.Memo = long
+	if tx.Verify() || utxos.ValidateTransaction(tx) == nil {
+		t.Error("A memo over the limit should be invalid")
+	}
+	tx.Memo = "\xff\xfe"
+	if tx.Verify() || utxos.ValidateTransaction(tx) == nil {
+		t.Error("A memo that is not UTF-8 should be invalid")
+	}
+	coinbase := NewCoinbaseTransaction("miner", 50, 1)
+	coinbase.Memo = long
+	if coinbase.Verify() {
+		t.Error("The limit should apply to coinbase transactions too")
+	}
+}
+
+func TestScriptHashOutputs(t *testing.T) {
+	alice, bob, carol := mustGenerateKeyPair(t), mustGenerateKeyPair(t), mustGenerateKeyPair(t)
+	multisig := script.MultiSig(2, alice.GetPublicKeyHex(), bob.GetPublicKeyHex(), carol.GetPublicKeyHex())
+	locked, err := script.PayToScriptHash(multisig)
+	if err != nil {
+		t.Fatalf("Failed to lock to script: %v", err)
+	}
+	if IsUnspendable(locked) {
+		t.Fatal("Script hash outputs are spendable")
+	}
+	utxos := NewUTXOSet()
+	utxos.AddUTXO("fund", 0, 100000, locked)
+	spent := TxOutput{Value: 100000, ScriptPubKey: locked}
+
+	tx := NewUTXOTransaction([]TxInput{{TxID: "fund", OutIndex: 0}}, []TxOutput{{Value: 90000, ScriptPubKey: "dave"}})
+	sign := func(kp *KeyPair) string {
+		sig, err := tx.SignInputSpending(0, kp.GetPrivateKeyHex(), SigHashAll, spent)
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		return sig
+	}
+	tx.Inputs[0].ScriptSig = script.SpendScriptHash(multisig, sign(alice))
+	if err := utxos.ValidateTransaction(tx); err == nil || !strings.Contains(err.Error(), "script failed") {
+		t.Errorf("One signature of a 2-of-3 should not spend, got %v", err)
+	}
+	tx.Inputs[0].ScriptSig = script.SpendScriptHash(multisig, sign(alice), sign(carol))
+	if err := utxos.ValidateTransaction(tx); err != nil {
+		t.Errorf("Two signatures should spend: %v", err)
+	}
+	if !tx.SignsSpentValues() || tx.HasLegacySignatures() {
+		t.Error("The rules should see the v3 signatures passed to the script")
+	}
+
+	// A timelocked output is spendable only by a transaction locked to its height
+	timelocked := script.TimeLocked(20, bob.GetPublicKeyHex())
+	locked, _ = script.PayToScriptHash(timelocked)
+	utxos.AddUTXO("vault", 0, 50000, locked)
+	spent = TxOutput{Value: 50000, ScriptPubKey: locked}
+	tx = NewUTXOTransaction([]TxInput{{TxID: "vault", OutIndex: 0}}, []TxOutput{{Value: 40000, ScriptPubKey: "dave"}})
+	tx.Inputs[0].ScriptSig = script.SpendScriptHash(timelocked, sign(bob))
+	utxos.Height = 25
+	if err := utxos.ValidateTransaction(tx); err == nil {
+		t.Error("An unlocked transaction should not spend a timelocked output")
+	}
+	tx.LockTime = 20
+	tx.Inputs[0].ScriptSig = script.SpendScriptHash(timelocked, sign(bob))
+	if err := utxos.ValidateTransaction(tx); err != nil {
+		t.Errorf("A transaction locked to the height should spend: %v", err)
+	}
+}
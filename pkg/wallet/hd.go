@@ -0,0 +1,95 @@
+// Package wallet implements deterministic key derivation for wallets that
+// use a fresh address per payment, and an encrypted keystore file for
+// holding private keys at rest
+package wallet
+
+import (
+	"blockchain/pkg/transaction"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// SeedSize is the length in bytes of a generated HD wallet seed
+const SeedSize = 32
+
+var ErrInvalidSeed = errors.New("invalid HD wallet seed")
+
+// HDWallet derives an unbounded sequence of key pairs from a single seed.
+// Every child is derived directly from the seed (hardened-only, one level), so
+// knowing the seed is enough to recover all keys; it is not BIP32 compatible.
+type HDWallet struct {
+	seed []byte
+}
+
+// NewHDWallet creates a wallet from an existing seed
+func NewHDWallet(seed []byte) (*HDWallet, error) {
+	if len(seed) < 16 {
+		return nil, ErrInvalidSeed
+	}
+	s := make([]byte, len(seed))
+	copy(s, seed)
+	return &HDWallet{seed: s}, nil
+}
+
+// GenerateHDWallet creates a wallet from a fresh random seed
+func GenerateHDWallet() (*HDWallet, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, fmt.Errorf("failed to generate seed: %v", err)
+	}
+	return &HDWallet{seed: seed}, nil
+}
+
+// HDWalletFromHex restores a wallet from a hex-encoded seed
+func HDWalletFromHex(seedHex string) (*HDWallet, error) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSeed, err)
+	}
+	return NewHDWallet(seed)
+}
+
+// SeedHex returns the hex-encoded seed for backup
+func (w *HDWallet) SeedHex() string {
+	return hex.EncodeToString(w.seed)
+}
+
+// DeriveKey returns the key pair at the given index
+func (w *HDWallet) DeriveKey(index uint32) *transaction.KeyPair {
+	curve := elliptic.P256()
+	n := curve.Params().N
+
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], index)
+	mac := hmac.New(sha512.New, w.seed)
+	mac.Write(idx[:])
+	sum := mac.Sum(nil)
+
+	// Map the MAC output into [1, n-1] so the scalar is always a valid key
+	d := new(big.Int).SetBytes(sum)
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	priv := new(ecdsa.PrivateKey)
+	priv.PublicKey.Curve = curve
+	priv.D = d
+	priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+
+	return &transaction.KeyPair{
+		PrivateKey: priv,
+		PublicKey:  &priv.PublicKey,
+	}
+}
+
+// Address returns the address (hex public key) at the given index
+func (w *HDWallet) Address(index uint32) string {
+	return w.DeriveKey(index).GetPublicKeyHex()
+}
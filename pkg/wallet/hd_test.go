@@ -0,0 +1,45 @@
+package wallet
+
+import (
+	"blockchain/pkg/transaction"
+	"testing"
+)
+
+func TestDeriveKeyIsDeterministic(t *testing.T) {
+	w, err := GenerateHDWallet()
+	if err != nil {
+		t.Fatalf("Failed to generate wallet: %v", err)
+	}
+	restored, err := HDWalletFromHex(w.SeedHex())
+	if err != nil {
+		t.Fatalf("Failed to restore wallet: %v", err)
+	}
+
+	for i := uint32(0); i < 5; i++ {
+		if w.Address(i) != restored.Address(i) {
+			t.Errorf("Address %d differs after restoring from seed", i)
+		}
+	}
+	if w.Address(0) == w.Address(1) {
+		t.Error("Different indexes should derive different addresses")
+	}
+}
+
+func TestDerivedKeySigns(t *testing.T) {
+	w, _ := NewHDWallet([]byte("0123456789abcdef0123456789abcdef"))
+	kp := w.DeriveKey(7)
+
+	sig, err := transaction.SignECDSA("payload", kp.GetPrivateKeyHex())
+	if err != nil {
+		t.Fatalf("Failed to sign with derived key: %v", err)
+	}
+	if !transaction.VerifyECDSA("payload", sig, w.Address(7)) {
+		t.Error("Signature from derived key should verify against its address")
+	}
+}
+
+func TestRejectShortSeed(t *testing.T) {
+	if _, err := NewHDWallet([]byte("short")); err == nil {
+		t.Error("Seeds shorter than 16 bytes should be rejected")
+	}
+}
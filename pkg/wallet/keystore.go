@@ -0,0 +1,210 @@
+package wallet
+
+import (
+	"blockchain/pkg/transaction"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeystoreVersion is the version of the keystore file format
+const KeystoreVersion = 1
+
+const (
+	keystoreKDF    = "scrypt"
+	keystoreCipher = "aes-256-gcm"
+	keystoreSalt   = 32
+)
+
+var (
+	ErrKeyNotFound   = errors.New("key not found in keystore")
+	ErrDuplicateKey  = errors.New("key already in keystore")
+	ErrWrongPassword = errors.New("wrong keystore password")
+)
+
+// ScryptParams are the cost parameters of the key derivation
+type ScryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+// DefaultScryptParams costs about 32 MiB and a fraction of a second per key
+var DefaultScryptParams = ScryptParams{N: 1 << 15, R: 8, P: 1}
+
+// KeystoreKey is one private key, encrypted with AES-256-GCM under a key
+// derived from the password by scrypt. The address is authenticated with the
+// ciphertext, so entries cannot be swapped between addresses.
+type KeystoreKey struct {
+	Name       string       `json:"name"`
+	Address    string       `json:"address"` // Public key (hex)
+	CreatedAt  string       `json:"created_at"`
+	KDF        string       `json:"kdf"`
+	KDFParams  ScryptParams `json:"kdfparams"`
+	Salt       string       `json:"salt"`
+	Cipher     string       `json:"cipher"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+// Keystore is a file of encrypted private keys. Names and addresses are
+// stored in the clear so keys can be listed without the password.
+type Keystore struct {
+	Version int           `json:"version"`
+	Keys    []KeystoreKey `json:"keys"`
+
+	path   string
+	params ScryptParams
+}
+
+// OpenKeystore loads the keystore at path, or returns an empty one if the
+// file does not exist yet
+func OpenKeystore(path string) (*Keystore, error) {
+	ks := &Keystore{Version: KeystoreVersion, path: path, params: DefaultScryptParams}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, fmt.Errorf("invalid keystore %s: %v", path, err)
+	}
+	if ks.Version != KeystoreVersion {
+		return nil, fmt.Errorf("keystore %s has unsupported version %d", path, ks.Version)
+	}
+	return ks, nil
+}
+
+// Path returns the file the keystore is saved to
+func (ks *Keystore) Path() string {
+	return ks.path
+}
+
+// SetScryptParams sets the cost of keys added from now on
+func (ks *Keystore) SetScryptParams(params ScryptParams) {
+	ks.params = params
+}
+
+// Find returns the key with the given name or address, or nil
+func (ks *Keystore) Find(ref string) *KeystoreKey {
+	for i := range ks.Keys {
+		if ks.Keys[i].Name == ref || ks.Keys[i].Address == ref {
+			return &ks.Keys[i]
+		}
+	}
+	return nil
+}
+
+// Add encrypts a hex private key under password and adds it under name
+func (ks *Keystore) Add(name, privateKeyHex, password string) (*KeystoreKey, error) {
+	priv, err := transaction.HexToPrivateKey(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	address := transaction.PublicKeyToHex(&priv.PublicKey)
+	if name == "" {
+		return nil, errors.New("key name is required")
+	}
+	if ks.Find(name) != nil || ks.Find(address) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, name)
+	}
+
+	salt := make([]byte, keystoreSalt)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := keystoreAEAD(password, salt, ks.params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ks.Keys = append(ks.Keys, KeystoreKey{
+		Name:       name,
+		Address:    address,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		KDF:        keystoreKDF,
+		KDFParams:  ks.params,
+		Salt:       hex.EncodeToString(salt),
+		Cipher:     keystoreCipher,
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, []byte(privateKeyHex), []byte(address))),
+	})
+	return &ks.Keys[len(ks.Keys)-1], nil
+}
+
+// Decrypt returns the hex private key of the key with the given name or address
+func (ks *Keystore) Decrypt(ref, password string) (string, error) {
+	key := ks.Find(ref)
+	if key == nil {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, ref)
+	}
+	if key.KDF != keystoreKDF || key.Cipher != keystoreCipher {
+		return "", fmt.Errorf("key %s uses unsupported encryption %s/%s", key.Name, key.KDF, key.Cipher)
+	}
+	salt, err := hex.DecodeString(key.Salt)
+	if err != nil {
+		return "", fmt.Errorf("key %s has an invalid salt: %v", key.Name, err)
+	}
+	nonce, err := hex.DecodeString(key.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("key %s has an invalid nonce: %v", key.Name, err)
+	}
+	ciphertext, err := hex.DecodeString(key.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("key %s has an invalid ciphertext: %v", key.Name, err)
+	}
+	aead, err := keystoreAEAD(password, salt, key.KDFParams)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", fmt.Errorf("key %s has an invalid nonce", key.Name)
+	}
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(key.Address))
+	if err != nil {
+		return "", ErrWrongPassword
+	}
+	return string(plain), nil
+}
+
+// Save writes the keystore to its file, readable only by the owner. The file
+// is replaced atomically so a crash never leaves it half-written.
+func (ks *Keystore) Save() error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return err
+	}
+	tmp := ks.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
+
+// keystoreAEAD derives the AES-256-GCM cipher for one key
+func keystoreAEAD(password string, salt []byte, params ScryptParams) (cipher.AEAD, error) {
+	dk, err := Scrypt([]byte(password), salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"blockchain/pkg/transaction"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testScryptParams keeps key derivation fast in tests
+var testScryptParams = ScryptParams{N: 16, R: 1, P: 1}
+
+func TestScryptVectors(t *testing.T) {
+	// Test vectors from RFC 7914, section 12
+	cases := []struct {
+		password, salt string
+		N, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1,
+			"77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16,
+			"fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+	for _, c := range cases {
+		dk, err := Scrypt([]byte(c.password), []byte(c.salt), c.N, c.r, c.p, 64)
+		if err != nil {
+			t.Fatalf("Scrypt failed: %v", err)
+		}
+		if got := hex.EncodeToString(dk); got != c.want {
+			t.Errorf("Scrypt(%q, %q) = %s, want %s", c.password, c.salt, got, c.want)
+		}
+	}
+	if _, err := Scrypt(nil, nil, 15, 1, 1, 32); err == nil {
+		t.Error("N must be a power of two")
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet", "keystore.json")
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatalf("Opening a missing keystore should start empty: %v", err)
+	}
+	ks.SetScryptParams(testScryptParams)
+
+	kp, _ := transaction.GenerateKeyPair()
+	key, err := ks.Add("alice", kp.GetPrivateKeyHex(), "hunter2")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if key.Address != kp.GetPublicKeyHex() {
+		t.Errorf("Stored address %s should be the key's public key", key.Address)
+	}
+	if _, err := ks.Add("bob", kp.GetPrivateKeyHex(), "hunter2"); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Expected ErrDuplicateKey for the same key under another name, got %v", err)
+	}
+	if err := ks.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), kp.GetPrivateKeyHex()) {
+		t.Fatal("The keystore file must not hold the private key in the clear")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Keystore should be owner-only, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatalf("OpenKeystore failed: %v", err)
+	}
+	for _, ref := range []string{"alice", kp.GetPublicKeyHex()} {
+		priv, err := loaded.Decrypt(ref, "hunter2")
+		if err != nil || priv != kp.GetPrivateKeyHex() {
+			t.Errorf("Decrypt(%s) = %v, expected the original key", ref, err)
+		}
+	}
+	if _, err := loaded.Decrypt("alice", "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Expected ErrWrongPassword, got %v", err)
+	}
+	if _, err := loaded.Decrypt("carol", "hunter2"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	// The ciphertext is bound to its address
+	other, _ := transaction.GenerateKeyPair()
+	loaded.Keys[0].Address = other.GetPublicKeyHex()
+	if _, err := loaded.Decrypt("alice", "hunter2"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("A key moved to another address should not decrypt, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package test
+
+import (
+	"blockchain/pkg/block"
+	"blockchain/pkg/network"
+	"blockchain/pkg/pow"
+	"blockchain/pkg/transaction"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// The RPC types as the first release of the client knew them. They are
+// frozen here rather than taken from pkg/network, so a change to the wire
+// format that breaks old clients fails these tests instead of changing
+// along with them.
+type legacyTransactionArgs struct {
+	InputSpecs []struct {
+		TxID     string
+		OutIndex int
+	}
+	Outputs     []transaction.TxOutput
+	PrivateKeys map[string]string
+}
+
+type legacyTransactionReply struct {
+	Success bool
+	TxID    string
+	Error   string
+}
+
+type legacyChainArgs struct {
+	StartIndex int64
+}
+
+type legacyChainReply struct {
+	Blocks [][]byte
+	Length int
+}
+
+type legacyStatusReply struct {
+	ID          string
+	ChainLength int
+	PendingTxs  int
+	Peers       int
+	Mining      bool
+}
+
+// startFundedMiner starts a miner whose chain holds a block paying
+// 50 BTC to the returned key pair
+func startFundedMiner(t *testing.T, address string) (*network.Miner, *transaction.KeyPair, string) {
+	kp, err := transaction.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	miner := network.NewMiner("compat", address, 1, nil)
+	coinbase := transaction.NewCoinbaseTransaction(kp.GetPublicKeyHex(), 5000000000, 1)
+	b := miner.Blockchain.CreateBlock([]*transaction.Transaction{coinbase}, "compat")
+	result := pow.NewProofOfWork(b).Mine(context.Background(), nil)
+	if err := miner.Blockchain.AddBlock(result.Block); err != nil {
+		t.Fatalf("Failed to add funding block: %v", err)
+	}
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Failed to start miner: %v", err)
+	}
+	t.Cleanup(miner.Stop)
+	return miner, kp, coinbase.ID
+}
+
+// deprecatedCalls returns how often the miner served each deprecated form
+func deprecatedCalls(miner *network.Miner) map[string]int64 {
+	calls := make(map[string]int64)
+	for _, d := range miner.Deprecations() {
+		calls[d.Form] = d.Calls
+	}
+	return calls
+}
+
+// Test that a client speaking the original RPC types still works
+func TestCompat_LegacyRPCTypes(t *testing.T) {
+	miner, kp, fundingID := startFundedMiner(t, "localhost:18150")
+	client, err := rpc.Dial("tcp", "localhost:18150")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	var status legacyStatusReply
+	if err := client.Call("RPCService.GetStatus", &struct{}{}, &status); err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status.ID != "compat" || status.ChainLength != 2 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Without Count the whole chain comes back, as it always did
+	var chain legacyChainReply
+	if err := client.Call("RPCService.GetChain", &legacyChainArgs{StartIndex: 0}, &chain); err != nil {
+		t.Fatalf("GetChain failed: %v", err)
+	}
+	if chain.Length != 2 || len(chain.Blocks) != 2 {
+		t.Fatalf("Expected the whole chain, got %d of %d blocks", len(chain.Blocks), chain.Length)
+	}
+	for i, data := range chain.Blocks {
+		if _, err := block.DeserializeBlock(data); err != nil {
+			t.Errorf("Block %d no longer decodes: %v", i, err)
+		}
+	}
+
+	args := &legacyTransactionArgs{
+		Outputs:     []transaction.TxOutput{{Value: 1000000000, ScriptPubKey: "bob"}, {Value: 3999990000, ScriptPubKey: kp.GetPublicKeyHex()}},
+		PrivateKeys: map[string]string{kp.GetPublicKeyHex(): kp.GetPrivateKeyHex()},
+	}
+	args.InputSpecs = append(args.InputSpecs, struct {
+		TxID     string
+		OutIndex int
+	}{fundingID, 0})
+	var reply legacyTransactionReply
+	if err := client.Call("RPCService.SubmitTransaction", args, &reply); err != nil {
+		t.Fatalf("SubmitTransaction failed: %v", err)
+	}
+	if !reply.Success || reply.TxID == "" {
+		t.Fatalf("Transaction refused: %s", reply.Error)
+	}
+	if len(miner.GetPendingTransactions()) != 1 {
+		t.Error("Expected the transaction in the mempool")
+	}
+
+	calls := deprecatedCalls(miner)
+	if calls[network.DeprecatedFullChain] != 1 || calls[network.DeprecatedSubmitTransaction] != 1 {
+		t.Errorf("Expected each deprecated form counted once, got %v", calls)
+	}
+}
+
+// Test that the current client pages through the chain instead of asking
+// for all of it
+func TestCompat_CurrentClientAvoidsDeprecatedForms(t *testing.T) {
+	miner, _, _ := startFundedMiner(t, "localhost:18151")
+	blocks, err := network.NewClient("client", nil).GetChain("localhost:18151")
+	if err != nil || len(blocks) != 2 {
+		t.Fatalf("GetChain failed: %d blocks, %v", len(blocks), err)
+	}
+	if calls := deprecatedCalls(miner); calls[network.DeprecatedFullChain] != 0 {
+		t.Errorf("The client should not use deprecated forms, got %v", calls)
+	}
+}
+
+// runOldClient runs the client binary named by COMPAT_CLIENT and decodes
+// its JSON output into v
+func runOldClient(t *testing.T, v interface{}, args ...string) {
+	out, err := exec.Command(os.Getenv("COMPAT_CLIENT"), args...).Output()
+	if err != nil {
+		t.Fatalf("client %v failed: %v\n%s", args, err, out)
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		t.Fatalf("client %v printed invalid JSON: %v\n%s", args, err, out)
+	}
+}
+
+// Test an old client binary against the current miner. test_compat.sh
+// builds one from an earlier commit and sets COMPAT_CLIENT to it.
+func TestCompat_OldClientBinary(t *testing.T) {
+	if os.Getenv("COMPAT_CLIENT") == "" {
+		t.Skip("COMPAT_CLIENT not set; run test_compat.sh")
+	}
+	miner, kp, fundingID := startFundedMiner(t, "localhost:18152")
+	addr := "localhost:18152"
+
+	var status struct {
+		ChainLength     int    `json:"chain_length"`
+		LatestBlockHash string `json:"latest_block_hash"`
+		MinerStatus     *struct {
+			ID string
+		} `json:"miner_status"`
+	}
+	runOldClient(t, &status, "blockchain", "-miner", addr)
+	if status.ChainLength != 2 || status.LatestBlockHash != miner.Blockchain.GetLatestBlock().Hash {
+		t.Errorf("Unexpected chain status %+v", status)
+	}
+	if status.MinerStatus == nil || status.MinerStatus.ID != "compat" {
+		t.Errorf("Expected the miner status, got %+v", status.MinerStatus)
+	}
+
+	var balance struct {
+		Balance   int64 `json:"balance"`
+		UTXOCount int   `json:"utxo_count"`
+	}
+	runOldClient(t, &balance, "balance", "-miner", addr, "-address", kp.GetPublicKeyHex())
+	if balance.Balance != 5000000000 || balance.UTXOCount != 1 {
+		t.Errorf("Unexpected balance %+v", balance)
+	}
+
+	var transfer struct {
+		Success bool   `json:"success"`
+		TxID    string `json:"txid"`
+		Error   string `json:"error"`
+	}
+	runOldClient(t, &transfer, "transfer", "-miner", addr,
+		"-from", kp.GetPublicKeyHex(), "-privkey", kp.GetPrivateKeyHex(),
+		"-inputs", fmt.Sprintf("%s:0", fundingID),
+		"-outputs", fmt.Sprintf("bob:1000000000,%s:3999990000", kp.GetPublicKeyHex()))
+	if !transfer.Success || transfer.TxID == "" {
+		t.Fatalf("Transfer failed: %s", transfer.Error)
+	}
+	pending := miner.GetPendingTransactions()
+	if len(pending) != 1 || pending[0].ID != transfer.TxID {
+		t.Errorf("Expected the transfer in the mempool, got %d pending", len(pending))
+	}
+}
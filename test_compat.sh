@@ -0,0 +1,38 @@
+#!/bin/bash
+# Compatibility test: runs a client built from an earlier commit against the
+# current miner, to check that the RPCs older clients depend on still work.
+# Usage: ./test_compat.sh [git-ref]   (default: the first commit)
+
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+BIN_OLD_CLIENT="${SCRIPT_DIR}/bin/client-old"
+REF="${1:-$(git -C "${SCRIPT_DIR}" rev-list --max-parents=0 HEAD | tail -n 1)}"
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+NC='\033[0m' # No Color
+
+echo_info() { echo -e "${GREEN}[INFO]${NC} $1"; }
+echo_error() { echo -e "${RED}[ERROR]${NC} $1"; }
+
+WORKTREE="$(mktemp -d)"
+cleanup() {
+    git -C "${SCRIPT_DIR}" worktree remove --force "${WORKTREE}" 2>/dev/null || rm -rf "${WORKTREE}"
+}
+trap cleanup EXIT
+
+echo_info "Building the client at $(git -C "${SCRIPT_DIR}" rev-parse --short "${REF}")..."
+git -C "${SCRIPT_DIR}" worktree add --detach "${WORKTREE}" "${REF}" > /dev/null
+mkdir -p "${SCRIPT_DIR}/bin"
+(cd "${WORKTREE}" && go build -o "${BIN_OLD_CLIENT}" ./cmd/client)
+
+echo_info "Running the compatibility tests against the current miner..."
+cd "${SCRIPT_DIR}"
+if COMPAT_CLIENT="${BIN_OLD_CLIENT}" go test ./test -run 'TestCompat_' -count=1 -v; then
+    echo_info "The old client works with the current miner"
+else
+    echo_error "Compatibility tests failed"
+    exit 1
+fi